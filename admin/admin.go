@@ -0,0 +1,159 @@
+// Package admin serves operator endpoints on a listener separate from the proxies.
+package admin
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/health"
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+	"github.com/spicyneuron/llama-matchmaker/proxy"
+	"github.com/spicyneuron/llama-matchmaker/traffic"
+	"github.com/spicyneuron/llama-matchmaker/usage"
+	"github.com/spicyneuron/llama-matchmaker/version"
+)
+
+// Admin endpoint paths
+const (
+	UsagePath     = "/admin/usage"     // Usage aggregates; see usage.Report
+	DashboardPath = "/admin/dashboard" // Live traffic UI
+	TrafficPath   = "/admin/traffic"   // Recent requests and target health, as JSON
+	VersionPath   = "/version"         // Build info; see version.Info
+	MonitorPath   = "/admin/monitor"   // Live activity for the monitor command; see Monitor
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// PprofPath serves net/http/pprof profiles when admin.pprof is set
+const PprofPath = "/debug/pprof/"
+
+// NewHandler returns the admin endpoint mux
+func NewHandler(cfg config.AdminConfig) http.Handler {
+	mux := http.NewServeMux()
+	if cfg.Pprof {
+		mux.HandleFunc("GET "+PprofPath, pprof.Index)
+		mux.HandleFunc("GET "+PprofPath+"cmdline", pprof.Cmdline)
+		mux.HandleFunc("GET "+PprofPath+"profile", pprof.Profile)
+		mux.HandleFunc("GET "+PprofPath+"symbol", pprof.Symbol)
+		mux.HandleFunc("POST "+PprofPath+"symbol", pprof.Symbol)
+		mux.HandleFunc("GET "+PprofPath+"trace", pprof.Trace)
+	}
+	mux.HandleFunc("GET /metrics", serveMetrics)
+	mux.HandleFunc("GET "+health.LivePath, health.ServeLive)
+	mux.HandleFunc("GET "+health.ReadyPath, health.Default.ReadyHandler(""))
+	mux.HandleFunc("GET "+UsagePath, serveUsage)
+	mux.HandleFunc("GET "+DashboardPath, serveDashboard)
+	mux.HandleFunc("GET "+TrafficPath, serveTraffic)
+	mux.HandleFunc("GET "+TrafficPath+"/{id}", serveExchange)
+	mux.HandleFunc("GET "+VersionPath, serveVersion)
+	mux.HandleFunc("GET "+ConfigPath, serveConfig)
+	mux.HandleFunc("GET "+RoutesPath, serveRoutes)
+	mux.HandleFunc("GET "+MonitorPath, serveMonitor)
+	mux.HandleFunc("POST "+ReloadPath, serveReload)
+	return mux
+}
+
+func serveMetrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WritePrometheus(w)
+}
+
+// serveUsage reports usage over ?since= (a Go duration, default 24h)
+func serveUsage(w http.ResponseWriter, req *http.Request) {
+	window := 24 * time.Hour
+	if since := req.URL.Query().Get("since"); since != "" {
+		parsed, err := time.ParseDuration(since)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "since must be a positive duration (ex: 24h)", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage.Default.Report(window))
+}
+
+func serveDashboard(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardPage)
+}
+
+// trafficSnapshot is what the dashboard polls
+type trafficSnapshot struct {
+	Enabled  bool               `json:"enabled"`
+	Requests []traffic.Exchange `json:"requests"`
+	Health   []traffic.Health   `json:"health"`
+}
+
+// serveTraffic lists recent requests, newest first, without bodies
+func serveTraffic(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trafficSnapshot{
+		Enabled:  traffic.Default.Enabled(),
+		Requests: traffic.Default.Recent(),
+		Health:   traffic.Default.Health(),
+	})
+}
+
+// serveExchange returns one request with its bodies, diffs, and stream timeline
+func serveExchange(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseUint(req.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id must be a request number", http.StatusBadRequest)
+		return
+	}
+	exchange, ok := traffic.Default.Get(id)
+	if !ok {
+		http.Error(w, "request not found (it may have been evicted)", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exchange)
+}
+
+// Monitor is what the monitor command polls. Rates come from the change in request counts
+// between polls.
+type Monitor struct {
+	Time     time.Time          `json:"time"`
+	Proxies  []proxy.ProxyStats `json:"proxies"`
+	Health   health.Status      `json:"health"`
+	Traffic  bool               `json:"traffic"` // Whether recent requests are recorded (admin.dashboard)
+	Targets  []traffic.Health   `json:"targets,omitempty"`
+	Requests []traffic.Exchange `json:"requests,omitempty"` // Newest first, without bodies
+}
+
+// serveMonitor reports live activity; ?requests= caps the request log (default 50)
+func serveMonitor(w http.ResponseWriter, req *http.Request) {
+	limit := 50
+	if n := req.URL.Query().Get("requests"); n != "" {
+		parsed, err := strconv.Atoi(n)
+		if err != nil || parsed < 0 {
+			http.Error(w, "requests must be a non-negative count", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	recent := traffic.Default.Recent()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Monitor{
+		Time:     time.Now(),
+		Proxies:  proxy.Stats(),
+		Health:   health.Default.Status(""),
+		Traffic:  traffic.Default.Enabled(),
+		Targets:  traffic.Default.Health(),
+		Requests: recent[:min(limit, len(recent))],
+	})
+}
+
+func serveVersion(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.Get())
+}
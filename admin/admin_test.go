@@ -0,0 +1,291 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/health"
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+	"github.com/spicyneuron/llama-matchmaker/proxy"
+	"github.com/spicyneuron/llama-matchmaker/traffic"
+	"github.com/spicyneuron/llama-matchmaker/usage"
+	"github.com/spicyneuron/llama-matchmaker/version"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	metrics.NewCounter("admin_test_total", "Counter rendered by the admin test").Add(1)
+
+	rec := httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "admin_test_total 1\n") {
+		t.Fatalf("metrics output missing counter:\n%s", rec.Body.String())
+	}
+}
+
+func TestPprofIsOptIn(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", PprofPath, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status without pprof = %d, want 404", rec.Code)
+	}
+
+	h := NewHandler(config.AdminConfig{Pprof: true})
+	for _, path := range []string{PprofPath, PprofPath + "goroutine?debug=1", PprofPath + "heap?debug=1"} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d, want 200", path, rec.Code)
+		}
+	}
+}
+
+func TestUsageEndpoint(t *testing.T) {
+	usage.Default.Record(usage.Entry{APIKey: "…test", Model: "admin-usage-test", Route: "0", PromptTokens: 4})
+
+	rec := httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", "/admin/usage?since=1h", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	var report usage.Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	found := false
+	for _, row := range report.Rows {
+		if row.Model == "admin-usage-test" && row.PromptTokens == 4 {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("report missing recorded row: %+v", report)
+	}
+
+	rec = httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", "/admin/usage?since=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400 for invalid since", rec.Code)
+	}
+}
+
+func TestTrafficEndpoints(t *testing.T) {
+	traffic.Default.Configure(5, 1024)
+	t.Cleanup(func() { traffic.Default.Configure(0, 0) })
+	id := traffic.Default.Start(traffic.Exchange{Method: "POST", Path: "/v1/chat/completions", Request: `{"model":"m"}`})
+
+	rec := httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", "/admin/traffic", nil))
+	var snapshot trafficSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !snapshot.Enabled || len(snapshot.Requests) != 1 || snapshot.Requests[0].Request != "" {
+		t.Fatalf("snapshot = %+v, want one request listed without its body", snapshot)
+	}
+
+	rec = httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", "/admin/traffic/"+strconv.FormatUint(id, 10), nil))
+	var exchange traffic.Exchange
+	json.Unmarshal(rec.Body.Bytes(), &exchange)
+	if rec.Code != http.StatusOK || exchange.Request != `{"model":"m"}` {
+		t.Fatalf("exchange = %d %+v, want the request body", rec.Code, exchange)
+	}
+
+	rec = httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", "/admin/traffic/999", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404 for an unknown request", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", "/admin/dashboard", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<title>Llama Matchmaker traffic</title>") {
+		t.Fatalf("dashboard = %d, want the embedded page", rec.Code)
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	health.Default.Register("admin-test:1", []string{"http://admin-test"})
+	defer health.Default.Reset()
+
+	for path, want := range map[string]int{health.LivePath: http.StatusOK, health.ReadyPath: http.StatusOK} {
+		rec := httptest.NewRecorder()
+		NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, want)
+		}
+	}
+
+	health.Default.SetUp("admin-test:1", "http://admin-test", false)
+	rec := httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", health.ReadyPath, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("GET %s with every target down = %d, want 503", health.ReadyPath, rec.Code)
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", VersionPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	var info version.Info
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version == "" || info.GoVersion == "" || info.Platform == "" {
+		t.Fatalf("info = %+v", info)
+	}
+}
+
+func TestConfigEndpoint(t *testing.T) {
+	t.Cleanup(func() { state, liveConfig, listenAddrs = nil, nil, nil })
+
+	rec := httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", ConfigPath, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status before load = %d, want 503", rec.Code)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	yaml := `proxy:
+  listen: localhost:8081
+  target: http://localhost:8080
+  routes:
+    - name: chat
+      methods: POST
+      paths: ^/v1/chat/completions$
+      on_request:
+        - template: '{"model": {{ toJson .model }}}'
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, files, err := config.Load([]string{path}, config.CliOverrides{})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	SetListenAddrs(map[string][]string{"localhost:8081": {"localhost:8081"}})
+	SetConfig(cfg, files)
+	SetConfig(cfg, append(files, filepath.Join(t.TempDir(), "missing.yml")))
+
+	rec = httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", ConfigPath, nil))
+	var got ConfigState
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if got.Reloads != 1 {
+		t.Fatalf("reloads = %d, want 1", got.Reloads)
+	}
+	if len(got.Files) != 2 || got.Files[0].Path != path || len(got.Files[0].SHA256) != 64 || got.Files[0].Size != int64(len(yaml)) {
+		t.Fatalf("files = %+v, want the config with its hash", got.Files)
+	}
+	if got.Files[1].Error == "" || got.Files[1].SHA256 != "" {
+		t.Fatalf("missing file = %+v, want an error instead of a hash", got.Files[1])
+	}
+	if len(got.Proxies) != 1 || len(got.Proxies[0].Routes) != 1 || len(got.Proxies[0].Addresses) != 1 {
+		t.Fatalf("proxies = %+v, want one proxy with its address and one route", got.Proxies)
+	}
+	route := got.Proxies[0].Routes[0]
+	if route.Name != "chat" || len(route.Paths) != 1 || route.Paths[0] != "(?i)^/v1/chat/completions$" || len(route.Templates) != 1 {
+		t.Fatalf("route = %+v, want compiled path and template name", route)
+	}
+}
+
+func TestMonitorEndpoint(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", MonitorPath+"?requests=5", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var snap Monitor
+	if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if snap.Time.IsZero() || snap.Health.Proxies == nil {
+		t.Fatalf("snapshot = %+v, want a timestamp and health", snap)
+	}
+
+	rec = httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", MonitorPath+"?requests=-1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400 for a negative count", rec.Code)
+	}
+}
+
+func TestRoutesEndpoint(t *testing.T) {
+	t.Cleanup(func() { state, liveConfig = nil, nil })
+
+	rec := httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", RoutesPath, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status before load = %d, want 503", rec.Code)
+	}
+
+	cfg := &config.Config{Proxies: config.ProxyEntries{{
+		Listen: "admin-routes-test:1",
+		Routes: []config.Route{{Name: "never"}},
+	}}}
+	SetConfig(cfg, nil)
+
+	rec = httptest.NewRecorder()
+	NewHandler(config.AdminConfig{}).ServeHTTP(rec, httptest.NewRequest("GET", RoutesPath+"?unused=true", nil))
+	var got []proxy.RouteUsage
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "never" || got[0].Hits != 0 {
+		t.Fatalf("unused routes = %+v, want the never-matched route", got)
+	}
+}
+
+func TestReloadEndpoint(t *testing.T) {
+	defer SetReloader(nil)
+	h := NewHandler(config.AdminConfig{})
+	post := func(path string) (int, ReloadResult) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", path, nil))
+		var result ReloadResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body.String(), err)
+		}
+		return rec.Code, result
+	}
+
+	if code, _ := post(ReloadPath); code != http.StatusServiceUnavailable {
+		t.Fatalf("status without a reloader = %d, want 503", code)
+	}
+
+	SetReloader(func(force bool) error {
+		if !force {
+			return fmt.Errorf("%w: too many routes removed", config.ErrReloadRefused)
+		}
+		return nil
+	})
+	code, result := post(ReloadPath)
+	if code != http.StatusConflict || result.Reloaded || !strings.Contains(result.Error, "too many routes") {
+		t.Fatalf("guarded reload = %d %+v, want 409 with the reason", code, result)
+	}
+	code, result = post(ReloadPath + "?force=true")
+	if code != http.StatusOK || !result.Reloaded || !result.Forced {
+		t.Fatalf("forced reload = %d %+v, want 200 reloaded", code, result)
+	}
+}
@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// ReloadPath reloads the config files on POST; ?force=true skips the reload guard
+const ReloadPath = "/admin/reload"
+
+var (
+	reloaderMu sync.RWMutex
+	reloader   func(force bool) error
+)
+
+// SetReloader sets the function POST ReloadPath calls. Without one, it answers 503.
+func SetReloader(fn func(force bool) error) {
+	reloaderMu.Lock()
+	defer reloaderMu.Unlock()
+	reloader = fn
+}
+
+// ReloadResult is the reply to POST ReloadPath
+type ReloadResult struct {
+	Reloaded bool   `json:"reloaded"`
+	Forced   bool   `json:"forced,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func serveReload(w http.ResponseWriter, req *http.Request) {
+	reloaderMu.RLock()
+	fn := reloader
+	reloaderMu.RUnlock()
+
+	force, _ := strconv.ParseBool(req.URL.Query().Get("force"))
+	result := ReloadResult{Forced: force}
+	status := http.StatusOK
+	switch {
+	case fn == nil:
+		status, result.Error = http.StatusServiceUnavailable, "reloads are not available"
+	default:
+		if err := fn(force); err != nil {
+			status, result.Error = http.StatusInternalServerError, err.Error()
+			if errors.Is(err, config.ErrReloadRefused) {
+				status = http.StatusConflict
+			}
+		} else {
+			result.Reloaded = true
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,199 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/proxy"
+)
+
+// ConfigPath serves the live config state; see ConfigState
+const ConfigPath = "/admin/config"
+
+// RoutesPath serves every live route's hits and last match; see proxy.RouteUsage
+const RoutesPath = "/admin/routes"
+
+// ConfigState is what the running proxies were built from, for confirming that a reload
+// took effect and which file versions are live
+type ConfigState struct {
+	LoadedAt      time.Time     `json:"loaded_at"`
+	Reloads       int           `json:"reloads"` // Successful reloads since startup
+	Files         []WatchedFile `json:"files"`
+	Proxies       []ProxyState  `json:"proxies"`
+	TemplateFuncs []string      `json:"template_funcs,omitempty"` // Registered plugin funcs
+}
+
+// WatchedFile is a config file (or included fragment, or SSL file) as it was when loaded
+type WatchedFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// ProxyState is one proxy's listener, backends, and compiled routes
+type ProxyState struct {
+	Listen    string       `json:"listen"`
+	Addresses []string     `json:"addresses,omitempty"` // Every bound address, with the ports the OS chose for port 0
+	Targets   []string     `json:"targets"`
+	Routes    []RouteState `json:"routes"`
+}
+
+// RouteState is a route as compiled: the regexes it matches with and its parsed templates
+type RouteState struct {
+	Index      int      `json:"index"`
+	Name       string   `json:"name,omitempty"`
+	Source     string   `json:"source,omitempty"`
+	Methods    []string `json:"methods"`
+	Paths      []string `json:"paths"`
+	TargetPath string   `json:"target_path,omitempty"`
+	Templates  []string `json:"templates,omitempty"`
+	Prompts    []string `json:"prompts,omitempty"` // Models with a chat template; "" is the route default
+	Funcs      []string `json:"funcs,omitempty"`
+}
+
+var (
+	stateMu     sync.RWMutex
+	state       *ConfigState
+	liveConfig  *config.Config
+	listenAddrs map[string][]string
+)
+
+// SetListenAddrs records the addresses each proxy (by listen) bound to, for the next
+// SetConfig. Call it as the proxies start, so test harnesses using listen: ":0" can find
+// their ports.
+func SetListenAddrs(addrs map[string][]string) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	listenAddrs = addrs
+}
+
+// SetConfig records cfg and its watch list as live. Call it after the proxies start
+// with them; every call after the first counts as a reload.
+func SetConfig(cfg *config.Config, files []string) {
+	next := &ConfigState{
+		LoadedAt:      time.Now(),
+		Files:         make([]WatchedFile, 0, len(files)),
+		Proxies:       make([]ProxyState, 0, len(cfg.Proxies)),
+		TemplateFuncs: config.TemplateFuncNames(),
+	}
+	for _, path := range files {
+		next.Files = append(next.Files, watchedFile(path))
+	}
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	for _, proxy := range cfg.Proxies {
+		ps := proxyState(proxy)
+		ps.Addresses = listenAddrs[proxy.Listen]
+		next.Proxies = append(next.Proxies, ps)
+	}
+	if state != nil {
+		next.Reloads = state.Reloads + 1
+	}
+	state = next
+	liveConfig = cfg
+}
+
+func watchedFile(path string) WatchedFile {
+	file := WatchedFile{Path: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		file.Error = err.Error()
+		return file
+	}
+	file.Size, file.ModTime = info.Size(), info.ModTime()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		file.Error = err.Error()
+		return file
+	}
+	sum := sha256.Sum256(data)
+	file.SHA256 = hex.EncodeToString(sum[:])
+	return file
+}
+
+func proxyState(proxy config.ProxyConfig) ProxyState {
+	ps := ProxyState{
+		Listen:  proxy.Listen,
+		Targets: proxy.AllTargets(),
+		Routes:  make([]RouteState, 0, len(proxy.Routes)),
+	}
+	for i, route := range proxy.Routes {
+		rs := RouteState{
+			Index:      i,
+			Name:       route.Name,
+			Source:     route.Source,
+			Methods:    regexSources(route.Methods.Compiled),
+			Paths:      regexSources(route.Paths.Compiled),
+			TargetPath: route.TargetPath,
+			Funcs:      route.Funcs,
+		}
+		if compiled := route.Compiled; compiled != nil {
+			for _, tmpl := range slices.Concat(compiled.OnRequestTemplates, compiled.OnResponseTemplates) {
+				if tmpl != nil {
+					rs.Templates = append(rs.Templates, tmpl.Name())
+				}
+			}
+			for model := range compiled.Prompts {
+				rs.Prompts = append(rs.Prompts, model)
+			}
+			slices.Sort(rs.Prompts)
+		}
+		ps.Routes = append(ps.Routes, rs)
+	}
+	return ps
+}
+
+func regexSources(compiled []*regexp.Regexp) []string {
+	sources := make([]string, len(compiled))
+	for i, re := range compiled {
+		sources[i] = re.String()
+	}
+	return sources
+}
+
+// serveConfig reports the live config, or 503 before the proxies first start
+// serveRoutes lists the live routes with their activity since startup; ?unused=true
+// keeps only routes that never matched
+func serveRoutes(w http.ResponseWriter, req *http.Request) {
+	stateMu.RLock()
+	cfg := liveConfig
+	stateMu.RUnlock()
+
+	if cfg == nil {
+		http.Error(w, "config not loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+	routes := proxy.RouteActivity(cfg)
+	if req.URL.Query().Get("unused") == "true" {
+		routes = proxy.UnusedRoutes(cfg)
+	}
+	if routes == nil {
+		routes = []proxy.RouteUsage{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(routes)
+}
+
+func serveConfig(w http.ResponseWriter, req *http.Request) {
+	stateMu.RLock()
+	current := state
+	stateMu.RUnlock()
+
+	if current == nil {
+		http.Error(w, "config not loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
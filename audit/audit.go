@@ -0,0 +1,227 @@
+// Package audit keeps a tamper-evident trail of requests: an append-only JSONL file in
+// which every record carries the hash of the record before it, so an edited, removed, or
+// reordered line breaks the chain from that point on.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// Record is one request in the audit log. Bodies are recorded by SHA-256 only.
+type Record struct {
+	Seq      uint64    `json:"seq"`
+	Time     time.Time `json:"time"` // When the request arrived
+	Listen   string    `json:"listen"`
+	Remote   string    `json:"remote,omitempty"`    // Client IP address
+	Key      string    `json:"key,omitempty"`       // Key name from keys:, or a fingerprint of an unlisted bearer token
+	ClientCN string    `json:"client_cn,omitempty"` // Common name of a verified client certificate
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Model    string    `json:"model,omitempty"`  // As sent to the backend, after aliases and actions
+	Routes   string    `json:"routes,omitempty"` // Matched routes, by name or index
+	Status   int       `json:"status"`
+	Aborted  bool      `json:"aborted,omitempty"` // The reply was cut off partway
+
+	RequestBytes   int64   `json:"request_bytes"`
+	RequestSHA256  string  `json:"request_sha256,omitempty"` // Omitted when the body wasn't read to the end
+	ResponseBytes  int64   `json:"response_bytes"`
+	ResponseSHA256 string  `json:"response_sha256"`
+	DurationMS     float64 `json:"duration_ms"`
+
+	Prev string `json:"prev"` // Hash of the previous record; empty for the first
+	Hash string `json:"hash"` // SHA-256 of this record encoded with an empty hash
+}
+
+// Log appends records to one file. A zero Log is disabled.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	seq  uint64
+	last string
+}
+
+// Default is the process-wide audit log, configured from the audit section
+var Default = &Log{}
+
+// Configure opens path for appending, continuing the chain from its last record. An empty
+// path closes the log; the path already open is kept as is.
+func (l *Log) Configure(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if path == l.path {
+		return nil
+	}
+	if l.file != nil {
+		l.file.Close()
+		l.file, l.path = nil, ""
+	}
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	last, err := lastRecord(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	l.file, l.path = f, path
+	l.seq, l.last = last.Seq, last.Hash
+	return nil
+}
+
+// Enabled reports whether records are being written
+func (l *Log) Enabled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file != nil
+}
+
+// Write chains r to the previous record and appends it
+func (l *Log) Write(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	r.Seq = l.seq + 1
+	r.Prev = l.last
+	hash, err := hashRecord(r)
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	l.seq, l.last = r.Seq, r.Hash
+	return nil
+}
+
+// Close flushes and closes the file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Sync()
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.file, l.path = nil, ""
+	return err
+}
+
+// Verify reads an audit log and checks every record's hash and link to the one before.
+// It returns the number of records that check out; the error names the first line that
+// doesn't.
+func Verify(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var prev Record
+	n := 0
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		want, err := hashRecord(rec)
+		if err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		switch {
+		case rec.Hash != want:
+			return n, fmt.Errorf("line %d: hash does not match the record (edited)", line)
+		case rec.Prev != prev.Hash:
+			return n, fmt.Errorf("line %d: prev does not match the record before (removed or reordered)", line)
+		case rec.Seq != prev.Seq+1:
+			return n, fmt.Errorf("line %d: seq %d follows %d", line, rec.Seq, prev.Seq)
+		}
+		prev = rec
+		n++
+	}
+	return n, scanner.Err()
+}
+
+func hashRecord(r Record) (string, error) {
+	r.Hash = ""
+	encoded, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lastRecord reads the final record of an audit file, or a zero Record when it's empty.
+// A last line with no newline was cut short by a crash mid-write; it is dropped from the
+// file so the chain continues from the record before it.
+func lastRecord(f *os.File) (Record, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return Record{}, err
+	}
+	end := info.Size()
+	// Records are small, so the last one is near the end; read more only if needed
+	for size := int64(64 * 1024); ; size *= 2 {
+		start := max(end-size, 0)
+		buf := make([]byte, end-start)
+		if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+			return Record{}, err
+		}
+		if len(buf) > 0 && buf[len(buf)-1] != '\n' {
+			i := bytes.LastIndexByte(buf, '\n')
+			if i < 0 && start > 0 {
+				continue
+			}
+			keep := start + int64(i) + 1
+			if err := f.Truncate(keep); err != nil {
+				return Record{}, fmt.Errorf("dropping a partial last record: %w", err)
+			}
+			logger.Error("Dropped a partial last record from the audit log, likely cut short by a crash", "path", f.Name(), "bytes", end-keep)
+			end, buf = keep, buf[:i+1]
+		}
+		buf = bytes.TrimRight(buf, "\n")
+		if len(buf) == 0 {
+			if start > 0 {
+				continue
+			}
+			return Record{}, nil
+		}
+		i := bytes.LastIndexByte(buf, '\n')
+		if i < 0 && start > 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(buf[i+1:], &rec); err != nil {
+			return Record{}, fmt.Errorf("last record is unreadable: %w", err)
+		}
+		if rec.Hash == "" {
+			return Record{}, fmt.Errorf("last record has no hash")
+		}
+		return rec, nil
+	}
+}
@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+func writeRecords(t *testing.T, path string, paths ...string) {
+	t.Helper()
+	l := &Log{}
+	if err := l.Configure(path); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	for _, p := range paths {
+		rec := Record{Time: time.Date(2026, 1, 2, 12, 30, 0, 0, time.UTC), Listen: "localhost:8081", Method: "POST", Path: p, Status: 200}
+		if err := l.Write(rec); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestLogChainsAcrossReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeRecords(t, path, "/v1/chat/completions", "/v1/embeddings")
+	// A restart continues the chain from the last record
+	writeRecords(t, path, "/v1/models")
+
+	content, _ := os.ReadFile(path)
+	n, err := Verify(bytes.NewReader(content))
+	if err != nil || n != 3 {
+		t.Fatalf("Verify = %d, %v; want 3 records and no error", n, err)
+	}
+	if strings.Count(string(content), `"prev":""`) != 1 {
+		t.Fatalf("only the first record should start the chain:\n%s", content)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeRecords(t, path, "/a", "/b", "/c")
+	content, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(strings.TrimSuffix(string(content), "\n"), "\n")
+
+	tests := []struct {
+		name    string
+		log     string
+		wantErr string
+	}{
+		{"edited", strings.Replace(string(content), `"path":"/b"`, `"path":"/x"`, 1), "line 2: hash does not match"},
+		{"removed", lines[0] + lines[2], "line 2: prev does not match"},
+		{"reordered", lines[1] + lines[0] + lines[2], "line 1: prev does not match"},
+		{"truncated front", lines[1] + lines[2], "line 1: prev does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Verify(strings.NewReader(tt.log))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Verify error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigureRefusesUnreadableTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	os.WriteFile(path, []byte(`{"seq":1,"hash":"ab`+"\n"), 0o600)
+	if err := (&Log{}).Configure(path); err == nil || !strings.Contains(err.Error(), "last record is unreadable") {
+		t.Fatalf("Configure error = %v, want the broken record reported", err)
+	}
+}
+
+func TestConfigureDropsPartialLastRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeRecords(t, path, "/a", "/b")
+	// A crash mid-write leaves the last line without its end
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	f.WriteString(`{"seq":3,"time":"2026-01-02T12:30:00Z","listen":"local`)
+	f.Close()
+
+	var logs bytes.Buffer
+	logger.SetOutput(&logs)
+	defer logger.SetOutput(os.Stdout)
+	writeRecords(t, path, "/c")
+
+	content, _ := os.ReadFile(path)
+	n, err := Verify(bytes.NewReader(content))
+	if err != nil || n != 3 {
+		t.Fatalf("Verify = %d, %v; want 3 records and no error:\n%s", n, err, content)
+	}
+	if !strings.Contains(logs.String(), "Dropped a partial last record") {
+		t.Fatalf("dropping the partial record should be logged, got %q", logs.String())
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/audit"
+)
+
+func TestAuditCommandVerifiesChain(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "audit.jsonl")
+	l := &audit.Log{}
+	if err := l.Configure(logPath); err != nil {
+		t.Fatal(err)
+	}
+	l.Write(audit.Record{Method: "POST", Path: "/v1/chat/completions", Status: 200})
+	l.Write(audit.Record{Method: "GET", Path: "/v1/models", Status: 200})
+	l.Close()
+
+	configPath := filepath.Join(dir, "config.yml")
+	os.WriteFile(configPath, []byte(`
+audit:
+  file: audit.jsonl
+proxy:
+  listen: localhost:8081
+  target: http://localhost:8080
+  routes:
+    - methods: POST
+      paths: ^/v1/chat/completions$
+      on_request:
+        - merge: { temperature: 0.2 }
+`), 0o644)
+
+	if code := runAuditCommand([]string{"-c", configPath}); code != 0 {
+		t.Fatalf("audit exited %d, want 0 for an intact log", code)
+	}
+
+	content, _ := os.ReadFile(logPath)
+	os.WriteFile(logPath, []byte(strings.Replace(string(content), `"status":200`, `"status":403`, 1)), 0o600)
+	if code := runAuditCommand([]string{"-file", logPath}); code != 1 {
+		t.Fatalf("audit exited %d, want 1 for an edited log", code)
+	}
+}
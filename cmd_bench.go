@@ -0,0 +1,597 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/proxy"
+)
+
+// benchRequest is one workload entry. Recorded workloads are JSON lines holding either
+// a body or, as /admin/traffic/{id} returns it, the request body as a string.
+type benchRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Request string            `json:"request,omitempty"`
+}
+
+func (b benchRequest) payload() []byte {
+	if len(b.Body) > 0 {
+		return b.Body
+	}
+	return []byte(b.Request)
+}
+
+func (b benchRequest) newRequest(base string) (*http.Request, error) {
+	req, err := http.NewRequest(b.Method, base+b.Path, bytes.NewReader(b.payload()))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range b.Headers {
+		req.Header.Set(name, value)
+	}
+	if len(b.payload()) > 0 && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// syntheticWorkload covers the common request shapes: chat, streamed chat, embeddings, and
+// Ollama chat
+func syntheticWorkload(model string) []benchRequest {
+	messages := `[{"role":"system","content":"You are a helpful assistant."},{"role":"user","content":"Write a haiku about proxies."}]`
+	return []benchRequest{
+		{Method: http.MethodPost, Path: "/v1/chat/completions", Body: json.RawMessage(fmt.Sprintf(`{"model":%q,"messages":%s,"temperature":0.7,"max_tokens":256}`, model, messages))},
+		{Method: http.MethodPost, Path: "/v1/chat/completions", Body: json.RawMessage(fmt.Sprintf(`{"model":%q,"messages":%s,"stream":true}`, model, messages))},
+		{Method: http.MethodPost, Path: "/v1/embeddings", Body: json.RawMessage(fmt.Sprintf(`{"model":%q,"input":["first passage","second passage"]}`, model))},
+		{Method: http.MethodPost, Path: "/api/chat", Body: json.RawMessage(fmt.Sprintf(`{"model":%q,"messages":%s,"stream":false}`, model, messages))},
+	}
+}
+
+// readWorkload reads a JSON lines workload; method defaults to POST
+func readWorkload(path string) ([]benchRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var workload []benchRequest
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var r benchRequest
+		if err := json.Unmarshal([]byte(text), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if r.Path == "" {
+			return nil, fmt.Errorf("%s:%d: path is required", path, line)
+		}
+		if r.Method == "" {
+			r.Method = http.MethodPost
+		}
+		r.Method = strings.ToUpper(r.Method)
+		workload = append(workload, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(workload) == 0 {
+		return nil, fmt.Errorf("%s: no requests", path)
+	}
+	return workload, nil
+}
+
+// stubReply answers an upstream request the way a backend would, streaming when asked
+func stubReply(path string, body []byte) (string, []byte) {
+	var req struct {
+		Model  string `json:"model"`
+		Stream *bool  `json:"stream"`
+	}
+	json.Unmarshal(body, &req)
+	ollama := strings.HasPrefix(path, "/api/")
+	// Ollama streams unless told not to
+	stream := req.Stream != nil && *req.Stream || ollama && req.Stream == nil
+
+	switch {
+	case strings.Contains(path, "embed"):
+		if ollama {
+			return "application/json", fmt.Appendf(nil, `{"model":%q,"embeddings":[[0.1,0.2,0.3],[0.4,0.5,0.6]],"prompt_eval_count":4}`, req.Model)
+		}
+		return "application/json", fmt.Appendf(nil, `{"object":"list","model":%q,"data":[{"object":"embedding","index":0,"embedding":[0.1,0.2,0.3]},{"object":"embedding","index":1,"embedding":[0.4,0.5,0.6]}],"usage":{"prompt_tokens":4,"total_tokens":4}}`, req.Model)
+	case ollama && stream:
+		var out []byte
+		for _, word := range []string{"Requests ", "pass ", "through"} {
+			out = fmt.Appendf(out, `{"model":%q,"message":{"role":"assistant","content":%q},"done":false}`+"\n", req.Model, word)
+		}
+		return "application/x-ndjson", fmt.Appendf(out, `{"model":%q,"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":24,"eval_count":3}`+"\n", req.Model)
+	case ollama:
+		return "application/json", fmt.Appendf(nil, `{"model":%q,"message":{"role":"assistant","content":"Requests pass through"},"done":true,"done_reason":"stop","prompt_eval_count":24,"eval_count":3}`, req.Model)
+	case stream:
+		var out []byte
+		for _, word := range []string{"Requests ", "pass ", "through"} {
+			out = fmt.Appendf(out, "data: {\"id\":\"bench\",\"object\":\"chat.completion.chunk\",\"model\":%q,\"choices\":[{\"index\":0,\"delta\":{\"content\":%q},\"finish_reason\":null}]}\n\n", req.Model, word)
+		}
+		out = fmt.Appendf(out, "data: {\"id\":\"bench\",\"object\":\"chat.completion.chunk\",\"model\":%q,\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":24,\"completion_tokens\":3,\"total_tokens\":27}}\n\n", req.Model)
+		return "text/event-stream", append(out, "data: [DONE]\n\n"...)
+	default:
+		return "application/json", fmt.Appendf(nil, `{"id":"bench","object":"chat.completion","model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":"Requests pass through"},"finish_reason":"stop"}],"usage":{"prompt_tokens":24,"completion_tokens":3,"total_tokens":27}}`, req.Model)
+	}
+}
+
+// stubTransport answers every request with stubReply without touching the network
+type stubTransport struct{}
+
+func (stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	contentType, reply := stubReply(req.URL.Path, body)
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{contentType}},
+		Body:          io.NopCloser(bytes.NewReader(reply)),
+		ContentLength: int64(len(reply)),
+		Request:       req,
+	}, nil
+}
+
+// benchStub serves stubReply over HTTP, flushing stream lines as a backend would
+func benchStub(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	contentType, reply := stubReply(req.URL.Path, body)
+	w.Header().Set("Content-Type", contentType)
+	if contentType == "application/json" {
+		w.Write(reply)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	for line := range bytes.Lines(reply) {
+		w.Write(line)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// benchCost is what a set of routes costs per request, in process
+type benchCost struct {
+	Nanos  float64 `json:"ns_per_request"`
+	Allocs float64 `json:"allocs_per_request"`
+	Bytes  float64 `json:"bytes_per_request"`
+}
+
+// benchRoute is what one route adds to the workload: all routes against all but this one
+type benchRoute struct {
+	Index   int     `json:"index"`
+	Name    string  `json:"name,omitempty"`
+	Matched int     `json:"matched"` // Workload requests the route matches
+	Nanos   float64 `json:"added_ns_per_request"`
+	Allocs  float64 `json:"added_allocs_per_request"`
+}
+
+type benchPercentiles struct {
+	P50 time.Duration `json:"p50_ns"`
+	P95 time.Duration `json:"p95_ns"`
+	P99 time.Duration `json:"p99_ns"`
+}
+
+type benchLatency struct {
+	Upstream    string           `json:"upstream"`
+	Requests    int              `json:"requests"`
+	Concurrency int              `json:"concurrency"`
+	Errors      int              `json:"errors"`
+	Direct      benchPercentiles `json:"direct"`
+	Proxied     benchPercentiles `json:"proxied"`
+	Added       benchPercentiles `json:"added"`
+}
+
+type benchReport struct {
+	Listen     string        `json:"listen"`
+	Workload   string        `json:"workload"`
+	Requests   int           `json:"requests"`
+	Iterations int           `json:"iterations"`
+	NoRoutes   benchCost     `json:"no_routes"`
+	AllRoutes  benchCost     `json:"all_routes"`
+	Routes     []benchRoute  `json:"routes"`
+	Latency    *benchLatency `json:"latency,omitempty"`
+}
+
+// runBenchCommand measures what a config's routes cost: in process per route, and
+// optionally end to end through a running proxy
+func runBenchCommand(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	var paths configFiles
+	fs.Var(&paths, "config", "Config file to load (can be specified multiple times)")
+	fs.Var(&paths, "c", "Alias for -config")
+	listen := fs.String("listen", "", "Proxy to benchmark, by listen address; defaults to the first")
+	workloadFile := fs.String("workload", "", "JSON lines of {method, path, headers, body}; defaults to a synthetic workload")
+	model := fs.String("model", "bench", "Model named in the synthetic workload")
+	iterations := fs.Int("iterations", 500, "Passes over the workload for in-process measurements")
+	requests := fs.Int("n", 0, "Requests to send through a running proxy for latency; 0 skips it")
+	concurrency := fs.Int("concurrency", 4, "Concurrent requests for latency")
+	upstream := fs.String("upstream", "stub", `Backend for latency: "stub" serves canned replies, "target" uses the configured targets`)
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "bench: -config is required")
+		return 2
+	}
+	if *iterations < 1 || *concurrency < 1 || *requests < 0 {
+		fmt.Fprintln(os.Stderr, "bench: -iterations and -concurrency must be positive, -n at least 0")
+		return 2
+	}
+	if *upstream != "stub" && *upstream != "target" {
+		fmt.Fprintln(os.Stderr, `bench: -upstream must be "stub" or "target"`)
+		return 2
+	}
+
+	logger.SetOutput(os.Stderr)
+	cfg, _, err := config.Load(paths, config.CliOverrides{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bench: %v\n", err)
+		return 1
+	}
+	proxyCfg, ok := selectProxy(cfg, *listen)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "bench: no proxy listens on %s\n", *listen)
+		return 1
+	}
+
+	workload, source := syntheticWorkload(*model), "synthetic"
+	if *workloadFile != "" {
+		if workload, err = readWorkload(*workloadFile); err != nil {
+			fmt.Fprintf(os.Stderr, "bench: %v\n", err)
+			return 1
+		}
+		source = *workloadFile
+	}
+
+	// Per-request logs would flood the output; their cost is still measured
+	logger.SetOutput(io.Discard)
+	report := benchReport{
+		Listen:     proxyCfg.Listen,
+		Workload:   source,
+		Requests:   len(workload),
+		Iterations: *iterations,
+		Routes:     []benchRoute{},
+	}
+	report.NoRoutes, report.AllRoutes, report.Routes = measureRoutes(proxyCfg, workload, *iterations)
+	if *requests > 0 {
+		latency, err := measureLatency(proxyCfg, workload, *requests, *concurrency, *upstream == "stub")
+		if err != nil {
+			logger.SetOutput(os.Stderr)
+			fmt.Fprintf(os.Stderr, "bench: %v\n", err)
+			return 1
+		}
+		report.Latency = latency
+	}
+	logger.SetOutput(os.Stderr)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return 0
+	}
+	printBenchReport(os.Stdout, report)
+	return 0
+}
+
+// benchRounds splits the iterations so every route set is measured in turn, repeatedly;
+// keeping each set's fastest round evens out GC and scheduling noise
+const benchRounds = 5
+
+// measureRoutes measures the workload with no routes, all routes, and all but each route
+func measureRoutes(proxyCfg config.ProxyConfig, workload []benchRequest, iterations int) (benchCost, benchCost, []benchRoute) {
+	sets := [][]config.Route{nil, proxyCfg.Routes}
+	for i := range proxyCfg.Routes {
+		sets = append(sets, slices.Delete(slices.Clone(proxyCfg.Routes), i, i+1))
+	}
+	pipelines := make([]func(), len(sets))
+	for i, routes := range sets {
+		cfg := proxyCfg
+		cfg.Routes = routes
+		pipelines[i] = transformPass(cfg, workload)
+		pipelines[i]() // Warm up
+	}
+
+	costs := make([]benchCost, len(sets))
+	perRound := max(1, iterations/benchRounds)
+	for range benchRounds {
+		for i, pass := range pipelines {
+			cost := measurePasses(pass, perRound, len(workload))
+			if costs[i].Nanos == 0 || cost.Nanos < costs[i].Nanos {
+				costs[i] = cost
+			}
+		}
+	}
+
+	none, all := costs[0], costs[1]
+	routes := []benchRoute{}
+	for i, route := range proxyCfg.Routes {
+		without := costs[2+i]
+		routes = append(routes, benchRoute{
+			Index:   i,
+			Name:    route.Name,
+			Matched: matchCount(proxyCfg, workload, i),
+			Nanos:   all.Nanos - without.Nanos,
+			Allocs:  all.Allocs - without.Allocs,
+		})
+	}
+	return none, all, routes
+}
+
+func matchCount(proxyCfg config.ProxyConfig, workload []benchRequest, index int) int {
+	count := 0
+	for _, w := range workload {
+		req, err := w.newRequest("http://bench")
+		if err != nil {
+			continue
+		}
+		req.URL.Path = proxyCfg.NormalizePaths.Apply(req.URL.Path)
+		if _, indices := proxy.MatchRoutes(req, proxyCfg.Routes); slices.Contains(indices, index) {
+			count++
+		}
+	}
+	return count
+}
+
+// transformPass returns a function running the workload once through the request and
+// response pipeline, against stubTransport instead of a backend
+func transformPass(proxyCfg config.ProxyConfig, workload []benchRequest) func() {
+	handler := proxy.NewHandler(proxyCfg)
+	transport := proxy.NewTransport(stubTransport{})
+	return func() {
+		for _, w := range workload {
+			req, err := w.newRequest("http://bench")
+			if err != nil {
+				continue
+			}
+			handler.ModifyRequest(req)
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				continue
+			}
+			if handler.ModifyResponse(resp) == nil {
+				io.Copy(io.Discard, resp.Body)
+			}
+			resp.Body.Close()
+		}
+	}
+}
+
+func measurePasses(pass func(), passes, requests int) benchCost {
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for range passes {
+		pass()
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	n := float64(passes * requests)
+	return benchCost{
+		Nanos:  float64(elapsed.Nanoseconds()) / n,
+		Allocs: float64(after.Mallocs-before.Mallocs) / n,
+		Bytes:  float64(after.TotalAlloc-before.TotalAlloc) / n,
+	}
+}
+
+// measureLatency starts the proxy on a free local port and compares latency to its
+// upstream directly and through the proxy
+func measureLatency(proxyCfg config.ProxyConfig, workload []benchRequest, requests, concurrency int, stub bool) (*benchLatency, error) {
+	latency := &benchLatency{Requests: requests, Concurrency: concurrency}
+	if stub {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		server := &http.Server{Handler: http.HandlerFunc(benchStub)}
+		go server.Serve(ln)
+		defer server.Close()
+
+		latency.Upstream = "stub"
+		proxyCfg.Target, proxyCfg.Targets = "http://"+ln.Addr().String(), nil
+		// The stub has no slots endpoint to schedule by
+		proxyCfg.Slots = nil
+	} else {
+		latency.Upstream = proxyCfg.Target
+	}
+
+	addr, err := freeAddr()
+	if err != nil {
+		return nil, err
+	}
+	proxyCfg.Listen = addr
+	proxyCfg.ExtraListen = nil
+	proxyCfg.SSLCert, proxyCfg.SSLKey, proxyCfg.PlainHTTP = "", "", ""
+	ps, err := startProxy(proxyCfg)
+	if err != nil {
+		return nil, err
+	}
+	defer stopProxy(ps)
+	if err := waitForListen(addr, 2*time.Second); err != nil {
+		return nil, err
+	}
+
+	direct, directErrors := sendWorkload(strings.TrimSuffix(proxyCfg.Target, "/"), workload, requests, concurrency)
+	proxied, proxiedErrors := sendWorkload("http://"+addr, workload, requests, concurrency)
+	if len(direct) == 0 || len(proxied) == 0 {
+		return nil, fmt.Errorf("every request to %s failed", latency.Upstream)
+	}
+	latency.Errors = directErrors + proxiedErrors
+	latency.Direct, latency.Proxied = percentiles(direct), percentiles(proxied)
+	latency.Added = benchPercentiles{
+		P50: latency.Proxied.P50 - latency.Direct.P50,
+		P95: latency.Proxied.P95 - latency.Direct.P95,
+		P99: latency.Proxied.P99 - latency.Direct.P99,
+	}
+	return latency, nil
+}
+
+func freeAddr() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+	return ln.Addr().String(), nil
+}
+
+func waitForListen(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("proxy did not start on %s: %w", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// sendWorkload sends requests round-robin over the workload, after one warm-up pass, and
+// returns the latency of each full response. Transport errors are counted, not timed.
+func sendWorkload(base string, workload []benchRequest, requests, concurrency int) ([]time.Duration, int) {
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: concurrency}}
+	defer client.CloseIdleConnections()
+	send := func(w benchRequest) (time.Duration, bool) {
+		req, err := w.newRequest(base)
+		if err != nil {
+			return 0, false
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, false
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return time.Since(start), true
+	}
+	for _, w := range workload {
+		send(w)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var durations []time.Duration
+	errors := 0
+	next := make(chan int)
+	for range concurrency {
+		wg.Go(func() {
+			for i := range next {
+				d, ok := send(workload[i%len(workload)])
+				mu.Lock()
+				if ok {
+					durations = append(durations, d)
+				} else {
+					errors++
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	for i := range requests {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return durations, errors
+}
+
+func percentiles(durations []time.Duration) benchPercentiles {
+	slices.Sort(durations)
+	at := func(q float64) time.Duration {
+		return durations[int(q*float64(len(durations)-1))]
+	}
+	return benchPercentiles{P50: at(0.50), P95: at(0.95), P99: at(0.99)}
+}
+
+func printBenchReport(w io.Writer, report benchReport) {
+	fmt.Fprintf(w, "Proxy %s, %s workload: %d requests x %d iterations\n\n", report.Listen, report.Workload, report.Requests, report.Iterations)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TRANSFORMS\tPER REQUEST\tALLOCS\tBYTES\tREQ/S\t")
+	for _, row := range []struct {
+		name string
+		cost benchCost
+	}{{"no routes", report.NoRoutes}, {"all routes", report.AllRoutes}} {
+		fmt.Fprintf(tw, "%s\t%s\t%.0f\t%.0f\t%.0f\t\n", row.name, formatNanos(row.cost.Nanos), row.cost.Allocs, row.cost.Bytes, 1e9/row.cost.Nanos)
+	}
+	tw.Flush()
+
+	if len(report.Routes) > 0 {
+		fmt.Fprintln(w, "\nAdded by each route (all routes vs. all but this one):")
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "#\tNAME\tMATCHED\tPER REQUEST\tALLOCS\t")
+		for _, r := range report.Routes {
+			fmt.Fprintf(tw, "%d\t%s\t%d/%d\t%s\t%+.0f\t\n", r.Index, orDash(r.Name), r.Matched, report.Requests, signedNanos(r.Nanos), r.Allocs)
+		}
+		tw.Flush()
+	}
+
+	if l := report.Latency; l != nil {
+		fmt.Fprintf(w, "\nLatency via %s upstream: %d requests, concurrency %d", l.Upstream, l.Requests, l.Concurrency)
+		if l.Errors > 0 {
+			fmt.Fprintf(w, ", %d errors", l.Errors)
+		}
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "\tP50\tP95\tP99\t")
+		fmt.Fprintf(tw, "direct\t%s\t%s\t%s\t\n", formatLatency(l.Direct.P50), formatLatency(l.Direct.P95), formatLatency(l.Direct.P99))
+		fmt.Fprintf(tw, "proxied\t%s\t%s\t%s\t\n", formatLatency(l.Proxied.P50), formatLatency(l.Proxied.P95), formatLatency(l.Proxied.P99))
+		fmt.Fprintf(tw, "added\t%s\t%s\t%s\t\n", formatLatency(l.Added.P50), formatLatency(l.Added.P95), formatLatency(l.Added.P99))
+		tw.Flush()
+	}
+}
+
+func formatNanos(ns float64) string {
+	return time.Duration(ns).Round(100 * time.Nanosecond).String()
+}
+
+func signedNanos(ns float64) string {
+	if ns < 0 {
+		return "-" + formatNanos(-ns)
+	}
+	return "+" + formatNanos(ns)
+}
+
+func formatLatency(d time.Duration) string {
+	return d.Round(10 * time.Microsecond).String()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestStubReplyShapes(t *testing.T) {
+	tests := []struct {
+		path, body, contentType, want string
+	}{
+		{"/v1/chat/completions", `{"model":"m"}`, "application/json", `"chat.completion"`},
+		{"/v1/chat/completions", `{"model":"m","stream":true}`, "text/event-stream", "data: [DONE]"},
+		{"/v1/embeddings", `{"model":"m"}`, "application/json", `"embedding"`},
+		{"/api/chat", `{"model":"m"}`, "application/x-ndjson", `"done":true`},
+		{"/api/chat", `{"model":"m","stream":false}`, "application/json", `"done":true`},
+	}
+	for _, tt := range tests {
+		contentType, reply := stubReply(tt.path, []byte(tt.body))
+		if contentType != tt.contentType || !strings.Contains(string(reply), tt.want) {
+			t.Errorf("stubReply(%s, %s) = %s %s", tt.path, tt.body, contentType, reply)
+		}
+	}
+}
+
+func TestReadWorkload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workload.jsonl")
+	os.WriteFile(path, []byte(`{"path":"/v1/chat/completions","body":{"model":"m"}}
+
+{"method":"get","path":"/v1/models"}
+{"method":"POST","path":"/v1/embeddings","request":"{\"input\":\"x\"}"}
+`), 0o644)
+
+	workload, err := readWorkload(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workload) != 3 {
+		t.Fatalf("read %d requests, want 3", len(workload))
+	}
+	if workload[0].Method != "POST" || workload[1].Method != "GET" {
+		t.Errorf("methods = %s, %s", workload[0].Method, workload[1].Method)
+	}
+	if got := string(workload[2].payload()); got != `{"input":"x"}` {
+		t.Errorf("recorded request body = %s", got)
+	}
+}
+
+func TestMeasureRoutesAndLatency(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(path, []byte(`
+proxy:
+  listen: localhost:8081
+  target: http://localhost:1
+  routes:
+    - name: chat
+      methods: POST
+      paths: ^/v1/chat/completions$
+      on_request:
+        - merge: { temperature: 0.2 }
+    - methods: POST
+      paths: ^/v1/embeddings$
+      on_request:
+        - default: { encoding_format: float }
+`), 0o644)
+	cfg, _, err := config.Load([]string{path}, config.CliOverrides{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyCfg := cfg.Proxies[0]
+	workload := syntheticWorkload("m")
+
+	none, all, routes := measureRoutes(proxyCfg, workload, 5)
+	if none.Nanos <= 0 || all.Nanos <= 0 || all.Allocs <= 0 {
+		t.Fatalf("costs = %+v, %+v", none, all)
+	}
+	if len(routes) != 2 || routes[0].Name != "chat" || routes[0].Matched != 2 || routes[1].Matched != 1 {
+		t.Fatalf("routes = %+v", routes)
+	}
+
+	latency, err := measureLatency(proxyCfg, workload, 8, 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latency.Upstream != "stub" || latency.Errors != 0 || latency.Proxied.P50 <= 0 {
+		t.Fatalf("latency = %+v", latency)
+	}
+
+	var buf bytes.Buffer
+	printBenchReport(&buf, benchReport{Listen: proxyCfg.Listen, Workload: "synthetic", Requests: len(workload), Iterations: 5, NoRoutes: none, AllRoutes: all, Routes: routes, Latency: latency})
+	for _, want := range []string{"all routes", "chat", "2/4", "Latency via stub upstream", "added"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, buf.String())
+		}
+	}
+}
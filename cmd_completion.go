@@ -0,0 +1,499 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// How a flag's value completes
+const (
+	valueNone   = ""       // Boolean flag
+	valueText   = "text"   // Free text, nothing to suggest
+	valueFile   = "file"   // Any path
+	valueConfig = "config" // YAML config paths
+	valueWords  = "words"  // One of a fixed list
+)
+
+// completionFlag is a flag offered by the completion scripts. Help text is shown by zsh,
+// fish, and PowerShell, so it avoids brackets and colons.
+type completionFlag struct {
+	name  string
+	help  string
+	value string
+	words []string
+}
+
+// completionCommand is a subcommand with its flags; args are positional words, like the
+// service actions
+type completionCommand struct {
+	name  string
+	help  string
+	args  []string
+	flags []completionFlag
+}
+
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+func configFlags(help string) []completionFlag {
+	return []completionFlag{
+		{name: "config", help: help, value: valueConfig},
+		{name: "c", help: "Alias for -config", value: valueConfig},
+	}
+}
+
+func jsonFlag(help string) completionFlag {
+	return completionFlag{name: "json", help: help}
+}
+
+// mainFlags are the proxy's own flags, used when no subcommand is named
+func mainFlags() []completionFlag {
+	return append(configFlags("Path to YAML configuration"),
+		completionFlag{name: "listen", help: "Address to listen on", value: valueText},
+		completionFlag{name: "l", help: "Alias for -listen", value: valueText},
+		completionFlag{name: "target", help: "Target URL to proxy to", value: valueText},
+		completionFlag{name: "t", help: "Alias for -target", value: valueText},
+		completionFlag{name: "ssl-cert", help: "SSL certificate file", value: valueFile},
+		completionFlag{name: "s", help: "Alias for -ssl-cert", value: valueFile},
+		completionFlag{name: "ssl-key", help: "SSL key file", value: valueFile},
+		completionFlag{name: "k", help: "Alias for -ssl-key", value: valueFile},
+		completionFlag{name: "timeout", help: "Timeout for requests to target", value: valueText},
+		completionFlag{name: "T", help: "Alias for -timeout", value: valueText},
+		completionFlag{name: "debug", help: "Print debug logs"},
+		completionFlag{name: "d", help: "Alias for -debug"},
+		completionFlag{name: "trace", help: "Write a JSON trace of every request to this directory", value: valueFile},
+		completionFlag{name: "daemon", help: "Run in the background (Unix)"},
+		completionFlag{name: "pid-file", help: "Write the process ID to this file", value: valueFile},
+		completionFlag{name: "log-file", help: "Append logs to this file", value: valueFile},
+		completionFlag{name: "report-unused", help: "On shutdown, log routes that never matched"},
+		completionFlag{name: "version", help: "Print version and build info"},
+	)
+}
+
+// serviceProxyFlags are the proxy flags service install passes through to the unit
+func serviceProxyFlags() []completionFlag {
+	var flags []completionFlag
+	for _, f := range mainFlags() {
+		switch f.name {
+		case "daemon", "pid-file", "log-file", "report-unused", "version":
+		default:
+			flags = append(flags, f)
+		}
+	}
+	return flags
+}
+
+// completionCommands lists every subcommand in help order; the usage text is built from it
+func completionCommands() []completionCommand {
+	return []completionCommand{
+		{
+			name: "audit",
+			help: "Verify an audit log's hash chain",
+			flags: append(configFlags("Config file whose audit.file to verify"),
+				completionFlag{name: "file", help: "Audit log to verify", value: valueFile},
+			),
+		},
+		{
+			name: "bench",
+			help: "Measure per-route transform cost and added latency against a stub upstream",
+			flags: append(configFlags("Config file to load"),
+				completionFlag{name: "listen", help: "Proxy to benchmark, by listen address", value: valueText},
+				completionFlag{name: "workload", help: "JSON lines workload file", value: valueFile},
+				completionFlag{name: "model", help: "Model named in the synthetic workload", value: valueText},
+				completionFlag{name: "iterations", help: "Passes over the workload", value: valueText},
+				completionFlag{name: "n", help: "Requests to send through the proxy for latency", value: valueText},
+				completionFlag{name: "concurrency", help: "Concurrent requests for latency", value: valueText},
+				completionFlag{name: "upstream", help: "Backend for latency", value: valueWords, words: []string{"stub", "target"}},
+				jsonFlag("Print the report as JSON"),
+			),
+		},
+		{
+			name: "completion",
+			help: "Print a shell completion script (bash, zsh, fish, or powershell)",
+			args: completionShells,
+		},
+		{
+			name: "init",
+			help: "Write a starter config (-preset ollama, llama-cpp, or openai-gateway)",
+			flags: []completionFlag{
+				{name: "preset", help: "Backend to configure for", value: valueWords, words: starterPresets()},
+				{name: "o", help: "File to write, or - for stdout", value: valueFile},
+				{name: "force", help: "Overwrite an existing file"},
+			},
+		},
+		{
+			name: "lint",
+			help: "Report unreachable policies, catch-all, unanchored or open-ended patterns, and unused includes",
+			flags: append(configFlags("Config file to load"),
+				completionFlag{name: "ignore", help: "Comma-separated checks to skip", value: valueWords, words: []string{
+					config.LintShadowed, config.LintCatchAll, config.LintNeverTrue,
+					config.LintUnanchored, config.LintOpenEnded, config.LintUnusedInclude, config.LintUnmatchedRoute,
+				}},
+				jsonFlag("Print findings as JSON"),
+			),
+		},
+		{
+			name: "monitor",
+			help: "Show live request rates, route hits, streams, target health, and recent requests",
+			flags: append(configFlags("Config file whose admin.listen to query"),
+				completionFlag{name: "admin", help: "Admin listener address", value: valueText},
+				completionFlag{name: "interval", help: "Refresh interval", value: valueWords, words: []string{"1s", "2s", "5s"}},
+				completionFlag{name: "once", help: "Print one frame and exit"},
+			),
+		},
+		{
+			name: "routes",
+			help: "Print the routing table after includes and merging",
+			flags: append(configFlags("Config file to load"),
+				jsonFlag("Print the routing table as JSON"),
+			),
+		},
+		{
+			name: "service",
+			help: "Write a systemd unit, or manage the Windows service",
+			args: []string{"install", "uninstall", "start", "stop"},
+			flags: append(serviceProxyFlags(),
+				completionFlag{name: "name", help: "Service name", value: valueText},
+				completionFlag{name: "log-file", help: "Log file for the service", value: valueFile},
+				completionFlag{name: "o", help: "Unit file to write, or - for stdout", value: valueFile},
+				completionFlag{name: "compose", help: "Also write a Docker compose file here", value: valueFile},
+				completionFlag{name: "user", help: "User for the systemd unit to run as", value: valueText},
+				completionFlag{name: "force", help: "Overwrite existing files"},
+			),
+		},
+		{
+			name: "test-request",
+			help: "Run a sample request through the routes without a backend",
+			flags: append(configFlags("Config file to load"),
+				completionFlag{name: "H", help: "Request header, repeatable", value: valueText},
+				completionFlag{name: "listen", help: "Proxy to evaluate, by listen address", value: valueText},
+				completionFlag{name: "method", help: "Request method", value: valueWords, words: httpMethodWords},
+				completionFlag{name: "path", help: "Request path with an optional query string", value: valueText},
+				completionFlag{name: "body", help: "File holding the request body, or - for stdin", value: valueFile},
+				jsonFlag("Print the report as JSON"),
+			),
+		},
+		{
+			name: "usage",
+			help: "Print usage aggregates from a running proxy's admin listener",
+			flags: append(configFlags("Config file whose admin.listen to query"),
+				completionFlag{name: "admin", help: "Admin listener address", value: valueText},
+				completionFlag{name: "since", help: "Report window", value: valueWords, words: []string{"1h", "24h", "168h"}},
+				jsonFlag("Print the raw JSON report"),
+			),
+		},
+	}
+}
+
+var httpMethodWords = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// runCompletionCommand prints a completion script for a shell
+func runCompletionCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "completion: expected one shell (%s)\n", strings.Join(completionShells, ", "))
+		return 2
+	}
+	if err := writeCompletion(os.Stdout, args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "completion: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+func writeCompletion(w io.Writer, shell string) error {
+	commands := completionCommands()
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, commands)
+	case "zsh":
+		writeZshCompletion(w, commands)
+	case "fish":
+		writeFishCompletion(w, commands)
+	case "powershell":
+		writePowerShellCompletion(w, commands)
+	default:
+		return fmt.Errorf("unknown shell %q (want %s)", shell, strings.Join(completionShells, ", "))
+	}
+	return nil
+}
+
+// flagNames joins a command's flag names with a leading dash
+func flagNames(flags []completionFlag) string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "-" + f.name
+	}
+	return strings.Join(names, " ")
+}
+
+// shellQuoted escapes s for a single-quoted bash or zsh string
+func shellQuoted(s string) string {
+	return strings.ReplaceAll(s, "'", `'\''`)
+}
+
+// fishQuoted escapes s for a single-quoted fish string
+func fishQuoted(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`)
+}
+
+func commandNames(commands []completionCommand) string {
+	names := make([]string, len(commands))
+	for i, c := range commands {
+		names[i] = c.name
+	}
+	return strings.Join(names, " ")
+}
+
+func writeBashCompletion(w io.Writer, commands []completionCommand) {
+	fmt.Fprint(w, `# bash completion for llama-matchmaker
+# Load with: source <(llama-matchmaker completion bash)
+
+_llama_matchmaker() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}" cmd="" flags="" args=""
+    if (( COMP_CWORD > 1 )); then
+        case "${COMP_WORDS[1]}" in
+`)
+	fmt.Fprintf(w, "            %s) cmd=\"${COMP_WORDS[1]}\" ;;\n", strings.ReplaceAll(commandNames(commands), " ", "|"))
+	fmt.Fprint(w, `        esac
+    fi
+
+    # Go flags take one or two dashes
+    prev="${prev#-}"
+    case "$cmd:-${prev#-}" in
+`)
+	all := append([]completionCommand{{flags: mainFlags()}}, commands...)
+	for _, c := range all {
+		for _, f := range c.flags {
+			pattern := fmt.Sprintf("%s:-%s", c.name, f.name)
+			switch f.value {
+			case valueText:
+				fmt.Fprintf(w, "        %s) return ;;\n", pattern)
+			case valueFile:
+				fmt.Fprintf(w, "        %s) compopt -o filenames 2>/dev/null; COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", pattern)
+			case valueConfig:
+				fmt.Fprintf(w, "        %s) compopt -o filenames 2>/dev/null; COMPREPLY=($(compgen -d -- \"$cur\") $(compgen -f -X '!*.y*ml' -- \"$cur\")); return ;;\n", pattern)
+			case valueWords:
+				fmt.Fprintf(w, "        %s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")); return ;;\n", pattern, strings.Join(f.words, " "))
+			}
+		}
+	}
+	fmt.Fprint(w, `    esac
+
+    case "$cmd" in
+`)
+	fmt.Fprintf(w, "        \"\") flags=\"%s\" ;;\n", flagNames(mainFlags()))
+	for _, c := range commands {
+		fmt.Fprintf(w, "        %s) flags=\"%s\"; args=\"%s\" ;;\n", c.name, flagNames(c.flags), strings.Join(c.args, " "))
+	}
+	fmt.Fprintf(w, `    esac
+
+    if [[ "$cur" == --* ]]; then
+        COMPREPLY=($(compgen -W "$(printf -- '-%%s ' $flags)" -- "$cur"))
+    elif [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    elif [[ -z "$cmd" && $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "%s" -- "$cur"))
+    elif [[ -n "$args" && $COMP_CWORD -eq 2 ]]; then
+        COMPREPLY=($(compgen -W "$args" -- "$cur"))
+    fi
+}
+
+complete -F _llama_matchmaker llama-matchmaker
+`, commandNames(commands))
+}
+
+// zshFlagSpec renders a flag for _arguments, accepting one or two dashes
+func zshFlagSpec(f completionFlag) string {
+	spec := fmt.Sprintf("'(-%[1]s --%[1]s)'{-%[1]s,--%[1]s}'[%[2]s]", f.name, shellQuoted(f.help))
+	switch f.value {
+	case valueText:
+		spec += ":" + f.name + ": "
+	case valueFile:
+		spec += ":file:_files"
+	case valueConfig:
+		spec += `:config file:_files -g "*.(yml|yaml)"`
+	case valueWords:
+		spec += ":" + f.name + ":(" + strings.Join(f.words, " ") + ")"
+	}
+	return spec + "'"
+}
+
+func writeZshCompletion(w io.Writer, commands []completionCommand) {
+	fmt.Fprint(w, `#compdef llama-matchmaker
+# zsh completion for llama-matchmaker
+# Load with: source <(llama-matchmaker completion zsh)
+# or save as _llama-matchmaker in a directory on $fpath
+
+_llama_matchmaker() {
+    local -a commands
+    commands=(
+`)
+	for _, c := range commands {
+		fmt.Fprintf(w, "        '%s:%s'\n", c.name, shellQuoted(c.help))
+	}
+	fmt.Fprint(w, `    )
+
+    if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then
+        _describe -t commands 'command' commands
+        return
+    fi
+
+    if (( CURRENT > 2 )) && (( ${commands[(I)${words[2]}:*]} )); then
+        local cmd=$words[2]
+        shift words
+        (( CURRENT-- ))
+        case $cmd in
+`)
+	for _, c := range commands {
+		fmt.Fprintf(w, "            %s)\n                _arguments -s", c.name)
+		for _, f := range c.flags {
+			fmt.Fprintf(w, " \\\n                    %s", zshFlagSpec(f))
+		}
+		if len(c.args) > 0 {
+			fmt.Fprintf(w, " \\\n                    '1:%s:(%s)'", c.name, strings.Join(c.args, " "))
+		}
+		fmt.Fprint(w, "\n                ;;\n")
+	}
+	fmt.Fprint(w, `        esac
+        return
+    fi
+
+    _arguments -s`)
+	for _, f := range mainFlags() {
+		fmt.Fprintf(w, " \\\n        %s", zshFlagSpec(f))
+	}
+	fmt.Fprint(w, `
+}
+
+if [[ $zsh_eval_context[-1] == loadautofunc ]]; then
+    _llama_matchmaker "$@"
+else
+    compdef _llama_matchmaker llama-matchmaker
+fi
+`)
+}
+
+// fishFlag renders a complete line for a flag under condition, accepting one or two dashes
+func fishFlag(condition string, f completionFlag) string {
+	line := fmt.Sprintf("complete -c llama-matchmaker -n '%s' -o %s -l %s -d '%s'", condition, f.name, f.name, fishQuoted(f.help))
+	switch f.value {
+	case valueText:
+		line += " -x"
+	case valueFile:
+		line += " -r -F"
+	case valueConfig:
+		line += " -x -a '(__fish_complete_suffix .yml; __fish_complete_suffix .yaml)'"
+	case valueWords:
+		line += " -x -a '" + strings.Join(f.words, " ") + "'"
+	}
+	return line
+}
+
+func writeFishCompletion(w io.Writer, commands []completionCommand) {
+	names := commandNames(commands)
+	noCommand := "not __fish_seen_subcommand_from " + names
+	fmt.Fprint(w, `# fish completion for llama-matchmaker
+# Save with: llama-matchmaker completion fish > ~/.config/fish/completions/llama-matchmaker.fish
+
+complete -c llama-matchmaker -f
+`)
+	for _, c := range commands {
+		fmt.Fprintf(w, "complete -c llama-matchmaker -n '%s' -a %s -d '%s'\n", noCommand, c.name, fishQuoted(c.help))
+	}
+	for _, f := range mainFlags() {
+		fmt.Fprintln(w, fishFlag(noCommand, f))
+	}
+	for _, c := range commands {
+		fmt.Fprintf(w, "\n# %s\n", c.name)
+		condition := "__fish_seen_subcommand_from " + c.name
+		if len(c.args) > 0 {
+			fmt.Fprintf(w, "complete -c llama-matchmaker -n '%s; and not __fish_seen_subcommand_from %s' -a '%s'\n", condition, strings.Join(c.args, " "), strings.Join(c.args, " "))
+		}
+		for _, f := range c.flags {
+			fmt.Fprintln(w, fishFlag(condition, f))
+		}
+	}
+}
+
+func writePowerShellCompletion(w io.Writer, commands []completionCommand) {
+	fmt.Fprint(w, `# PowerShell completion for llama-matchmaker
+# Load with: llama-matchmaker completion powershell | Out-String | Invoke-Expression
+
+Register-ArgumentCompleter -Native -CommandName 'llama-matchmaker', 'llama-matchmaker.exe' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $commands = [ordered]@{
+`)
+	for _, c := range commands {
+		fmt.Fprintf(w, "        '%s' = '%s'\n", c.name, strings.ReplaceAll(c.help, "'", "''"))
+	}
+	fmt.Fprint(w, `    }
+    # Flags per command: name = @(value kind, help, words)
+    $flags = @{
+`)
+	all := append([]completionCommand{{flags: mainFlags()}}, commands...)
+	for _, c := range all {
+		fmt.Fprintf(w, "        '%s' = [ordered]@{\n", c.name)
+		for _, f := range c.flags {
+			words := make([]string, len(f.words))
+			for i, word := range f.words {
+				words[i] = "'" + word + "'"
+			}
+			fmt.Fprintf(w, "            '-%s' = @('%s', '%s', @(%s))\n", f.name, f.value, strings.ReplaceAll(f.help, "'", "''"), strings.Join(words, ", "))
+		}
+		fmt.Fprint(w, "        }\n")
+	}
+	fmt.Fprint(w, `    }
+    $positional = @{
+`)
+	for _, c := range commands {
+		if len(c.args) > 0 {
+			fmt.Fprintf(w, "        '%s' = @('%s')\n", c.name, strings.Join(c.args, "', '"))
+		}
+	}
+	fmt.Fprint(w, `    }
+
+    $elements = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    # Words before the one being completed
+    $before = $elements.Count
+    if ($wordToComplete -ne '') { $before-- }
+    $cmd = ''
+    if ($before -gt 1 -and $commands.Contains($elements[1])) { $cmd = $elements[1] }
+    $prev = if ($before -gt 0) { '-' + $elements[$before - 1].TrimStart('-') } else { '' }
+    $result = { param($text, $tip) [System.Management.Automation.CompletionResult]::new($text, $text, 'ParameterValue', $tip) }
+
+    if ($flags[$cmd].Contains($prev) -and $flags[$cmd][$prev][0] -ne '') {
+        $kind, $tip, $words = $flags[$cmd][$prev]
+        switch ($kind) {
+            'words' { $words | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object { & $result $_ $tip } }
+            'config' {
+                Get-ChildItem -Path "$wordToComplete*" -ErrorAction SilentlyContinue |
+                    Where-Object { $_.PSIsContainer -or $_.Extension -in '.yml', '.yaml' } |
+                    ForEach-Object {
+                        $path = Resolve-Path -Relative $_.FullName
+                        [System.Management.Automation.CompletionResult]::new($path, $path, 'ProviderItem', $path)
+                    }
+            }
+            # Nothing returned falls back to path completion
+        }
+        return
+    }
+
+    if ($wordToComplete -like '-*') {
+        $dashes = if ($wordToComplete -like '--*') { '-' } else { '' }
+        $flags[$cmd].GetEnumerator() | Where-Object { ($dashes + $_.Key) -like "$wordToComplete*" } | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($dashes + $_.Key, $_.Key, 'ParameterName', $_.Value[1])
+        }
+    } elseif ($cmd -eq '' -and $before -eq 1) {
+        $commands.GetEnumerator() | Where-Object { $_.Key -like "$wordToComplete*" } | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_.Key, $_.Key, 'Command', $_.Value)
+        }
+    } elseif ($positional.ContainsKey($cmd) -and $before -eq 2) {
+        $positional[$cmd] | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object { & $result $_ $_ }
+    }
+}
+`)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// helpFlags returns the flags a subcommand prints for -h
+func helpFlags(t *testing.T, run func([]string) int) []string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	run([]string{"-h"})
+	os.Stderr = stderr
+	w.Close()
+	out, _ := io.ReadAll(r)
+
+	var flags []string
+	for _, m := range regexp.MustCompile(`(?m)^  -(\S+)`).FindAllStringSubmatch(string(out), -1) {
+		flags = append(flags, m[1])
+	}
+	slices.Sort(flags)
+	return flags
+}
+
+func TestCompletionSpecMatchesSubcommands(t *testing.T) {
+	specs := make(map[string]completionCommand)
+	for _, c := range completionCommands() {
+		specs[c.name] = c
+		if _, ok := subcommands[c.name]; !ok {
+			t.Errorf("completion lists %q, which is not a subcommand", c.name)
+		}
+	}
+
+	for name, run := range subcommands {
+		spec, ok := specs[name]
+		if !ok {
+			t.Errorf("subcommand %q is missing from completionCommands", name)
+			continue
+		}
+		// These take a positional word before any flags
+		if name == "completion" || name == "service" {
+			continue
+		}
+		var want []string
+		for _, f := range spec.flags {
+			want = append(want, f.name)
+		}
+		slices.Sort(want)
+		if got := helpFlags(t, run); !slices.Equal(got, want) {
+			t.Errorf("%s flags = %v, completion offers %v", name, got, want)
+		}
+	}
+}
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range completionShells {
+		var buf bytes.Buffer
+		if err := writeCompletion(&buf, shell); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		for _, want := range []string{"test-request", "-config", "openai-gateway", "unused_include", "uninstall"} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s script missing %q", shell, want)
+			}
+		}
+	}
+
+	if err := writeCompletion(io.Discard, "tcsh"); err == nil {
+		t.Fatal("expected an error for an unsupported shell")
+	}
+}
+
+func TestCompletionHelpIsShellSafe(t *testing.T) {
+	check := func(where, help string) {
+		if strings.ContainsAny(help, "[]:`$\"\\") {
+			t.Errorf("%s help %q has characters the scripts don't escape", where, help)
+		}
+	}
+	for _, f := range mainFlags() {
+		check("-"+f.name, f.help)
+	}
+	for _, c := range completionCommands() {
+		check(c.name, c.help)
+		for _, f := range c.flags {
+			check(c.name+" -"+f.name, f.help)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+)
+
+// starterConfigs holds the commented configs written by init, one per backend preset
+//
+//go:embed starters/*.config.yml
+var starterConfigs embed.FS
+
+// starterPresets lists the presets init accepts, sorted
+func starterPresets() []string {
+	entries, _ := fs.ReadDir(starterConfigs, "starters")
+	var presets []string
+	for _, e := range entries {
+		presets = append(presets, strings.TrimSuffix(e.Name(), ".config.yml"))
+	}
+	slices.Sort(presets)
+	return presets
+}
+
+// runInitCommand writes a starter config for a backend
+func runInitCommand(args []string) int {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	presets := starterPresets()
+	preset := flags.String("preset", "", "Backend to configure for: "+strings.Join(presets, ", "))
+	output := flags.String("o", "config.yml", "File to write; - prints to stdout")
+	force := flags.Bool("force", false, "Overwrite an existing file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *preset == "" {
+		fmt.Fprintf(os.Stderr, "init: -preset is required (%s)\n", strings.Join(presets, ", "))
+		return 2
+	}
+
+	starter, err := starterConfigs.ReadFile("starters/" + *preset + ".config.yml")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "init: unknown preset %q (want %s)\n", *preset, strings.Join(presets, ", "))
+		return 2
+	}
+
+	if *output == "-" {
+		os.Stdout.Write(starter)
+		return 0
+	}
+
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(*output, mode, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		fmt.Fprintf(os.Stderr, "init: %s already exists (use -force to overwrite)\n", *output)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "init: %v\n", err)
+		return 1
+	}
+	_, err = f.Write(starter)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "init: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Wrote %s for %s. Start the proxy with:\n  llama-matchmaker --config %s\n", *output, *preset, *output)
+	return 0
+}
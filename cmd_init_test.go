@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestInitPresetsLoad(t *testing.T) {
+	presets := starterPresets()
+	if len(presets) != 3 {
+		t.Fatalf("presets = %v, want ollama, llama-cpp, and openai-gateway", presets)
+	}
+	for _, preset := range presets {
+		t.Run(preset, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yml")
+			if code := runInitCommand([]string{"-preset", preset, "-o", path}); code != 0 {
+				t.Fatalf("init exited %d", code)
+			}
+			cfg, _, err := config.Load([]string{path}, config.CliOverrides{})
+			if err != nil {
+				t.Fatalf("starter config does not load: %v", err)
+			}
+			if len(cfg.Proxies) != 1 || len(cfg.Proxies[0].Routes) == 0 {
+				t.Fatalf("config = %+v, want one proxy with routes", cfg)
+			}
+		})
+	}
+}
+
+func TestInitKeepsExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(path, []byte("mine"), 0o644)
+
+	if code := runInitCommand([]string{"-preset", "ollama", "-o", path}); code != 1 {
+		t.Fatalf("init exited %d, want 1 for an existing file", code)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "mine" {
+		t.Fatalf("existing file overwritten: %q", data)
+	}
+	if code := runInitCommand([]string{"-preset", "ollama", "-o", path, "-force"}); code != 0 {
+		t.Fatalf("init -force exited %d", code)
+	}
+	if data, _ := os.ReadFile(path); string(data) == "mine" {
+		t.Fatal("init -force kept the old file")
+	}
+}
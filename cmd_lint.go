@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// runLintCommand loads the config and reports routes and actions that can't work as written.
+// It exits 1 when anything is found, for use in CI.
+func runLintCommand(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	var paths configFiles
+	fs.Var(&paths, "config", "Config file to load (can be specified multiple times)")
+	fs.Var(&paths, "c", "Alias for -config")
+	ignore := fs.String("ignore", "", "Comma-separated checks to skip (ex: catch_all,unanchored)")
+	asJSON := fs.Bool("json", false, "Print findings as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "lint: -config is required")
+		return 2
+	}
+
+	// Results go to stdout, so keep load logs out of them
+	logger.SetOutput(os.Stderr)
+	cfg, loaded, err := config.Load(paths, config.CliOverrides{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lint: %v\n", err)
+		return 1
+	}
+
+	skip := strings.Split(*ignore, ",")
+	findings := []config.Finding{}
+	for _, f := range append(config.Lint(cfg), config.LintIncludes(paths, loaded)...) {
+		if !slices.Contains(skip, f.Check) {
+			findings = append(findings, f)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(findings)
+	} else {
+		printFindings(os.Stdout, findings)
+	}
+	if len(findings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printFindings(w io.Writer, findings []config.Finding) {
+	for _, f := range findings {
+		where := f.Source
+		if f.Route >= 0 {
+			route := fmt.Sprintf("route %d", f.Route)
+			if f.Name != "" {
+				route += " (" + f.Name + ")"
+			}
+			where = strings.TrimPrefix(where+": "+f.Listen+" "+route, ": ")
+		}
+		fmt.Fprintf(w, "%s: %s [%s]\n", where, f.Message, f.Check)
+	}
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "No problems found")
+	}
+}
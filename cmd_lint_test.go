@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestLintExitCodeAndIgnore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(path, []byte(`
+proxy:
+  listen: localhost:8081
+  target: http://localhost:8080
+  routes:
+    - methods: POST
+      paths: /v1/chat/completions
+      on_request:
+        - merge: { temperature: 0.2 }
+`), 0o644)
+
+	if code := runLintCommand([]string{"-c", path, "-json"}); code != 1 {
+		t.Fatalf("lint exited %d, want 1 for an unanchored path", code)
+	}
+	if code := runLintCommand([]string{"-c", path, "-ignore", config.LintUnanchored, "-json"}); code != 0 {
+		t.Fatalf("lint -ignore exited %d, want 0", code)
+	}
+}
+
+func TestPrintFindings(t *testing.T) {
+	var buf bytes.Buffer
+	printFindings(&buf, []config.Finding{
+		{Listen: "localhost:8081", Route: 2, Name: "chat", Source: "config.yml", Check: config.LintCatchAll, Message: "path pattern \".*\" matches every path"},
+		{Route: -1, Source: "rules.yml", Check: config.LintUnusedInclude, Message: "not included by any config in its directory"},
+	})
+	want := "config.yml: localhost:8081 route 2 (chat): path pattern \".*\" matches every path [catch_all]\n" +
+		"rules.yml: not included by any config in its directory [unused_include]\n"
+	if buf.String() != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	printFindings(&buf, nil)
+	if !strings.Contains(buf.String(), "No problems found") {
+		t.Fatalf("empty output = %q", buf.String())
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/admin"
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/traffic"
+)
+
+// Terminal control: alternate screen, cursor, clear
+const (
+	ansiEnterScreen = "\x1b[?1049h\x1b[?25l"
+	ansiLeaveScreen = "\x1b[?25h\x1b[?1049l"
+	ansiHome        = "\x1b[H\x1b[2J"
+)
+
+// runMonitorCommand polls /admin/monitor on a running instance and redraws a live view
+// until interrupted
+func runMonitorCommand(args []string) int {
+	fs := flag.NewFlagSet("monitor", flag.ContinueOnError)
+	var paths configFiles
+	fs.Var(&paths, "config", "Config file whose admin.listen to query (can be specified multiple times)")
+	fs.Var(&paths, "c", "Alias for -config")
+	adminAddr := fs.String("admin", "", "Admin listener address (ex: localhost:9090); overrides -config")
+	interval := fs.Duration("interval", time.Second, "Refresh interval")
+	once := fs.Bool("once", false, "Print one frame without taking over the terminal")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *interval <= 0 {
+		fmt.Fprintln(os.Stderr, "monitor: -interval must be positive")
+		return 2
+	}
+
+	addr := *adminAddr
+	if addr == "" && len(paths) > 0 {
+		cfg, _, err := config.Load(paths, config.CliOverrides{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monitor: %v\n", err)
+			return 1
+		}
+		addr = cfg.Admin.Listen
+	}
+	if addr == "" {
+		fmt.Fprintln(os.Stderr, "monitor: -admin or a -config with admin.listen is required")
+		return 2
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	width, height := terminalSize()
+
+	if *once {
+		snap, err := fetchMonitor(client, addr, height)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monitor: %v\n", err)
+			return 1
+		}
+		renderMonitor(os.Stdout, addr, snap, nil, width, height)
+		return 0
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	fmt.Print(ansiEnterScreen)
+	defer fmt.Print(ansiLeaveScreen)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	var prev *admin.Monitor
+	for {
+		width, height = terminalSize()
+		var frame strings.Builder
+		snap, err := fetchMonitor(client, addr, height)
+		if err != nil {
+			fmt.Fprintf(&frame, "llama-matchmaker monitor  %s  %s\n\n%v\n\nRetrying every %s (Ctrl-C to quit)\n",
+				addr, time.Now().Format(time.TimeOnly), err, *interval)
+		} else {
+			renderMonitor(&frame, addr, snap, prev, width, height)
+			prev = snap
+		}
+		fmt.Print(ansiHome + frame.String())
+
+		select {
+		case <-stop:
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetchMonitor reads one snapshot, with enough requests to fill the screen
+func fetchMonitor(client *http.Client, addr string, height int) (*admin.Monitor, error) {
+	endpoint := url.URL{Scheme: "http", Host: addr, Path: admin.MonitorPath, RawQuery: "requests=" + strconv.Itoa(max(height, 10))}
+	resp, err := client.Get(endpoint.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var snap admin.Monitor
+	if err := json.Unmarshal(body, &snap); err != nil {
+		return nil, fmt.Errorf("invalid monitor report: %w", err)
+	}
+	return &snap, nil
+}
+
+// renderMonitor draws one frame: proxies with request rates, route hits, targets, and as
+// much of the request log as fits in height. Rates need prev and show - without it.
+func renderMonitor(w io.Writer, addr string, snap, prev *admin.Monitor, width, height int) {
+	var out strings.Builder
+	fmt.Fprintf(&out, "llama-matchmaker monitor  %s  %s  (Ctrl-C to quit)\n\n", addr, snap.Time.Local().Format(time.TimeOnly))
+
+	elapsed := 0.0
+	prevRequests := map[string]int64{}
+	prevHits := map[string]int64{}
+	if prev != nil {
+		elapsed = snap.Time.Sub(prev.Time).Seconds()
+		for _, p := range prev.Proxies {
+			prevRequests[p.Listen] = p.Requests
+			for _, r := range p.Routes {
+				prevHits[p.Listen+" "+r.Route] = r.Hits
+			}
+		}
+	}
+	rate := func(now, before int64) string {
+		if elapsed <= 0 {
+			return "-"
+		}
+		return strconv.FormatFloat(float64(now-before)/elapsed, 'f', 1, 64)
+	}
+
+	ready := map[string]bool{}
+	for _, p := range snap.Health.Proxies {
+		ready[p.Listen] = p.Ready
+	}
+
+	tw := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LISTEN\tREQ/S\tREQUESTS\tSTREAMS\tREADY\t")
+	for _, p := range snap.Proxies {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t\n", p.Listen, rate(p.Requests, prevRequests[p.Listen]), p.Requests, p.ActiveStreams, yesNo(ready[p.Listen]))
+	}
+	if len(snap.Proxies) == 0 {
+		fmt.Fprintln(tw, "(no requests yet)\t\t\t\t\t")
+	}
+	tw.Flush()
+
+	out.WriteString("\n")
+	tw = tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LISTEN\tROUTE\tHITS/S\tHITS\t")
+	for _, p := range snap.Proxies {
+		for _, r := range p.Routes {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t\n", p.Listen, r.Route, rate(r.Hits, prevHits[p.Listen+" "+r.Route]), r.Hits)
+		}
+	}
+	tw.Flush()
+
+	out.WriteString("\n")
+	printMonitorTargets(&out, snap)
+
+	out.WriteString("\n")
+	if !snap.Traffic {
+		out.WriteString("Request log is off; set admin.dashboard to record recent requests\n")
+	} else {
+		// Whatever height the tables left, less the heading
+		used := strings.Count(out.String(), "\n")
+		rows := max(height-used-1, 3)
+		out.WriteString("RECENT REQUESTS\n")
+		for i, e := range snap.Requests {
+			if i == rows {
+				break
+			}
+			out.WriteString(requestLine(e) + "\n")
+		}
+	}
+
+	// Long lines would wrap and push the log off screen
+	for line := range strings.Lines(out.String()) {
+		line = strings.TrimSuffix(line, "\n")
+		if width > 0 && len(line) > width {
+			line = line[:width]
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// printMonitorTargets lists each proxy's targets with polled health and recent traffic
+func printMonitorTargets(w io.Writer, snap *admin.Monitor) {
+	seen := map[string]traffic.Health{}
+	for _, h := range snap.Targets {
+		seen[h.Target] = h
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LISTEN\tTARGET\tUP\tREQUESTS\tERRORS\tLAST ERROR\t")
+	for _, p := range snap.Health.Proxies {
+		for _, t := range p.Targets {
+			up := "?"
+			if t.Up != nil {
+				up = yesNo(*t.Up)
+			}
+			requests, errors, lastError := "-", "-", ""
+			// Traffic is keyed by host, health by URL
+			if u, err := url.Parse(t.URL); err == nil {
+				if h, ok := seen[u.Host]; ok {
+					requests, errors, lastError = strconv.Itoa(h.Requests), strconv.Itoa(h.Errors), h.LastError
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t\n", p.Listen, t.URL, up, requests, errors, lastError)
+		}
+	}
+	tw.Flush()
+}
+
+// requestLine summarizes one recorded request on a line
+func requestLine(e traffic.Exchange) string {
+	status := "..."
+	if e.Status != 0 {
+		status = strconv.Itoa(e.Status)
+	}
+	parts := []string{e.Start.Local().Format(time.TimeOnly), status, e.Method, e.Path}
+	if e.Stream {
+		parts = append(parts, "stream")
+	}
+	if e.Done {
+		parts = append(parts, strconv.FormatFloat(e.DurationMS, 'f', 0, 64)+"ms")
+	}
+	if e.Model != "" {
+		parts = append(parts, "model="+e.Model)
+	}
+	if len(e.Routes) > 0 {
+		routes := make([]string, len(e.Routes))
+		for i, r := range e.Routes {
+			routes[i] = r.Name
+			if r.Name == "" {
+				routes[i] = strconv.Itoa(r.Index)
+			}
+		}
+		parts = append(parts, "routes="+strings.Join(routes, ","))
+	}
+	if e.Rejection != "" {
+		parts = append(parts, "rejected="+e.Rejection)
+	}
+	if e.Error != "" {
+		parts = append(parts, "error="+e.Error)
+	}
+	return strings.Join(parts, "  ")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// defaultTerminalSize reads COLUMNS and LINES, falling back to 120x40
+func defaultTerminalSize() (width, height int) {
+	width, height = 120, 40
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		width = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 0 {
+		height = n
+	}
+	return width, height
+}
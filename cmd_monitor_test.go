@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/admin"
+	"github.com/spicyneuron/llama-matchmaker/health"
+	"github.com/spicyneuron/llama-matchmaker/proxy"
+	"github.com/spicyneuron/llama-matchmaker/traffic"
+)
+
+func TestRenderMonitor(t *testing.T) {
+	now := time.Now()
+	up := false
+	prev := &admin.Monitor{
+		Time:    now.Add(-2 * time.Second),
+		Proxies: []proxy.ProxyStats{{Listen: "localhost:8081", Requests: 10, Routes: []proxy.RouteHits{{Route: "chat", Hits: 4}}}},
+	}
+	snap := &admin.Monitor{
+		Time:    now,
+		Proxies: []proxy.ProxyStats{{Listen: "localhost:8081", Requests: 16, ActiveStreams: 2, Routes: []proxy.RouteHits{{Route: "chat", Hits: 8}}}},
+		Health: health.Status{Proxies: []health.Proxy{{
+			Listen:  "localhost:8081",
+			Ready:   true,
+			Targets: []health.Target{{URL: "http://gpu:8080", Up: &up}},
+		}}},
+		Traffic: true,
+		Targets: []traffic.Health{{Target: "gpu:8080", Requests: 16, Errors: 1, LastError: "connection refused"}},
+		Requests: []traffic.Exchange{
+			{Start: now, Method: "POST", Path: "/v1/chat/completions", Status: 200, Stream: true, Done: true, DurationMS: 812, Model: "llama3", Routes: []traffic.Route{{Index: 0, Name: "chat"}}},
+			{Start: now, Method: "GET", Path: "/v1/models"},
+		},
+	}
+
+	var buf bytes.Buffer
+	renderMonitor(&buf, "localhost:9090", snap, prev, 200, 40)
+	out := buf.String()
+	for _, want := range []string{
+		"localhost:8081  3.0    16        2        yes",
+		"localhost:8081  chat   2.0     8",
+		"http://gpu:8080  no  16        1       connection refused",
+		"200  POST  /v1/chat/completions  stream  812ms  model=llama3  routes=chat",
+		"...  GET  /v1/models",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	// Without a previous frame there is no rate; without traffic there is no log
+	snap.Traffic = false
+	buf.Reset()
+	renderMonitor(&buf, "localhost:9090", snap, nil, 40, 40)
+	out = buf.String()
+	if !strings.Contains(out, "localhost:8081  -") || !strings.Contains(out, "Request log is off") {
+		t.Fatalf("output without prev or traffic:\n%s", out)
+	}
+	for line := range strings.Lines(out) {
+		if len(strings.TrimSuffix(line, "\n")) > 40 {
+			t.Fatalf("line exceeds width: %q", line)
+		}
+	}
+}
+
+func TestRunMonitorCommandRequiresAddress(t *testing.T) {
+	if code := runMonitorCommand(nil); code != 2 {
+		t.Fatalf("exit code = %d, want 2 without -admin or -config", code)
+	}
+}
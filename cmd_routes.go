@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// routeEntry is one row of the routing table
+type routeEntry struct {
+	Listen       string   `json:"listen"`
+	Index        int      `json:"index"`
+	Name         string   `json:"name,omitempty"`
+	Methods      []string `json:"methods"`
+	Paths        []string `json:"paths"`
+	ContentTypes []string `json:"content_types,omitempty"`
+	TargetPath   string   `json:"target_path,omitempty"`
+	Actions      []string `json:"actions"`
+	Source       string   `json:"source,omitempty"`
+}
+
+// runRoutesCommand loads the config and prints every proxy's routes in match order
+func runRoutesCommand(args []string) int {
+	fs := flag.NewFlagSet("routes", flag.ContinueOnError)
+	var paths configFiles
+	fs.Var(&paths, "config", "Config file to load (can be specified multiple times)")
+	fs.Var(&paths, "c", "Alias for -config")
+	asJSON := fs.Bool("json", false, "Print the routing table as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "routes: -config is required")
+		return 2
+	}
+
+	// Results go to stdout, so keep load logs out of them
+	logger.SetOutput(os.Stderr)
+	cfg, _, err := config.Load(paths, config.CliOverrides{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "routes: %v\n", err)
+		return 1
+	}
+
+	entries := routeEntries(cfg)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(entries)
+		return 0
+	}
+	printRoutes(os.Stdout, entries)
+	return 0
+}
+
+func routeEntries(cfg *config.Config) []routeEntry {
+	entries := []routeEntry{}
+	for _, proxy := range cfg.Proxies {
+		for i, route := range proxy.Routes {
+			entries = append(entries, routeEntry{
+				Listen:       proxy.Listen,
+				Index:        i,
+				Name:         route.Name,
+				Methods:      route.Methods.Patterns,
+				Paths:        route.Paths.Patterns,
+				ContentTypes: route.ContentTypes.Patterns,
+				TargetPath:   route.TargetPath,
+				Actions:      routeActions(route),
+				Source:       route.Source,
+			})
+		}
+	}
+	return entries
+}
+
+// routeActions summarizes what a route does: its policies, then its actions per phase
+func routeActions(route config.Route) []string {
+	var actions []string
+	if route.Format != "" {
+		actions = append(actions, "format="+route.Format)
+	}
+	if route.Priority != "" {
+		actions = append(actions, "priority="+route.Priority)
+	}
+	timeouts := []struct {
+		name  string
+		limit time.Duration
+	}{
+		{"response_timeout", route.ResponseTimeout},
+		{"first_byte_timeout", route.FirstByteTimeout},
+		{"idle_chunk_timeout", route.IdleChunkTimeout},
+	}
+	for _, t := range timeouts {
+		if t.limit > 0 {
+			actions = append(actions, t.name+"="+t.limit.String())
+		}
+	}
+	policies := []struct {
+		name string
+		set  bool
+	}{
+		{"context", route.Context != nil},
+		{"images", route.Images != nil},
+		{"files", route.Files != nil},
+		{"embeddings", route.Embeddings != nil},
+		{"prompt", route.Prompt != nil},
+		{"choices", route.Choices != nil},
+		{"structured_output", route.StructuredOutput != nil},
+		{"reasoning", route.Reasoning != nil},
+		{"moderation", route.Moderation != nil},
+		{"trace", route.Trace},
+		{"retry", route.Retry},
+		{"options", route.Options != nil},
+	}
+	for _, p := range policies {
+		if p.set {
+			actions = append(actions, p.name)
+		}
+	}
+	if len(route.OnRequest) > 0 {
+		actions = append(actions, "on_request: "+strings.Join(actionKinds(route.OnRequest), ", "))
+	}
+	if len(route.OnResponse) > 0 {
+		actions = append(actions, "on_response: "+strings.Join(actionKinds(route.OnResponse), ", "))
+	}
+	return actions
+}
+
+// actionKinds lists the kinds of actions in a phase, once each in first-seen order
+func actionKinds(ops []config.Action) []string {
+	var kinds []string
+	seen := make(map[string]bool)
+	add := func(kind string, set bool) {
+		if set && !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	config.WalkActions(ops, func(op *config.Action) {
+		add("actions", len(op.Actions) > 0)
+		add("template", op.Template != "")
+		add("merge", len(op.Merge) > 0)
+		add("default", len(op.Default) > 0)
+		add("delete", len(op.Delete) > 0)
+		add("param_map", !op.ParamMap.IsZero())
+		add("apply_preset", op.ApplyPreset != nil)
+		add("normalize_stop", op.NormalizeStop != nil)
+		add("redact", op.Redact != nil)
+		add("seed", op.Seed != nil)
+		add("from_request", len(op.FromRequest) > 0)
+		add("else", len(op.ElseActions) > 0 || op.Else != nil)
+		add("stop", op.Stop)
+	})
+	return kinds
+}
+
+func printRoutes(w io.Writer, entries []routeEntry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LISTEN\t#\tNAME\tMETHODS\tPATHS\tTARGET PATH\tACTIONS\tSOURCE\t")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+			e.Listen, e.Index, orDash(e.Name), strings.Join(e.Methods, " "), strings.Join(e.Paths, " "),
+			orDash(e.TargetPath), strings.Join(e.Actions, "; "), e.Source)
+	}
+	tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestRouteEntriesRecordIncludeOrigin(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "main.yml")
+	included := filepath.Join(dir, "chat.yml")
+	os.WriteFile(mainPath, []byte(`
+proxy:
+  listen: localhost:8081
+  target: http://localhost:8080
+  routes:
+    - name: embeddings
+      methods: POST
+      paths: ^/v1/embeddings$
+      embeddings: { batch_size: 16 }
+    - include: chat.yml
+`), 0o644)
+	os.WriteFile(included, []byte(`
+- methods: [POST]
+  paths: ^/v1/chat/completions$
+  target_path: /chat
+  format: openai-to-ollama
+  on_request:
+    - default: { temperature: 0.7 }
+    - merge: { stream: false }
+    - default: { top_p: 0.9 }
+`), 0o644)
+
+	cfg, _, err := config.Load([]string{mainPath}, config.CliOverrides{})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	entries := routeEntries(cfg)
+	if len(entries) != 2 {
+		t.Fatalf("got %d routes, want 2", len(entries))
+	}
+	if entries[0].Name != "embeddings" || entries[0].Source != mainPath {
+		t.Errorf("route 0 = %+v, want name embeddings from %s", entries[0], mainPath)
+	}
+	if entries[1].Source != included || entries[1].TargetPath != "/chat" {
+		t.Errorf("route 1 = %+v, want target_path /chat from %s", entries[1], included)
+	}
+	wantActions := []string{"format=openai-to-ollama", "on_request: default, merge"}
+	if strings.Join(entries[1].Actions, "|") != strings.Join(wantActions, "|") {
+		t.Errorf("route 1 actions = %v, want %v", entries[1].Actions, wantActions)
+	}
+
+	var buf bytes.Buffer
+	printRoutes(&buf, entries)
+	for _, want := range []string{"LISTEN", "embeddings", "^/v1/chat/completions$", "chat.yml"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("table missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRunRoutesCommandRequiresConfig(t *testing.T) {
+	if code := runRoutesCommand(nil); code != 2 {
+		t.Fatalf("exit code = %d, want 2 without -config", code)
+	}
+}
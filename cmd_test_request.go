@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/proxy"
+)
+
+// headerFlags collects repeated -H "Name: value" flags
+type headerFlags []string
+
+func (h *headerFlags) String() string     { return strings.Join(*h, ", ") }
+func (h *headerFlags) Set(v string) error { *h = append(*h, v); return nil }
+
+// requestReport is the outcome of running a sample request through a proxy's routes
+type requestReport struct {
+	Method    string               `json:"method"`
+	Path      string               `json:"path"`
+	Routes    []reportRoute        `json:"routes"`
+	Fired     []config.FiredAction `json:"fired"`
+	Rejection *reportRejection     `json:"rejection,omitempty"`
+	Before    json.RawMessage      `json:"before,omitempty"`
+	After     json.RawMessage      `json:"after,omitempty"`
+}
+
+type reportRoute struct {
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+}
+
+type reportRejection struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// runTestRequestCommand runs a sample request through matching and on_request transforms
+// without contacting a backend
+func runTestRequestCommand(args []string) int {
+	fs := flag.NewFlagSet("test-request", flag.ContinueOnError)
+	var paths configFiles
+	var headers headerFlags
+	fs.Var(&paths, "config", "Config file to load (can be specified multiple times)")
+	fs.Var(&paths, "c", "Alias for -config")
+	fs.Var(&headers, "H", `Request header as "Name: value" (can be specified multiple times)`)
+	listen := fs.String("listen", "", "Proxy to evaluate, by listen address; defaults to the first")
+	method := fs.String("method", http.MethodPost, "Request method")
+	path := fs.String("path", "", "Request path, with an optional query string (ex: /v1/chat/completions)")
+	bodyFile := fs.String("body", "", "File holding the request body; - reads stdin")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(paths) == 0 || *path == "" {
+		fmt.Fprintln(os.Stderr, "test-request: -config and -path are required")
+		return 2
+	}
+
+	// Results go to stdout, so keep load logs out of them
+	logger.SetOutput(os.Stderr)
+	cfg, _, err := config.Load(paths, config.CliOverrides{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "test-request: %v\n", err)
+		return 1
+	}
+	proxyCfg, ok := selectProxy(cfg, *listen)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "test-request: no proxy listens on %s\n", *listen)
+		return 1
+	}
+
+	var body []byte
+	switch *bodyFile {
+	case "":
+	case "-":
+		body, err = io.ReadAll(os.Stdin)
+	default:
+		body, err = os.ReadFile(*bodyFile)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "test-request: %v\n", err)
+		return 1
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(*method), "http://"+proxyCfg.Listen+*path, bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "test-request: %v\n", err)
+		return 1
+	}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "test-request: header %q must be \"Name: value\"\n", h)
+			return 2
+		}
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	report := evaluateRequest(proxyCfg, req, body)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return 0
+	}
+	printRequestReport(os.Stdout, report)
+	return 0
+}
+
+func selectProxy(cfg *config.Config, listen string) (config.ProxyConfig, bool) {
+	for _, p := range cfg.Proxies {
+		if listen == "" || p.Listen == listen {
+			return p, true
+		}
+	}
+	return config.ProxyConfig{}, false
+}
+
+// evaluateRequest runs req through the proxy's request pipeline and reports what changed
+func evaluateRequest(proxyCfg config.ProxyConfig, req *http.Request, body []byte) requestReport {
+	// Explaining records each action's diff
+	req.Header.Set(proxy.ExplainHeader, "true")
+	proxy.NewHandler(proxyCfg).ModifyRequest(req)
+	var after []byte
+	if req.Body != nil {
+		after, _ = io.ReadAll(req.Body)
+	}
+
+	trace := proxy.TraceFromRequest(req)
+	report := requestReport{
+		Method: req.Method,
+		Path:   req.URL.RequestURI(),
+		Fired:  trace.Fired,
+		Before: asRawJSON(body),
+		After:  asRawJSON(after),
+	}
+	for _, i := range trace.Routes {
+		report.Routes = append(report.Routes, reportRoute{Index: i, Name: proxyCfg.Routes[i].Name})
+	}
+	if rej := trace.Rejection; rej != nil {
+		report.Rejection = &reportRejection{Status: rej.Status, Code: rej.Code, Message: rej.Message}
+	}
+	return report
+}
+
+// asRawJSON returns body as JSON, quoting it as a string when it isn't JSON
+func asRawJSON(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+func printRequestReport(w io.Writer, report requestReport) {
+	fmt.Fprintf(w, "Upstream: %s %s\n", report.Method, report.Path)
+
+	if len(report.Routes) == 0 {
+		fmt.Fprintln(w, "Routes: none matched")
+	} else {
+		fmt.Fprintln(w, "Routes:")
+		for _, r := range report.Routes {
+			fmt.Fprintf(w, "  %d %s\n", r.Index, orDash(r.Name))
+		}
+	}
+
+	if len(report.Fired) > 0 {
+		fmt.Fprintln(w, "Actions:")
+		for _, a := range report.Fired {
+			changes := "no changes"
+			if len(a.Changes) > 0 {
+				changes = strings.Join(a.Changes, ", ")
+			}
+			fmt.Fprintf(w, "  route %d on_%s %d: %s\n", a.Route, a.Phase, a.Index, changes)
+			for _, c := range a.Diff {
+				fmt.Fprintf(w, "    %s\n", formatChange(c))
+			}
+		}
+	}
+
+	if rej := report.Rejection; rej != nil {
+		fmt.Fprintf(w, "Rejected: %d %s: %s\n", rej.Status, rej.Code, rej.Message)
+	}
+
+	before, after := indentJSON(report.Before), indentJSON(report.After)
+	if before == after {
+		fmt.Fprintln(w, "Body: unchanged")
+		return
+	}
+	fmt.Fprintln(w, "Body:")
+	for _, line := range diffLines(before, after) {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// formatChange renders a diff entry as "path: old -> new"
+func formatChange(c config.Change) string {
+	value := func(v any) string {
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+	switch c.Op {
+	case config.ChangeAdded:
+		return fmt.Sprintf("%s: added %s", c.Path, value(c.New))
+	case config.ChangeDeleted:
+		return fmt.Sprintf("%s: deleted (was %s)", c.Path, value(c.Old))
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.Path, value(c.Old), value(c.New))
+}
+
+func indentJSON(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return string(raw)
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// diffLines returns a line diff of a and b, prefixing lines with "- ", "+ ", or "  "
+func diffLines(a, b string) []string {
+	x, y := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			out = append(out, "  "+x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "- "+x[i])
+			i++
+		default:
+			out = append(out, "+ "+y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		out = append(out, "- "+x[i])
+	}
+	for ; j < len(y); j++ {
+		out = append(out, "+ "+y[j])
+	}
+	return out
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
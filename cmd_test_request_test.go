@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestEvaluateRequestReportsFiredActions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(path, []byte(`
+proxy:
+  listen: localhost:8081
+  target: http://localhost:8080
+  routes:
+    - name: tune
+      methods: POST
+      paths: ^/v1/chat/completions$
+      on_request:
+        - when: { body: { model: "^other$" } }
+          merge: { temperature: 0 }
+        - default: { temperature: 0.7 }
+        - delete: [user]
+`), 0o644)
+	cfg, _, err := config.Load([]string{path}, config.CliOverrides{})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	body := []byte(`{"model":"llama","user":"ada"}`)
+	req, _ := http.NewRequest("POST", "http://localhost:8081/v1/chat/completions", bytes.NewReader(body))
+	report := evaluateRequest(cfg.Proxies[0], req, body)
+
+	if len(report.Routes) != 1 || report.Routes[0].Name != "tune" {
+		t.Fatalf("routes = %+v, want tune", report.Routes)
+	}
+	if len(report.Fired) != 2 || report.Fired[0].Index != 1 || report.Fired[1].Index != 2 {
+		t.Fatalf("fired = %+v, want actions 1 and 2 (the when on 0 doesn't match)", report.Fired)
+	}
+	if strings.Join(report.Fired[0].Changes, ",") != "temperature" {
+		t.Fatalf("action 1 changes = %v, want temperature", report.Fired[0].Changes)
+	}
+
+	var buf bytes.Buffer
+	printRequestReport(&buf, report)
+	for _, want := range []string{"Upstream: POST /v1/chat/completions", "0 tune", "route 0 on_request 2: user", "temperature: added 0.7", `user: deleted (was "ada")`, `+   "temperature": 0.7`, `-   "user": "ada"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	got := diffLines("a\nb\nc", "a\nc\nd")
+	want := []string{"  a", "- b", "  c", "+ d"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("diff = %q, want %q", got, want)
+	}
+}
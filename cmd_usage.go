@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/admin"
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/usage"
+)
+
+// runUsageCommand fetches /admin/usage from a running instance and prints it as a table
+func runUsageCommand(args []string) int {
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+	var paths configFiles
+	fs.Var(&paths, "config", "Config file whose admin.listen to query (can be specified multiple times)")
+	fs.Var(&paths, "c", "Alias for -config")
+	adminAddr := fs.String("admin", "", "Admin listener address (ex: localhost:9090); overrides -config")
+	since := fs.Duration("since", 24*time.Hour, "Report window (ex: 24h, 168h)")
+	asJSON := fs.Bool("json", false, "Print the raw JSON report")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	addr := *adminAddr
+	if addr == "" && len(paths) > 0 {
+		cfg, _, err := config.Load(paths, config.CliOverrides{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "usage: %v\n", err)
+			return 1
+		}
+		addr = cfg.Admin.Listen
+	}
+	if addr == "" {
+		fmt.Fprintln(os.Stderr, "usage: -admin or a -config with admin.listen is required")
+		return 2
+	}
+
+	endpoint := url.URL{Scheme: "http", Host: addr, Path: admin.UsagePath, RawQuery: "since=" + since.String()}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(endpoint.String())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usage: %v\n", err)
+		return 1
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "usage: %s: %s\n", resp.Status, body)
+		return 1
+	}
+
+	if *asJSON {
+		os.Stdout.Write(body)
+		return 0
+	}
+
+	var report usage.Report
+	if err := json.Unmarshal(body, &report); err != nil {
+		fmt.Fprintf(os.Stderr, "usage: invalid report: %v\n", err)
+		return 1
+	}
+	printUsageReport(os.Stdout, report)
+	return 0
+}
+
+func printUsageReport(w io.Writer, report usage.Report) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Usage since %s\n\n", report.Since.Local().Format(time.RFC3339))
+	fmt.Fprintln(tw, "API KEY\tMODEL\tROUTE\tREQUESTS\tPROMPT\tCOMPLETION\tCOST\t")
+	for _, row := range report.Rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%.4f\t\n", row.APIKey, row.Model, row.Route, row.Requests, row.PromptTokens, row.CompletionTokens, row.Cost)
+	}
+	t := report.Total
+	fmt.Fprintf(tw, "TOTAL\t\t\t%d\t%d\t%d\t%.4f\t\n", t.Requests, t.PromptTokens, t.CompletionTokens, t.Cost)
+	tw.Flush()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/usage"
+)
+
+func TestPrintUsageReport(t *testing.T) {
+	report := usage.Report{
+		Since: time.Now(),
+		Rows: []usage.Row{{
+			APIKey: "…abcd",
+			Model:  "llama3",
+			Route:  "0",
+			Totals: usage.Totals{Requests: 3, PromptTokens: 120, CompletionTokens: 40, Cost: 0.25},
+		}},
+		Total: usage.Totals{Requests: 3, PromptTokens: 120, CompletionTokens: 40, Cost: 0.25},
+	}
+
+	var buf bytes.Buffer
+	printUsageReport(&buf, report)
+	out := buf.String()
+
+	for _, want := range []string{"API KEY", "…abcd", "llama3", "0.2500", "TOTAL"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRunUsageCommandRequiresAddress(t *testing.T) {
+	if code := runUsageCommand(nil); code != 2 {
+		t.Fatalf("exit code = %d, want 2 without -admin or -config", code)
+	}
+}
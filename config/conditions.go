@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// validateConditions compiles the named conditions and resolves the refs between them
+func validateConditions(conditions map[string]*BoolExpr) error {
+	for _, name := range slices.Sorted(maps.Keys(conditions)) {
+		cond := conditions[name]
+		if cond == nil {
+			return fmt.Errorf("conditions.%s: empty condition", name)
+		}
+		if err := cond.Validate(); err != nil {
+			return fmt.Errorf("conditions.%s: %w", name, err)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(conditions)) {
+		if err := conditions[name].resolveRefs(conditions, []string{name}); err != nil {
+			return fmt.Errorf("conditions.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateConditionRefs points the refs in a route's when expressions at their conditions,
+// then checks that only on_response actions match a status or the request, and that state
+// matches have a store
+func validateConditionRefs(route *Route, index int, conditions map[string]*BoolExpr) error {
+	phases := []struct {
+		name string
+		ops  []Action
+	}{{"on_request", route.OnRequest}, {"on_response", route.OnResponse}}
+	for _, phase := range phases {
+		for opIdx := range phase.ops {
+			var err error
+			WalkActions(phase.ops[opIdx:opIdx+1], func(op *Action) {
+				if op.When == nil || err != nil {
+					return
+				}
+				if err = op.When.resolveRefs(conditions, nil); err != nil {
+					return
+				}
+				if route.State == nil && op.When.matchesState() {
+					err = fmt.Errorf("state matches need the route's state store (state:)")
+					return
+				}
+				if phase.name == "on_response" {
+					return
+				}
+				if op.When.matchesStatus() {
+					err = fmt.Errorf("status matches responses only (on_response)")
+				} else if op.When.matchesRequest() {
+					err = fmt.Errorf("request matches from on_response only; on_request sees the request itself")
+				}
+			})
+			if err != nil {
+				return fmt.Errorf("route %d %s %d when: %w", index, phase.name, opIdx, err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveRefs sets the condition each ref in the tree refers to. path lists the conditions
+// being resolved, to reject a condition that refers to itself.
+func (b *BoolExpr) resolveRefs(conditions map[string]*BoolExpr, path []string) error {
+	if b.Ref != "" {
+		cond, ok := conditions[b.Ref]
+		if !ok {
+			return fmt.Errorf("unknown condition %q", b.Ref)
+		}
+		if slices.Contains(path, b.Ref) {
+			return fmt.Errorf("condition cycle: %s -> %s", strings.Join(path, " -> "), b.Ref)
+		}
+		if err := cond.resolveRefs(conditions, slices.Concat(path, []string{b.Ref})); err != nil {
+			return err
+		}
+		b.ref = cond
+	}
+	for i := range b.And {
+		if err := b.And[i].resolveRefs(conditions, path); err != nil {
+			return err
+		}
+	}
+	for i := range b.Or {
+		if err := b.Or[i].resolveRefs(conditions, path); err != nil {
+			return err
+		}
+	}
+	if b.Request != nil {
+		if err := b.Request.resolveRefs(conditions, path); err != nil {
+			return err
+		}
+	}
+	if b.Not != nil {
+		return b.Not.resolveRefs(conditions, path)
+	}
+	return nil
+}
+
+// matchesStatus reports whether the tree, or a condition it refers to, has a status matcher
+func (b *BoolExpr) matchesStatus() bool {
+	return b.anyNode(func(node *BoolExpr) bool { return node.Status.Len() > 0 })
+}
+
+// matchesRequest reports whether the tree, or a condition it refers to, matches the request
+func (b *BoolExpr) matchesRequest() bool {
+	return b.anyNode(func(node *BoolExpr) bool { return node.Request != nil })
+}
+
+// matchesState reports whether the tree, or a condition it refers to, matches stored state
+func (b *BoolExpr) matchesState() bool {
+	return b.anyNode(func(node *BoolExpr) bool { return len(node.State) > 0 })
+}
+
+// anyNode reports whether fn holds for a node of the tree or of a condition it refers to.
+// It doesn't descend into request expressions.
+func (b *BoolExpr) anyNode(fn func(node *BoolExpr) bool) bool {
+	if fn(b) || (b.ref != nil && b.ref.anyNode(fn)) {
+		return true
+	}
+	for i := range b.And {
+		if b.And[i].anyNode(fn) {
+			return true
+		}
+	}
+	for i := range b.Or {
+		if b.Or[i].anyNode(fn) {
+			return true
+		}
+	}
+	return b.Not != nil && b.Not.anyNode(fn)
+}
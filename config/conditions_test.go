@@ -0,0 +1,135 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const conditionsConfig = `
+conditions:
+  streaming: { body: { stream: "true" } }
+  qwen: { body: { model: "^qwen" } }
+  streaming_qwen:
+    and:
+      - ref: streaming
+      - ref: qwen
+
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      on_request:
+        - when: { ref: streaming_qwen }
+          merge: { stream_options: { include_usage: true } }
+        - when:
+            ref: qwen
+            body: { temperature: ".*" }
+          merge: { tuned: true }
+        - when:
+            not: { ref: streaming }
+          merge: { buffered: true }
+`
+
+func TestConditionRefs(t *testing.T) {
+	cfg := mustParseConfig(t, conditionsConfig)
+	route := cfg.Proxies[0].Routes[0]
+
+	tests := []struct {
+		name string
+		data map[string]any
+		want []string
+		skip []string
+	}{
+		{
+			name: "nested refs all match",
+			data: map[string]any{"model": "qwen3", "stream": true},
+			want: []string{"stream_options"},
+			skip: []string{"tuned", "buffered"},
+		},
+		{
+			name: "ref alongside leaf matchers",
+			data: map[string]any{"model": "qwen3", "temperature": 0.7},
+			want: []string{"tuned", "buffered"},
+			skip: []string{"stream_options"},
+		},
+		{
+			name: "ref that doesn't match",
+			data: map[string]any{"model": "llama3", "stream": true, "temperature": 0.7},
+			skip: []string{"stream_options", "tuned", "buffered"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ProcessRequest(tt.data, nil, nil, route.Compiled, 0, "POST", "/v1/chat")
+			for _, key := range tt.want {
+				if _, ok := tt.data[key]; !ok {
+					t.Errorf("data = %v, want %s set", tt.data, key)
+				}
+			}
+			for _, key := range tt.skip {
+				if _, ok := tt.data[key]; ok {
+					t.Errorf("data = %v, want %s unset", tt.data, key)
+				}
+			}
+		})
+	}
+}
+
+func TestConditionRefValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions string
+		when       string
+		errMsg     string
+	}{
+		{
+			name:       "unknown ref in an action",
+			conditions: `streaming: { body: { stream: "true" } }`,
+			when:       `{ ref: streamed }`,
+			errMsg:     `route 0 on_request 0 when: unknown condition "streamed"`,
+		},
+		{
+			name:       "unknown ref in a condition",
+			conditions: `streaming: { ref: stream }`,
+			when:       `{ ref: streaming }`,
+			errMsg:     `conditions.streaming: unknown condition "stream"`,
+		},
+		{
+			name:       "cycle",
+			conditions: "a: { ref: b }\n  b: { not: { ref: a } }",
+			when:       `{ ref: a }`,
+			errMsg:     "condition cycle: a -> b -> a",
+		},
+		{
+			name:       "invalid pattern",
+			conditions: `bad: { body: { model: "[" } }`,
+			when:       `{ ref: bad }`,
+			errMsg:     "conditions.bad: invalid body pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig(t, `
+conditions:
+  `+tt.conditions+`
+
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      on_request:
+        - when: `+tt.when+`
+          merge: { ok: true }
+`)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("err = %v, want %q", err, tt.errMsg)
+			}
+		})
+	}
+}
@@ -2,28 +2,145 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/schema"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the full proxy configuration
 type Config struct {
-	Proxies ProxyEntries `yaml:"proxy"`
+	Proxies  ProxyEntries              `yaml:"proxy"`
+	Admin    AdminConfig               `yaml:"admin,omitempty"`
+	Logging  LoggingConfig             `yaml:"logging,omitempty"`
+	Memory   *MemoryConfig             `yaml:"memory,omitempty"`   // Shed large requests under memory pressure
+	Patterns PatternsConfig            `yaml:"patterns,omitempty"` // Stricter checks on route methods and paths
+	Presets  map[string]map[string]any `yaml:"presets,omitempty"`  // Named param bundles for apply_preset
+
+	Conditions map[string]*BoolExpr `yaml:"conditions,omitempty"` // Named when expressions, used with when: {ref: name}
+	Reload     *ReloadGuard         `yaml:"reload,omitempty"`     // Refuse hot reloads that change too much at once
+	Audit      *AuditConfig         `yaml:"audit,omitempty"`      // Tamper-evident request trail, separate from logs
+}
+
+// AuditConfig appends one hash-chained JSON line per request, across every proxy, recording
+// who sent it, what it asked for, and when, with body hashes instead of contents
+type AuditConfig struct {
+	File string `yaml:"file"` // Append-only JSONL file, resolved relative to the config file
+}
+
+// MemoryConfig caps the memory held by buffered bodies and active streams, across every
+// proxy, so the proxy doesn't exhaust a host it shares with the model server
+type MemoryConfig struct {
+	Limit     int64 `yaml:"limit"`                // Bytes in use above which large requests are answered 503
+	LargeBody int64 `yaml:"large_body,omitempty"` // Smallest request body shed; defaults to 64KB. Unknown lengths count as large.
+}
+
+// DefaultLargeBody is the smallest request body shed when memory.large_body is unset
+const DefaultLargeBody = 64 * 1024
+
+// Validate normalizes defaults
+func (m *MemoryConfig) Validate() error {
+	if m.Limit <= 0 {
+		return fmt.Errorf("limit must be positive")
+	}
+	if m.LargeBody < 0 {
+		return fmt.Errorf("large_body must not be negative")
+	}
+	if m.LargeBody == 0 {
+		m.LargeBody = DefaultLargeBody
+	}
+	return nil
+}
+
+// PatternsConfig tightens the checks on route methods and paths at load time
+type PatternsConfig struct {
+	MaxLength      int  `yaml:"max_length,omitempty"`      // Longest method or path pattern accepted; defaults to 1024
+	RequireAnchors bool `yaml:"require_anchors,omitempty"` // Paths must start with ^ and end with $ or /
+}
+
+// DefaultMaxPatternLength is the longest method or path pattern accepted when
+// patterns.max_length is unset
+const DefaultMaxPatternLength = 1024
+
+// LoggingConfig selects where logs go and thins info logs for high-volume traffic.
+// Errors are always logged.
+type LoggingConfig struct {
+	Output       string        `yaml:"output,omitempty"`        // stdout (default), stderr, syslog, or journald
+	Syslog       string        `yaml:"syslog,omitempty"`        // Remote syslog address (ex: udp://logs:514); defaults to the local daemon
+	Tag          string        `yaml:"tag,omitempty"`           // syslog and journald identifier; defaults to llama-matchmaker
+	Sample       int           `yaml:"sample,omitempty"`        // Log 1 in N request lines; error replies are always logged
+	RepeatLimit  int           `yaml:"repeat_limit,omitempty"`  // Identical messages logged per repeat_window, then suppressed
+	RepeatWindow time.Duration `yaml:"repeat_window,omitempty"` // Defaults to 1m
+}
+
+// Log outputs
+const (
+	LogStdout   = "stdout"
+	LogStderr   = "stderr"
+	LogSyslog   = "syslog"
+	LogJournald = "journald"
+)
+
+// AdminConfig configures the optional operator listener (metrics, usage, health)
+type AdminConfig struct {
+	Listen    string           `yaml:"listen,omitempty"`
+	UsageFile string           `yaml:"usage_file,omitempty"` // Persist usage aggregates across restarts
+	Dashboard *DashboardConfig `yaml:"dashboard,omitempty"`  // Live traffic UI at /admin/dashboard
+	Pprof     bool             `yaml:"pprof,omitempty"`      // Serve net/http/pprof profiles under /debug/pprof/
+}
+
+// DashboardConfig keeps recent requests in memory for the admin dashboard
+type DashboardConfig struct {
+	Requests     int `yaml:"requests,omitempty"`       // Requests kept; defaults to 200
+	MaxBodyBytes int `yaml:"max_body_bytes,omitempty"` // Bytes kept of each body; defaults to 64KB
+}
+
+// Validate normalizes defaults
+func (d *DashboardConfig) Validate() error {
+	if d.Requests < 0 || d.MaxBodyBytes < 0 {
+		return fmt.Errorf("requests and max_body_bytes must not be negative")
+	}
+	if d.Requests == 0 {
+		d.Requests = 200
+	}
+	if d.MaxBodyBytes == 0 {
+		d.MaxBodyBytes = 64 * 1024
+	}
+	return nil
 }
 
 type watchList struct {
 	paths []string
 	seen  map[string]struct{}
+
+	// sources maps mapping nodes loaded by include to their file, for route origins
+	sources map[*yaml.Node]string
 }
 
 func newWatchList() *watchList {
-	return &watchList{paths: make([]string, 0), seen: make(map[string]struct{})}
+	return &watchList{paths: make([]string, 0), seen: make(map[string]struct{}), sources: make(map[*yaml.Node]string)}
+}
+
+// markSource records path as the origin of every mapping node under node not already
+// claimed by a nested include
+func (w *watchList) markSource(node *yaml.Node, path string) {
+	if node.Kind == yaml.MappingNode {
+		if _, ok := w.sources[node]; !ok {
+			w.sources[node] = path
+		}
+	}
+	for _, child := range node.Content {
+		w.markSource(child, path)
+	}
 }
 
 func (w *watchList) Add(path string) {
@@ -45,11 +162,359 @@ func (w *watchList) Paths() []string {
 type ProxyConfig struct {
 	Listen  string        `yaml:"listen"`
 	Target  string        `yaml:"target"`
+	Targets []string      `yaml:"targets,omitempty"` // Additional backends, balanced round-robin
 	Timeout time.Duration `yaml:"timeout"`
 	SSLCert string        `yaml:"ssl_cert"`
 	SSLKey  string        `yaml:"ssl_key"`
 	Debug   bool          `yaml:"debug"`
+	Models  ModelsConfig  `yaml:"models,omitempty"`
 	Routes  []Route       `yaml:"routes"`
+
+	Session  *SessionConfig  `yaml:"session,omitempty"`  // Where requests carry a conversation ID, for logs, metrics, and affinity
+	Affinity *AffinityConfig `yaml:"affinity,omitempty"` // Pin conversations to one target
+	Slots    *SlotsConfig    `yaml:"slots,omitempty"`    // Schedule by llama.cpp slot availability
+
+	DNSRefresh time.Duration `yaml:"dns_refresh,omitempty"` // Re-resolve target hostnames when their records' TTL expires, at most this far apart, dialing the address family that last connected first; 0 resolves on each new connection
+
+	OutboundProxy *OutboundProxy `yaml:"outbound_proxy,omitempty"` // Reach targets through an HTTP or SOCKS5 proxy, except no_proxy hosts
+
+	UpstreamTLSMinVersion string   `yaml:"upstream_tls_min_version,omitempty"` // tls_min_version for https:// targets
+	UpstreamTLSCiphers    []string `yaml:"upstream_tls_ciphers,omitempty"`     // tls_ciphers for https:// targets
+	UpstreamTLSCurves     []string `yaml:"upstream_tls_curves,omitempty"`      // tls_curves for https:// targets
+
+	UpstreamIdleTimeout time.Duration `yaml:"upstream_idle_timeout,omitempty"` // Close pooled backend connections idle this long; defaults to 4s, under llama.cpp's 5s keep-alive
+	UpstreamKeepAlive   time.Duration `yaml:"upstream_keepalive,omitempty"`    // TCP keep-alive probe interval on backend connections; defaults to 15s
+
+	MaxRequestBytes int64 `yaml:"max_request_bytes,omitempty"` // Larger bodies are answered 413; defaults to 10MB
+	BufferThreshold int64 `yaml:"buffer_threshold,omitempty"`  // Larger bodies stream to the backend without request transforms; 0 buffers up to max_request_bytes
+
+	HealthEndpoints bool `yaml:"health_endpoints,omitempty"` // Answer /healthz and /readyz here instead of forwarding them
+
+	PlainHTTP string `yaml:"plain_http,omitempty"` // With ssl_cert: how plain HTTP sent to the TLS port is answered (see PlainHTTPRedirect)
+
+	RedirectHTTP *HTTPRedirect `yaml:"redirect_http,omitempty"` // Companion plain-HTTP listener redirecting to this TLS proxy
+
+	SSLCerts []SSLCertPair `yaml:"ssl_certs,omitempty"` // More cert/key pairs, served to clients whose SNI hostname they cover; ssl_cert is the default
+
+	TLSMinVersion string   `yaml:"tls_min_version,omitempty"` // Oldest TLS version clients may use (1.0 to 1.3); Go's default is 1.2
+	TLSCiphers    []string `yaml:"tls_ciphers,omitempty"`     // Cipher suites offered to TLS 1.2 clients, by Go name
+	TLSCurves     []string `yaml:"tls_curves,omitempty"`      // Key exchange groups, in preference order (ex: X25519, P-256)
+
+	SSLClientCA       string `yaml:"ssl_client_ca,omitempty"`       // With ssl_cert: PEM CAs that client certificates are verified against
+	RequireClientCert bool   `yaml:"require_client_cert,omitempty"` // Refuse TLS connections without a client certificate signed by ssl_client_ca
+
+	NormalizePaths *PathNormalization `yaml:"normalize_paths,omitempty"` // Clean up paths before routes match them
+
+	MethodOverride bool `yaml:"method_override,omitempty"` // Route and forward POSTs by their X-HTTP-Method-Override header
+
+	CompressResponses bool `yaml:"compress_responses,omitempty"` // Gzip non-streaming replies of 1KB or more for clients that accept it
+
+	ForwardTrailers PatternField `yaml:"forward_trailers,omitempty"` // Trailers (ex: ^X-) also copied into the headers of non-streaming replies
+
+	DeadlineHeader string `yaml:"deadline_header,omitempty"` // Header (ex: X-Request-Deadline) carrying the client's deadline in and the earliest deadline upstream
+
+	LogRedact LogRedact `yaml:"log_redact,omitempty"` // Body fields hidden from debug logs (ex: messages[*].content)
+
+	PreserveKeyOrder bool `yaml:"preserve_key_order,omitempty"` // Edited bodies keep the sender's key order; new keys go last, sorted
+
+	StreamWorkers int `yaml:"stream_workers,omitempty"` // Streams transformed at once; more wait for a free worker. 0 means no limit.
+
+	TraceDir string `yaml:"trace_dir,omitempty"` // Where trace files go; defaults to traces/ beside the config
+	TraceAll bool   `yaml:"-"`                   // Trace every request (-trace)
+
+	Conformance *ConformanceConfig `yaml:"conformance,omitempty"` // Check replies against an OpenAPI spec
+
+	ErrorResponse *ErrorResponse `yaml:"error_response,omitempty"` // Reply sent when the upstream can't be reached
+	Retry         *RetryPolicy   `yaml:"retry,omitempty"`          // Resend GET/HEAD requests after transport errors
+
+	Warmup *WarmupConfig `yaml:"warmup,omitempty"` // Requests sent through the routes at startup and on an interval
+
+	Keys []APIKey `yaml:"keys,omitempty"` // Model and route allowlists per API key
+
+	ExtraListen []string `yaml:"-"` // Addresses after the first in a listen list, serving the same routes
+}
+
+// HTTPRedirect is a plain-HTTP listener beside a TLS proxy that answers every request with a
+// 301 to the same URL over HTTPS, except ACME HTTP-01 challenges, which it serves so
+// certificates can be issued and renewed without another web server
+type HTTPRedirect struct {
+	Listen  string `yaml:"listen"`             // ex: :80
+	ACMEDir string `yaml:"acme_dir,omitempty"` // Webroot passed to certbot --webroot -w or lego --http.webroot; challenges are read from its .well-known/acme-challenge/
+}
+
+// Validate checks the listen address
+func (r *HTTPRedirect) Validate() error {
+	if r.Listen == "" {
+		return fmt.Errorf("listen is required")
+	}
+	if strings.HasPrefix(r.Listen, UnixListenPrefix) {
+		return fmt.Errorf("listen must be a TCP address")
+	}
+	return nil
+}
+
+// SSLCertPair is a certificate and its key, for serving several hostnames on one listener
+type SSLCertPair struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+// RetryPolicy resends requests that fail with a transport error (connection refused, reset,
+// or closed before a response) as when a backend restarts. GET and HEAD requests are
+// retried, plus requests matching routes with retry: true.
+type RetryPolicy struct {
+	Attempts int           `yaml:"attempts,omitempty"` // Resends after the first try; defaults to 2
+	Backoff  time.Duration `yaml:"backoff,omitempty"`  // Wait before the first resend, doubled for each next one; defaults to 250ms
+}
+
+// RetryPolicy defaults
+const (
+	DefaultRetryAttempts = 2
+	DefaultRetryBackoff  = 250 * time.Millisecond
+)
+
+// Validate normalizes defaults
+func (r *RetryPolicy) Validate() error {
+	if r.Attempts < 0 || r.Backoff < 0 {
+		return fmt.Errorf("attempts and backoff cannot be negative")
+	}
+	if r.Attempts == 0 {
+		r.Attempts = DefaultRetryAttempts
+	}
+	if r.Backoff == 0 {
+		r.Backoff = DefaultRetryBackoff
+	}
+	return nil
+}
+
+// ConformanceConfig checks non-streaming JSON replies against the response schemas of an
+// OpenAPI spec and logs and counts deviations, to catch backend incompatibilities.
+// Replies are never changed.
+type ConformanceConfig struct {
+	OpenAPI  string `yaml:"openapi"`             // Spec file (YAML or JSON), relative to the config file
+	BasePath string `yaml:"base_path,omitempty"` // Prefix before the spec's paths; defaults to the first server URL's path
+
+	Spec *schema.OpenAPI `yaml:"-"` // Loaded by Validate
+}
+
+// Validate loads the spec
+func (c *ConformanceConfig) Validate() error {
+	if c.OpenAPI == "" {
+		return fmt.Errorf("openapi spec file is required")
+	}
+	spec, err := schema.LoadOpenAPI(c.OpenAPI, c.BasePath)
+	if err != nil {
+		return fmt.Errorf("openapi: %w", err)
+	}
+	c.Spec = spec
+	return nil
+}
+
+// DefaultTraceDir holds trace files when trace_dir is unset, relative to the config file
+const DefaultTraceDir = "traces"
+
+// DefaultMaxRequestBytes caps request bodies when max_request_bytes is unset
+const DefaultMaxRequestBytes = 10 * 1024 * 1024
+
+// RequestLimit returns the largest request body the proxy reads
+func (p ProxyConfig) RequestLimit() int64 {
+	if p.MaxRequestBytes > 0 {
+		return p.MaxRequestBytes
+	}
+	return DefaultMaxRequestBytes
+}
+
+// Backend connection pool defaults
+const (
+	DefaultUpstreamIdleTimeout = 4 * time.Second
+	DefaultUpstreamKeepAlive   = 15 * time.Second
+)
+
+// IdleConnTimeout returns how long a pooled backend connection may sit idle. It is kept
+// under the backend's own keep-alive, so a connection the backend is about to close isn't
+// handed to a request.
+func (p ProxyConfig) IdleConnTimeout() time.Duration {
+	if p.UpstreamIdleTimeout > 0 {
+		return p.UpstreamIdleTimeout
+	}
+	return DefaultUpstreamIdleTimeout
+}
+
+// KeepAliveInterval returns the TCP keep-alive probe interval on backend connections, which
+// finds connections dropped without a close (ex: by a NAT or a crashed host)
+func (p ProxyConfig) KeepAliveInterval() time.Duration {
+	if p.UpstreamKeepAlive > 0 {
+		return p.UpstreamKeepAlive
+	}
+	return DefaultUpstreamKeepAlive
+}
+
+// plain_http modes: plain HTTP reaching a TLS listener is redirected to https://, refused
+// with a 400 naming the https:// URL, or served as is (HTTP/1 and h2c)
+const (
+	PlainHTTPRedirect = "redirect"
+	PlainHTTPError    = "error"
+	PlainHTTPServe    = "serve"
+)
+
+// UnixListenPrefix marks a listen address as a Unix socket path (ex: unix:/run/proxy.sock)
+const UnixListenPrefix = "unix:"
+
+// Listeners returns every address the proxy binds: Listen, then the rest of a listen list
+func (p ProxyConfig) Listeners() []string {
+	return append([]string{p.Listen}, p.ExtraListen...)
+}
+
+// UnmarshalYAML accepts listen as one address or a list of them
+func (p *ProxyConfig) UnmarshalYAML(value *yaml.Node) error {
+	type plain ProxyConfig
+	listen := mappingValue(value, "listen")
+	if listen == nil || listen.Kind != yaml.SequenceNode {
+		return value.Decode((*plain)(p))
+	}
+	var addrs []string
+	if err := listen.Decode(&addrs); err != nil {
+		return err
+	}
+	first := ""
+	if len(addrs) > 0 {
+		first = addrs[0]
+	}
+
+	// Decode a copy with the first address as listen, keeping the loaded node intact
+	node := *value
+	node.Content = slices.Clone(value.Content)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "listen" {
+			node.Content[i+1] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: first}
+		}
+	}
+	if err := node.Decode((*plain)(p)); err != nil {
+		return err
+	}
+	if len(addrs) > 1 {
+		p.ExtraListen = addrs[1:]
+	}
+	return nil
+}
+
+// AllTargets returns the primary target followed by any additional targets, without duplicates
+func (p ProxyConfig) AllTargets() []string {
+	targets := make([]string, 0, 1+len(p.Targets))
+	seen := make(map[string]struct{}, 1+len(p.Targets))
+	for _, t := range append([]string{p.Target}, p.Targets...) {
+		if t == "" {
+			continue
+		}
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// AffinityConfig sends every turn of a conversation to the same target, so llama.cpp can
+// reuse its prompt cache. Keys are tried in order: header, body, then messages; requests
+// without any are balanced round-robin.
+type AffinityConfig struct {
+	Header   string `yaml:"header,omitempty"`   // Request header holding a session key
+	Body     string `yaml:"body,omitempty"`     // Body field holding a session key (ex: user)
+	Messages int    `yaml:"messages,omitempty"` // Hash the first N chat messages
+}
+
+// Slot scheduling defaults
+const (
+	DefaultSlotsInterval     = 2 * time.Second
+	DefaultSlotsQueueTimeout = 30 * time.Second
+)
+
+// SlotsConfig polls each target's llama.cpp /health and /slots endpoints and sends POST
+// requests to the target with the most free slots, queueing them while every slot is busy
+type SlotsConfig struct {
+	Interval     time.Duration `yaml:"interval,omitempty"`      // Poll period; defaults to 2s
+	QueueTimeout time.Duration `yaml:"queue_timeout,omitempty"` // Longest wait for a free slot before 503; defaults to 30s
+	MaxQueue     int           `yaml:"max_queue,omitempty"`     // Requests allowed to wait; 0 means no limit
+
+	BatchKeys  PatternField `yaml:"batch_keys,omitempty"`  // API keys (bearer tokens) whose requests are batch priority
+	BatchShare float64      `yaml:"batch_share,omitempty"` // Most of the reported slots batch requests may hold; 0 means no bound
+}
+
+// Request priorities for the slot queue: waiting interactive requests get free slots first
+const (
+	PriorityInteractive = "interactive"
+	PriorityBatch       = "batch"
+)
+
+// ModelsConfig controls how a proxy presents its model catalog
+type ModelsConfig struct {
+	Aggregate bool              `yaml:"aggregate,omitempty"` // Serve /v1/models by merging every target's list
+	Aliases   map[string]string `yaml:"aliases,omitempty"`   // Published name -> backend model name
+	Allow     PatternField      `yaml:"allow,omitempty"`     // Published names clients may see; empty allows all
+	Vision    PatternField      `yaml:"vision,omitempty"`    // Backend models that accept images; empty assumes all do
+
+	ContextWindows map[string]int `yaml:"context_windows,omitempty"` // Backend model name -> context window in tokens
+
+	Pricing    map[string]Price `yaml:"pricing,omitempty"`     // Backend model name -> price per 1K tokens
+	CostHeader string           `yaml:"cost_header,omitempty"` // Response header carrying the request cost (non-streaming only)
+}
+
+// Price is the cost per 1K prompt and completion tokens
+type Price struct {
+	Prompt     float64 `yaml:"prompt"`
+	Completion float64 `yaml:"completion"`
+}
+
+// Cost returns the price of a request to a backend model, if the model is priced
+func (m ModelsConfig) Cost(model string, promptTokens, completionTokens int) (float64, bool) {
+	price, ok := m.Pricing[model]
+	if !ok {
+		return 0, false
+	}
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1000, true
+}
+
+// ContextWindow returns the configured context window for a backend model
+func (m ModelsConfig) ContextWindow(model string) (int, bool) {
+	window, ok := m.ContextWindows[model]
+	return window, ok && window > 0
+}
+
+// AcceptsImages reports whether a backend model can be sent image inputs
+func (m ModelsConfig) AcceptsImages(model string) bool {
+	return m.Vision.Len() == 0 || m.Vision.Matches(model)
+}
+
+// Allowed reports whether a published model name passes the allow list
+func (m ModelsConfig) Allowed(name string) bool {
+	return m.Allow.Len() == 0 || m.Allow.Matches(name)
+}
+
+// RewritesLists reports whether model list responses need filtering or renaming
+func (m ModelsConfig) RewritesLists() bool {
+	return m.Allow.Len() > 0 || len(m.Aliases) > 0
+}
+
+// ResolveAlias returns the backend model name for a published name
+func (m ModelsConfig) ResolveAlias(name string) (string, bool) {
+	backend, ok := m.Aliases[name]
+	return backend, ok
+}
+
+// PublishedNames returns the published names for a backend model, or the name itself when unaliased
+func (m ModelsConfig) PublishedNames(backend string) []string {
+	var names []string
+	for alias, target := range m.Aliases {
+		if target == backend {
+			names = append(names, alias)
+		}
+	}
+	if len(names) == 0 {
+		return []string{backend}
+	}
+	sort.Strings(names)
+	return names
 }
 
 // ProxyEntries allows proxy to be defined as a single map or a list
@@ -87,19 +552,182 @@ type CliOverrides struct {
 	SSLCert string
 	SSLKey  string
 	Debug   bool
+	Trace   string // Trace every request on every proxy into this directory
 }
 
 // Route defines matching criteria and operations with compiled templates
 type Route struct {
+	Name       string       `yaml:"name,omitempty"` // Optional label, shown by the routes command
 	Methods    PatternField `yaml:"methods"`
 	Paths      PatternField `yaml:"paths"`
-	TargetPath string       `yaml:"target_path"`
+	TargetPath string       `yaml:"target_path"`      // Backend path; may be a template over .captures, .query, and .body
+	Format     string       `yaml:"format,omitempty"` // Built-in translation profile (ex: openai-to-ollama)
+
+	ContentTypes PatternField `yaml:"content_types,omitempty"` // Match only requests whose Content-Type (or Accept, without one) matches
+
+	Context *ContextPolicy `yaml:"context,omitempty"` // Enforce the model's context window
+	Images  *ImagePolicy   `yaml:"images,omitempty"`  // Limit image inputs in chat messages
+	Files   *FilePolicy    `yaml:"files,omitempty"`   // Limit file uploads in multipart requests
+
+	Embeddings *EmbeddingsPolicy `yaml:"embeddings,omitempty"` // Split large embedding batches across upstream calls
+	Prompt     *PromptConfig     `yaml:"prompt,omitempty"`     // Render chat messages into a raw /completion prompt
+	Choices    *ChoicesPolicy    `yaml:"choices,omitempty"`    // Emulate n > 1 with parallel single-choice requests
+
+	StructuredOutput *StructuredOutputPolicy `yaml:"structured_output,omitempty"` // Adapt response_format for the backend
+	Reasoning        *ReasoningPolicy        `yaml:"reasoning,omitempty"`         // Normalize or strip chain-of-thought in replies
+	Moderation       *ModerationPolicy       `yaml:"moderation,omitempty"`        // Check replies with patterns or a classifier
 
 	OnRequest  []Action `yaml:"on_request,omitempty"`
 	OnResponse []Action `yaml:"on_response,omitempty"`
 
+	Funcs []string     `yaml:"funcs,omitempty"` // Registered plugin template funcs this route's templates may call
+	State *StateConfig `yaml:"state,omitempty"` // Key-value store for this route's templates and when expressions
+	Trace bool         `yaml:"trace,omitempty"` // Write a trace file for each matching request (see trace_dir)
+	Retry bool         `yaml:"retry,omitempty"` // Resend after transport errors whatever the method (see the proxy's retry)
+
+	Priority string `yaml:"priority,omitempty"` // interactive or batch, for the slot queue; overrides slots.batch_keys
+
+	ResponseTimeout  time.Duration `yaml:"response_timeout,omitempty"`   // Longest wait for a whole non-streaming reply
+	FirstByteTimeout time.Duration `yaml:"first_byte_timeout,omitempty"` // Longest wait for the reply to start, as while the backend processes the prompt
+	IdleChunkTimeout time.Duration `yaml:"idle_chunk_timeout,omitempty"` // Longest gap between chunks of a streamed reply before it is cut
+
+	Options *OptionsReply `yaml:"options,omitempty"` // Answer OPTIONS requests to the route's paths locally, whatever its methods
+
 	// Compiled templates (not serialized)
 	Compiled *CompiledRoute `yaml:"-"`
+
+	// Source is the config or include file the route was defined in
+	Source string `yaml:"-"`
+}
+
+// NeedsBody reports whether the route reads or edits request bodies: request actions,
+// body policies, translation, tracing, retries that replay the body, response actions
+// using the request, or a response_timeout that must tell streaming requests apart
+func (r *Route) NeedsBody() bool {
+	return len(r.OnRequest) > 0 || r.Format != "" || r.Context != nil || r.Images != nil ||
+		r.Files != nil || r.Embeddings != nil || r.Prompt != nil || r.Choices != nil ||
+		r.StructuredOutput != nil || r.Trace || r.Retry || r.TargetPathTemplated() || r.UsesRequest() ||
+		r.ResponseTimeout > 0
+}
+
+// HasTimeouts reports whether the route limits how long its replies may take
+func (r *Route) HasTimeouts() bool {
+	return r.ResponseTimeout > 0 || r.FirstByteTimeout > 0 || r.IdleChunkTimeout > 0
+}
+
+// Context overflow strategies
+const (
+	OverflowTruncate = "truncate" // Drop oldest non-system messages until the prompt fits
+	OverflowReject   = "reject"   // Answer 400 without contacting the backend
+	OverflowStrip    = "strip"    // Remove offending images and send the rest
+)
+
+// MaxTokensAuto derives max_tokens from the room left in the context window
+const MaxTokensAuto = "auto"
+
+// RetryMaxTokens retries a context overflow with a smaller output limit
+const RetryMaxTokens = "max_tokens"
+
+// ContextPolicy controls what happens when a prompt exceeds the model's context window
+type ContextPolicy struct {
+	Overflow  string `yaml:"overflow,omitempty"`   // truncate (default) or reject
+	MaxTokens string `yaml:"max_tokens,omitempty"` // auto: cap max_tokens to window - prompt - margin
+	Margin    int    `yaml:"margin,omitempty"`     // Tokens held back for estimation error
+	Retry     string `yaml:"retry,omitempty"`      // Resend once after a backend overflow error: truncate or max_tokens
+}
+
+// ImagePolicy limits image parts (OpenAI image_url, Ollama images) in chat requests.
+// Images sent to models outside models.vision are handled the same way as oversized ones.
+type ImagePolicy struct {
+	Overflow     string `yaml:"overflow,omitempty"`      // strip (default) or reject
+	MaxBytes     int    `yaml:"max_bytes,omitempty"`     // Largest decoded image accepted
+	MaxCount     int    `yaml:"max_count,omitempty"`     // Most images per request; stripping keeps the latest
+	MaxDimension int    `yaml:"max_dimension,omitempty"` // Downscale inline images whose longest side is larger
+}
+
+// FilePolicy limits file parts in multipart form requests (ex: /v1/audio/transcriptions)
+type FilePolicy struct {
+	MaxBytes int64 `yaml:"max_bytes"` // Largest file accepted; larger uploads get 413
+}
+
+// EmbeddingsPolicy splits embedding requests whose input array exceeds the backend's batch limit
+type EmbeddingsPolicy struct {
+	BatchSize int `yaml:"batch_size"` // Most inputs per upstream call
+}
+
+// ChoicesPolicy fans out requests for n > 1 completions as n upstream requests and merges
+// the replies, for backends that ignore n
+type ChoicesPolicy struct {
+	Max         int `yaml:"max,omitempty"`         // Largest n accepted; larger requests get 400
+	Concurrency int `yaml:"concurrency,omitempty"` // Upstream requests in flight at once
+}
+
+// ChoicesPolicy defaults
+const (
+	DefaultChoicesMax         = 8
+	DefaultChoicesConcurrency = 4
+)
+
+// Structured output modes
+const (
+	StructuredLlamaCpp = "llama.cpp" // Top-level json_schema
+	StructuredOllama   = "ollama"    // format: <schema> or "json"
+	StructuredStrip    = "strip"     // Drop response_format for backends that reject it
+)
+
+// StructuredOutputPolicy rewrites OpenAI response_format for backends with their own
+// structured output parameter, and can check replies against the requested schema
+type StructuredOutputPolicy struct {
+	Mode     string `yaml:"mode,omitempty"`     // llama.cpp, ollama, or strip; empty leaves response_format as is
+	Validate bool   `yaml:"validate,omitempty"` // Answer 502 when a non-streaming reply doesn't match the schema
+}
+
+// Reasoning modes
+const (
+	ReasoningField = "field" // Move reasoning into one field
+	ReasoningStrip = "strip" // Remove reasoning from replies
+)
+
+// DefaultReasoningField is where reasoning lands when the policy names no field
+const DefaultReasoningField = "reasoning_content"
+
+// ReasoningPolicy normalizes the reasoning backends return as reasoning_content, reasoning,
+// thinking, or inline <think> tags, in OpenAI and Ollama replies and streams
+type ReasoningPolicy struct {
+	Mode  string `yaml:"mode,omitempty"`  // field (default) or strip
+	Field string `yaml:"field,omitempty"` // Target field for mode field; defaults to reasoning_content
+}
+
+// Moderation actions
+const (
+	ModerationBlock    = "block"    // Replace the reply with an error
+	ModerationRedact   = "redact"   // Replace flagged text
+	ModerationAnnotate = "annotate" // Add the verdict to the reply
+)
+
+// DefaultModerationTimeout bounds classifier calls when the policy sets no timeout
+const DefaultModerationTimeout = 10 * time.Second
+
+// ModerationPolicy checks generated text against regexes and/or a classifier with an
+// OpenAI /v1/moderations style API. Streams are checked as they accumulate; classifier
+// verdicts on streams arrive with the final chunk, after the text was sent.
+type ModerationPolicy struct {
+	Action     string            `yaml:"action,omitempty"`      // block (default), redact, or annotate
+	Patterns   PatternField      `yaml:"patterns,omitempty"`    // Regexes that flag a reply
+	Endpoint   string            `yaml:"endpoint,omitempty"`    // Classifier URL, sent {"input": text}
+	Model      string            `yaml:"model,omitempty"`       // Classifier model, if it needs one
+	Headers    map[string]string `yaml:"headers,omitempty"`     // Extra classifier headers (ex: Authorization)
+	Timeout    time.Duration     `yaml:"timeout,omitempty"`     // Classifier timeout; defaults to 10s
+	FailClosed bool              `yaml:"fail_closed,omitempty"` // Treat classifier errors as flagged
+}
+
+// PromptConfig renders chat requests with a chat template and sends them to llama.cpp's
+// /completion endpoint, for models without a built-in chat template. Templates are a
+// built-in name (chatml, llama3, mistral, gemma) or Go template text over .Messages.
+type PromptConfig struct {
+	Template string            `yaml:"template,omitempty"` // Default template; models without one pass through as chat
+	Models   map[string]string `yaml:"models,omitempty"`   // Backend model name -> template
+	Stop     []string          `yaml:"stop,omitempty"`     // Extra stop strings
 }
 
 // Action defines a transformation to apply
@@ -113,7 +741,43 @@ type Action struct {
 	Merge    map[string]any `yaml:"merge,omitempty"`
 	Default  map[string]any `yaml:"default,omitempty"`
 	Delete   []string       `yaml:"delete,omitempty"`
-	Stop     bool           `yaml:"stop,omitempty"`
+	ParamMap ParamMap       `yaml:"param_map,omitempty"` // Move params between dialects (see params.go)
+
+	ApplyPreset   *PresetSelector `yaml:"apply_preset,omitempty"`    // Apply a named preset from presets
+	NormalizeStop *StopNormalizer `yaml:"normalize_stop,omitempty"`  // Rewrite stop strings into one field and shape
+	Redact        *RedactPolicy   `yaml:"redact,omitempty"`          // Replace sensitive prompt text with placeholders
+	Seed          *SeedPolicy     `yaml:"seed,omitempty"`            // Inject a seed when absent
+	Schema        *SchemaCheck    `yaml:"validate_schema,omitempty"` // Check the body against a JSON Schema file
+	Stop          bool            `yaml:"stop,omitempty"`
+
+	// Actions groups actions under this action's when, evaluated once before any of them run
+	Actions []Action `yaml:"actions,omitempty"`
+
+	// FromRequest sets reply fields (dotted for nested) from the client's request:
+	// body.<field>, headers.<name>, or query.<name>. on_response only.
+	FromRequest map[string]string `yaml:"from_request,omitempty"`
+
+	// Else runs instead when the when doesn't match: one action, or a list in ElseActions.
+	// Validate moves Else into ElseActions.
+	Else        *Action  `yaml:"else,omitempty"`
+	ElseActions []Action `yaml:"else_actions,omitempty"`
+}
+
+// WalkActions calls fn for every action in ops, including those nested in groups and
+// else branches
+func WalkActions(ops []Action, fn func(op *Action)) {
+	for i := range ops {
+		walkAction(&ops[i], fn)
+	}
+}
+
+func walkAction(op *Action, fn func(op *Action)) {
+	fn(op)
+	WalkActions(op.Actions, fn)
+	if op.Else != nil {
+		walkAction(op.Else, fn)
+	}
+	WalkActions(op.ElseActions, fn)
 }
 
 // BoolExpr represents a boolean expression tree for matching requests
@@ -122,17 +786,42 @@ type BoolExpr struct {
 	Body    map[string]PatternField `yaml:"body,omitempty"`
 	Query   map[string]PatternField `yaml:"query,omitempty"`
 	Headers map[string]PatternField `yaml:"headers,omitempty"`
+	Status  PatternField            `yaml:"status,omitempty"` // Response status code, ex: "5..", in on_response only
+	State   map[string]PatternField `yaml:"state,omitempty"`  // Values in the route's state store, by key
+
+	// Request matches the client's request, in on_response only
+	Request *BoolExpr `yaml:"request,omitempty"`
 
 	// Boolean operators
 	And []BoolExpr `yaml:"and,omitempty"`
 	Or  []BoolExpr `yaml:"or,omitempty"`
 	Not *BoolExpr  `yaml:"not,omitempty"`
+
+	// Ref names a condition from the top-level conditions, which must also match
+	Ref string `yaml:"ref,omitempty"`
+
+	// The condition Ref names, set by Validate
+	ref *BoolExpr
+
+	// Header matchers with their names lowercased, built by Validate
+	headerMatchers []headerMatcher
+}
+
+// headerMatcher is a headers entry with its lookup names computed once
+type headerMatcher struct {
+	name    string
+	lower   string
+	pattern PatternField
 }
 
 // PatternField can be a single pattern or array of patterns
 type PatternField struct {
 	Patterns []string
 	Compiled []*regexp.Regexp
+
+	// literals is set by Validate when every pattern is plain text, so ASCII inputs are
+	// matched without the regex
+	literals []literalPattern
 }
 
 // UnmarshalYAML allows both string and []string for pattern fields
@@ -164,11 +853,21 @@ func (p *PatternField) Validate() error {
 		}
 		p.Compiled = append(p.Compiled, re)
 	}
+	p.literals = literalPatterns(p.Patterns)
 	return nil
 }
 
 // Matches checks if input matches any compiled pattern
 func (p PatternField) Matches(input string) bool {
+	if p.literals != nil && isASCII(input) {
+		lowered := strings.ToLower(input)
+		for _, lit := range p.literals {
+			if lit.matches(lowered) {
+				return true
+			}
+		}
+		return false
+	}
 	for _, re := range p.Compiled {
 		if re.MatchString(input) {
 			return true
@@ -207,6 +906,24 @@ func (b *BoolExpr) Validate() error {
 		}
 		b.Headers[key] = pattern // Update map with compiled pattern
 	}
+	for key, pattern := range b.State {
+		if err := pattern.Validate(); err != nil {
+			return fmt.Errorf("invalid state pattern for '%s': %w", key, err)
+		}
+		b.State[key] = pattern
+	}
+	if err := b.Status.Validate(); err != nil {
+		return fmt.Errorf("invalid status pattern: %w", err)
+	}
+	if b.Request != nil {
+		if b.Request.matchesStatus() || b.Request.matchesRequest() {
+			return fmt.Errorf("request matches the request only: status and request can't be nested in it")
+		}
+		if err := b.Request.Validate(); err != nil {
+			return fmt.Errorf("invalid request expression: %w", err)
+		}
+	}
+	b.headerMatchers = newHeaderMatchers(b.Headers)
 
 	// Validate boolean operators recursively
 	for i := range b.And {
@@ -228,31 +945,66 @@ func (b *BoolExpr) Validate() error {
 	return nil
 }
 
+func newHeaderMatchers(headers map[string]PatternField) []headerMatcher {
+	matchers := make([]headerMatcher, 0, len(headers))
+	for key, pattern := range headers {
+		matchers = append(matchers, headerMatcher{name: key, lower: strings.ToLower(key), pattern: pattern})
+	}
+	return matchers
+}
+
 // Evaluate evaluates the boolean expression against request data
-// Returns true if the expression matches, false otherwise
+// Returns true if the expression matches, false otherwise. Header names match
+// case-insensitively; maps keyed in lowercase (as the proxy builds them once per request)
+// are looked up directly.
 func (b *BoolExpr) Evaluate(body map[string]any, headers map[string]string, query map[string]string) bool {
+	return b.match(matchInput{body: body, headers: headers, query: query})
+}
+
+// matchInput is what a when expression is evaluated against
+type matchInput struct {
+	body    map[string]any
+	headers map[string]string
+	query   map[string]string
+	status  int          // Response status; 0 for requests
+	request *RequestData // The client's request, for replies; nil for requests
+	store   *StateStore  // The route's state store, if any
+}
+
+func (b *BoolExpr) match(in matchInput) bool {
 	if b == nil {
 		return true // nil expression always matches
 	}
 
-	// Convert body to strings for pattern matching
-	bodyStrings := toStringMap(body)
-
-	// Normalize header keys to lowercase for case-insensitive matching
-	normalizedHeaders := make(map[string]string, len(headers))
-	for key, value := range headers {
-		normalizedHeaders[strings.ToLower(key)] = value
+	// Evaluate leaf matchers (implicit AND)
+	if !b.evaluateLeafMatchers(in.body, in.headers, in.query) {
+		return false
+	}
+	if b.Status.Len() > 0 && (in.status == 0 || !b.Status.Matches(strconv.Itoa(in.status))) {
+		return false
+	}
+	for key, pattern := range b.State {
+		if in.store == nil {
+			return false
+		}
+		value, ok := in.store.Get(key)
+		if !ok || !pattern.Matches(bodyString(value)) {
+			return false
+		}
+	}
+	if b.Request != nil && (in.request == nil || !b.Request.match(matchInput{body: in.request.Body, headers: in.request.Headers, query: in.request.Query})) {
+		return false
 	}
 
-	// Evaluate leaf matchers (implicit AND)
-	if !b.evaluateLeafMatchers(bodyStrings, normalizedHeaders, query) {
+	// Evaluate the named condition; refs are resolved by Validate, so one that isn't never matches
+	if b.Ref != "" && (b.ref == nil || !b.ref.match(in)) {
 		return false
 	}
 
 	// Evaluate boolean operators
 	if len(b.And) > 0 {
 		for _, expr := range b.And {
-			if !expr.Evaluate(body, headers, query) {
+			if !expr.match(in) {
 				return false
 			}
 		}
@@ -261,7 +1013,7 @@ func (b *BoolExpr) Evaluate(body map[string]any, headers map[string]string, quer
 	if len(b.Or) > 0 {
 		matched := false
 		for _, expr := range b.Or {
-			if expr.Evaluate(body, headers, query) {
+			if expr.match(in) {
 				matched = true
 				break
 			}
@@ -272,7 +1024,7 @@ func (b *BoolExpr) Evaluate(body map[string]any, headers map[string]string, quer
 	}
 
 	if b.Not != nil {
-		if b.Not.Evaluate(body, headers, query) {
+		if b.Not.match(in) {
 			return false
 		}
 	}
@@ -281,14 +1033,14 @@ func (b *BoolExpr) Evaluate(body map[string]any, headers map[string]string, quer
 }
 
 // evaluateLeafMatchers checks body, query, and header matchers (all must match - implicit AND)
-func (b *BoolExpr) evaluateLeafMatchers(bodyStrings map[string]string, normalizedHeaders map[string]string, query map[string]string) bool {
-	// Check body matchers
+func (b *BoolExpr) evaluateLeafMatchers(body map[string]any, headers map[string]string, query map[string]string) bool {
+	// Check body matchers, formatting only the fields they name
 	for key, pattern := range b.Body {
-		actualValue, exists := bodyStrings[key]
+		actualValue, exists := body[key]
 		if !exists {
 			return false
 		}
-		if !pattern.Matches(actualValue) {
+		if !pattern.Matches(bodyString(actualValue)) {
 			return false
 		}
 	}
@@ -305,13 +1057,16 @@ func (b *BoolExpr) evaluateLeafMatchers(bodyStrings map[string]string, normalize
 	}
 
 	// Check header matchers (case-insensitive keys)
-	for key, pattern := range b.Headers {
-		normalizedKey := strings.ToLower(key)
-		actualValue, exists := normalizedHeaders[normalizedKey]
+	matchers := b.headerMatchers
+	if matchers == nil && len(b.Headers) > 0 {
+		matchers = newHeaderMatchers(b.Headers)
+	}
+	for _, m := range matchers {
+		actualValue, exists := lookupHeader(headers, m.name, m.lower)
 		if !exists {
 			return false
 		}
-		if !pattern.Matches(actualValue) {
+		if !m.pattern.Matches(actualValue) {
 			return false
 		}
 	}
@@ -319,13 +1074,29 @@ func (b *BoolExpr) evaluateLeafMatchers(bodyStrings map[string]string, normalize
 	return true
 }
 
-// toStringMap converts map[string]any to map[string]string for pattern matching
-func toStringMap(data map[string]any) map[string]string {
-	result := make(map[string]string, len(data))
-	for key, value := range data {
-		result[key] = fmt.Sprintf("%v", value)
+// bodyString formats a body value for pattern matching
+func bodyString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
 	}
-	return result
+	return fmt.Sprintf("%v", v)
+}
+
+// lookupHeader finds a header by name, then by its lowercase form, then by scanning for a
+// case-insensitive match
+func lookupHeader(headers map[string]string, name, lower string) (string, bool) {
+	if value, ok := headers[name]; ok {
+		return value, true
+	}
+	if value, ok := headers[lower]; ok {
+		return value, true
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
 }
 
 // Load loads and merges one or more config files
@@ -359,9 +1130,32 @@ func Load(configPaths []string, overrides CliOverrides) (*Config, []string, erro
 
 		// Resolve paths relative to this config file's directory
 		configDir := filepath.Dir(configPath)
+		cfg.Admin.UsageFile = ResolvePath(cfg.Admin.UsageFile, configDir)
+		if cfg.Audit != nil {
+			cfg.Audit.File = ResolvePath(cfg.Audit.File, configDir)
+		}
 		for i := range cfg.Proxies {
 			cfg.Proxies[i].SSLCert = ResolvePath(cfg.Proxies[i].SSLCert, configDir)
 			cfg.Proxies[i].SSLKey = ResolvePath(cfg.Proxies[i].SSLKey, configDir)
+			cfg.Proxies[i].SSLClientCA = ResolvePath(cfg.Proxies[i].SSLClientCA, configDir)
+			if r := cfg.Proxies[i].RedirectHTTP; r != nil && r.ACMEDir != "" {
+				r.ACMEDir = ResolvePath(r.ACMEDir, configDir)
+			}
+			for j := range cfg.Proxies[i].SSLCerts {
+				pair := &cfg.Proxies[i].SSLCerts[j]
+				pair.Cert = ResolvePath(pair.Cert, configDir)
+				pair.Key = ResolvePath(pair.Key, configDir)
+				if pair.Cert != "" {
+					watchedFiles.Add(pair.Cert)
+				}
+				if pair.Key != "" {
+					watchedFiles.Add(pair.Key)
+				}
+			}
+			if cfg.Proxies[i].TraceDir == "" {
+				cfg.Proxies[i].TraceDir = DefaultTraceDir
+			}
+			cfg.Proxies[i].TraceDir = ResolvePath(cfg.Proxies[i].TraceDir, configDir)
 
 			// Add SSL cert/key files to watched files
 			if cfg.Proxies[i].SSLCert != "" {
@@ -370,12 +1164,72 @@ func Load(configPaths []string, overrides CliOverrides) (*Config, []string, erro
 			if cfg.Proxies[i].SSLKey != "" {
 				watchedFiles.Add(cfg.Proxies[i].SSLKey)
 			}
+			if cfg.Proxies[i].SSLClientCA != "" {
+				watchedFiles.Add(cfg.Proxies[i].SSLClientCA)
+			}
+			if c := cfg.Proxies[i].Conformance; c != nil && c.OpenAPI != "" {
+				c.OpenAPI = ResolvePath(c.OpenAPI, configDir)
+				watchedFiles.Add(c.OpenAPI)
+			}
+
+			// Schema files are relative to the file declaring the route, and watched like it
+			for j := range cfg.Proxies[i].Routes {
+				route := &cfg.Proxies[i].Routes[j]
+				routeDir := configDir
+				if route.Source != "" {
+					routeDir = filepath.Dir(route.Source)
+				}
+				WalkActions(route.OnRequest, func(op *Action) {
+					if op.Schema != nil && op.Schema.File != "" {
+						op.Schema.File = ResolvePath(op.Schema.File, routeDir)
+						watchedFiles.Add(op.Schema.File)
+					}
+				})
+			}
 		}
 
 		if i == 0 {
 			mergedConfig = &cfg
 		} else {
 			mergedConfig.Proxies = append(mergedConfig.Proxies, cfg.Proxies...)
+			if cfg.Admin.Listen != "" {
+				mergedConfig.Admin.Listen = cfg.Admin.Listen
+			}
+			if cfg.Admin.UsageFile != "" {
+				mergedConfig.Admin.UsageFile = cfg.Admin.UsageFile
+			}
+			if cfg.Admin.Dashboard != nil {
+				mergedConfig.Admin.Dashboard = cfg.Admin.Dashboard
+			}
+			if cfg.Admin.Pprof {
+				mergedConfig.Admin.Pprof = true
+			}
+			if cfg.Logging != (LoggingConfig{}) {
+				mergedConfig.Logging = cfg.Logging
+			}
+			if cfg.Memory != nil {
+				mergedConfig.Memory = cfg.Memory
+			}
+			if cfg.Reload != nil {
+				mergedConfig.Reload = cfg.Reload
+			}
+			if cfg.Audit != nil {
+				mergedConfig.Audit = cfg.Audit
+			}
+			if cfg.Patterns.MaxLength != 0 {
+				mergedConfig.Patterns.MaxLength = cfg.Patterns.MaxLength
+			}
+			if cfg.Patterns.RequireAnchors {
+				mergedConfig.Patterns.RequireAnchors = true
+			}
+			if len(cfg.Presets) > 0 && mergedConfig.Presets == nil {
+				mergedConfig.Presets = make(map[string]map[string]any, len(cfg.Presets))
+			}
+			maps.Copy(mergedConfig.Presets, cfg.Presets)
+			if len(cfg.Conditions) > 0 && mergedConfig.Conditions == nil {
+				mergedConfig.Conditions = make(map[string]*BoolExpr, len(cfg.Conditions))
+			}
+			maps.Copy(mergedConfig.Conditions, cfg.Conditions)
 			logger.Debug("Merged config file", "path", configPath, "proxies_added", len(cfg.Proxies))
 		}
 
@@ -415,6 +1269,14 @@ func Load(configPaths []string, overrides CliOverrides) (*Config, []string, erro
 			// Allow global debug enablement
 			proxies[i].Debug = true
 		}
+		if overrides.Trace != "" {
+			proxies[i].TraceDir = ResolvePath(overrides.Trace, pwd)
+			proxies[i].TraceAll = true
+		}
+
+		if proxies[i].Target == "" && len(proxies[i].Targets) > 0 {
+			proxies[i].Target = proxies[i].Targets[0]
+		}
 
 		if proxies[i].Timeout == 0 {
 			proxies[i].Timeout = 60 * time.Second
@@ -443,6 +1305,9 @@ func Load(configPaths []string, overrides CliOverrides) (*Config, []string, erro
 	if overrides.Debug {
 		overrideFields = append(overrideFields, "debug", overrides.Debug)
 	}
+	if overrides.Trace != "" {
+		overrideFields = append(overrideFields, "trace", overrides.Trace)
+	}
 	if len(overrideFields) > 0 {
 		logger.Debug("Applied CLI overrides", overrideFields...)
 	}
@@ -477,10 +1342,55 @@ func loadConfigFile(configPath string, watchedFiles *watchList) (Config, error)
 	if err := root.Decode(&cfg); err != nil {
 		return Config{}, fmt.Errorf("failed to decode config %s: %w", configPath, err)
 	}
+	setRouteSources(&root, &cfg, configPath, watchedFiles)
 
 	return cfg, nil
 }
 
+// setRouteSources records the file each route was defined in: configPath, or the include
+// that supplied it
+func setRouteSources(root *yaml.Node, cfg *Config, configPath string, watchedFiles *watchList) {
+	if len(root.Content) == 0 {
+		return
+	}
+	proxies := mappingValue(root.Content[0], "proxy")
+	if proxies == nil {
+		return
+	}
+	proxyNodes := []*yaml.Node{proxies}
+	if proxies.Kind == yaml.SequenceNode {
+		proxyNodes = proxies.Content
+	}
+	if len(proxyNodes) != len(cfg.Proxies) {
+		return
+	}
+	for i, proxyNode := range proxyNodes {
+		routes := mappingValue(proxyNode, "routes")
+		if routes == nil || routes.Kind != yaml.SequenceNode || len(routes.Content) != len(cfg.Proxies[i].Routes) {
+			continue
+		}
+		for j, routeNode := range routes.Content {
+			source, ok := watchedFiles.sources[routeNode]
+			if !ok {
+				source = configPath
+			}
+			cfg.Proxies[i].Routes[j].Source = source
+		}
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
 // expandIncludes recursively inlines include nodes and tracks every referenced file for watching.
 func expandIncludes(node *yaml.Node, baseDir string, watchedFiles *watchList) error {
 	switch node.Kind {
@@ -501,6 +1411,9 @@ func expandIncludes(node *yaml.Node, baseDir string, watchedFiles *watchList) er
 					return err
 				}
 				*node = *included
+				if source, ok := watchedFiles.sources[included]; ok {
+					watchedFiles.sources[node] = source
+				}
 				return expandIncludes(node, baseDir, watchedFiles)
 			}
 
@@ -591,18 +1504,22 @@ func loadIncludeNode(pathNode *yaml.Node, baseDir string, watchedFiles *watchLis
 	}
 
 	// yaml.Unmarshal produces a DocumentNode with single child
+	included := &root
 	if len(root.Content) > 0 {
-		return root.Content[0], nil
+		included = root.Content[0]
 	}
-	return &root, nil
+	watchedFiles.markSource(included, includePath)
+	return included, nil
 }
 
 func applyOverrides(proxy *ProxyConfig, overrides CliOverrides, pwd string) {
 	if overrides.Listen != "" {
 		proxy.Listen = overrides.Listen
+		proxy.ExtraListen = nil
 	}
 	if overrides.Target != "" {
 		proxy.Target = overrides.Target
+		proxy.Targets = nil
 	}
 	if overrides.Timeout > 0 {
 		proxy.Timeout = overrides.Timeout
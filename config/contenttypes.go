@@ -0,0 +1,42 @@
+package config
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// MatchesContentType reports whether a request with headers fits the route's content_types:
+// its Content-Type's media type, or without one any media type in Accept, must match a
+// pattern. Routes without content_types match every request.
+func (r *Route) MatchesContentType(headers http.Header) bool {
+	if r.ContentTypes.Len() == 0 {
+		return true
+	}
+	for _, mediaType := range requestMediaTypes(headers) {
+		if r.ContentTypes.Matches(mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestMediaTypes returns the media types, without parameters, a request sends
+// (Content-Type) or, when it sends no body type, accepts
+func requestMediaTypes(headers http.Header) []string {
+	if contentType := headers.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			return []string{mediaType}
+		}
+		return nil
+	}
+	var mediaTypes []string
+	for _, accept := range headers.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil {
+				mediaTypes = append(mediaTypes, mediaType)
+			}
+		}
+	}
+	return mediaTypes
+}
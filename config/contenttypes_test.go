@@ -0,0 +1,35 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRouteMatchesContentType(t *testing.T) {
+	route := Route{ContentTypes: newPatternField("^application/json$")}
+
+	tests := []struct {
+		name    string
+		headers http.Header
+		want    bool
+	}{
+		{name: "JSON body", headers: http.Header{"Content-Type": {"application/json; charset=utf-8"}}, want: true},
+		{name: "upper case", headers: http.Header{"Content-Type": {"Application/JSON"}}, want: true},
+		{name: "multipart body", headers: http.Header{"Content-Type": {"multipart/form-data; boundary=x"}}},
+		{name: "Content-Type wins over Accept", headers: http.Header{"Content-Type": {"text/plain"}, "Accept": {"application/json"}}},
+		{name: "Accept without a body", headers: http.Header{"Accept": {"text/event-stream, application/json;q=0.9"}}, want: true},
+		{name: "no headers", headers: http.Header{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := route.MatchesContentType(tt.headers); got != tt.want {
+				t.Errorf("MatchesContentType(%v) = %v, want %v", tt.headers, got, tt.want)
+			}
+		})
+	}
+
+	if !(&Route{}).MatchesContentType(http.Header{}) {
+		t.Error("a route without content_types should match every request")
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+// Change ops
+const (
+	ChangeAdded   = "added"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// Change is one value an action changed, at a dotted path into the body (array elements by
+// index, ex: messages.0.content)
+type Change struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`            // added, updated, or deleted
+	Old  any    `json:"old,omitempty"` // Unset for added
+	New  any    `json:"new,omitempty"` // Unset for deleted
+}
+
+// Diff returns the changes from before to after, sorted by path. Arrays of equal length are
+// compared element by element; otherwise the whole array is reported as updated.
+func Diff(before, after map[string]any) []Change {
+	return diffValues("", before, after, nil)
+}
+
+func diffValues(path string, before, after any, changes []Change) []Change {
+	switch b := before.(type) {
+	case map[string]any:
+		if a, ok := after.(map[string]any); ok {
+			keys := slices.Collect(maps.Keys(b))
+			for key := range a {
+				if _, ok := b[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			slices.Sort(keys)
+			for _, key := range keys {
+				bv, inBefore := b[key]
+				av, inAfter := a[key]
+				switch {
+				case !inAfter:
+					changes = append(changes, Change{Path: joinPath(path, key), Op: ChangeDeleted, Old: bv})
+				case !inBefore:
+					changes = append(changes, Change{Path: joinPath(path, key), Op: ChangeAdded, New: av})
+				default:
+					changes = diffValues(joinPath(path, key), bv, av, changes)
+				}
+			}
+			return changes
+		}
+	case []any:
+		if a, ok := after.([]any); ok && len(a) == len(b) {
+			for i := range b {
+				changes = diffValues(joinPath(path, strconv.Itoa(i)), b[i], a[i], changes)
+			}
+			return changes
+		}
+	}
+	if !reflect.DeepEqual(before, after) {
+		changes = append(changes, Change{Path: path, Op: ChangeUpdated, Old: before, New: after})
+	}
+	return changes
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// cloneJSON deep-copies decoded JSON so a snapshot survives in-place edits
+func cloneJSON(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(value))
+		for k, item := range value {
+			out[k] = cloneJSON(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(value))
+		for i, item := range value {
+			out[i] = cloneJSON(item)
+		}
+		return out
+	}
+	return v
+}
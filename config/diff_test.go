@@ -0,0 +1,63 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffReportsNestedPaths(t *testing.T) {
+	before := map[string]any{
+		"model":    "m",
+		"user":     "ada",
+		"options":  map[string]any{"temperature": 1.0},
+		"messages": []any{map[string]any{"role": "user", "content": "hi"}},
+		"stop":     []any{"a"},
+	}
+	after := map[string]any{
+		"model":    "m",
+		"seed":     42.0,
+		"options":  map[string]any{"temperature": 0.2},
+		"messages": []any{map[string]any{"role": "user", "content": "[EMAIL_1]"}},
+		"stop":     []any{"a", "b"},
+	}
+
+	want := []Change{
+		{Path: "messages.0.content", Op: ChangeUpdated, Old: "hi", New: "[EMAIL_1]"},
+		{Path: "options.temperature", Op: ChangeUpdated, Old: 1.0, New: 0.2},
+		{Path: "seed", Op: ChangeAdded, New: 42.0},
+		{Path: "stop", Op: ChangeUpdated, Old: []any{"a"}, New: []any{"a", "b"}},
+		{Path: "user", Op: ChangeDeleted, Old: "ada"},
+	}
+	if got := Diff(before, after); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Diff = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestProcessActionsRecordsDiffs(t *testing.T) {
+	route := &CompiledRoute{OnRequest: []ActionExec{
+		{Merge: map[string]any{"temperature": 0.2}},
+		{Seed: &SeedPolicy{Mode: SeedPerKey, Field: "options.seed", Header: "Authorization"}},
+	}}
+	data := map[string]any{"temperature": 1.0, "options": map[string]any{"num_ctx": 4096.0}}
+
+	state := &ActionState{Diffs: true}
+	ProcessRequestWithState(data, map[string]string{"Authorization": "Bearer k"}, nil, route, 0, "POST", "/api/chat", state)
+
+	if len(state.Fired) != 2 {
+		t.Fatalf("fired = %+v, want 2 actions", state.Fired)
+	}
+	want := []Change{{Path: "temperature", Op: ChangeUpdated, Old: 1.0, New: 0.2}}
+	if !reflect.DeepEqual(state.Fired[0].Diff, want) {
+		t.Fatalf("merge diff = %+v, want %+v", state.Fired[0].Diff, want)
+	}
+	seedDiff := state.Fired[1].Diff
+	if len(seedDiff) != 1 || seedDiff[0].Path != "options.seed" || seedDiff[0].Op != ChangeAdded {
+		t.Fatalf("seed diff = %+v, want options.seed added", seedDiff)
+	}
+
+	state = &ActionState{}
+	ProcessRequestWithState(map[string]any{"temperature": 1.0}, nil, nil, route, 0, "POST", "/", state)
+	if state.Fired[0].Diff != nil {
+		t.Fatalf("diff recorded without ActionState.Diffs: %+v", state.Fired[0].Diff)
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"text/template"
+)
+
+// ErrorResponse replaces the plain-text 502 answered when the upstream connection fails
+// or times out. The body is a Go template producing JSON, over .status, .code
+// (upstream_unreachable or upstream_timeout), .message, .error, .method, and .path.
+type ErrorResponse struct {
+	Status  int               `yaml:"status,omitempty"`  // Defaults to 502, or 504 for timeouts
+	Headers map[string]string `yaml:"headers,omitempty"` // Added to the reply; Content-Type defaults to application/json
+	Body    string            `yaml:"body,omitempty"`    // Defaults to an OpenAI-style error
+
+	Compiled *template.Template `yaml:"-"` // Body, parsed by Validate
+}
+
+// Validate checks the status and parses the body template
+func (e *ErrorResponse) Validate() error {
+	if e.Status != 0 && (e.Status < 400 || e.Status > 599) {
+		return fmt.Errorf("status must be a 4xx or 5xx code")
+	}
+	for name := range e.Headers {
+		if http.CanonicalHeaderKey(name) == "Content-Length" {
+			return fmt.Errorf("headers: Content-Length is set from the body")
+		}
+	}
+	if e.Body == "" {
+		return nil
+	}
+	tmpl, err := template.New("error_response").Funcs(TemplateFuncs).Parse(e.Body)
+	if err != nil {
+		return fmt.Errorf("body: %w", err)
+	}
+	e.Compiled = tmpl
+	return nil
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// pluginFuncs are template funcs registered by embedders and compiled-in plugin packages.
+// Routes opt in to them by name with funcs.
+var (
+	pluginFuncsMu sync.RWMutex
+	pluginFuncs   = template.FuncMap{}
+)
+
+// RegisterTemplateFunc makes fn available to the templates of routes that list name under
+// funcs. Call it from an init function or before loading config. fn follows text/template
+// rules: one result, or a result and an error. It panics when name is taken or fn is not
+// a valid template func.
+func RegisterTemplateFunc(name string, fn any) {
+	if _, ok := TemplateFuncs[name]; ok {
+		panic(fmt.Sprintf("template func %q is built in", name))
+	}
+	if strings.HasPrefix(name, "state_") {
+		panic(fmt.Sprintf("template func %q uses the prefix reserved for state stores", name))
+	}
+	// Funcs panics on invalid names and signatures
+	template.New("").Funcs(template.FuncMap{name: fn})
+
+	pluginFuncsMu.Lock()
+	defer pluginFuncsMu.Unlock()
+	if _, ok := pluginFuncs[name]; ok {
+		panic(fmt.Sprintf("template func %q registered twice", name))
+	}
+	pluginFuncs[name] = fn
+}
+
+// RegisterTemplateFuncs registers every func in funcs (see RegisterTemplateFunc)
+func RegisterTemplateFuncs(funcs template.FuncMap) {
+	for _, name := range slices.Sorted(maps.Keys(funcs)) {
+		RegisterTemplateFunc(name, funcs[name])
+	}
+}
+
+// TemplateFuncNames returns the registered plugin funcs in sorted order
+func TemplateFuncNames() []string {
+	pluginFuncsMu.RLock()
+	defer pluginFuncsMu.RUnlock()
+	return slices.Sorted(maps.Keys(pluginFuncs))
+}
+
+// validateFuncs checks that every name in a route's funcs is registered
+func validateFuncs(names []string) error {
+	pluginFuncsMu.RLock()
+	defer pluginFuncsMu.RUnlock()
+	for _, name := range names {
+		if _, ok := pluginFuncs[name]; ok {
+			continue
+		}
+		if _, ok := TemplateFuncs[name]; ok {
+			return fmt.Errorf("funcs: %s is built in and always available", name)
+		}
+		available := "none registered"
+		if len(pluginFuncs) > 0 {
+			available = "available: " + strings.Join(slices.Sorted(maps.Keys(pluginFuncs)), ", ")
+		}
+		return fmt.Errorf("funcs: unknown template func '%s' (%s)", name, available)
+	}
+	return nil
+}
+
+// routeFuncs returns the built-in funcs plus the plugin funcs a route allows
+func routeFuncs(allowed []string) template.FuncMap {
+	if len(allowed) == 0 {
+		return TemplateFuncs
+	}
+	funcs := maps.Clone(TemplateFuncs)
+	pluginFuncsMu.RLock()
+	defer pluginFuncsMu.RUnlock()
+	for _, name := range allowed {
+		if fn, ok := pluginFuncs[name]; ok {
+			funcs[name] = fn
+		}
+	}
+	return funcs
+}
+
+// funcHint explains a parse error caused by a registered func the route didn't allow, or
+// a state helper without a state store
+func funcHint(err error) error {
+	if strings.Contains(err.Error(), `function "state_`) {
+		return fmt.Errorf("%w (set state: on the route to use its state store)", err)
+	}
+	pluginFuncsMu.RLock()
+	defer pluginFuncsMu.RUnlock()
+	for name := range pluginFuncs {
+		if strings.Contains(err.Error(), fmt.Sprintf("function %q not defined", name)) {
+			return fmt.Errorf("%w (add %s to the route's funcs)", err, name)
+		}
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestRegisterTemplateFuncAllowlist(t *testing.T) {
+	RegisterTemplateFunc("testShout", strings.ToUpper)
+
+	if !slices.Contains(TemplateFuncNames(), "testShout") {
+		t.Fatalf("TemplateFuncNames() = %v, want testShout", TemplateFuncNames())
+	}
+
+	newRoutes := func(funcs ...string) []Route {
+		return []Route{{
+			Methods:   newPatternField("POST"),
+			Paths:     newPatternField("/v1/chat"),
+			Funcs:     funcs,
+			OnRequest: []Action{{Template: `{"model": "{{testShout .model}}"}`}},
+		}}
+	}
+
+	if err := compileRouteTemplates(newRoutes("testShout"), nil, "test"); err != nil {
+		t.Fatalf("allowed func: %v", err)
+	}
+
+	err := compileRouteTemplates(newRoutes(), nil, "test")
+	if err == nil || !strings.Contains(err.Error(), "add testShout to the route's funcs") {
+		t.Fatalf("expected funcs hint, got %v", err)
+	}
+}
+
+func TestValidateRouteFuncs(t *testing.T) {
+	RegisterTemplateFunc("testKnown", func() string { return "" })
+
+	route := Route{
+		Methods:   newPatternField("POST"),
+		Paths:     newPatternField("/v1/chat"),
+		Funcs:     []string{"testKnown"},
+		OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+	}
+	if err := validateRoute(&route, 0); err != nil {
+		t.Fatalf("registered func: %v", err)
+	}
+
+	route.Funcs = []string{"testMissing"}
+	if err := validateRoute(&route, 0); err == nil || !strings.Contains(err.Error(), "unknown template func 'testMissing'") || !strings.Contains(err.Error(), "testKnown") {
+		t.Fatalf("expected unknown func error listing registered funcs, got %v", err)
+	}
+
+	route.Funcs = []string{"toJson"}
+	if err := validateRoute(&route, 0); err == nil || !strings.Contains(err.Error(), "built in") {
+		t.Fatalf("expected built-in error, got %v", err)
+	}
+}
+
+func TestRegisterTemplateFuncPanics(t *testing.T) {
+	RegisterTemplateFuncs(template.FuncMap{"testOnce": func() string { return "" }})
+
+	for name, fn := range map[string]any{
+		"toJson":   func() string { return "" }, // Built in
+		"testOnce": func() string { return "" }, // Already registered
+		"testBad":  "not a func",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterTemplateFunc(%q) did not panic", name)
+				}
+			}()
+			RegisterTemplateFunc(name, fn)
+		}()
+	}
+}
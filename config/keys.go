@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// APIKey limits what one client key (the Authorization bearer token) may use, for sharing
+// a proxy among teams with different entitlements, and can set its own request defaults.
+// Once a proxy lists keys, requests without a listed key are refused.
+type APIKey struct {
+	Name   string       `yaml:"name,omitempty"`   // Label in logs and errors; defaults to the key's last 4 characters
+	Key    string       `yaml:"key"`              // Bearer token, without the "Bearer " prefix
+	Models PatternField `yaml:"models,omitempty"` // Model names the key may request, as the client sends them; empty allows any
+	Routes []string     `yaml:"routes,omitempty"` // Names of the routes the key may use; empty allows any
+
+	OnRequest []Action `yaml:"on_request,omitempty"` // Actions for this key's requests, before aliases and route actions (ex: force a model, set user)
+
+	// Compiled on_request actions (not serialized)
+	Compiled *CompiledRoute `yaml:"-"`
+}
+
+// Validate compiles the model patterns and checks route names against the proxy's routes
+func (k *APIKey) Validate(routes []Route) error {
+	if k.Key == "" {
+		return fmt.Errorf("key required")
+	}
+	if k.Name == "" {
+		k.Name = "…" + k.Key[max(0, len(k.Key)-4):]
+	}
+	if err := k.Models.Validate(); err != nil {
+		return fmt.Errorf("models: %w", err)
+	}
+	for opIdx := range k.OnRequest {
+		if err := validateActionAt(&k.OnRequest[opIdx], fmt.Sprintf("on_request %d", opIdx), "on_request"); err != nil {
+			return err
+		}
+	}
+	for _, name := range k.Routes {
+		found := false
+		for i := range routes {
+			if routes[i].Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("routes: no route named %q", name)
+		}
+	}
+	return nil
+}
+
+// AllowsRoute reports whether the key may use the named route
+func (k *APIKey) AllowsRoute(name string) bool {
+	if len(k.Routes) == 0 {
+		return true
+	}
+	for _, r := range k.Routes {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveActionRefs checks the presets and named conditions the key's actions use. Keys
+// have no state store or response, so their actions can't match state, status, or request.
+func (k *APIKey) resolveActionRefs(presets map[string]map[string]any, conditions map[string]*BoolExpr) error {
+	for opIdx := range k.OnRequest {
+		var err error
+		WalkActions(k.OnRequest[opIdx:opIdx+1], func(op *Action) {
+			if err != nil {
+				return
+			}
+			if op.ApplyPreset != nil {
+				if err = op.ApplyPreset.Validate(presets); err != nil {
+					return
+				}
+			}
+			if op.When == nil {
+				return
+			}
+			if err = op.When.resolveRefs(conditions, nil); err != nil {
+				return
+			}
+			if op.When.matchesState() || op.When.matchesStatus() || op.When.matchesRequest() {
+				err = fmt.Errorf("when: key actions can't match state, status, or request")
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("on_request %d: %w", opIdx, err)
+		}
+	}
+	return nil
+}
+
+// validateKeys validates a proxy's keys and rejects a key listed twice
+func validateKeys(keys []APIKey, routes []Route, presets map[string]map[string]any, conditions map[string]*BoolExpr) error {
+	seen := make(map[string]bool, len(keys))
+	for i := range keys {
+		if err := keys[i].Validate(routes); err != nil {
+			return fmt.Errorf("keys[%d]: %w", i, err)
+		}
+		if err := keys[i].resolveActionRefs(presets, conditions); err != nil {
+			return fmt.Errorf("keys[%d]: %w", i, err)
+		}
+		if seen[keys[i].Key] {
+			return fmt.Errorf("keys[%d]: key %s listed twice", i, keys[i].Name)
+		}
+		seen[keys[i].Key] = true
+	}
+	return nil
+}
+
+// BearerToken returns the token of an Authorization header ("Bearer <token>"), or the
+// whole value when it has no scheme
+func BearerToken(authorization string) string {
+	key := strings.TrimSpace(authorization)
+	if len(key) > 7 && strings.EqualFold(key[:7], "bearer ") {
+		key = strings.TrimSpace(key[7:])
+	}
+	return key
+}
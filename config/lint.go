@@ -0,0 +1,357 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Lint checks
+const (
+	LintShadowed       = "shadowed"        // A route policy that an earlier route always claims first
+	LintCatchAll       = "catch_all"       // A pattern that matches every value
+	LintNeverTrue      = "never_true"      // A when that can't hold, or an action that can't run
+	LintUnanchored     = "unanchored"      // A path pattern without a leading ^
+	LintOpenEnded      = "open_ended"      // A path pattern that also matches longer paths (ex: ^/v1/chat)
+	LintUnusedInclude  = "unused_include"  // A YAML fragment next to the config that nothing includes
+	LintUnmatchedRoute = "unmatched_route" // A route whose methods match no HTTP method
+)
+
+// Finding is one lint result. Route is -1 for findings about files.
+type Finding struct {
+	Listen  string `json:"listen,omitempty"`
+	Route   int    `json:"route"`
+	Name    string `json:"name,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// lintProbes are inputs a pattern must match to count as matching everything
+var lintProbes = []string{"", "/", "/v1/chat/completions", "GET", "POST", "x-y_z.1 ?"}
+
+var httpMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// bodiless methods never carry the JSON body on_request actions work on
+var bodiless = []string{"GET", "HEAD", "OPTIONS"}
+
+// routePolicies are the route policies where the first matching route wins
+var routePolicies = []struct {
+	name string
+	set  func(r *Route) bool
+}{
+	{"format", func(r *Route) bool { return r.Format != "" }},
+	{"context", func(r *Route) bool { return r.Context != nil }},
+	{"images", func(r *Route) bool { return r.Images != nil }},
+	{"files", func(r *Route) bool { return r.Files != nil }},
+	{"embeddings", func(r *Route) bool { return r.Embeddings != nil }},
+	{"prompt", func(r *Route) bool { return r.Prompt != nil }},
+	{"choices", func(r *Route) bool { return r.Choices != nil }},
+	{"structured_output", func(r *Route) bool { return r.StructuredOutput != nil }},
+	{"reasoning", func(r *Route) bool { return r.Reasoning != nil }},
+	{"moderation", func(r *Route) bool { return r.Moderation != nil }},
+}
+
+// Lint reports likely mistakes in a validated config: they load fine but don't do what
+// they appear to
+func Lint(cfg *Config) []Finding {
+	var findings []Finding
+	for _, proxy := range cfg.Proxies {
+		for i := range proxy.Routes {
+			route := &proxy.Routes[i]
+			report := func(check, format string, args ...any) {
+				findings = append(findings, Finding{
+					Listen:  proxy.Listen,
+					Route:   i,
+					Name:    route.Name,
+					Source:  route.Source,
+					Check:   check,
+					Message: fmt.Sprintf(format, args...),
+				})
+			}
+			lintPatterns(route, report)
+			lintShadowed(proxy.Routes[:i], route, report)
+			lintActions(route, report)
+		}
+	}
+	return findings
+}
+
+func lintPatterns(route *Route, report func(check, format string, args ...any)) {
+	for i, re := range route.Methods.Compiled {
+		if matchesEverything(re) {
+			report(LintCatchAll, "method pattern %q matches every method", route.Methods.Patterns[i])
+		}
+	}
+	if len(matchingMethods(route.Methods)) == 0 {
+		report(LintUnmatchedRoute, "methods %s match no HTTP method, so the route never runs", strings.Join(route.Methods.Patterns, ", "))
+	}
+	for i, re := range route.Paths.Compiled {
+		pattern := route.Paths.Patterns[i]
+		switch {
+		case matchesEverything(re):
+			report(LintCatchAll, "path pattern %q matches every path", pattern)
+		case !strings.HasPrefix(pattern, "^"):
+			report(LintUnanchored, "path pattern %q is unanchored and matches anywhere in the path (ex: /proxy%s); start it with ^", pattern, strings.TrimSuffix(pattern, "$"))
+		case openEnded(pattern):
+			report(LintOpenEnded, "path pattern %q also matches longer paths (ex: %s-archive); end it with $ or /", pattern, strings.TrimPrefix(pattern, "^"))
+		}
+	}
+}
+
+// openEnded reports whether pattern is plain text anchored only at the start, so it
+// matches any path that continues the last segment
+func openEnded(pattern string) bool {
+	lit, ok := parseLiteral(pattern)
+	return ok && lit.kind == literalPrefix && lit.text != "" && !strings.HasSuffix(lit.text, "/")
+}
+
+// lintShadowed flags policies an earlier route with the same policy always claims first
+func lintShadowed(earlier []Route, route *Route, report func(check, format string, args ...any)) {
+	for _, policy := range routePolicies {
+		if !policy.set(route) {
+			continue
+		}
+		for j := range earlier {
+			if policy.set(&earlier[j]) && covers(&earlier[j], route) {
+				report(LintShadowed, "%s never applies: route %d sets %s and matches every request this route does", policy.name, j, policy.name)
+				break
+			}
+		}
+	}
+}
+
+// covers reports whether every request matching b also matches a
+func covers(a, b *Route) bool {
+	return coversPatterns(a.Methods, b.Methods) && coversPatterns(a.Paths, b.Paths)
+}
+
+func coversPatterns(a, b PatternField) bool {
+	for _, re := range a.Compiled {
+		if matchesEverything(re) {
+			return true
+		}
+	}
+	for _, pattern := range b.Patterns {
+		if !slices.ContainsFunc(a.Patterns, func(p string) bool { return strings.EqualFold(p, pattern) }) {
+			return false
+		}
+	}
+	return true
+}
+
+func lintActions(route *Route, report func(check, format string, args ...any)) {
+	methods := matchingMethods(route.Methods)
+	if len(route.OnRequest) > 0 && len(methods) > 0 && !slices.ContainsFunc(methods, func(m string) bool { return !slices.Contains(bodiless, m) }) {
+		report(LintNeverTrue, "on_request actions never run: the route only matches %s requests, which have no body", strings.Join(methods, ", "))
+	}
+
+	phases := []struct {
+		name string
+		ops  []Action
+	}{{"on_request", route.OnRequest}, {"on_response", route.OnResponse}}
+	for _, phase := range phases {
+		stopped := -1
+		for i, op := range phase.ops {
+			if stopped >= 0 {
+				report(LintNeverTrue, "%s action %d never runs: action %d always stops the route", phase.name, i, stopped)
+				continue
+			}
+			when := op.When
+			if when == nil && len(op.WhenAny) > 0 {
+				when = &BoolExpr{Or: op.WhenAny}
+			}
+			if when != nil {
+				if reason := neverTrue(when); reason != "" {
+					report(LintNeverTrue, "%s action %d never runs: %s", phase.name, i, reason)
+				}
+				for _, field := range catchAllFields(when) {
+					report(LintCatchAll, "%s action %d: %s matches any value, so the when only checks that it is present", phase.name, i, field)
+				}
+			}
+			if op.Stop && (when == nil || alwaysTrue(when)) {
+				stopped = i
+			}
+		}
+	}
+}
+
+// neverTrue explains why a when expression can't match, or returns ""
+func neverTrue(b *BoolExpr) string {
+	if b.ref != nil {
+		if reason := neverTrue(b.ref); reason != "" {
+			return fmt.Sprintf("condition %s never matches: %s", b.Ref, reason)
+		}
+	}
+	for key := range b.Body {
+		if strings.Contains(key, ".") {
+			return fmt.Sprintf("body key %q is compared with top-level fields only, so dotted keys never match", key)
+		}
+	}
+	for _, expr := range b.And {
+		if reason := neverTrue(&expr); reason != "" {
+			return reason
+		}
+	}
+	if len(b.Or) > 0 {
+		var reasons []string
+		for _, expr := range b.Or {
+			reason := neverTrue(&expr)
+			if reason == "" {
+				break
+			}
+			reasons = append(reasons, reason)
+		}
+		if len(reasons) == len(b.Or) {
+			return "no branch of or can match (" + strings.Join(reasons, "; ") + ")"
+		}
+	}
+	if b.Not != nil && alwaysTrue(b.Not) {
+		return "not negates a condition that always holds"
+	}
+	return ""
+}
+
+// alwaysTrue reports whether a when expression matches every request
+func alwaysTrue(b *BoolExpr) bool {
+	if len(b.Body) > 0 || len(b.Query) > 0 || len(b.Headers) > 0 || b.Status.Len() > 0 || b.Request != nil || len(b.State) > 0 {
+		return false
+	}
+	if b.Ref != "" && (b.ref == nil || !alwaysTrue(b.ref)) {
+		return false
+	}
+	for _, expr := range b.And {
+		if !alwaysTrue(&expr) {
+			return false
+		}
+	}
+	if len(b.Or) > 0 && !slices.ContainsFunc(b.Or, func(expr BoolExpr) bool { return alwaysTrue(&expr) }) {
+		return false
+	}
+	return b.Not == nil || neverTrue(b.Not) != ""
+}
+
+// catchAllFields lists the leaf matchers of a when expression that match any value
+func catchAllFields(b *BoolExpr) []string {
+	var fields []string
+	add := func(kind string, matchers map[string]PatternField) {
+		for _, key := range slices.Sorted(maps.Keys(matchers)) {
+			if slices.ContainsFunc(matchers[key].Compiled, matchesEverything) {
+				fields = append(fields, kind+"."+key)
+			}
+		}
+	}
+	add("body", b.Body)
+	add("query", b.Query)
+	add("headers", b.Headers)
+	for _, expr := range b.And {
+		fields = append(fields, catchAllFields(&expr)...)
+	}
+	for _, expr := range b.Or {
+		fields = append(fields, catchAllFields(&expr)...)
+	}
+	if b.Not != nil {
+		fields = append(fields, catchAllFields(b.Not)...)
+	}
+	return fields
+}
+
+func matchesEverything(re *regexp.Regexp) bool {
+	for _, probe := range lintProbes {
+		if !re.MatchString(probe) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchingMethods(p PatternField) []string {
+	var methods []string
+	for _, method := range httpMethods {
+		if p.Matches(method) {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// LintIncludes flags YAML files beside the config files that look like include fragments
+// but are included neither by the loaded config nor by another config in the same directory.
+// loaded is the file list from Load.
+func LintIncludes(configPaths, loaded []string) []Finding {
+	used := make(map[string]bool)
+	markUsed := func(paths []string) {
+		for _, path := range paths {
+			if abs, err := filepath.Abs(path); err == nil {
+				used[abs] = true
+			}
+		}
+	}
+	markUsed(configPaths)
+	markUsed(loaded)
+
+	var fragments []string
+	dirs := make(map[string]bool)
+	for _, configPath := range configPaths {
+		dir := filepath.Dir(configPath)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+
+		for _, pattern := range []string{"*.yml", "*.yaml"} {
+			matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+			for _, path := range matches {
+				root, standalone := readLintYAML(path)
+				if !standalone {
+					fragments = append(fragments, path)
+					continue
+				}
+				// Another config here may be what includes the fragments
+				watched := newWatchList()
+				if root != nil && expandIncludes(root, dir, watched) == nil {
+					markUsed(watched.paths)
+				}
+			}
+		}
+	}
+
+	var findings []Finding
+	for _, path := range fragments {
+		if abs, err := filepath.Abs(path); err == nil && !used[abs] {
+			findings = append(findings, Finding{
+				Route:   -1,
+				Source:  path,
+				Check:   LintUnusedInclude,
+				Message: "not included by any config in its directory",
+			})
+		}
+	}
+	return findings
+}
+
+// readLintYAML parses a YAML file and reports whether it is a config (it has a proxy
+// section) rather than an include fragment. Unreadable files count as configs so they
+// aren't flagged.
+func readLintYAML(path string) (*yaml.Node, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, true
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, false
+	}
+	var doc map[string]any
+	if root.Decode(&doc) != nil {
+		return &root, false
+	}
+	_, ok := doc["proxy"]
+	return &root, ok
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLintFindsMistakes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	os.WriteFile(path, []byte(`
+proxy:
+  listen: localhost:8081
+  target: http://localhost:8080
+  routes:
+    - name: everything
+      methods: .*
+      paths: .*
+      context: { overflow: truncate }
+    - name: chat
+      methods: POST
+      paths: ^/v1/chat/completions$
+      context: { overflow: reject }
+      on_request:
+        - when: { body: { options.temperature: "." } }
+          merge: { a: 1 }
+        - when: { headers: { Authorization: ".*" } }
+          merge: { auth: true }
+          stop: true
+        - merge: { b: 2 }
+        - merge: { c: 3 }
+          stop: true
+        - merge: { g: 7 }
+    - methods: GET
+      paths: [/v1/models, ^/v1/chat, ^/api/]
+      on_request:
+        - merge: { d: 4 }
+    - methods: PSOT
+      paths: ^/v1/embeddings$
+      on_request:
+        - merge: { e: 5 }
+      on_response:
+        - when: { not: {} }
+          merge: { f: 6 }
+`), 0o644)
+	cfg, _, err := Load([]string{path}, CliOverrides{})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	var got []string
+	for _, f := range Lint(cfg) {
+		got = append(got, f.Check+" "+f.Name+" "+f.Message)
+	}
+	want := []string{
+		`catch_all everything method pattern ".*" matches every method`,
+		`catch_all everything path pattern ".*" matches every path`,
+		`shadowed chat context never applies: route 0 sets context and matches every request this route does`,
+		`never_true chat on_request action 0 never runs: body key "options.temperature" is compared with top-level fields only, so dotted keys never match`,
+		`catch_all chat on_request action 1: headers.Authorization matches any value, so the when only checks that it is present`,
+		`never_true chat on_request action 4 never runs: action 3 always stops the route`,
+		`unanchored  path pattern "/v1/models" is unanchored and matches anywhere in the path (ex: /proxy/v1/models); start it with ^`,
+		`open_ended  path pattern "^/v1/chat" also matches longer paths (ex: /v1/chat-archive); end it with $ or /`,
+		`never_true  on_request actions never run: the route only matches GET requests, which have no body`,
+		`unmatched_route  methods PSOT match no HTTP method, so the route never runs`,
+		`never_true  on_response action 0 never runs: not negates a condition that always holds`,
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLintIncludesFlagsUnusedFragments(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0o644)
+		return path
+	}
+	fragment := "- methods: POST\n  paths: ^/x$\n  on_request:\n    - merge: { a: 1 }\n"
+	write("used.yml", fragment)
+	write("other-config-uses.yml", fragment)
+	write("stale.yml", fragment)
+	write("other.config.yml", "proxy:\n  listen: localhost:9\n  target: http://localhost:8\n  routes:\n    - include: other-config-uses.yml\n")
+	path := write("config.yml", "proxy:\n  listen: localhost:8081\n  target: http://localhost:8080\n  routes:\n    - include: used.yml\n")
+
+	_, loaded, err := Load([]string{path}, CliOverrides{})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	findings := LintIncludes([]string{path}, loaded)
+	if len(findings) != 1 || filepath.Base(findings[0].Source) != "stale.yml" || findings[0].Check != LintUnusedInclude {
+		t.Fatalf("findings = %+v, want only stale.yml", findings)
+	}
+}
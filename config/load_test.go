@@ -123,6 +123,88 @@ proxy:
 	}
 }
 
+func TestLoadTargetsList(t *testing.T) {
+	configContent := `
+proxy:
+  listen: "localhost:8081"
+  targets:
+    - "http://localhost:8080"
+    - "http://localhost:8082"
+    - "http://localhost:8080"
+  models:
+    aggregate: true
+    aliases:
+      gpt-4o: qwen3-32b
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      on_request:
+        - merge:
+            temperature: 0.7
+`
+	configPath := writeTempConfig(t, t.TempDir(), "targets.yml", configContent)
+	cfg, _, err := Load([]string{configPath}, CliOverrides{})
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	p := cfg.Proxies[0]
+
+	if p.Target != "http://localhost:8080" {
+		t.Errorf("Target = %v, want first entry of targets", p.Target)
+	}
+	if got := p.AllTargets(); len(got) != 2 || got[1] != "http://localhost:8082" {
+		t.Errorf("AllTargets() = %v, want two deduplicated targets", got)
+	}
+	if !p.Models.Aggregate {
+		t.Error("Models.Aggregate should be true")
+	}
+	if backend, ok := p.Models.ResolveAlias("gpt-4o"); !ok || backend != "qwen3-32b" {
+		t.Errorf("ResolveAlias(gpt-4o) = %v, %v", backend, ok)
+	}
+	if names := p.Models.PublishedNames("qwen3-32b"); len(names) != 1 || names[0] != "gpt-4o" {
+		t.Errorf("PublishedNames(qwen3-32b) = %v, want [gpt-4o]", names)
+	}
+}
+
+func TestLoadListenList(t *testing.T) {
+	configContent := `
+proxy:
+  listen: ["127.0.0.1:8081", "[::1]:8081", "unix:/run/proxy.sock"]
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      on_request:
+        - merge: { temperature: 0.7 }
+`
+	configPath := writeTempConfig(t, t.TempDir(), "listen.yml", configContent)
+	cfg, _, err := Load([]string{configPath}, CliOverrides{})
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	p := cfg.Proxies[0]
+	if p.Listen != "127.0.0.1:8081" || len(p.Listeners()) != 3 || p.Listeners()[2] != "unix:/run/proxy.sock" {
+		t.Errorf("Listeners() = %v, want the list with the first as listen", p.Listeners())
+	}
+	if len(p.Routes) != 1 || p.Routes[0].Source != configPath {
+		t.Errorf("routes = %+v, want the route with its source", p.Routes)
+	}
+
+	cfg, _, err = Load([]string{configPath}, CliOverrides{Listen: "localhost:9000"})
+	if err != nil {
+		t.Fatalf("Load() with -listen failed: %v", err)
+	}
+	if got := cfg.Proxies[0].Listeners(); len(got) != 1 || got[0] != "localhost:9000" {
+		t.Errorf("Listeners() = %v, want -listen to replace the list", got)
+	}
+
+	duplicate := strings.Replace(configContent, `"[::1]:8081"`, `"127.0.0.1:8081"`, 1)
+	configPath = writeTempConfig(t, t.TempDir(), "duplicate.yml", duplicate)
+	if _, _, err := Load([]string{configPath}, CliOverrides{}); err == nil || !strings.Contains(err.Error(), "127.0.0.1:8081 is duplicated") {
+		t.Errorf("Load() = %v, want a duplicate listener error", err)
+	}
+}
+
 func TestLoadWithAdditionalProxies(t *testing.T) {
 	configContent := `
 proxy:
@@ -408,6 +490,9 @@ proxy:
 	}
 
 	rulesConfig := `
+admin:
+  listen: "localhost:9090"
+  pprof: true
 proxy:
   listen: "localhost:8081"
   target: "http://localhost:4000"
@@ -443,6 +528,10 @@ proxy:
 	if cfg.Proxies[1].Routes[0].Methods.Patterns[0] != "POST" {
 		t.Errorf("Proxy1 Rules[0].Methods = %v, want POST", cfg.Proxies[1].Routes[0].Methods.Patterns[0])
 	}
+
+	if cfg.Admin.Listen != "localhost:9090" || !cfg.Admin.Pprof {
+		t.Errorf("Admin = %+v, want the later file's listen and pprof", cfg.Admin)
+	}
 }
 
 func TestLoadProxyMerge(t *testing.T) {
@@ -1078,6 +1167,55 @@ proxy:
 	}
 }
 
+func TestLoadTraceDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yml")
+	configContent := `
+proxy:
+  - listen: "localhost:9000"
+    target: "http://localhost:3000"
+    routes:
+      - methods: POST
+        paths: /v1/chat
+        trace: true
+  - listen: "localhost:9001"
+    target: "http://localhost:3001"
+    trace_dir: debug/traces
+    routes:
+      - methods: GET
+        paths: /v1/models
+        format: openai-to-ollama
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, _, err := Load([]string{configPath}, CliOverrides{})
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if got, want := cfg.Proxies[0].TraceDir, filepath.Join(tmpDir, DefaultTraceDir); got != want {
+		t.Errorf("default TraceDir = %s, want %s", got, want)
+	}
+	if got, want := cfg.Proxies[1].TraceDir, filepath.Join(tmpDir, "debug", "traces"); got != want {
+		t.Errorf("TraceDir = %s, want %s", got, want)
+	}
+	if !cfg.Proxies[0].Routes[0].Trace || cfg.Proxies[0].TraceAll {
+		t.Errorf("route trace = %v, TraceAll = %v, want only the route traced", cfg.Proxies[0].Routes[0].Trace, cfg.Proxies[0].TraceAll)
+	}
+
+	// -trace applies to every proxy, even with several configured
+	cfg, _, err = Load([]string{configPath}, CliOverrides{Trace: "/tmp/all-traces"})
+	if err != nil {
+		t.Fatalf("Load() with -trace failed: %v", err)
+	}
+	for i, proxy := range cfg.Proxies {
+		if !proxy.TraceAll || proxy.TraceDir != "/tmp/all-traces" {
+			t.Errorf("proxy %d: TraceAll = %v, TraceDir = %s, want every request traced to /tmp/all-traces", i, proxy.TraceAll, proxy.TraceDir)
+		}
+	}
+}
+
 func TestResolvePath(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LogRedactPlaceholder replaces redacted body fields in debug logs
+const LogRedactPlaceholder = "[REDACTED]"
+
+// LogRedact lists body fields hidden from debug logs. Paths are dotted keys, where [*]
+// selects every array element and [N] one (ex: messages[*].content, input).
+// A single string is shorthand for a one-item list.
+type LogRedact struct {
+	Paths    []string
+	compiled [][]redactStep
+}
+
+// redactStep is one key or array selector in a log_redact path
+type redactStep struct {
+	key   string
+	index int // -1 for every element
+	array bool
+}
+
+// UnmarshalYAML allows both string and []string
+func (l *LogRedact) UnmarshalYAML(unmarshal func(any) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		l.Paths = []string{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := unmarshal(&multiple); err == nil {
+		l.Paths = multiple
+		return nil
+	}
+
+	return fmt.Errorf("log_redact must be string or []string")
+}
+
+// Validate parses every path
+func (l *LogRedact) Validate() error {
+	l.compiled = make([][]redactStep, 0, len(l.Paths))
+	for _, path := range l.Paths {
+		steps, err := parseRedactPath(path)
+		if err != nil {
+			return fmt.Errorf("invalid path '%s': %w", path, err)
+		}
+		l.compiled = append(l.compiled, steps)
+	}
+	return nil
+}
+
+// parseRedactPath splits a path like messages[*].content into steps
+func parseRedactPath(path string) ([]redactStep, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path is empty")
+	}
+	var steps []redactStep
+	for _, part := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		if key == "" && len(steps) == 0 {
+			return nil, fmt.Errorf("path must start with a field name")
+		}
+		if key == "" && rest == "" {
+			return nil, fmt.Errorf("empty field name")
+		}
+		if key != "" {
+			steps = append(steps, redactStep{key: key})
+		}
+		for rest != "" {
+			selector, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("missing ]")
+			}
+			step := redactStep{index: -1, array: true}
+			if selector != "*" {
+				n, err := strconv.Atoi(selector)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("array selector must be * or an index, got [%s]", selector)
+				}
+				step.index = n
+			}
+			steps = append(steps, step)
+			if after == "" {
+				break
+			}
+			if !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("unexpected '%s' after ]", after)
+			}
+			rest = after[1:]
+		}
+	}
+	return steps, nil
+}
+
+// Apply replaces every configured field in data with LogRedactPlaceholder, editing it in
+// place, and reports whether anything was replaced. Missing fields are skipped.
+func (l LogRedact) Apply(data any) bool {
+	redacted := false
+	for _, steps := range l.compiled {
+		if redactAt(data, steps) {
+			redacted = true
+		}
+	}
+	return redacted
+}
+
+// RedactJSON returns body with the configured fields replaced. Bodies that are not JSON,
+// or contain none of the fields, are returned unchanged.
+func (l LogRedact) RedactJSON(body []byte) []byte {
+	if len(l.compiled) == 0 {
+		return body
+	}
+	// Numbers stay as written, so large IDs aren't rounded in logs
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var data any
+	if err := dec.Decode(&data); err != nil || dec.More() {
+		return body
+	}
+	if !l.Apply(data) {
+		return body
+	}
+	out, err := json.Marshal(data)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+func redactAt(value any, steps []redactStep) bool {
+	step, last := steps[0], len(steps) == 1
+	if !step.array {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return false
+		}
+		child, ok := obj[step.key]
+		if !ok {
+			return false
+		}
+		if last {
+			obj[step.key] = LogRedactPlaceholder
+			return true
+		}
+		return redactAt(child, steps[1:])
+	}
+
+	items, ok := value.([]any)
+	if !ok {
+		return false
+	}
+	redacted := false
+	for i := range items {
+		if step.index >= 0 && i != step.index {
+			continue
+		}
+		if last {
+			items[i] = LogRedactPlaceholder
+			redacted = true
+		} else if redactAt(items[i], steps[1:]) {
+			redacted = true
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLogRedactJSON(t *testing.T) {
+	redact := LogRedact{Paths: []string{"messages[*].content", "input", "tools[0].function.description", "absent.field"}}
+	if err := redact.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	body := `{"model":"m","id":12345678901234567890,"input":["a","b"],` +
+		`"messages":[{"role":"system","content":"secret"},{"role":"user","content":[{"type":"text","text":"hi"}]}],` +
+		`"tools":[{"function":{"description":"one"}},{"function":{"description":"two"}}]}`
+	got := string(redact.RedactJSON([]byte(body)))
+
+	for _, leaked := range []string{"secret", `"hi"`, `"one"`, `"a"`} {
+		if strings.Contains(got, leaked) {
+			t.Fatalf("%s not redacted: %s", leaked, got)
+		}
+	}
+	for _, kept := range []string{`"role":"system"`, `"two"`, `"model":"m"`, "12345678901234567890"} {
+		if !strings.Contains(got, kept) {
+			t.Fatalf("%s should be kept: %s", kept, got)
+		}
+	}
+
+	// Untouched and non-JSON bodies come back as they were
+	for _, body := range []string{`{ "model": "m" }`, "not json", `{"a":1} {"b":2}`} {
+		if got := string(redact.RedactJSON([]byte(body))); got != body {
+			t.Fatalf("RedactJSON(%q) = %q, want unchanged", body, got)
+		}
+	}
+}
+
+func TestLogRedactValidate(t *testing.T) {
+	for _, path := range []string{"", "[*].content", "messages[x]", "messages[*", "messages[0]x", "a..b", "messages[-1]"} {
+		redact := LogRedact{Paths: []string{path}}
+		if err := redact.Validate(); err == nil {
+			t.Errorf("expected error for path %q", path)
+		}
+	}
+	for _, path := range []string{"input", "messages[*].content", "a.b[2][*].c"} {
+		redact := LogRedact{Paths: []string{path}}
+		if err := redact.Validate(); err != nil {
+			t.Errorf("path %q: %v", path, err)
+		}
+	}
+}
+
+func TestLogRedactUnmarshal(t *testing.T) {
+	var single, list struct {
+		LogRedact LogRedact `yaml:"log_redact"`
+	}
+	if err := yaml.Unmarshal([]byte("log_redact: input"), &single); err != nil {
+		t.Fatalf("unmarshal string: %v", err)
+	}
+	if err := yaml.Unmarshal([]byte("log_redact:\n  - input\n  - messages[*].content\n"), &list); err != nil {
+		t.Fatalf("unmarshal list: %v", err)
+	}
+	if len(single.LogRedact.Paths) != 1 || len(list.LogRedact.Paths) != 2 || list.LogRedact.Paths[1] != "messages[*].content" {
+		t.Fatalf("paths = %v, %v", single.LogRedact.Paths, list.LogRedact.Paths)
+	}
+}
@@ -749,6 +749,51 @@ func TestActionWhenAnyWithComplexExpressions(t *testing.T) {
 	}
 }
 
+// TestBoolExprLowercaseHeaderMap tests that validated expressions find configured header
+// names in the lowercase maps the proxy builds, including inside nested operators
+func TestBoolExprLowercaseHeaderMap(t *testing.T) {
+	expr := &BoolExpr{
+		Headers: map[string]PatternField{"X-API-Version": {Patterns: []string{"^v2"}}},
+		Or: []BoolExpr{
+			{Headers: map[string]PatternField{"Authorization": {Patterns: []string{"Bearer"}}}},
+			{Body: map[string]PatternField{"max_tokens": {Patterns: []string{"^512$"}}}},
+		},
+	}
+	if err := expr.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	headers := map[string]string{"x-api-version": "v2", "authorization": "Bearer t"}
+	if !expr.Evaluate(map[string]any{}, headers, nil) {
+		t.Fatal("expected match with lowercase header names")
+	}
+
+	delete(headers, "authorization")
+	if expr.Evaluate(map[string]any{}, headers, nil) {
+		t.Fatal("expected no match without authorization or max_tokens")
+	}
+	if !expr.Evaluate(map[string]any{"max_tokens": 512.0}, headers, nil) {
+		t.Fatal("expected match on a numeric body field")
+	}
+}
+
+func BenchmarkBoolExprEvaluate(b *testing.B) {
+	expr := &BoolExpr{
+		Headers: map[string]PatternField{"Authorization": {Patterns: []string{"^Bearer"}}},
+		Body:    map[string]PatternField{"model": {Patterns: []string{"llama"}}},
+	}
+	if err := expr.Validate(); err != nil {
+		b.Fatal(err)
+	}
+	body := map[string]any{"model": "llama-3", "messages": []any{"hi"}, "temperature": 0.7, "stream": true}
+	headers := map[string]string{"authorization": "Bearer t", "content-type": "application/json", "accept": "*/*"}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		expr.Evaluate(body, headers, nil)
+	}
+}
+
 func containsString(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
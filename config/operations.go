@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"maps"
+	"slices"
 	"text/template"
 	"time"
 
@@ -19,6 +20,21 @@ type CompiledRoute struct {
 	OnResponse          []ActionExec
 	OnRequestTemplates  []*template.Template
 	OnResponseTemplates []*template.Template
+
+	// Prompts holds chat templates by backend model name; "" is the route default
+	Prompts map[string]*CompiledPrompt
+
+	// TargetPath renders a templated target_path; nil when the path is fixed
+	TargetPath *template.Template
+
+	// State is the route's key-value store; nil without state
+	State *StateStore
+}
+
+// CompiledPrompt is a parsed chat template with the stop strings it needs
+type CompiledPrompt struct {
+	Template *template.Template
+	Stop     []string
 }
 
 // ActionExec represents an action during execution (converted from Action)
@@ -28,102 +44,188 @@ type ActionExec struct {
 	Merge    map[string]any
 	Default  map[string]any
 	Delete   []string
+	ParamMap ParamMap
+	Preset   *CompiledPreset
+	StopNorm *StopNormalizer
+	Redact   *RedactPolicy
+	Seed     *SeedPolicy
+	Schema   *SchemaCheck
 	Stop     bool
+
+	FromRequest map[string]string
+
+	// Actions and their compiled templates, by index, for action groups
+	Actions   []ActionExec
+	Templates []*template.Template
+
+	// Else and its compiled templates run when When doesn't match
+	Else          []ActionExec
+	ElseTemplates []*template.Template
+}
+
+// branch returns what runs for op: op itself when its when matches, else a group of its
+// else actions. ok is false when nothing runs.
+func (op ActionExec) branch(tmpl *template.Template, data map[string]any, headers, query map[string]string, state *ActionState) (run ActionExec, runTmpl *template.Template, isElse, ok bool) {
+	if op.When == nil || op.When.match(matchInput{body: data, headers: headers, query: query, status: state.Status, request: state.Request, store: state.store}) {
+		return op, tmpl, false, true
+	}
+	if len(op.Else) == 0 {
+		return ActionExec{}, nil, false, false
+	}
+	return ActionExec{Actions: op.Else, Templates: op.ElseTemplates}, nil, true, true
+}
+
+// FiredAction records an action whose when condition matched
+type FiredAction struct {
+	Route   int      `json:"route"`
+	Phase   string   `json:"phase"` // request or response
+	Index   int      `json:"index"`
+	Else    bool     `json:"else,omitempty"`    // The action's else ran because its when didn't match
+	Changes []string `json:"changes,omitempty"` // Top-level keys the action set or deleted
+	Diff    []Change `json:"diff,omitempty"`    // Old and new values, when ActionState.Diffs is set
 }
 
 // ProcessRequest applies all request actions to data
 func ProcessRequest(data map[string]any, headers map[string]string, query map[string]string, route *CompiledRoute, ruleIndex int, method, path string) (bool, map[string]any) {
-	return processActions("request", data, headers, query, ruleIndex, method, path, route.OnRequest, route.OnRequestTemplates)
+	return processActions("request", data, headers, query, ruleIndex, method, path, route.OnRequest, route.OnRequestTemplates, &ActionState{store: route.State})
+}
+
+// ProcessRequestWithState is ProcessRequest with state shared across routes and kept for
+// the response (ex: redacted text to restore)
+func ProcessRequestWithState(data map[string]any, headers map[string]string, query map[string]string, route *CompiledRoute, ruleIndex int, method, path string, state *ActionState) (bool, map[string]any) {
+	state.store = route.State
+	return processActions("request", data, headers, query, ruleIndex, method, path, route.OnRequest, route.OnRequestTemplates, state)
 }
 
 // ProcessResponse applies all response actions to data
 func ProcessResponse(data map[string]any, headers map[string]string, query map[string]string, route *CompiledRoute, ruleIndex int, method, path string) (bool, map[string]any) {
-	return processActions("response", data, headers, query, ruleIndex, method, path, route.OnResponse, route.OnResponseTemplates)
+	return processActions("response", data, headers, query, ruleIndex, method, path, route.OnResponse, route.OnResponseTemplates, &ActionState{store: route.State})
+}
+
+// ProcessResponseWithState is ProcessResponse recording fired actions in state
+func ProcessResponseWithState(data map[string]any, headers map[string]string, query map[string]string, route *CompiledRoute, ruleIndex int, method, path string, state *ActionState) (bool, map[string]any) {
+	state.store = route.State
+	return processActions("response", data, headers, query, ruleIndex, method, path, route.OnResponse, route.OnResponseTemplates, state)
 }
 
 // processActions applies actions to data with their compiled templates
-func processActions(phase string, data map[string]any, headers map[string]string, query map[string]string, ruleIndex int, method, path string, operations []ActionExec, templates []*template.Template) (bool, map[string]any) {
+func processActions(phase string, data map[string]any, headers map[string]string, query map[string]string, ruleIndex int, method, path string, operations []ActionExec, templates []*template.Template, state *ActionState) (bool, map[string]any) {
 	appliedValues := make(map[string]any)
 	anyApplied := false
-	addedKeys := make([]string, 0)
-	updatedKeys := make([]string, 0)
-	deletedKeys := make([]string, 0)
 	opExecuted := 0
+	recordDiffs := state.Diffs || logger.IsDebug()
+	var routeDiff []Change
 
 	for i, op := range operations {
-		// Check if action's when condition matches
-		if op.When != nil && !op.When.Evaluate(data, headers, query) {
+		// Check if action's when condition matches, falling back to its else
+		run, tmpl, isElse, ok := op.branch(templateAt(templates, i), data, headers, query, state)
+		if !ok {
 			continue
 		}
 
-		// Capture values before for diff
-		beforeValues := make(map[string]any)
-		for k, v := range data {
-			beforeValues[k] = v
+		// Snapshot the body for the diff; actions edit nested values in place
+		var before map[string]any
+		if recordDiffs {
+			before = cloneJSON(data).(map[string]any)
 		}
 
 		// Track changes for this specific operation
 		opChanges := make(map[string]any)
-
-		// Execute template if present
-		if op.Template != "" && templates[i] != nil {
-			if ExecuteTemplate(templates[i], data, data, phase, ruleIndex, i, method, path) {
-				maps.Copy(appliedValues, data)
-				maps.Copy(opChanges, data)
-				anyApplied = true
-			}
-		}
-
-		// Apply other operations
-		if len(op.Default) > 0 {
-			applyDefault(data, op.Default, opChanges)
-			for k, v := range opChanges {
-				appliedValues[k] = v
-			}
-		}
-		if len(op.Merge) > 0 {
-			applyMerge(data, op.Merge, opChanges)
-			for k, v := range opChanges {
-				appliedValues[k] = v
-			}
-		}
-		if len(op.Delete) > 0 {
-			applyDelete(data, op.Delete, opChanges)
-			for k, v := range opChanges {
-				appliedValues[k] = v
-			}
-		}
+		applied, stop := applyAction(phase, data, headers, query, ruleIndex, i, method, path, run, tmpl, state, opChanges)
+		maps.Copy(appliedValues, opChanges)
+		anyApplied = anyApplied || applied
 
 		opExecuted++
-		// Show changes if any
+		fired := FiredAction{Route: ruleIndex, Phase: phase, Index: i, Else: isElse, Changes: slices.Sorted(maps.Keys(opChanges))}
 		if len(opChanges) > 0 {
 			anyApplied = true
-
-			for key, newValue := range opChanges {
-				if newValue == "<deleted>" {
-					deletedKeys = append(deletedKeys, key)
-				} else if oldValue, existed := beforeValues[key]; existed {
-					_ = oldValue
-					updatedKeys = append(updatedKeys, key)
-				} else {
-					addedKeys = append(addedKeys, key)
-				}
+			if recordDiffs {
+				fired.Diff = Diff(before, data)
+				routeDiff = append(routeDiff, fired.Diff...)
 			}
 		}
+		state.Fired = append(state.Fired, fired)
 
-		if op.Stop {
+		if stop {
 			logger.Debug("Action stop flag set", "index", i)
 			break
 		}
 	}
 
-	if anyApplied {
-		logger.Debug("Route applied request changes", "index", ruleIndex, "ops_run", opExecuted, "added", addedKeys, "updated", updatedKeys, "deleted", deletedKeys)
+	if anyApplied && logger.IsDebug() {
+		diffJSON, _ := json.Marshal(routeDiff)
+		logger.Debug("Route applied changes", "index", ruleIndex, "phase", phase, "ops_run", opExecuted, "diff", string(diffJSON))
 	}
 
 	return anyApplied, appliedValues
 }
 
+// applyAction runs one action whose when matched, recording what it set in opChanges. A
+// group runs its actions in order, each checked against its own when. stop reports a stop
+// flag, which ends the route's actions from inside a group too.
+func applyAction(phase string, data map[string]any, headers map[string]string, query map[string]string, ruleIndex, opIndex int, method, path string, op ActionExec, tmpl *template.Template, state *ActionState, opChanges map[string]any) (applied, stop bool) {
+	// Execute template if present
+	if op.Template != "" && tmpl != nil {
+		if ExecuteTemplate(tmpl, data, data, phase, ruleIndex, opIndex, method, path) {
+			maps.Copy(opChanges, data)
+			applied = true
+		}
+	}
+
+	// Apply other operations
+	if op.Preset != nil {
+		applyPreset(data, op.Preset, opChanges)
+	}
+	if !op.ParamMap.IsZero() {
+		applyParamMap(data, op.ParamMap, opChanges)
+	}
+	if op.Redact != nil {
+		applyRedact(data, op.Redact, state, opChanges)
+	}
+	if op.StopNorm != nil {
+		applyStopNormalizer(data, op.StopNorm, opChanges)
+	}
+	if op.Seed != nil {
+		applySeed(data, op.Seed, headers, state, opChanges)
+	}
+	if op.Schema != nil {
+		applySchemaCheck(data, op.Schema, state)
+	}
+	if len(op.Default) > 0 {
+		applyDefault(data, op.Default, opChanges)
+	}
+	if len(op.Merge) > 0 {
+		applyMerge(data, op.Merge, opChanges)
+	}
+	if len(op.FromRequest) > 0 {
+		applyFromRequest(data, op.FromRequest, state.Request, opChanges)
+	}
+	if len(op.Delete) > 0 {
+		applyDelete(data, op.Delete, opChanges)
+	}
+
+	for j, child := range op.Actions {
+		run, tmpl, _, ok := child.branch(templateAt(op.Templates, j), data, headers, query, state)
+		if !ok {
+			continue
+		}
+		childApplied, childStop := applyAction(phase, data, headers, query, ruleIndex, opIndex, method, path, run, tmpl, state, opChanges)
+		applied = applied || childApplied
+		if childStop {
+			return applied, true
+		}
+	}
+	return applied, op.Stop
+}
+
+// templateAt returns the compiled template for action i, if any
+func templateAt(templates []*template.Template, i int) *template.Template {
+	if i < len(templates) {
+		return templates[i]
+	}
+	return nil
+}
+
 func applyMerge(data map[string]any, mergeValues map[string]any, appliedValues map[string]any) {
 	for key, value := range mergeValues {
 		data[key] = value
@@ -302,6 +404,9 @@ func toInt(v any) (int, bool) {
 		return int(n), true
 	case float64:
 		return int(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err == nil
 	case string:
 		// Try to parse string as int
 		var i int
@@ -323,6 +428,9 @@ func toNumber(v any) float64 {
 		return n
 	case float32:
 		return float64(n)
+	case json.Number:
+		f, _ := n.Float64()
+		return f
 	case string:
 		var f float64
 		if _, err := fmt.Sscanf(n, "%f", &f); err == nil {
@@ -345,7 +453,7 @@ func checkKind(kind string, value any) bool {
 		return ok
 	case "number", "float", "int":
 		switch value.(type) {
-		case int, int64, float64, float32:
+		case int, int64, float64, float32, json.Number:
 			return true
 		}
 		return false
@@ -1,6 +1,10 @@
 package config
 
-import "testing"
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestProcessActionsMatchHeadersDeleteAndStop(t *testing.T) {
 	envPattern := PatternField{Patterns: []string{"prod"}}
@@ -44,7 +48,7 @@ func TestProcessActionsMatchHeadersDeleteAndStop(t *testing.T) {
 		"remove_me": "y",
 	}
 
-	modified, applied := processActions("test", body, headers, query, 0, "", "", ops, nil)
+	modified, applied := processActions("test", body, headers, query, 0, "", "", ops, nil, &ActionState{})
 	if !modified {
 		t.Fatal("expected modifications to be applied")
 	}
@@ -149,3 +153,140 @@ func TestDictHelperOddArgs(t *testing.T) {
 		t.Fatalf("expected empty map on odd args, got %v", result)
 	}
 }
+
+func TestProcessActionsGroupSharesWhen(t *testing.T) {
+	qwen := PatternField{Patterns: []string{"^qwen"}}
+	if err := qwen.Validate(); err != nil {
+		t.Fatalf("failed to compile model pattern: %v", err)
+	}
+	streaming := PatternField{Patterns: []string{"true"}}
+	if err := streaming.Validate(); err != nil {
+		t.Fatalf("failed to compile stream pattern: %v", err)
+	}
+
+	ops := []ActionExec{
+		{
+			When: &BoolExpr{Body: map[string]PatternField{"model": qwen}},
+			Actions: []ActionExec{
+				// Renaming the model doesn't stop the rest of the group: its when was checked once
+				{Merge: map[string]any{"model": "llama3"}},
+				{Default: map[string]any{"top_k": 20}},
+				{When: &BoolExpr{Body: map[string]PatternField{"stream": streaming}}, Merge: map[string]any{"streamed": true}},
+				{Merge: map[string]any{"stopped": true}, Stop: true},
+				{Merge: map[string]any{"after_stop": true}},
+			},
+		},
+		{Merge: map[string]any{"next_action": true}},
+	}
+
+	body := map[string]any{"model": "qwen3"}
+	state := &ActionState{}
+	processActions("request", body, map[string]string{}, map[string]string{}, 0, "", "", ops, nil, state)
+
+	if body["model"] != "llama3" || body["top_k"] != 20 || body["stopped"] != true {
+		t.Fatalf("group actions should all run, body = %v", body)
+	}
+	if _, ok := body["streamed"]; ok {
+		t.Fatal("a group's action with its own when should still check it")
+	}
+	if _, ok := body["after_stop"]; ok {
+		t.Fatal("stop inside a group should end the group")
+	}
+	if _, ok := body["next_action"]; ok {
+		t.Fatal("stop inside a group should end the route's actions")
+	}
+	if len(state.Fired) != 1 || len(state.Fired[0].Changes) != 3 {
+		t.Fatalf("fired = %+v, want the group recorded once with its changes", state.Fired)
+	}
+}
+
+func TestProcessActionsElse(t *testing.T) {
+	qwen := PatternField{Patterns: []string{"^qwen"}}
+	if err := qwen.Validate(); err != nil {
+		t.Fatalf("failed to compile model pattern: %v", err)
+	}
+
+	ops := []ActionExec{
+		{
+			When:  &BoolExpr{Body: map[string]PatternField{"model": qwen}},
+			Merge: map[string]any{"top_k": 20},
+			Stop:  true,
+			Else: []ActionExec{
+				{Merge: map[string]any{"top_k": 40}},
+				{Delete: []string{"min_p"}},
+			},
+		},
+		{Merge: map[string]any{"after": true}},
+	}
+
+	body := map[string]any{"model": "llama3", "min_p": 0.1}
+	state := &ActionState{}
+	processActions("request", body, map[string]string{}, map[string]string{}, 0, "", "", ops, nil, state)
+
+	if body["top_k"] != 40 || body["after"] != true {
+		t.Fatalf("else should run and the action's stop shouldn't, body = %v", body)
+	}
+	if _, ok := body["min_p"]; ok {
+		t.Fatal("every else action should run")
+	}
+	if len(state.Fired) != 2 || !state.Fired[0].Else || state.Fired[1].Else {
+		t.Fatalf("fired = %+v, want the else branch marked", state.Fired)
+	}
+
+	body = map[string]any{"model": "qwen3", "min_p": 0.1}
+	processActions("request", body, map[string]string{}, map[string]string{}, 0, "", "", ops, nil, &ActionState{})
+	if body["top_k"] != 20 || body["min_p"] != 0.1 {
+		t.Fatalf("a matching when shouldn't run else, body = %v", body)
+	}
+	if _, ok := body["after"]; ok {
+		t.Fatal("a matching action's stop should still apply")
+	}
+}
+
+func TestProcessResponseMatchesStatus(t *testing.T) {
+	cfg := mustParseConfig(t, `
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      on_response:
+        - when: { status: "5.." }
+          merge: { retry_after: 5 }
+        - when: { not: { status: "^2" } }
+          default: { failed: true }
+`)
+	compiled := cfg.Proxies[0].Routes[0].Compiled
+
+	tests := []struct {
+		status int
+		want   map[string]any
+	}{
+		{200, map[string]any{}},
+		{429, map[string]any{"failed": true}},
+		{503, map[string]any{"retry_after": 5, "failed": true}},
+	}
+	for _, tt := range tests {
+		body := map[string]any{}
+		ProcessResponseWithState(body, nil, nil, compiled, 0, "POST", "/v1/chat", &ActionState{Status: tt.status})
+		if !reflect.DeepEqual(body, tt.want) {
+			t.Errorf("status %d: body = %v, want %v", tt.status, body, tt.want)
+		}
+	}
+
+	_, err := parseConfig(t, `
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      on_request:
+        - when: { status: "5.." }
+          merge: { retry_after: 5 }
+`)
+	if err == nil || !strings.Contains(err.Error(), "route 0 on_request 0 when: status matches responses only") {
+		t.Fatalf("err = %v, want status rejected in on_request", err)
+	}
+}
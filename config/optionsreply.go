@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// OptionsReply answers OPTIONS requests without the backend, as for CORS preflights or
+// clients probing which methods a path allows
+type OptionsReply struct {
+	Status  int               `yaml:"status,omitempty"`  // 2xx status; defaults to 204
+	Headers map[string]string `yaml:"headers,omitempty"` // ex: Allow, Access-Control-Allow-Origin
+}
+
+// Validate normalizes the default status
+func (o *OptionsReply) Validate() error {
+	if o.Status == 0 {
+		o.Status = http.StatusNoContent
+	}
+	if o.Status < 200 || o.Status > 299 {
+		return fmt.Errorf("status must be a 2xx code")
+	}
+	for name := range o.Headers {
+		if http.CanonicalHeaderKey(name) == "Content-Length" {
+			return fmt.Errorf("headers: Content-Length is set by the proxy")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// OutboundProxy sends upstream calls through an HTTP or SOCKS5 proxy, for targets only
+// reachable through a bastion. https:// targets are tunneled with CONNECT.
+type OutboundProxy struct {
+	URL     string   `yaml:"url"`                // http://, https://, socks5://, or socks5h:// (both resolve DNS at the proxy); credentials go in user:pass@
+	NoProxy []string `yaml:"no_proxy,omitempty"` // Targets dialed directly: hostnames (with their subdomains), IPs, CIDRs, optional :port, or *
+
+	proxyURL *url.URL
+}
+
+// Validate parses the proxy URL and no_proxy entries
+func (o *OutboundProxy) Validate() error {
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("url scheme must be http, https, socks5, or socks5h")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url requires a host")
+	}
+	for _, entry := range o.NoProxy {
+		if entry == "" {
+			return fmt.Errorf("no_proxy entries must be non-empty")
+		}
+		if strings.Contains(entry, "/") {
+			if _, err := netip.ParsePrefix(entry); err != nil {
+				return fmt.Errorf("invalid no_proxy CIDR %q", entry)
+			}
+		}
+	}
+	o.proxyURL = u
+	return nil
+}
+
+// Proxy picks the proxy for an upstream request, or none for no_proxy hosts. It fits
+// http.Transport.Proxy.
+func (o *OutboundProxy) Proxy(req *http.Request) (*url.URL, error) {
+	if o.Bypasses(req.URL) {
+		return nil, nil
+	}
+	return o.proxyURL, nil
+}
+
+// Forwards reports whether requests to target reach the proxy as absolute URIs rather than
+// through a tunnel: plain http:// targets behind an HTTP proxy
+func (o *OutboundProxy) Forwards(target *url.URL) bool {
+	return target.Scheme == "http" && (o.proxyURL.Scheme == "http" || o.proxyURL.Scheme == "https") && !o.Bypasses(target)
+}
+
+// Bypasses reports whether target matches a no_proxy entry
+func (o *OutboundProxy) Bypasses(target *url.URL) bool {
+	host := strings.ToLower(target.Hostname())
+	port := target.Port()
+	if port == "" {
+		port = "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+	}
+	ip, ipErr := netip.ParseAddr(host)
+
+	for _, entry := range o.NoProxy {
+		entry = strings.ToLower(entry)
+		if entry == "*" {
+			return true
+		}
+		if strings.Contains(entry, "/") {
+			if prefix, err := netip.ParsePrefix(entry); err == nil && ipErr == nil && prefix.Contains(ip.Unmap()) {
+				return true
+			}
+			continue
+		}
+		name, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			name, entryPort = h, p
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		name = strings.Trim(name, "[]")
+		if entryIP, err := netip.ParseAddr(name); err == nil {
+			if ipErr == nil && entryIP.Unmap() == ip.Unmap() {
+				return true
+			}
+			continue
+		}
+		name = strings.TrimPrefix(name, ".")
+		if host == name || strings.HasSuffix(host, "."+name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestOutboundProxyBypasses(t *testing.T) {
+	o := &OutboundProxy{NoProxy: []string{"localhost", ".internal", "10.0.0.0/8", "::1", "gpu.lan:8443"}}
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"http://localhost:8080", true},
+		{"http://api.internal", true},
+		{"http://internal", true},
+		{"http://notinternal", false},
+		{"http://10.1.2.3:8080", true},
+		{"http://11.0.0.1", false},
+		{"http://[::1]:8080", true},
+		{"https://gpu.lan:8443", true},
+		{"http://gpu.lan:8080", false},
+		{"https://api.example.com", false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.target)
+		if got := o.Bypasses(u); got != tt.want {
+			t.Errorf("Bypasses(%s) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+
+	all := &OutboundProxy{NoProxy: []string{"*"}}
+	if u, _ := url.Parse("http://anything"); !all.Bypasses(u) {
+		t.Error("no_proxy * should bypass every target")
+	}
+}
+
+func TestOutboundProxyValidate(t *testing.T) {
+	_, err := parseConfig(t, `
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  outbound_proxy: { url: "ftp://bastion:21" }
+  routes:
+    - methods: GET
+      paths: /v1/models
+      on_request:
+        - merge: { ok: true }
+`)
+	if err == nil || err.Error() != "proxy[0].outbound_proxy: url scheme must be http, https, socks5, or socks5h" {
+		t.Fatalf("err = %v, want an invalid scheme error", err)
+	}
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ParamMap moves request parameters between dialects: either a built-in table name
+// (ex: openai-to-ollama) or a mapping of source -> destination keys. Dotted keys address
+// nested objects (ex: options.num_predict).
+type ParamMap struct {
+	Table string
+	Pairs map[string]string
+}
+
+// UnmarshalYAML accepts a table name or a mapping
+func (p *ParamMap) UnmarshalYAML(unmarshal func(any) error) error {
+	var table string
+	if err := unmarshal(&table); err == nil {
+		p.Table = table
+		return nil
+	}
+
+	var pairs map[string]string
+	if err := unmarshal(&pairs); err == nil {
+		p.Pairs = pairs
+		return nil
+	}
+
+	return fmt.Errorf("param_map must be a table name or a mapping")
+}
+
+// IsZero reports whether no mapping is configured
+func (p ParamMap) IsZero() bool {
+	return p.Table == "" && len(p.Pairs) == 0
+}
+
+// Validate checks that a named table exists
+func (p ParamMap) Validate() error {
+	if p.Table != "" && paramTables[p.Table] == nil {
+		return fmt.Errorf("unknown param_map table '%s' (available: %s)", p.Table, strings.Join(ParamTableNames(), ", "))
+	}
+	for from, to := range p.Pairs {
+		if from == "" || to == "" {
+			return fmt.Errorf("param_map keys must be non-empty")
+		}
+	}
+	return nil
+}
+
+// paramRule moves one parameter, optionally converting numeric values
+type paramRule struct {
+	from, to string
+	convert  func(float64) float64
+}
+
+// OpenAI's frequency_penalty is additive (0 = off); repeat_penalty is multiplicative (1 = off)
+func frequencyToRepeat(v float64) float64 { return 1 + v }
+func repeatToFrequency(v float64) float64 { return v - 1 }
+
+// ollamaOptions are the sampling params Ollama reads from options
+var ollamaOptions = []string{"temperature", "top_p", "top_k", "min_p", "seed", "stop", "presence_penalty", "repeat_penalty"}
+
+func ollamaRules(toOllama bool) []paramRule {
+	rules := []paramRule{
+		{from: "max_completion_tokens", to: "options.num_predict"},
+		{from: "max_tokens", to: "options.num_predict"},
+		{from: "frequency_penalty", to: "options.repeat_penalty", convert: frequencyToRepeat},
+	}
+	for _, key := range ollamaOptions {
+		rules = append(rules, paramRule{from: key, to: "options." + key})
+	}
+	if toOllama {
+		return rules
+	}
+
+	reversed := []paramRule{
+		{from: "options.num_predict", to: "max_tokens"},
+		{from: "options.repeat_penalty", to: "frequency_penalty", convert: repeatToFrequency},
+	}
+	for _, key := range ollamaOptions {
+		if key != "repeat_penalty" {
+			reversed = append(reversed, paramRule{from: "options." + key, to: key})
+		}
+	}
+	return reversed
+}
+
+// paramTables are the built-in param_map tables
+var paramTables = map[string][]paramRule{
+	"openai-to-llama.cpp": {
+		{from: "max_completion_tokens", to: "n_predict"},
+		{from: "max_tokens", to: "n_predict"},
+		{from: "frequency_penalty", to: "repeat_penalty", convert: frequencyToRepeat},
+	},
+	"llama.cpp-to-openai": {
+		{from: "n_predict", to: "max_tokens"},
+		{from: "repeat_penalty", to: "frequency_penalty", convert: repeatToFrequency},
+	},
+	"openai-to-ollama": ollamaRules(true),
+	"ollama-to-openai": ollamaRules(false),
+}
+
+// ParamTableNames returns the built-in param_map tables in sorted order
+func ParamTableNames() []string {
+	return slices.Sorted(maps.Keys(paramTables))
+}
+
+func (p ParamMap) rules() []paramRule {
+	if p.Table != "" {
+		return paramTables[p.Table]
+	}
+	rules := make([]paramRule, 0, len(p.Pairs))
+	for _, from := range slices.Sorted(maps.Keys(p.Pairs)) {
+		rules = append(rules, paramRule{from: from, to: p.Pairs[from]})
+	}
+	return rules
+}
+
+// applyParamMap moves mapped parameters in data. A destination that is already set wins,
+// and the source is dropped either way. Changed top-level keys are recorded in appliedValues.
+func applyParamMap(data map[string]any, p ParamMap, appliedValues map[string]any) {
+	for _, rule := range p.rules() {
+		value, ok := takePath(data, rule.from)
+		if !ok {
+			continue
+		}
+		appliedValues[topKey(rule.from)] = "<deleted>"
+		if _, exists := lookupPath(data, rule.to); exists {
+			continue
+		}
+		if n, isNumber := value.(float64); isNumber && rule.convert != nil {
+			value = rule.convert(n)
+		}
+		setPath(data, rule.to, value)
+		appliedValues[topKey(rule.to)] = data[topKey(rule.to)]
+	}
+}
+
+func topKey(path string) string {
+	key, _, _ := strings.Cut(path, ".")
+	return key
+}
+
+func lookupPath(data map[string]any, path string) (any, bool) {
+	parts := strings.Split(path, ".")
+	current := data
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	v, ok := current[parts[len(parts)-1]]
+	return v, ok
+}
+
+// takePath removes and returns the value at path, dropping parent objects left empty
+func takePath(data map[string]any, path string) (any, bool) {
+	parent, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		v, ok := data[path]
+		delete(data, path)
+		return v, ok
+	}
+	child, ok := data[parent].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	v, ok := takePath(child, rest)
+	if len(child) == 0 {
+		delete(data, parent)
+	}
+	return v, ok
+}
+
+func setPath(data map[string]any, path string, value any) {
+	parent, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		data[path] = value
+		return
+	}
+	child, ok := data[parent].(map[string]any)
+	if !ok {
+		child = make(map[string]any)
+		data[parent] = child
+	}
+	setPath(child, rest, value)
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyParamMapOpenAIToOllama(t *testing.T) {
+	data := map[string]any{
+		"model":             "llama3",
+		"max_tokens":        256.0,
+		"frequency_penalty": 0.1,
+		"temperature":       0.7,
+		"options":           map[string]any{"temperature": 0.2},
+	}
+	applied := map[string]any{}
+	applyParamMap(data, ParamMap{Table: "openai-to-ollama"}, applied)
+
+	want := map[string]any{
+		"model": "llama3",
+		"options": map[string]any{
+			"num_predict":    256.0,
+			"repeat_penalty": 1.1,
+			"temperature":    0.2, // Existing destination wins
+		},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("data = %#v, want %#v", data, want)
+	}
+	if applied["max_tokens"] != "<deleted>" || applied["options"] == nil {
+		t.Errorf("applied = %#v, want max_tokens deleted and options set", applied)
+	}
+}
+
+func TestApplyParamMapOllamaToOpenAIDropsEmptyOptions(t *testing.T) {
+	data := map[string]any{
+		"options": map[string]any{"num_predict": 64.0, "repeat_penalty": 1.25, "top_k": 40.0},
+	}
+	applyParamMap(data, ParamMap{Table: "ollama-to-openai"}, map[string]any{})
+
+	want := map[string]any{"max_tokens": 64.0, "frequency_penalty": 0.25, "top_k": 40.0}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("data = %#v, want %#v", data, want)
+	}
+}
+
+func TestParamMapCustomPairs(t *testing.T) {
+	cfg := mustParseConfig(t, `
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /api/generate
+      on_request:
+        - param_map:
+            max_tokens: options.num_ctx_predict
+            seed: options.seed
+`)
+	route := cfg.Proxies[0].Routes[0]
+	data := map[string]any{"max_tokens": 10.0, "seed": 3.0}
+	ProcessRequest(data, nil, nil, route.Compiled, 0, "POST", "/api/generate")
+
+	want := map[string]any{"options": map[string]any{"num_ctx_predict": 10.0, "seed": 3.0}}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("data = %#v, want %#v", data, want)
+	}
+}
+
+func TestParamMapUnknownTable(t *testing.T) {
+	_, err := parseConfig(t, `
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      on_request:
+        - param_map: openai-to-nowhere
+`)
+	if err == nil || !strings.Contains(err.Error(), "unknown param_map table") {
+		t.Fatalf("err = %v, want unknown param_map table", err)
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// PathNormalization rewrites request paths before routes match them, so client quirks like
+// doubled or trailing slashes don't make rules miss. The backend still gets the path as
+// sent, unless a route's target_path rewrites it.
+type PathNormalization struct {
+	CollapseSlashes bool   `yaml:"collapse_slashes,omitempty"` // "//" becomes "/"
+	Decode          bool   `yaml:"decode,omitempty"`           // Unescape %-encoding left after the server's own decoding (ex: %252F from double-encoding clients)
+	TrailingSlash   string `yaml:"trailing_slash,omitempty"`   // strip or add a trailing "/"; the root path is kept
+}
+
+// trailing_slash modes
+const (
+	TrailingSlashStrip = "strip"
+	TrailingSlashAdd   = "add"
+)
+
+// Validate checks the trailing slash mode
+func (n *PathNormalization) Validate() error {
+	switch n.TrailingSlash {
+	case "", TrailingSlashStrip, TrailingSlashAdd:
+		return nil
+	}
+	return fmt.Errorf("trailing_slash must be %s or %s", TrailingSlashStrip, TrailingSlashAdd)
+}
+
+// Apply returns path as routes match it. A nil normalization returns path unchanged.
+func (n *PathNormalization) Apply(path string) string {
+	if n == nil {
+		return path
+	}
+	if n.Decode {
+		if decoded, err := url.PathUnescape(path); err == nil {
+			path = decoded
+		}
+	}
+	if n.CollapseSlashes {
+		for strings.Contains(path, "//") {
+			path = strings.ReplaceAll(path, "//", "/")
+		}
+	}
+	switch n.TrailingSlash {
+	case TrailingSlashStrip:
+		if trimmed := strings.TrimRight(path, "/"); trimmed != "" {
+			path = trimmed
+		} else {
+			path = "/"
+		}
+	case TrailingSlashAdd:
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+	}
+	return path
+}
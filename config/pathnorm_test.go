@@ -0,0 +1,46 @@
+package config
+
+import "testing"
+
+func TestPathNormalizationApply(t *testing.T) {
+	tests := []struct {
+		name string
+		norm *PathNormalization
+		path string
+		want string
+	}{
+		{name: "unset", path: "//v1/models/", want: "//v1/models/"},
+		{name: "collapse slashes", norm: &PathNormalization{CollapseSlashes: true}, path: "///v1//models", want: "/v1/models"},
+		{name: "decode", norm: &PathNormalization{Decode: true}, path: "/v1/chat%2Fcompletions", want: "/v1/chat/completions"},
+		{name: "invalid escape kept", norm: &PathNormalization{Decode: true}, path: "/v1/100%", want: "/v1/100%"},
+		{name: "decode then collapse", norm: &PathNormalization{Decode: true, CollapseSlashes: true}, path: "/v1/%2Fmodels", want: "/v1/models"},
+		{name: "strip trailing slash", norm: &PathNormalization{TrailingSlash: TrailingSlashStrip}, path: "/v1/models//", want: "/v1/models"},
+		{name: "strip keeps root", norm: &PathNormalization{TrailingSlash: TrailingSlashStrip}, path: "/", want: "/"},
+		{name: "add trailing slash", norm: &PathNormalization{TrailingSlash: TrailingSlashAdd}, path: "/v1/models", want: "/v1/models/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.norm.Apply(tt.path); got != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathNormalizationValidate(t *testing.T) {
+	_, err := parseConfig(t, `
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  normalize_paths: { trailing_slash: remove }
+  routes:
+    - methods: GET
+      paths: /v1/models
+      on_request:
+        - merge: { ok: true }
+`)
+	if err == nil || err.Error() != "proxy[0].normalize_paths: trailing_slash must be strip or add" {
+		t.Fatalf("err = %v, want an invalid trailing_slash error", err)
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import "fmt"
+
+// Preset modes
+const (
+	PresetDefault = "default" // Fill params the client didn't send
+	PresetMerge   = "merge"   // Override the client's params
+)
+
+// PresetSelector picks a named preset for a request: the first models entry matching the
+// request's model, otherwise Preset. A bare string is shorthand for { preset: <name> }.
+type PresetSelector struct {
+	Preset string        `yaml:"preset,omitempty"`
+	Models []PresetMatch `yaml:"models,omitempty"` // Checked in order
+	Mode   string        `yaml:"mode,omitempty"`   // default (default) or merge
+}
+
+// PresetMatch selects a preset for models matching a pattern
+type PresetMatch struct {
+	Model  PatternField `yaml:"model"`
+	Preset string       `yaml:"preset"`
+}
+
+// UnmarshalYAML accepts a preset name or a selector mapping
+func (p *PresetSelector) UnmarshalYAML(unmarshal func(any) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		p.Preset = name
+		return nil
+	}
+
+	type plain PresetSelector
+	return unmarshal((*plain)(p))
+}
+
+// Validate compiles model patterns and checks that every referenced preset exists
+func (p *PresetSelector) Validate(presets map[string]map[string]any) error {
+	switch p.Mode {
+	case "":
+		p.Mode = PresetDefault
+	case PresetDefault, PresetMerge:
+	default:
+		return fmt.Errorf("apply_preset mode must be %s or %s", PresetDefault, PresetMerge)
+	}
+	if p.Preset == "" && len(p.Models) == 0 {
+		return fmt.Errorf("apply_preset requires a preset or models")
+	}
+
+	names := []string{p.Preset}
+	for i := range p.Models {
+		if err := p.Models[i].Model.Validate(); err != nil {
+			return fmt.Errorf("apply_preset models[%d]: %w", i, err)
+		}
+		if p.Models[i].Model.Len() == 0 || p.Models[i].Preset == "" {
+			return fmt.Errorf("apply_preset models[%d]: model and preset are required", i)
+		}
+		names = append(names, p.Models[i].Preset)
+	}
+	for _, name := range names {
+		if _, ok := presets[name]; name != "" && !ok {
+			return fmt.Errorf("apply_preset: unknown preset '%s'", name)
+		}
+	}
+	return nil
+}
+
+// CompiledPreset is a preset selector with preset names resolved to their params
+type CompiledPreset struct {
+	Params map[string]any // Fallback when no model matches; may be nil
+	Models []CompiledPresetMatch
+	Merge  bool
+}
+
+// CompiledPresetMatch is a model pattern with its resolved params
+type CompiledPresetMatch struct {
+	Model  PatternField
+	Params map[string]any
+}
+
+func compilePreset(p *PresetSelector, presets map[string]map[string]any) *CompiledPreset {
+	if p == nil {
+		return nil
+	}
+	compiled := &CompiledPreset{Params: presets[p.Preset], Merge: p.Mode == PresetMerge}
+	for _, m := range p.Models {
+		compiled.Models = append(compiled.Models, CompiledPresetMatch{Model: m.Model, Params: presets[m.Preset]})
+	}
+	return compiled
+}
+
+// params returns the preset for the request's model
+func (p *CompiledPreset) params(data map[string]any) map[string]any {
+	if model, ok := data["model"].(string); ok {
+		for _, m := range p.Models {
+			if m.Model.Matches(model) {
+				return m.Params
+			}
+		}
+	}
+	return p.Params
+}
+
+// applyPreset sets the selected preset's params, overriding client values only in merge mode
+func applyPreset(data map[string]any, p *CompiledPreset, appliedValues map[string]any) {
+	params := p.params(data)
+	if p.Merge {
+		applyMerge(data, params, appliedValues)
+	} else {
+		applyDefault(data, params, appliedValues)
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const presetsConfig = `
+presets:
+  precise: { temperature: 0.2, top_p: 0.9 }
+  creative: { temperature: 1.1, min_p: 0.05 }
+
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      on_request:
+        - apply_preset:
+            preset: precise
+            models:
+              - model: "^qwen"
+                preset: creative
+`
+
+func TestApplyPresetByModelPattern(t *testing.T) {
+	cfg := mustParseConfig(t, presetsConfig)
+	route := cfg.Proxies[0].Routes[0]
+
+	tests := []struct {
+		name string
+		data map[string]any
+		want map[string]any
+	}{
+		{
+			name: "fallback preset fills missing params",
+			data: map[string]any{"model": "llama3", "temperature": 0.5},
+			want: map[string]any{"model": "llama3", "temperature": 0.5, "top_p": 0.9},
+		},
+		{
+			name: "model pattern selects preset",
+			data: map[string]any{"model": "Qwen3-32B"},
+			want: map[string]any{"model": "Qwen3-32B", "temperature": 1.1, "min_p": 0.05},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ProcessRequest(tt.data, nil, nil, route.Compiled, 0, "POST", "/v1/chat")
+			if !reflect.DeepEqual(tt.data, tt.want) {
+				t.Errorf("data = %#v, want %#v", tt.data, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPresetMergeMode(t *testing.T) {
+	cfg := mustParseConfig(t, `
+presets:
+  precise: { temperature: 0.2 }
+
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      on_request:
+        - apply_preset: { preset: precise, mode: merge }
+`)
+	data := map[string]any{"temperature": 0.9}
+	ProcessRequest(data, nil, nil, cfg.Proxies[0].Routes[0].Compiled, 0, "POST", "/v1/chat")
+	if data["temperature"] != 0.2 {
+		t.Errorf("temperature = %v, want 0.2", data["temperature"])
+	}
+}
+
+func TestApplyPresetValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		errMsg string
+	}{
+		{"unknown preset", "apply_preset: missing", "unknown preset 'missing'"},
+		{"unknown model preset", "apply_preset: { models: [{ model: qwen, preset: missing }] }", "unknown preset 'missing'"},
+		{"bad mode", "apply_preset: { preset: precise, mode: replace }", "mode must be default or merge"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig(t, `
+presets:
+  precise: { temperature: 0.2 }
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      on_request:
+        - `+tt.action+`
+`)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("err = %v, want containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// redactSets are the built-in redact patterns
+var redactSets = map[string]string{
+	"email":       `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"phone":       `(?:\+\d{1,3}[\s.-]?)?(?:\(\d{3}\)|\b\d{3})[\s.-]?\d{3}[\s.-]?\d{4}\b`,
+	"api_key":     `\b(?:sk|pk|rk)-[A-Za-z0-9_-]{16,}|\bAKIA[0-9A-Z]{16}\b|\bgh[pousr]_[A-Za-z0-9]{36}\b|\bxox[abprs]-[A-Za-z0-9-]{10,}`,
+	"credit_card": `\b\d(?:[ -]?\d){12,18}\b`,
+}
+
+// RedactSetNames returns the built-in redact patterns in sorted order
+func RedactSetNames() []string {
+	return slices.Sorted(maps.Keys(redactSets))
+}
+
+// RedactPolicy replaces sensitive text in prompts with numbered placeholders (ex: [EMAIL_1])
+type RedactPolicy struct {
+	Patterns []string          `yaml:"patterns,omitempty"` // Built-in sets: email, phone, api_key, credit_card
+	Custom   map[string]string `yaml:"custom,omitempty"`   // Placeholder label -> regex
+	Restore  bool              `yaml:"restore,omitempty"`  // Put the original text back into replies
+
+	compiled []redactPattern
+}
+
+type redactPattern struct {
+	label string
+	re    *regexp.Regexp
+	check func(string) bool
+}
+
+// Validate compiles the built-in and custom patterns
+func (r *RedactPolicy) Validate() error {
+	if len(r.Patterns) == 0 && len(r.Custom) == 0 {
+		return fmt.Errorf("redact requires patterns or custom")
+	}
+	r.compiled = nil
+	for _, name := range r.Patterns {
+		source, ok := redactSets[name]
+		if !ok {
+			return fmt.Errorf("unknown redact pattern '%s' (available: %s)", name, strings.Join(RedactSetNames(), ", "))
+		}
+		pattern := redactPattern{label: strings.ToUpper(name), re: regexp.MustCompile(source)}
+		if name == "credit_card" {
+			pattern.check = luhnValid
+		}
+		r.compiled = append(r.compiled, pattern)
+	}
+	for _, label := range slices.Sorted(maps.Keys(r.Custom)) {
+		re, err := regexp.Compile(r.Custom[label])
+		if err != nil {
+			return fmt.Errorf("invalid redact pattern for '%s': %w", label, err)
+		}
+		r.compiled = append(r.compiled, redactPattern{label: strings.ToUpper(label), re: re})
+	}
+	return nil
+}
+
+// luhnValid reports whether a digit string (spaces and dashes allowed) passes the Luhn check
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// ActionState carries per-request state from request actions to the response
+type ActionState struct {
+	Redactions   map[string]string // Placeholder -> original text, for redact with restore
+	Seed         string            // Seed in effect after a seed action, for the response header
+	SchemaErrors []string          // Failures of validate_schema checks in reject mode
+	Fired        []FiredAction     // Actions whose when matched, in order
+	Diffs        bool              // Record each fired action's Diff (always on at debug level)
+	Status       int               // Response status, matched by on_response when: {status}
+	Request      *RequestData      // The client's request, for on_response actions that use it
+
+	store        *StateStore       // The state store of the route whose actions are running
+	placeholders map[string]string // Original text -> placeholder
+	counts       map[string]int    // Placeholders issued per label
+}
+
+// Masker returns a function replacing text redacted from the request with its placeholders,
+// for anything that keeps request or response bodies. It returns nil when nothing was redacted.
+func (s *ActionState) Masker() func(string) string {
+	if len(s.placeholders) == 0 {
+		return nil
+	}
+	// Longest first, so an original containing another is replaced whole
+	originals := slices.SortedFunc(maps.Keys(s.placeholders), func(a, b string) int { return len(b) - len(a) })
+	pairs := make([]string, 0, 2*len(originals))
+	for _, original := range originals {
+		pairs = append(pairs, original, s.placeholders[original])
+	}
+	return strings.NewReplacer(pairs...).Replace
+}
+
+// placeholder returns the placeholder for a redacted value, reusing it for repeats
+func (s *ActionState) placeholder(label, value string, restore bool) string {
+	if s.placeholders == nil {
+		s.placeholders = make(map[string]string)
+		s.counts = make(map[string]int)
+	}
+	p, ok := s.placeholders[value]
+	if !ok {
+		s.counts[label]++
+		p = fmt.Sprintf("[%s_%d]", label, s.counts[label])
+		s.placeholders[value] = p
+	}
+	if restore {
+		if s.Redactions == nil {
+			s.Redactions = make(map[string]string)
+		}
+		s.Redactions[p] = value
+	}
+	return p
+}
+
+// redactText replaces every match in text and reports how many were replaced
+func (r *RedactPolicy) redactText(text string, state *ActionState) (string, int) {
+	count := 0
+	for _, pattern := range r.compiled {
+		text = pattern.re.ReplaceAllStringFunc(text, func(match string) string {
+			if pattern.check != nil && !pattern.check(match) {
+				return match
+			}
+			count++
+			return state.placeholder(pattern.label, match, r.Restore)
+		})
+	}
+	return text, count
+}
+
+// applyRedact redacts chat message content (strings and text parts), prompt, and system
+func applyRedact(data map[string]any, r *RedactPolicy, state *ActionState, appliedValues map[string]any) {
+	total := 0
+	redact := func(container map[string]any, key string) {
+		switch v := container[key].(type) {
+		case string:
+			text, n := r.redactText(v, state)
+			container[key] = text
+			total += n
+		case []any:
+			for _, part := range v {
+				if p, ok := part.(map[string]any); ok {
+					if text, ok := p["text"].(string); ok {
+						redacted, n := r.redactText(text, state)
+						p["text"] = redacted
+						total += n
+					}
+				}
+			}
+		}
+	}
+
+	before := total
+	if messages, ok := data["messages"].([]any); ok {
+		for _, m := range messages {
+			if msg, ok := m.(map[string]any); ok {
+				redact(msg, "content")
+			}
+		}
+		if total > before {
+			appliedValues["messages"] = "<redacted>"
+		}
+	}
+	for _, key := range []string{"prompt", "system"} {
+		before = total
+		redact(data, key)
+		if total > before {
+			appliedValues[key] = "<redacted>"
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyRedact(t *testing.T) {
+	policy := &RedactPolicy{
+		Patterns: []string{"email", "api_key", "credit_card"},
+		Custom:   map[string]string{"employee_id": `EMP-\d{6}`},
+		Restore:  true,
+	}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	data := map[string]any{
+		"messages": []any{
+			map[string]any{"role": "system", "content": "Reply to ada@example.com"},
+			map[string]any{"role": "user", "content": []any{
+				map[string]any{"type": "text", "text": "Card 4111 1111 1111 1111, order 1234 5678 9012 3456, key sk-abcdefghijklmnop1234"},
+			}},
+			map[string]any{"role": "user", "content": "I am EMP-123456, cc ada@example.com"},
+		},
+	}
+	state := &ActionState{}
+	applied := map[string]any{}
+	applyRedact(data, policy, state, applied)
+
+	messages := data["messages"].([]any)
+	system := messages[0].(map[string]any)["content"]
+	if system != "Reply to [EMAIL_1]" {
+		t.Errorf("system = %q", system)
+	}
+	part := messages[1].(map[string]any)["content"].([]any)[0].(map[string]any)["text"].(string)
+	if !strings.Contains(part, "[CREDIT_CARD_1]") || !strings.Contains(part, "[API_KEY_1]") {
+		t.Errorf("part = %q, want card and key redacted", part)
+	}
+	if !strings.Contains(part, "1234 5678 9012 3456") {
+		t.Errorf("part = %q, want number failing the Luhn check kept", part)
+	}
+	if last := messages[2].(map[string]any)["content"]; last != "I am [EMPLOYEE_ID_1], cc [EMAIL_1]" {
+		t.Errorf("last = %q, want repeated email to reuse its placeholder", last)
+	}
+	if state.Redactions["[EMAIL_1]"] != "ada@example.com" || len(state.Redactions) != 4 {
+		t.Errorf("redactions = %v", state.Redactions)
+	}
+	if applied["messages"] != "<redacted>" {
+		t.Errorf("applied = %v, want messages marked redacted", applied)
+	}
+}
+
+func TestRedactPolicyValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RedactPolicy
+		errMsg string
+	}{
+		{"empty", RedactPolicy{}, "requires patterns or custom"},
+		{"unknown set", RedactPolicy{Patterns: []string{"ssn"}}, "unknown redact pattern 'ssn'"},
+		{"bad regex", RedactPolicy{Custom: map[string]string{"x": "("}}, "invalid redact pattern for 'x'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("err = %v, want containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
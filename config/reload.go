@@ -0,0 +1,64 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ReloadGuard refuses hot reloads that change too much at once, such as a config file
+// picked up half-written. The running config's guard applies, so a reload can't lift its
+// own guard. Forced reloads (POST /admin/reload?force=true) skip it.
+type ReloadGuard struct {
+	MaxRoutesRemoved int  `yaml:"max_routes_removed,omitempty"` // Percent of routes, across proxies, one reload may remove; 0 allows any
+	KeepListeners    bool `yaml:"keep_listeners,omitempty"`     // Refuse reloads that add, remove, or change proxy listen addresses
+}
+
+// ErrReloadRefused is wrapped by ReloadGuard.Check errors
+var ErrReloadRefused = errors.New("reload refused")
+
+// Validate checks the limits
+func (g *ReloadGuard) Validate() error {
+	if g.MaxRoutesRemoved < 0 || g.MaxRoutesRemoved > 100 {
+		return fmt.Errorf("max_routes_removed must be between 0 and 100")
+	}
+	return nil
+}
+
+// Check returns an error wrapping ErrReloadRefused when replacing current with next
+// exceeds the guard
+func (g *ReloadGuard) Check(current, next *Config) error {
+	if g.KeepListeners {
+		before, after := listenAddrs(current), listenAddrs(next)
+		if !slices.Equal(before, after) {
+			return fmt.Errorf("%w: listeners would change from %s to %s (reload.keep_listeners)",
+				ErrReloadRefused, strings.Join(before, ", "), strings.Join(after, ", "))
+		}
+	}
+	if g.MaxRoutesRemoved > 0 {
+		before, after := routeCount(current), routeCount(next)
+		if removed := before - after; removed > 0 && removed*100 > g.MaxRoutesRemoved*before {
+			return fmt.Errorf("%w: %d of %d routes would be removed, over %d%% (reload.max_routes_removed)",
+				ErrReloadRefused, removed, before, g.MaxRoutesRemoved)
+		}
+	}
+	return nil
+}
+
+func listenAddrs(cfg *Config) []string {
+	var addrs []string
+	for _, proxy := range cfg.Proxies {
+		addrs = append(addrs, proxy.Listeners()...)
+	}
+	slices.Sort(addrs)
+	return addrs
+}
+
+func routeCount(cfg *Config) int {
+	n := 0
+	for _, proxy := range cfg.Proxies {
+		n += len(proxy.Routes)
+	}
+	return n
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReloadGuardCheck(t *testing.T) {
+	proxies := func(listens ...string) *Config {
+		cfg := &Config{}
+		for _, listen := range listens {
+			cfg.Proxies = append(cfg.Proxies, ProxyConfig{Listen: listen, Routes: make([]Route, 4)})
+		}
+		return cfg
+	}
+	truncated := proxies("localhost:8081")
+	truncated.Proxies[0].Routes = truncated.Proxies[0].Routes[:1]
+
+	tests := []struct {
+		name    string
+		guard   ReloadGuard
+		current *Config
+		next    *Config
+		errMsg  string
+	}{
+		{
+			name:    "same listeners",
+			guard:   ReloadGuard{KeepListeners: true},
+			current: proxies("localhost:8081", "localhost:8082"),
+			next:    proxies("localhost:8082", "localhost:8081"),
+		},
+		{
+			name:    "listener removed",
+			guard:   ReloadGuard{KeepListeners: true},
+			current: proxies("localhost:8081", "localhost:8082"),
+			next:    proxies("localhost:8081"),
+			errMsg:  "listeners would change from localhost:8081, localhost:8082 to localhost:8081",
+		},
+		{
+			name:    "removal within the limit",
+			guard:   ReloadGuard{MaxRoutesRemoved: 50},
+			current: proxies("localhost:8081", "localhost:8082"),
+			next:    proxies("localhost:8081"),
+		},
+		{
+			name:    "removal over the limit",
+			guard:   ReloadGuard{MaxRoutesRemoved: 50},
+			current: proxies("localhost:8081"),
+			next:    truncated,
+			errMsg:  "3 of 4 routes would be removed, over 50%",
+		},
+		{
+			name:    "no route limit",
+			guard:   ReloadGuard{},
+			current: proxies("localhost:8081"),
+			next:    truncated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.guard.Check(tt.current, tt.next)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatalf("Check() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !errors.Is(err, ErrReloadRefused) || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("Check() = %v, want ErrReloadRefused containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
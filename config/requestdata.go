@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// RequestData is a request as the client sent it, kept for on_response actions that match
+// (when: {request: ...}) or copy (from_request) its values
+type RequestData struct {
+	Body    map[string]any // Empty when the body isn't JSON
+	Headers map[string]string
+	Query   map[string]string
+}
+
+// NewRequestData copies a request's values, so actions and aliases applied afterwards don't
+// change them
+func NewRequestData(body map[string]any, headers, query map[string]string) *RequestData {
+	r := &RequestData{Headers: maps.Clone(headers), Query: maps.Clone(query)}
+	if body != nil {
+		r.Body = cloneJSON(body).(map[string]any)
+	}
+	return r
+}
+
+// Request sources for from_request
+const (
+	requestSourceBody    = "body."
+	requestSourceHeaders = "headers."
+	requestSourceQuery   = "query."
+)
+
+// Lookup returns the value at source: body.<field> (dotted for nested fields),
+// headers.<name> (case-insensitive), or query.<name>
+func (r *RequestData) Lookup(source string) (any, bool) {
+	switch {
+	case strings.HasPrefix(source, requestSourceBody):
+		return lookupPath(r.Body, strings.TrimPrefix(source, requestSourceBody))
+	case strings.HasPrefix(source, requestSourceHeaders):
+		name := strings.TrimPrefix(source, requestSourceHeaders)
+		return lookupHeader(r.Headers, name, strings.ToLower(name))
+	case strings.HasPrefix(source, requestSourceQuery):
+		v, ok := r.Query[strings.TrimPrefix(source, requestSourceQuery)]
+		return v, ok
+	}
+	return nil, false
+}
+
+// validateFromRequest checks from_request sources name a part of the request
+func validateFromRequest(fields map[string]string) error {
+	for _, field := range slices.Sorted(maps.Keys(fields)) {
+		source := fields[field]
+		if field == "" {
+			return fmt.Errorf("from_request: empty field name")
+		}
+		valid := false
+		for _, prefix := range []string{requestSourceBody, requestSourceHeaders, requestSourceQuery} {
+			if strings.HasPrefix(source, prefix) && len(source) > len(prefix) {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("from_request.%s: %q must start with body., headers., or query.", field, source)
+		}
+	}
+	return nil
+}
+
+// applyFromRequest sets reply fields (dotted for nested) from the request. Values the
+// request doesn't have are left unset.
+func applyFromRequest(data map[string]any, fields map[string]string, request *RequestData, appliedValues map[string]any) {
+	if request == nil {
+		return
+	}
+	for _, field := range slices.Sorted(maps.Keys(fields)) {
+		value, ok := request.Lookup(fields[field])
+		if !ok {
+			continue
+		}
+		setPath(data, field, cloneJSON(value))
+		appliedValues[topKey(field)] = data[topKey(field)]
+	}
+}
+
+// UsesRequest reports whether the route's on_response actions match or copy the request,
+// which must then be kept until the reply
+func (r *Route) UsesRequest() bool {
+	uses := false
+	WalkActions(r.OnResponse, func(op *Action) {
+		if len(op.FromRequest) > 0 || (op.When != nil && op.When.matchesRequest()) {
+			uses = true
+		}
+	})
+	return uses
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFromRequest(t *testing.T) {
+	request := NewRequestData(
+		map[string]any{"model": "qwen3", "options": map[string]any{"seed": 7.0}},
+		map[string]string{"X-Request-Id": "abc"},
+		map[string]string{"tier": "free"},
+	)
+	data := map[string]any{"model": "backend"}
+	changes := map[string]any{}
+	applyFromRequest(data, map[string]string{
+		"requested_model": "body.model",
+		"meta.seed":       "body.options.seed",
+		"meta.id":         "headers.x-request-id",
+		"tier":            "query.tier",
+		"missing":         "body.user",
+	}, request, changes)
+
+	want := map[string]any{
+		"model":           "backend",
+		"requested_model": "qwen3",
+		"meta":            map[string]any{"seed": 7.0, "id": "abc"},
+		"tier":            "free",
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("data = %v, want %v", data, want)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("changes = %v, want the three top-level keys set", changes)
+	}
+}
+
+func TestRequestMatchersValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		errMsg string
+	}{
+		{
+			name:   "request when in on_request",
+			action: "on_request:\n        - when: { request: { body: { model: qwen } } }\n          merge: { ok: true }",
+			errMsg: "route 0 on_request 0 when: request matches from on_response only",
+		},
+		{
+			name:   "from_request in on_request",
+			action: "on_request:\n        - from_request: { model: body.model }",
+			errMsg: "from_request copies into replies",
+		},
+		{
+			name:   "unknown source",
+			action: "on_response:\n        - from_request: { model: model }",
+			errMsg: `from_request.model: "model" must start with body., headers., or query.`,
+		},
+		{
+			name:   "status nested in request",
+			action: "on_response:\n        - when: { request: { status: \"5..\" } }\n          merge: { ok: true }",
+			errMsg: "status and request can't be nested in it",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig(t, `
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      `+tt.action+`
+`)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("err = %v, want %q", err, tt.errMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Literal pattern kinds
+const (
+	literalContains = iota // Unanchored: matches anywhere
+	literalPrefix          // ^text
+	literalExact           // ^text$
+)
+
+// literalPattern is a pattern with no regex operators, matched with string comparisons.
+// Text is lowercased ASCII; patterns always match case-insensitively.
+type literalPattern struct {
+	kind int
+	text string
+}
+
+// parseLiteral reports whether pattern is plain ASCII text, optionally anchored with ^
+// and $. Anything else (classes, repeats, suffix anchors) is left to the regex.
+func parseLiteral(pattern string) (literalPattern, bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return literalPattern{}, false
+	}
+	re = re.Simplify()
+
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+	start := len(subs) > 0 && subs[0].Op == syntax.OpBeginText
+	if start {
+		subs = subs[1:]
+	}
+	end := len(subs) > 0 && subs[len(subs)-1].Op == syntax.OpEndText
+	if end {
+		subs = subs[:len(subs)-1]
+	}
+
+	var text string
+	switch {
+	case len(subs) == 0:
+	case len(subs) == 1 && subs[0].Op == syntax.OpEmptyMatch:
+	case len(subs) == 1 && subs[0].Op == syntax.OpLiteral:
+		text = string(subs[0].Rune)
+	default:
+		return literalPattern{}, false
+	}
+	if !isASCII(text) {
+		return literalPattern{}, false
+	}
+
+	lit := literalPattern{kind: literalContains, text: strings.ToLower(text)}
+	switch {
+	case start && end:
+		lit.kind = literalExact
+	case start:
+		lit.kind = literalPrefix
+	case end:
+		return literalPattern{}, false
+	}
+	return lit, true
+}
+
+// matches checks lowered, an ASCII input already lowercased
+func (l literalPattern) matches(lowered string) bool {
+	switch l.kind {
+	case literalExact:
+		return lowered == l.text
+	case literalPrefix:
+		return strings.HasPrefix(lowered, l.text)
+	}
+	return strings.Contains(lowered, l.text)
+}
+
+// literalPatterns returns the literal form of every pattern, or nil if any needs a regex
+func literalPatterns(patterns []string) []literalPattern {
+	literals := make([]literalPattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		lit, ok := parseLiteral(pattern)
+		if !ok {
+			return nil
+		}
+		literals = append(literals, lit)
+	}
+	return literals
+}
+
+// isASCII reports whether s has no multi-byte runes. Case folding beyond ASCII (ex: the
+// Kelvin sign matching k) is left to the regex.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// RouteIndex finds the routes matching a method and path without running every route's
+// patterns. Routes whose path patterns are all exact or ^prefix literals are found by
+// lookup; the rest are checked one by one.
+type RouteIndex struct {
+	routes []Route
+	exact  map[string][]int
+	prefix *pathTrie
+	scan   []int // Routes with a path pattern the index can't hold
+}
+
+// pathTrie holds ^prefix path patterns by lowercased byte
+type pathTrie struct {
+	children map[byte]*pathTrie
+	routes   []int
+}
+
+func (t *pathTrie) insert(prefix string, route int) {
+	node := t
+	for i := 0; i < len(prefix); i++ {
+		child, ok := node.children[prefix[i]]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[byte]*pathTrie)
+			}
+			child = &pathTrie{}
+			node.children[prefix[i]] = child
+		}
+		node = child
+	}
+	node.routes = append(node.routes, route)
+}
+
+// collect appends the routes of every prefix of path
+func (t *pathTrie) collect(path string, out []int) []int {
+	node := t
+	out = append(out, node.routes...)
+	for i := 0; i < len(path); i++ {
+		if node = node.children[path[i]]; node == nil {
+			break
+		}
+		out = append(out, node.routes...)
+	}
+	return out
+}
+
+// NewRouteIndex indexes validated routes. The index refers to routes, which must not be
+// modified afterwards.
+func NewRouteIndex(routes []Route) *RouteIndex {
+	x := &RouteIndex{routes: routes, exact: make(map[string][]int), prefix: &pathTrie{}}
+	for i := range routes {
+		paths := routes[i].Paths
+		literals := paths.literals
+		if literals == nil || slices.ContainsFunc(literals, func(l literalPattern) bool { return l.kind == literalContains }) {
+			if paths.Len() > 0 {
+				x.scan = append(x.scan, i)
+			}
+			continue
+		}
+		for _, lit := range literals {
+			if lit.kind == literalExact {
+				x.exact[lit.text] = append(x.exact[lit.text], i)
+			} else {
+				x.prefix.insert(lit.text, i)
+			}
+		}
+	}
+	return x
+}
+
+// Match returns the indices of the routes matching method and path, in route order
+func (x *RouteIndex) Match(method, path string) []int {
+	var matched []int
+	if !isASCII(path) {
+		for i := range x.routes {
+			if x.routes[i].Paths.Matches(path) && x.routes[i].Methods.Matches(method) {
+				matched = append(matched, i)
+			}
+		}
+		return matched
+	}
+
+	lowered := strings.ToLower(path)
+	candidates := append([]int(nil), x.exact[lowered]...)
+	candidates = x.prefix.collect(lowered, candidates)
+	for _, i := range x.scan {
+		if x.routes[i].Paths.Matches(path) {
+			candidates = append(candidates, i)
+		}
+	}
+	slices.Sort(candidates)
+	for _, i := range slices.Compact(candidates) {
+		if x.routes[i].Methods.Matches(method) {
+			matched = append(matched, i)
+		}
+	}
+	return matched
+}
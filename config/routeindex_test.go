@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestParseLiteral(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    literalPattern
+		ok      bool
+	}{
+		{"POST", literalPattern{literalContains, "post"}, true},
+		{"^/v1/chat/completions$", literalPattern{literalExact, "/v1/chat/completions"}, true},
+		{"^/API/", literalPattern{literalPrefix, "/api/"}, true},
+		{`^/v1/models\.json$`, literalPattern{literalExact, "/v1/models.json"}, true},
+		{"^$", literalPattern{literalExact, ""}, true},
+		{"", literalPattern{literalContains, ""}, true},
+		{"/completions$", literalPattern{}, false},
+		{"^/v1/.*", literalPattern{}, false},
+		{"^(GET|POST)$", literalPattern{}, false},
+		{"^/v1/chat/completions?$", literalPattern{}, false},
+		{"^/modèles$", literalPattern{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseLiteral(tt.pattern)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseLiteral(%q) = %+v, %v; want %+v, %v", tt.pattern, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPatternFieldLiteralsMatchLikeRegex(t *testing.T) {
+	patterns := []string{"POST", "^/v1/chat$", "^/api/", "^$", "^/v1/.*", "^/k$"}
+	inputs := []string{"POST", "post", "XPOSTY", "GET", "/v1/chat", "/V1/CHAT", "/v1/chat/x", "/api/tags",
+		"/API", "", "/v1/", "/k", "/K", "/\u212a"}
+	for _, pattern := range patterns {
+		p := PatternField{Patterns: []string{pattern}}
+		if err := p.Validate(); err != nil {
+			t.Fatalf("validate %q: %v", pattern, err)
+		}
+		for _, input := range inputs {
+			want := p.Compiled[0].MatchString(input)
+			if got := p.Matches(input); got != want {
+				t.Errorf("pattern %q on %q = %v, regex says %v", pattern, input, got, want)
+			}
+		}
+	}
+}
+
+func newIndexedRoutes(t testing.TB, specs [][2][]string) []Route {
+	t.Helper()
+	routes := make([]Route, len(specs))
+	for i, spec := range specs {
+		routes[i].Methods = PatternField{Patterns: spec[0]}
+		routes[i].Paths = PatternField{Patterns: spec[1]}
+		if err := routes[i].Methods.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := routes[i].Paths.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return routes
+}
+
+func TestRouteIndexMatchesLikeScan(t *testing.T) {
+	routes := newIndexedRoutes(t, [][2][]string{
+		{{"POST"}, {"^/v1/chat/completions$"}},
+		{{"^GET$"}, {"^/v1/models$", "^/api/tags$"}},
+		{{"POST"}, {"^/api/"}},
+		{{".*"}, {".*"}},
+		{{"POST"}, {"completions"}},
+		{{"POST|PUT"}, {"^/v1/(chat/)?completions$"}},
+		{{"POST"}, {"^/v1/"}},
+		{{"GET"}, {}},
+		{{"POST"}, {"^/k"}},
+	})
+	x := NewRouteIndex(routes)
+
+	for _, method := range []string{"POST", "GET", "PUT", "post"} {
+		for _, path := range []string{"/v1/chat/completions", "/V1/Chat/Completions", "/v1/completions", "/v1/models",
+			"/api/tags", "/api/chat", "/other", "", "/v1", "/kelvin", "/\u212aelvin"} {
+			var want []int
+			for i := range routes {
+				if routes[i].Methods.Matches(method) && routes[i].Paths.Matches(path) {
+					want = append(want, i)
+				}
+			}
+			if got := x.Match(method, path); !slices.Equal(got, want) {
+				t.Errorf("Match(%s, %q) = %v, want %v", method, path, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkRouteIndexMatch(b *testing.B) {
+	specs := make([][2][]string, 500)
+	for i := range specs {
+		specs[i] = [2][]string{{"POST"}, {fmt.Sprintf("^/v1/route%d$", i)}}
+	}
+	routes := newIndexedRoutes(b, specs)
+	x := NewRouteIndex(routes)
+
+	b.Run("index", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			x.Match("POST", "/v1/route499")
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			for i := range routes {
+				if routes[i].Methods.Compiled[0].MatchString("POST") {
+					routes[i].Paths.Compiled[0].MatchString("/v1/route499")
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/schema"
+)
+
+// Schema check modes
+const (
+	SchemaReject  = "reject"  // Answer 400 with the validation errors
+	SchemaObserve = "observe" // Log the errors and forward the request
+)
+
+// maxSchemaErrors caps the errors reported for one request
+const maxSchemaErrors = 10
+
+// SchemaCheck validates request bodies against a JSON Schema file. A bare string is
+// shorthand for { file: <path> }.
+type SchemaCheck struct {
+	File string `yaml:"file"`           // Relative to the config file that declares it
+	Mode string `yaml:"mode,omitempty"` // reject (default) or observe
+
+	schema map[string]any // Read from File by Validate
+}
+
+// UnmarshalYAML accepts a file path or a check mapping
+func (s *SchemaCheck) UnmarshalYAML(unmarshal func(any) error) error {
+	var file string
+	if err := unmarshal(&file); err == nil {
+		s.File = file
+		return nil
+	}
+
+	type plain SchemaCheck
+	return unmarshal((*plain)(s))
+}
+
+// Validate normalizes defaults and reads the schema
+func (s *SchemaCheck) Validate() error {
+	switch s.Mode {
+	case "":
+		s.Mode = SchemaReject
+	case SchemaReject, SchemaObserve:
+	default:
+		return fmt.Errorf("validate_schema mode must be %s or %s", SchemaReject, SchemaObserve)
+	}
+	if s.File == "" {
+		return fmt.Errorf("validate_schema requires a file")
+	}
+
+	data, err := os.ReadFile(s.File)
+	if err != nil {
+		return fmt.Errorf("validate_schema: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.schema); err != nil {
+		return fmt.Errorf("validate_schema %s: not a JSON Schema object: %w", s.File, err)
+	}
+	return nil
+}
+
+// applySchemaCheck records the ways data fails the schema; rejections are left to the caller
+func applySchemaCheck(data map[string]any, s *SchemaCheck, state *ActionState) {
+	errs := schema.Errors(s.schema, data, maxSchemaErrors)
+	if len(errs) == 0 {
+		return
+	}
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	if s.Mode == SchemaObserve {
+		logger.Info("Request failed schema validation", "schema", s.File, "errors", len(messages), "first", messages[0])
+		return
+	}
+	state.SchemaErrors = append(state.SchemaErrors, messages...)
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSchemaCheckLoadsRelativeToConfig(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "schemas"), 0o755)
+	os.WriteFile(filepath.Join(dir, "schemas", "chat.json"), []byte(`{
+		"type": "object",
+		"required": ["model", "messages"],
+		"properties": {"messages": {"type": "array", "minItems": 1}}
+	}`), 0o644)
+	path := filepath.Join(dir, "config.yml")
+	os.WriteFile(path, []byte(`
+proxy:
+  listen: localhost:8081
+  target: http://localhost:8080
+  routes:
+    - methods: POST
+      paths: ^/v1/chat/completions$
+      on_request:
+        - validate_schema: schemas/chat.json
+        - validate_schema: { file: schemas/chat.json, mode: observe }
+`), 0o644)
+
+	cfg, watched, err := Load([]string{path}, CliOverrides{})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	schemaPath := filepath.Join(dir, "schemas", "chat.json")
+	route := cfg.Proxies[0].Routes[0]
+	if route.OnRequest[0].Schema.File != schemaPath || route.OnRequest[0].Schema.Mode != SchemaReject {
+		t.Fatalf("schema check = %+v, want %s in reject mode", route.OnRequest[0].Schema, schemaPath)
+	}
+	if !slices.Contains(watched, schemaPath) {
+		t.Fatalf("watched = %v, want the schema file for reloads", watched)
+	}
+
+	state := &ActionState{}
+	ProcessRequestWithState(map[string]any{"messages": []any{}}, nil, nil, route.Compiled, 0, "POST", "/v1/chat/completions", state)
+	want := []string{`$: missing required property "model"`, "$.messages: expected at least 1 items"}
+	if !slices.Equal(state.SchemaErrors, want) {
+		t.Fatalf("schema errors = %q, want %q (observe mode adds none)", state.SchemaErrors, want)
+	}
+
+	state = &ActionState{}
+	ProcessRequestWithState(map[string]any{"model": "m", "messages": []any{"hi"}}, nil, nil, route.Compiled, 0, "POST", "/v1/chat/completions", state)
+	if len(state.SchemaErrors) != 0 {
+		t.Fatalf("schema errors for a valid body = %q", state.SchemaErrors)
+	}
+}
+
+func TestSchemaCheckValidate(t *testing.T) {
+	dir := t.TempDir()
+	notObject := filepath.Join(dir, "list.json")
+	os.WriteFile(notObject, []byte(`[1]`), 0o644)
+
+	tests := []struct {
+		check SchemaCheck
+		want  string
+	}{
+		{SchemaCheck{}, "requires a file"},
+		{SchemaCheck{File: filepath.Join(dir, "missing.json")}, "no such file"},
+		{SchemaCheck{File: notObject}, "not a JSON Schema object"},
+		{SchemaCheck{File: notObject, Mode: "warn"}, "mode must be reject or observe"},
+	}
+	for _, tt := range tests {
+		if err := tt.check.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Validate(%+v) = %v, want %q", tt.check, err, tt.want)
+		}
+	}
+}
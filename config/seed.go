@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Seed modes
+const (
+	SeedRandom = "random"  // A fresh random seed per request
+	SeedPerKey = "per_key" // A fixed seed per API key, for reproducible evals
+)
+
+// SeedPolicy injects a seed into requests that don't send one. The seed used is recorded
+// for the response (see ActionState.Seed). A bare string is shorthand for { mode: <mode> }.
+type SeedPolicy struct {
+	Mode   string `yaml:"mode,omitempty"`   // random (default) or per_key
+	Field  string `yaml:"field,omitempty"`  // Defaults to seed. Dotted keys nest (ex: options.seed)
+	Header string `yaml:"header,omitempty"` // Header holding the API key for per_key; defaults to Authorization
+}
+
+// UnmarshalYAML accepts a mode or a policy mapping
+func (s *SeedPolicy) UnmarshalYAML(unmarshal func(any) error) error {
+	var mode string
+	if err := unmarshal(&mode); err == nil {
+		s.Mode = mode
+		return nil
+	}
+
+	type plain SeedPolicy
+	return unmarshal((*plain)(s))
+}
+
+// Validate normalizes defaults
+func (s *SeedPolicy) Validate() error {
+	switch s.Mode {
+	case "":
+		s.Mode = SeedRandom
+	case SeedRandom, SeedPerKey:
+	default:
+		return fmt.Errorf("seed mode must be %s or %s", SeedRandom, SeedPerKey)
+	}
+	if s.Field == "" {
+		s.Field = "seed"
+	}
+	if s.Header == "" {
+		s.Header = "Authorization"
+	}
+	s.Header = http.CanonicalHeaderKey(s.Header)
+	return nil
+}
+
+// keySeed derives a stable seed from an API key; the key itself is never logged
+func keySeed(key string) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int64(h.Sum32() & math.MaxInt32)
+}
+
+// applySeed sets the seed field when absent and records the seed in effect either way
+func applySeed(data map[string]any, s *SeedPolicy, headers map[string]string, state *ActionState, appliedValues map[string]any) {
+	if existing, ok := lookupPath(data, s.Field); ok && existing != nil {
+		state.Seed = fmt.Sprint(existing)
+		return
+	}
+
+	var seed int64
+	switch s.Mode {
+	case SeedPerKey:
+		value, _ := lookupHeader(headers, s.Header, strings.ToLower(s.Header))
+		seed = keySeed(value)
+	default:
+		seed = rand.Int64N(math.MaxInt32)
+	}
+	setPath(data, s.Field, float64(seed))
+	appliedValues[topKey(s.Field)] = data[topKey(s.Field)]
+	state.Seed = strconv.FormatInt(seed, 10)
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplySeed(t *testing.T) {
+	perKey := &SeedPolicy{Mode: SeedPerKey}
+	if err := perKey.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	headers := map[string]string{"Authorization": "Bearer sk-eval"}
+
+	var seeds []any
+	for range 2 {
+		data := map[string]any{"model": "m"}
+		state := &ActionState{}
+		applied := map[string]any{}
+		applySeed(data, perKey, headers, state, applied)
+		if applied["seed"] == nil || state.Seed == "" {
+			t.Fatalf("expected seed injected and recorded, got data %v state %q", data, state.Seed)
+		}
+		seeds = append(seeds, data["seed"])
+	}
+	if seeds[0] != seeds[1] {
+		t.Fatalf("per_key seeds differ for the same key: %v", seeds)
+	}
+
+	other := map[string]any{}
+	applySeed(other, perKey, map[string]string{"Authorization": "Bearer sk-other"}, &ActionState{}, map[string]any{})
+	if other["seed"] == seeds[0] {
+		t.Fatalf("different keys should get different seeds")
+	}
+
+	// A client seed is kept and recorded
+	data := map[string]any{"seed": 42.0}
+	state := &ActionState{}
+	applied := map[string]any{}
+	applySeed(data, &SeedPolicy{Mode: SeedRandom, Field: "seed"}, nil, state, applied)
+	if data["seed"] != 42.0 || state.Seed != "42" || len(applied) != 0 {
+		t.Fatalf("client seed should pass through, got %v state %q applied %v", data, state.Seed, applied)
+	}
+}
+
+func TestApplySeedNestedField(t *testing.T) {
+	policy := &SeedPolicy{Field: "options.seed"}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	data := map[string]any{"options": map[string]any{"temperature": 0.2}}
+	applySeed(data, policy, nil, &ActionState{}, map[string]any{})
+	options := data["options"].(map[string]any)
+	if _, ok := options["seed"].(float64); !ok || options["temperature"] != 0.2 {
+		t.Fatalf("options = %v, want seed added beside temperature", options)
+	}
+}
+
+func TestSeedPolicyYAML(t *testing.T) {
+	var action Action
+	if err := yaml.Unmarshal([]byte("seed: per_key"), &action); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if action.Seed == nil || action.Seed.Mode != SeedPerKey {
+		t.Fatalf("seed = %+v, want per_key shorthand", action.Seed)
+	}
+	if err := (&SeedPolicy{Mode: "fixed"}).Validate(); err == nil {
+		t.Fatal("expected unknown mode to fail validation")
+	}
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultSessionIdle is how long a session counts as active after its last request
+const DefaultSessionIdle = 30 * time.Minute
+
+// SessionConfig names where requests carry a conversation ID, so every turn of a chat can
+// be followed through logs and metrics and kept on one target. The header is tried first.
+type SessionConfig struct {
+	Header string        `yaml:"header,omitempty"` // Request header holding the ID (ex: X-Session-ID)
+	Body   string        `yaml:"body,omitempty"`   // Body field holding the ID, dotted for nested (ex: metadata.conversation_id)
+	Idle   time.Duration `yaml:"idle,omitempty"`   // Quiet time after which a session no longer counts as active; defaults to 30m
+}
+
+// Validate checks that the session has somewhere to come from
+func (s *SessionConfig) Validate() error {
+	if s.Header == "" && s.Body == "" {
+		return fmt.Errorf("requires header or body")
+	}
+	if s.Idle < 0 {
+		return fmt.Errorf("idle cannot be negative")
+	}
+	return nil
+}
+
+// IdleTimeout returns the idle period, or the default when unset
+func (s *SessionConfig) IdleTimeout() time.Duration {
+	if s.Idle > 0 {
+		return s.Idle
+	}
+	return DefaultSessionIdle
+}
+
+// ID returns a request's conversation ID from its header, then its body field. Numbers
+// count as written; empty strings and other values don't count.
+func (s *SessionConfig) ID(header http.Header, data map[string]any) string {
+	if s == nil {
+		return ""
+	}
+	if s.Header != "" {
+		if v := header.Get(s.Header); v != "" {
+			return v
+		}
+	}
+	if s.Body == "" || data == nil {
+		return ""
+	}
+	v, _ := lookupPath(data, s.Body)
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// StateConfig gives a route a small key-value store for stateful policies (ex: the first
+// request of a session gets a system prompt). Templates read and write it with state_get,
+// state_set, and state_incr; when: {state: {key: pattern}} matches stored values. The store
+// lives in memory and starts empty on every config load.
+type StateConfig struct {
+	TTL     time.Duration `yaml:"ttl,omitempty"`      // How long a key lives after its last write; defaults to 1h
+	MaxKeys int           `yaml:"max_keys,omitempty"` // Keys kept at once, dropping those closest to expiry; defaults to 10000
+}
+
+// State store defaults
+const (
+	DefaultStateTTL     = time.Hour
+	DefaultStateMaxKeys = 10000
+)
+
+// Validate normalizes defaults
+func (s *StateConfig) Validate() error {
+	if s.TTL < 0 || s.MaxKeys < 0 {
+		return fmt.Errorf("values cannot be negative")
+	}
+	if s.TTL == 0 {
+		s.TTL = DefaultStateTTL
+	}
+	if s.MaxKeys == 0 {
+		s.MaxKeys = DefaultStateMaxKeys
+	}
+	return nil
+}
+
+// StateStore is a route's key-value store. Every write renews the key's TTL.
+type StateStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxKeys int
+	entries map[string]stateEntry
+	now     func() time.Time
+}
+
+type stateEntry struct {
+	value   any
+	expires time.Time
+}
+
+// NewStateStore creates an empty store with cfg's limits
+func NewStateStore(cfg StateConfig) *StateStore {
+	return &StateStore{ttl: cfg.TTL, maxKeys: cfg.MaxKeys, entries: make(map[string]stateEntry), now: time.Now}
+}
+
+// Get returns the value stored at key, if it hasn't expired
+func (s *StateStore) Get(key string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || !s.now().Before(entry.expires) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Set stores value at key
+func (s *StateStore) Set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setLocked(key, value)
+}
+
+// Incr adds one to the count at key and returns it: 1 the first time, or after the key
+// expired. Non-numeric values count as 0.
+func (s *StateStore) Incr(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	if entry, ok := s.entries[key]; ok && s.now().Before(entry.expires) {
+		count, _ = entry.value.(int)
+	}
+	count++
+	s.setLocked(key, count)
+	return count
+}
+
+// Len returns the number of keys held, including expired ones not yet dropped
+func (s *StateStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+func (s *StateStore) setLocked(key string, value any) {
+	now := s.now()
+	if _, ok := s.entries[key]; !ok && len(s.entries) >= s.maxKeys {
+		s.evictLocked(now)
+	}
+	s.entries[key] = stateEntry{value: value, expires: now.Add(s.ttl)}
+}
+
+// evictLocked drops expired keys, or the key closest to expiry when none have
+func (s *StateStore) evictLocked(now time.Time) {
+	var oldest string
+	var oldestExpires time.Time
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+			continue
+		}
+		if oldest == "" || entry.expires.Before(oldestExpires) {
+			oldest, oldestExpires = key, entry.expires
+		}
+	}
+	if len(s.entries) >= s.maxKeys {
+		delete(s.entries, oldest)
+	}
+}
+
+// funcs returns the template helpers bound to the store
+func (s *StateStore) funcs() template.FuncMap {
+	return template.FuncMap{
+		"state_get": func(key string) any {
+			value, _ := s.Get(key)
+			return value
+		},
+		"state_set": func(key string, value any) string {
+			s.Set(key, value)
+			return ""
+		},
+		"state_incr": s.Incr,
+	}
+}
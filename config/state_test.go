@@ -0,0 +1,117 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStateStoreExpiresAndEvicts(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewStateStore(StateConfig{TTL: time.Minute, MaxKeys: 2})
+	store.now = func() time.Time { return now }
+
+	if n := store.Incr("a"); n != 1 {
+		t.Fatalf("first incr = %d, want 1", n)
+	}
+	if n := store.Incr("a"); n != 2 {
+		t.Fatalf("second incr = %d, want 2", n)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := store.Get("a"); ok {
+		t.Fatal("key should expire after its TTL")
+	}
+	if n := store.Incr("a"); n != 1 {
+		t.Fatalf("incr after expiry = %d, want 1", n)
+	}
+
+	now = now.Add(time.Second)
+	store.Set("b", "x")
+	now = now.Add(time.Second)
+	store.Set("c", "y")
+	if _, ok := store.Get("a"); ok {
+		t.Fatal("a full store should drop the key closest to expiry")
+	}
+	if v, _ := store.Get("c"); v != "y" || store.Len() != 2 {
+		t.Fatalf("c = %v, len = %d; want the new key kept within max_keys", v, store.Len())
+	}
+}
+
+func TestRouteStateInTemplatesAndWhen(t *testing.T) {
+	cfg := mustParseConfig(t, `
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      state: { ttl: 30m }
+      on_request:
+        - when: { state: { last_model: "^qwen" } }
+          merge: { after_qwen: true }
+        - template: |
+            {{- $n := state_incr (printf "session:%v" .user) -}}
+            {{- state_set "last_model" .model -}}
+            {"model": "{{ .model }}", "user": "{{ .user }}", "first": {{ eq $n 1 }}}
+`)
+	route := cfg.Proxies[0].Routes[0]
+	if route.State.MaxKeys != DefaultStateMaxKeys {
+		t.Fatalf("max_keys = %d, want the default", route.State.MaxKeys)
+	}
+
+	first := map[string]any{"model": "qwen3", "user": "ada"}
+	ProcessRequest(first, nil, nil, route.Compiled, 0, "POST", "/v1/chat")
+	if first["first"] != true || first["after_qwen"] != nil {
+		t.Fatalf("first request = %v, want first and no stored model yet", first)
+	}
+
+	second := map[string]any{"model": "llama3", "user": "ada"}
+	ProcessRequest(second, nil, nil, route.Compiled, 0, "POST", "/v1/chat")
+	if second["first"] != false {
+		t.Fatalf("second request = %v, want the session counted", second)
+	}
+	if v, _ := route.Compiled.State.Get("last_model"); v != "llama3" {
+		t.Fatalf("last_model = %v, want llama3", v)
+	}
+}
+
+func TestRouteStateValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		route  string
+		errMsg string
+	}{
+		{
+			name:   "state match without a store",
+			route:  "on_request:\n        - when: { state: { seen: \"1\" } }\n          merge: { ok: true }",
+			errMsg: "route 0 on_request 0 when: state matches need the route's state store",
+		},
+		{
+			name:   "state helper without a store",
+			route:  "on_request:\n        - template: '{{ state_incr \"a\" }}'",
+			errMsg: "set state: on the route",
+		},
+		{
+			name:   "negative ttl",
+			route:  "state: { ttl: -1s }\n      on_request:\n        - merge: { ok: true }",
+			errMsg: "route 0: state: values cannot be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig(t, `
+proxy:
+  listen: "localhost:8081"
+  target: "http://localhost:8080"
+  routes:
+    - methods: POST
+      paths: /v1/chat
+      `+tt.route+`
+`)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("err = %v, want %q", err, tt.errMsg)
+			}
+		})
+	}
+}
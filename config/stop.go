@@ -0,0 +1,88 @@
+package config
+
+import "fmt"
+
+// Stop shapes
+const (
+	StopArray  = "array"  // ["a", "b"]
+	StopString = "string" // "a"; only the first stop string is kept
+)
+
+// stopFields are where clients and backends put stop strings
+var stopFields = []string{"stop", "stop_sequences", "options.stop"}
+
+// StopNormalizer gathers stop strings from every known field (stop, stop_sequences,
+// options.stop) and writes them to one field in one shape
+type StopNormalizer struct {
+	Shape string `yaml:"shape,omitempty"` // array (default) or string
+	Field string `yaml:"field,omitempty"` // Destination; defaults to stop. Dotted keys nest (ex: options.stop)
+	Max   int    `yaml:"max,omitempty"`   // Keep at most this many; 0 keeps all
+}
+
+// Validate normalizes defaults
+func (s *StopNormalizer) Validate() error {
+	switch s.Shape {
+	case "":
+		s.Shape = StopArray
+	case StopArray, StopString:
+	default:
+		return fmt.Errorf("normalize_stop shape must be %s or %s", StopArray, StopString)
+	}
+	if s.Field == "" {
+		s.Field = "stop"
+	}
+	if s.Max < 0 {
+		return fmt.Errorf("normalize_stop max cannot be negative")
+	}
+	return nil
+}
+
+// applyStopNormalizer rewrites stop strings in data. Duplicates and empty strings are dropped.
+func applyStopNormalizer(data map[string]any, s *StopNormalizer, appliedValues map[string]any) {
+	var stops []any
+	seen := make(map[string]bool)
+	found := false
+	for _, field := range stopFields {
+		value, ok := takePath(data, field)
+		if !ok {
+			continue
+		}
+		found = true
+		appliedValues[topKey(field)] = "<deleted>"
+
+		var values []any
+		switch v := value.(type) {
+		case string:
+			values = []any{v}
+		case []any:
+			values = v
+		}
+		for _, v := range values {
+			if str, ok := v.(string); ok && str != "" && !seen[str] {
+				seen[str] = true
+				stops = append(stops, str)
+			}
+		}
+	}
+	if !found {
+		return
+	}
+
+	limit := s.Max
+	if s.Shape == StopString {
+		limit = 1
+	}
+	if limit > 0 && len(stops) > limit {
+		stops = stops[:limit]
+	}
+	if len(stops) == 0 {
+		return
+	}
+
+	if s.Shape == StopString {
+		setPath(data, s.Field, stops[0])
+	} else {
+		setPath(data, s.Field, stops)
+	}
+	appliedValues[topKey(s.Field)] = data[topKey(s.Field)]
+}
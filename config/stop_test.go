@@ -0,0 +1,62 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyStopNormalizer(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy StopNormalizer
+		data   map[string]any
+		want   map[string]any
+	}{
+		{
+			name:   "string to array",
+			policy: StopNormalizer{},
+			data:   map[string]any{"stop": "\n\n"},
+			want:   map[string]any{"stop": []any{"\n\n"}},
+		},
+		{
+			name:   "array to string keeps first",
+			policy: StopNormalizer{Shape: StopString},
+			data:   map[string]any{"stop": []any{"a", "b"}},
+			want:   map[string]any{"stop": "a"},
+		},
+		{
+			name:   "gathers fields into ollama options with max",
+			policy: StopNormalizer{Field: "options.stop", Max: 2},
+			data: map[string]any{
+				"stop":           []any{"a", "", "a"},
+				"stop_sequences": []any{"b", "c"},
+				"options":        map[string]any{"temperature": 0.1},
+			},
+			want: map[string]any{"options": map[string]any{"temperature": 0.1, "stop": []any{"a", "b"}}},
+		},
+		{
+			name:   "no stop leaves body alone",
+			policy: StopNormalizer{},
+			data:   map[string]any{"model": "m"},
+			want:   map[string]any{"model": "m"},
+		},
+		{
+			name:   "only empty stops are removed",
+			policy: StopNormalizer{},
+			data:   map[string]any{"stop": []any{""}},
+			want:   map[string]any{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			applyStopNormalizer(tt.data, &tt.policy, map[string]any{})
+			if !reflect.DeepEqual(tt.data, tt.want) {
+				t.Errorf("data = %#v, want %#v", tt.data, tt.want)
+			}
+		})
+	}
+}
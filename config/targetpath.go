@@ -0,0 +1,93 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// TargetPathTemplated reports whether a route's target_path is a Go template rather than
+// a fixed path
+func (r *Route) TargetPathTemplated() bool {
+	return strings.Contains(r.TargetPath, "{{")
+}
+
+// compileTargetPath parses a templated target_path; fixed paths need no template
+func compileTargetPath(route *Route, name string) (*template.Template, error) {
+	if !route.TargetPathTemplated() {
+		return nil, nil
+	}
+	return template.New(name).Funcs(routeFuncs(route.Funcs)).Parse(route.TargetPath)
+}
+
+// TargetPathData is what a templated target_path sees
+type TargetPathData struct {
+	Method   string
+	Path     string            // The request path as received
+	Captures map[string]string // The route's path pattern groups, by number ("1") and by name
+	Query    map[string]string
+	Body     map[string]any // Empty when the body isn't JSON
+}
+
+// RenderTargetPath returns the backend path for a request matching the route: target_path
+// itself, or its template rendered over data. A rendered path must be absolute and have
+// every field it refers to.
+func (r *Route) RenderTargetPath(data TargetPathData) (string, error) {
+	if r.Compiled == nil || r.Compiled.TargetPath == nil {
+		return r.TargetPath, nil
+	}
+	if data.Body == nil {
+		data.Body = map[string]any{}
+	}
+	var buf bytes.Buffer
+	err := r.Compiled.TargetPath.Execute(&buf, map[string]any{
+		"method":   data.Method,
+		"path":     data.Path,
+		"captures": anyValues(data.Captures),
+		"query":    anyValues(data.Query),
+		"body":     data.Body,
+	})
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSpace(buf.String())
+	switch {
+	case strings.Contains(path, "<no value>"):
+		return "", fmt.Errorf("target_path %q refers to a field the request doesn't have", r.TargetPath)
+	case !strings.HasPrefix(path, "/"):
+		return "", fmt.Errorf("target_path rendered %q, which is not an absolute path", path)
+	case strings.ContainsAny(path, "?#") || strings.Contains(path, ".."):
+		return "", fmt.Errorf("target_path rendered %q, which may not contain ?, #, or ..", path)
+	}
+	return path, nil
+}
+
+// Captures returns the groups of the first pattern matching input, by number and by name
+func (p PatternField) Captures(input string) map[string]string {
+	for _, re := range p.Compiled {
+		match := re.FindStringSubmatch(input)
+		if match == nil {
+			continue
+		}
+		captures := make(map[string]string, len(match))
+		for i, name := range re.SubexpNames() {
+			captures[strconv.Itoa(i)] = match[i]
+			if name != "" {
+				captures[name] = match[i]
+			}
+		}
+		return captures
+	}
+	return map[string]string{}
+}
+
+// anyValues converts a string map for template helpers (ex: index) that take map[string]any
+func anyValues(m map[string]string) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
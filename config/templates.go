@@ -2,86 +2,161 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"text/template"
 
 	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/translate"
 )
 
-// CompileTemplates compiles all template strings in routes
+// CompileTemplates compiles all template strings in routes and key actions
 func CompileTemplates(cfg *Config) error {
 	for i := range cfg.Proxies {
 		if len(cfg.Proxies[i].Routes) == 0 {
 			continue
 		}
-		if err := compileRouteTemplates(cfg.Proxies[i].Routes, fmt.Sprintf("proxy_%d", i)); err != nil {
+		if err := compileRouteTemplates(cfg.Proxies[i].Routes, cfg.Presets, fmt.Sprintf("proxy_%d", i)); err != nil {
 			return err
 		}
+		for j := range cfg.Proxies[i].Keys {
+			key := &cfg.Proxies[i].Keys[j]
+			if len(key.OnRequest) == 0 {
+				continue
+			}
+			compiled := &CompiledRoute{}
+			var err error
+			compiled.OnRequest, compiled.OnRequestTemplates, err = compileActions(key.OnRequest, fmt.Sprintf("proxy_%d_key_%d_request", i, j), TemplateFuncs, cfg.Presets)
+			if err != nil {
+				return fmt.Errorf("key %s request %w", key.Name, err)
+			}
+			key.Compiled = compiled
+		}
 	}
 
 	return nil
 }
 
-func compileRouteTemplates(routes []Route, prefix string) error {
+func compileRouteTemplates(routes []Route, presets map[string]map[string]any, prefix string) error {
 	for i := range routes {
 		route := &routes[i]
+		funcs := routeFuncs(route.Funcs)
 
 		// Convert config operations to execution types
-		compiled := &CompiledRoute{
-			OnRequest:  make([]ActionExec, len(route.OnRequest)),
-			OnResponse: make([]ActionExec, len(route.OnResponse)),
+		compiled := &CompiledRoute{}
+		if route.State != nil {
+			compiled.State = NewStateStore(*route.State)
+			funcs = maps.Clone(funcs)
+			maps.Copy(funcs, compiled.State.funcs())
+		}
+		var err error
+		compiled.OnRequest, compiled.OnRequestTemplates, err = compileActions(route.OnRequest, fmt.Sprintf("%s_rule_%d_request", prefix, i), funcs, presets)
+		if err != nil {
+			return fmt.Errorf("rule %d request %w", i, err)
+		}
+		compiled.OnResponse, compiled.OnResponseTemplates, err = compileActions(route.OnResponse, fmt.Sprintf("%s_rule_%d_response", prefix, i), funcs, presets)
+		if err != nil {
+			return fmt.Errorf("rule %d response %w", i, err)
 		}
 
-		// Convert OnRequest operations
-		for j, op := range route.OnRequest {
-			compiled.OnRequest[j] = ActionExec{
-				When:     op.When,
-				Template: op.Template,
-				Merge:    op.Merge,
-				Default:  op.Default,
-				Delete:   op.Delete,
-				Stop:     op.Stop,
+		if route.Prompt != nil {
+			prompts, err := compilePrompts(route.Prompt, fmt.Sprintf("%s_rule_%d_prompt", prefix, i), funcs)
+			if err != nil {
+				return fmt.Errorf("rule %d prompt: %w", i, funcHint(err))
 			}
+			compiled.Prompts = prompts
+		}
+
+		targetPath, err := compileTargetPath(route, fmt.Sprintf("%s_rule_%d_target_path", prefix, i))
+		if err != nil {
+			return fmt.Errorf("rule %d target_path: %w", i, funcHint(err))
+		}
+		compiled.TargetPath = targetPath
 
-			if op.Template != "" {
-				tmpl, err := template.New(fmt.Sprintf("%s_rule_%d_request_%d", prefix, i, j)).
-					Funcs(TemplateFuncs).
-					Parse(op.Template)
-				if err != nil {
-					return fmt.Errorf("rule %d request operation %d: %w", i, j, err)
-				}
-				logger.Debug("Compiled request template", "scope", prefix, "rule_index", i, "operation_index", j)
-				compiled.OnRequestTemplates = append(compiled.OnRequestTemplates, tmpl)
-			} else {
-				compiled.OnRequestTemplates = append(compiled.OnRequestTemplates, nil)
+		route.Compiled = compiled
+	}
+	return nil
+}
+
+// compileActions converts actions to their execution form with one compiled template (or
+// nil) per action, descending into groups
+func compileActions(ops []Action, name string, funcs template.FuncMap, presets map[string]map[string]any) ([]ActionExec, []*template.Template, error) {
+	execs := make([]ActionExec, len(ops))
+	templates := make([]*template.Template, len(ops))
+	for j, op := range ops {
+		execs[j] = ActionExec{
+			When:        op.When,
+			Template:    op.Template,
+			Merge:       op.Merge,
+			Default:     op.Default,
+			Delete:      op.Delete,
+			ParamMap:    op.ParamMap,
+			Preset:      compilePreset(op.ApplyPreset, presets),
+			StopNorm:    op.NormalizeStop,
+			Redact:      op.Redact,
+			Seed:        op.Seed,
+			Schema:      op.Schema,
+			Stop:        op.Stop,
+			FromRequest: op.FromRequest,
+		}
+
+		if op.Template != "" {
+			tmpl, err := template.New(fmt.Sprintf("%s_%d", name, j)).
+				Funcs(funcs).
+				Parse(op.Template)
+			if err != nil {
+				return nil, nil, fmt.Errorf("operation %d: %w", j, funcHint(err))
 			}
+			logger.Debug("Compiled action template", "name", tmpl.Name())
+			templates[j] = tmpl
 		}
 
-		// Convert OnResponse operations
-		for j, op := range route.OnResponse {
-			compiled.OnResponse[j] = ActionExec{
-				When:     op.When,
-				Template: op.Template,
-				Merge:    op.Merge,
-				Default:  op.Default,
-				Delete:   op.Delete,
-				Stop:     op.Stop,
+		if len(op.Actions) > 0 {
+			children, childTemplates, err := compileActions(op.Actions, fmt.Sprintf("%s_%d", name, j), funcs, presets)
+			if err != nil {
+				return nil, nil, fmt.Errorf("operation %d actions %w", j, err)
 			}
+			execs[j].Actions, execs[j].Templates = children, childTemplates
+		}
 
-			if op.Template != "" {
-				tmpl, err := template.New(fmt.Sprintf("%s_rule_%d_response_%d", prefix, i, j)).
-					Funcs(TemplateFuncs).
-					Parse(op.Template)
-				if err != nil {
-					return fmt.Errorf("rule %d response operation %d: %w", i, j, err)
-				}
-				logger.Debug("Compiled response template", "scope", prefix, "rule_index", i, "operation_index", j)
-				compiled.OnResponseTemplates = append(compiled.OnResponseTemplates, tmpl)
-			} else {
-				compiled.OnResponseTemplates = append(compiled.OnResponseTemplates, nil)
+		if len(op.ElseActions) > 0 {
+			branch, branchTemplates, err := compileActions(op.ElseActions, fmt.Sprintf("%s_%d_else", name, j), funcs, presets)
+			if err != nil {
+				return nil, nil, fmt.Errorf("operation %d else %w", j, err)
 			}
+			execs[j].Else, execs[j].ElseTemplates = branch, branchTemplates
 		}
+	}
+	return execs, templates, nil
+}
 
-		route.Compiled = compiled
+// compilePrompts parses a route's chat templates, resolving built-in names
+func compilePrompts(cfg *PromptConfig, name string, funcs template.FuncMap) (map[string]*CompiledPrompt, error) {
+	sources := make(map[string]string, len(cfg.Models)+1)
+	if cfg.Template != "" {
+		sources[""] = cfg.Template
 	}
-	return nil
+	for model, source := range cfg.Models {
+		sources[model] = source
+	}
+
+	prompts := make(map[string]*CompiledPrompt, len(sources))
+	for model, source := range sources {
+		prompt := &CompiledPrompt{}
+		if builtin, ok := translate.ChatTemplates[source]; ok {
+			source = builtin.Text
+			prompt.Stop = append(prompt.Stop, builtin.Stop...)
+		}
+		prompt.Stop = append(prompt.Stop, cfg.Stop...)
+
+		tmpl, err := template.New(name + "_" + model).Funcs(funcs).Parse(source)
+		if err != nil {
+			if model == "" {
+				return nil, err
+			}
+			return nil, fmt.Errorf("model %s: %w", model, err)
+		}
+		prompt.Template = tmpl
+		prompts[model] = prompt
+	}
+	return prompts, nil
 }
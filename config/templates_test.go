@@ -2,6 +2,7 @@ package config
 
 import (
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -63,3 +64,51 @@ func TestTemplateFuncIndexDictAndKindIs(t *testing.T) {
 		t.Fatalf("kindIs string should be false for slice")
 	}
 }
+
+func TestCompilePromptsResolvesBuiltins(t *testing.T) {
+	prompts, err := compilePrompts(&PromptConfig{
+		Template: "{{range .Messages}}{{.content}}{{end}}",
+		Models:   map[string]string{"llama": "llama3"},
+		Stop:     []string{"END"},
+	}, "test", TemplateFuncs)
+	if err != nil {
+		t.Fatalf("compilePrompts: %v", err)
+	}
+	if got := prompts["llama"].Stop; len(got) != 2 || got[0] != "<|eot_id|>" || got[1] != "END" {
+		t.Fatalf("llama stop = %v", got)
+	}
+	if got := prompts[""].Stop; len(got) != 1 || got[0] != "END" {
+		t.Fatalf("default stop = %v", got)
+	}
+
+	if _, err := compilePrompts(&PromptConfig{Models: map[string]string{"m": "{{.Broken"}}, "test", TemplateFuncs); err == nil || !strings.Contains(err.Error(), "model m") {
+		t.Fatalf("expected parse error naming the model, got %v", err)
+	}
+}
+
+func TestCompileTemplatesChecksTargetPath(t *testing.T) {
+	routes := []Route{{TargetPath: "/api/{{ .body.model | nosuchfunc }}"}}
+	if err := compileRouteTemplates(routes, nil, "test"); err == nil || !strings.Contains(err.Error(), "rule 0 target_path") {
+		t.Fatalf("expected target_path compile error, got %v", err)
+	}
+
+	routes = []Route{{TargetPath: "/api/{{ .captures.1 }}"}, {TargetPath: "/fixed"}}
+	if err := compileRouteTemplates(routes, nil, "test"); err == nil {
+		t.Fatal("numeric field names should fail to parse; use index .captures \"1\"")
+	}
+
+	routes = []Route{{TargetPath: `/api/{{ index .captures "1" }}`}, {TargetPath: "/fixed"}}
+	if err := compileRouteTemplates(routes, nil, "test"); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if routes[1].Compiled.TargetPath != nil {
+		t.Fatal("fixed target_path should not be compiled as a template")
+	}
+	got, err := routes[0].RenderTargetPath(TargetPathData{Captures: map[string]string{"1": "qwen"}})
+	if err != nil || got != "/api/qwen" {
+		t.Fatalf("RenderTargetPath = %q, %v, want /api/qwen", got, err)
+	}
+	if _, err := routes[0].RenderTargetPath(TargetPathData{Captures: map[string]string{"1": "../admin"}}); err == nil {
+		t.Fatal("rendered paths containing .. should be refused")
+	}
+}
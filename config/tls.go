@@ -0,0 +1,85 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TLSSettings narrows what a TLS connection may negotiate, for security baselines stricter
+// than Go's defaults. Empty fields keep the defaults.
+type TLSSettings struct {
+	MinVersion string   // 1.0, 1.1, 1.2, or 1.3
+	Ciphers    []string // Go cipher suite names for TLS 1.2 and below (ex: TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)
+	Curves     []string // Key exchange groups in preference order: X25519MLKEM768, X25519, P-256, P-384, P-521
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519MLKEM768": tls.X25519MLKEM768,
+	"X25519":         tls.X25519,
+	"P-256":          tls.CurveP256,
+	"P-384":          tls.CurveP384,
+	"P-521":          tls.CurveP521,
+}
+
+// ListenerTLS returns the settings for TLS connections clients make to the proxy
+func (p ProxyConfig) ListenerTLS() TLSSettings {
+	return TLSSettings{MinVersion: p.TLSMinVersion, Ciphers: p.TLSCiphers, Curves: p.TLSCurves}
+}
+
+// UpstreamTLS returns the settings for TLS connections the proxy makes to https:// targets
+func (p ProxyConfig) UpstreamTLS() TLSSettings {
+	return TLSSettings{MinVersion: p.UpstreamTLSMinVersion, Ciphers: p.UpstreamTLSCiphers, Curves: p.UpstreamTLSCurves}
+}
+
+// Empty reports whether the settings keep every Go default
+func (s TLSSettings) Empty() bool {
+	return s.MinVersion == "" && len(s.Ciphers) == 0 && len(s.Curves) == 0
+}
+
+// Apply sets the settings on c. Errors name the setting at fault (ex: "ciphers: ...").
+func (s TLSSettings) Apply(c *tls.Config) error {
+	if s.MinVersion != "" {
+		version, ok := tlsVersions[s.MinVersion]
+		if !ok {
+			return fmt.Errorf("min_version must be 1.0, 1.1, 1.2, or 1.3")
+		}
+		c.MinVersion = version
+	}
+
+	if len(s.Ciphers) > 0 {
+		c.CipherSuites = make([]uint16, 0, len(s.Ciphers))
+		for _, name := range s.Ciphers {
+			i := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool { return suite.Name == name })
+			if i < 0 {
+				return fmt.Errorf("ciphers: unknown or insecure cipher suite %q", name)
+			}
+			suite := tls.CipherSuites()[i]
+			if !slices.ContainsFunc(suite.SupportedVersions, func(v uint16) bool { return v < tls.VersionTLS13 }) {
+				// Go always offers its TLS 1.3 suites and doesn't let them be chosen
+				return fmt.Errorf("ciphers: %s is a TLS 1.3 suite, which can't be configured", name)
+			}
+			c.CipherSuites = append(c.CipherSuites, suite.ID)
+		}
+	}
+
+	if len(s.Curves) > 0 {
+		c.CurvePreferences = make([]tls.CurveID, 0, len(s.Curves))
+		for _, name := range s.Curves {
+			curve, ok := tlsCurves[strings.ToUpper(name)]
+			if !ok {
+				return fmt.Errorf("curves: unknown curve %q (available: X25519MLKEM768, X25519, P-256, P-384, P-521)", name)
+			}
+			c.CurvePreferences = append(c.CurvePreferences, curve)
+		}
+	}
+	return nil
+}
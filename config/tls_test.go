@@ -0,0 +1,56 @@
+package config
+
+import (
+	"crypto/tls"
+	"slices"
+	"testing"
+)
+
+func TestTLSSettingsApply(t *testing.T) {
+	var c tls.Config
+	s := TLSSettings{
+		MinVersion: "1.2",
+		Ciphers:    []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+		Curves:     []string{"x25519", "P-384"},
+	}
+	if err := s.Apply(&c); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if c.MinVersion != tls.VersionTLS12 ||
+		!slices.Equal(c.CipherSuites, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}) ||
+		!slices.Equal(c.CurvePreferences, []tls.CurveID{tls.X25519, tls.CurveP384}) {
+		t.Errorf("config = min %x, ciphers %v, curves %v", c.MinVersion, c.CipherSuites, c.CurvePreferences)
+	}
+
+	tests := []struct {
+		settings TLSSettings
+		want     string
+	}{
+		{TLSSettings{MinVersion: "1.4"}, "min_version must be 1.0, 1.1, 1.2, or 1.3"},
+		{TLSSettings{Ciphers: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, `ciphers: unknown or insecure cipher suite "TLS_RSA_WITH_RC4_128_SHA"`},
+		{TLSSettings{Ciphers: []string{"TLS_AES_128_GCM_SHA256"}}, "ciphers: TLS_AES_128_GCM_SHA256 is a TLS 1.3 suite, which can't be configured"},
+		{TLSSettings{Curves: []string{"P-192"}}, `curves: unknown curve "P-192" (available: X25519MLKEM768, X25519, P-256, P-384, P-521)`},
+	}
+	for _, tt := range tests {
+		if err := tt.settings.Apply(&tls.Config{}); err == nil || err.Error() != tt.want {
+			t.Errorf("Apply(%+v) = %v, want %q", tt.settings, err, tt.want)
+		}
+	}
+}
+
+func TestTLSSettingsValidate(t *testing.T) {
+	_, err := parseConfig(t, `
+proxy:
+  listen: "localhost:8081"
+  target: "https://localhost:8443"
+  upstream_tls_min_version: "1.4"
+  routes:
+    - methods: GET
+      paths: /v1/models
+      on_request:
+        - merge: { ok: true }
+`)
+	if err == nil || err.Error() != "proxy[0].upstream_tls_min_version must be 1.0, 1.1, 1.2, or 1.3" {
+		t.Fatalf("err = %v, want an invalid upstream_tls_min_version error", err)
+	}
+}
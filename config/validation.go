@@ -1,9 +1,12 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/url"
 	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/translate"
 )
 
 // Validate checks the entire configuration for errors
@@ -11,29 +14,199 @@ func Validate(config *Config) error {
 	if len(config.Proxies) == 0 {
 		return fmt.Errorf("proxy configuration is required")
 	}
+	if config.Patterns.MaxLength < 0 {
+		return fmt.Errorf("patterns.max_length cannot be negative")
+	}
+
+	if err := validateConditions(config.Conditions); err != nil {
+		return err
+	}
 
 	seenListeners := make(map[string]struct{})
 	for i, proxy := range config.Proxies {
 		if proxy.Listen == "" {
 			return fmt.Errorf("proxy[%d].listen is required", i)
 		}
-		if proxy.Target == "" {
+		if proxy.Target == "" && len(proxy.Targets) == 0 {
 			return fmt.Errorf("proxy[%d].target is required", i)
 		}
 
-		if _, err := url.Parse(proxy.Target); err != nil {
-			return fmt.Errorf("proxy[%d].target URL is invalid: %w", i, err)
+		for _, target := range proxy.AllTargets() {
+			if _, err := url.Parse(target); err != nil {
+				return fmt.Errorf("proxy[%d].target URL is invalid: %w", i, err)
+			}
+		}
+
+		for alias, backend := range proxy.Models.Aliases {
+			if alias == "" || backend == "" {
+				return fmt.Errorf("proxy[%d].models.aliases: alias and model names must be non-empty", i)
+			}
+		}
+		for model, window := range proxy.Models.ContextWindows {
+			if window <= 0 {
+				return fmt.Errorf("proxy[%d].models.context_windows: %s must be positive", i, model)
+			}
+		}
+		for model, price := range proxy.Models.Pricing {
+			if price.Prompt < 0 || price.Completion < 0 {
+				return fmt.Errorf("proxy[%d].models.pricing: %s prices cannot be negative", i, model)
+			}
+		}
+		if err := config.Proxies[i].Models.Allow.Validate(); err != nil {
+			return fmt.Errorf("proxy[%d].models.allow: %w", i, err)
+		}
+		if err := config.Proxies[i].Models.Vision.Validate(); err != nil {
+			return fmt.Errorf("proxy[%d].models.vision: %w", i, err)
+		}
+		if s := proxy.Session; s != nil {
+			if err := s.Validate(); err != nil {
+				return fmt.Errorf("proxy[%d].session: %w", i, err)
+			}
+		}
+		if a := proxy.Affinity; a != nil {
+			if a.Header == "" && a.Body == "" && a.Messages == 0 {
+				return fmt.Errorf("proxy[%d].affinity requires header, body, or messages", i)
+			}
+			if a.Messages < 0 {
+				return fmt.Errorf("proxy[%d].affinity.messages cannot be negative", i)
+			}
+		}
+		if o := config.Proxies[i].OutboundProxy; o != nil {
+			if err := o.Validate(); err != nil {
+				return fmt.Errorf("proxy[%d].outbound_proxy: %w", i, err)
+			}
+		}
+		if proxy.DNSRefresh < 0 {
+			return fmt.Errorf("proxy[%d].dns_refresh cannot be negative", i)
+		}
+		if proxy.UpstreamIdleTimeout < 0 || proxy.UpstreamKeepAlive < 0 {
+			return fmt.Errorf("proxy[%d].upstream_idle_timeout and upstream_keepalive cannot be negative", i)
+		}
+		if s := config.Proxies[i].Slots; s != nil {
+			if s.Interval < 0 || s.QueueTimeout < 0 || s.MaxQueue < 0 {
+				return fmt.Errorf("proxy[%d].slots values cannot be negative", i)
+			}
+			if s.Interval == 0 {
+				s.Interval = DefaultSlotsInterval
+			}
+			if s.QueueTimeout == 0 {
+				s.QueueTimeout = DefaultSlotsQueueTimeout
+			}
+			if s.BatchShare < 0 || s.BatchShare > 1 {
+				return fmt.Errorf("proxy[%d].slots.batch_share must be between 0 and 1", i)
+			}
+			if err := s.BatchKeys.Validate(); err != nil {
+				return fmt.Errorf("proxy[%d].slots.batch_keys: %w", i, err)
+			}
+		}
+		if err := config.Proxies[i].ForwardTrailers.Validate(); err != nil {
+			return fmt.Errorf("proxy[%d].forward_trailers: %w", i, err)
+		}
+		if h := proxy.DeadlineHeader; h != "" && strings.ContainsAny(h, " \t\r\n:") {
+			return fmt.Errorf("proxy[%d].deadline_header must be a header name", i)
+		}
+		if err := config.Proxies[i].LogRedact.Validate(); err != nil {
+			return fmt.Errorf("proxy[%d].log_redact: %w", i, err)
+		}
+		if proxy.MaxRequestBytes < 0 {
+			return fmt.Errorf("proxy[%d].max_request_bytes cannot be negative", i)
+		}
+		if proxy.BufferThreshold < 0 {
+			return fmt.Errorf("proxy[%d].buffer_threshold cannot be negative", i)
+		}
+		if proxy.StreamWorkers < 0 {
+			return fmt.Errorf("proxy[%d].stream_workers cannot be negative", i)
+		}
+		if r := proxy.Retry; r != nil {
+			if err := r.Validate(); err != nil {
+				return fmt.Errorf("proxy[%d].retry: %w", i, err)
+			}
+		}
+		if w := proxy.Warmup; w != nil {
+			if err := w.Validate(); err != nil {
+				return fmt.Errorf("proxy[%d].warmup: %w", i, err)
+			}
+		}
+		if n := proxy.NormalizePaths; n != nil {
+			if err := n.Validate(); err != nil {
+				return fmt.Errorf("proxy[%d].normalize_paths: %w", i, err)
+			}
+		}
+		if e := proxy.ErrorResponse; e != nil {
+			if err := e.Validate(); err != nil {
+				return fmt.Errorf("proxy[%d].error_response: %w", i, err)
+			}
+		}
+		if c := proxy.Conformance; c != nil {
+			if err := c.Validate(); err != nil {
+				return fmt.Errorf("proxy[%d].conformance: %w", i, err)
+			}
 		}
 
 		if (proxy.SSLCert != "" && proxy.SSLKey == "") ||
 			(proxy.SSLCert == "" && proxy.SSLKey != "") {
 			return fmt.Errorf("proxy[%d]: both ssl_cert and ssl_key must be provided together", i)
 		}
+		switch proxy.PlainHTTP {
+		case "", PlainHTTPRedirect, PlainHTTPError, PlainHTTPServe:
+		default:
+			return fmt.Errorf("proxy[%d].plain_http must be %s, %s, or %s", i, PlainHTTPRedirect, PlainHTTPError, PlainHTTPServe)
+		}
+		if proxy.PlainHTTP != "" && proxy.SSLCert == "" {
+			return fmt.Errorf("proxy[%d].plain_http requires ssl_cert and ssl_key", i)
+		}
+		// Apply's errors start with the setting's name, completing the key
+		if err := proxy.ListenerTLS().Apply(&tls.Config{}); err != nil {
+			return fmt.Errorf("proxy[%d].tls_%w", i, err)
+		}
+		if err := proxy.UpstreamTLS().Apply(&tls.Config{}); err != nil {
+			return fmt.Errorf("proxy[%d].upstream_tls_%w", i, err)
+		}
+		if !proxy.ListenerTLS().Empty() && proxy.SSLCert == "" {
+			return fmt.Errorf("proxy[%d]: tls_min_version, tls_ciphers, and tls_curves require ssl_cert and ssl_key", i)
+		}
+		for j, pair := range proxy.SSLCerts {
+			if pair.Cert == "" || pair.Key == "" {
+				return fmt.Errorf("proxy[%d].ssl_certs[%d]: both cert and key must be provided", i, j)
+			}
+		}
+		if len(proxy.SSLCerts) > 0 && proxy.SSLCert == "" {
+			return fmt.Errorf("proxy[%d].ssl_certs requires ssl_cert and ssl_key for the default certificate", i)
+		}
+		if r := proxy.RedirectHTTP; r != nil {
+			if proxy.SSLCert == "" {
+				return fmt.Errorf("proxy[%d].redirect_http requires ssl_cert and ssl_key", i)
+			}
+			if err := r.Validate(); err != nil {
+				return fmt.Errorf("proxy[%d].redirect_http: %w", i, err)
+			}
+		}
+		if proxy.SSLClientCA != "" && proxy.SSLCert == "" {
+			return fmt.Errorf("proxy[%d].ssl_client_ca requires ssl_cert and ssl_key", i)
+		}
+		if proxy.RequireClientCert && proxy.SSLClientCA == "" {
+			return fmt.Errorf("proxy[%d].require_client_cert requires ssl_client_ca", i)
+		}
+		if proxy.RequireClientCert && proxy.PlainHTTP == PlainHTTPServe {
+			// Plain HTTP has no certificate to check
+			return fmt.Errorf("proxy[%d].require_client_cert cannot be combined with plain_http: %s", i, PlainHTTPServe)
+		}
 
-		if _, exists := seenListeners[proxy.Listen]; exists {
-			return fmt.Errorf("proxy listeners must be unique; %s is duplicated", proxy.Listen)
+		for _, listen := range proxy.Listeners() {
+			if listen == "" || listen == UnixListenPrefix {
+				return fmt.Errorf("proxy[%d].listen: addresses must be non-empty", i)
+			}
+			if _, exists := seenListeners[listen]; exists {
+				return fmt.Errorf("proxy listeners must be unique; %s is duplicated", listen)
+			}
+			seenListeners[listen] = struct{}{}
+		}
+		if r := proxy.RedirectHTTP; r != nil {
+			if _, exists := seenListeners[r.Listen]; exists {
+				return fmt.Errorf("proxy listeners must be unique; %s is duplicated", r.Listen)
+			}
+			seenListeners[r.Listen] = struct{}{}
 		}
-		seenListeners[proxy.Listen] = struct{}{}
 
 		if len(proxy.Routes) == 0 {
 			return fmt.Errorf("proxy[%d].routes is required", i)
@@ -42,9 +215,98 @@ func Validate(config *Config) error {
 			if err := validateRoute(&proxy.Routes[j], j); err != nil {
 				return err
 			}
+			if err := validateRoutePatterns(&proxy.Routes[j], j, config.Patterns); err != nil {
+				return err
+			}
+			if err := validatePresetRefs(&proxy.Routes[j], j, config.Presets); err != nil {
+				return err
+			}
+			if err := validateConditionRefs(&proxy.Routes[j], j, config.Conditions); err != nil {
+				return err
+			}
+			if p := proxy.Routes[j].Priority; p != "" && p != PriorityInteractive && p != PriorityBatch {
+				return fmt.Errorf("route %d: priority must be %s or %s", j, PriorityInteractive, PriorityBatch)
+			}
+			if proxy.Routes[j].Priority != "" && proxy.Slots == nil {
+				return fmt.Errorf("route %d: priority requires slots scheduling (proxy[%d].slots)", j, i)
+			}
+			if proxy.Routes[j].Retry && proxy.Retry == nil {
+				return fmt.Errorf("route %d: retry requires the proxy's retry policy (proxy[%d].retry)", j, i)
+			}
+		}
+		if err := validateKeys(proxy.Keys, proxy.Routes, config.Presets, config.Conditions); err != nil {
+			return fmt.Errorf("proxy[%d].%w", i, err)
 		}
 	}
 
+	if config.Admin.Listen != "" {
+		if _, exists := seenListeners[config.Admin.Listen]; exists {
+			return fmt.Errorf("admin.listen %s is already used by a proxy", config.Admin.Listen)
+		}
+	}
+	if config.Admin.Pprof && config.Admin.Listen == "" {
+		return fmt.Errorf("admin.pprof requires admin.listen")
+	}
+	if dashboard := config.Admin.Dashboard; dashboard != nil {
+		if config.Admin.Listen == "" {
+			return fmt.Errorf("admin.dashboard requires admin.listen")
+		}
+		if err := dashboard.Validate(); err != nil {
+			return fmt.Errorf("admin.dashboard: %w", err)
+		}
+	}
+	if config.Audit != nil && config.Audit.File == "" {
+		return fmt.Errorf("audit.file is required")
+	}
+	if config.Memory != nil {
+		if err := config.Memory.Validate(); err != nil {
+			return fmt.Errorf("memory: %w", err)
+		}
+	}
+	if config.Reload != nil {
+		if err := config.Reload.Validate(); err != nil {
+			return fmt.Errorf("reload: %w", err)
+		}
+	}
+	if l := config.Logging; l.Sample < 0 || l.RepeatLimit < 0 || l.RepeatWindow < 0 {
+		return fmt.Errorf("logging values cannot be negative")
+	}
+	switch config.Logging.Output {
+	case "", LogStdout, LogStderr, LogSyslog, LogJournald:
+	default:
+		return fmt.Errorf("logging.output must be %s, %s, %s, or %s", LogStdout, LogStderr, LogSyslog, LogJournald)
+	}
+	if config.Logging.Syslog != "" && config.Logging.Output != LogSyslog {
+		return fmt.Errorf("logging.syslog requires output: %s", LogSyslog)
+	}
+
+	return nil
+}
+
+// validateRoutePatterns applies the patterns: limits to a route's methods and paths
+func validateRoutePatterns(route *Route, index int, limits PatternsConfig) error {
+	maxLength := limits.MaxLength
+	if maxLength == 0 {
+		maxLength = DefaultMaxPatternLength
+	}
+	for _, field := range []struct {
+		name     string
+		patterns []string
+	}{{"methods", route.Methods.Patterns}, {"paths", route.Paths.Patterns}} {
+		for _, pattern := range field.patterns {
+			if len(pattern) > maxLength {
+				return fmt.Errorf("route %d %s: pattern is %d characters, over patterns.max_length (%d)", index, field.name, len(pattern), maxLength)
+			}
+		}
+	}
+
+	if limits.RequireAnchors {
+		for _, pattern := range route.Paths.Patterns {
+			if !strings.HasPrefix(pattern, "^") || !(strings.HasSuffix(pattern, "$") || strings.HasSuffix(pattern, "/")) {
+				return fmt.Errorf("route %d paths: '%s' must start with ^ and end with $ or / (patterns.require_anchors)", index, pattern)
+			}
+		}
+	}
 	return nil
 }
 
@@ -55,12 +317,141 @@ func validateRoute(route *Route, index int) error {
 	if route.Paths.Len() == 0 {
 		return fmt.Errorf("route %d: paths required", index)
 	}
+	if err := validateFuncs(route.Funcs); err != nil {
+		return fmt.Errorf("route %d: %w", index, err)
+	}
+	if route.State != nil {
+		if err := route.State.Validate(); err != nil {
+			return fmt.Errorf("route %d: state: %w", index, err)
+		}
+	}
+
+	if route.ResponseTimeout < 0 || route.FirstByteTimeout < 0 || route.IdleChunkTimeout < 0 {
+		return fmt.Errorf("route %d: timeouts cannot be negative", index)
+	}
+	if len(route.OnRequest) == 0 && len(route.OnResponse) == 0 && route.Format == "" && route.Context == nil && route.Images == nil && route.Files == nil && route.Embeddings == nil && route.Prompt == nil && route.StructuredOutput == nil && route.Reasoning == nil && route.Moderation == nil && route.Choices == nil && !route.Trace && !route.Retry && route.Priority == "" && !route.HasTimeouts() && route.Options == nil {
+		return fmt.Errorf("route %d: at least one action required (on_request, on_response, format, context, images, files, embeddings, prompt, structured_output, reasoning, moderation, choices, trace, retry, priority, options, or a timeout)", index)
+	}
+
+	if route.Options != nil {
+		if err := route.Options.Validate(); err != nil {
+			return fmt.Errorf("route %d: options: %w", index, err)
+		}
+	}
+
+	if route.Format != "" && translate.Lookup(route.Format) == nil {
+		return fmt.Errorf("route %d: unknown format '%s' (available: %s)", index, route.Format, strings.Join(translate.Names(), ", "))
+	}
+
+	if route.Context != nil {
+		switch route.Context.Overflow {
+		case "":
+			route.Context.Overflow = OverflowTruncate
+		case OverflowTruncate, OverflowReject:
+		default:
+			return fmt.Errorf("route %d: context.overflow must be %s or %s", index, OverflowTruncate, OverflowReject)
+		}
+		if route.Context.MaxTokens != "" && route.Context.MaxTokens != MaxTokensAuto {
+			return fmt.Errorf("route %d: context.max_tokens must be %s", index, MaxTokensAuto)
+		}
+		if route.Context.Margin < 0 {
+			return fmt.Errorf("route %d: context.margin cannot be negative", index)
+		}
+		switch route.Context.Retry {
+		case "", OverflowTruncate, RetryMaxTokens:
+		default:
+			return fmt.Errorf("route %d: context.retry must be %s or %s", index, OverflowTruncate, RetryMaxTokens)
+		}
+	}
+
+	if route.Images != nil {
+		switch route.Images.Overflow {
+		case "":
+			route.Images.Overflow = OverflowStrip
+		case OverflowStrip, OverflowReject:
+		default:
+			return fmt.Errorf("route %d: images.overflow must be %s or %s", index, OverflowStrip, OverflowReject)
+		}
+		if route.Images.MaxBytes < 0 || route.Images.MaxCount < 0 || route.Images.MaxDimension < 0 {
+			return fmt.Errorf("route %d: images limits cannot be negative", index)
+		}
+	}
+
+	if route.Files != nil && route.Files.MaxBytes <= 0 {
+		return fmt.Errorf("route %d: files.max_bytes must be positive", index)
+	}
+
+	if route.Prompt != nil {
+		if route.Prompt.Template == "" && len(route.Prompt.Models) == 0 {
+			return fmt.Errorf("route %d: prompt requires a template or models", index)
+		}
+		if route.Format != "" {
+			return fmt.Errorf("route %d: prompt cannot be combined with format", index)
+		}
+	}
+
+	if route.StructuredOutput != nil {
+		switch route.StructuredOutput.Mode {
+		case "", StructuredLlamaCpp, StructuredOllama, StructuredStrip:
+		default:
+			return fmt.Errorf("route %d: structured_output.mode must be %s, %s, or %s", index, StructuredLlamaCpp, StructuredOllama, StructuredStrip)
+		}
+	}
+
+	if route.Reasoning != nil {
+		switch route.Reasoning.Mode {
+		case "":
+			route.Reasoning.Mode = ReasoningField
+		case ReasoningField, ReasoningStrip:
+		default:
+			return fmt.Errorf("route %d: reasoning.mode must be %s or %s", index, ReasoningField, ReasoningStrip)
+		}
+		if route.Reasoning.Field == "" {
+			route.Reasoning.Field = DefaultReasoningField
+		}
+	}
+
+	if route.Moderation != nil {
+		switch route.Moderation.Action {
+		case "":
+			route.Moderation.Action = ModerationBlock
+		case ModerationBlock, ModerationRedact, ModerationAnnotate:
+		default:
+			return fmt.Errorf("route %d: moderation.action must be %s, %s, or %s", index, ModerationBlock, ModerationRedact, ModerationAnnotate)
+		}
+		if route.Moderation.Patterns.Len() == 0 && route.Moderation.Endpoint == "" {
+			return fmt.Errorf("route %d: moderation requires patterns or an endpoint", index)
+		}
+		if err := route.Moderation.Patterns.Validate(); err != nil {
+			return fmt.Errorf("route %d moderation.patterns: %w", index, err)
+		}
+		if route.Moderation.Endpoint != "" {
+			if u, err := url.Parse(route.Moderation.Endpoint); err != nil || u.Host == "" {
+				return fmt.Errorf("route %d: moderation.endpoint must be an absolute URL", index)
+			}
+		}
+		if route.Moderation.Timeout == 0 {
+			route.Moderation.Timeout = DefaultModerationTimeout
+		}
+	}
 
-	if len(route.OnRequest) == 0 && len(route.OnResponse) == 0 {
-		return fmt.Errorf("route %d: at least one action required (on_request or on_response)", index)
+	if route.Embeddings != nil && route.Embeddings.BatchSize < 1 {
+		return fmt.Errorf("route %d: embeddings.batch_size must be positive", index)
 	}
 
-	if route.TargetPath != "" && !strings.HasPrefix(route.TargetPath, "/") {
+	if route.Choices != nil {
+		if route.Choices.Max < 0 || route.Choices.Concurrency < 0 {
+			return fmt.Errorf("route %d: choices limits cannot be negative", index)
+		}
+		if route.Choices.Max == 0 {
+			route.Choices.Max = DefaultChoicesMax
+		}
+		if route.Choices.Concurrency == 0 {
+			route.Choices.Concurrency = DefaultChoicesConcurrency
+		}
+	}
+
+	if route.TargetPath != "" && !strings.HasPrefix(route.TargetPath, "/") && !route.TargetPathTemplated() {
 		return fmt.Errorf("route %d: target_path must be absolute", index)
 	}
 
@@ -70,17 +461,20 @@ func validateRoute(route *Route, index int) error {
 	if err := route.Paths.Validate(); err != nil {
 		return fmt.Errorf("route %d paths: %w", index, err)
 	}
+	if err := route.ContentTypes.Validate(); err != nil {
+		return fmt.Errorf("route %d content_types: %w", index, err)
+	}
 
 	// Validate on_request actions
-	for opIdx, op := range route.OnRequest {
-		if err := validateAction(&op, index, opIdx, "on_request"); err != nil {
+	for opIdx := range route.OnRequest {
+		if err := validateAction(&route.OnRequest[opIdx], index, opIdx, "on_request"); err != nil {
 			return err
 		}
 	}
 
 	// Validate on_response actions
-	for opIdx, op := range route.OnResponse {
-		if err := validateAction(&op, index, opIdx, "on_response"); err != nil {
+	for opIdx := range route.OnResponse {
+		if err := validateAction(&route.OnResponse[opIdx], index, opIdx, "on_response"); err != nil {
 			return err
 		}
 	}
@@ -89,31 +483,132 @@ func validateRoute(route *Route, index int) error {
 }
 
 func validateAction(op *Action, ruleIndex, opIndex int, opType string) error {
+	return validateActionAt(op, fmt.Sprintf("route %d %s %d", ruleIndex, opType, opIndex), opType)
+}
+
+// validateActionAt validates an action, or a group and its actions; errors start with at
+func validateActionAt(op *Action, at, opType string) error {
 	// Check for mutual exclusivity
 	if op.When != nil && len(op.WhenAny) > 0 {
-		return fmt.Errorf("route %d %s %d: cannot specify both when and when_any", ruleIndex, opType, opIndex)
+		return fmt.Errorf("%s: cannot specify both when and when_any", at)
 	}
 
-	// Convert when_any to when with OR
+	// Convert when_any to when with OR, once, so a second validation sees only when
 	if len(op.WhenAny) > 0 {
 		op.When = &BoolExpr{Or: op.WhenAny}
+		op.WhenAny = nil
 	}
 
 	// Validate when expression if present
 	if op.When != nil {
 		if err := op.When.Validate(); err != nil {
-			return fmt.Errorf("route %d %s %d when: %w", ruleIndex, opType, opIndex, err)
+			return fmt.Errorf("%s when: %w", at, err)
+		}
+	}
+
+	if err := op.ParamMap.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", at, err)
+	}
+
+	if op.NormalizeStop != nil {
+		if err := op.NormalizeStop.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", at, err)
+		}
+	}
+
+	if op.Redact != nil {
+		if err := op.Redact.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", at, err)
+		}
+	}
+
+	if op.Seed != nil {
+		if err := op.Seed.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", at, err)
+		}
+	}
+
+	if op.Schema != nil {
+		if opType != "on_request" {
+			return fmt.Errorf("%s: validate_schema only checks requests (on_request)", at)
+		}
+		if err := op.Schema.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", at, err)
 		}
 	}
 
-	// Template is a valid standalone action
-	if op.Template != "" {
+	if len(op.FromRequest) > 0 {
+		if opType != "on_response" {
+			return fmt.Errorf("%s: from_request copies into replies (on_response)", at)
+		}
+		if err := validateFromRequest(op.FromRequest); err != nil {
+			return fmt.Errorf("%s: %w", at, err)
+		}
+	}
+
+	// else runs when the when doesn't match, so it needs one
+	if op.Else != nil || len(op.ElseActions) > 0 {
+		if op.When == nil {
+			return fmt.Errorf("%s: else and else_actions need a when (or when_any)", at)
+		}
+		if op.Else != nil && len(op.ElseActions) > 0 {
+			return fmt.Errorf("%s: cannot specify both else and else_actions", at)
+		}
+		if op.Else != nil {
+			if err := validateActionAt(op.Else, at+" else", opType); err != nil {
+				return err
+			}
+			op.ElseActions, op.Else = []Action{*op.Else}, nil
+		} else {
+			for i := range op.ElseActions {
+				if err := validateActionAt(&op.ElseActions[i], fmt.Sprintf("%s else_actions[%d]", at, i), opType); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	transforms := op.Template != "" || len(op.Merge) > 0 || len(op.Default) > 0 || len(op.Delete) > 0 || !op.ParamMap.IsZero() || op.ApplyPreset != nil || op.NormalizeStop != nil || op.Redact != nil || op.Seed != nil || op.Schema != nil || len(op.FromRequest) > 0
+
+	// A group shares its when; what runs is up to its actions
+	if len(op.Actions) > 0 {
+		if transforms {
+			return fmt.Errorf("%s: a group with actions takes only when, when_any, and stop alongside them", at)
+		}
+		for i := range op.Actions {
+			if err := validateActionAt(&op.Actions[i], fmt.Sprintf("%s actions[%d]", at, i), opType); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
 
-	if len(op.Merge) == 0 && len(op.Default) == 0 && len(op.Delete) == 0 {
-		return fmt.Errorf("route %d %s %d: must have at least one action (template, merge, default, or delete)", ruleIndex, opType, opIndex)
+	// An action with only an else acts when its when doesn't match
+	if !transforms && len(op.ElseActions) == 0 {
+		return fmt.Errorf("%s: must have at least one action (template, merge, default, delete, param_map, apply_preset, normalize_stop, redact, seed, validate_schema, from_request, or actions)", at)
 	}
 
 	return nil
 }
+
+// validatePresetRefs checks apply_preset actions against the configured presets
+func validatePresetRefs(route *Route, index int, presets map[string]map[string]any) error {
+	phases := []struct {
+		name string
+		ops  []Action
+	}{{"on_request", route.OnRequest}, {"on_response", route.OnResponse}}
+	for _, phase := range phases {
+		for opIdx := range phase.ops {
+			var err error
+			WalkActions(phase.ops[opIdx:opIdx+1], func(op *Action) {
+				if op.ApplyPreset != nil && err == nil {
+					err = op.ApplyPreset.Validate(presets)
+				}
+			})
+			if err != nil {
+				return fmt.Errorf("route %d %s %d: %w", index, phase.name, opIdx, err)
+			}
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestValidateConfig(t *testing.T) {
@@ -102,6 +103,46 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: true,
 			errMsg:  "both ssl_cert and ssl_key must be provided together",
 		},
+		{
+			name: "plain_http without SSL",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen:    "localhost:8081",
+					Target:    "http://localhost:8080",
+					PlainHTTP: PlainHTTPRedirect,
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "proxy[0].plain_http requires ssl_cert and ssl_key",
+		},
+		{
+			name: "unknown plain_http mode",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen:    "localhost:8081",
+					Target:    "http://localhost:8080",
+					SSLCert:   "cert.pem",
+					SSLKey:    "key.pem",
+					PlainHTTP: "upgrade",
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "proxy[0].plain_http must be redirect, error, or serve",
+		},
 		{
 			name: "SSL key without cert",
 			config: &Config{
@@ -121,6 +162,411 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: true,
 			errMsg:  "both ssl_cert and ssl_key must be provided together",
 		},
+		{
+			name: "invalid models allow pattern",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Models: ModelsConfig{Allow: PatternField{Patterns: []string{"qwen[("}}},
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "models.allow",
+		},
+		{
+			name: "admin listener reuses proxy listener",
+			config: &Config{
+				Admin: AdminConfig{Listen: "localhost:8081"},
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "admin.listen",
+		},
+		{
+			name: "dashboard without admin listener",
+			config: &Config{
+				Admin: AdminConfig{Dashboard: &DashboardConfig{}},
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "admin.dashboard requires admin.listen",
+		},
+		{
+			name: "pprof without admin listener",
+			config: &Config{
+				Admin: AdminConfig{Pprof: true},
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "admin.pprof requires admin.listen",
+		},
+		{
+			name: "audit without file",
+			config: &Config{
+				Audit: &AuditConfig{},
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "audit.file is required",
+		},
+		{
+			name: "memory without limit",
+			config: &Config{
+				Memory: &MemoryConfig{LargeBody: 1024},
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "memory: limit must be positive",
+		},
+		{
+			name: "path without anchors when required",
+			config: &Config{
+				Patterns: PatternsConfig{RequireAnchors: true},
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("^/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "route 0 paths: '^/v1/chat' must start with ^ and end with $ or / (patterns.require_anchors)",
+		},
+		{
+			name: "anchored paths when required",
+			config: &Config{
+				Patterns: PatternsConfig{RequireAnchors: true},
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     PatternField{Patterns: []string{"^/v1/chat$", "^/api/"}},
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "pattern over max length",
+			config: &Config{
+				Patterns: PatternsConfig{MaxLength: 8},
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("^/v1/chat/completions$"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "route 0 paths: pattern is 22 characters, over patterns.max_length (8)",
+		},
+		{
+			name: "negative log sampling",
+			config: &Config{
+				Logging: LoggingConfig{Sample: -1},
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "logging values cannot be negative",
+		},
+		{
+			name: "unknown log output",
+			config: &Config{
+				Logging: LoggingConfig{Output: "file"},
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "logging.output must be",
+		},
+		{
+			name: "route retry without proxy retry",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Routes: []Route{
+						{
+							Methods: newPatternField("POST"),
+							Paths:   newPatternField("/v1/embeddings"),
+							Retry:   true,
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "route 0: retry requires the proxy's retry policy",
+		},
+		{
+			name: "unknown route priority",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Slots:  &SlotsConfig{},
+					Routes: []Route{
+						{
+							Methods:  newPatternField("POST"),
+							Paths:    newPatternField("/v1/batch"),
+							Priority: "urgent",
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "route 0: priority must be interactive or batch",
+		},
+		{
+			name: "key allowlist naming an unknown route",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Keys:   []APIKey{{Key: "sk-team-a", Routes: []string{"chat"}}},
+					Routes: []Route{
+						{
+							Name:      "completions",
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  `proxy[0].keys[0]: routes: no route named "chat"`,
+		},
+		{
+			name: "session without header or body",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen:  "localhost:8081",
+					Target:  "http://localhost:8080",
+					Session: &SessionConfig{Idle: time.Hour},
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "proxy[0].session: requires header or body",
+		},
+		{
+			name: "key action matching status",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen: "localhost:8081",
+					Target: "http://localhost:8080",
+					Keys: []APIKey{{Key: "sk-team-a", OnRequest: []Action{{
+						When:  &BoolExpr{Status: newPatternField("^5")},
+						Merge: map[string]any{"user": "team-a"},
+					}}}},
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "proxy[0].keys[0]: on_request 0: when: key actions can't match state, status, or request",
+		},
+		{
+			name: "error_response status out of range",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen:        "localhost:8081",
+					Target:        "http://localhost:8080",
+					ErrorResponse: &ErrorResponse{Status: 200},
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "error_response: status must be a 4xx or 5xx code",
+		},
+		{
+			name: "error_response body template invalid",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen:        "localhost:8081",
+					Target:        "http://localhost:8080",
+					ErrorResponse: &ErrorResponse{Body: `{"error": {{ .message }`},
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "error_response: body:",
+		},
+		{
+			name: "ssl_certs pair without key",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen:   "localhost:8081",
+					Target:   "http://localhost:8080",
+					SSLCert:  "cert.pem",
+					SSLKey:   "key.pem",
+					SSLCerts: []SSLCertPair{{Cert: "chat.pem"}},
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "proxy[0].ssl_certs[0]: both cert and key must be provided",
+		},
+		{
+			name: "require_client_cert without ssl_client_ca",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen:            "localhost:8081",
+					Target:            "http://localhost:8080",
+					SSLCert:           "cert.pem",
+					SSLKey:            "key.pem",
+					RequireClientCert: true,
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "proxy[0].require_client_cert requires ssl_client_ca",
+		},
+		{
+			name: "deadline_header not a header name",
+			config: &Config{
+				Proxies: ProxyEntries{{
+					Listen:         "localhost:8081",
+					Target:         "http://localhost:8080",
+					DeadlineHeader: "X-Request-Deadline: now",
+					Routes: []Route{
+						{
+							Methods:   newPatternField("POST"),
+							Paths:     newPatternField("/v1/chat"),
+							OnRequest: []Action{{Merge: map[string]any{"temp": 0.7}}},
+						},
+					},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "proxy[0].deadline_header must be a header name",
+		},
 	}
 
 	for _, tt := range tests {
@@ -233,6 +679,142 @@ func TestValidateRoute(t *testing.T) {
 			wantErr: true,
 			errMsg:  "at least one action required",
 		},
+		{
+			name: "format only",
+			rule: Route{
+				Methods: newPatternField("POST"),
+				Paths:   newPatternField("/v1/chat/completions"),
+				Format:  "openai-to-ollama",
+			},
+			wantErr: false,
+		},
+		{
+			name: "timeouts only",
+			rule: Route{
+				Methods:          newPatternField("POST"),
+				Paths:            newPatternField("/v1/chat/completions"),
+				FirstByteTimeout: time.Minute,
+				IdleChunkTimeout: 10 * time.Second,
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative timeout",
+			rule: Route{
+				Methods:         newPatternField("POST"),
+				Paths:           newPatternField("/v1/chat/completions"),
+				ResponseTimeout: -time.Second,
+			},
+			wantErr: true,
+			errMsg:  "timeouts cannot be negative",
+		},
+		{
+			name: "options only",
+			rule: Route{
+				Methods: newPatternField("POST"),
+				Paths:   newPatternField("/v1/chat"),
+				Options: &OptionsReply{Headers: map[string]string{"Allow": "POST, OPTIONS"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "options status not 2xx",
+			rule: Route{
+				Methods: newPatternField("POST"),
+				Paths:   newPatternField("/v1/chat"),
+				Options: &OptionsReply{Status: 404},
+			},
+			wantErr: true,
+			errMsg:  "options: status must be a 2xx code",
+		},
+		{
+			name: "unknown format",
+			rule: Route{
+				Methods: newPatternField("POST"),
+				Paths:   newPatternField("/v1/chat/completions"),
+				Format:  "openai-to-klingon",
+			},
+			wantErr: true,
+			errMsg:  "unknown format",
+		},
+		{
+			name: "context only",
+			rule: Route{
+				Methods: newPatternField("POST"),
+				Paths:   newPatternField("/v1/chat/completions"),
+				Context: &ContextPolicy{Overflow: OverflowReject},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown context overflow",
+			rule: Route{
+				Methods: newPatternField("POST"),
+				Paths:   newPatternField("/v1/chat/completions"),
+				Context: &ContextPolicy{Overflow: "summarize"},
+			},
+			wantErr: true,
+			errMsg:  "context.overflow must be",
+		},
+		{
+			name: "unknown context max_tokens",
+			rule: Route{
+				Methods: newPatternField("POST"),
+				Paths:   newPatternField("/v1/chat/completions"),
+				Context: &ContextPolicy{MaxTokens: "lots"},
+			},
+			wantErr: true,
+			errMsg:  "context.max_tokens must be auto",
+		},
+		{
+			name: "images only",
+			rule: Route{
+				Methods: newPatternField("POST"),
+				Paths:   newPatternField("/v1/chat/completions"),
+				Images:  &ImagePolicy{MaxBytes: 1 << 20},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown images overflow",
+			rule: Route{
+				Methods: newPatternField("POST"),
+				Paths:   newPatternField("/v1/chat/completions"),
+				Images:  &ImagePolicy{Overflow: "truncate"},
+			},
+			wantErr: true,
+			errMsg:  "images.overflow must be",
+		},
+		{
+			name: "unknown structured output mode",
+			rule: Route{
+				Methods:          newPatternField("POST"),
+				Paths:            newPatternField("/v1/chat/completions"),
+				StructuredOutput: &StructuredOutputPolicy{Mode: "vllm"},
+			},
+			wantErr: true,
+			errMsg:  "structured_output.mode must be",
+		},
+		{
+			name: "unknown reasoning mode",
+			rule: Route{
+				Methods:   newPatternField("POST"),
+				Paths:     newPatternField("/v1/chat/completions"),
+				Reasoning: &ReasoningPolicy{Mode: "hide"},
+			},
+			wantErr: true,
+			errMsg:  "reasoning.mode must be",
+		},
+		{
+			name: "embeddings without batch size",
+			rule: Route{
+				Methods:    newPatternField("POST"),
+				Paths:      newPatternField("/v1/embeddings"),
+				Embeddings: &EmbeddingsPolicy{},
+			},
+			wantErr: true,
+			errMsg:  "embeddings.batch_size must be positive",
+		},
 		{
 			name: "invalid target path (not absolute)",
 			rule: Route{
@@ -386,6 +968,76 @@ func TestValidateAction(t *testing.T) {
 			wantErr: true,
 			errMsg:  "invalid regex pattern",
 		},
+		{
+			name: "group of actions",
+			op: Action{
+				When:    &BoolExpr{Body: map[string]PatternField{"model": newPatternField("qwen")}},
+				Actions: []Action{{Merge: map[string]any{"top_k": 20}}, {Delete: []string{"seed"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "group mixed with a transform",
+			op: Action{
+				Merge:   map[string]any{"temp": 0.7},
+				Actions: []Action{{Merge: map[string]any{"top_k": 20}}},
+			},
+			wantErr: true,
+			errMsg:  "a group with actions takes only when",
+		},
+		{
+			name: "empty action inside a group",
+			op: Action{
+				Actions: []Action{{Merge: map[string]any{"top_k": 20}}, {Stop: true}},
+			},
+			wantErr: true,
+			errMsg:  "route 0 on_request 0 actions[1]: must have at least one action",
+		},
+		{
+			name: "else with when",
+			op: Action{
+				When:  &BoolExpr{Body: map[string]PatternField{"model": newPatternField("qwen")}},
+				Merge: map[string]any{"top_k": 20},
+				Else:  &Action{Merge: map[string]any{"top_k": 40}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "else only",
+			op: Action{
+				When:        &BoolExpr{Body: map[string]PatternField{"model": newPatternField("qwen")}},
+				ElseActions: []Action{{Merge: map[string]any{"top_k": 40}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "else without when",
+			op: Action{
+				Merge: map[string]any{"top_k": 20},
+				Else:  &Action{Merge: map[string]any{"top_k": 40}},
+			},
+			wantErr: true,
+			errMsg:  "else and else_actions need a when",
+		},
+		{
+			name: "else and else_actions",
+			op: Action{
+				When:        &BoolExpr{Body: map[string]PatternField{"model": newPatternField("qwen")}},
+				Else:        &Action{Merge: map[string]any{"top_k": 40}},
+				ElseActions: []Action{{Merge: map[string]any{"top_k": 40}}},
+			},
+			wantErr: true,
+			errMsg:  "cannot specify both else and else_actions",
+		},
+		{
+			name: "empty else",
+			op: Action{
+				When: &BoolExpr{Body: map[string]PatternField{"model": newPatternField("qwen")}},
+				Else: &Action{Stop: true},
+			},
+			wantErr: true,
+			errMsg:  "route 0 on_request 0 else: must have at least one action",
+		},
 	}
 
 	for _, tt := range tests {
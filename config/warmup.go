@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WarmupConfig sends requests through a proxy's own routes at startup and then every
+// interval, to keep models loaded and prompt caches warm. Results show in /readyz.
+type WarmupConfig struct {
+	Interval time.Duration   `yaml:"interval,omitempty"` // Repeat period; 0 sends once at startup
+	Timeout  time.Duration   `yaml:"timeout,omitempty"`  // Longest wait per request; defaults to 60s
+	Requests []WarmupRequest `yaml:"requests"`
+}
+
+// WarmupRequest is one request to send. With models, it is sent once per model with the
+// body's model field set to each.
+type WarmupRequest struct {
+	Name    string            `yaml:"name,omitempty"`    // Label in health status; defaults to method and path
+	Method  string            `yaml:"method,omitempty"`  // Defaults to POST
+	Path    string            `yaml:"path"`              // Ex: /v1/chat/completions
+	Headers map[string]string `yaml:"headers,omitempty"` // Ex: Authorization for routes that check it
+	Body    map[string]any    `yaml:"body,omitempty"`    // JSON body, ex: { max_tokens: 1, messages: [...] }
+	Models  []string          `yaml:"models,omitempty"`  // One request per model
+}
+
+// DefaultWarmupTimeout bounds a warm-up request that sets no timeout
+const DefaultWarmupTimeout = 60 * time.Second
+
+// Validate normalizes defaults
+func (w *WarmupConfig) Validate() error {
+	if w.Interval < 0 || w.Timeout < 0 {
+		return fmt.Errorf("interval and timeout cannot be negative")
+	}
+	if w.Timeout == 0 {
+		w.Timeout = DefaultWarmupTimeout
+	}
+	if len(w.Requests) == 0 {
+		return fmt.Errorf("at least one request required")
+	}
+	for i := range w.Requests {
+		r := &w.Requests[i]
+		if !strings.HasPrefix(r.Path, "/") {
+			return fmt.Errorf("requests[%d].path must start with /", i)
+		}
+		r.Method = strings.ToUpper(r.Method)
+		if r.Method == "" {
+			r.Method = http.MethodPost
+		}
+		if r.Name == "" {
+			r.Name = r.Method + " " + r.Path
+		}
+	}
+	return nil
+}
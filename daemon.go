@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// daemonEnv marks the background copy started by -daemon, so it runs instead of forking again
+const daemonEnv = "LLAMA_MATCHMAKER_DAEMON"
+
+func isDaemonChild() bool {
+	return os.Getenv(daemonEnv) == "1"
+}
+
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+}
+
+// writePIDFile records this process's ID, refusing when the file names a process that is
+// still running. Files left behind by a crash are replaced.
+func writePIDFile(path string) error {
+	if data, err := os.ReadFile(path); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid != os.Getpid() && processAlive(pid) {
+			return fmt.Errorf("%s: already running as pid %d", path, pid)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWritePIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.pid")
+	if err := writePIDFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("pid file = %q, want %d", data, os.Getpid())
+	}
+
+	// A file naming a process that has exited is left over from a crash
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)), 0o644)
+	if err := writePIDFile(path); err != nil {
+		t.Fatalf("stale pid file: %v", err)
+	}
+
+	// A running process keeps its file
+	sleeper := exec.Command("sleep", "5")
+	if err := sleeper.Start(); err != nil {
+		t.Skip("no sleep command to hold a pid")
+	}
+	defer sleeper.Process.Kill()
+	os.WriteFile(path, []byte(strconv.Itoa(sleeper.Process.Pid)), 0o644)
+	if err := writePIDFile(path); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("live pid file: err = %v, want already running", err)
+	}
+}
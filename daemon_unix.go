@@ -0,0 +1,73 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// daemonize starts this command again in a new session, detached from the terminal, with
+// output going to logFile (or discarded). It waits briefly so startup failures, such as
+// an invalid config, are reported here rather than lost.
+func daemonize(logFile string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if logFile != "" {
+		out, err = openLogFile(logFile)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdout, cmd.Stderr = out, out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		if err == nil {
+			err = errors.New("exit status 0")
+		}
+		where := "run without -daemon to see why"
+		if logFile != "" {
+			where = "see " + logFile
+		}
+		return 0, fmt.Errorf("background process exited during startup: %v; %s", err, where)
+	case <-time.After(500 * time.Millisecond):
+	}
+	return cmd.Process.Pid, nil
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func runningAsService() bool {
+	return false
+}
+
+func runAsService(run func(stop <-chan os.Signal)) error {
+	return errors.New("Windows services are not supported on this platform")
+}
+
+// notifyReloadSignal sends SIGHUP to ch, which reloads the config
+func notifyReloadSignal(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGHUP)
+}
@@ -4,7 +4,6 @@ go 1.25.0
 
 require (
 	github.com/fsnotify/fsnotify v1.9.0
+	golang.org/x/sys v0.13.0
 	gopkg.in/yaml.v3 v3.0.1
 )
-
-require golang.org/x/sys v0.13.0 // indirect
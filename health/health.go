@@ -0,0 +1,192 @@
+// Package health answers liveness and readiness probes: whether the config is valid and
+// whether each proxy has a target that passes health checks.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Probe paths, served on the admin listener and on proxies with health_endpoints
+const (
+	LivePath  = "/healthz"
+	ReadyPath = "/readyz"
+)
+
+// Target is one backend of a proxy. Up is nil until a health check (slots polling) reports.
+type Target struct {
+	URL     string     `json:"url"`
+	Up      *bool      `json:"up,omitempty"`
+	Checked *time.Time `json:"checked,omitempty"`
+}
+
+// Warmup is the last result of one of a proxy's warm-up requests. It is reported only;
+// a failing warm-up doesn't make the proxy unready.
+type Warmup struct {
+	Name     string    `json:"name"`
+	OK       bool      `json:"ok"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Duration string    `json:"duration"`
+	Checked  time.Time `json:"checked"`
+}
+
+// Proxy is ready when any of its targets isn't known to be down
+type Proxy struct {
+	Listen  string   `json:"listen"`
+	Ready   bool     `json:"ready"`
+	Targets []Target `json:"targets"`
+	Warmups []Warmup `json:"warmups,omitempty"`
+}
+
+// Status is the readiness report
+type Status struct {
+	Ready       bool    `json:"ready"`
+	ConfigError string  `json:"config_error,omitempty"` // Why the last load or reload failed
+	Proxies     []Proxy `json:"proxies"`
+}
+
+// Checker tracks config validity and target health
+type Checker struct {
+	mu        sync.Mutex
+	configErr string
+	proxies   map[string][]*Target // By listen address
+	warmups   map[string][]Warmup  // By listen address, in config order
+	now       func() time.Time
+}
+
+// NewChecker creates a checker with a valid config and no proxies
+func NewChecker() *Checker {
+	return &Checker{proxies: make(map[string][]*Target), warmups: make(map[string][]Warmup), now: time.Now}
+}
+
+// Default is the process-wide checker fed by config loading and slot polling
+var Default = NewChecker()
+
+// SetConfigError records the last config load result; nil means the config is valid
+func (c *Checker) SetConfigError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.configErr = ""
+	if err != nil {
+		c.configErr = err.Error()
+	}
+}
+
+// Register adds a running proxy and its targets
+func (c *Checker) Register(listen string, targets []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := make([]*Target, len(targets))
+	for i, url := range targets {
+		list[i] = &Target{URL: url}
+	}
+	c.proxies[listen] = list
+}
+
+// Reset forgets every proxy, before they are stopped for a reload
+func (c *Checker) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.proxies = make(map[string][]*Target)
+	c.warmups = make(map[string][]Warmup)
+}
+
+// SetUp records a health check result for one of a proxy's targets
+func (c *Checker) SetUp(listen, url string, up bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.proxies[listen] {
+		if t.URL == url {
+			checked := c.now()
+			t.Up, t.Checked = &up, &checked
+		}
+	}
+}
+
+// SetWarmup records a warm-up result for a proxy, replacing the last one with its name
+func (c *Checker) SetWarmup(listen string, w Warmup) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.proxies[listen]; !ok {
+		return
+	}
+	if w.Checked.IsZero() {
+		w.Checked = c.now()
+	}
+	for i := range c.warmups[listen] {
+		if c.warmups[listen][i].Name == w.Name {
+			c.warmups[listen][i] = w
+			return
+		}
+	}
+	c.warmups[listen] = append(c.warmups[listen], w)
+}
+
+// Status reports readiness for one proxy, or for every proxy when listen is empty. It is
+// ready when the config is valid and each proxy has a target not known to be down.
+func (c *Checker) Status(listen string) Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := Status{Ready: c.configErr == "", ConfigError: c.configErr, Proxies: []Proxy{}}
+	for name, targets := range c.proxies {
+		if listen != "" && name != listen {
+			continue
+		}
+		p := Proxy{Listen: name, Targets: make([]Target, len(targets)), Warmups: append([]Warmup(nil), c.warmups[name]...)}
+		for i, t := range targets {
+			p.Targets[i] = *t
+			if t.Up == nil || *t.Up {
+				p.Ready = true
+			}
+		}
+		status.Ready = status.Ready && p.Ready
+		status.Proxies = append(status.Proxies, p)
+	}
+	if len(status.Proxies) == 0 {
+		status.Ready = false
+	}
+	sort.Slice(status.Proxies, func(i, j int) bool { return status.Proxies[i].Listen < status.Proxies[j].Listen })
+	return status
+}
+
+// ServeLive answers liveness probes: the process is up and serving
+func ServeLive(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// ReadyHandler answers readiness probes for one proxy, or every proxy when listen is
+// empty, with 503 while not ready
+func (c *Checker) ReadyHandler(listen string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		status := c.Status(listen)
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// Wrap answers GET probes on a proxy's listener for that proxy and passes everything else
+// to next
+func (c *Checker) Wrap(next http.Handler, listen string) http.Handler {
+	ready := c.ReadyHandler(listen)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			switch req.URL.Path {
+			case LivePath:
+				ServeLive(w, req)
+				return
+			case ReadyPath:
+				ready(w, req)
+				return
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,107 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatusReadiness(t *testing.T) {
+	c := NewChecker()
+	if c.Status("").Ready {
+		t.Fatal("ready with no proxies running")
+	}
+
+	c.Register("localhost:8081", []string{"http://a", "http://b"})
+	c.Register("localhost:8082", []string{"http://c"})
+	if !c.Status("").Ready {
+		t.Fatal("unchecked targets should count as up")
+	}
+
+	c.SetUp("localhost:8081", "http://a", false)
+	if !c.Status("localhost:8081").Ready {
+		t.Fatal("proxy with one healthy target should be ready")
+	}
+	c.SetUp("localhost:8081", "http://b", false)
+	if status := c.Status(""); status.Ready || !status.Proxies[1].Ready {
+		t.Fatalf("status = %+v, want 8081 down and 8082 ready", status)
+	}
+	if !c.Status("localhost:8082").Ready {
+		t.Fatal("other proxy's targets should not affect its readiness")
+	}
+
+	c.SetConfigError(errors.New("bad yaml"))
+	if status := c.Status("localhost:8082"); status.Ready || status.ConfigError != "bad yaml" {
+		t.Fatalf("status = %+v, want not ready with the config error", status)
+	}
+	c.SetConfigError(nil)
+	if !c.Status("localhost:8082").Ready {
+		t.Fatal("a valid config should clear the error")
+	}
+
+	c.Reset()
+	if status := c.Status(""); status.Ready || len(status.Proxies) != 0 {
+		t.Fatalf("status after reset = %+v", status)
+	}
+}
+
+func TestWrapAnswersProbes(t *testing.T) {
+	c := NewChecker()
+	c.Register("localhost:8081", []string{"http://a"})
+	c.SetUp("localhost:8081", "http://a", false)
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := c.Wrap(next, "localhost:8081")
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", LivePath, http.StatusOK},
+		{"GET", ReadyPath, http.StatusServiceUnavailable},
+		{"POST", ReadyPath, http.StatusTeapot},
+		{"GET", "/v1/models", http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", ReadyPath, nil))
+	var status Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if up := status.Proxies[0].Targets[0].Up; up == nil || *up || status.Proxies[0].Targets[0].Checked == nil {
+		t.Fatalf("target = %+v, want checked and down", status.Proxies[0].Targets[0])
+	}
+}
+
+func TestSetWarmupReportsWithoutReadiness(t *testing.T) {
+	c := NewChecker()
+	c.SetWarmup("localhost:8081", Warmup{Name: "ignored"}) // Not registered yet
+	c.Register("localhost:8081", []string{"http://a"})
+
+	c.SetWarmup("localhost:8081", Warmup{Name: "chat qwen3", OK: false, Status: 502})
+	c.SetWarmup("localhost:8081", Warmup{Name: "embed"})
+	c.SetWarmup("localhost:8081", Warmup{Name: "chat qwen3", OK: true, Status: 200})
+
+	status := c.Status("localhost:8081")
+	if !status.Ready {
+		t.Fatal("warm-up results should not affect readiness")
+	}
+	warmups := status.Proxies[0].Warmups
+	if len(warmups) != 2 || warmups[0].Name != "chat qwen3" || !warmups[0].OK || warmups[1].Name != "embed" {
+		t.Fatalf("warmups = %+v, want the latest chat result then embed", warmups)
+	}
+	if warmups[0].Checked.IsZero() {
+		t.Error("checked time should be set")
+	}
+}
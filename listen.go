@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// listen binds addr before its server starts, so startup and reloads fail on a port
+// conflict instead of logging it from the server goroutine
+func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, config.UnixListenPrefix); ok {
+		return listenUnix(path)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, listenError(addr, err)
+	}
+	return ln, nil
+}
+
+// listenUnix binds a Unix socket, replacing a stale socket file that nothing answers on.
+// The file is removed when the listener closes.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s%s is already in use by another process", config.UnixListenPrefix, path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// listenError names the process holding addr's port, when the OS says who it is
+func listenError(addr string, err error) error {
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		return err
+	}
+	if holder := portHolder(listenPort(addr)); holder != "" {
+		return fmt.Errorf("%s is already in use by %s: %w", addr, holder, err)
+	}
+	return fmt.Errorf("%s is already in use by another process: %w", addr, err)
+}
+
+// boundAddr is listen with the port the OS chose for port 0 (ex: ":0" becomes ":40321")
+func boundAddr(listen string, ln net.Listener) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil || port != "0" {
+		return listen
+	}
+	if tcp, ok := ln.Addr().(*net.TCPAddr); ok {
+		return net.JoinHostPort(host, strconv.Itoa(tcp.Port))
+	}
+	return listen
+}
+
+func listenPort(addr string) int {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// httpsPort is the port redirect_http sends clients to: the proxy's first TCP listener's,
+// or 443 when it only listens on Unix sockets
+func httpsPort(addrs []string) int {
+	for _, addr := range addrs {
+		if port := listenPort(addr); port > 0 {
+			return port
+		}
+	}
+	return 443
+}
+
+// checkListeners binds and releases every address next listens on that current doesn't, so
+// a reload onto a taken port is refused while the running proxies still serve
+func checkListeners(current, next *config.Config) error {
+	held := map[string]bool{current.Admin.Listen: true}
+	for _, proxyCfg := range current.Proxies {
+		for _, addr := range proxyCfg.Listeners() {
+			held[addr] = true
+		}
+		if proxyCfg.RedirectHTTP != nil {
+			held[proxyCfg.RedirectHTTP.Listen] = true
+		}
+	}
+
+	var addrs []string
+	for _, proxyCfg := range next.Proxies {
+		addrs = append(addrs, proxyCfg.Listeners()...)
+		if proxyCfg.RedirectHTTP != nil {
+			addrs = append(addrs, proxyCfg.RedirectHTTP.Listen)
+		}
+	}
+	if next.Admin.Listen != "" {
+		addrs = append(addrs, next.Admin.Listen)
+	}
+	for _, addr := range addrs {
+		if held[addr] || (!strings.HasPrefix(addr, config.UnixListenPrefix) && listenPort(addr) == 0) {
+			continue
+		}
+		ln, err := listen(addr)
+		if err != nil {
+			return err
+		}
+		ln.Close()
+	}
+	return nil
+}
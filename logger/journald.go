@@ -0,0 +1,106 @@
+//go:build linux
+
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// journalSocket is where systemd-journald accepts native protocol datagrams
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalSink writes entries to journald with each field as its own journal field
+type journalSink struct {
+	conn *net.UnixConn
+	tag  string
+}
+
+// NewJournald connects to the local journald. Entries are logged with SYSLOG_IDENTIFIER
+// tag, a PRIORITY for their level, and fields as upper-case journal fields
+// (ex: status=200 becomes STATUS=200).
+func NewJournald(tag string) (Sink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("journald: %w", err)
+	}
+	return &journalSink{conn: conn, tag: tag}, nil
+}
+
+func (s *journalSink) Log(e Entry) error {
+	if _, err := s.conn.Write(journalMessage(e, s.tag)); err != nil {
+		return fmt.Errorf("journald: %w", err)
+	}
+	return nil
+}
+
+func (s *journalSink) Close() error {
+	return s.conn.Close()
+}
+
+// journalMessage encodes an entry in the journal native protocol
+func journalMessage(e Entry, tag string) []byte {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", e.Text())
+	writeJournalField(&buf, "PRIORITY", journalPriority(e.Level))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", tag)
+	writeJournalField(&buf, "SYSLOG_PID", fmt.Sprint(os.Getpid()))
+	for _, f := range e.Fields {
+		if f.Key == "" {
+			continue
+		}
+		writeJournalField(&buf, journalFieldName(f.Key), f.Value)
+	}
+	return buf.Bytes()
+}
+
+// journalPriority maps levels to syslog severities
+func journalPriority(level string) string {
+	switch level {
+	case "DEBUG":
+		return "7"
+	case "ERROR":
+		return "3"
+	case "FATAL":
+		return "2"
+	default:
+		return "6"
+	}
+}
+
+// journalFieldName upper-cases a key and replaces characters journald rejects. Names that
+// would collide with the fields set above, or start with a digit, get a FIELD_ prefix.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	name = strings.TrimLeft(name, "_")
+	switch {
+	case name == "", name[0] >= '0' && name[0] <= '9',
+		name == "MESSAGE", name == "PRIORITY", name == "SYSLOG_IDENTIFIER", name == "SYSLOG_PID":
+		name = "FIELD_" + name
+	}
+	return name[:min(len(name), 64)]
+}
+
+// writeJournalField writes KEY=value, or the length-prefixed form for multi-line values
+func writeJournalField(buf *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(key + "=" + value + "\n")
+		return
+	}
+	buf.WriteString(key + "\n")
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package logger
+
+import "fmt"
+
+// NewJournald is unavailable outside Linux
+func NewJournald(tag string) (Sink, error) {
+	return nil, fmt.Errorf("journald is only available on Linux")
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package logger
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestJournalMessage(t *testing.T) {
+	e := Entry{Level: "ERROR", Message: "Upstream failed", Fields: []Field{
+		{Key: "status", Value: "502"},
+		{Key: "matched-routes", Value: "[0 2]"},
+		{Key: "message", Value: "shadowed"},
+		{Key: "body", Value: "line one\nline two"},
+		{Value: "no key"},
+	}}
+	msg := string(journalMessage(e, "matchmaker"))
+
+	for _, want := range []string{
+		"Upstream failed | status=502 matched-routes=[0 2] message=shadowed",
+		"PRIORITY=3\n",
+		"SYSLOG_IDENTIFIER=matchmaker\n",
+		"STATUS=502\n",
+		"MATCHED_ROUTES=[0 2]\n",
+		"FIELD_MESSAGE=shadowed\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("missing %q in:\n%s", want, msg)
+		}
+	}
+
+	// Multi-line values use the length-prefixed form
+	_, rest, ok := strings.Cut(msg, "BODY\n")
+	if !ok || binary.LittleEndian.Uint64([]byte(rest[:8])) != uint64(len("line one\nline two")) || !strings.HasPrefix(rest[8:], "line one\nline two\n") {
+		t.Fatalf("multi-line field not length-prefixed: %q", msg)
+	}
+}
+
+func TestJournalFieldName(t *testing.T) {
+	for key, want := range map[string]string{
+		"status":      "STATUS",
+		"_hidden":     "HIDDEN",
+		"2xx":         "FIELD_2XX",
+		"priority":    "FIELD_PRIORITY",
+		"route.name":  "ROUTE_NAME",
+		"":            "FIELD_",
+		"ünïcode_key": "N_CODE_KEY",
+	} {
+		if got := journalFieldName(key); got != want {
+			t.Errorf("journalFieldName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -2,10 +2,12 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Level represents log verbosity.
@@ -24,6 +26,42 @@ var (
 	mu                sync.RWMutex
 )
 
+// Limits thins info logs under load. Errors are always written.
+type Limits struct {
+	Sample       int           // Write 1 in N request lines (see Sampled); 0 or 1 writes all
+	RepeatLimit  int           // Identical Info messages written per RepeatWindow; 0 is unlimited
+	RepeatWindow time.Duration // Defaults to a minute
+}
+
+// DefaultRepeatWindow is the repeat window when RepeatLimit is set without one
+const DefaultRepeatWindow = time.Minute
+
+var (
+	limitsMu sync.Mutex
+	limits   Limits
+	sampled  = map[string]int{}           // Request lines seen, by message
+	repeats  = map[string]*repeatWindow{} // Info messages in the current window, by message
+	now      = time.Now
+)
+
+type repeatWindow struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// SetLimits replaces the sampling and repeat limits, resetting their counters
+func SetLimits(l Limits) {
+	if l.RepeatLimit > 0 && l.RepeatWindow <= 0 {
+		l.RepeatWindow = DefaultRepeatWindow
+	}
+	limitsMu.Lock()
+	limits = l
+	sampled = map[string]int{}
+	repeats = map[string]*repeatWindow{}
+	limitsMu.Unlock()
+}
+
 // SetLevel sets the global log level.
 func SetLevel(level Level) {
 	mu.Lock()
@@ -31,6 +69,11 @@ func SetLevel(level Level) {
 	mu.Unlock()
 }
 
+// SetOutput redirects logs (ex: to stderr for commands that print results on stdout).
+func SetOutput(w io.Writer) {
+	stdLogger.SetOutput(w)
+}
+
 // EnableDebug toggles debug-level logging.
 func EnableDebug(enabled bool) {
 	if enabled {
@@ -49,9 +92,59 @@ func IsDebug() bool {
 
 // Info logs informational messages.
 func Info(msg string, kv ...any) {
+	if !allowRepeat(msg) {
+		return
+	}
 	logWithLevel("INFO", msg, kv...)
 }
 
+// Sampled logs a per-request info line, writing 1 in Limits.Sample of each message.
+// Sampled lines are not repeat limited. Use Info or Error for lines that must always appear.
+func Sampled(msg string, kv ...any) {
+	limitsMu.Lock()
+	every := limits.Sample
+	n := sampled[msg]
+	sampled[msg] = n + 1
+	limitsMu.Unlock()
+
+	if every > 1 {
+		if n%every != 0 {
+			return
+		}
+		kv = append(kv, "sampled", fmt.Sprintf("1/%d", every))
+	}
+	logWithLevel("INFO", msg, kv...)
+}
+
+// allowRepeat reports whether an info message is under its repeat limit. The first
+// message of a new window reports how many were dropped in the last one.
+func allowRepeat(msg string) bool {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	if limits.RepeatLimit <= 0 {
+		return true
+	}
+
+	t := now()
+	w := repeats[msg]
+	if w == nil {
+		w = &repeatWindow{start: t}
+		repeats[msg] = w
+	}
+	if t.Sub(w.start) >= limits.RepeatWindow {
+		if w.suppressed > 0 {
+			logWithLevel("INFO", "Suppressed repeated log message", "message", msg, "count", w.suppressed, "window", limits.RepeatWindow)
+		}
+		*w = repeatWindow{start: t}
+	}
+	w.count++
+	if w.count > limits.RepeatLimit {
+		w.suppressed++
+		return false
+	}
+	return true
+}
+
 // Error logs error messages.
 func Error(msg string, kv ...any) {
 	logWithLevel("ERROR", msg, kv...)
@@ -71,35 +164,98 @@ func Fatal(msg string, kv ...any) {
 	os.Exit(1)
 }
 
+// Field is a log key and its formatted value, redacted and truncated
+type Field struct {
+	Key   string // Empty for a trailing value without a key
+	Value string
+}
+
+// Entry is one log line as handed to a Sink
+type Entry struct {
+	Level   string // DEBUG, INFO, ERROR, or FATAL
+	Message string
+	Fields  []Field
+}
+
+// Text renders the entry as it appears in text logs, without the level
+func (e Entry) Text() string {
+	return e.Message + formatFields(e.Fields)
+}
+
+// Sink receives log entries in place of the text output (ex: syslog or journald)
+type Sink interface {
+	Log(e Entry) error
+	Close() error
+}
+
+var (
+	sinkMu sync.RWMutex
+	sink   Sink
+)
+
+// SetSink sends logs to s instead of the text output, or back to it when s is nil.
+// The previous sink is returned so the caller can close it.
+func SetSink(s Sink) Sink {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	prev := sink
+	sink = s
+	return prev
+}
+
 func logWithLevel(level string, msg string, kv ...any) {
-	stdLogger.Printf("[%s] %s%s", level, msg, formatFields(kv...))
+	e := Entry{Level: level, Message: msg, Fields: fields(kv...)}
+
+	sinkMu.RLock()
+	s := sink
+	sinkMu.RUnlock()
+	if s != nil {
+		err := s.Log(e)
+		if err == nil {
+			return
+		}
+		// Keep the line rather than lose it with the sink
+		stdLogger.Printf("[ERROR] Log sink failed | err=%v", err)
+	}
+	stdLogger.Printf("[%s] %s", level, e.Text())
 }
 
-func formatFields(kv ...any) string {
+func fields(kv ...any) []Field {
 	if len(kv) == 0 {
-		return ""
+		return nil
 	}
 
-	builder := strings.Builder{}
-	builder.WriteString(" |")
-
+	out := make([]Field, 0, (len(kv)+1)/2)
 	for i := 0; i < len(kv); i += 2 {
 		if i+1 >= len(kv) {
-			builder.WriteString(fmt.Sprintf(" %v", kv[i]))
+			out = append(out, Field{Value: fmt.Sprintf("%v", kv[i])})
 			break
 		}
 
 		key := fmt.Sprintf("%v", kv[i])
-		val := kv[i+1]
-
 		if shouldRedact(key) {
-			builder.WriteString(fmt.Sprintf(" %s=%s", key, "[REDACTED]"))
+			out = append(out, Field{Key: key, Value: "[REDACTED]"})
 			continue
 		}
+		out = append(out, Field{Key: key, Value: truncateValue(fmt.Sprintf("%v", kv[i+1]))})
+	}
+	return out
+}
 
-		builder.WriteString(fmt.Sprintf(" %s=%s", key, truncateValue(fmt.Sprintf("%v", val))))
+func formatFields(fields []Field) string {
+	if len(fields) == 0 {
+		return ""
 	}
 
+	builder := strings.Builder{}
+	builder.WriteString(" |")
+	for _, f := range fields {
+		if f.Key == "" {
+			builder.WriteString(" " + f.Value)
+			continue
+		}
+		builder.WriteString(" " + f.Key + "=" + f.Value)
+	}
 	return builder.String()
 }
 
@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func captureLogs(t *testing.T, l Limits) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	SetLimits(l)
+	t.Cleanup(func() {
+		SetOutput(os.Stdout)
+		SetLimits(Limits{})
+		now = time.Now
+	})
+	return &buf
+}
+
+func TestSampled(t *testing.T) {
+	buf := captureLogs(t, Limits{Sample: 10})
+
+	for range 25 {
+		Sampled("Inbound request", "path", "/v1/embeddings")
+		Sampled("Outbound response", "status", 200)
+	}
+	Error("Upstream failed")
+
+	logs := buf.String()
+	if n := strings.Count(logs, "Inbound request"); n != 3 {
+		t.Fatalf("got %d inbound lines, want 3 (1st, 11th, 21st):\n%s", n, logs)
+	}
+	if n := strings.Count(logs, "Outbound response"); n != 3 {
+		t.Fatalf("each message should be sampled on its own, got %d outbound lines", n)
+	}
+	if !strings.Contains(logs, "sampled=1/10") || !strings.Contains(logs, "[ERROR] Upstream failed") {
+		t.Fatalf("missing sample marker or error line:\n%s", logs)
+	}
+
+	SetLimits(Limits{})
+	buf.Reset()
+	Sampled("Inbound request")
+	if strings.Contains(buf.String(), "sampled=") || !strings.Contains(buf.String(), "Inbound request") {
+		t.Fatalf("sampling off should log every line unmarked: %s", buf.String())
+	}
+}
+
+func TestRepeatLimit(t *testing.T) {
+	buf := captureLogs(t, Limits{RepeatLimit: 2})
+	clock := time.Unix(0, 0)
+	now = func() time.Time { return clock }
+
+	for range 5 {
+		Info("Target health changed", "healthy", false)
+		Error("Failed to poll slots")
+	}
+	Info("Shutdown requested")
+
+	logs := buf.String()
+	if n := strings.Count(logs, "Target health changed"); n != 2 {
+		t.Fatalf("got %d repeated info lines, want 2:\n%s", n, logs)
+	}
+	if n := strings.Count(logs, "Failed to poll slots"); n != 5 {
+		t.Fatalf("errors must not be limited, got %d", n)
+	}
+	if !strings.Contains(logs, "Shutdown requested") {
+		t.Fatal("other messages have their own limit")
+	}
+
+	// The next window starts with a report of what was dropped
+	buf.Reset()
+	clock = clock.Add(DefaultRepeatWindow)
+	Info("Target health changed", "healthy", true)
+	logs = buf.String()
+	if !strings.Contains(logs, "Suppressed repeated log message | message=Target health changed count=3") || !strings.Contains(logs, "healthy=true") {
+		t.Fatalf("expected suppression report then the message:\n%s", logs)
+	}
+}
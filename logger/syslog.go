@@ -0,0 +1,50 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+// syslogSink writes entries to a syslog daemon, mapping levels to priorities
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslog connects to syslog at address (ex: udp://logs:514 or tcp://logs:601; a bare
+// host:port is UDP), or to the local daemon when address is empty. Entries are logged
+// under tag with the daemon facility.
+func NewSyslog(address, tag string) (Sink, error) {
+	network, raddr := "", ""
+	if address != "" {
+		var ok bool
+		network, raddr, ok = strings.Cut(address, "://")
+		if !ok {
+			network, raddr = "udp", address
+		}
+	}
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("syslog: %w", err)
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Log(e Entry) error {
+	switch e.Level {
+	case "DEBUG":
+		return s.w.Debug(e.Text())
+	case "ERROR":
+		return s.w.Err(e.Text())
+	case "FATAL":
+		return s.w.Crit(e.Text())
+	default:
+		return s.w.Info(e.Text())
+	}
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package logger
+
+import "fmt"
+
+// NewSyslog is unavailable on this platform
+func NewSyslog(address, tag string) (Sink, error) {
+	return nil, fmt.Errorf("syslog is not supported on this platform")
+}
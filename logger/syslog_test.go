@@ -0,0 +1,40 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := NewSyslog("udp://"+conn.LocalAddr().String(), "matchmaker-test")
+	if err != nil {
+		t.Fatalf("NewSyslog: %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Log(Entry{Level: "ERROR", Message: "Upstream failed", Fields: []Field{{Key: "status", Value: "502"}}}); err != nil {
+		t.Fatalf("log: %v", err)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	got := string(buf[:n])
+	// daemon facility (3) * 8 + err severity (3)
+	if !strings.HasPrefix(got, "<27>") || !strings.Contains(got, "matchmaker-test") || !strings.Contains(got, "Upstream failed | status=502") {
+		t.Fatalf("unexpected syslog message: %q", got)
+	}
+}
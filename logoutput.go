@@ -0,0 +1,71 @@
+package main
+
+import (
+	"cmp"
+	"os"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// defaultLogTag identifies the proxy in syslog and journald
+const defaultLogTag = "llama-matchmaker"
+
+var (
+	// logOutput is the logging.output in effect, so reloads only reopen a changed sink
+	logOutput config.LoggingConfig
+	// logFileSet records -log-file, which takes precedence over logging.output
+	logFileSet bool
+	newSyslog  = logger.NewSyslog
+	newJournal = logger.NewJournald
+)
+
+// applyLogOutput switches logs to the configured output. On failure the current output
+// is kept and the error logged there, and the next reload tries again.
+func applyLogOutput(l config.LoggingConfig) {
+	want := config.LoggingConfig{Output: l.Output, Syslog: l.Syslog, Tag: l.Tag}
+	if want == logOutput {
+		return
+	}
+	if logFileSet {
+		logOutput = want
+		if want.Output != "" {
+			logger.Info("Ignoring logging.output because -log-file is set", "output", want.Output)
+		}
+		return
+	}
+
+	tag := cmp.Or(want.Tag, defaultLogTag)
+	var sink logger.Sink
+	var err error
+	switch want.Output {
+	case config.LogSyslog:
+		sink, err = newSyslog(want.Syslog, tag)
+	case config.LogJournald:
+		sink, err = newJournal(tag)
+	case config.LogStderr:
+		logger.SetOutput(os.Stderr)
+	default:
+		logger.SetOutput(os.Stdout)
+	}
+	if err != nil {
+		logger.Error("Failed to open log output, keeping the current one", "output", want.Output, "err", err)
+		return
+	}
+	logOutput = want
+
+	if prev := logger.SetSink(sink); prev != nil {
+		prev.Close()
+	}
+	if sink != nil {
+		logger.Info("Logging to "+want.Output, "tag", tag)
+	}
+}
+
+// closeLogOutput returns logs to the text output, flushing any sink
+func closeLogOutput() {
+	if prev := logger.SetSink(nil); prev != nil {
+		prev.Close()
+	}
+	logOutput = config.LoggingConfig{}
+}
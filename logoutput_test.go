@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+type recordingSink struct {
+	entries []logger.Entry
+	closed  bool
+}
+
+func (s *recordingSink) Log(e logger.Entry) error {
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestApplyLogOutput(t *testing.T) {
+	var text bytes.Buffer
+	logger.SetOutput(&text)
+	sink := &recordingSink{}
+	var gotAddress, gotTag string
+	newSyslog = func(address, tag string) (logger.Sink, error) {
+		gotAddress, gotTag = address, tag
+		return sink, nil
+	}
+	newJournal = func(string) (logger.Sink, error) { return nil, errors.New("no journal socket") }
+	t.Cleanup(func() {
+		closeLogOutput()
+		logger.SetOutput(os.Stdout)
+		newSyslog, newJournal = logger.NewSyslog, logger.NewJournald
+	})
+
+	applyLogOutput(config.LoggingConfig{Output: config.LogSyslog, Syslog: "udp://logs:514"})
+	logger.Info("Inbound request", "path", "/v1/chat/completions")
+	if gotAddress != "udp://logs:514" || gotTag != defaultLogTag {
+		t.Fatalf("syslog opened with %q, %q", gotAddress, gotTag)
+	}
+	if len(sink.entries) != 2 || sink.entries[1].Message != "Inbound request" || text.Len() != 0 {
+		t.Fatalf("logs should go to the sink only, got %+v and text %q", sink.entries, text.String())
+	}
+
+	// Unchanged settings keep the sink; a failed switch keeps it too
+	applyLogOutput(config.LoggingConfig{Output: config.LogSyslog, Syslog: "udp://logs:514", Sample: 10})
+	applyLogOutput(config.LoggingConfig{Output: config.LogJournald})
+	if sink.closed || !strings.Contains(sink.entries[len(sink.entries)-1].Text(), "no journal socket") {
+		t.Fatalf("expected the failure logged to the open sink, got %+v", sink.entries)
+	}
+
+	// Dropping the output closes the sink and returns to stdout
+	applyLogOutput(config.LoggingConfig{})
+	logged := len(sink.entries)
+	logger.SetOutput(&text)
+	logger.Info("Back to text")
+	if !sink.closed || len(sink.entries) != logged || !strings.Contains(text.String(), "Back to text") {
+		t.Fatalf("expected sink closed and text output restored, got %q", text.String())
+	}
+}
+
+func TestApplyLogOutputLogFileWins(t *testing.T) {
+	var text bytes.Buffer
+	logger.SetOutput(&text)
+	logFileSet = true
+	newSyslog = func(string, string) (logger.Sink, error) {
+		t.Fatal("syslog should not open while -log-file is set")
+		return nil, nil
+	}
+	t.Cleanup(func() {
+		logFileSet = false
+		closeLogOutput()
+		logger.SetOutput(os.Stdout)
+		newSyslog = logger.NewSyslog
+	})
+
+	applyLogOutput(config.LoggingConfig{Output: config.LogSyslog})
+	if !strings.Contains(text.String(), "Ignoring logging.output because -log-file is set") {
+		t.Fatalf("expected a notice in the log file, got %q", text.String())
+	}
+}
+
+func TestApplyLogOutputRetriesFailedOpen(t *testing.T) {
+	var text bytes.Buffer
+	logger.SetOutput(&text)
+	sink := &recordingSink{}
+	opened := 0
+	newJournal = func(string) (logger.Sink, error) {
+		opened++
+		if opened == 1 {
+			return nil, errors.New("no journal socket")
+		}
+		return sink, nil
+	}
+	t.Cleanup(func() {
+		closeLogOutput()
+		logger.SetOutput(os.Stdout)
+		newJournal = logger.NewJournald
+	})
+
+	// The same config on the next reload opens the sink once the socket is there
+	applyLogOutput(config.LoggingConfig{Output: config.LogJournald})
+	applyLogOutput(config.LoggingConfig{Output: config.LogJournald})
+	logger.Info("Inbound request")
+	if opened != 2 || len(sink.entries) == 0 || sink.entries[len(sink.entries)-1].Message != "Inbound request" {
+		t.Fatalf("journald opened %d times, entries %+v; want the reload to retry", opened, sink.entries)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"net"
@@ -11,14 +12,21 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/spicyneuron/llama-matchmaker/admin"
+	"github.com/spicyneuron/llama-matchmaker/audit"
 	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/health"
 	"github.com/spicyneuron/llama-matchmaker/logger"
 	"github.com/spicyneuron/llama-matchmaker/proxy"
+	"github.com/spicyneuron/llama-matchmaker/traffic"
+	"github.com/spicyneuron/llama-matchmaker/usage"
+	"github.com/spicyneuron/llama-matchmaker/version"
 )
 
 // configFiles allows multiple -config flags
@@ -37,6 +45,14 @@ func (c *configFiles) Set(value string) error {
 type ProxyServer struct {
 	server *http.Server
 	config config.ProxyConfig
+	addrs  []string // Listeners, with the ports chosen for port 0
+
+	stopSlots  context.CancelFunc // Stops slot polling, when enabled
+	stopWarmup context.CancelFunc // Stops warm-up requests, when enabled
+	stopDNS    context.CancelFunc // Stops target hostname refreshes, when enabled
+
+	redirect     *http.Server // Plain-HTTP redirect listener (redirect_http), when enabled
+	redirectAddr string
 }
 
 type fileWatcher interface {
@@ -60,14 +76,20 @@ func (w *realWatcher) Errors() <-chan error {
 
 var (
 	runningServers []*ProxyServer
+	adminServer    *http.Server
+	usageSaver     *usagePersister
+	usageLoaded    bool
 	serversMutex   sync.RWMutex
 	currentConfig  *config.Config
 	watchedFiles   []string
+	loadedFiles    fileSnapshot // Checksums of watchedFiles as loaded
 	configWatcher  fileWatcher
 	configPaths    configFiles
 	overrides      config.CliOverrides
+	reportUnused   bool
 	reloadMutex    sync.Mutex
 	reloadTimer    *time.Timer
+	applyMutex     sync.Mutex // Serializes reloads from files, signals, and the admin API
 	watcherMutex   sync.Mutex
 	watchFactory   = func() (fileWatcher, error) {
 		w, err := fsnotify.NewWatcher()
@@ -83,19 +105,46 @@ var (
 
 func init() {
 	reloadConfigFn = reloadConfig
+	admin.SetReloader(applyReload)
+}
+
+// subcommands run instead of the proxy when named as the first argument
+var subcommands = map[string]func(args []string) int{
+	"audit":        runAuditCommand,
+	"bench":        runBenchCommand,
+	"completion":   runCompletionCommand,
+	"init":         runInitCommand,
+	"lint":         runLintCommand,
+	"monitor":      runMonitorCommand,
+	"routes":       runRoutesCommand,
+	"service":      runServiceCommand,
+	"test-request": runTestRequestCommand,
+	"usage":        runUsageCommand,
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
 	var (
-		listenAddr = flag.String("listen", "", "Address to listen on (ex: localhost:8081)")
-		targetURL  = flag.String("target", "", "Target URL to proxy to (ex: http://localhost:8080)")
-		sslCert    = flag.String("ssl-cert", "", "SSL certificate file (ex: cert.pem)")
-		sslKey     = flag.String("ssl-key", "", "SSL key file (ex: key.pem)")
-		timeout    = flag.Duration("timeout", 0, "Timeout for requests to target (ex: 60s)")
-		debug      = flag.Bool("debug", false, "Print debug logs")
+		listenAddr  = flag.String("listen", "", "Address to listen on (ex: localhost:8081)")
+		targetURL   = flag.String("target", "", "Target URL to proxy to (ex: http://localhost:8080)")
+		sslCert     = flag.String("ssl-cert", "", "SSL certificate file (ex: cert.pem)")
+		sslKey      = flag.String("ssl-key", "", "SSL key file (ex: key.pem)")
+		timeout     = flag.Duration("timeout", 0, "Timeout for requests to target (ex: 60s)")
+		debug       = flag.Bool("debug", false, "Print debug logs")
+		trace       = flag.String("trace", "", "Write a JSON trace of every request to this directory")
+		showVersion = flag.Bool("version", false, "Print version and build info")
+		daemon      = flag.Bool("daemon", false, "Run in the background, detached from the terminal (Unix)")
+		pidFile     = flag.String("pid-file", "", "Write the process ID to this file while running")
+		logFile     = flag.String("log-file", "", "Append logs to this file instead of stdout")
 	)
 
 	flag.Var(&configPaths, "config", "Path to YAML configuration (can be specified multiple times)")
+	flag.BoolVar(&reportUnused, "report-unused", false, "On shutdown, log routes that never matched a request")
 	flag.StringVar(listenAddr, "l", "", "Alias for -listen")
 	flag.StringVar(targetURL, "t", "", "Alias for -target")
 	flag.StringVar(sslCert, "s", "", "Alias for -ssl-cert")
@@ -124,6 +173,23 @@ func main() {
 		fmt.Println("        Timeout for requests to target (ex: 60s)")
 		fmt.Println("  -debug, -d")
 		fmt.Println("        Print debug logs")
+		fmt.Println("  -trace string")
+		fmt.Println("        Write a JSON trace of every request to this directory (ex: traces)")
+		fmt.Println("  -daemon")
+		fmt.Println("        Run in the background, detached from the terminal (Unix)")
+		fmt.Println("  -pid-file string")
+		fmt.Println("        Write the process ID to this file while running (ex: /run/llama-matchmaker.pid)")
+		fmt.Println("  -log-file string")
+		fmt.Println("        Append logs to this file instead of stdout")
+		fmt.Println("  -report-unused")
+		fmt.Println("        On shutdown, log routes that never matched a request")
+		fmt.Println("  -version")
+		fmt.Println("        Print version and build info")
+		fmt.Println()
+		fmt.Println("Commands:")
+		for _, c := range completionCommands() {
+			fmt.Printf("  %-14s%s\n", c.name, c.help)
+		}
 		fmt.Println()
 		fmt.Println("For more information and examples, visit:")
 		fmt.Println("  https://github.com/spicyneuron/llama-matchmaker")
@@ -131,6 +197,11 @@ func main() {
 
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println("llama-matchmaker " + version.Get().String())
+		return
+	}
+
 	if len(configPaths) == 0 {
 		flag.Usage()
 		os.Exit(1)
@@ -143,33 +214,102 @@ func main() {
 		SSLCert: *sslCert,
 		SSLKey:  *sslKey,
 		Debug:   *debug,
+		Trace:   *trace,
+	}
+
+	if *daemon && !isDaemonChild() {
+		pid, err := daemonize(*logFile)
+		if err != nil {
+			logger.Fatal("Failed to start in the background", "err", err)
+		}
+		fmt.Printf("llama-matchmaker running in the background (pid %d)\n", pid)
+		return
+	}
+
+	if *logFile != "" {
+		f, err := openLogFile(*logFile)
+		if err != nil {
+			logger.Fatal("Failed to open log file", "path", *logFile, "err", err)
+		}
+		defer f.Close()
+		logger.SetOutput(f)
+		logFileSet = true
+	}
+
+	if *pidFile != "" {
+		if err := writePIDFile(*pidFile); err != nil {
+			logger.Fatal("Failed to write PID file", "err", err)
+		}
+		defer os.Remove(*pidFile)
 	}
 
+	if runningAsService() {
+		if err := runAsService(serve); err != nil {
+			logger.Fatal("Windows service failed", "err", err)
+		}
+		return
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	hupCh := make(chan os.Signal, 1)
+	notifyReloadSignal(hupCh)
+	go reloadOnSignal(hupCh)
+	serve(sigCh)
+}
+
+// serve runs the proxies and reloads them on config changes until stop receives
+func serve(stop <-chan os.Signal) {
+	build := version.Get()
+	logger.Info("Starting llama-matchmaker", "version", build.Version, "commit", build.ShortCommit(), "go", build.GoVersion)
+
 	cfg, files, err := config.Load(configPaths, overrides)
 	if err != nil {
 		logger.Fatal("Failed to load config", "err", err)
 	}
 	currentConfig = cfg
 	watchedFiles = files
+	loadedFiles = snapshotFiles(files)
 
 	if err := startAllProxiesFn(cfg); err != nil {
 		logger.Fatal("Failed to start proxies", "err", err)
 	}
+	admin.SetConfig(cfg, files)
 
 	if err := setWatcher(files); err != nil {
 		logger.Fatal("Failed to setup file watcher", "err", err)
 	}
 	defer closeWatcher()
 
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
-
 	logger.Info("Watching for config changes", "watched_files", len(files))
 
-	<-sigCh
+	<-stop
 	logger.Info("Shutdown requested", "proxies", len(runningServers))
 	stopAllProxies()
+	if err := audit.Default.Close(); err != nil {
+		logger.Error("Failed to close audit log", "err", err)
+	}
+	if reportUnused {
+		logUnusedRoutes(currentConfig)
+	}
 	logger.Info("Shutdown complete")
+	closeLogOutput()
+}
+
+// logUnusedRoutes lists the routes that never matched a request, to find stale rules
+func logUnusedRoutes(cfg *config.Config) {
+	unused := proxy.UnusedRoutes(cfg)
+	for _, r := range unused {
+		fields := []any{"listen", r.Listen, "route", r.Index}
+		if r.Name != "" {
+			fields = append(fields, "name", r.Name)
+		}
+		if r.Source != "" {
+			fields = append(fields, "source", r.Source)
+		}
+		logger.Info("Route never matched", fields...)
+	}
+	logger.Info("Unused routes", "count", len(unused), "routes", len(proxy.RouteActivity(cfg)))
 }
 
 func CreateServer(cfg config.ProxyConfig, handler http.Handler) *http.Server {
@@ -186,6 +326,42 @@ func CreateServer(cfg config.ProxyConfig, handler http.Handler) *http.Server {
 		server.TLSConfig = &tls.Config{
 			Certificates: []tls.Certificate{cert},
 		}
+		// Go serves the first certificate covering the client's SNI hostname, or ssl_cert
+		for _, pair := range cfg.SSLCerts {
+			extra, err := tls.LoadX509KeyPair(pair.Cert, pair.Key)
+			if err != nil {
+				logger.Fatal("Failed to load SSL certificates", "cert", pair.Cert, "err", err)
+			}
+			server.TLSConfig.Certificates = append(server.TLSConfig.Certificates, extra)
+		}
+		if err := cfg.ListenerTLS().Apply(server.TLSConfig); err != nil {
+			logger.Fatal("Invalid TLS settings", "err", err)
+		}
+		if cfg.SSLClientCA != "" {
+			pem, err := os.ReadFile(cfg.SSLClientCA)
+			if err != nil {
+				logger.Fatal("Failed to load SSL client CA", "err", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				logger.Fatal("Failed to load SSL client CA", "path", cfg.SSLClientCA, "err", "no PEM certificates found")
+			}
+			server.TLSConfig.ClientCAs = pool
+			server.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			if cfg.RequireClientCert {
+				server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+		if cfg.PlainHTTP != "" {
+			// Serve offers HTTP/2 over TLS only when NextProtos lists it
+			server.TLSConfig.NextProtos = []string{"h2", "http/1.1"}
+		}
+		if cfg.PlainHTTP == config.PlainHTTPServe {
+			server.Protocols = new(http.Protocols)
+			server.Protocols.SetHTTP1(true)
+			server.Protocols.SetHTTP2(true)
+			server.Protocols.SetUnencryptedHTTP2(true)
+		}
 	}
 
 	if cfg.Timeout > 0 {
@@ -196,30 +372,109 @@ func CreateServer(cfg config.ProxyConfig, handler http.Handler) *http.Server {
 }
 
 func startProxy(proxyCfg config.ProxyConfig) (*ProxyServer, error) {
-	targetURLParsed, err := url.Parse(proxyCfg.Target)
-	if err != nil {
-		return nil, fmt.Errorf("invalid target URL: %w", err)
+	var targets []*url.URL
+	for _, target := range proxyCfg.AllTargets() {
+		targetURLParsed, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target URL: %w", err)
+		}
+		targets = append(targets, targetURLParsed)
+	}
+	targetNames := make([]string, len(targets))
+	for i, target := range targets {
+		targetNames[i] = target.String()
+	}
+	listeners := make([]net.Listener, 0, 1+len(proxyCfg.ExtraListen))
+	var redirectLn net.Listener
+	closeListeners := func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+		if redirectLn != nil {
+			redirectLn.Close()
+		}
+	}
+	for _, addr := range proxyCfg.Listeners() {
+		ln, err := listen(addr)
+		if err != nil {
+			closeListeners()
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+	if proxyCfg.RedirectHTTP != nil {
+		ln, err := listen(proxyCfg.RedirectHTTP.Listen)
+		if err != nil {
+			closeListeners()
+			return nil, err
+		}
+		redirectLn = ln
+	}
+	health.Default.Register(proxyCfg.Listen, targetNames)
+
+	// Each target keeps the standard single-host rewrite; the balancer picks one per request
+	directors := make([]func(*http.Request), len(targets))
+	for i, target := range targets {
+		directors[i] = httputil.NewSingleHostReverseProxy(target).Director
 	}
+	balancer := proxy.NewBalancer(len(targets))
+	if proxyCfg.Affinity != nil || proxyCfg.Session != nil {
+		balancer = proxy.NewAffinityBalancer(len(targets), proxyCfg.Affinity, proxyCfg.Session, proxyCfg.RequestLimit())
+	}
+	handler := proxy.NewHandler(proxyCfg)
 
-	reverseProxy := httputil.NewSingleHostReverseProxy(targetURLParsed)
+	reverseProxy := &httputil.ReverseProxy{}
 	reverseProxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
-		logger.Error("Reverse proxy error",
+		fields := []any{
 			"listen", proxyCfg.Listen,
-			"target_host", targetURLParsed.Host,
+			"target_host", req.URL.Host,
 			"method", req.Method,
 			"path", req.URL.Path,
-			"err", err)
-		http.Error(rw, "Bad Gateway", http.StatusBadGateway)
+		}
+		if session := proxy.SessionID(req); session != "" {
+			fields = append(fields, "session", session)
+		}
+		if proxy.IsClientDisconnect(req, err) {
+			logger.Info("Request aborted by client disconnect", fields...)
+			proxy.RecordError(req, proxy.StatusClientClosedRequest, err)
+			rw.WriteHeader(proxy.StatusClientClosedRequest)
+			return
+		}
+		logger.Error("Reverse proxy error", append(fields, "err", err)...)
+		status := proxy.WriteUpstreamError(rw, req, proxyCfg.ErrorResponse, err)
+		proxy.RecordError(req, status, err)
 	}
 
 	// Configure transport with optimized settings for mobile connections
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		KeepAliveConfig: net.KeepAliveConfig{
+			Enable:   true,
+			Idle:     proxyCfg.KeepAliveInterval(),
+			Interval: proxyCfg.KeepAliveInterval(),
+			Count:    3,
+		},
+	}
 	transport := &http.Transport{
 		MaxIdleConnsPerHost: 5,
-		IdleConnTimeout:     90 * time.Second,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		IdleConnTimeout:     proxyCfg.IdleConnTimeout(),
+		DialContext:         dialer.DialContext,
+	}
+	var resolver *proxy.Resolver
+	if proxyCfg.DNSRefresh > 0 {
+		// Pooled connections stay on the old addresses, so they are dropped when DNS changes
+		resolver = proxy.NewResolver(proxyCfg.Listen, targets, proxyCfg.DNSRefresh, dialer, transport.CloseIdleConnections)
+		transport.DialContext = resolver.DialContext
+	}
+	if proxyCfg.OutboundProxy != nil {
+		transport.Proxy = proxyCfg.OutboundProxy.Proxy
+	}
+	if upstreamTLS := proxyCfg.UpstreamTLS(); !upstreamTLS.Empty() {
+		transport.TLSClientConfig = &tls.Config{}
+		if err := upstreamTLS.Apply(transport.TLSClientConfig); err != nil {
+			closeListeners()
+			return nil, fmt.Errorf("upstream TLS: %w", err)
+		}
 	}
 
 	if proxyCfg.Timeout > 0 {
@@ -227,45 +482,149 @@ func startProxy(proxyCfg config.ProxyConfig) (*ProxyServer, error) {
 		transport.ResponseHeaderTimeout = proxyCfg.Timeout
 	}
 
-	reverseProxy.Transport = transport
+	reverseProxy.Transport = proxy.NewTransport(transport)
 
-	originalDirector := reverseProxy.Director
 	reverseProxy.Director = func(req *http.Request) {
-		originalDirector(req)
-		proxy.ModifyRequest(req, proxyCfg.Routes)
+		target, scheduled := proxy.TargetFromContext(req.Context())
+		if !scheduled {
+			target = balancer.Pick(req)
+		}
+		directors[target](req)
+		// Forward proxies route by the absolute URI, whose host is taken from req.Host
+		if proxyCfg.OutboundProxy != nil && proxyCfg.OutboundProxy.Forwards(req.URL) {
+			req.Host = ""
+		}
+		handler.ModifyRequest(req)
+	}
+
+	reverseProxy.ModifyResponse = handler.ModifyResponse
+
+	var rootHandler http.Handler = reverseProxy
+	if proxyCfg.Models.Aggregate {
+		aggregator := proxy.NewModelsAggregator(targets, proxyCfg.Models, proxyCfg.Timeout)
+		if proxyCfg.OutboundProxy != nil {
+			aggregator.UseTransport(transport)
+		}
+		rootHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			// Requests without a listed key go on to be refused by ModifyRequest
+			if aggregator.Matches(req) && handler.KnownKey(req) {
+				aggregator.ServeHTTP(w, req)
+				return
+			}
+			reverseProxy.ServeHTTP(w, req)
+		})
 	}
 
-	reverseProxy.ModifyResponse = func(resp *http.Response) error {
-		return proxy.ModifyResponse(resp, proxyCfg.Routes)
+	var stopSlots context.CancelFunc
+	if proxyCfg.Slots != nil {
+		scheduler := proxy.NewSlotScheduler(proxyCfg.Listen, targets, *proxyCfg.Slots)
+		if proxyCfg.OutboundProxy != nil {
+			scheduler.UseTransport(transport)
+		}
+		var slotsCtx context.Context
+		slotsCtx, stopSlots = context.WithCancel(context.Background())
+		go scheduler.Run(slotsCtx)
+		rootHandler = scheduler.Handler(rootHandler, balancer, handler.Priority)
+	}
+	if proxyCfg.MethodOverride {
+		rootHandler = proxy.WithMethodOverride(rootHandler)
+	}
+	rootHandler = proxy.WithMemoryLimit(rootHandler, proxyCfg.Listen)
+	rootHandler = proxy.WithTimings(rootHandler)
+	rootHandler = proxy.WithAudit(rootHandler, proxyCfg.Listen)
+	if proxyCfg.HealthEndpoints {
+		rootHandler = health.Default.Wrap(rootHandler, proxyCfg.Listen)
+	}
+	useTLS := proxyCfg.SSLCert != "" && proxyCfg.SSLKey != ""
+	if useTLS && proxyCfg.SSLClientCA != "" {
+		rootHandler = proxy.WithClientCert(rootHandler)
+	}
+	if useTLS {
+		rootHandler = proxy.WithPlainHTTP(rootHandler, proxyCfg.PlainHTTP)
 	}
 
-	server := CreateServer(proxyCfg, reverseProxy)
+	var stopWarmup context.CancelFunc
+	if proxyCfg.Warmup != nil {
+		warmer, err := proxy.NewWarmer(proxyCfg.Listen, *proxyCfg.Warmup, rootHandler)
+		if err != nil {
+			if stopSlots != nil {
+				stopSlots()
+			}
+			closeListeners()
+			return nil, err
+		}
+		var warmupCtx context.Context
+		warmupCtx, stopWarmup = context.WithCancel(context.Background())
+		go warmer.Run(warmupCtx)
+	}
+
+	var stopDNS context.CancelFunc
+	if resolver != nil {
+		var dnsCtx context.Context
+		dnsCtx, stopDNS = context.WithCancel(context.Background())
+		go resolver.Run(dnsCtx)
+	}
+
+	server := CreateServer(proxyCfg, rootHandler)
 
 	ps := &ProxyServer{
-		server: server,
-		config: proxyCfg,
+		server:     server,
+		config:     proxyCfg,
+		addrs:      make([]string, len(listeners)),
+		stopSlots:  stopSlots,
+		stopWarmup: stopWarmup,
+		stopDNS:    stopDNS,
 	}
 
-	logListen := proxyCfg.Listen
-	if proxyCfg.SSLCert != "" && proxyCfg.SSLKey != "" {
-		logListen = "https://" + logListen
-		logger.Info("Starting HTTPS proxy", "listen", logListen, "target", proxyCfg.Target)
+	scheme := "http://"
+	if useTLS {
+		scheme = "https://"
+	}
+	logListens := make([]string, len(listeners))
+	for i, ln := range listeners {
+		ps.addrs[i] = boundAddr(proxyCfg.Listeners()[i], ln)
+		logListens[i] = ps.addrs[i]
+		if !strings.HasPrefix(logListens[i], config.UnixListenPrefix) {
+			logListens[i] = scheme + logListens[i]
+		}
+	}
+	if useTLS {
+		logger.Info("Starting HTTPS proxy", "listen", strings.Join(logListens, ","), "target", strings.Join(proxyCfg.AllTargets(), ","))
 	} else {
-		logListen = "http://" + logListen
-		logger.Info("Starting HTTP proxy", "listen", logListen, "target", proxyCfg.Target)
+		logger.Info("Starting HTTP proxy", "listen", strings.Join(logListens, ","), "target", strings.Join(proxyCfg.AllTargets(), ","))
 	}
 
-	go func() {
-		var err error
-		if proxyCfg.SSLCert != "" && proxyCfg.SSLKey != "" {
-			err = server.ListenAndServeTLS(proxyCfg.SSLCert, proxyCfg.SSLKey)
-		} else {
-			err = server.ListenAndServe()
-		}
-		if err != nil && err != http.ErrServerClosed {
-			logger.Error("Proxy server stopped with error", "listen", proxyCfg.Listen, "err", err)
+	// One server serves every listener, so shutting it down closes them all
+	for _, ln := range listeners {
+		go func() {
+			var err error
+			if useTLS && proxyCfg.PlainHTTP != "" {
+				err = server.Serve(newSniffListener(ln, server.TLSConfig))
+			} else if useTLS {
+				// The certificates are already loaded; files here would replace them
+				err = server.ServeTLS(ln, "", "")
+			} else {
+				err = server.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				logger.Error("Proxy server stopped with error", "listen", ln.Addr().String(), "err", err)
+			}
+		}()
+	}
+
+	if redirectLn != nil {
+		ps.redirectAddr = boundAddr(proxyCfg.RedirectHTTP.Listen, redirectLn)
+		ps.redirect = &http.Server{
+			Handler:           proxy.HTTPRedirect(httpsPort(ps.addrs), proxyCfg.RedirectHTTP.ACMEDir),
+			ReadHeaderTimeout: 10 * time.Second,
 		}
-	}()
+		logger.Info("Redirecting plain HTTP to HTTPS", "listen", "http://"+ps.redirectAddr, "acme_dir", proxyCfg.RedirectHTTP.ACMEDir)
+		go func() {
+			if err := ps.redirect.Serve(redirectLn); err != nil && err != http.ErrServerClosed {
+				logger.Error("Redirect server stopped with error", "listen", ps.redirectAddr, "err", err)
+			}
+		}()
+	}
 
 	return ps, nil
 }
@@ -275,9 +634,23 @@ func stopProxy(ps *ProxyServer) {
 	defer cancel()
 
 	logger.Debug("Stopping proxy", "listen", ps.config.Listen)
+	if ps.stopSlots != nil {
+		ps.stopSlots()
+	}
+	if ps.stopWarmup != nil {
+		ps.stopWarmup()
+	}
+	if ps.stopDNS != nil {
+		ps.stopDNS()
+	}
 	if err := ps.server.Shutdown(ctx); err != nil {
 		logger.Error("Error during proxy shutdown", "listen", ps.config.Listen, "err", err)
 	}
+	if ps.redirect != nil {
+		if err := ps.redirect.Shutdown(ctx); err != nil {
+			logger.Error("Error during redirect listener shutdown", "listen", ps.redirectAddr, "err", err)
+		}
+	}
 }
 
 func stopAllProxies() {
@@ -293,8 +666,22 @@ func stopAllProxies() {
 			stopProxy(p)
 		}(ps)
 	}
+	if adminServer != nil {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			stopAdmin(server)
+		}(adminServer)
+	}
 	wg.Wait()
 	runningServers = nil
+	health.Default.Reset()
+	adminServer = nil
+
+	if usageSaver != nil {
+		usageSaver.stop()
+		usageSaver = nil
+	}
 
 	// Give OS time to fully release the ports
 	time.Sleep(100 * time.Millisecond)
@@ -312,22 +699,139 @@ func startAllProxies(cfg *config.Config) error {
 		}
 	}
 	logger.EnableDebug(debugEnabled)
+	applyLogOutput(cfg.Logging)
+	logger.SetLimits(logger.Limits{
+		Sample:       cfg.Logging.Sample,
+		RepeatLimit:  cfg.Logging.RepeatLimit,
+		RepeatWindow: cfg.Logging.RepeatWindow,
+	})
 
 	logResolvedConfig(cfg)
+	proxy.ConfigureMemory(cfg.Memory)
 
+	// A listener that fails to bind stops the ones already started, so the caller can
+	// start another config on the same ports
+	abort := func(err error) error {
+		for _, ps := range runningServers {
+			stopProxy(ps)
+		}
+		runningServers = nil
+		health.Default.Reset()
+		return err
+	}
+	// Opened before any listener, so no request goes unrecorded
+	auditFile := ""
+	if cfg.Audit != nil {
+		auditFile = cfg.Audit.File
+	}
+	if err := audit.Default.Configure(auditFile); err != nil {
+		return abort(fmt.Errorf("audit: %w", err))
+	}
+	addrs := make(map[string][]string, len(cfg.Proxies))
 	for i, proxyCfg := range cfg.Proxies {
 		ps, err := startProxy(proxyCfg)
 		if err != nil {
-			logger.Fatal("Failed to start proxy", "index", i, "err", err)
-			return err
+			return abort(fmt.Errorf("proxy %d: %w", i, err))
 		}
 		runningServers = append(runningServers, ps)
+		addrs[proxyCfg.Listen] = ps.addrs
+	}
+	admin.SetListenAddrs(addrs)
+
+	if cfg.Admin.Listen != "" {
+		server, err := startAdmin(cfg.Admin)
+		if err != nil {
+			return abort(fmt.Errorf("admin: %w", err))
+		}
+		adminServer = server
+	}
+	if dashboard := cfg.Admin.Dashboard; dashboard != nil {
+		traffic.Default.Configure(dashboard.Requests, dashboard.MaxBodyBytes)
+	} else {
+		traffic.Default.Configure(0, 0)
+	}
+	if cfg.Admin.UsageFile != "" {
+		usageSaver = startUsagePersistence(cfg.Admin.UsageFile)
 	}
 
 	logger.Debug("All proxies started", "count", len(runningServers))
 	return nil
 }
 
+func startAdmin(adminCfg config.AdminConfig) (*http.Server, error) {
+	ln, err := listen(adminCfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{
+		Addr:    adminCfg.Listen,
+		Handler: admin.NewHandler(adminCfg),
+	}
+
+	logger.Info("Starting admin listener", "listen", "http://"+boundAddr(adminCfg.Listen, ln))
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Error("Admin server stopped with error", "listen", adminCfg.Listen, "err", err)
+		}
+	}()
+	return server, nil
+}
+
+// usagePersister periodically saves usage aggregates so they survive restarts
+type usagePersister struct {
+	path string
+	quit chan struct{}
+	done chan struct{}
+}
+
+func startUsagePersistence(path string) *usagePersister {
+	// Reloads keep the in-memory store, so only the first start reads the file
+	if !usageLoaded {
+		if err := usage.Default.Load(path); err != nil {
+			logger.Error("Failed to load usage file", "path", path, "err", err)
+		}
+		usageLoaded = true
+	}
+
+	p := &usagePersister{path: path, quit: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.save()
+			case <-p.quit:
+				p.save()
+				return
+			}
+		}
+	}()
+	return p
+}
+
+func (p *usagePersister) save() {
+	if err := usage.Default.Save(p.path); err != nil {
+		logger.Error("Failed to save usage file", "path", p.path, "err", err)
+	}
+}
+
+func (p *usagePersister) stop() {
+	close(p.quit)
+	<-p.done
+}
+
+func stopAdmin(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	logger.Debug("Stopping admin listener", "listen", server.Addr)
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("Error during admin shutdown", "listen", server.Addr, "err", err)
+	}
+}
+
 func logResolvedConfig(cfg *config.Config) {
 	if !logger.IsDebug() {
 		return
@@ -353,7 +857,7 @@ func logResolvedConfig(cfg *config.Config) {
 
 		logger.Debug(fmt.Sprintf("Proxy %d configured", i+1),
 			"listen", logListen,
-			"target", p.Target,
+			"target", strings.Join(p.AllTargets(), ","),
 			"timeout", p.Timeout,
 			"routes", len(p.Routes),
 			"request_actions", reqOps,
@@ -431,6 +935,12 @@ func watchForChanges(watcher fileWatcher) {
 }
 
 func debounceReload() {
+	// Batch rapid fsnotify events so we only reload after a brief quiet period.
+	scheduleReload(200*time.Millisecond, "Config file changed, reloading...")
+}
+
+// scheduleReload reloads after delay, replacing any reload already pending
+func scheduleReload(delay time.Duration, msg string) {
 	reloadMutex.Lock()
 	defer reloadMutex.Unlock()
 
@@ -438,21 +948,58 @@ func debounceReload() {
 		reloadTimer.Stop()
 	}
 
-	// Batch rapid fsnotify events so we only reload after a brief quiet period.
-	reloadTimer = time.AfterFunc(200*time.Millisecond, func() {
-		logger.Info("Config file changed, reloading...")
+	reloadTimer = time.AfterFunc(delay, func() {
+		logger.Info(msg)
 		if reloadConfigFn != nil {
 			reloadConfigFn()
 		}
 	})
 }
 
+// reloadOnSignal reloads the config whenever hup receives, as with systemctl reload
+func reloadOnSignal(hup <-chan os.Signal) {
+	for range hup {
+		scheduleReload(0, "Reload requested, reloading...")
+	}
+}
+
 func reloadConfig() {
-	newCfg, newFiles, err := config.Load(configPaths, overrides)
+	_ = applyReload(false)
+}
+
+// applyReload loads the config files and restarts the proxies with them. Unless force is
+// set, the running config's reload guard may refuse the new config.
+func applyReload(force bool) error {
+	applyMutex.Lock()
+	defer applyMutex.Unlock()
+
+	newCfg, newFiles, snapshot, err := loadSettled()
 	if err != nil {
 		logger.Error("Failed to reload config, keeping current config", "err", err)
-		return
+		health.Default.SetConfigError(err)
+		return err
+	}
+	if !force && loadedFiles != nil && loadedFiles.covers(snapshot) && len(loadedFiles) == len(snapshot) {
+		logger.Info("Config files unchanged, skipping reload")
+		health.Default.SetConfigError(nil)
+		return nil
+	}
+	if currentConfig != nil && currentConfig.Reload != nil && !force {
+		guard := currentConfig.Reload
+		if err := guard.Check(currentConfig, newCfg); err != nil {
+			logger.Error("Refused config reload, keeping current config (force with POST "+admin.ReloadPath+"?force=true)", "err", err)
+			health.Default.SetConfigError(err)
+			return err
+		}
 	}
+	if currentConfig != nil {
+		if err := checkListeners(currentConfig, newCfg); err != nil {
+			logger.Error("Refused config reload, keeping current config", "err", err)
+			health.Default.SetConfigError(err)
+			return err
+		}
+	}
+	health.Default.SetConfigError(nil)
 
 	logger.Info("Successfully loaded new config")
 
@@ -464,15 +1011,18 @@ func reloadConfig() {
 			logger.Fatal("Failed to restore previous config", "err", err)
 		}
 		logger.Info("Restored previous config")
-		return
+		return err
 	}
 
 	currentConfig = newCfg
 	watchedFiles = newFiles
+	loadedFiles = snapshot
+	admin.SetConfig(newCfg, newFiles)
 
 	if err := setWatcher(newFiles); err != nil {
 		logger.Error("Failed to update file watcher after reload", "err", err)
 	}
 
-	logger.Info("Config reloaded successfully", "proxies", len(newCfg.Proxies), "watched_files", len(newFiles))
+	logger.Info("Config reloaded successfully", "proxies", len(newCfg.Proxies), "watched_files", len(newFiles), "forced", force)
+	return nil
 }
@@ -1,15 +1,34 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 
 	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/health"
+	"github.com/spicyneuron/llama-matchmaker/proxy"
 )
 
 type fakeWatcher struct {
@@ -199,6 +218,25 @@ proxy:
 	}
 }
 
+func TestReloadOnSignal(t *testing.T) {
+	origReload := reloadConfigFn
+	defer func() { reloadConfigFn = origReload }()
+
+	reloaded := make(chan struct{}, 1)
+	reloadConfigFn = func() { reloaded <- struct{}{} }
+
+	hup := make(chan os.Signal, 1)
+	go reloadOnSignal(hup)
+	defer close(hup)
+	hup <- syscall.SIGHUP
+
+	select {
+	case <-reloaded:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected reloadConfigFn to be invoked after a reload signal")
+	}
+}
+
 func TestCreateServerTimeouts(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -271,3 +309,514 @@ func TestCreateServerWithoutTLSConfig(t *testing.T) {
 func writeFile(path, content string) error {
 	return os.WriteFile(path, []byte(content), 0644)
 }
+
+func TestReloadGuardRefusesUnlessForced(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	if err := writeFile(configPath, `
+proxy:
+  listen: "localhost:0"
+  target: "http://example.com"
+  routes:
+    - methods: GET
+      paths: /.*
+      on_request:
+        - merge: { injected: true }
+`); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	origPaths, origOverrides, origCurrent, origLoaded := configPaths, overrides, currentConfig, loadedFiles
+	origStart, origStop, origFactory := startAllProxiesFn, stopAllProxiesFn, watchFactory
+	defer func() {
+		configPaths, overrides, currentConfig, loadedFiles = origPaths, origOverrides, origCurrent, origLoaded
+		startAllProxiesFn, stopAllProxiesFn, watchFactory = origStart, origStop, origFactory
+		health.Default.SetConfigError(nil)
+		closeWatcher()
+	}()
+
+	starts := 0
+	startAllProxiesFn = func(*config.Config) error { starts++; return nil }
+	stopAllProxiesFn = func() {}
+	watchFactory = func() (fileWatcher, error) { return newFakeWatcher(), nil }
+	configPaths = []string{configPath}
+	overrides = config.CliOverrides{}
+	loadedFiles = nil
+	currentConfig = &config.Config{
+		Proxies: []config.ProxyConfig{{Listen: "localhost:0", Routes: make([]config.Route, 4)}},
+		Reload:  &config.ReloadGuard{MaxRoutesRemoved: 50},
+	}
+
+	if err := applyReload(false); !errors.Is(err, config.ErrReloadRefused) {
+		t.Fatalf("applyReload(false) = %v, want the guard to refuse", err)
+	}
+	if starts != 0 {
+		t.Fatal("a refused reload should keep the running proxies")
+	}
+	if err := applyReload(true); err != nil {
+		t.Fatalf("applyReload(true) = %v, want a forced reload", err)
+	}
+	if starts != 1 || len(currentConfig.Proxies[0].Routes) != 1 {
+		t.Fatalf("starts = %d, want the new config running", starts)
+	}
+	if err := applyReload(false); err != nil || starts != 1 {
+		t.Fatalf("applyReload(false) = %v with starts = %d, want unchanged files skipped", err, starts)
+	}
+}
+
+func TestLoadSettledWaitsForNewIncludes(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yml")
+	includePath := filepath.Join(dir, "routes.yml")
+	if err := writeFile(includePath, `
+- methods: GET
+  paths: /.*
+  on_request:
+    - merge: { injected: true }
+`); err != nil {
+		t.Fatalf("failed to write include: %v", err)
+	}
+	if err := writeFile(configPath, `
+proxy:
+  listen: "localhost:0"
+  target: "http://example.com"
+  routes:
+    - include: routes.yml
+`); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	origPaths, origOverrides, origWatched := configPaths, overrides, watchedFiles
+	defer func() { configPaths, overrides, watchedFiles = origPaths, origOverrides, origWatched }()
+	configPaths = []string{configPath}
+	overrides = config.CliOverrides{}
+	watchedFiles = []string{configPath}
+
+	_, files, snapshot, err := loadSettled()
+	if err != nil {
+		t.Fatalf("loadSettled() = %v", err)
+	}
+	if len(files) != 2 || snapshot[includePath] == "" {
+		t.Fatalf("files = %v, snapshot = %v; want the include loaded and checksummed", files, snapshot)
+	}
+	if !snapshotFiles(files).covers(snapshot) {
+		t.Fatal("snapshot should match the files as loaded")
+	}
+	if err := writeFile(includePath, "- methods: POST\n  paths: /x\n  on_request: [{ merge: { a: 1 } }]\n"); err != nil {
+		t.Fatalf("failed to rewrite include: %v", err)
+	}
+	if snapshot.covers(snapshotFiles(files)) {
+		t.Fatal("a rewritten include should change the snapshot")
+	}
+}
+
+func TestListenNamesPortHolder(t *testing.T) {
+	held, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer held.Close()
+
+	_, err = listen(held.Addr().String())
+	if err == nil || !strings.Contains(err.Error(), held.Addr().String()+" is already in use by") {
+		t.Fatalf("listen = %v, want a port conflict", err)
+	}
+	if runtime.GOOS == "linux" && !strings.Contains(err.Error(), fmt.Sprintf("(pid %d)", os.Getpid())) {
+		t.Errorf("listen = %v, want this process named as the holder", err)
+	}
+}
+
+func TestStartProxyEphemeralPort(t *testing.T) {
+	defer health.Default.Reset()
+
+	ps, err := startProxy(config.ProxyConfig{Listen: "127.0.0.1:0", Target: "http://localhost:3000"})
+	if err != nil {
+		t.Fatalf("startProxy = %v", err)
+	}
+	defer stopProxy(ps)
+
+	if ps.addrs[0] == "127.0.0.1:0" || !strings.HasPrefix(ps.addrs[0], "127.0.0.1:") {
+		t.Fatalf("addr = %q, want the chosen port", ps.addrs[0])
+	}
+	conn, err := net.Dial("tcp", ps.addrs[0])
+	if err != nil {
+		t.Fatalf("dial %s = %v", ps.addrs[0], err)
+	}
+	conn.Close()
+}
+
+func TestStartProxyUsesOutboundProxy(t *testing.T) {
+	defer health.Default.Reset()
+
+	// A forward proxy sees absolute request URIs for plain http:// targets
+	var requested string
+	bastion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		w.Write([]byte("via bastion"))
+	}))
+	defer bastion.Close()
+
+	outbound := &config.OutboundProxy{URL: bastion.URL}
+	if err := outbound.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	ps, err := startProxy(config.ProxyConfig{Listen: "127.0.0.1:0", Target: "http://backend.example:9000", OutboundProxy: outbound})
+	if err != nil {
+		t.Fatalf("startProxy = %v", err)
+	}
+	defer stopProxy(ps)
+
+	resp, err := http.Get("http://" + ps.addrs[0] + "/v1/models")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "via bastion" || requested != "http://backend.example:9000/v1/models" {
+		t.Fatalf("body = %q, bastion saw %q, want the request sent through the bastion", body, requested)
+	}
+}
+
+func TestCheckListenersRefusesTakenPorts(t *testing.T) {
+	held, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer held.Close()
+	addr := held.Addr().String()
+
+	current := &config.Config{Proxies: []config.ProxyConfig{{Listen: addr}}}
+	if err := checkListeners(current, current); err != nil {
+		t.Errorf("checkListeners = %v, want ports the running proxies hold skipped", err)
+	}
+	next := &config.Config{Proxies: []config.ProxyConfig{{Listen: "127.0.0.1:0"}}, Admin: config.AdminConfig{Listen: addr}}
+	if err := checkListeners(&config.Config{}, next); err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Errorf("checkListeners = %v, want the taken admin port refused", err)
+	}
+}
+
+func TestStartProxyServesEveryListener(t *testing.T) {
+	defer health.Default.Reset()
+	socket := filepath.Join(t.TempDir(), "proxy.sock")
+
+	// A socket file left by a crashed process is replaced
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	proxyCfg := config.ProxyConfig{
+		Listen:      "127.0.0.1:0",
+		ExtraListen: []string{config.UnixListenPrefix + socket},
+		Target:      "http://localhost:3000",
+	}
+	ps, err := startProxy(proxyCfg)
+	if err != nil {
+		t.Fatalf("startProxy = %v", err)
+	}
+
+	if len(ps.addrs) != 2 || ps.addrs[1] != config.UnixListenPrefix+socket {
+		t.Fatalf("addrs = %v, want the TCP port and the socket", ps.addrs)
+	}
+	for network, addr := range map[string]string{"tcp": ps.addrs[0], "unix": socket} {
+		conn, err := net.Dial(network, addr)
+		if err != nil {
+			t.Fatalf("dial %s = %v", addr, err)
+		}
+		conn.Close()
+	}
+	if _, err := listen(ps.addrs[1]); err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Errorf("listen = %v, want the live socket refused", err)
+	}
+
+	stopProxy(ps)
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("stat socket after stop = %v, want it removed", err)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key into dir
+func writeTestCert(t *testing.T, dir string) (certPath, keyPath string) {
+	return writeCert(t, dir, "", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	})
+}
+
+// writeCert writes a self-signed certificate from template, valid for an hour, and its key
+// into dir as <prefix>cert.pem and <prefix>key.pem
+func writeCert(t *testing.T, dir, prefix string, template *x509.Certificate) (certPath, keyPath string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template.SerialNumber = big.NewInt(1)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	certPath, keyPath = filepath.Join(dir, prefix+"cert.pem"), filepath.Join(dir, prefix+"key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func TestPlainHTTPOnTLSListener(t *testing.T) {
+	defer health.Default.Reset()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+	certPath, keyPath := writeTestCert(t, t.TempDir())
+
+	tlsClient := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	plainClient := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	h2cTransport := &http.Transport{Protocols: new(http.Protocols)}
+	h2cTransport.Protocols.SetUnencryptedHTTP2(true)
+	h2cClient := &http.Client{Transport: h2cTransport}
+
+	for _, mode := range []string{config.PlainHTTPRedirect, config.PlainHTTPServe} {
+		t.Run(mode, func(t *testing.T) {
+			ps, err := startProxy(config.ProxyConfig{
+				Listen: "127.0.0.1:0", Target: backend.URL,
+				SSLCert: certPath, SSLKey: keyPath, PlainHTTP: mode,
+			})
+			if err != nil {
+				t.Fatalf("startProxy = %v", err)
+			}
+			defer stopProxy(ps)
+
+			resp, err := tlsClient.Get("https://" + ps.addrs[0] + "/v1/models")
+			if err != nil {
+				t.Fatalf("HTTPS request = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent || resp.ProtoMajor != 2 {
+				t.Errorf("HTTPS = %d over HTTP/%d, want 204 over HTTP/2", resp.StatusCode, resp.ProtoMajor)
+			}
+
+			resp, err = plainClient.Get("http://" + ps.addrs[0] + "/v1/models")
+			if err != nil {
+				t.Fatalf("plain request = %v", err)
+			}
+			resp.Body.Close()
+			if mode == config.PlainHTTPRedirect {
+				if resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Location") != "https://"+ps.addrs[0]+"/v1/models" {
+					t.Errorf("plain = %d to %q, want a redirect to https", resp.StatusCode, resp.Header.Get("Location"))
+				}
+				return
+			}
+			if resp.StatusCode != http.StatusNoContent {
+				t.Errorf("plain = %d, want it served", resp.StatusCode)
+			}
+			resp, err = h2cClient.Get("http://" + ps.addrs[0] + "/v1/models")
+			if err != nil {
+				t.Fatalf("h2c request = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent || resp.ProtoMajor != 2 {
+				t.Errorf("h2c = %d over HTTP/%d, want 204 over HTTP/2", resp.StatusCode, resp.ProtoMajor)
+			}
+		})
+	}
+}
+
+// writeClientCert writes a self-signed client certificate that is also its own CA, for
+// ssl_client_ca, and returns its path and key pair
+func writeClientCert(t *testing.T, dir string, subject pkix.Name) (string, tls.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	certPath := filepath.Join(dir, "client-ca.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientCertAuthentication(t *testing.T) {
+	defer health.Default.Reset()
+	var seen http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCert(t, dir)
+	caPath, clientCert := writeClientCert(t, dir, pkix.Name{CommonName: "alice", Organization: []string{"Example"}})
+
+	ps, err := startProxy(config.ProxyConfig{
+		Listen: "127.0.0.1:0", Target: backend.URL,
+		SSLCert: certPath, SSLKey: keyPath, SSLClientCA: caPath, RequireClientCert: true,
+	})
+	if err != nil {
+		t.Fatalf("startProxy = %v", err)
+	}
+	defer stopProxy(ps)
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: certs}}}
+	}
+
+	// Connections without a certificate are refused during the handshake
+	if resp, err := client().Get("https://" + ps.addrs[0] + "/v1/models"); err == nil {
+		resp.Body.Close()
+		t.Fatalf("request without a client certificate got %d, want a handshake failure", resp.StatusCode)
+	}
+
+	// The verified subject replaces headers the client sent
+	req, _ := http.NewRequest("GET", "https://"+ps.addrs[0]+"/v1/models", nil)
+	req.Header.Set(proxy.ClientCertCN, "mallory")
+	req.Header.Set(proxy.ClientCertOrgUnit, "admins")
+	resp, err := client(clientCert).Do(req)
+	if err != nil {
+		t.Fatalf("request with a client certificate: %v", err)
+	}
+	resp.Body.Close()
+	if seen.Get(proxy.ClientCertCN) != "alice" || seen.Get(proxy.ClientCertOrg) != "Example" || seen.Get(proxy.ClientCertOrgUnit) != "" {
+		t.Errorf("backend saw CN %q, O %q, OU %q; want alice, Example, and none", seen.Get(proxy.ClientCertCN), seen.Get(proxy.ClientCertOrg), seen.Get(proxy.ClientCertOrgUnit))
+	}
+	if got := seen.Get(proxy.ClientCertSubject); got != "CN=alice,O=Example" {
+		t.Errorf("backend saw subject %q, want CN=alice,O=Example", got)
+	}
+}
+
+func TestSNICertificates(t *testing.T) {
+	defer health.Default.Reset()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCert(t, dir)
+	var pairs []config.SSLCertPair
+	for _, host := range []string{"chat.internal", "embed.internal"} {
+		cert, key := writeCert(t, dir, host+"-", &x509.Certificate{Subject: pkix.Name{CommonName: host}, DNSNames: []string{host}})
+		pairs = append(pairs, config.SSLCertPair{Cert: cert, Key: key})
+	}
+
+	ps, err := startProxy(config.ProxyConfig{
+		Listen: "127.0.0.1:0", Target: backend.URL,
+		SSLCert: certPath, SSLKey: keyPath, SSLCerts: pairs,
+	})
+	if err != nil {
+		t.Fatalf("startProxy = %v", err)
+	}
+	defer stopProxy(ps)
+
+	// Each hostname gets its own certificate; unknown names get ssl_cert
+	for serverName, want := range map[string]string{"chat.internal": "chat.internal", "embed.internal": "embed.internal", "other.internal": "127.0.0.1"} {
+		conn, err := tls.Dial("tcp", ps.addrs[0], &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("dial %s: %v", serverName, err)
+		}
+		got := conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+		conn.Close()
+		if got != want {
+			t.Errorf("SNI %s got certificate %q, want %q", serverName, got, want)
+		}
+	}
+}
+
+func TestTLSVersionSettings(t *testing.T) {
+	defer health.Default.Reset()
+
+	// The backend records the versions the proxy offers; its certificate isn't trusted, so
+	// the handshake then fails
+	offered := make(chan []uint16, 1)
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	backend.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		offered <- hello.SupportedVersions
+		return nil, nil
+	}}
+	backend.StartTLS()
+	defer backend.Close()
+	certPath, keyPath := writeTestCert(t, t.TempDir())
+
+	ps, err := startProxy(config.ProxyConfig{
+		Listen: "127.0.0.1:0", Target: backend.URL,
+		SSLCert: certPath, SSLKey: keyPath,
+		TLSMinVersion: "1.3", UpstreamTLSMinVersion: "1.3",
+	})
+	if err != nil {
+		t.Fatalf("startProxy = %v", err)
+	}
+	defer stopProxy(ps)
+
+	// Clients limited to TLS 1.2 are refused
+	if _, err := tls.Dial("tcp", ps.addrs[0], &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12}); err == nil {
+		t.Fatal("TLS 1.2 handshake succeeded, want it refused")
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + ps.addrs[0] + "/v1/models")
+	if err != nil {
+		t.Fatalf("TLS 1.3 request: %v", err)
+	}
+	resp.Body.Close()
+	if versions := <-offered; !slices.Equal(versions, []uint16{tls.VersionTLS13}) {
+		t.Errorf("proxy offered the backend versions %x, want only TLS 1.3", versions)
+	}
+}
+
+func TestStartProxyRedirectsPlainHTTP(t *testing.T) {
+	defer health.Default.Reset()
+	certPath, keyPath := writeTestCert(t, t.TempDir())
+	ps, err := startProxy(config.ProxyConfig{
+		Listen: "127.0.0.1:0", Target: "http://localhost:3000",
+		SSLCert: certPath, SSLKey: keyPath,
+		RedirectHTTP: &config.HTTPRedirect{Listen: "127.0.0.1:0"},
+	})
+	if err != nil {
+		t.Fatalf("startProxy = %v", err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get("http://" + ps.redirectAddr + "/v1/models")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if want := "https://" + ps.addrs[0] + "/v1/models"; resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != want {
+		t.Errorf("got %d to %q, want 301 to %q", resp.StatusCode, resp.Header.Get("Location"), want)
+	}
+
+	stopProxy(ps)
+	if _, err := client.Get("http://" + ps.redirectAddr + "/"); err == nil {
+		t.Error("redirect listener still serving after stop")
+	}
+}
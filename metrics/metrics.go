@@ -0,0 +1,300 @@
+// Package metrics keeps process-wide counters and renders them in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// collector is anything the registry can render
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// WritePrometheus renders every registered metric in the Prometheus text exposition format
+func WritePrometheus(w io.Writer) {
+	registryMu.Lock()
+	collectors := append([]collector(nil), registry...)
+	registryMu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Counter is a monotonically increasing value partitioned by label values
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter creates and registers a counter with the given label names
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+// Add increases the counter for the given label values; negative values are ignored
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := labelKey(labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Value returns the current value for the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[labelKey(labelValues)]
+}
+
+// Samples returns every labeled value, sorted by label values
+func (c *Counter) Samples() []Sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return samples(c.values, len(c.labels))
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, splitLabelKey(k)), strconv.FormatFloat(c.values[k], 'g', -1, 64))
+	}
+}
+
+// Sample is one labeled value of a counter or gauge
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// samples lists values with one label value per label name, so a single empty label
+// value (which shares the unlabeled key) still has its slot
+func samples(values map[string]float64, labels int) []Sample {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]Sample, len(keys))
+	for i, k := range keys {
+		labelValues := splitLabelKey(k)
+		for len(labelValues) < labels {
+			labelValues = append(labelValues, "")
+		}
+		out[i] = Sample{Labels: labelValues, Value: values[k]}
+	}
+	return out
+}
+
+const labelSep = "\xff"
+
+func labelKey(values []string) string {
+	return strings.Join(values, labelSep)
+}
+
+func splitLabelKey(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return strings.Split(key, labelSep)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + `="` + labelEscaper.Replace(value) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Gauge is a value that can go up and down, partitioned by label values
+type Gauge struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewGauge creates and registers a gauge with the given label names
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	register(g)
+	return g
+}
+
+// Set replaces the gauge value for the given label values
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	g.mu.Lock()
+	g.values[key] = v
+	g.mu.Unlock()
+}
+
+// Add changes the gauge value for the given label values by delta
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	g.mu.Lock()
+	g.values[key] += delta
+	g.mu.Unlock()
+}
+
+// Value returns the current value for the given label values
+func (g *Gauge) Value(labelValues ...string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[labelKey(labelValues)]
+}
+
+// Samples returns every labeled value, sorted by label values
+func (g *Gauge) Samples() []Sample {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return samples(g.values, len(g.labels))
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	keys := make([]string, 0, len(g.values))
+	for k := range g.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, splitLabelKey(k)), strconv.FormatFloat(g.values[k], 'g', -1, 64))
+	}
+}
+
+// LatencyBuckets are histogram bounds in seconds, from sub-millisecond proxy overhead
+// to minutes-long generations
+var LatencyBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// SizeBuckets are histogram bounds in bytes, from small completions to multi-megabyte
+// image and audio uploads
+var SizeBuckets = []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216}
+
+// TokenBuckets are histogram bounds in tokens, from one-word replies to long contexts
+var TokenBuckets = []float64{16, 64, 256, 1024, 2048, 4096, 8192, 16384, 32768, 65536, 131072}
+
+// Histogram counts observations into cumulative buckets, partitioned by label values
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // Per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram creates and registers a histogram with sorted bucket upper bounds
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+	register(h)
+	return h
+}
+
+// Observe records a value for the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[key]
+	if s == nil {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	s.counts[sort.SearchFloat64s(h.buckets, v)]++
+	s.sum += v
+	s.count++
+}
+
+// Count returns the number of observations for the given label values
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s := h.series[labelKey(labelValues)]; s != nil {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, k := range keys {
+		s := h.series[k]
+		values := splitLabelKey(k)
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = strconv.FormatFloat(h.buckets[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(bucketLabels, append(append([]string(nil), values...), le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, values), strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, values), s.count)
+	}
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCounterWritePrometheus(t *testing.T) {
+	c := NewCounter("test_requests_total", "Requests seen in tests", "model", "kind")
+	c.Add(2, "llama3", "prompt")
+	c.Add(1.5, "llama3", "prompt")
+	c.Add(1, `we"ird`, "completion")
+	c.Add(-5, "llama3", "prompt")
+
+	if got := c.Value("llama3", "prompt"); got != 3.5 {
+		t.Fatalf("Value = %v, want 3.5", got)
+	}
+
+	empty := NewCounter("test_empty_label_total", "Counter with an empty label value", "listen")
+	empty.Add(1, "")
+	if got := empty.Samples(); len(got) != 1 || len(got[0].Labels) != 1 || got[0].Labels[0] != "" {
+		t.Fatalf("Samples = %+v, want one sample with an empty label", got)
+	}
+
+	var buf bytes.Buffer
+	WritePrometheus(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{model="llama3",kind="prompt"} 3.5` + "\n",
+		`test_requests_total{model="we\"ird",kind="completion"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestGaugeWritePrometheus(t *testing.T) {
+	g := NewGauge("test_slots_busy", "Busy slots in tests", "target")
+	g.Set(3, "http://a")
+	g.Set(1, "http://a")
+	g.Set(2, "http://b")
+	g.Add(-1, "http://a")
+	g.Add(1, "http://a")
+
+	if got := g.Value("http://a"); got != 1 {
+		t.Fatalf("Value = %v, want 1", got)
+	}
+	if got := g.Samples(); len(got) != 2 || got[0].Labels[0] != "http://a" || got[1].Value != 2 {
+		t.Fatalf("Samples = %+v, want a then b", got)
+	}
+
+	var buf bytes.Buffer
+	WritePrometheus(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE test_slots_busy gauge\n",
+		`test_slots_busy{target="http://a"} 1` + "\n",
+		`test_slots_busy{target="http://b"} 2` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHistogramWritePrometheus(t *testing.T) {
+	h := NewHistogram("test_phase_seconds", "Phase time in tests", []float64{0.1, 1}, "phase")
+	h.Observe(0.05, "total")
+	h.Observe(0.1, "total")
+	h.Observe(3, "total")
+
+	if got := h.Count("total"); got != 3 {
+		t.Fatalf("Count = %d, want 3", got)
+	}
+
+	var buf bytes.Buffer
+	WritePrometheus(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE test_phase_seconds histogram\n",
+		`test_phase_seconds_bucket{phase="total",le="0.1"} 2` + "\n",
+		`test_phase_seconds_bucket{phase="total",le="1"} 2` + "\n",
+		`test_phase_seconds_bucket{phase="total",le="+Inf"} 3` + "\n",
+		`test_phase_seconds_sum{phase="total"} 3.15` + "\n",
+		`test_phase_seconds_count{phase="total"} 3` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	runtime.GC()
+
+	var buf bytes.Buffer
+	WritePrometheus(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE go_goroutines gauge\ngo_goroutines ",
+		"# TYPE go_heap_objects_bytes gauge\n",
+		"# TYPE go_gc_cycles_total counter\n",
+		"# TYPE go_gc_pause_seconds histogram\n",
+		`go_gc_pause_seconds_bucket{le="+Inf"} `,
+		"go_gc_pause_seconds_count ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q", want)
+		}
+	}
+	if strings.Contains(out, "go_gc_pause_seconds_count 0\n") {
+		t.Error("no GC pauses counted after runtime.GC")
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"runtime/metrics"
+	"sort"
+	"strconv"
+)
+
+// pauseBuckets are the bounds, in seconds, that GC pause times are reported in
+var pauseBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1}
+
+// Runtime samples read on each scrape; runtime/metrics reads don't stop the world
+var runtimeSamples = []struct {
+	metric string
+	name   string
+	help   string
+	kind   string
+}{
+	{"/sched/goroutines:goroutines", "go_goroutines", "Goroutines that currently exist", "gauge"},
+	{"/memory/classes/heap/objects:bytes", "go_heap_objects_bytes", "Heap memory occupied by live and not yet swept objects", "gauge"},
+	{"/gc/heap/goal:bytes", "go_gc_heap_goal_bytes", "Heap size the next GC cycle aims for", "gauge"},
+	{"/memory/classes/total:bytes", "go_memory_total_bytes", "Memory mapped by the Go runtime", "gauge"},
+	{"/gc/cycles/total:gc-cycles", "go_gc_cycles_total", "Completed GC cycles", "counter"},
+}
+
+const pauseMetric = "/sched/pauses/total/gc:seconds"
+
+func init() {
+	register(runtimeCollector{})
+}
+
+// runtimeCollector renders Go runtime health: goroutines, heap, and GC pauses
+type runtimeCollector struct{}
+
+func (runtimeCollector) write(w io.Writer) {
+	samples := make([]metrics.Sample, len(runtimeSamples)+1)
+	for i, s := range runtimeSamples {
+		samples[i].Name = s.metric
+	}
+	samples[len(runtimeSamples)].Name = pauseMetric
+	metrics.Read(samples)
+
+	for i, s := range runtimeSamples {
+		var v float64
+		switch samples[i].Value.Kind() {
+		case metrics.KindUint64:
+			v = float64(samples[i].Value.Uint64())
+		case metrics.KindFloat64:
+			v = samples[i].Value.Float64()
+		default:
+			continue // Not supported by this Go version
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", s.name, s.help, s.name, s.kind, s.name, strconv.FormatFloat(v, 'g', -1, 64))
+	}
+
+	if pauses := samples[len(runtimeSamples)].Value; pauses.Kind() == metrics.KindFloat64Histogram {
+		writePauses(w, pauses.Float64Histogram())
+	}
+}
+
+// writePauses folds the runtime's fine-grained pause histogram into pauseBuckets. The
+// runtime keeps no exact total, so the sum is estimated from bucket midpoints.
+func writePauses(w io.Writer, h *metrics.Float64Histogram) {
+	const name = "go_gc_pause_seconds"
+	counts := make([]uint64, len(pauseBuckets)+1)
+	var total uint64
+	var sum float64
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		lower, upper := h.Buckets[i], h.Buckets[i+1]
+		counts[sort.SearchFloat64s(pauseBuckets, upper)] += n
+		total += n
+		switch {
+		case math.IsInf(lower, -1):
+			sum += float64(n) * upper
+		case math.IsInf(upper, 1):
+			sum += float64(n) * lower
+		default:
+			sum += float64(n) * (lower + upper) / 2
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP %s Stop-the-world GC pause durations\n# TYPE %s histogram\n", name, name)
+	var cumulative uint64
+	for i, bound := range pauseBuckets {
+		cumulative += counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, total)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", name, strconv.FormatFloat(sum, 'g', -1, 64), name, total)
+}
@@ -0,0 +1,78 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpListen is the socket state /proc/net/tcp reports for listeners
+const tcpListen = "0A"
+
+// portHolder names the process listening on port (ex: "llama-server (pid 4121)"), or ""
+// when /proc doesn't say, such as for another user's process
+func portHolder(port int) string {
+	if port <= 0 {
+		return ""
+	}
+	inodes := map[string]bool{}
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		listeningInodes(table, port, inodes)
+	}
+	if len(inodes) == 0 {
+		return ""
+	}
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return ""
+	}
+	for _, proc := range procs {
+		pid := proc.Name()
+		if _, err := strconv.Atoi(pid); err != nil {
+			continue
+		}
+		fds, err := os.ReadDir(filepath.Join("/proc", pid, "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join("/proc", pid, "fd", fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			if inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] {
+				comm, _ := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+				return fmt.Sprintf("%s (pid %s)", strings.TrimSpace(string(comm)), pid)
+			}
+		}
+	}
+	return ""
+}
+
+// listeningInodes adds the socket inodes of table's listeners on port
+func listeningInodes(table string, port int, inodes map[string]bool) {
+	f, err := os.Open(table)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	suffix := fmt.Sprintf(":%04X", port)
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListen || !strings.HasSuffix(fields[1], suffix) {
+			continue
+		}
+		if fields[9] != "0" {
+			inodes[fields[9]] = true
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// portHolder can't name the process holding a port outside Linux
+func portHolder(port int) string {
+	return ""
+}
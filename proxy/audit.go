@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/audit"
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+type auditKey struct{}
+
+// auditEntry collects what ModifyRequest learns about a request for its audit record
+type auditEntry struct {
+	key    string
+	model  string
+	routes string
+}
+
+func auditFromContext(ctx context.Context) *auditEntry {
+	e, _ := ctx.Value(auditKey{}).(*auditEntry)
+	return e
+}
+
+// noteKey records who sent the request: the key's name when it is listed, or else a
+// fingerprint of the bearer token, which is never written itself
+func (e *auditEntry) noteKey(key *config.APIKey, req *http.Request) {
+	if key != nil && key.Name != "" {
+		e.key = key.Name
+		return
+	}
+	if token := config.BearerToken(req.Header.Get("Authorization")); token != "" {
+		sum := sha256.Sum256([]byte(token))
+		e.key = "sha256:" + hex.EncodeToString(sum[:8])
+	}
+}
+
+// WithAudit writes an audit record for each request once its reply is sent, while the
+// audit log is enabled. Request and reply bodies are hashed as they pass through.
+func WithAudit(next http.Handler, listen string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !audit.Default.Enabled() {
+			next.ServeHTTP(w, req)
+			return
+		}
+		start := time.Now()
+		entry := &auditEntry{}
+		entry.noteKey(nil, req)
+		body := &hashingBody{hash: sha256.New()}
+		if req.Body != nil && req.Body != http.NoBody {
+			body.ReadCloser = req.Body
+			req.Body = body
+		}
+		reply := &auditWriter{ResponseWriter: w, hash: sha256.New()}
+
+		rec := audit.Record{
+			Time:   start.UTC(),
+			Listen: listen,
+			Method: req.Method,
+			Path:   req.URL.Path,
+		}
+		if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+			rec.Remote = host
+		}
+		// Only certificates that chained to ssl_client_ca are trusted (see WithClientCert)
+		if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+			rec.ClientCN = req.TLS.VerifiedChains[0][0].Subject.CommonName
+		}
+
+		completed := false
+		defer func() {
+			rec.Key, rec.Model, rec.Routes = entry.key, entry.model, entry.routes
+			rec.Status = reply.status
+			if rec.Status == 0 {
+				rec.Status = http.StatusOK
+			}
+			rec.Aborted = !completed
+			rec.RequestBytes, rec.RequestSHA256 = body.sum()
+			rec.ResponseBytes, rec.ResponseSHA256 = reply.bytes, hex.EncodeToString(reply.hash.Sum(nil))
+			rec.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+			if err := audit.Default.Write(rec); err != nil {
+				logger.Error("Failed to write audit record", "method", rec.Method, "path", rec.Path, "err", err)
+			}
+		}()
+		next.ServeHTTP(reply, req.WithContext(context.WithValue(req.Context(), auditKey{}, entry)))
+		completed = true
+	})
+}
+
+// hashingBody hashes a request body as it is read. The transport may still be reading it
+// when the reply is done, so reads and sums are serialized.
+type hashingBody struct {
+	io.ReadCloser
+	mu    sync.Mutex
+	hash  hash.Hash
+	bytes int64
+	eof   bool
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	b.hash.Write(p[:n])
+	b.bytes += int64(n)
+	if err == io.EOF {
+		b.eof = true
+	}
+	b.mu.Unlock()
+	return n, err
+}
+
+// sum returns the bytes read and their hash, which is empty unless the body was read to
+// the end. Requests without a body hash as empty.
+func (b *hashingBody) sum() (int64, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ReadCloser != nil && !b.eof {
+		return b.bytes, ""
+	}
+	return b.bytes, hex.EncodeToString(b.hash.Sum(nil))
+}
+
+// auditWriter hashes the reply as it is written to the client
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	hash   hash.Hash
+}
+
+func (w *auditWriter) WriteHeader(code int) {
+	// Informational replies (ex: 103 Early Hints) precede the real status
+	if w.status == 0 && code >= http.StatusOK {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.hash.Write(p[:n])
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush keeps streamed replies flowing through the wrapper
+func (w *auditWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the connection (ex: to hijack it for upgrades)
+func (w *auditWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/audit"
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestWithAuditRecordsRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := audit.Default.Configure(path); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	t.Cleanup(func() { audit.Default.Close() })
+
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Name:      "chat",
+		Methods:   newPatternField("POST"),
+		Paths:     newPatternField("^/v1/chat/completions$"),
+		OnRequest: []config.Action{{Merge: map[string]any{"temperature": 0.6}}},
+	}})
+	cfg.Proxies[0].Models.Aliases = map[string]string{"fast": "qwen3-4b"}
+	cfg.Proxies[0].Keys = []config.APIKey{{Name: "team-a", Key: "sk-team-a"}}
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+	reply := `{"choices":[]}`
+	handler := WithAudit(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.ModifyRequest(req)
+		io.ReadAll(req.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(reply))
+	}), "localhost:8081")
+
+	send := func(token, body string) {
+		req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	body := `{"model":"fast","messages":[]}`
+	send("sk-team-a", body)
+	send("sk-unlisted", body)
+
+	content, _ := os.ReadFile(path)
+	if n, err := audit.Verify(bytes.NewReader(content)); err != nil || n != 2 {
+		t.Fatalf("Verify = %d, %v; want 2 records", n, err)
+	}
+	if strings.Contains(string(content), "sk-") || strings.Contains(string(content), "messages") {
+		t.Fatalf("audit log holds a token or body content:\n%s", content)
+	}
+
+	var records []audit.Record
+	for line := range strings.Lines(string(content)) {
+		var rec audit.Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		records = append(records, rec)
+	}
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	got := records[0]
+	if got.Key != "team-a" || got.Model != "qwen3-4b" || got.Routes != "chat" || got.Status != http.StatusCreated {
+		t.Errorf("record = %+v, want key team-a, model qwen3-4b, route chat, status 201", got)
+	}
+	if got.RequestSHA256 != sum(body) || got.RequestBytes != int64(len(body)) {
+		t.Errorf("request hash = %s (%d bytes), want the client's body", got.RequestSHA256, got.RequestBytes)
+	}
+	if got.ResponseSHA256 != sum(reply) || got.ResponseBytes != int64(len(reply)) {
+		t.Errorf("response hash = %s (%d bytes), want the reply sent", got.ResponseSHA256, got.ResponseBytes)
+	}
+	if key := records[1].Key; !strings.HasPrefix(key, "sha256:") {
+		t.Errorf("unlisted key = %q, want a token fingerprint", key)
+	}
+}
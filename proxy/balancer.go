@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// Balancer picks which of a proxy's targets receives each request
+type Balancer struct {
+	size int
+	next atomic.Uint64
+
+	affinity *config.AffinityConfig
+	session  *config.SessionConfig
+	maxBody  int64
+}
+
+// NewBalancer creates a round-robin balancer over size targets
+func NewBalancer(size int) *Balancer {
+	return &Balancer{size: size}
+}
+
+// NewAffinityBalancer creates a balancer that sends requests with the same session ID or
+// affinity key to the same target, and round-robins the rest. Either config may be nil.
+// maxBody caps how much of a body is read to find the key.
+func NewAffinityBalancer(size int, affinity *config.AffinityConfig, session *config.SessionConfig, maxBody int64) *Balancer {
+	return &Balancer{size: size, affinity: affinity, session: session, maxBody: maxBody}
+}
+
+// Pick returns the index of the target that should serve req
+func (b *Balancer) Pick(req *http.Request) int {
+	if b.size <= 1 {
+		return 0
+	}
+	if target, ok := b.AffinityTarget(req); ok {
+		return target
+	}
+	return int((b.next.Add(1) - 1) % uint64(b.size))
+}
+
+// AffinityTarget returns the target pinned by req's affinity key, if it has one
+func (b *Balancer) AffinityTarget(req *http.Request) (int, bool) {
+	if b.size <= 1 {
+		return 0, false
+	}
+	key := b.affinityKey(req)
+	if key == "" {
+		return 0, false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	target := int(h.Sum64() % uint64(b.size))
+	logger.Debug("Affinity target selected", "target_index", target)
+	return target, true
+}
+
+// affinityKey returns the request's affinity key: the session ID, then the configured
+// header, then the body field, then a hash of the first messages. The body is left
+// readable for the handler.
+func (b *Balancer) affinityKey(req *http.Request) string {
+	if b.affinity == nil && b.session == nil {
+		return ""
+	}
+	if id := b.session.ID(req.Header, nil); id != "" {
+		return "session:" + id
+	}
+	var affinity config.AffinityConfig
+	if b.affinity != nil {
+		affinity = *b.affinity
+	}
+	if affinity.Header != "" {
+		if v := req.Header.Get(affinity.Header); v != "" {
+			return "header:" + v
+		}
+	}
+	sessionBody := b.session != nil && b.session.Body != ""
+	if (affinity.Body == "" && affinity.Messages == 0 && !sessionBody) || req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+
+	peeked, err := io.ReadAll(io.LimitReader(req.Body, b.maxBody+1))
+	req.Body = readCloser{io.MultiReader(bytes.NewReader(peeked), req.Body), req.Body}
+	if err != nil || int64(len(peeked)) > b.maxBody {
+		return ""
+	}
+	var data map[string]any
+	if json.Unmarshal(peeked, &data) != nil {
+		return ""
+	}
+
+	if id := b.session.ID(nil, data); id != "" {
+		return "session:" + id
+	}
+	if affinity.Body != "" {
+		switch v := data[affinity.Body].(type) {
+		case string:
+			if v != "" {
+				return "body:" + v
+			}
+		case float64:
+			encoded, _ := json.Marshal(v)
+			return "body:" + string(encoded)
+		}
+	}
+	if n := affinity.Messages; n > 0 {
+		messages := asSlice(data["messages"])
+		if len(messages) == 0 {
+			return ""
+		}
+		// Earlier turns stay the same as a conversation grows, so they identify it
+		encoded, _ := json.Marshal(messages[:min(n, len(messages))])
+		return "messages:" + string(encoded)
+	}
+	return ""
+}
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// batchSizeFromRequest returns the embeddings batch size selected by ModifyRequest, or 0
+func batchSizeFromRequest(req *http.Request) int {
+	if v, ok := req.Context().Value(routeContextKey).(*responseRouteContext); ok && v != nil {
+		return v.batchSize
+	}
+	return 0
+}
+
+// splitEmbeddings sets the batch size of the first matched embeddings policy when the
+// request has more inputs than fit in one batch
+func (h *Handler) splitEmbeddings(e *requestEdit) {
+	if !e.json {
+		return
+	}
+	rule := e.firstRoute(func(r *config.Route) bool { return r.Embeddings != nil })
+	if rule == nil {
+		return
+	}
+	if inputs := embeddingInputs(e.data); len(inputs) > rule.Embeddings.BatchSize {
+		e.route.batchSize = rule.Embeddings.BatchSize
+		logger.Debug("Splitting embeddings request", "inputs", len(inputs), "batch_size", rule.Embeddings.BatchSize)
+	}
+}
+
+// embeddingInputs returns the input list of an embeddings request. A single string or a
+// single token array is one input and is never split.
+func embeddingInputs(data map[string]any) []any {
+	inputs, ok := data["input"].([]any)
+	if !ok || len(inputs) == 0 {
+		return nil
+	}
+	if _, isToken := inputs[0].(float64); isToken {
+		return nil
+	}
+	return inputs
+}
+
+type batchingTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip sends an oversized embeddings request as sequential batches and merges the
+// responses. The first failing batch is returned as is.
+func (t *batchingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	size := batchSizeFromRequest(req)
+	if size == 0 || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	data, err := decodeBody(body)
+	if err != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		return t.base.RoundTrip(req)
+	}
+	inputs := embeddingInputs(data)
+	if len(inputs) <= size {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		return t.base.RoundTrip(req)
+	}
+
+	var first *http.Response
+	var parts []map[string]any
+	for start := 0; start < len(inputs); start += size {
+		data["input"] = inputs[start:min(start+size, len(inputs))]
+		batch, _ := encodeBody(data, body, true)
+
+		out := req.Clone(req.Context())
+		out.Body = io.NopCloser(bytes.NewReader(batch))
+		out.ContentLength = int64(len(batch))
+		out.Header.Set("Content-Length", strconv.Itoa(len(batch)))
+		// Batch replies are parsed here, so let the transport undo any compression
+		out.Header.Del("Accept-Encoding")
+
+		resp, err := t.base.RoundTrip(out)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= http.StatusBadRequest {
+			logger.Info("Embeddings batch failed", "path", req.URL.Path, "batch_start", start, "status", resp.StatusCode)
+			return resp, nil
+		}
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, replyLimit+1))
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embeddings batch: %w", err)
+		}
+		if len(respBody) > replyLimit {
+			return nil, fmt.Errorf("embeddings batch reply too large: over %d bytes", replyLimit)
+		}
+		var part map[string]any
+		if err := json.Unmarshal(respBody, &part); err != nil {
+			return nil, fmt.Errorf("embeddings batch returned invalid JSON: %w", err)
+		}
+		parts = append(parts, part)
+		if first == nil {
+			first = resp
+		}
+	}
+
+	merged, _ := json.Marshal(mergeEmbeddings(parts, size))
+	logger.Debug("Merged embeddings batches", "path", req.URL.Path, "inputs", len(inputs), "batches", len(parts))
+
+	first.Body = io.NopCloser(bytes.NewReader(merged))
+	first.ContentLength = int64(len(merged))
+	first.Header.Set("Content-Length", strconv.Itoa(len(merged)))
+	first.Header.Del("Content-Encoding")
+	first.Request = req
+	return first, nil
+}
+
+// mergeEmbeddings combines batch responses in order. OpenAI data entries are re-indexed and
+// usage summed; Ollama embeddings are concatenated and eval counts summed.
+func mergeEmbeddings(parts []map[string]any, size int) map[string]any {
+	merged := parts[0]
+	var data, embeddings []any
+	usage := make(map[string]any)
+	counters := map[string]float64{}
+	for i, part := range parts {
+		for _, d := range asSlice(part["data"]) {
+			if entry, ok := d.(map[string]any); ok {
+				if idx, ok := entry["index"].(float64); ok {
+					entry["index"] = idx + float64(i*size)
+				}
+			}
+			data = append(data, d)
+		}
+		embeddings = append(embeddings, asSlice(part["embeddings"])...)
+		if u, ok := part["usage"].(map[string]any); ok {
+			for k, v := range u {
+				if n, ok := v.(float64); ok {
+					usage[k] = asFloat(usage[k]) + n
+				}
+			}
+		}
+		for _, k := range []string{"prompt_eval_count", "total_duration", "load_duration"} {
+			if n, ok := part[k].(float64); ok {
+				counters[k] += n
+			}
+		}
+	}
+
+	if data != nil {
+		merged["data"] = data
+	}
+	if embeddings != nil {
+		merged["embeddings"] = embeddings
+	}
+	if len(usage) > 0 {
+		merged["usage"] = usage
+	}
+	for k, v := range counters {
+		merged[k] = v
+	}
+	return merged
+}
+
+func asFloat(v any) float64 {
+	n, _ := v.(float64)
+	return n
+}
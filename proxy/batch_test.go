@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func embeddingsRoute(batchSize int) config.Route {
+	return config.Route{
+		Paths:      newPatternField("^/v1/embeddings$", "^/api/embed$"),
+		Embeddings: &config.EmbeddingsPolicy{BatchSize: batchSize},
+	}
+}
+
+// embeddingsBackend answers each input with a one-element vector holding the input's number
+func embeddingsBackend(t *testing.T, batchSizes *[]int) *httptest.Server {
+	return httptest.NewServer(embeddingsReplies(t, batchSizes))
+}
+
+func embeddingsReplies(t *testing.T, batchSizes *[]int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		*batchSizes = append(*batchSizes, len(req.Input))
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/embed" {
+			var embeddings []any
+			for _, in := range req.Input {
+				var n float64
+				fmt.Sscanf(in, "text %g", &n)
+				embeddings = append(embeddings, []float64{n})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"model": "nomic", "embeddings": embeddings, "prompt_eval_count": len(req.Input)})
+			return
+		}
+		var data []any
+		for i, in := range req.Input {
+			var n float64
+			fmt.Sscanf(in, "text %g", &n)
+			data = append(data, map[string]any{"object": "embedding", "index": i, "embedding": []float64{n}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"object": "list",
+			"model":  "nomic",
+			"data":   data,
+			"usage":  map[string]any{"prompt_tokens": 2 * len(req.Input), "total_tokens": 2 * len(req.Input)},
+		})
+	}
+}
+
+func embeddingsRequest(t *testing.T, h *Handler, backend, path string, inputs int) map[string]any {
+	t.Helper()
+	var input []string
+	for i := range inputs {
+		input = append(input, fmt.Sprintf("text %d", i))
+	}
+	body, _ := json.Marshal(map[string]any{"model": "nomic", "input": input})
+
+	req := httptest.NewRequest("POST", "http://example.com"+path, strings.NewReader(string(body)))
+	h.ModifyRequest(req)
+	req.URL, _ = url.Parse(backend + path)
+	req.RequestURI = ""
+
+	resp, err := NewTransport(http.DefaultTransport).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.ContentLength != int64(len(respBody)) {
+		t.Fatalf("content length = %d, body is %d bytes", resp.ContentLength, len(respBody))
+	}
+	var data map[string]any
+	if err := json.Unmarshal(respBody, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return data
+}
+
+func TestEmbeddingsBatchSplitting(t *testing.T) {
+	var batches []int
+	backend := embeddingsBackend(t, &batches)
+	defer backend.Close()
+
+	data := embeddingsRequest(t, newRouteHandler(t, embeddingsRoute(2), nil), backend.URL, "/v1/embeddings", 5)
+
+	if fmt.Sprint(batches) != "[2 2 1]" {
+		t.Fatalf("batches = %v, want [2 2 1]", batches)
+	}
+	entries := data["data"].([]any)
+	if len(entries) != 5 {
+		t.Fatalf("got %d embeddings, want 5", len(entries))
+	}
+	for i, e := range entries {
+		entry := e.(map[string]any)
+		if entry["index"] != float64(i) || entry["embedding"].([]any)[0] != float64(i) {
+			t.Fatalf("entry %d = %v, want index and embedding %d", i, entry, i)
+		}
+	}
+	usage := data["usage"].(map[string]any)
+	if usage["prompt_tokens"] != float64(10) || usage["total_tokens"] != float64(10) {
+		t.Fatalf("usage = %v, want 10 tokens", usage)
+	}
+}
+
+func TestEmbeddingsBatchSplittingOllama(t *testing.T) {
+	var batches []int
+	backend := embeddingsBackend(t, &batches)
+	defer backend.Close()
+
+	data := embeddingsRequest(t, newRouteHandler(t, embeddingsRoute(3), nil), backend.URL, "/api/embed", 4)
+
+	if fmt.Sprint(batches) != "[3 1]" {
+		t.Fatalf("batches = %v, want [3 1]", batches)
+	}
+	embeddings := data["embeddings"].([]any)
+	if len(embeddings) != 4 || embeddings[3].([]any)[0] != float64(3) {
+		t.Fatalf("embeddings = %v, want 4 in order", embeddings)
+	}
+	if data["prompt_eval_count"] != float64(4) {
+		t.Fatalf("prompt_eval_count = %v, want 4", data["prompt_eval_count"])
+	}
+}
+
+func TestEmbeddingsWithinBatchSizeAreNotSplit(t *testing.T) {
+	var batches []int
+	backend := embeddingsBackend(t, &batches)
+	defer backend.Close()
+
+	embeddingsRequest(t, newRouteHandler(t, embeddingsRoute(8), nil), backend.URL, "/v1/embeddings", 5)
+
+	if fmt.Sprint(batches) != "[5]" {
+		t.Fatalf("batches = %v, want a single call", batches)
+	}
+}
+
+func TestEmbeddingsBatchesOfGzipClients(t *testing.T) {
+	var batches []int
+	replies := embeddingsReplies(t, &batches)
+	// Compresses whenever asked, as many servers do
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			replies(w, r)
+			return
+		}
+		rec := httptest.NewRecorder()
+		replies(rec, r)
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write(rec.Body.Bytes())
+		zw.Close()
+	}))
+	defer backend.Close()
+
+	body := `{"model":"nomic","input":["text 0","text 1","text 2"]}`
+	req := httptest.NewRequest("POST", "http://example.com/v1/embeddings", strings.NewReader(body))
+	req.Header.Set("Accept-Encoding", "gzip")
+	newRouteHandler(t, embeddingsRoute(2), nil).ModifyRequest(req)
+	req.URL, _ = url.Parse(backend.URL + "/v1/embeddings")
+	req.RequestURI = ""
+
+	resp, err := NewTransport(http.DefaultTransport).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	defer resp.Body.Close()
+	var data map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if entries, _ := data["data"].([]any); len(entries) != 3 {
+		t.Fatalf("data = %v, want 3 merged embeddings", data["data"])
+	}
+}
+
+func TestEmbeddingsBatchReplyTooLarge(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strings.Repeat(" ", replyLimit+1)))
+	}))
+	defer backend.Close()
+
+	body := `{"model":"nomic","input":["text 0","text 1","text 2"]}`
+	req := httptest.NewRequest("POST", "http://example.com/v1/embeddings", strings.NewReader(body))
+	newRouteHandler(t, embeddingsRoute(2), nil).ModifyRequest(req)
+	req.URL, _ = url.Parse(backend.URL + "/v1/embeddings")
+	req.RequestURI = ""
+
+	_, err := NewTransport(http.DefaultTransport).RoundTrip(req)
+	if err == nil || !strings.Contains(err.Error(), "batch reply too large") {
+		t.Fatalf("err = %v, want the oversized batch reported", err)
+	}
+}
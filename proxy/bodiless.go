@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// optionsReply returns the options reply of the first route whose paths match, whatever
+// its methods, so a POST route can answer its own preflights
+func (h *Handler) optionsReply(path string) *config.OptionsReply {
+	for i := range h.cfg.Routes {
+		if route := &h.cfg.Routes[i]; route.Options != nil && route.Paths.Matches(path) {
+			return route.Options
+		}
+	}
+	return nil
+}
+
+// optionsResponse is the local answer to an OPTIONS request (see rejectingTransport)
+func optionsResponse(req *http.Request, reply *config.OptionsReply) *http.Response {
+	header := make(http.Header, len(reply.Headers))
+	for name, value := range reply.Headers {
+		header.Set(name, value)
+	}
+	if reply.Status != http.StatusNoContent {
+		header.Set("Content-Length", "0")
+	}
+	return &http.Response{
+		Status:     strconv.Itoa(reply.Status) + " " + http.StatusText(reply.Status),
+		StatusCode: reply.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// editsReply reports whether a reply to req may be changed on its way to the client, so a
+// HEAD request's backend headers could describe a different body than GET would get
+func (h *Handler) editsReply(req *http.Request, matchedRoutes []*config.Route) bool {
+	return len(matchedRoutes) > 0 || !h.transformers.empty() ||
+		(h.cfg.Models.RewritesLists() && isModelListRequest(req))
+}
+
+// answerHead ends the reply to a HEAD request sent upstream as GET: its headers are those
+// of the finished GET reply, with the Content-Length of the body it would carry, and the
+// body is dropped. Streams have no length, so they are closed unread.
+func (h *Handler) answerHead(resp *http.Response) error {
+	if isStreamingContentType(resp.Header.Get("Content-Type")) {
+		resp.Body.Close()
+		resp.Body = http.NoBody
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		return nil
+	}
+	encoded, decoded, err := decodeReply(resp)
+	if err != nil {
+		return err
+	}
+	if err := h.modifyResponse(resp); err != nil {
+		return err
+	}
+	if err := h.encodeReply(resp, encoded, decoded); err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.ContentLength = int64(len(body))
+	resp.Body = http.NoBody
+	logger.Debug("Answered HEAD from GET reply", "path", resp.Request.URL.Path, "content_length", len(body))
+	return nil
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestHeadAndOptions(t *testing.T) {
+	var methods []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"a":1}`))
+	}))
+	defer backend.Close()
+
+	cfg := newTestConfig(backend.URL, []config.Route{
+		{
+			Methods:    newPatternField("GET|HEAD|OPTIONS"),
+			Paths:      newPatternField("^/v1/props"),
+			OnResponse: []config.Action{{Merge: map[string]any{"extra": "hello world"}}},
+		},
+		{
+			Methods: newPatternField("POST"),
+			Paths:   newPatternField("^/v1/chat"),
+			Options: &config.OptionsReply{Headers: map[string]string{"Allow": "POST, OPTIONS"}},
+		},
+	})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+	transport := NewTransport(http.DefaultTransport)
+
+	send := func(method, path string) *http.Response {
+		t.Helper()
+		methods = nil
+		req := httptest.NewRequest(method, backend.URL+path, nil)
+		req.RequestURI = ""
+		h.ModifyRequest(req)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		if err := h.ModifyResponse(resp); err != nil {
+			t.Fatalf("%s %s: ModifyResponse: %v", method, path, err)
+		}
+		return resp
+	}
+
+	get := send("GET", "/v1/props")
+	body, _ := io.ReadAll(get.Body)
+
+	// HEAD is sent as GET so its length is the edited body's
+	head := send("HEAD", "/v1/props")
+	if len(methods) != 1 || methods[0] != "GET" {
+		t.Errorf("backend saw %v, want GET", methods)
+	}
+	headBody, _ := io.ReadAll(head.Body)
+	if want := strconv.Itoa(len(body)); head.Header.Get("Content-Length") != want || head.ContentLength != int64(len(body)) || len(headBody) != 0 {
+		t.Errorf("HEAD Content-Length = %q (%d), body = %q; want %s and no body", head.Header.Get("Content-Length"), head.ContentLength, headBody, want)
+	}
+
+	// OPTIONS to a route's paths is answered by its options reply, whatever its methods
+	options := send("OPTIONS", "/v1/chat/completions")
+	if len(methods) != 0 {
+		t.Errorf("backend saw %v, want no call", methods)
+	}
+	if options.StatusCode != http.StatusNoContent || options.Header.Get("Allow") != "POST, OPTIONS" {
+		t.Errorf("OPTIONS = %d with Allow %q, want 204 with the route's headers", options.StatusCode, options.Header.Get("Allow"))
+	}
+
+	// Other OPTIONS requests still reach the backend
+	send("OPTIONS", "/v1/props")
+	if len(methods) != 1 || methods[0] != "OPTIONS" {
+		t.Errorf("backend saw %v, want OPTIONS", methods)
+	}
+}
@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"slices"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+)
+
+var unbufferedRequests = metrics.NewCounter("llama_matchmaker_unbuffered_requests_total", "Requests over buffer_threshold streamed to the backend without request transforms", "listen")
+
+// bufferLimit returns how much of a request body is read for transforms: buffer_threshold,
+// or the whole request limit when it is unset or the request must be checked in full (key
+// model allowlists, and routes with context, images, or files policies)
+func (h *Handler) bufferLimit(routeIndices []int, key *config.APIKey) int64 {
+	limit := h.cfg.RequestLimit()
+	threshold := h.cfg.BufferThreshold
+	if threshold <= 0 || threshold >= limit || (key != nil && key.Models.Len() > 0) ||
+		slices.ContainsFunc(routeIndices, func(i int) bool { return h.checksBody[i] }) {
+		return limit
+	}
+	return threshold
+}
+
+// skipBuffering records a request streamed to the backend unread because its body is over
+// buffer_threshold. size is -1 for chunked bodies.
+func (h *Handler) skipBuffering(method, path string, size int64) {
+	unbufferedRequests.Add(1, h.cfg.Listen)
+	logger.Info("Streaming request over buffer_threshold without transforms",
+		"method", method, "path", path, "content_length", size, "buffer_threshold", h.cfg.BufferThreshold)
+}
@@ -0,0 +1,27 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+)
+
+// Distributions per model and route, for capacity planning
+var (
+	requestBytes     = metrics.NewHistogram("llama_matchmaker_request_body_bytes", "Request body size as received from the client", metrics.SizeBuckets, "listen", "model", "route")
+	promptTokens     = metrics.NewHistogram("llama_matchmaker_prompt_tokens", "Prompt tokens per request, as reported by backends", metrics.TokenBuckets, "listen", "model", "route")
+	completionTokens = metrics.NewHistogram("llama_matchmaker_completion_tokens", "Completion tokens per request, as reported by backends", metrics.TokenBuckets, "listen", "model", "route")
+	streamSeconds    = metrics.NewHistogram("llama_matchmaker_stream_duration_seconds", "Time from response headers until a streamed body ends", metrics.LatencyBuckets, "listen", "model", "route")
+)
+
+// routesLabel names the matched routes in metrics, joined with commas (see
+// routeMetricLabel); requests matching no route get an empty label
+func (h *Handler) routesLabel(indices []int) string {
+	labels := make([]string, 0, len(indices))
+	for _, i := range indices {
+		if i >= 0 && i < len(h.cfg.Routes) {
+			labels = append(labels, routeMetricLabel(&h.cfg.Routes[i], i))
+		}
+	}
+	return strings.Join(labels, ",")
+}
@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// fanOut is how many single-choice requests stand in for one n > 1 request
+type fanOut struct {
+	n           int
+	concurrency int
+}
+
+func fanOutFromRequest(req *http.Request) *fanOut {
+	if v, ok := req.Context().Value(routeContextKey).(*responseRouteContext); ok && v != nil {
+		return v.fanOut
+	}
+	return nil
+}
+
+// fanOutChoices applies the first matched choices policy to a request for n > 1:
+// rejected over the limit, fanned out otherwise, and passed through when streaming
+func (h *Handler) fanOutChoices(e *requestEdit) {
+	if !e.json || e.route.rejection != nil {
+		return
+	}
+	rule := e.firstRoute(func(r *config.Route) bool { return r.Choices != nil })
+	if rule == nil {
+		return
+	}
+	n := requestedChoices(e.data)
+	switch {
+	case n <= 1:
+	case n > rule.Choices.Max:
+		e.route.rejection = &Rejection{
+			Status:  http.StatusBadRequest,
+			Type:    "invalid_request_error",
+			Code:    "too_many_choices",
+			Message: fmt.Sprintf("n = %d exceeds the limit of %d", n, rule.Choices.Max),
+		}
+	case e.data["stream"] == true:
+		logger.Debug("Skipped fan-out for streaming request", "n", n)
+	default:
+		e.route.fanOut = &fanOut{n: n, concurrency: rule.Choices.Concurrency}
+		logger.Debug("Fanning out request", "n", n, "concurrency", rule.Choices.Concurrency)
+	}
+}
+
+// requestedChoices returns a chat request's n, or 0 when unset
+func requestedChoices(data map[string]any) int {
+	n, _ := data["n"].(float64)
+	return int(n)
+}
+
+type fanOutTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip sends n copies of a request with n removed, at most concurrency at a time, and
+// merges their choices into one reply. The first failure is returned as is. A request seed
+// is offset per copy so the completions differ.
+func (t *fanOutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fan := fanOutFromRequest(req)
+	if fan == nil || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	data, err := decodeBody(body)
+	if err != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		return t.base.RoundTrip(req)
+	}
+	delete(data, "n")
+	seed, hasSeed := data["seed"]
+
+	responses := make([]*http.Response, fan.n)
+	errs := make([]error, fan.n)
+	sem := make(chan struct{}, fan.concurrency)
+	var wg sync.WaitGroup
+	for i := range fan.n {
+		if hasSeed {
+			data["seed"] = offsetSeed(seed, i)
+		}
+		copyBody, _ := encodeBody(data, body, true)
+
+		out := req.Clone(req.Context())
+		out.Body = io.NopCloser(bytes.NewReader(copyBody))
+		out.ContentLength = int64(len(copyBody))
+		out.Header.Set("Content-Length", strconv.Itoa(len(copyBody)))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			responses[i], errs[i] = t.base.RoundTrip(out)
+		}()
+	}
+	wg.Wait()
+
+	// Keep the first failure and close everything else
+	var failed *http.Response
+	var failErr error
+	for i, resp := range responses {
+		switch {
+		case errs[i] != nil:
+			if failed == nil && failErr == nil {
+				failErr = errs[i]
+			}
+		case resp.StatusCode >= http.StatusBadRequest && failed == nil && failErr == nil:
+			logger.Info("Fan-out request failed", "path", req.URL.Path, "choice", i, "status", resp.StatusCode)
+			failed = resp
+		}
+	}
+	if failed != nil || failErr != nil {
+		for _, resp := range responses {
+			if resp != nil && resp != failed {
+				resp.Body.Close()
+			}
+		}
+		return failed, failErr
+	}
+
+	parts := make([]map[string]any, fan.n)
+	for i, resp := range responses {
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fan-out reply: %w", err)
+		}
+		if err := json.Unmarshal(respBody, &parts[i]); err != nil {
+			return nil, fmt.Errorf("fan-out reply returned invalid JSON: %w", err)
+		}
+	}
+
+	merged, _ := json.Marshal(mergeChoices(parts))
+	logger.Debug("Merged fan-out replies", "path", req.URL.Path, "n", fan.n)
+
+	first := responses[0]
+	first.Body = io.NopCloser(bytes.NewReader(merged))
+	first.ContentLength = int64(len(merged))
+	first.Header.Set("Content-Length", strconv.Itoa(len(merged)))
+	first.Header.Del("Content-Encoding")
+	first.Request = req
+	return first, nil
+}
+
+// mergeChoices combines single-choice replies in order. Choices are re-indexed, completion
+// tokens summed, and the prompt counted once, as a backend honoring n would report it.
+func mergeChoices(parts []map[string]any) map[string]any {
+	merged := parts[0]
+	var choices []any
+	completion := 0.0
+	hasUsage := false
+	for _, part := range parts {
+		for _, c := range asSlice(part["choices"]) {
+			if choice, ok := c.(map[string]any); ok {
+				choice["index"] = float64(len(choices))
+			}
+			choices = append(choices, c)
+		}
+		if u, ok := part["usage"].(map[string]any); ok {
+			hasUsage = true
+			completion += asFloat(u["completion_tokens"])
+		}
+	}
+
+	if choices != nil {
+		merged["choices"] = choices
+	}
+	if hasUsage {
+		usage, ok := merged["usage"].(map[string]any)
+		if !ok {
+			usage = make(map[string]any)
+			merged["usage"] = usage
+		}
+		prompt := asFloat(usage["prompt_tokens"])
+		usage["completion_tokens"] = completion
+		usage["total_tokens"] = prompt + completion
+	}
+	return merged
+}
+
+// offsetSeed adds i to a seed, keeping seeds too large for a float64 exact
+func offsetSeed(seed any, i int) any {
+	switch n := seed.(type) {
+	case float64:
+		return n + float64(i)
+	case json.Number:
+		if v, err := strconv.ParseInt(n.String(), 10, 64); err == nil && v <= math.MaxInt64-int64(i) {
+			return json.Number(strconv.FormatInt(v+int64(i), 10))
+		}
+		if v, err := strconv.ParseUint(n.String(), 10, 64); err == nil && v <= math.MaxUint64-uint64(i) {
+			return json.Number(strconv.FormatUint(v+uint64(i), 10))
+		}
+	}
+	return seed
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// choicesBackend ignores n and answers with one choice naming the request's seed
+func choicesBackend(t *testing.T, maxInFlight *int32) *httptest.Server {
+	var inFlight int32
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		mu.Lock()
+		*maxInFlight = max(*maxInFlight, now)
+		mu.Unlock()
+
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		if _, ok := req["n"]; ok {
+			t.Errorf("n should be removed from fanned out requests, got %v", req["n"])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"object": "chat.completion",
+			"choices": []any{map[string]any{
+				"index":         0,
+				"message":       map[string]any{"role": "assistant", "content": fmt.Sprintf("seed %v", req["seed"])},
+				"finish_reason": "stop",
+			}},
+			"usage": map[string]any{"prompt_tokens": 10, "completion_tokens": 3, "total_tokens": 13},
+		})
+	}))
+}
+
+func choicesRequest(t *testing.T, h *Handler, backend, body string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(body))
+	h.ModifyRequest(req)
+	req.URL, _ = url.Parse(backend + "/v1/chat/completions")
+	req.RequestURI = ""
+
+	resp, err := NewTransport(http.DefaultTransport).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	return resp
+}
+
+func TestFanOutMergesChoices(t *testing.T) {
+	var maxInFlight int32
+	backend := choicesBackend(t, &maxInFlight)
+	defer backend.Close()
+	h := newRouteHandler(t, config.Route{Choices: &config.ChoicesPolicy{Concurrency: 2}}, nil)
+
+	resp := choicesRequest(t, h, backend.URL, `{"model":"m","n":5,"seed":7,"messages":[]}`)
+	var data map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	choices := data["choices"].([]any)
+	if len(choices) != 5 {
+		t.Fatalf("got %d choices, want 5", len(choices))
+	}
+	for i, c := range choices {
+		choice := c.(map[string]any)
+		if choice["index"] != float64(i) {
+			t.Errorf("choice %d index = %v", i, choice["index"])
+		}
+		if want := fmt.Sprintf("seed %d", 7+i); choice["message"].(map[string]any)["content"] != want {
+			t.Errorf("choice %d content = %v, want %s", i, choice["message"], want)
+		}
+	}
+	usage := data["usage"].(map[string]any)
+	if usage["prompt_tokens"] != 10.0 || usage["completion_tokens"] != 15.0 || usage["total_tokens"] != 25.0 {
+		t.Fatalf("usage = %v, want prompt counted once and completions summed", usage)
+	}
+	if maxInFlight > 2 {
+		t.Fatalf("max in flight = %d, want at most 2", maxInFlight)
+	}
+}
+
+func TestFanOutSkipsSingleAndStreaming(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"content":"x"}}]}`))
+	}))
+	defer backend.Close()
+	h := newRouteHandler(t, config.Route{Choices: &config.ChoicesPolicy{}}, nil)
+
+	for _, body := range []string{
+		`{"model":"m","messages":[]}`,
+		`{"model":"m","n":1,"messages":[]}`,
+		`{"model":"m","n":3,"stream":true,"messages":[]}`,
+	} {
+		resp := choicesRequest(t, h, backend.URL, body)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if calls != 3 {
+		t.Fatalf("backend calls = %d, want 3", calls)
+	}
+}
+
+func TestFanOutRejectsTooMany(t *testing.T) {
+	h := newRouteHandler(t, config.Route{Choices: &config.ChoicesPolicy{Max: 4}}, nil)
+	resp := choicesRequest(t, h, "http://127.0.0.1:1", `{"model":"m","n":5,"messages":[]}`)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "too_many_choices") {
+		t.Fatalf("status = %d, body = %s, want 400 too_many_choices", resp.StatusCode, body)
+	}
+}
+
+func TestFanOutReturnsFirstFailure(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"busy"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"content":"x"}}]}`))
+	}))
+	defer backend.Close()
+	h := newRouteHandler(t, config.Route{Choices: &config.ChoicesPolicy{Concurrency: 1}}, nil)
+
+	resp := choicesRequest(t, h, backend.URL, `{"model":"m","n":3,"messages":[]}`)
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", resp.StatusCode)
+	}
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+)
+
+// Client certificate headers, set from the verified certificate on proxies with
+// ssl_client_ca so routes can match them (when: headers) and backends can read them
+const (
+	ClientCertHeaderPrefix = "X-Client-Cert-"
+	ClientCertSubject      = ClientCertHeaderPrefix + "Subject" // Full subject, ex: CN=alice,OU=ml,O=Example
+	ClientCertCN           = ClientCertHeaderPrefix + "CN"
+	ClientCertOrg          = ClientCertHeaderPrefix + "O"  // Organizations, comma-joined
+	ClientCertOrgUnit      = ClientCertHeaderPrefix + "OU" // Organizational units, comma-joined
+)
+
+// WithClientCert replaces any X-Client-Cert-* headers the client sent with the subject of
+// the certificate it presented, so they can only come from a verified certificate
+func WithClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for name := range req.Header {
+			if strings.HasPrefix(name, ClientCertHeaderPrefix) {
+				req.Header.Del(name)
+			}
+		}
+		setClientCertHeaders(req.Header, req.TLS)
+		next.ServeHTTP(w, req)
+	})
+}
+
+func setClientCertHeaders(header http.Header, state *tls.ConnectionState) {
+	// Only certificates that chain to ssl_client_ca have verified chains
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return
+	}
+	subject := state.VerifiedChains[0][0].Subject
+	header.Set(ClientCertSubject, subject.String())
+	fields := []struct {
+		name   string
+		values []string
+	}{
+		{ClientCertCN, []string{subject.CommonName}},
+		{ClientCertOrg, subject.Organization},
+		{ClientCertOrgUnit, subject.OrganizationalUnit},
+	}
+	for _, f := range fields {
+		if value := strings.Join(f.values, ","); value != "" {
+			header.Set(f.name, value)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// compressMinBytes is the smallest reply compress_responses gzips; smaller ones gain little
+const compressMinBytes = 1024
+
+// decodeReply replaces a gzip-encoded reply body with its decoded bytes, so routes, usage,
+// and logs see the JSON. It returns the backend's bytes and the decoded ones, or nils when
+// the reply wasn't gzip or didn't decode (the body is then left as sent).
+func decodeReply(resp *http.Response) (encoded, decoded []byte, err error) {
+	if !strings.EqualFold(strings.TrimSpace(resp.Header.Get("Content-Encoding")), "gzip") {
+		return nil, nil, nil
+	}
+	encoded, err = readBody(io.LimitReader(resp.Body, replyLimit))
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(encoded))
+
+	zr, err := gzip.NewReader(bytes.NewReader(encoded))
+	if err != nil {
+		logger.Debug("Reply isn't valid gzip, leaving it encoded", "err", err)
+		return nil, nil, nil
+	}
+	decoded, err = readBody(io.LimitReader(zr, replyLimit))
+	if err != nil {
+		logger.Debug("Reply isn't valid gzip, leaving it encoded", "err", err)
+		return nil, nil, nil
+	}
+
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(decoded)))
+	resp.ContentLength = int64(len(decoded))
+	resp.Body = io.NopCloser(bytes.NewReader(decoded))
+	return encoded, decoded, nil
+}
+
+// encodeReply gzips the final reply for clients that accept it, when the backend sent it
+// gzipped (reusing the backend's bytes if nothing changed) or compress_responses is on and
+// it is at least compressMinBytes. Other replies are sent as they are.
+func (h *Handler) encodeReply(resp *http.Response, encoded, decoded []byte) error {
+	if resp.Header.Get("Content-Encoding") != "" || !acceptsGzip(resp.Request.Header) {
+		return nil
+	}
+	if encoded == nil && !h.cfg.CompressResponses {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if encoded == nil || !bytes.Equal(body, decoded) {
+		if encoded == nil && len(body) < compressMinBytes {
+			return nil
+		}
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		encoded = buf.Bytes()
+		logger.Debug("Compressed reply", "bytes", len(body), "compressed_bytes", len(encoded))
+	}
+
+	resp.Header.Set("Content-Encoding", "gzip")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(encoded)))
+	resp.Header.Add("Vary", "Accept-Encoding")
+	resp.ContentLength = int64(len(encoded))
+	resp.Body = io.NopCloser(bytes.NewReader(encoded))
+	return nil
+}
+
+// acceptsGzip reports whether a request's Accept-Encoding allows gzip (or *) with a
+// nonzero q
+func acceptsGzip(header http.Header) bool {
+	for _, value := range header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			coding = strings.TrimSpace(coding)
+			if !strings.EqualFold(coding, "gzip") && coding != "*" {
+				continue
+			}
+			q, found := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q=")
+			if !found {
+				return true
+			}
+			if weight, err := strconv.ParseFloat(q, 64); err != nil || weight > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
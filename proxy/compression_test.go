@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestModifyResponseRecompressesReplies(t *testing.T) {
+	largeReply := `{"data":"` + strings.Repeat("x", 2*compressMinBytes) + `"}`
+	tests := []struct {
+		name           string
+		onResponse     []config.Action
+		compress       bool
+		acceptEncoding string
+		upstream       string
+		gzipUpstream   bool
+		wantGzip       bool
+		wantSame       bool // The backend's gzip bytes are passed through
+		want           string
+	}{
+		{
+			name:           "modified gzip reply",
+			onResponse:     []config.Action{{Merge: map[string]any{"edited": true}}},
+			acceptEncoding: "gzip, deflate",
+			upstream:       `{"original":true}`,
+			gzipUpstream:   true,
+			wantGzip:       true,
+			want:           `"edited":true`,
+		},
+		{
+			name:           "unchanged gzip reply",
+			onResponse:     []config.Action{{When: &config.BoolExpr{Status: newPatternField("^5")}, Merge: map[string]any{"edited": true}}},
+			acceptEncoding: "gzip",
+			upstream:       `{"original":true}`,
+			gzipUpstream:   true,
+			wantGzip:       true,
+			wantSame:       true,
+			want:           `"original":true`,
+		},
+		{
+			name:           "client refusing gzip",
+			onResponse:     []config.Action{{Merge: map[string]any{"edited": true}}},
+			acceptEncoding: "gzip;q=0, identity",
+			upstream:       `{"original":true}`,
+			gzipUpstream:   true,
+			want:           `"edited":true`,
+		},
+		{
+			name:           "compress_responses on a large reply",
+			onResponse:     []config.Action{{Merge: map[string]any{"edited": true}}},
+			compress:       true,
+			acceptEncoding: "gzip",
+			upstream:       largeReply,
+			wantGzip:       true,
+			want:           `"edited":true`,
+		},
+		{
+			name:           "compress_responses skips small replies",
+			onResponse:     []config.Action{{Merge: map[string]any{"edited": true}}},
+			compress:       true,
+			acceptEncoding: "gzip",
+			upstream:       `{"original":true}`,
+			want:           `"edited":true`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig("http://localhost:9000", []config.Route{{
+				Methods:    newPatternField("POST"),
+				Paths:      newPatternField("^/v1/embeddings$"),
+				OnResponse: tt.onResponse,
+			}})
+			cfg.Proxies[0].CompressResponses = tt.compress
+			if err := config.Validate(cfg); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			if err := config.CompileTemplates(cfg); err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			h := NewHandler(cfg.Proxies[0])
+
+			req := httptest.NewRequest("POST", "http://example.com/v1/embeddings", strings.NewReader(`{}`))
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			h.ModifyRequest(req)
+
+			upstream := []byte(tt.upstream)
+			header := http.Header{"Content-Type": {"application/json"}}
+			if tt.gzipUpstream {
+				upstream = gzipped(t, tt.upstream)
+				header.Set("Content-Encoding", "gzip")
+			}
+			resp := &http.Response{Request: req, StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(bytes.NewReader(upstream))}
+			if err := h.ModifyResponse(resp); err != nil {
+				t.Fatalf("ModifyResponse error: %v", err)
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.Header.Get("Content-Length") != strconv.Itoa(len(body)) {
+				t.Errorf("Content-Length = %s, want %d", resp.Header.Get("Content-Length"), len(body))
+			}
+			if got := resp.Header.Get("Content-Encoding") == "gzip"; got != tt.wantGzip {
+				t.Fatalf("gzip = %v, want %v", got, tt.wantGzip)
+			}
+			if tt.wantSame && !bytes.Equal(body, upstream) {
+				t.Error("unchanged reply should pass the backend's gzip bytes through")
+			}
+			if tt.wantGzip {
+				zr, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatalf("gzip reader: %v", err)
+				}
+				body, _ = io.ReadAll(zr)
+			}
+			if !strings.Contains(string(body), tt.want) {
+				t.Errorf("body = %.80s, want %s", body, tt.want)
+			}
+		})
+	}
+}
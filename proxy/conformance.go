@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+	"github.com/spicyneuron/llama-matchmaker/schema"
+)
+
+var conformanceDeviations = metrics.NewCounter("llama_matchmaker_conformance_deviations_total", "Backend replies that did not match the OpenAPI spec, by spec path", "listen", "path")
+
+// maxConformanceErrors caps the deviations logged for one reply
+const maxConformanceErrors = 5
+
+// checkConformance logs and counts the ways a JSON reply body departs from the spec's schema
+// for its request. Replies the spec doesn't describe, and local rejections, are skipped.
+func checkConformance(cfg *config.ConformanceConfig, listen string, resp *http.Response, body []byte) {
+	if cfg == nil || cfg.Spec == nil || rejectionFromRequest(resp.Request) != nil || !strings.Contains(resp.Header.Get("Content-Type"), "application/json") {
+		return
+	}
+	s, specPath, ok := cfg.Spec.ResponseSchema(resp.Request.Method, resp.Request.URL.Path, resp.StatusCode)
+	if !ok {
+		return
+	}
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return
+	}
+	errs := schema.Errors(s, value, maxConformanceErrors)
+	if len(errs) == 0 {
+		return
+	}
+	conformanceDeviations.Add(1, listen, specPath)
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	logger.Info("Reply deviates from OpenAPI spec", "method", resp.Request.Method, "path", resp.Request.URL.Path, "spec_path", specPath, "status", resp.StatusCode, "errors", strings.Join(messages, "; "))
+}
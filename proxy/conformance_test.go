@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestModifyResponseCountsConformanceDeviations(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "openapi.json")
+	os.WriteFile(spec, []byte(`{
+		"servers": [{"url": "/v1"}],
+		"paths": {"/models": {"get": {"responses": {"200": {"content": {"application/json": {"schema": {
+			"type": "object",
+			"required": ["object", "data"],
+			"properties": {"data": {"type": "array", "items": {"type": "object", "required": ["id"]}}}
+		}}}}}}}}
+	}`), 0o644)
+	conformance := &config.ConformanceConfig{OpenAPI: spec}
+	if err := conformance.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	h := NewHandler(config.ProxyConfig{Listen: "conformance-test", Conformance: conformance})
+
+	send := func(body string) {
+		req := httptest.NewRequest("GET", "http://example.com/v1/models", nil)
+		h.ModifyRequest(req)
+		resp := &http.Response{
+			Request:    req,
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+		}
+		if err := h.ModifyResponse(resp); err != nil {
+			t.Fatalf("ModifyResponse: %v", err)
+		}
+		if got, _ := io.ReadAll(resp.Body); string(got) != body {
+			t.Fatalf("body = %s, want it unchanged", got)
+		}
+	}
+
+	send(`{"object": "list", "data": [{"id": "llama"}]}`)
+	if n := conformanceDeviations.Value("conformance-test", "/models"); n != 0 {
+		t.Fatalf("deviations = %v after a conforming reply", n)
+	}
+	send(`{"data": [{"name": "llama"}]}`)
+	if n := conformanceDeviations.Value("conformance-test", "/models"); n != 1 {
+		t.Fatalf("deviations = %v, want 1", n)
+	}
+}
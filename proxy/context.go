@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/tokens"
+)
+
+// limitContext applies the first matched context policy, and arms its overflow retry
+func (h *Handler) limitContext(e *requestEdit) {
+	if !e.json || e.route.rejection != nil {
+		return
+	}
+	rule := e.firstRoute(func(r *config.Route) bool { return r.Context != nil })
+	if rule == nil {
+		return
+	}
+	ollama := strings.HasPrefix(e.req.URL.Path, "/api/")
+	modified, rejection := enforceContextWindow(e.data, h.cfg.Models, rule.Context, ollama)
+	e.modified = e.modified || modified
+	e.route.rejection = rejection
+	if rule.Context.Retry != "" {
+		model, _ := e.data["model"].(string)
+		window, _ := h.cfg.Models.ContextWindow(model)
+		e.route.retry = &overflowRetry{mode: rule.Context.Retry, window: window, margin: rule.Context.Margin, ollama: ollama}
+	}
+}
+
+// enforceContextWindow trims or rejects chat requests whose prompt exceeds the model's
+// context window, then derives max_tokens when the policy asks for it. It reports whether
+// data was modified, and returns a rejection when the request should not reach the backend.
+// ollama selects options.num_predict as the output limit.
+func enforceContextWindow(data map[string]any, models config.ModelsConfig, policy *config.ContextPolicy, ollama bool) (bool, *Rejection) {
+	model, _ := data["model"].(string)
+	window, ok := models.ContextWindow(model)
+	if !ok {
+		logger.Debug("Context window unknown, skipping enforcement", "model", model)
+		return false, nil
+	}
+
+	messages, _ := data["messages"].([]any)
+	promptTokens := tokens.Messages(messages)
+	limit := window - policy.Margin
+	modified := false
+
+	if promptTokens > limit {
+		kept, dropped := messages, 0
+		if policy.Overflow == config.OverflowTruncate {
+			kept, dropped = truncateMessages(messages, limit)
+		}
+		if dropped == 0 {
+			logger.Info("Rejected request exceeding context window", "model", model, "prompt_tokens", promptTokens, "context_window", window)
+			return false, &Rejection{
+				Status:  http.StatusBadRequest,
+				Type:    "invalid_request_error",
+				Code:    "context_length_exceeded",
+				Message: fmt.Sprintf("prompt is about %d tokens, which exceeds the %d-token context window of model '%s'", promptTokens, window, model),
+			}
+		}
+
+		data["messages"] = kept
+		logger.Info("Truncated messages to fit context window",
+			"model", model,
+			"dropped", dropped,
+			"prompt_tokens", promptTokens,
+			"context_window", window)
+		promptTokens = tokens.Messages(kept)
+		modified = true
+	}
+
+	if policy.MaxTokens == config.MaxTokensAuto && fitMaxTokens(data, limit-promptTokens, ollama) {
+		modified = true
+	}
+	return modified, nil
+}
+
+// fitMaxTokens caps the output limit to available when it is missing, unlimited, or too large
+func fitMaxTokens(data map[string]any, available int, ollama bool) bool {
+	if available < 1 {
+		return false
+	}
+
+	container, key := data, "max_tokens"
+	if ollama {
+		options, _ := data["options"].(map[string]any)
+		if options == nil {
+			options = make(map[string]any)
+			data["options"] = options
+		}
+		container, key = options, "num_predict"
+	} else if _, ok := data["max_completion_tokens"]; ok {
+		key = "max_completion_tokens"
+	}
+
+	var requested float64
+	switch n := container[key].(type) {
+	case float64:
+		requested = n
+	case int:
+		requested = float64(n)
+	}
+	if requested > 0 && requested <= float64(available) {
+		return false
+	}
+
+	container[key] = available
+	logger.Debug("Derived output token limit", "field", key, "requested", requested, "limit", available)
+	return true
+}
+
+// truncateMessages drops the oldest non-system messages until the prompt fits. System
+// messages and the final message are always kept, and tool results are never left without
+// the assistant turn that requested them. Returns the original slice and 0 when nothing
+// can be dropped to fit.
+func truncateMessages(messages []any, window int) ([]any, int) {
+	if len(messages) == 0 {
+		return messages, 0
+	}
+
+	var system, rest []any
+	for _, m := range messages[:len(messages)-1] {
+		if msg, ok := m.(map[string]any); ok && msg["role"] == "system" {
+			system = append(system, m)
+		} else {
+			rest = append(rest, m)
+		}
+	}
+	last := messages[len(messages)-1]
+
+	budget := window - tokens.Messages(system) - tokens.Message(last)
+	size := tokens.Messages(rest)
+	start := 0
+	for size > budget && start < len(rest) {
+		size -= tokens.Message(rest[start])
+		start++
+		// A tool result without its assistant turn is rejected by most backends
+		for start < len(rest) && isToolResult(rest[start]) {
+			size -= tokens.Message(rest[start])
+			start++
+		}
+	}
+	if size > budget {
+		return messages, 0
+	}
+
+	kept := make([]any, 0, len(system)+len(rest)-start+1)
+	kept = append(kept, system...)
+	kept = append(kept, rest[start:]...)
+	kept = append(kept, last)
+	return kept, len(messages) - len(kept)
+}
+
+func isToolResult(m any) bool {
+	msg, ok := m.(map[string]any)
+	return ok && msg["role"] == "tool"
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+type failingTransport struct{ t *testing.T }
+
+func (f failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	f.t.Fatal("rejected request reached the backend transport")
+	return nil, nil
+}
+
+// contextWindow gives the llama3 model a window of n tokens
+func contextWindow(n int) func(*config.ProxyConfig) {
+	return func(p *config.ProxyConfig) {
+		p.Models.ContextWindows = map[string]int{"llama3": n}
+	}
+}
+
+func chatBody(messages ...string) string {
+	var msgs []map[string]any
+	for i, content := range messages {
+		role := "user"
+		if i == 0 {
+			role = "system"
+		}
+		msgs = append(msgs, map[string]any{"role": role, "content": content})
+	}
+	encoded, _ := json.Marshal(map[string]any{"model": "llama3", "messages": msgs})
+	return string(encoded)
+}
+
+func TestModifyRequestTruncatesToContextWindow(t *testing.T) {
+	// Each 40-char message is 4 framing + 10 content tokens
+	long := strings.Repeat("x", 40)
+	h := newRouteHandler(t, config.Route{Context: &config.ContextPolicy{}}, contextWindow(45))
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		bytes.NewBufferString(chatBody("system prompt", long+"1", long+"2", long+"3", long+"4")))
+	h.ModifyRequest(req)
+
+	body, _ := io.ReadAll(req.Body)
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	messages := data["messages"].([]any)
+	var contents []string
+	for _, m := range messages {
+		contents = append(contents, m.(map[string]any)["content"].(string))
+	}
+	want := []string{"system prompt", long + "3", long + "4"}
+	if strings.Join(contents, "|") != strings.Join(want, "|") {
+		t.Fatalf("messages = %v, want %v", contents, want)
+	}
+	if rejectionFromRequest(req) != nil {
+		t.Fatal("truncated request should not be rejected")
+	}
+}
+
+func TestModifyRequestRejectsContextOverflow(t *testing.T) {
+	h := newRouteHandler(t, config.Route{Context: &config.ContextPolicy{Overflow: config.OverflowReject}}, contextWindow(10))
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		bytes.NewBufferString(chatBody("system", strings.Repeat("x", 200))))
+	h.ModifyRequest(req)
+
+	resp, err := NewTransport(failingTransport{t}).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip error: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "context_length_exceeded") {
+		t.Fatalf("body = %s, want context_length_exceeded error", body)
+	}
+}
+
+func TestTruncateMessagesKeepsToolPairs(t *testing.T) {
+	long := strings.Repeat("x", 400)
+	messages := []any{
+		map[string]any{"role": "system", "content": "sys"},
+		map[string]any{"role": "assistant", "content": long, "tool_calls": []any{map[string]any{"id": "1"}}},
+		map[string]any{"role": "tool", "content": "result"},
+		map[string]any{"role": "user", "content": "latest"},
+	}
+
+	kept, dropped := truncateMessages(messages, 20)
+	if dropped != 2 || len(kept) != 2 {
+		t.Fatalf("kept %d, dropped %d; want 2 kept, 2 dropped", len(kept), dropped)
+	}
+
+	if _, dropped := truncateMessages(messages[3:], 1); dropped != 0 {
+		t.Fatal("a lone final message can never be dropped")
+	}
+}
+
+func TestModifyRequestDerivesMaxTokens(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods: newPatternField("POST"),
+		Paths:   newPatternField("^/v1/chat/completions$", "^/api/chat$"),
+		Context: &config.ContextPolicy{MaxTokens: config.MaxTokensAuto, Margin: 10},
+	}})
+	cfg.Proxies[0].Models.ContextWindows = map[string]int{"llama3": 100}
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+
+	// "hi" is 1 content token + 4 framing, leaving 100 - 5 - 10 = 85
+	tests := []struct {
+		name  string
+		path  string
+		body  string
+		field func(map[string]any) any
+		want  any
+	}{
+		{"omitted", "/v1/chat/completions", `{"model":"llama3","messages":[{"role":"user","content":"hi"}]}`,
+			func(d map[string]any) any { return d["max_tokens"] }, 85.0},
+		{"too large", "/v1/chat/completions", `{"model":"llama3","max_tokens":4096,"messages":[{"role":"user","content":"hi"}]}`,
+			func(d map[string]any) any { return d["max_tokens"] }, 85.0},
+		{"within budget", "/v1/chat/completions", `{"model":"llama3","max_tokens":20,"messages":[{"role":"user","content":"hi"}]}`,
+			func(d map[string]any) any { return d["max_tokens"] }, 20.0},
+		{"max_completion_tokens", "/v1/chat/completions", `{"model":"llama3","max_completion_tokens":-1,"messages":[{"role":"user","content":"hi"}]}`,
+			func(d map[string]any) any { return d["max_completion_tokens"] }, 85.0},
+		{"ollama unlimited", "/api/chat", `{"model":"llama3","options":{"num_predict":-1},"messages":[{"role":"user","content":"hi"}]}`,
+			func(d map[string]any) any { return d["options"].(map[string]any)["num_predict"] }, 85.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://example.com"+tt.path, bytes.NewBufferString(tt.body))
+			h.ModifyRequest(req)
+
+			body, _ := io.ReadAll(req.Body)
+			var data map[string]any
+			if err := json.Unmarshal(body, &data); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if got := tt.field(data); got != tt.want {
+				t.Fatalf("limit = %v, want %v (body %s)", got, tt.want, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// applyTimeouts sets the first matched route's timeouts. With deadline_header, the
+// earliest deadline, the client's or the route's, goes upstream in it and ends the call
+// when it passes.
+func (h *Handler) applyTimeouts(e *requestEdit) {
+	if rule := e.firstRoute((*config.Route).HasTimeouts); rule != nil {
+		e.route.timeouts = newRouteTimeouts(rule, e.data)
+	}
+	if h.cfg.DeadlineHeader == "" {
+		return
+	}
+	deadline := h.requestDeadline(e.req, e.route.timeouts)
+	e.req.Header.Del(h.cfg.DeadlineHeader)
+	if deadline.IsZero() {
+		return
+	}
+	e.req.Header.Set(h.cfg.DeadlineHeader, formatDeadline(deadline))
+	if e.route.timeouts == nil {
+		e.route.timeouts = &routeTimeouts{streaming: e.data["stream"] == true}
+	}
+	e.route.timeouts.deadline = deadline
+	if !time.Now().Before(deadline) && e.route.rejection == nil {
+		logger.Info("Rejected request past its deadline", "method", e.method, "path", e.path, "deadline", formatDeadline(deadline))
+		e.route.rejection = &Rejection{
+			Status:  http.StatusGatewayTimeout,
+			Type:    "invalid_request_error",
+			Code:    "deadline_exceeded",
+			Message: "request deadline has already passed",
+		}
+	}
+}
+
+// requestDeadline returns when the request must be answered by: the earlier of the
+// client's deadline_header and, for non-streaming requests, arrival plus the route's
+// response_timeout. Zero means no deadline.
+func (h *Handler) requestDeadline(req *http.Request, limits *routeTimeouts) time.Time {
+	var deadline time.Time
+	if value := req.Header.Get(h.cfg.DeadlineHeader); value != "" {
+		if d, ok := parseDeadline(value); ok {
+			deadline = d
+		} else {
+			logger.Debug("Ignored unparsable deadline header", "header", h.cfg.DeadlineHeader, "value", value)
+		}
+	}
+	if limits != nil && limits.response > 0 && !limits.streaming {
+		received := time.Now()
+		if t := timingsFromContext(req.Context()); t != nil {
+			received = t.received
+		}
+		if d := received.Add(limits.response); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	return deadline
+}
+
+// parseDeadline reads an RFC 3339 timestamp or Unix milliseconds
+func parseDeadline(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, true
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil && ms > 0 {
+		return time.UnixMilli(ms), true
+	}
+	return time.Time{}, false
+}
+
+// formatDeadline writes a deadline as RFC 3339 in UTC, to the millisecond
+func formatDeadline(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
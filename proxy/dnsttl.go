@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// resolvConf names the nameserver asked for record TTLs
+var resolvConf = "/etc/resolv.conf"
+
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+
+	// dnsQueryTimeout bounds a TTL query when ctx has no deadline of its own
+	dnsQueryTimeout = 5 * time.Second
+)
+
+var errDNSShort = errors.New("truncated DNS message")
+
+// lookupTTL asks the first nameserver in resolv.conf for name's A and AAAA records and
+// returns the smallest TTL among the answers, CNAMEs included. The system resolver still
+// picks the addresses (it also reads /etc/hosts); this only says how long they hold.
+func lookupTTL(ctx context.Context, name string) (time.Duration, error) {
+	server, err := nameserver(resolvConf)
+	if err != nil {
+		return 0, err
+	}
+	var ttl uint32
+	found := false
+	for _, qtype := range []uint16{dnsTypeA, dnsTypeAAAA} {
+		t, ok, err := queryTTL(ctx, server, name, qtype)
+		if err != nil {
+			return 0, err
+		}
+		if ok && (!found || t < ttl) {
+			ttl, found = t, true
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("no DNS records for %s", name)
+	}
+	return time.Duration(ttl) * time.Second, nil
+}
+
+// nameserver returns the first nameserver listed in a resolv.conf file, with port 53
+func nameserver(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	for line := range strings.Lines(string(data)) {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+	return "", fmt.Errorf("no nameserver in %s", path)
+}
+
+// queryTTL sends one UDP query and returns the smallest TTL of its answers, or false when
+// the name has no records of qtype
+func queryTTL(ctx context.Context, server, name string, qtype uint16) (uint32, bool, error) {
+	id := uint16(rand.Uint32())
+	query, err := dnsQuery(id, name, qtype)
+	if err != nil {
+		return 0, false, err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, false, err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(dnsQueryTimeout)
+	}
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := conn.Write(query); err != nil {
+		return 0, false, err
+	}
+	reply := make([]byte, 512)
+	n, err := conn.Read(reply)
+	if err != nil {
+		return 0, false, err
+	}
+	return answerTTL(reply[:n], id)
+}
+
+// dnsQuery builds a recursive query for name's records of qtype
+func dnsQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	msg := []byte{byte(id >> 8), byte(id), 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for label := range strings.SplitSeq(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid hostname %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0, byte(qtype>>8), byte(qtype), 0, 1), nil
+}
+
+// answerTTL reads a reply to query id and returns the smallest TTL among its answers
+func answerTTL(msg []byte, id uint16) (uint32, bool, error) {
+	if len(msg) < 12 {
+		return 0, false, errDNSShort
+	}
+	if binary.BigEndian.Uint16(msg) != id || msg[2]&0x80 == 0 {
+		return 0, false, errors.New("unexpected DNS reply")
+	}
+	if msg[2]&0x02 != 0 {
+		return 0, false, errors.New("DNS reply truncated")
+	}
+	switch rcode := msg[3] & 0x0f; rcode {
+	case 0:
+	case 3: // NXDOMAIN
+		return 0, false, nil
+	default:
+		return 0, false, fmt.Errorf("DNS reply code %d", rcode)
+	}
+
+	questions := binary.BigEndian.Uint16(msg[4:])
+	answers := binary.BigEndian.Uint16(msg[6:])
+	off := 12
+	var err error
+	for range questions {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return 0, false, err
+		}
+		off += 4
+	}
+	var ttl uint32
+	found := false
+	for range answers {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return 0, false, err
+		}
+		if off+10 > len(msg) {
+			return 0, false, errDNSShort
+		}
+		rrTTL := binary.BigEndian.Uint32(msg[off+4:])
+		off += 10 + int(binary.BigEndian.Uint16(msg[off+8:]))
+		if off > len(msg) {
+			return 0, false, errDNSShort
+		}
+		if !found || rrTTL < ttl {
+			ttl, found = rrTTL, true
+		}
+	}
+	return ttl, found, nil
+}
+
+// skipDNSName returns the offset just past the name at off, which may end in a pointer
+func skipDNSName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errDNSShort
+		}
+		switch l := int(msg[off]); {
+		case l == 0:
+			return off + 1, nil
+		case l&0xc0 == 0xc0:
+			return off + 2, nil
+		default:
+			off += 1 + l
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// ExplainHeader asks for an explanation on requests ("true") and carries it on responses
+const ExplainHeader = "X-Proxy-Explain"
+
+// wantsExplain reports whether a request asked for ExplainHeader; debug mode always does
+func wantsExplain(req *http.Request, debug bool) bool {
+	if debug || logger.IsDebug() {
+		return true
+	}
+	want, _ := strconv.ParseBool(req.Header.Get(ExplainHeader))
+	return want
+}
+
+// explanation summarizes the matched routes and fired actions on one header line, naming
+// routes by name when set and by index otherwise, and API key actions as key. Each action
+// lists the fields it changed.
+//
+//	routes=chat-defaults,6; request=chat-defaults[0]:max_tokens+temperature,6[1]:-
+func explanation(rules []*config.Route, indices []int, fired []config.FiredAction) string {
+	labels := map[int]string{keyActionsRoute: "key"}
+	var routes []string
+	for i, index := range indices {
+		label := strconv.Itoa(index)
+		if i < len(rules) && rules[i] != nil && rules[i].Name != "" {
+			label = rules[i].Name
+		}
+		labels[index] = label
+		routes = append(routes, label)
+	}
+	if len(routes) == 0 {
+		routes = []string{"-"}
+	}
+
+	parts := []string{"routes=" + strings.Join(routes, ",")}
+	for _, phase := range []string{"request", "response"} {
+		var actions []string
+		for _, a := range fired {
+			if a.Phase != phase {
+				continue
+			}
+			label, ok := labels[a.Route]
+			if !ok {
+				label = strconv.Itoa(a.Route)
+			}
+			changes := "-"
+			if len(a.Changes) > 0 {
+				changes = strings.Join(a.Changes, "+")
+			}
+			index := strconv.Itoa(a.Index)
+			if a.Else {
+				index += ".else"
+			}
+			actions = append(actions, label+"["+index+"]:"+changes)
+		}
+		if len(actions) > 0 {
+			parts = append(parts, phase+"="+strings.Join(actions, ","))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
@@ -5,22 +5,129 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spicyneuron/llama-matchmaker/config"
 	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/traffic"
+	"github.com/spicyneuron/llama-matchmaker/translate"
 )
 
 type contextKey string
 
 const routeContextKey contextKey = "matched_route"
 
+// SeedHeader reports the seed a seed action sent upstream, for reproducing the reply
+const SeedHeader = "X-Seed"
+
 type responseRouteContext struct {
 	rules   []*config.Route
 	indices []int
+	profile *translate.Profile
+
+	// rejection short-circuits the upstream call (see NewTransport)
+	rejection *Rejection
+
+	// options answers an OPTIONS request locally (see NewTransport)
+	options *config.OptionsReply
+
+	// head marks a HEAD request sent upstream as GET, so its reply headers describe the
+	// edited body (see answerHead)
+	head bool
+
+	// model is the backend model requested, for usage accounting
+	model string
+
+	// session is the request's conversation ID (see config.SessionConfig), logged with the reply
+	session string
+
+	// batchSize splits embedding inputs across upstream calls (see NewTransport)
+	batchSize int
+
+	// fanOut emulates n > 1 with several single-choice upstream calls (see NewTransport)
+	fanOut *fanOut
+
+	// retry resends the request once after a backend context overflow (see NewTransport)
+	retry *overflowRetry
+
+	// resend retries the request after transport errors (see NewTransport)
+	resend *config.RetryPolicy
+
+	// timeouts bound the upstream call and reply (see NewTransport)
+	timeouts *routeTimeouts
+
+	// rewindable marks a buffered or empty body, which can be sent again (see NewTransport)
+	rewindable bool
+
+	// request is the client's request, for on_response actions that use it
+	request *config.RequestData
+
+	// redactions maps placeholders back to the text redacted from the request
+	redactions map[string]string
+
+	// seed is the seed in effect after seed actions, echoed in SeedHeader
+	seed string
+
+	// fired lists the on_request actions whose when matched
+	fired []config.FiredAction
+
+	// schema is checked against non-streaming replies (structured_output.validate)
+	schema map[string]any
+
+	// explain returns ExplainHeader on the response
+	explain bool
+
+	// exchange is the request's dashboard record (0 when not recording); mask hides
+	// redacted text in what it keeps
+	exchange uint64
+	mask     func(string) string
+
+	// trace is the request's trace file, written when the response ends (nil when not tracing)
+	trace *requestTrace
+}
+
+// Trace is what ModifyRequest decided for a request
+type Trace struct {
+	Routes    []int                // Indices of matched routes, in order
+	Fired     []config.FiredAction // on_request actions whose when matched
+	Rejection *Rejection           // Set when the proxy answers without contacting the backend
+}
+
+// TraceFromRequest returns the trace ModifyRequest left on req
+func TraceFromRequest(req *http.Request) Trace {
+	if v, ok := req.Context().Value(routeContextKey).(*responseRouteContext); ok && v != nil {
+		return Trace{Routes: v.indices, Fired: v.fired, Rejection: v.rejection}
+	}
+	return Trace{}
+}
+
+// profileFromContext returns the translation profile selected for the request, if any.
+func profileFromContext(ctx context.Context) *translate.Profile {
+	if v, ok := ctx.Value(routeContextKey).(*responseRouteContext); ok && v != nil {
+		return v.profile
+	}
+	return nil
+}
+
+// requestDataFromContext returns the request kept for on_response actions, if any
+func requestDataFromContext(ctx context.Context) *config.RequestData {
+	if v, ok := ctx.Value(routeContextKey).(*responseRouteContext); ok && v != nil {
+		return v.request
+	}
+	return nil
+}
+
+// isStreamingContentType reports whether a response should be processed chunk by chunk
+func isStreamingContentType(contentType string) bool {
+	return strings.Contains(contentType, "text/event-stream") || strings.Contains(contentType, "application/x-ndjson")
 }
 
 func headersJSON(headers map[string][]string) string {
@@ -41,21 +148,39 @@ func headersJSON(headers map[string][]string) string {
 	return string(b)
 }
 
+// StatusClientClosedRequest is the non-standard status recorded when the client
+// disconnects before the upstream response completes.
+const StatusClientClosedRequest = 499
+
+// IsClientDisconnect reports whether err was caused by the client going away
+// rather than by the upstream.
+func IsClientDisconnect(req *http.Request, err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return true
+	}
+	return req != nil && req.Context().Err() == context.Canceled
+}
+
 // MatchRoutes returns matching routes and their indices in order.
 func MatchRoutes(req *http.Request, routes []config.Route) ([]*config.Route, []int) {
-	logger.Debug("Evaluating routes for request", "route_count", len(routes), "method", req.Method, "path", req.URL.Path)
+	return matchRoutesByPath(req.Method, req.URL.Path, req.Header, routes)
+}
+
+func matchRoutesByPath(method, path string, headers http.Header, routes []config.Route) ([]*config.Route, []int) {
+	logger.Debug("Evaluating routes for request", "route_count", len(routes), "method", method, "path", path)
 
 	var matchedRoutes []*config.Route
 	var matchedIndices []int
 
 	for i := range routes {
 		route := &routes[i]
-		methodMatch := route.Methods.Matches(req.Method)
-		pathMatch := route.Paths.Matches(req.URL.Path)
+		methodMatch := route.Methods.Matches(method)
+		pathMatch := route.Paths.Matches(path)
+		contentMatch := route.MatchesContentType(headers)
 
-		logger.Debug("Route evaluation", "index", i, "methods", route.Methods.Patterns, "paths", route.Paths.Patterns, "method_match", methodMatch, "path_match", pathMatch)
+		logger.Debug("Route evaluation", "index", i, "methods", route.Methods.Patterns, "paths", route.Paths.Patterns, "method_match", methodMatch, "path_match", pathMatch, "content_type_match", contentMatch)
 
-		if methodMatch && pathMatch {
+		if methodMatch && pathMatch && contentMatch {
 			logger.Debug("Route matched", "index", i)
 			matchedRoutes = append(matchedRoutes, route)
 			matchedIndices = append(matchedIndices, i)
@@ -77,130 +202,583 @@ func FindMatchingRoutes(req *http.Request, routes []config.Route) []*config.Rout
 	return matchedRoutes
 }
 
+// Handler applies a proxy's routes together with its proxy-level settings
+type Handler struct {
+	cfg          config.ProxyConfig
+	transformers transformers
+	readsBody    []bool // By route index, whether matching requests are read and parsed
+	keepsRequest []bool // By route index, whether on_response actions use the request
+	checksBody   []bool // By route index, whether policies limit the body, so it is always read
+	routeIndex   *config.RouteIndex
+	workers      *streamWorkers
+	keys         map[string]*config.APIKey // By bearer token
+	sessions     *sessionTracker           // Nil without session
+}
+
+// NewHandler creates a handler for a single proxy configuration
+func NewHandler(cfg config.ProxyConfig) *Handler {
+	readsBody := make([]bool, len(cfg.Routes))
+	keepsRequest := make([]bool, len(cfg.Routes))
+	checksBody := make([]bool, len(cfg.Routes))
+	for i := range cfg.Routes {
+		readsBody[i] = cfg.Routes[i].NeedsBody()
+		keepsRequest[i] = cfg.Routes[i].UsesRequest()
+		checksBody[i] = cfg.Routes[i].Context != nil || cfg.Routes[i].Images != nil || cfg.Routes[i].Files != nil
+	}
+	return &Handler{
+		cfg:          cfg,
+		readsBody:    readsBody,
+		keepsRequest: keepsRequest,
+		checksBody:   checksBody,
+		routeIndex:   config.NewRouteIndex(cfg.Routes),
+		workers:      newStreamWorkers(cfg.Listen, cfg.StreamWorkers),
+		keys:         keysByToken(cfg.Keys),
+		sessions:     newSessionTracker(cfg.Listen, cfg.Session),
+	}
+}
+
+// matchPath is req's path as routes match it, after normalize_paths
+func (h *Handler) matchPath(req *http.Request) string {
+	return h.cfg.NormalizePaths.Apply(req.URL.Path)
+}
+
+// matchRoutes is MatchRoutes through the handler's route index, on the path from
+// matchPath. Debug logging takes the full scan instead, to log how each route was evaluated.
+func (h *Handler) matchRoutes(method, path string, headers http.Header) ([]*config.Route, []int) {
+	if logger.IsDebug() {
+		return matchRoutesByPath(method, path, headers, h.cfg.Routes)
+	}
+	indices := h.indexMatch(method, path, headers)
+	if len(indices) == 0 {
+		return nil, nil
+	}
+	matched := make([]*config.Route, len(indices))
+	for i, idx := range indices {
+		matched[i] = &h.cfg.Routes[idx]
+	}
+	return matched, indices
+}
+
+// indexMatch is the route index's match, less the routes whose content_types don't fit
+func (h *Handler) indexMatch(method, path string, headers http.Header) []int {
+	indices := h.routeIndex.Match(method, path)
+	return slices.DeleteFunc(indices, func(idx int) bool {
+		return !h.cfg.Routes[idx].MatchesContentType(headers)
+	})
+}
+
+// Priority returns the slot queue class for req: the first matching route's priority, else
+// batch when its bearer token matches slots.batch_keys, else interactive
+func (h *Handler) Priority(req *http.Request) string {
+	for _, idx := range h.indexMatch(req.Method, h.matchPath(req), req.Header) {
+		if p := h.cfg.Routes[idx].Priority; p != "" {
+			return p
+		}
+	}
+	if h.cfg.Slots != nil && h.cfg.Slots.BatchKeys.Len() > 0 {
+		key := config.BearerToken(req.Header.Get("Authorization"))
+		if key != "" && h.cfg.Slots.BatchKeys.Matches(key) {
+			return config.PriorityBatch
+		}
+	}
+	return config.PriorityInteractive
+}
+
 // ModifyRequest processes the request through rules sequentially
 // Each rule is checked and processed immediately before moving to the next rule
 func ModifyRequest(req *http.Request, routes []config.Route) {
+	NewHandler(config.ProxyConfig{Routes: routes}).ModifyRequest(req)
+}
+
+// ModifyResponse processes the response through matching routes
+func ModifyResponse(resp *http.Response, routes []config.Route) error {
+	return NewHandler(config.ProxyConfig{Routes: routes}).ModifyResponse(resp)
+}
+
+// ModifyRequest processes the request through the proxy's rules sequentially
+func (h *Handler) ModifyRequest(req *http.Request) {
 	method := req.Method
 	path := req.URL.Path
-	// Read and limit body size to 10MB to prevent memory exhaustion
-	var body []byte
-	var err error
-	if req.Body != nil {
-		limitedBody := io.LimitReader(req.Body, 10*1024*1024)
-		body, err = io.ReadAll(limitedBody)
-		req.Body.Close()
-		if err != nil {
-			logger.Error("Failed to read request body", "method", method, "path", path, "err", err)
+	matchPath := h.matchPath(req)
+	uri := req.URL.RequestURI()
+	// The explain header is for the proxy, so it never reaches rules or the backend
+	explain := wantsExplain(req, h.cfg.Debug)
+	req.Header.Del(ExplainHeader)
+	recording := traffic.Default.Enabled()
+
+	// Routes match on the request line and headers (content_types among them), never the
+	// body, so they decide up front whether the body is read
+	matchedRoutes, matchedRouteIndices := h.matchRoutes(method, matchPath, req.Header)
+	if matchPath != path {
+		logger.Debug("Path normalized for matching", "path", path, "match_path", matchPath)
+	}
+	h.countRouteHits(matchedRoutes, matchedRouteIndices)
+	tracing := h.tracing(matchedRoutes)
+	key := h.apiKey(req)
+	// Audited requests are read for their model, like recorded ones
+	audited := auditFromContext(req.Context())
+	lazy := !h.needsBody(matchedRouteIndices, recording || audited != nil, tracing, key)
+	if audited != nil {
+		audited.noteKey(key, req)
+		audited.routes = h.routesLabel(matchedRouteIndices)
+	}
+
+	body, lazy, ok := h.readRequestBody(req, matchedRouteIndices, key, lazy)
+	if !ok {
+		return
+	}
+	limit := h.cfg.RequestLimit()
+
+	inbound := []any{"method", method, "path", path}
+	if cn := req.Header.Get(ClientCertCN); cn != "" && h.cfg.SSLClientCA != "" {
+		inbound = append(inbound, "client_cn", cn)
+	}
+	logger.Sampled("Inbound request", inbound...)
+	requestsTotal.Add(1, h.cfg.Listen)
+
+	*req = *withTimings(req)
+	transformStart := time.Now()
+	defer func() {
+		timingsFromContext(req.Context()).set(PhaseTransform, time.Since(transformStart))
+	}()
+
+	// A truncated body would reach the backend as broken JSON, so answer locally instead.
+	// Unread bodies are checked against their declared length, and capped as they stream.
+	if int64(len(body)) > limit || (lazy && req.ContentLength > limit) {
+		logger.Info("Rejected request body over limit", "method", method, "path", path, "limit", limit)
+		rejected := &responseRouteContext{rejection: &Rejection{
+			Status:  http.StatusRequestEntityTooLarge,
+			Type:    "invalid_request_error",
+			Code:    "request_too_large",
+			Message: fmt.Sprintf("request body exceeds the %d-byte limit", limit),
+		}}
+		*req = *req.WithContext(context.WithValue(req.Context(), routeContextKey, rejected))
+		req.Body = http.NoBody
+		req.ContentLength = 0
+		return
+	}
+	if method == http.MethodOptions {
+		if reply := h.optionsReply(matchPath); reply != nil {
+			logger.Debug("Answering OPTIONS locally", "path", path, "status", reply.Status)
+			local := &responseRouteContext{options: reply}
+			*req = *req.WithContext(context.WithValue(req.Context(), routeContextKey, local))
 			return
 		}
 	}
-
-	logger.Info("Inbound request", "method", method, "path", path)
+	if lazy && req.Body != nil && req.Body != http.NoBody {
+		req.Body = http.MaxBytesReader(nil, req.Body, limit)
+	}
 
 	if logger.IsDebug() {
 		logger.Debug("Request headers", "headers", headersJSON(req.Header))
 
 		if len(body) > 0 {
-			safeBody, truncated := sanitizeBody(body, 4096)
+			safeBody, truncated := sanitizeBody(body, 4096, h.cfg.LogRedact)
 			logger.Debug("Request body", "body", safeBody, "truncated", truncated)
 		} else {
 			logger.Debug("Request body omitted", "reason", "empty")
 		}
 	}
 
-	var data map[string]any
-	hasJSONBody := false
-	if len(body) > 0 {
-		if err := json.Unmarshal(body, &data); err == nil {
-			hasJSONBody = true
-		} else {
-			if logger.IsDebug() {
-				logger.Debug("Request body is not JSON, passing through unchanged")
-			}
-			req.Body = io.NopCloser(bytes.NewReader(body))
+	e := &requestEdit{req: req, method: method, path: path, matchPath: matchPath, route: &responseRouteContext{}}
+	e.decodeBody(body)
+
+	headers := headerValues(req.Header)
+	defer releaseHeaderValues(headers)
+
+	query := extractQueryParams(req.URL)
+
+	// Sessions are identified as the client sent the request, before any action edits it
+	e.route.session = h.cfg.Session.ID(req.Header, e.data)
+	turn := 0
+	if e.route.session != "" {
+		turn = h.sessions.observe(e.route.session, time.Now())
+	}
+
+	// on_response actions see the request as the client sent it, before aliases and actions
+	if slices.ContainsFunc(matchedRouteIndices, func(i int) bool { return h.keepsRequest[i] }) {
+		e.route.request = config.NewRequestData(e.data, headers, query)
+	}
+
+	// Key allowlists name models as clients send them, so they are checked before aliasing
+	e.route.rejection = h.checkKey(key, method, path, matchedRoutes, e.data)
+
+	// Key actions run before aliases, so a key can force a model by its alias, and before
+	// routes, so route actions see the key's defaults
+	actionState := &config.ActionState{Diffs: explain || recording || tracing}
+	allAppliedValues := make(map[string]any)
+	if e.json && e.route.rejection == nil && key != nil && key.Compiled != nil {
+		modified, applied := config.ProcessRequestWithState(e.data, headers, query, key.Compiled, keyActionsRoute, method, path, actionState)
+		maps.Copy(allAppliedValues, applied)
+		if modified {
+			e.modified = true
+			logger.Debug("Key actions applied", "key", key.Name)
 		}
 	}
 
-	headers := make(map[string]string)
-	for key, values := range req.Header {
-		if len(values) > 0 {
-			headers[key] = values[0]
+	// Aliases resolve before routes so rules always see backend model names
+	if e.json {
+		if model, ok := e.data["model"].(string); ok {
+			if backend, ok := h.cfg.Models.ResolveAlias(model); ok {
+				e.data["model"] = backend
+				e.modified = true
+				logger.Debug("Resolved model alias", "alias", model, "model", backend)
+			}
 		}
 	}
 
-	query := extractQueryParams(req.URL)
+	if !h.transformers.empty() && e.json {
+		e.modified = true
+	}
+	if e.route.rejection == nil {
+		e.route.rejection = h.transformers.onRequest(BeforeRoutes, req, e.data)
+	}
 
-	matchedRoutes, matchedRouteIndices := MatchRoutes(req, routes)
-	var matchedResponseRoutes responseRouteContext
-	anyModified := false
-	allAppliedValues := make(map[string]any)
+	h.applyRoutes(e, matchedRoutes, matchedRouteIndices, headers, query, actionState, allAppliedValues)
+
+	if e.route.rejection == nil && len(actionState.SchemaErrors) > 0 {
+		logger.Info("Rejected request failing schema validation", "method", method, "path", path, "errors", len(actionState.SchemaErrors))
+		e.route.rejection = &Rejection{
+			Status:  http.StatusBadRequest,
+			Type:    "invalid_request_error",
+			Code:    "schema_validation_failed",
+			Message: "request body does not match the schema: " + actionState.SchemaErrors[0],
+			Details: actionState.SchemaErrors,
+		}
+	}
+	if e.route.rejection == nil {
+		e.route.rejection = h.transformers.onRequest(AfterRoutes, req, e.data)
+	}
+
+	e.route.redactions = actionState.Redactions
+	e.route.seed = actionState.Seed
+	e.route.fired = actionState.Fired
+	e.route.explain = explain
+	if explain {
+		logger.Info("Explain", "method", method, "path", path, "explain", explanation(e.route.rules, e.route.indices, actionState.Fired))
+	}
 
-	for idx, rule := range matchedRoutes {
-		routeIndex := matchedRouteIndices[idx]
+	e.translate()
 
-		matchedResponseRoutes.rules = append(matchedResponseRoutes.rules, rule)
-		matchedResponseRoutes.indices = append(matchedResponseRoutes.indices, routeIndex)
+	// Images and context windows are enforced on the backend dialect, after translation
+	h.limitFiles(e)
+	h.limitImages(e)
+	h.limitContext(e)
+	h.adaptStructuredOutput(e)
+	// Prompt templates consume the final messages, so they render last
+	h.renderPrompt(e)
 
-		if rule.TargetPath != "" {
-			originalPath := req.URL.Path
-			if rule.TargetPath != originalPath {
-				req.URL.Path = rule.TargetPath
-				logger.Debug("Route path rewrite applied", "index", routeIndex, "from", originalPath, "to", rule.TargetPath)
-			}
+	if e.json {
+		e.route.model, _ = e.data["model"].(string)
+		if audited != nil {
+			audited.model = e.route.model
 		}
+	}
+	h.splitEmbeddings(e)
+	h.fanOutChoices(e)
 
-		if !hasJSONBody || len(rule.OnRequest) == 0 {
-			continue
+	// Unread bodies are sized by their declared length; chunked ones go unmeasured
+	if size := int64(len(body)); size > 0 || (lazy && req.ContentLength > 0) {
+		if lazy {
+			size = req.ContentLength
 		}
+		requestBytes.Observe(float64(size), h.cfg.Listen, e.route.model, h.routesLabel(matchedRouteIndices))
+	}
 
-		modified, appliedValues := config.ProcessRequest(data, headers, query, rule.Compiled, routeIndex, method, path)
+	h.applyTimeouts(e)
 
-		if modified {
-			anyModified = true
-			for k, v := range appliedValues {
-				allAppliedValues[k] = v
-			}
-		}
+	// A HEAD reply the routes would edit is measured from the edited GET reply, so its
+	// Content-Length matches what GET returns
+	if method == http.MethodHead && e.route.rejection == nil && h.editsReply(req, matchedRoutes) {
+		req.Method = http.MethodGet
+		e.route.head = true
+	}
 
+	// Unread bodies can't be replayed, so only buffered or empty requests are resent
+	replayable := e.route.rejection == nil && (!lazy || req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0)
+	e.route.rewindable = replayable
+	if h.cfg.Retry != nil && replayable {
+		if method == http.MethodGet || method == http.MethodHead || slices.ContainsFunc(matchedRoutes, func(r *config.Route) bool { return r.Retry }) {
+			e.route.resend = h.cfg.Retry
+		}
 	}
 
-	if len(matchedResponseRoutes.rules) > 0 {
-		ctx := context.WithValue(req.Context(), routeContextKey, &matchedResponseRoutes)
+	if len(e.route.rules) > 0 || e.route.model != "" || e.route.rejection != nil || e.route.resend != nil || e.route.rewindable || e.route.timeouts != nil || e.route.head || e.route.session != "" || explain || recording || tracing {
+		ctx := context.WithValue(req.Context(), routeContextKey, e.route)
 		*req = *req.WithContext(ctx)
 	}
 
-	if hasJSONBody {
-		modifiedBody, err := json.Marshal(data)
-		if err != nil {
-			logger.Error("Failed to marshal modified request JSON", "method", method, "path", path, "err", err)
-			req.Body = io.NopCloser(bytes.NewReader(body))
+	upstreamBody, ok := h.sendBody(e, body, len(allAppliedValues), turn)
+	if !ok {
+		return
+	}
+
+	if recording {
+		e.route.exchange = h.startExchange(req, path, body, upstreamBody, e.route, actionState)
+	}
+	if tracing {
+		e.route.trace = h.startTrace(req, uri, body, upstreamBody, e.route, actionState)
+	}
+}
+
+// requestEdit is a request on its way through ModifyRequest: its parsed body, and what
+// the checks and routes have decided for it so far
+type requestEdit struct {
+	req       *http.Request
+	method    string
+	path      string // As the client sent it, for logs
+	matchPath string
+	data      map[string]any
+	form      *multipartForm // Multipart forms are edited through data, then re-encoded
+	json      bool           // data holds the body, from JSON or a multipart form
+	modified  bool           // data no longer matches the body as sent
+	rewritten bool           // A route's target_path set the upstream path
+	route     *responseRouteContext
+}
+
+// firstRoute returns the first matched route has accepts, or nil
+func (e *requestEdit) firstRoute(has func(*config.Route) bool) *config.Route {
+	if i := slices.IndexFunc(e.route.rules, has); i >= 0 {
+		return e.route.rules[i]
+	}
+	return nil
+}
+
+// readRequestBody buffers the body of a request that isn't lazy, up to the buffer limit
+// for its routes and key. It returns lazy again, true when the body turned out to be over
+// buffer_threshold and the rest streams, and false once the body fails to read.
+func (h *Handler) readRequestBody(req *http.Request, routeIndices []int, key *config.APIKey, lazy bool) ([]byte, bool, bool) {
+	method, path := req.Method, req.URL.Path
+	// Read and limit body size to prevent memory exhaustion
+	limit := h.cfg.RequestLimit()
+	bufferLimit := limit
+	if !lazy {
+		bufferLimit = h.bufferLimit(routeIndices, key)
+		if bufferLimit < limit && req.ContentLength > bufferLimit {
+			lazy = true
+			h.skipBuffering(method, path, req.ContentLength)
+		}
+	}
+	if req.Body == nil || lazy {
+		return nil, lazy, true
+	}
+
+	body, err := readBody(io.LimitReader(req.Body, bufferLimit+1))
+	if err != nil {
+		req.Body.Close()
+		if IsClientDisconnect(req, err) {
+			logger.Info("Request aborted by client disconnect", "method", method, "path", path, "stage", "request_body")
+			return nil, lazy, false
+		}
+		logger.Error("Failed to read request body", "method", method, "path", path, "err", err)
+		return nil, lazy, false
+	}
+	if bufferLimit < limit && int64(len(body)) > bufferLimit {
+		// A chunked body is over buffer_threshold once read past it: the part read
+		// goes out first, then the rest streams
+		req.Body = readCloser{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		h.skipBuffering(method, path, req.ContentLength)
+		return nil, true, true
+	}
+	req.Body.Close()
+	chargeMemory(req.Context(), len(body))
+	return body, lazy, true
+}
+
+// decodeBody parses a JSON or multipart form body into e.data. Any other body is put back
+// to pass through unchanged.
+func (e *requestEdit) decodeBody(body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	var err error
+	if e.data, err = decodeBody(body); err == nil {
+		e.json = true
+		return
+	}
+	contentType := e.req.Header.Get("Content-Type")
+	if isMultipartForm(contentType) {
+		var ok bool
+		if e.form, e.data, ok = parseMultipart(contentType, body); ok {
+			e.json = true
+			logger.Debug("Parsed multipart form", "parts", len(e.form.parts))
 			return
 		}
+		e.form = nil
+		logger.Debug("Multipart body could not be parsed, passing through unchanged")
+	} else if logger.IsDebug() {
+		logger.Debug("Request body is not JSON, passing through unchanged")
+	}
+	e.req.Body = io.NopCloser(bytes.NewReader(body))
+}
+
+// applyRoutes records each matched route for the reply and applies its target_path and
+// on_request actions in order, adding the values the actions set to applied
+func (h *Handler) applyRoutes(e *requestEdit, routes []*config.Route, indices []int, headers, query map[string]string, state *config.ActionState, applied map[string]any) {
+	for idx, rule := range routes {
+		routeIndex := indices[idx]
 
-		req.Body = io.NopCloser(bytes.NewReader(modifiedBody))
-		req.ContentLength = int64(len(modifiedBody))
+		e.route.rules = append(e.route.rules, rule)
+		e.route.indices = append(e.route.indices, routeIndex)
 
-		fields := []any{
-			"method", method,
-			"path", path,
-			"changes", len(allAppliedValues),
+		// First matched route with a format wins; rules always see the client's dialect
+		if rule.Format != "" && e.route.profile == nil {
+			e.route.profile = translate.Lookup(rule.Format)
+		}
+
+		if rule.TargetPath != "" && e.route.rejection == nil {
+			targetPath, err := rule.RenderTargetPath(config.TargetPathData{
+				Method:   e.method,
+				Path:     e.matchPath,
+				Captures: rule.Paths.Captures(e.matchPath),
+				Query:    query,
+				Body:     e.data,
+			})
+			if err != nil {
+				logger.Info("Rejected request with unresolved target_path", "index", routeIndex, "method", e.method, "path", e.path, "err", err)
+				e.route.rejection = &Rejection{
+					Status:  http.StatusBadRequest,
+					Type:    "invalid_request_error",
+					Code:    "target_path_unresolved",
+					Message: "no backend path for this request: " + err.Error(),
+				}
+			} else {
+				e.rewritten = true
+				originalPath := e.req.URL.Path
+				if targetPath != originalPath {
+					e.req.URL.Path = targetPath
+					logger.Debug("Route path rewrite applied", "index", routeIndex, "from", originalPath, "to", targetPath)
+				}
+			}
 		}
-		if len(matchedResponseRoutes.rules) > 0 {
-			fields = append(fields, "matched_routes", matchedResponseRoutes.indices)
+
+		if !e.json || len(rule.OnRequest) == 0 {
+			continue
 		}
-		logger.Info("Outbound request", fields...)
 
-		if anyModified && logger.IsDebug() {
-			finalBody, _ := json.MarshalIndent(data, "  ", "  ")
-			logger.Debug("Outbound request body", "body", string(finalBody))
+		modified, appliedValues := config.ProcessRequestWithState(e.data, headers, query, rule.Compiled, routeIndex, e.method, e.path, state)
+		if modified {
+			e.modified = true
+			maps.Copy(applied, appliedValues)
 		}
-	} else if len(body) > 0 {
+	}
+}
+
+// translate rewrites the request into the backend dialect of the first matched format,
+// unless a route already chose the upstream path
+func (e *requestEdit) translate() {
+	profile := e.route.profile
+	if profile == nil {
+		return
+	}
+	if !e.rewritten && profile.TargetPath != "" && e.req.URL.Path != profile.TargetPath {
+		logger.Debug("Format path rewrite applied", "format", profile.Name, "from", e.req.URL.Path, "to", profile.TargetPath)
+		e.req.URL.Path = profile.TargetPath
+	}
+	if e.json && e.form == nil {
+		e.data = profile.Request(e.data, e.path)
+		e.modified = true
+		logger.Debug("Translated request body", "format", profile.Name)
+	}
+}
+
+// sendBody sets the body the backend receives and returns it, with false when an edited
+// body fails to encode and the original goes out instead
+func (h *Handler) sendBody(e *requestEdit, body []byte, changes, turn int) ([]byte, bool) {
+	req := e.req
+	if !e.json {
+		if len(body) > 0 {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		return body, true
+	}
+
+	// Untouched bodies go out byte for byte, keeping key order, number formatting, and
+	// any signature over them
+	modifiedBody := body
+	var err error
+	if e.modified && e.form != nil {
+		modifiedBody, err = e.form.encode(e.data)
+	} else if e.modified {
+		modifiedBody, err = encodeBody(e.data, body, h.cfg.PreserveKeyOrder)
+	}
+	if err != nil {
+		logger.Error("Failed to marshal modified request JSON", "method", e.method, "path", e.path, "err", err)
 		req.Body = io.NopCloser(bytes.NewReader(body))
+		return nil, false
+	}
+	if e.modified {
+		chargeMemory(req.Context(), len(modifiedBody))
 	}
+
+	req.Body = io.NopCloser(bytes.NewReader(modifiedBody))
+	req.ContentLength = int64(len(modifiedBody))
+
+	fields := []any{
+		"method", e.method,
+		"path", e.path,
+		"changes", changes,
+	}
+	if len(e.route.rules) > 0 {
+		fields = append(fields, "matched_routes", e.route.indices)
+	}
+	if e.route.seed != "" {
+		fields = append(fields, "seed", e.route.seed)
+	}
+	if e.route.session != "" {
+		fields = append(fields, "session", e.route.session, "turn", turn)
+	}
+	logger.Sampled("Outbound request", fields...)
+
+	if e.modified && logger.IsDebug() {
+		logger.Debug("Outbound request body", "body", bodyJSON(e.data, h.cfg.LogRedact))
+	}
+	return modifiedBody, true
 }
 
-// ModifyResponse processes the response through matching routes
-func ModifyResponse(resp *http.Response, routes []config.Route) error {
+// needsBody reports whether a request matching routeIndices is read and parsed, rather
+// than streamed to the backend unread. Aliases, pricing, and key model allowlists all need
+// the request's model, key actions edit the body, and session.body reads it.
+func (h *Handler) needsBody(routeIndices []int, recording, tracing bool, key *config.APIKey) bool {
+	if recording || tracing || logger.IsDebug() || !h.transformers.empty() ||
+		len(h.cfg.Models.Aliases) > 0 || len(h.cfg.Models.Pricing) > 0 || (h.cfg.Session != nil && h.cfg.Session.Body != "") || (key != nil && (key.Models.Len() > 0 || len(key.OnRequest) > 0)) {
+		return true
+	}
+	return slices.ContainsFunc(routeIndices, func(i int) bool { return h.readsBody[i] })
+}
+
+// replyLimit is the most of a non-streaming reply the proxy reads
+const replyLimit = 10 * 1024 * 1024
+
+// ModifyResponse processes the response through the routes matched for its request.
+// Gzipped replies are decoded for the routes, then compressed again for clients that
+// accept gzip. Chunked replies stay chunked, so their trailers still follow the body.
+func (h *Handler) ModifyResponse(resp *http.Response) error {
+	if v, ok := resp.Request.Context().Value(routeContextKey).(*responseRouteContext); ok && v != nil && v.head {
+		return h.answerHead(resp)
+	}
+	if isStreamingContentType(resp.Header.Get("Content-Type")) {
+		return h.modifyResponse(resp)
+	}
+	chunked := resp.ContentLength < 0
+	encoded, decoded, err := decodeReply(resp)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	if err := h.modifyResponse(resp); err != nil {
+		return err
+	}
+	if err := h.encodeReply(resp, encoded, decoded); err != nil {
+		return err
+	}
+	if chunked {
+		keepChunked(resp)
+	}
+	h.forwardTrailers(resp)
+	return nil
+}
+
+func (h *Handler) modifyResponse(resp *http.Response) error {
 	method := resp.Request.Method
 	path := resp.Request.URL.Path
 	contentType := resp.Header.Get("Content-Type")
@@ -208,11 +786,41 @@ func ModifyResponse(resp *http.Response, routes []config.Route) error {
 	// Get the routes from context (may be nil)
 	var matchedRoutes []*config.Route
 	var matchedRouteIndices []int
+	var profile *translate.Profile
+	var model string
+	var replySchema map[string]any
+	var redactions map[string]string
+	var request *config.RequestData
+	var explained *responseRouteContext
+	var traced *requestTrace
+	var responseFired []config.FiredAction
+	var session string
 	switch v := resp.Request.Context().Value(routeContextKey).(type) {
 	case *responseRouteContext:
 		if v != nil {
 			matchedRoutes = v.rules
 			matchedRouteIndices = v.indices
+			profile = v.profile
+			model = v.model
+			replySchema = v.schema
+			redactions = v.redactions
+			request = v.request
+			session = v.session
+			if v.seed != "" {
+				resp.Header.Set(SeedHeader, v.seed)
+			}
+			if v.explain {
+				explained = v
+				resp.Header.Set(ExplainHeader, explanation(v.rules, v.indices, v.fired))
+			}
+			if id, mask := v.exchange, v.mask; id != 0 {
+				// Deferred so the exchange sees the body as finally sent to the client
+				defer func() { recordResponse(resp, id, mask) }()
+			}
+			if traced = v.trace; traced != nil {
+				status, headers := traced.captureUpstream(resp)
+				defer func() { traced.captureResponse(resp, status, headers, responseFired) }()
+			}
 		}
 	case *config.Route:
 		matchedRoutes = []*config.Route{v}
@@ -226,26 +834,57 @@ func ModifyResponse(resp *http.Response, routes []config.Route) error {
 		}
 	}
 
-	// Route to streaming handler if SSE (log events even without on_response operations)
-	if strings.Contains(contentType, "text/event-stream") {
+	// Route to streaming handler if SSE/NDJSON (log events even without on_response operations)
+	if isStreamingContentType(contentType) {
 		if len(matchedRoutes) == 0 {
-			logger.Info("Streaming response", "method", method, "path", path, "status", resp.StatusCode, "content_type", contentType)
+			logger.Sampled("Streaming response", "method", method, "path", path, "status", resp.StatusCode, "content_type", contentType)
 		} else {
-			logger.Info("Streaming response", "method", method, "path", path, "status", resp.StatusCode, "content_type", contentType, "matched_routes", matchedRouteIndices)
+			logger.Sampled("Streaming response", "method", method, "path", path, "status", resp.StatusCode, "content_type", contentType, "matched_routes", matchedRouteIndices)
 		}
 		if logger.IsDebug() {
 			logger.Debug("Streaming response headers", "headers", headersJSON(resp.Header))
 		}
-		return ModifyStreamingResponse(resp, matchedRoutes, matchedRouteIndices)
+		onComplete := func(u Usage, replyModel string, reported bool, summary *streamSummary) {
+			fields := append([]any{"method", method, "path", path}, summary.fields(StreamComplete)...)
+			// Unread request bodies leave the model to the reply
+			if model == "" {
+				model = replyModel
+			}
+			if model != "" || reported {
+				usageFields, _, _ := h.recordUsage(resp.Request, model, matchedRouteIndices, u)
+				if reported {
+					fields = append(fields, usageFields...)
+				}
+			}
+			clock := timingsFromContext(resp.Request.Context())
+			fields = append(fields, clock.finish(h.cfg.Listen, true)...)
+			if d, ok := clock.phase(PhaseStream); ok {
+				streamSeconds.Observe(d.Seconds(), h.cfg.Listen, model, h.routesLabel(matchedRouteIndices))
+			}
+			logger.Sampled("Streaming response complete", fields...)
+		}
+		err := modifyStreamingResponse(resp, matchedRoutes, matchedRouteIndices, streamOptions{
+			redact:       h.cfg.LogRedact,
+			transformers: &h.transformers,
+			keepKeyOrder: h.cfg.PreserveKeyOrder,
+			workers:      h.workers,
+			session:      session,
+			onComplete:   onComplete,
+		})
+		trackStream(resp, h.cfg.Listen)
+		return err
 	}
 
 	// Read response body (limit to 10MB)
-	limitedBody := io.LimitReader(resp.Body, 10*1024*1024)
-	body, err := io.ReadAll(limitedBody)
+	limitedBody := io.LimitReader(resp.Body, replyLimit)
+	body, err := readBody(limitedBody)
 	resp.Body.Close()
 	if err != nil {
 		return fmt.Errorf("failed to read response body: %w", err)
 	}
+	chargeMemory(resp.Request.Context(), len(body))
+	// Replies are checked as the backend sent them, before any route edits them
+	checkConformance(h.cfg.Conformance, h.cfg.Listen, resp, body)
 
 	if logger.IsDebug() {
 		logger.Debug("Inbound response", "status", resp.StatusCode, "status_text", resp.Status)
@@ -253,22 +892,96 @@ func ModifyResponse(resp *http.Response, routes []config.Route) error {
 		logger.Debug("Response headers", "headers", headersJSON(resp.Header))
 
 		if len(body) > 0 {
-			safeBody, truncated := sanitizeBody(body, 4096)
+			safeBody, truncated := sanitizeBody(body, 4096, h.cfg.LogRedact)
 			logger.Debug("Response body", "body", safeBody, "truncated", truncated)
 		} else {
 			logger.Debug("Response body omitted", "reason", "empty")
 		}
 	}
 
+	if h.cfg.Models.RewritesLists() && resp.StatusCode == http.StatusOK && isModelListRequest(resp.Request) {
+		if rewritten, ok := rewriteModelListBody(body, h.cfg.Models); ok {
+			body = rewritten
+			resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			logger.Debug("Rewrote model list", "path", path)
+		}
+	}
+
 	resp.Body = io.NopCloser(bytes.NewReader(body))
 	resp.ContentLength = int64(len(body))
 
-	if len(matchedRoutes) == 0 {
-		logger.Info("Outbound response", "method", method, "path", path, "status", resp.StatusCode, "changes", 0, "reason", "no_matching_rule", "content_type", contentType)
+	var usageFields []any
+	var reported Usage
+	hasUsage := false
+	if resp.StatusCode < http.StatusBadRequest && strings.Contains(contentType, "application/json") {
+		var parsed map[string]any
+		if err := json.Unmarshal(body, &parsed); err == nil {
+			if reported, hasUsage = usageFromBody(parsed); hasUsage && model == "" {
+				model, _ = parsed["model"].(string)
+			}
+		}
+	}
+	if model != "" || hasUsage {
+		fields, cost, priced := h.recordUsage(resp.Request, model, matchedRouteIndices, reported)
+		if hasUsage {
+			usageFields = fields
+			if priced && h.cfg.Models.CostHeader != "" {
+				resp.Header.Set(h.cfg.Models.CostHeader, formatCost(cost))
+			}
+		}
+	}
+	if replySchema != nil && resp.StatusCode < http.StatusBadRequest && strings.Contains(contentType, "application/json") {
+		if err := checkStructuredReply(body, replySchema); err != nil {
+			logger.Info("Reply failed schema validation", "method", method, "path", path, "err", err)
+			body = replaceWithError(resp, &Rejection{
+				Status:  http.StatusBadGateway,
+				Type:    "invalid_response_error",
+				Code:    "schema_validation_failed",
+				Message: "backend reply does not match the requested schema: " + err.Error(),
+			})
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			resp.ContentLength = int64(len(body))
+		}
+	}
+
+	// Error replies are always logged; the rest are sampled
+	logOutbound := func(fields ...any) {
+		if session != "" {
+			fields = append(fields, "session", session)
+		}
+		fields = append(append(fields, usageFields...), timingsFromContext(resp.Request.Context()).finish(h.cfg.Listen, false)...)
+		if resp.StatusCode >= http.StatusBadRequest {
+			logger.Info("Outbound response", fields...)
+			return
+		}
+		logger.Sampled("Outbound response", fields...)
+	}
+
+	if len(matchedRoutes) == 0 && h.transformers.empty() {
+		logOutbound("method", method, "path", path, "status", resp.StatusCode, "changes", 0, "reason", "no_matching_rule", "content_type", contentType)
 		return nil
 	}
 
-	hasResponseOps := false
+	// Error bodies are not in the chat shape; they are normalized into the client's error
+	// shape instead of translated
+	if profile != nil && resp.StatusCode >= http.StatusBadRequest {
+		body = profile.TranslateError(resp.StatusCode, body)
+		resp.Header.Set("Content-Type", "application/json")
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		contentType = "application/json"
+		logger.Debug("Normalized error body", "format", profile.Name, "status", resp.StatusCode)
+		profile = nil
+	}
+
+	reasoning := newReasoningNormalizer(matchedRoutes)
+	restorePlaceholders := newPlaceholderRestorer(redactions)
+	moderation := moderationPolicy(matchedRoutes)
+	if resp.StatusCode >= http.StatusBadRequest {
+		moderation = nil
+	}
+	hasResponseOps := profile != nil || reasoning != nil || restorePlaceholders != nil || moderation != nil || !h.transformers.empty()
 	for _, r := range matchedRoutes {
 		if len(r.OnResponse) > 0 {
 			hasResponseOps = true
@@ -276,39 +989,75 @@ func ModifyResponse(resp *http.Response, routes []config.Route) error {
 		}
 	}
 	if !hasResponseOps {
-		logger.Info("Outbound response", "method", method, "path", path, "status", resp.StatusCode, "changes", 0, "reason", "no_on_response_operations", "matched_routes", matchedRouteIndices, "content_type", contentType)
+		logOutbound("method", method, "path", path, "status", resp.StatusCode, "changes", 0, "reason", "no_on_response_operations", "matched_routes", matchedRouteIndices, "content_type", contentType)
 		return nil
 	}
 
 	if !strings.Contains(contentType, "application/json") {
-		logger.Info("Outbound response", "method", method, "path", path, "status", resp.StatusCode, "changes", 0, "reason", "non_json", "matched_routes", matchedRouteIndices, "content_type", contentType)
+		logOutbound("method", method, "path", path, "status", resp.StatusCode, "changes", 0, "reason", "non_json", "matched_routes", matchedRouteIndices, "content_type", contentType)
 		return nil
 	}
 
-	var data map[string]any
-	if err := json.Unmarshal(body, &data); err != nil {
+	data, err := decodeBody(body)
+	if err != nil {
 		// If not JSON, return original body
 		resp.Body = io.NopCloser(bytes.NewReader(body))
 		return nil
 	}
 
-	// Extract response headers as map[string]string for matching
-	headers := make(map[string]string)
-	for key, values := range resp.Header {
-		if len(values) > 0 {
-			headers[key] = values[0]
+	anyModified := false
+	if profile != nil {
+		data = profile.Response(translate.NormalizeFinishReasons(data))
+		anyModified = true
+		logger.Debug("Translated response body", "format", profile.Name)
+	}
+	if reasoning != nil && reasoning.apply(data, false) {
+		anyModified = true
+	}
+	if restorePlaceholders != nil && restorePlaceholders(data) {
+		anyModified = true
+	}
+	if moderation != nil {
+		modified, rejection := moderateReply(resp.Request.Context(), moderation, data)
+		if rejection != nil {
+			blocked := replaceWithError(resp, rejection)
+			resp.Body = io.NopCloser(bytes.NewReader(blocked))
+			resp.ContentLength = int64(len(blocked))
+			logOutbound("method", method, "path", path, "status", resp.StatusCode, "reason", "moderation_blocked", "matched_routes", matchedRouteIndices)
+			return nil
+		}
+		if modified {
+			anyModified = true
 		}
 	}
 
+	// Extract response headers as map[string]string for matching
+	headers := headerValues(resp.Header)
+	defer releaseHeaderValues(headers)
+
 	query := extractQueryParams(resp.Request.URL)
 
-	anyModified := false
 	appliedValues := make(map[string]any)
+	responseState := &config.ActionState{Diffs: traced != nil, Status: resp.StatusCode, Request: request}
+	// Transformers that reject replace the reply with their error
+	rejectReply := func(rejection *Rejection) {
+		rejected := replaceWithError(resp, rejection)
+		resp.Body = io.NopCloser(bytes.NewReader(rejected))
+		resp.ContentLength = int64(len(rejected))
+		logOutbound("method", method, "path", path, "status", resp.StatusCode, "reason", "transform_rejected", "matched_routes", matchedRouteIndices)
+	}
+	if !h.transformers.empty() {
+		anyModified = true
+	}
+	if rejection := h.transformers.onResponse(BeforeRoutes, resp, data); rejection != nil {
+		rejectReply(rejection)
+		return nil
+	}
 	for i, route := range matchedRoutes {
 		if len(route.OnResponse) == 0 || route.Compiled == nil {
 			continue
 		}
-		modified, vals := config.ProcessResponse(data, headers, query, route.Compiled, matchedRouteIndices[i], method, path)
+		modified, vals := config.ProcessResponseWithState(data, headers, query, route.Compiled, matchedRouteIndices[i], method, path, responseState)
 		if modified {
 			anyModified = true
 		}
@@ -316,15 +1065,32 @@ func ModifyResponse(resp *http.Response, routes []config.Route) error {
 			appliedValues[k] = v
 		}
 	}
+	responseFired = responseState.Fired
+	if rejection := h.transformers.onResponse(AfterRoutes, resp, data); rejection != nil {
+		rejectReply(rejection)
+		return nil
+	}
+	// Non-streaming replies are transformed before headers go out, so the header covers both phases
+	if explained != nil && len(responseState.Fired) > 0 {
+		fired := append(slices.Clone(explained.fired), responseState.Fired...)
+		explain := explanation(explained.rules, explained.indices, fired)
+		resp.Header.Set(ExplainHeader, explain)
+		logger.Info("Explain", "method", method, "path", path, "explain", explain)
+	}
 
-	modifiedBody, err := json.Marshal(data)
-	if err != nil {
-		resp.Body = io.NopCloser(bytes.NewReader(body))
-		return fmt.Errorf("failed to marshal modified response JSON: %w", err)
+	modifiedBody := body
+	if anyModified {
+		var err error
+		if modifiedBody, err = encodeBody(data, body, h.cfg.PreserveKeyOrder); err != nil {
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return fmt.Errorf("failed to marshal modified response JSON: %w", err)
+		}
+		chargeMemory(resp.Request.Context(), len(modifiedBody))
 	}
 
 	resp.Body = io.NopCloser(bytes.NewReader(modifiedBody))
 	resp.ContentLength = int64(len(modifiedBody))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(modifiedBody)))
 
 	fields := []any{
 		"method", method,
@@ -335,11 +1101,10 @@ func ModifyResponse(resp *http.Response, routes []config.Route) error {
 	if len(matchedRouteIndices) > 0 {
 		fields = append(fields, "matched_routes", matchedRouteIndices)
 	}
-	logger.Info("Outbound response", fields...)
+	logOutbound(fields...)
 
 	if anyModified && logger.IsDebug() {
-		finalBody, _ := json.MarshalIndent(data, "  ", "  ")
-		logger.Debug("Outbound response body", "body", string(finalBody))
+		logger.Debug("Outbound response body", "body", bodyJSON(data, h.cfg.LogRedact))
 	}
 
 	return nil
@@ -348,6 +1113,37 @@ func ModifyResponse(resp *http.Response, routes []config.Route) error {
 // ModifyStreamingResponse processes Server-Sent Events (SSE) line-by-line
 // ModifyStreamingResponse rewrites streaming responses for matched routes, handling both SSE (`data:`) lines and raw JSON chunks.
 func ModifyStreamingResponse(resp *http.Response, routes []*config.Route, routeIndices []int) error {
+	return modifyStreamingResponse(resp, routes, routeIndices, streamOptions{})
+}
+
+// streamOptions carries proxy-level settings into modifyStreamingResponse
+type streamOptions struct {
+	redact       config.LogRedact // Body fields hidden from debug logs
+	transformers *transformers    // Go transforms run on each chunk; may be nil
+	keepKeyOrder bool             // Chunks keep the backend's key order
+	workers      *streamWorkers   // Bounds concurrent stream transforms; may be nil
+	session      string           // Conversation ID, logged when the stream ends
+
+	// onComplete runs once the stream completes, receiving the last usage reported by
+	// the backend (if any), the model named alongside it, and the stream's tallies
+	onComplete func(u Usage, model string, reported bool, summary *streamSummary)
+}
+
+// chunksModified reports whether any route action or transformer edits stream chunks
+func chunksModified(routes []*config.Route, ts *transformers) bool {
+	if ts != nil && !ts.empty() {
+		return true
+	}
+	for _, rule := range routes {
+		if rule != nil && len(rule.OnResponse) > 0 && rule.Compiled != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// modifyStreamingResponse is ModifyStreamingResponse with a proxy's settings
+func modifyStreamingResponse(resp *http.Response, routes []*config.Route, routeIndices []int, opts streamOptions) error {
 	method := resp.Request.Method
 	path := resp.Request.URL.Path
 
@@ -358,28 +1154,172 @@ func ModifyStreamingResponse(resp *http.Response, routes []*config.Route, routeI
 		}
 	}
 
-	pipeReader, pipeWriter := io.Pipe()
+	chargeMemory(resp.Request.Context(), streamMemory)
+
+	profile := profileFromContext(resp.Request.Context())
+	if profile != nil && resp.StatusCode >= http.StatusBadRequest {
+		profile = nil
+	}
+	if profile != nil {
+		resp.Header.Set("Content-Type", profile.StreamContentType())
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		logger.Debug("Translating streaming response", "format", profile.Name)
+	}
+
+	ctx := resp.Request.Context()
+	release, err := opts.workers.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	pipeReader, rawWriter := io.Pipe()
+	summary := &streamSummary{start: time.Now(), session: opts.session}
+	pipeWriter := &countingPipe{PipeWriter: rawWriter, summary: summary}
 	originalBody := resp.Body
 
 	resp.Body = pipeReader
 
+	// Close the upstream body as soon as the client goes away so the scanner
+	// unblocks and the backend stops generating tokens nobody will read.
+	stopWatching := context.AfterFunc(ctx, func() { originalBody.Close() })
+
 	go func() {
+		defer release()
 		defer pipeWriter.Close()
 		defer originalBody.Close()
+		defer stopWatching()
 
+		scanBuf := scanBufferPool.Get().(*[]byte)
+		defer scanBufferPool.Put(scanBuf)
 		scanner := bufio.NewScanner(originalBody)
-		scanner.Buffer(make([]byte, 64*1024), 1024*1024) // 64KB initial, 1MB max line size
-		logger.Info("Streaming response start", "method", method, "path", path)
+		scanner.Buffer(*scanBuf, 1024*1024) // 64KB initial, 1MB max line size
+		logger.Sampled("Streaming response start", "method", method, "path", path)
 		logger.Debug("Initialized streaming scanner", "max_line_size", "1MB")
 
-		headers := make(map[string]string)
-		for key, values := range resp.Header {
-			if len(values) > 0 {
-				headers[key] = values[0]
+		headers := headerValues(resp.Header)
+		defer releaseHeaderValues(headers)
+
+		query := extractQueryParams(resp.Request.URL)
+
+		// applyRules runs every matched route's on_response actions against one chunk
+		reasoning := newReasoningNormalizer(routes)
+		restorePlaceholders := newPlaceholderRestorer(redactionsFromContext(ctx))
+		moderator := newStreamModerator(ctx, routes)
+		request := requestDataFromContext(ctx)
+		applyRules := func(data map[string]any, lineNum int) {
+			if reasoning != nil && resp.StatusCode < http.StatusBadRequest {
+				reasoning.apply(data, true)
+			}
+			if restorePlaceholders != nil {
+				restorePlaceholders(data)
+			}
+			if moderator != nil && resp.StatusCode < http.StatusBadRequest {
+				moderator.apply(data)
+			}
+			if opts.transformers != nil {
+				opts.transformers.onStreamChunk(BeforeRoutes, resp, data)
+			}
+			modified := false
+			appliedValues := make(map[string]any)
+			for i, rule := range routes {
+				if rule == nil || len(rule.OnResponse) == 0 || rule.Compiled == nil {
+					continue
+				}
+				changed, vals := config.ProcessResponseWithState(data, headers, query, rule.Compiled, routeIndices[i], method, path, &config.ActionState{Status: resp.StatusCode, Request: request})
+				if changed {
+					modified = true
+					for k, v := range vals {
+						appliedValues[k] = v
+					}
+				}
+			}
+			if opts.transformers != nil {
+				opts.transformers.onStreamChunk(AfterRoutes, resp, data)
+			}
+
+			if modified {
+				summary.transforms++
+			}
+			if logger.IsDebug() && modified {
+				appliedJSON, _ := json.MarshalIndent(appliedValues, "", "  ")
+				logger.Debug("Applied streaming chunk transformation", "line", lineNum, "changes", string(appliedJSON))
 			}
 		}
 
-		query := extractQueryParams(resp.Request.URL)
+		// Translated streams are re-framed in the client's dialect, so upstream
+		// delimiters and [DONE] markers are replaced rather than passed through.
+		var stream translate.Stream
+		if profile != nil {
+			stream = profile.NewStream()
+		}
+		finished := false
+		writeTranslated := func(chunks []map[string]any, lineNum int) error {
+			for _, chunk := range chunks {
+				applyRules(chunk, lineNum)
+				chunkJSON, err := json.Marshal(chunk)
+				if err != nil {
+					logger.Error("Failed to marshal translated streaming chunk", "err", err)
+					continue
+				}
+				if profile.SSE {
+					frame := []byte("data: ")
+					if event, ok := chunk[profile.EventField].(string); ok && profile.EventField != "" {
+						frame = []byte("event: " + event + "\ndata: ")
+					}
+					chunkJSON = append(append(frame, chunkJSON...), '\n', '\n')
+				} else {
+					chunkJSON = append(chunkJSON, '\n')
+				}
+				if _, err := pipeWriter.Write(chunkJSON); err != nil {
+					return err
+				}
+				summary.chunks++
+			}
+			return nil
+		}
+		finishTranslated := func(lineNum int) error {
+			if finished {
+				return nil
+			}
+			finished = true
+			if err := writeTranslated(stream.Finish(), lineNum); err != nil {
+				return err
+			}
+			if profile.SSE && profile.DoneMarker != "" {
+				_, err := pipeWriter.Write([]byte("data: " + profile.DoneMarker + "\n\n"))
+				return err
+			}
+			return nil
+		}
+
+		// Backends report cumulative usage, so the last chunk that carries it wins; the
+		// finish reason is kept for the summary line
+		var usage Usage
+		var usageModel string
+		haveUsage := false
+		observe := func(data map[string]any) {
+			if u, ok := usageFromBody(data); ok {
+				usage, haveUsage = u, true
+				if m, ok := data["model"].(string); ok {
+					usageModel = m
+				}
+			}
+			summary.observeFinish(data)
+		}
+
+		// Each event goes out in one write, so the client sees it in one flush
+		out := getBuffer()
+		defer putBuffer(out)
+		writeLine := func(line string) error {
+			out.Reset()
+			out.WriteString(line)
+			out.WriteByte('\n')
+			_, err := pipeWriter.Write(out.Bytes())
+			return err
+		}
+		passthrough := stream == nil && !chunksModified(routes, opts.transformers) &&
+			reasoning == nil && restorePlaceholders == nil && moderator == nil
 
 		lineNum := 0
 		for scanner.Scan() {
@@ -387,7 +1327,7 @@ func ModifyStreamingResponse(resp *http.Response, routes []*config.Route, routeI
 			line := scanner.Text()
 
 			if logger.IsDebug() {
-				safeLine, truncated := sanitizeBody([]byte(line), 4096)
+				safeLine, truncated := sanitizeBody([]byte(line), 4096, opts.redact)
 				logger.Debug("Streaming event received", "line", lineNum, "body", safeLine, "truncated", truncated)
 			}
 
@@ -397,9 +1337,37 @@ func ModifyStreamingResponse(resp *http.Response, routes []*config.Route, routeI
 				logger.Debug("Streaming heartbeat", "line", lineNum)
 			}
 
+			if stream != nil {
+				if line == "" {
+					continue
+				}
+				jsonStr := strings.TrimPrefix(line, "data: ")
+				if jsonStr == "[DONE]" {
+					if err := finishTranslated(lineNum); err != nil {
+						return
+					}
+					continue
+				}
+				data, err := decodeBody([]byte(jsonStr))
+				if err != nil {
+					// Comments and keep-alives only make sense to SSE clients
+					if profile.SSE {
+						if err := writeLine(line); err != nil {
+							return
+						}
+					}
+					continue
+				}
+				observe(data)
+				if err := writeTranslated(stream.Chunk(translate.NormalizeFinishReasons(data)), lineNum); err != nil {
+					return
+				}
+				continue
+			}
+
 			// Empty lines are SSE delimiters - pass through
 			if line == "" {
-				if _, err := pipeWriter.Write([]byte("\n")); err != nil {
+				if err := writeLine(""); err != nil {
 					logger.Error("Failed to write empty streaming line", "err", err)
 					return
 				}
@@ -415,70 +1383,88 @@ func ModifyStreamingResponse(resp *http.Response, routes []*config.Route, routeI
 
 				// Handle [DONE] marker
 				if jsonStr == "[DONE]" {
-					if _, err := pipeWriter.Write([]byte(line + "\n")); err != nil {
+					if err := writeLine(line); err != nil {
 						logger.Error("Failed to write streaming [DONE] marker", "err", err)
 					}
 					continue
 				}
 
-				jsonData = []byte(jsonStr)
+				jsonData = scanner.Bytes()[len("data: "):]
 			} else {
-				jsonData = []byte(line)
-			}
-
-			var data map[string]any
-			if err := json.Unmarshal(jsonData, &data); err != nil {
-				if _, err := pipeWriter.Write([]byte(line + "\n")); err != nil {
-					logger.Error("Failed to write non-JSON streaming line", "err", err)
-				}
-				continue
+				jsonData = scanner.Bytes()
 			}
 
-			modified := false
-			appliedValues := make(map[string]any)
-			for i, rule := range routes {
-				if rule == nil || len(rule.OnResponse) == 0 || rule.Compiled == nil {
-					continue
-				}
-				changed, vals := config.ProcessResponse(data, headers, query, rule.Compiled, routeIndices[i], method, path)
-				if changed {
-					modified = true
-					for k, v := range vals {
-						appliedValues[k] = v
+			// Chunks no rule can change go out as received; only usage is read from them
+			if passthrough {
+				if mayReportUsage(jsonData) || mayReportFinish(jsonData) {
+					if data, err := decodeBody(jsonData); err == nil {
+						observe(data)
 					}
 				}
+				if err := writeLine(line); err != nil {
+					return
+				}
+				summary.chunks++
+				continue
 			}
 
-			if logger.IsDebug() && modified {
-				appliedJSON, _ := json.MarshalIndent(appliedValues, "", "  ")
-				logger.Debug("Applied streaming chunk transformation", "line", lineNum, "changes", string(appliedJSON))
-			}
-
-			modifiedJSON, err := json.Marshal(data)
+			data, err := decodeBody(jsonData)
 			if err != nil {
-				logger.Error("Failed to marshal modified streaming chunk", "err", err)
-				if _, err := pipeWriter.Write([]byte(line + "\n")); err != nil {
-					return
+				if err := writeLine(line); err != nil {
+					logger.Error("Failed to write non-JSON streaming line", "err", err)
 				}
+				summary.chunks++
 				continue
 			}
 
+			observe(data)
+			applyRules(data, lineNum)
+
+			out.Reset()
 			if isSSE {
-				if _, err := pipeWriter.Write([]byte("data: ")); err != nil {
+				out.WriteString("data: ")
+			}
+			if err := appendBody(out, data, jsonData, opts.keepKeyOrder); err != nil {
+				logger.Error("Failed to marshal modified streaming chunk", "err", err)
+				if err := writeLine(line); err != nil {
 					return
 				}
+				continue
 			}
-			if _, err := pipeWriter.Write(modifiedJSON); err != nil {
-				return
-			}
-			if _, err := pipeWriter.Write([]byte("\n")); err != nil {
+			out.WriteByte('\n')
+			if _, err := pipeWriter.Write(out.Bytes()); err != nil {
 				return
 			}
+			summary.chunks++
+		}
+
+		// ctx is the upstream call's, which a route timeout also cancels; that is the
+		// backend's failure, not the client's
+		if expired := timeoutCause(ctx, nil); expired != nil {
+			logger.Error("Streaming response timed out", append([]any{"method", method, "path", path, "lines", lineNum, "err", expired}, summary.fields(StreamUpstreamError)...)...)
+			pipeWriter.CloseWithError(expired)
+			return
+		}
+		if ctx.Err() != nil {
+			logger.Info("Streaming response aborted by client disconnect", append([]any{"method", method, "path", path, "lines", lineNum}, summary.fields(StreamClientDisconnect)...)...)
+			pipeWriter.CloseWithError(ctx.Err())
+			return
 		}
 
 		if err := scanner.Err(); err != nil {
-			logger.Error("Streaming scanner error", "err", err)
+			logger.Error("Streaming scanner error", append([]any{"method", method, "path", path, "err", err}, summary.fields(StreamUpstreamError)...)...)
 			pipeWriter.CloseWithError(err)
+			return
+		}
+
+		if stream != nil {
+			finishTranslated(lineNum)
+		}
+
+		if opts.onComplete != nil {
+			opts.onComplete(usage, usageModel, haveUsage, summary)
+		} else {
+			logger.Sampled("Streaming response complete", append([]any{"method", method, "path", path}, summary.fields(StreamComplete)...)...)
 		}
 	}()
 
@@ -6,6 +6,8 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"text/template"
 
@@ -87,3 +89,421 @@ func TestModifyResponseAppliesAllMatchedRules(t *testing.T) {
 		t.Fatalf("expected original field preserved, got %v", data["original"])
 	}
 }
+
+func TestSeedActionSetsResponseHeader(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:   newPatternField("POST"),
+		Paths:     newPatternField("^/v1/chat/completions$"),
+		OnRequest: []config.Action{{Seed: &config.SeedPolicy{Mode: config.SeedPerKey}}},
+	}})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	routes := cfg.Proxies[0].Routes
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", bytes.NewBufferString(`{"model":"m"}`))
+	req.Header.Set("Authorization", "Bearer sk-eval")
+	ModifyRequest(req, routes)
+
+	var sent map[string]any
+	json.NewDecoder(req.Body).Decode(&sent)
+	seed, ok := sent["seed"].(float64)
+	if !ok {
+		t.Fatalf("upstream body = %v, want seed injected", sent)
+	}
+
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(`{"choices":[]}`)),
+	}
+	if err := ModifyResponse(resp, routes); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	if got := resp.Header.Get(SeedHeader); got != strconv.Itoa(int(seed)) {
+		t.Fatalf("%s = %q, want %d", SeedHeader, got, int(seed))
+	}
+}
+
+func TestExplainHeaderListsRoutesAndChanges(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{
+		{
+			Name:       "chat-defaults",
+			Methods:    newPatternField("POST"),
+			Paths:      newPatternField("^/v1/chat/completions$"),
+			OnRequest:  []config.Action{{Merge: map[string]any{"temperature": 0.2}}},
+			OnResponse: []config.Action{{Merge: map[string]any{"served_by": "proxy"}}},
+		},
+		{
+			Methods:   newPatternField("POST"),
+			Paths:     newPatternField(".*"),
+			OnRequest: []config.Action{{Default: map[string]any{"model": "m"}}},
+		},
+	})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	routes := cfg.Proxies[0].Routes
+
+	send := func(explain bool) *http.Response {
+		req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", bytes.NewBufferString(`{"model":"m","temperature":1}`))
+		if explain {
+			req.Header.Set(ExplainHeader, "true")
+		}
+		ModifyRequest(req, routes)
+		if req.Header.Get(ExplainHeader) != "" {
+			t.Fatalf("%s forwarded upstream", ExplainHeader)
+		}
+		resp := &http.Response{
+			Request:    req,
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewBufferString(`{"choices":[]}`)),
+		}
+		if err := ModifyResponse(resp, routes); err != nil {
+			t.Fatalf("ModifyResponse: %v", err)
+		}
+		return resp
+	}
+
+	want := "routes=chat-defaults,1; request=chat-defaults[0]:temperature,1[0]:-; response=chat-defaults[0]:served_by"
+	if got := send(true).Header.Get(ExplainHeader); got != want {
+		t.Fatalf("%s = %q, want %q", ExplainHeader, got, want)
+	}
+	if got := send(false).Header.Get(ExplainHeader); got != "" {
+		t.Fatalf("%s = %q without asking", ExplainHeader, got)
+	}
+}
+
+// bodies no action changes reach the backend and client byte for byte
+func TestUntouchedBodiesPassThroughExactly(t *testing.T) {
+	rules := []config.Route{{
+		Methods: newPatternField("POST"),
+		Paths:   newPatternField("^/v1/chat$"),
+		Compiled: &config.CompiledRoute{
+			OnRequest:           []config.ActionExec{{Default: map[string]any{"temperature": 0.7}}},
+			OnRequestTemplates:  []*template.Template{nil},
+			OnResponse:          []config.ActionExec{{Default: map[string]any{"id": "x"}}},
+			OnResponseTemplates: []*template.Template{nil},
+		},
+	}}
+	rules[0].OnRequest = []config.Action{{Default: map[string]any{"temperature": 0.7}}}
+	rules[0].OnResponse = []config.Action{{Default: map[string]any{"id": "x"}}}
+
+	const reqBody = `{"temperature": 1.0, "model":"m", "prompt":"café <b>"}`
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat", bytes.NewBufferString(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	ModifyRequest(req, rules)
+
+	sent, _ := io.ReadAll(req.Body)
+	if string(sent) != reqBody {
+		t.Fatalf("request body = %s, want it unchanged", sent)
+	}
+	if req.ContentLength != int64(len(reqBody)) {
+		t.Fatalf("ContentLength = %d, want %d", req.ContentLength, len(reqBody))
+	}
+
+	const respBody = `{"id": "r1", "score": 1e3}`
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(respBody)),
+	}
+	if err := ModifyResponse(resp, rules); err != nil {
+		t.Fatalf("ModifyResponse error: %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	if string(got) != respBody {
+		t.Fatalf("response body = %s, want it unchanged", got)
+	}
+}
+
+// readCounter records whether a request body was read
+type readCounter struct {
+	io.Reader
+	reads int
+}
+
+func (r *readCounter) Read(p []byte) (int, error) {
+	r.reads++
+	return r.Reader.Read(p)
+}
+
+func TestModifyRequestLeavesBodyUnreadWhenNoRouteNeedsIt(t *testing.T) {
+	const reqBody = `{"model":"m","prompt":"hi"}`
+	tests := []struct {
+		name     string
+		route    config.Route
+		wantRead bool
+	}{
+		{"response actions only", config.Route{OnResponse: []config.Action{{Merge: map[string]any{"id": "x"}}}}, false},
+		{"reasoning", config.Route{Reasoning: &config.ReasoningPolicy{Mode: "strip"}}, false},
+		{"request actions", config.Route{OnRequest: []config.Action{{Merge: map[string]any{"top_p": 0.9}}}}, true},
+		{"format", config.Route{Format: "openai-to-ollama"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := tt.route
+			route.Methods = newPatternField("POST")
+			route.Paths = newPatternField("^/v1/chat$")
+			cfg := newTestConfig("http://localhost:9000", []config.Route{route})
+			if err := config.Validate(cfg); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			if err := config.CompileTemplates(cfg); err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			h := NewHandler(cfg.Proxies[0])
+
+			body := &readCounter{Reader: strings.NewReader(reqBody)}
+			req := httptest.NewRequest("POST", "http://example.com/v1/chat", body)
+			req.ContentLength = int64(len(reqBody))
+			h.ModifyRequest(req)
+
+			if got := body.reads > 0; got != tt.wantRead {
+				t.Fatalf("body read = %v, want %v", got, tt.wantRead)
+			}
+			if !tt.wantRead {
+				if req.ContentLength != int64(len(reqBody)) {
+					t.Fatalf("ContentLength = %d, want %d", req.ContentLength, len(reqBody))
+				}
+				sent, _ := io.ReadAll(req.Body)
+				if string(sent) != reqBody {
+					t.Fatalf("body = %s, want it unchanged", sent)
+				}
+			}
+		})
+	}
+}
+
+func TestModifyRequestRejectsOversizedUnreadBody(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:    newPatternField("POST"),
+		Paths:      newPatternField(".*"),
+		TargetPath: "/completion",
+	}})
+	cfg.Proxies[0].MaxRequestBytes = 16
+	h := NewHandler(cfg.Proxies[0])
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat", strings.NewReader(strings.Repeat("x", 100)))
+	h.ModifyRequest(req)
+
+	if rej := rejectionFromRequest(req); rej == nil || rej.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("rejection = %+v, want 413", rej)
+	}
+
+	// Without a declared length the cap applies as the body streams
+	req = httptest.NewRequest("POST", "http://example.com/v1/chat", strings.NewReader(strings.Repeat("x", 100)))
+	req.ContentLength = -1
+	h.ModifyRequest(req)
+	if _, err := io.ReadAll(req.Body); err == nil {
+		t.Fatal("reading an over-limit body succeeded, want an error")
+	}
+}
+
+func TestModifyRequestStreamsBodyOverBufferThreshold(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:   newPatternField("POST"),
+		Paths:     newPatternField(".*"),
+		OnRequest: []config.Action{{Merge: map[string]any{"top_p": 0.9}}},
+	}})
+	cfg.Proxies[0].BufferThreshold = 64
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+
+	large := `{"model":"m","prompt":"` + strings.Repeat("x", 100) + `"}`
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantModified  bool
+	}{
+		{"small", `{"model":"m"}`, 13, true},
+		{"large", large, int64(len(large)), false},
+		{"large chunked", large, -1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://example.com/v1/chat", strings.NewReader(tt.body))
+			req.ContentLength = tt.contentLength
+			h.ModifyRequest(req)
+
+			if rej := rejectionFromRequest(req); rej != nil {
+				t.Fatalf("rejection = %+v, want none", rej)
+			}
+			sent, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("read body: %v", err)
+			}
+			if got := strings.Contains(string(sent), "top_p"); got != tt.wantModified {
+				t.Fatalf("body = %s, modified = %v, want %v", sent, got, tt.wantModified)
+			}
+			if !tt.wantModified && string(sent) != tt.body {
+				t.Fatalf("body = %s, want it unchanged", sent)
+			}
+		})
+	}
+}
+
+func TestModifyRequestRendersTargetPathTemplate(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:    newPatternField("POST"),
+		Paths:      newPatternField(`^/models/(?P<family>[a-z]+)/generate$`),
+		TargetPath: `/api/{{ .captures.family }}/{{ if .query.raw }}raw{{ else }}{{ .body.model }}{{ end }}`,
+		OnRequest:  []config.Action{{Default: map[string]any{"stream": false}}},
+	}})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+
+	tests := []struct {
+		url, body string
+		want      string // Empty when the request should be rejected
+	}{
+		{"http://example.com/models/qwen/generate", `{"model":"qwen3"}`, "/api/qwen/qwen3"},
+		{"http://example.com/models/qwen/generate?raw=1", `{}`, "/api/qwen/raw"},
+		{"http://example.com/models/qwen/generate", `{"prompt":"no model"}`, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.url, strings.NewReader(tt.body))
+		h.ModifyRequest(req)
+		rej := rejectionFromRequest(req)
+		if tt.want == "" {
+			if rej == nil || rej.Code != "target_path_unresolved" {
+				t.Errorf("%s %s: rejection = %+v, want target_path_unresolved", tt.url, tt.body, rej)
+			}
+			continue
+		}
+		if rej != nil || req.URL.Path != tt.want {
+			t.Errorf("%s %s: path = %q, rejection = %+v, want %q", tt.url, tt.body, req.URL.Path, rej, tt.want)
+		}
+	}
+}
+
+func TestModifyRequestMatchesNormalizedPaths(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:   newPatternField("POST"),
+		Paths:     newPatternField(`^/v1/chat/completions$`),
+		OnRequest: []config.Action{{Merge: map[string]any{"matched": true}}},
+	}})
+	cfg.Proxies[0].NormalizePaths = &config.PathNormalization{CollapseSlashes: true, TrailingSlash: config.TrailingSlashStrip}
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+
+	req := httptest.NewRequest("POST", "http://example.com//v1/chat//completions/", strings.NewReader(`{"model":"qwen3"}`))
+	h.ModifyRequest(req)
+	body, _ := io.ReadAll(req.Body)
+	if !strings.Contains(string(body), `"matched":true`) {
+		t.Errorf("body = %s, want the route to match the normalized path", body)
+	}
+	if req.URL.Path != "//v1/chat//completions/" {
+		t.Errorf("path = %q, want the original path forwarded", req.URL.Path)
+	}
+}
+
+func TestModifyRequestMatchesContentTypes(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:      newPatternField("POST"),
+		Paths:        newPatternField(`^/v1/files$`),
+		ContentTypes: newPatternField(`^application/json$`),
+		OnRequest:    []config.Action{{Merge: map[string]any{"matched": true}}},
+	}})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+
+	for _, tt := range []struct {
+		contentType string
+		want        int
+	}{
+		{"application/json", 1},
+		{"multipart/form-data; boundary=x", 0},
+	} {
+		header := http.Header{"Content-Type": {tt.contentType}}
+		if _, indices := h.matchRoutes("POST", "/v1/files", header); len(indices) != tt.want {
+			t.Errorf("%s: matched %v, want %d routes", tt.contentType, indices, tt.want)
+		}
+		req := httptest.NewRequest("POST", "/v1/files", nil)
+		req.Header = header
+		if _, indices := MatchRoutes(req, cfg.Proxies[0].Routes); len(indices) != tt.want {
+			t.Errorf("%s: MatchRoutes matched %v, want %d routes", tt.contentType, indices, tt.want)
+		}
+	}
+}
+
+func TestResponseActionsSeeTheClientRequest(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:   newPatternField("POST"),
+		Paths:     newPatternField("^/v1/chat/completions$"),
+		OnRequest: []config.Action{{Merge: map[string]any{"model": "backend-model"}}},
+		OnResponse: []config.Action{{
+			When: &config.BoolExpr{
+				Not:     &config.BoolExpr{Body: map[string]config.PatternField{"model": newPatternField(".")}},
+				Request: &config.BoolExpr{Headers: map[string]config.PatternField{"X-Team": newPatternField("^research$")}},
+			},
+			FromRequest: map[string]string{"model": "body.model", "meta.team": "headers.x-team"},
+		}},
+	}})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	handler := NewHandler(cfg.Proxies[0])
+
+	reply := func(team string) map[string]any {
+		req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(`{"model":"client-model"}`))
+		req.Header.Set("X-Team", team)
+		handler.ModifyRequest(req)
+		resp := &http.Response{
+			Request:    req,
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"choices":[]}`)),
+		}
+		if err := handler.ModifyResponse(resp); err != nil {
+			t.Fatalf("ModifyResponse: %v", err)
+		}
+		var data map[string]any
+		body, _ := io.ReadAll(resp.Body)
+		if err := json.Unmarshal(body, &data); err != nil {
+			t.Fatalf("unmarshal %s: %v", body, err)
+		}
+		return data
+	}
+
+	data := reply("research")
+	if data["model"] != "client-model" {
+		t.Fatalf("model = %v, want the model the client sent", data["model"])
+	}
+	if meta, _ := data["meta"].(map[string]any); meta["team"] != "research" {
+		t.Fatalf("meta = %v, want the request header copied", data["meta"])
+	}
+	if data := reply("ops"); data["model"] != nil {
+		t.Fatalf("reply = %v, want the request when to not match", data)
+	}
+}
@@ -31,6 +31,30 @@ func newTestConfig(target string, rules []config.Route) *config.Config {
 	}
 }
 
+// newRouteHandler builds a handler for a proxy with a single route, validated and compiled as
+// config loading would. A route without methods or paths matches chat completions; setup, when
+// given, adjusts the proxy before validation.
+func newRouteHandler(t *testing.T, route config.Route, setup func(*config.ProxyConfig)) *Handler {
+	t.Helper()
+	if len(route.Methods.Patterns) == 0 {
+		route.Methods = newPatternField("POST")
+	}
+	if len(route.Paths.Patterns) == 0 {
+		route.Paths = newPatternField("^/v1/chat/completions$")
+	}
+	cfg := newTestConfig("http://localhost:9000", []config.Route{route})
+	if setup != nil {
+		setup(&cfg.Proxies[0])
+	}
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	return NewHandler(cfg.Proxies[0])
+}
+
 func newTestServer(handler func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, func()) {
 	srv := httptest.NewServer(http.HandlerFunc(handler))
 	return srv, srv.Close
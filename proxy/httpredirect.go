@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// ACMEChallengePath prefixes the tokens an ACME CA fetches over plain HTTP (HTTP-01)
+const ACMEChallengePath = "/.well-known/acme-challenge/"
+
+// acmeToken matches challenge tokens, which are base64url, so they can't name other files
+var acmeToken = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// HTTPRedirect answers a plain-HTTP listener for a TLS proxy (see redirect_http): ACME
+// challenges are served from the acmeDir webroot, when set, and everything else gets a 301
+// to the same URL on httpsPort
+func HTTPRedirect(httpsPort int, acmeDir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if token, ok := strings.CutPrefix(req.URL.Path, ACMEChallengePath); ok && acmeDir != "" {
+			serveACMEChallenge(w, req, acmeDir, token)
+			return
+		}
+
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if httpsPort != 443 {
+			host += ":" + strconv.Itoa(httpsPort)
+		}
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+func serveACMEChallenge(w http.ResponseWriter, req *http.Request, dir, token string) {
+	if !acmeToken.MatchString(token) {
+		http.NotFound(w, req)
+		return
+	}
+	// dir is the webroot given to the ACME client, which writes challenges beneath it
+	content, err := os.ReadFile(filepath.Join(dir, ".well-known", "acme-challenge", token))
+	if err != nil {
+		logger.Info("ACME challenge not found", "token", token, "err", err)
+		http.NotFound(w, req)
+		return
+	}
+	logger.Info("Served ACME challenge", "token", token)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(content)
+}
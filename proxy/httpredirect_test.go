@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTTPRedirect(t *testing.T) {
+	// The webroot layout certbot --webroot and lego --http.webroot write
+	dir := t.TempDir()
+	challenges := filepath.Join(dir, ".well-known", "acme-challenge")
+	if err := os.MkdirAll(challenges, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(challenges, "tok-EN_1"), []byte("tok-EN_1.thumbprint"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		port       int
+		target     string
+		wantStatus int
+		want       string // Location, or the body for challenges
+	}{
+		{"redirect to the TLS port", 8443, "http://api.internal:8080/v1/models?x=1", http.StatusMovedPermanently, "https://api.internal:8443/v1/models?x=1"},
+		{"default port omitted", 443, "http://api.internal/v1/chat/completions", http.StatusMovedPermanently, "https://api.internal/v1/chat/completions"},
+		{"IPv6 host", 8443, "http://[::1]:80/", http.StatusMovedPermanently, "https://[::1]:8443/"},
+		{"challenge served", 443, "http://api.internal/.well-known/acme-challenge/tok-EN_1", http.StatusOK, "tok-EN_1.thumbprint"},
+		{"unknown challenge", 443, "http://api.internal/.well-known/acme-challenge/missing", http.StatusNotFound, ""},
+		{"token outside the directory", 443, "http://api.internal/.well-known/acme-challenge/..%2Fsecret", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			HTTPRedirect(tt.port, dir).ServeHTTP(rec, httptest.NewRequest("GET", tt.target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			switch tt.wantStatus {
+			case http.StatusMovedPermanently:
+				if got := rec.Header().Get("Location"); got != tt.want {
+					t.Errorf("Location = %q, want %q", got, tt.want)
+				}
+			case http.StatusOK:
+				if got := rec.Body.String(); got != tt.want {
+					t.Errorf("body = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
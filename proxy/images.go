@@ -0,0 +1,330 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // Register decoders for inline images
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// imageRef is one image in a chat request: a data URL, a remote URL, or Ollama's bare base64
+type imageRef struct {
+	value string
+	bare  bool
+	set   func(string)
+	drop  func()
+}
+
+func (r *imageRef) replace(value string) {
+	r.value = value
+	r.set(value)
+}
+
+// payload returns the base64 data of an inline image, or false for remote URLs
+func (r *imageRef) payload() (string, bool) {
+	if r.bare {
+		return r.value, true
+	}
+	if !strings.HasPrefix(r.value, "data:") {
+		return "", false
+	}
+	_, data, ok := strings.Cut(r.value, ";base64,")
+	return data, ok
+}
+
+// limitImages applies the first matched image policy to a JSON request
+func (h *Handler) limitImages(e *requestEdit) {
+	if !e.json || e.form != nil || e.route.rejection != nil {
+		return
+	}
+	rule := e.firstRoute(func(r *config.Route) bool { return r.Images != nil })
+	if rule == nil {
+		return
+	}
+	modified, rejection := enforceImagePolicy(e.data, h.cfg.Models, rule.Images)
+	e.modified = e.modified || modified
+	e.route.rejection = rejection
+}
+
+// enforceImagePolicy downscales, strips, or rejects image inputs. It reports whether data
+// was modified, and returns a rejection when the request should not reach the backend.
+func enforceImagePolicy(data map[string]any, models config.ModelsConfig, policy *config.ImagePolicy) (bool, *Rejection) {
+	refs := collectImages(data)
+	if len(refs) == 0 {
+		return false, nil
+	}
+	model, _ := data["model"].(string)
+	reject := policy.Overflow == config.OverflowReject
+
+	if !models.AcceptsImages(model) {
+		if reject {
+			logger.Info("Rejected images for non-vision model", "model", model, "images", len(refs))
+			return false, imageRejection("images_not_supported", fmt.Sprintf("model '%s' does not accept images", model))
+		}
+		for _, ref := range refs {
+			ref.drop()
+		}
+		compactImages(data)
+		logger.Info("Stripped images for non-vision model", "model", model, "images", len(refs))
+		return true, nil
+	}
+
+	modified := false
+	var kept []*imageRef
+	for i, ref := range refs {
+		if policy.MaxDimension > 0 {
+			scaled, ok, err := downscaleImage(ref, policy.MaxDimension)
+			if err != nil {
+				if reject {
+					logger.Info("Rejected image too large to decode", "model", model, "image", i+1, "err", err)
+					return false, imageRejection("image_too_large", fmt.Sprintf("image %d: %v", i+1, err))
+				}
+				ref.drop()
+				modified = true
+				logger.Info("Stripped image too large to decode", "model", model, "image", i+1, "err", err)
+				continue
+			}
+			if ok {
+				ref.replace(scaled)
+				modified = true
+			}
+		}
+		if policy.MaxBytes > 0 {
+			if encoded, ok := ref.payload(); ok && base64.StdEncoding.DecodedLen(len(strings.TrimRight(encoded, "="))) > policy.MaxBytes {
+				if reject {
+					logger.Info("Rejected oversized image", "model", model, "image", i+1)
+					return false, imageRejection("image_too_large", fmt.Sprintf("image %d exceeds the %d-byte limit", i+1, policy.MaxBytes))
+				}
+				ref.drop()
+				modified = true
+				logger.Info("Stripped oversized image", "model", model, "image", i+1)
+				continue
+			}
+		}
+		kept = append(kept, ref)
+	}
+
+	if policy.MaxCount > 0 && len(kept) > policy.MaxCount {
+		if reject {
+			logger.Info("Rejected request with too many images", "model", model, "images", len(kept))
+			return false, imageRejection("too_many_images", fmt.Sprintf("request has %d images; at most %d are accepted", len(kept), policy.MaxCount))
+		}
+		// Later turns matter most to the reply, so the oldest images go first
+		for _, ref := range kept[:len(kept)-policy.MaxCount] {
+			ref.drop()
+		}
+		modified = true
+		logger.Info("Stripped images over the count limit", "model", model, "dropped", len(kept)-policy.MaxCount)
+	}
+
+	if modified {
+		compactImages(data)
+	}
+	return modified, nil
+}
+
+func imageRejection(code, message string) *Rejection {
+	return &Rejection{Status: http.StatusBadRequest, Type: "invalid_request_error", Code: code, Message: message}
+}
+
+// collectImages finds images in OpenAI content parts and Ollama images arrays, in prompt order
+func collectImages(data map[string]any) []*imageRef {
+	var refs []*imageRef
+	for _, m := range asSlice(data["messages"]) {
+		msg, ok := m.(map[string]any)
+		if !ok {
+			continue
+		}
+		if parts, ok := msg["content"].([]any); ok {
+			for i, p := range parts {
+				part, ok := p.(map[string]any)
+				if !ok || part["type"] != "image_url" {
+					continue
+				}
+				refs = append(refs, contentPartImage(parts, i, part))
+			}
+		}
+		refs = append(refs, bareImages(msg)...)
+	}
+	// Ollama /api/generate
+	return append(refs, bareImages(data)...)
+}
+
+func contentPartImage(parts []any, i int, part map[string]any) *imageRef {
+	ref := &imageRef{drop: func() { parts[i] = nil }}
+	switch v := part["image_url"].(type) {
+	case map[string]any:
+		ref.value, _ = v["url"].(string)
+		ref.set = func(s string) { v["url"] = s }
+	case string:
+		ref.value = v
+		ref.set = func(s string) { part["image_url"] = s }
+	default:
+		ref.set = func(string) {}
+	}
+	return ref
+}
+
+func bareImages(container map[string]any) []*imageRef {
+	images, _ := container["images"].([]any)
+	var refs []*imageRef
+	for i, img := range images {
+		value, ok := img.(string)
+		if !ok {
+			continue
+		}
+		refs = append(refs, &imageRef{
+			value: value,
+			bare:  true,
+			set:   func(s string) { images[i] = s },
+			drop:  func() { images[i] = nil },
+		})
+	}
+	return refs
+}
+
+// compactImages removes the slots left by dropped images
+func compactImages(data map[string]any) {
+	for _, m := range asSlice(data["messages"]) {
+		msg, ok := m.(map[string]any)
+		if !ok {
+			continue
+		}
+		if parts, ok := msg["content"].([]any); ok {
+			parts = withoutNil(parts)
+			if len(parts) == 0 {
+				msg["content"] = ""
+			} else {
+				msg["content"] = parts
+			}
+		}
+		compactBareImages(msg)
+	}
+	compactBareImages(data)
+}
+
+func compactBareImages(container map[string]any) {
+	images, ok := container["images"].([]any)
+	if !ok {
+		return
+	}
+	if images = withoutNil(images); len(images) == 0 {
+		delete(container, "images")
+	} else {
+		container["images"] = images
+	}
+}
+
+func withoutNil(values []any) []any {
+	out := values[:0]
+	for _, v := range values {
+		if v != nil {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+func asMap(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+// maxImagePixels caps the images downscaleImage decodes. A small file can declare huge
+// dimensions, and decoding it would take 4 bytes per pixel (128MB at this size).
+const maxImagePixels = 32 << 20
+
+// downscaleImage shrinks an inline image whose longest side exceeds maxSide, returning the
+// re-encoded value in the same form (data URL or bare base64). JPEGs stay JPEG; everything
+// else decodable becomes PNG. Undecodable formats (ex: WebP) are left alone. Images over
+// maxImagePixels are not decoded; the error says so.
+func downscaleImage(ref *imageRef, maxSide int) (string, bool, error) {
+	encoded, ok := ref.payload()
+	if !ok {
+		return "", false, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false, nil
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil || max(cfg.Width, cfg.Height) <= maxSide {
+		return "", false, nil
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return "", false, fmt.Errorf("%dx%d exceeds the %d-pixel decode limit", cfg.Width, cfg.Height, maxImagePixels)
+	}
+	src, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return "", false, nil
+	}
+
+	scaled := resizeImage(src, maxSide)
+	var buf bytes.Buffer
+	mediaType := "image/png"
+	if format == "jpeg" {
+		mediaType = "image/jpeg"
+		err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, scaled)
+	}
+	if err != nil {
+		return "", false, nil
+	}
+
+	logger.Debug("Downscaled image", "from", fmt.Sprintf("%dx%d", cfg.Width, cfg.Height), "to", fmt.Sprintf("%dx%d", scaled.Bounds().Dx(), scaled.Bounds().Dy()), "bytes", buf.Len())
+	out := base64.StdEncoding.EncodeToString(buf.Bytes())
+	if ref.bare {
+		return out, true, nil
+	}
+	return "data:" + mediaType + ";base64," + out, true, nil
+}
+
+// resizeImage box-filters src so its longest side is maxSide. Source rows are converted
+// one output row's band at a time, so only the scaled image is held at full size.
+func resizeImage(src image.Image, maxSide int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	scale := float64(maxSide) / float64(max(w, h))
+	dw, dh := max(1, int(float64(w)*scale+0.5)), max(1, int(float64(h)*scale+0.5))
+
+	band := image.NewRGBA(image.Rect(0, 0, w, (h+dh-1)/dh+1))
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		rows := band.SubImage(image.Rect(0, 0, w, y1-y0)).(*image.RGBA)
+		draw.Draw(rows, rows.Bounds(), src, image.Pt(b.Min.X, b.Min.Y+y0), draw.Src)
+		for x := range dw {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := rows.Pix[(sy-y0)*rows.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := range 4 {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			off := y*dst.Stride + x*4
+			for c := range 4 {
+				dst.Pix[off+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,241 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func pngDataURL(t *testing.T, w, h int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// pngHeaderDataURL is a PNG that declares w x h pixels but holds no image data, the shape
+// of a decompression bomb
+func pngHeaderDataURL(w, h int) string {
+	ihdr := binary.BigEndian.AppendUint32([]byte("IHDR"), uint32(w))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(h))
+	ihdr = append(ihdr, 8, 6, 0, 0, 0) // 8-bit RGBA
+	file := binary.BigEndian.AppendUint32([]byte("\x89PNG\r\n\x1a\n"), uint32(len(ihdr)-4))
+	file = binary.BigEndian.AppendUint32(append(file, ihdr...), crc32.ChecksumIEEE(ihdr))
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(file)
+}
+
+func visionBody(urls ...string) string {
+	parts := []any{map[string]any{"type": "text", "text": "describe"}}
+	for _, url := range urls {
+		parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]any{"url": url}})
+	}
+	encoded, _ := json.Marshal(map[string]any{
+		"model":    "llava",
+		"messages": []any{map[string]any{"role": "user", "content": parts}},
+	})
+	return string(encoded)
+}
+
+func visionModels(patterns ...string) func(*config.ProxyConfig) {
+	return func(p *config.ProxyConfig) {
+		p.Models.Vision = newPatternField(patterns...)
+	}
+}
+
+func imageParts(t *testing.T, req *http.Request) []any {
+	t.Helper()
+	body, _ := io.ReadAll(req.Body)
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	content := data["messages"].([]any)[0].(map[string]any)["content"]
+	parts, _ := content.([]any)
+	return parts
+}
+
+func TestModifyRequestStripsImagesForTextModels(t *testing.T) {
+	h := newRouteHandler(t, config.Route{Images: &config.ImagePolicy{}}, visionModels("^llava$", "^qwen.*vl"))
+	body := strings.Replace(visionBody("https://example.com/cat.png"), "llava", "llama3", 1)
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(body))
+	h.ModifyRequest(req)
+
+	parts := imageParts(t, req)
+	if len(parts) != 1 || parts[0].(map[string]any)["type"] != "text" {
+		t.Fatalf("parts = %v, want only the text part", parts)
+	}
+}
+
+func TestModifyRequestRejectsImageLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy config.ImagePolicy
+		vision string
+		body   string
+		code   string
+	}{
+		{"non-vision model", config.ImagePolicy{}, "^qwen", visionBody("https://example.com/a.png"), "images_not_supported"},
+		{"too large", config.ImagePolicy{MaxBytes: 16}, "", visionBody(pngDataURL(t, 8, 8)), "image_too_large"},
+		{"too many", config.ImagePolicy{MaxCount: 1}, "", visionBody("https://example.com/a.png", "https://example.com/b.png"), "too_many_images"},
+		{"too many pixels", config.ImagePolicy{MaxDimension: 32}, "", visionBody(pngHeaderDataURL(50000, 50000)), "image_too_large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.policy.Overflow = config.OverflowReject
+			var vision []string
+			if tt.vision != "" {
+				vision = []string{tt.vision}
+			}
+			h := newRouteHandler(t, config.Route{Images: &tt.policy}, visionModels(vision...))
+
+			req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(tt.body))
+			h.ModifyRequest(req)
+
+			rej := rejectionFromRequest(req)
+			if rej == nil || rej.Code != tt.code || rej.Status != http.StatusBadRequest {
+				t.Fatalf("rejection = %+v, want 400 %s", rej, tt.code)
+			}
+		})
+	}
+}
+
+func TestModifyRequestStripsOldestImagesOverCount(t *testing.T) {
+	h := newRouteHandler(t, config.Route{Images: &config.ImagePolicy{MaxCount: 1}}, nil)
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		strings.NewReader(visionBody("https://example.com/a.png", "https://example.com/b.png")))
+	h.ModifyRequest(req)
+
+	parts := imageParts(t, req)
+	if len(parts) != 2 {
+		t.Fatalf("parts = %v, want text and one image", parts)
+	}
+	if url := parts[1].(map[string]any)["image_url"].(map[string]any)["url"]; url != "https://example.com/b.png" {
+		t.Fatalf("kept %v, want the latest image", url)
+	}
+}
+
+func TestModifyRequestDownscalesImages(t *testing.T) {
+	h := newRouteHandler(t, config.Route{Images: &config.ImagePolicy{MaxDimension: 32}}, nil)
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(visionBody(pngDataURL(t, 128, 64))))
+	h.ModifyRequest(req)
+
+	parts := imageParts(t, req)
+	url := parts[1].(map[string]any)["image_url"].(map[string]any)["url"].(string)
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(url, "data:image/png;base64,"))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("decode config: %v", err)
+	}
+	if cfg.Width != 32 || cfg.Height != 16 {
+		t.Fatalf("size = %dx%d, want 32x16", cfg.Width, cfg.Height)
+	}
+}
+
+func TestEnforceImagePolicyOllamaImages(t *testing.T) {
+	data := map[string]any{
+		"model": "llama3",
+		"messages": []any{map[string]any{
+			"role":    "user",
+			"content": "what is this?",
+			"images":  []any{"aGVsbG8="},
+		}},
+	}
+	models := config.ModelsConfig{Vision: newPatternField("^llava")}
+
+	modified, rej := enforceImagePolicy(data, models, &config.ImagePolicy{Overflow: config.OverflowStrip})
+	if !modified || rej != nil {
+		t.Fatalf("modified = %v, rejection = %+v", modified, rej)
+	}
+	if _, ok := data["messages"].([]any)[0].(map[string]any)["images"]; ok {
+		t.Fatal("images should be removed for a text-only model")
+	}
+}
+
+func TestModifyRequestRejectsOversizedBody(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:   newPatternField("POST"),
+		Paths:     newPatternField(".*"),
+		OnRequest: []config.Action{{Merge: map[string]any{"temperature": 0.5}}},
+	}})
+	cfg.Proxies[0].MaxRequestBytes = 64
+	h := NewHandler(cfg.Proxies[0])
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(chatBody(strings.Repeat("x", 100))))
+	h.ModifyRequest(req)
+
+	rej := rejectionFromRequest(req)
+	if rej == nil || rej.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("rejection = %+v, want 413", rej)
+	}
+}
+
+func TestSanitizeBodyElidesImageData(t *testing.T) {
+	body := visionBody("data:image/png;base64," + strings.Repeat("A", 10000))
+
+	safe, truncated := sanitizeBody([]byte(body), 4096, config.LogRedact{})
+	if truncated {
+		t.Fatal("elided body should fit the log limit")
+	}
+	if !strings.Contains(safe, "data:image/png;base64,[10000 base64 chars]") {
+		t.Fatalf("image data not elided: %s", safe)
+	}
+}
+
+func TestModifyRequestStripsImagesTooLargeToDecode(t *testing.T) {
+	h := newRouteHandler(t, config.Route{Images: &config.ImagePolicy{MaxDimension: 32}}, nil)
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		strings.NewReader(visionBody(pngHeaderDataURL(50000, 50000), "https://example.com/b.png")))
+	h.ModifyRequest(req)
+
+	parts := imageParts(t, req)
+	if len(parts) != 2 {
+		t.Fatalf("parts = %v, want text and the remote image", parts)
+	}
+	if url := parts[1].(map[string]any)["image_url"].(map[string]any)["url"]; url != "https://example.com/b.png" {
+		t.Fatalf("kept %v, want the declared 50000x50000 image dropped", url)
+	}
+}
+
+func TestResizeImageAveragesBands(t *testing.T) {
+	// Offset bounds and a non-RGBA source exercise the per-band conversion
+	src := image.NewNRGBA(image.Rect(10, 20, 14, 22))
+	for x := 10; x < 14; x++ {
+		for y := 20; y < 22; y++ {
+			c := color.NRGBA{A: 255}
+			if x < 12 {
+				c.R = 200
+			} else {
+				c.B = 100
+			}
+			src.SetNRGBA(x, y, c)
+		}
+	}
+	got := resizeImage(src, 2)
+	if b := got.Bounds(); b.Dx() != 2 || b.Dy() != 1 {
+		t.Fatalf("size = %v, want 2x1", b)
+	}
+	if left, right := got.RGBAAt(0, 0), got.RGBAAt(1, 0); left != (color.RGBA{R: 200, A: 255}) || right != (color.RGBA{B: 100, A: 255}) {
+		t.Fatalf("pixels = %v, %v, want the average of each half", left, right)
+	}
+}
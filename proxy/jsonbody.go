@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxExactInt is the largest integer a float64 holds exactly
+const maxExactInt = 1 << 53
+
+// decodeBody parses a JSON object body. Numbers become float64 like json.Unmarshal, except
+// integers too large for one (ex: 64-bit seeds, token IDs), which stay json.Number so
+// they are sent on unchanged.
+func decodeBody(body []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var data map[string]any
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+	for key, value := range data {
+		data[key] = normalizeNumbers(value)
+	}
+	return data, nil
+}
+
+func normalizeNumbers(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, item := range value {
+			value[key] = normalizeNumbers(item)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = normalizeNumbers(item)
+		}
+	case json.Number:
+		s := value.String()
+		if !strings.ContainsAny(s, ".eE") {
+			if n, err := strconv.ParseInt(s, 10, 64); err != nil || n > maxExactInt || n < -maxExactInt {
+				return value
+			}
+		}
+		if f, err := value.Float64(); err == nil {
+			return f
+		}
+		return value
+	}
+	return v
+}
+
+// encodeBody marshals an edited body like json.Marshal, but numbers whose value didn't
+// change keep their text from original (ex: 1.0 stays 1.0). With keepOrder, objects keep
+// original's key order and new keys follow, sorted; otherwise all keys are sorted.
+func encodeBody(data any, original []byte, keepOrder bool) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := appendBody(buf, data, original, keepOrder); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+// appendBody is encodeBody writing to buf
+func appendBody(buf *bytes.Buffer, data any, original []byte, keepOrder bool) error {
+	w := jsonWriter{buf: buf, enc: json.NewEncoder(buf), keepOrder: keepOrder}
+	return w.write(data, parseShape(original))
+}
+
+// jsonShape is what encodeBody keeps of the original body: key order and number text
+type jsonShape struct {
+	keys   []string
+	fields map[string]*jsonShape
+	items  []*jsonShape
+	number string
+}
+
+func (s *jsonShape) field(key string) *jsonShape {
+	if s == nil {
+		return nil
+	}
+	return s.fields[key]
+}
+
+func (s *jsonShape) item(i int) *jsonShape {
+	if s == nil || i >= len(s.items) {
+		return nil
+	}
+	return s.items[i]
+}
+
+// jsonWriter encodes scalars through one json.Encoder, which escapes like json.Marshal
+// without allocating a result per value
+type jsonWriter struct {
+	buf       *bytes.Buffer
+	enc       *json.Encoder
+	keepOrder bool
+}
+
+// scalar encodes v, dropping the newline Encode adds
+func (w jsonWriter) scalar(v any) error {
+	if err := w.enc.Encode(v); err != nil {
+		return err
+	}
+	w.buf.Truncate(w.buf.Len() - 1)
+	return nil
+}
+
+func (w jsonWriter) write(v any, shape *jsonShape) error {
+	switch value := v.(type) {
+	case map[string]any:
+		keys := slices.Sorted(maps.Keys(value))
+		if w.keepOrder && shape != nil && len(shape.keys) > 0 {
+			ordered := make([]string, 0, len(keys))
+			for _, key := range shape.keys {
+				if _, ok := value[key]; ok {
+					ordered = append(ordered, key)
+				}
+			}
+			for _, key := range keys {
+				if _, ok := shape.fields[key]; !ok {
+					ordered = append(ordered, key)
+				}
+			}
+			keys = ordered
+		}
+		w.buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			if err := w.scalar(key); err != nil {
+				return err
+			}
+			w.buf.WriteByte(':')
+			if err := w.write(value[key], shape.field(key)); err != nil {
+				return err
+			}
+		}
+		w.buf.WriteByte('}')
+		return nil
+	case []any:
+		w.buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			if err := w.write(item, shape.item(i)); err != nil {
+				return err
+			}
+		}
+		w.buf.WriteByte(']')
+		return nil
+	case float64:
+		if shape != nil && shape.number != "" {
+			if f, err := strconv.ParseFloat(shape.number, 64); err == nil && f == value {
+				w.buf.WriteString(shape.number)
+				return nil
+			}
+		}
+	case string:
+		return w.scalar(value)
+	case bool:
+		w.buf.WriteString(strconv.FormatBool(value))
+		return nil
+	case nil:
+		w.buf.WriteString("null")
+		return nil
+	}
+	return w.scalar(v)
+}
+
+// parseShape reads the key order and number text of a JSON body, or nil when it isn't JSON
+func parseShape(body []byte) *jsonShape {
+	if len(body) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	shape, err := readShape(dec)
+	if err != nil {
+		return nil
+	}
+	return shape
+}
+
+func readShape(dec *json.Decoder) (*jsonShape, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		shape := &jsonShape{}
+		if t == '{' {
+			shape.fields = make(map[string]*jsonShape)
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, _ := keyTok.(string)
+				field, err := readShape(dec)
+				if err != nil {
+					return nil, err
+				}
+				if _, dup := shape.fields[key]; !dup {
+					shape.keys = append(shape.keys, key)
+				}
+				shape.fields[key] = field
+			}
+		} else {
+			for dec.More() {
+				item, err := readShape(dec)
+				if err != nil {
+					return nil, err
+				}
+				shape.items = append(shape.items, item)
+			}
+		}
+		// Closing delimiter
+		_, err := dec.Token()
+		return shape, err
+	case json.Number:
+		return &jsonShape{number: t.String()}, nil
+	}
+	// Strings, booleans, and nulls encode the same either way
+	return nil, nil
+}
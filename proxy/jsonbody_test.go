@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"text/template"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestDecodeBodyKeepsLargeIntegers(t *testing.T) {
+	data, err := decodeBody([]byte(`{"seed": 12345678901234567890, "max_tokens": 256, "ids": [9007199254740993, 1.5]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["seed"] != json.Number("12345678901234567890") {
+		t.Fatalf("seed = %#v, want json.Number", data["seed"])
+	}
+	if data["max_tokens"] != 256.0 {
+		t.Fatalf("max_tokens = %#v, want float64", data["max_tokens"])
+	}
+	ids := data["ids"].([]any)
+	if ids[0] != json.Number("9007199254740993") || ids[1] != 1.5 {
+		t.Fatalf("ids = %#v", ids)
+	}
+
+	if _, err := decodeBody([]byte(`{"a":1} {"b":2}`)); err == nil {
+		t.Fatal("expected an error for trailing data")
+	}
+}
+
+func TestEncodeBodyKeepsNumberTextAndOrder(t *testing.T) {
+	original := []byte(`{"z": 1.0, "a": {"y": 2e2, "x": 3}, "seed": 12345678901234567890}`)
+	data, _ := decodeBody(original)
+	data["a"].(map[string]any)["x"] = 4.0
+	data["new"] = true
+
+	sorted, err := encodeBody(data, original, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":{"x":4,"y":2e2},"new":true,"seed":12345678901234567890,"z":1.0}`; string(sorted) != want {
+		t.Fatalf("sorted = %s, want %s", sorted, want)
+	}
+
+	ordered, _ := encodeBody(data, original, true)
+	if want := `{"z":1.0,"a":{"y":2e2,"x":4},"seed":12345678901234567890,"new":true}`; string(ordered) != want {
+		t.Fatalf("ordered = %s, want %s", ordered, want)
+	}
+}
+
+func TestModifyRequestPreservesSeedAndKeyOrder(t *testing.T) {
+	route := config.Route{
+		Methods: newPatternField("POST"),
+		Paths:   newPatternField("^/v1/chat$"),
+		Compiled: &config.CompiledRoute{
+			OnRequest:          []config.ActionExec{{Merge: map[string]any{"top_p": 0.9}}},
+			OnRequestTemplates: []*template.Template{nil},
+		},
+	}
+	route.OnRequest = []config.Action{{Merge: map[string]any{"top_p": 0.9}}}
+	h := NewHandler(config.ProxyConfig{Routes: []config.Route{route}, PreserveKeyOrder: true})
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat",
+		bytes.NewBufferString(`{"model":"m","seed":18446744073709551615,"temperature":1.0}`))
+	h.ModifyRequest(req)
+
+	sent, _ := io.ReadAll(req.Body)
+	if want := `{"model":"m","seed":18446744073709551615,"temperature":1.0,"top_p":0.9}`; string(sent) != want {
+		t.Fatalf("body = %s, want %s", sent, want)
+	}
+}
+
+func TestOffsetSeed(t *testing.T) {
+	tests := []struct {
+		seed any
+		want any
+	}{
+		{42.0, 45.0},
+		{json.Number("9223372036854775807"), json.Number("9223372036854775810")},
+		{json.Number("18446744073709551615"), json.Number("18446744073709551615")},
+		{"abc", "abc"},
+	}
+	for _, tt := range tests {
+		if got := offsetSeed(tt.seed, 3); got != tt.want {
+			t.Errorf("offsetSeed(%v, 3) = %v, want %v", tt.seed, got, tt.want)
+		}
+	}
+}
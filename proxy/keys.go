@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// keyActionsRoute stands in for a route index in the fired actions of API key actions
+const keyActionsRoute = -1
+
+// keysByToken indexes a proxy's keys by bearer token
+func keysByToken(keys []config.APIKey) map[string]*config.APIKey {
+	if len(keys) == 0 {
+		return nil
+	}
+	byToken := make(map[string]*config.APIKey, len(keys))
+	for i := range keys {
+		byToken[keys[i].Key] = &keys[i]
+	}
+	return byToken
+}
+
+// apiKey returns the restrictions for req's API key, or nil when the key isn't listed
+func (h *Handler) apiKey(req *http.Request) *config.APIKey {
+	if h.keys == nil {
+		return nil
+	}
+	return h.keys[config.BearerToken(req.Header.Get("Authorization"))]
+}
+
+// KnownKey reports whether req may reach the proxy: it lists no keys, or req carries one of them
+func (h *Handler) KnownKey(req *http.Request) bool {
+	return h.keys == nil || h.apiKey(req) != nil
+}
+
+// pathModel matches a model named in the path, as in Gemini's /v1beta/models/{model}:{method}
+// or OpenAI's /v1/models/{model}
+var pathModel = regexp.MustCompile(`/models/([^/:]+)(?::\w+)?$`)
+
+// requestModel returns the model a request asks for: the body's, else one named in the path
+func requestModel(path string, data map[string]any) (string, bool) {
+	if model, ok := data["model"]; ok {
+		name, _ := model.(string)
+		return name, true
+	}
+	if match := pathModel.FindStringSubmatch(path); match != nil {
+		return match[1], true
+	}
+	return "", false
+}
+
+// checkKey answers 401 when the proxy lists keys and the request's isn't one of them, and
+// 403 when key may not use any of the matched routes or asks for a model outside its
+// allowlist. A key with a model allowlist must name a model in every request with a body,
+// so a backend's default model can't stand in for one.
+func (h *Handler) checkKey(key *config.APIKey, method, path string, routes []*config.Route, data map[string]any) *Rejection {
+	if h.keys == nil {
+		return nil
+	}
+	if key == nil {
+		// CORS preflights never carry credentials
+		if method == http.MethodOptions {
+			return nil
+		}
+		logger.Info("Rejected request without a listed key", "method", method, "path", path)
+		return &Rejection{
+			Status:  http.StatusUnauthorized,
+			Type:    "authentication_error",
+			Code:    "invalid_api_key",
+			Message: "a listed API key is required",
+		}
+	}
+	if len(key.Routes) > 0 {
+		allowed := false
+		for _, route := range routes {
+			if key.AllowsRoute(route.Name) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			logger.Info("Rejected request outside key's routes", "key", key.Name)
+			return &Rejection{
+				Status:  http.StatusForbidden,
+				Type:    "permission_error",
+				Code:    "route_not_allowed",
+				Message: fmt.Sprintf("API key %s may not use this endpoint", key.Name),
+			}
+		}
+	}
+	if key.Models.Len() > 0 {
+		name, named := requestModel(path, data)
+		if !named && data != nil {
+			logger.Info("Rejected request naming no model", "key", key.Name, "path", path)
+			return &Rejection{
+				Status:  http.StatusForbidden,
+				Type:    "permission_error",
+				Code:    "model_required",
+				Message: fmt.Sprintf("API key %s must name a model", key.Name),
+			}
+		}
+		if named && !key.Models.Matches(name) {
+			logger.Info("Rejected model outside key's allowlist", "key", key.Name, "model", name)
+			return &Rejection{
+				Status:  http.StatusForbidden,
+				Type:    "permission_error",
+				Code:    "model_not_allowed",
+				Message: fmt.Sprintf("API key %s may not use model %q", key.Name, name),
+			}
+		}
+	}
+	return nil
+}
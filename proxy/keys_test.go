@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestModifyRequestEnforcesKeyAllowlists(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{
+		{
+			Name:       "chat",
+			Methods:    newPatternField("POST"),
+			Paths:      newPatternField("^/v1/chat/completions$"),
+			OnResponse: []config.Action{{Merge: map[string]any{"ok": true}}},
+		},
+		{
+			Name:       "embeddings",
+			Methods:    newPatternField("POST"),
+			Paths:      newPatternField("^/v1/embeddings$"),
+			OnResponse: []config.Action{{Merge: map[string]any{"ok": true}}},
+		},
+		{
+			Name:       "gemini",
+			Methods:    newPatternField("POST"),
+			Paths:      newPatternField("^/v1beta/models/"),
+			OnResponse: []config.Action{{Merge: map[string]any{"ok": true}}},
+		},
+	})
+	cfg.Proxies[0].Keys = []config.APIKey{{
+		Name:   "team-a",
+		Key:    "sk-team-a",
+		Models: newPatternField("^qwen"),
+		Routes: []string{"chat", "gemini"},
+	}}
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+
+	tests := []struct {
+		name, key, path, body string
+		wantStatus            int
+		wantCode              string // Empty when the request reaches the backend
+	}{
+		{"allowed model and route", "sk-team-a", "/v1/chat/completions", `{"model":"qwen3"}`, 0, ""},
+		{"model outside allowlist", "sk-team-a", "/v1/chat/completions", `{"model":"llama3"}`, http.StatusForbidden, "model_not_allowed"},
+		{"route outside allowlist", "sk-team-a", "/v1/embeddings", `{"model":"qwen3"}`, http.StatusForbidden, "route_not_allowed"},
+		{"no model named", "sk-team-a", "/v1/chat/completions", `{"messages":[]}`, http.StatusForbidden, "model_required"},
+		{"allowed model in path", "sk-team-a", "/v1beta/models/qwen3:generateContent", `{"contents":[]}`, 0, ""},
+		{"model in path outside allowlist", "sk-team-a", "/v1beta/models/llama3:generateContent", `{"contents":[]}`, http.StatusForbidden, "model_not_allowed"},
+		{"unlisted key", "sk-other", "/v1/embeddings", `{"model":"llama3"}`, http.StatusUnauthorized, "invalid_api_key"},
+		{"no key", "", "/v1/chat/completions", `{"model":"qwen3"}`, http.StatusUnauthorized, "invalid_api_key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://example.com"+tt.path, bytes.NewBufferString(tt.body))
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			h.ModifyRequest(req)
+
+			if tt.wantCode == "" {
+				if rej := rejectionFromRequest(req); rej != nil {
+					t.Fatalf("rejected with %s, want the request passed", rej.Code)
+				}
+				return
+			}
+			resp, err := NewTransport(failingTransport{t}).RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip error: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus || !strings.Contains(string(body), tt.wantCode) {
+				t.Fatalf("status = %d, body = %s, want %d %s", resp.StatusCode, body, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestModifyRequestAppliesKeyActionsBeforeRoutes(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Name:    "chat",
+		Methods: newPatternField("POST"),
+		Paths:   newPatternField("^/v1/chat/completions$"),
+		OnRequest: []config.Action{{
+			When:  &config.BoolExpr{Body: map[string]config.PatternField{"user": newPatternField("^team-a$")}},
+			Merge: map[string]any{"temperature": 0.6},
+		}},
+	}})
+	cfg.Proxies[0].Models.Aliases = map[string]string{"fast": "qwen3-4b"}
+	cfg.Proxies[0].Keys = []config.APIKey{
+		{
+			Name: "team-a",
+			Key:  "sk-team-a",
+			OnRequest: []config.Action{
+				{Merge: map[string]any{"model": "fast", "user": "team-a"}},
+				{Default: map[string]any{"max_tokens": 512}},
+			},
+		},
+		{Name: "team-b", Key: "sk-team-b"},
+	}
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+
+	tests := []struct {
+		name, key string
+		want      map[string]any
+	}{
+		{"listed key", "sk-team-a", map[string]any{"model": "qwen3-4b", "user": "team-a", "max_tokens": 512.0, "temperature": 0.6}},
+		{"key without actions", "sk-team-b", map[string]any{"model": "llama3", "user": nil, "max_tokens": nil, "temperature": nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+				bytes.NewBufferString(`{"model":"llama3","messages":[]}`))
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			h.ModifyRequest(req)
+
+			body, _ := io.ReadAll(req.Body)
+			var data map[string]any
+			if err := json.Unmarshal(body, &data); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			for field, want := range tt.want {
+				if data[field] != want {
+					t.Errorf("%s = %v, want %v (body %s)", field, data[field], want, body)
+				}
+			}
+		})
+	}
+}
@@ -3,12 +3,35 @@ package proxy
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// Inline image payloads: data URLs, and Ollama's bare base64 strings
+var (
+	dataURLPattern    = regexp.MustCompile(`data:[\w/.+-]+;base64,[A-Za-z0-9+/=]{64,}`)
+	bareBase64Pattern = regexp.MustCompile(`"[A-Za-z0-9+/]{512,}={0,2}"`)
 )
 
+// elideImageData replaces base64 image payloads with their length, so logs stay readable
+// and truncation keeps the surrounding JSON.
+func elideImageData(body []byte) []byte {
+	body = dataURLPattern.ReplaceAllFunc(body, func(m []byte) []byte {
+		i := bytes.Index(m, []byte(",")) + 1
+		return fmt.Appendf(nil, "%s[%d base64 chars]", m[:i], len(m)-i)
+	})
+	return bareBase64Pattern.ReplaceAllFunc(body, func(m []byte) []byte {
+		return fmt.Appendf(nil, `"[%d base64 chars]"`, len(m)-2)
+	})
+}
+
 // sanitizeBody returns a redacted, truncated string for logging JSON bodies.
-func sanitizeBody(body []byte, maxBytes int) (string, bool) {
+func sanitizeBody(body []byte, maxBytes int, redact config.LogRedact) (string, bool) {
+	body = elideImageData(redactBody(body, redact))
 	truncated := false
 	if len(body) > maxBytes {
 		body = body[:maxBytes]
@@ -23,6 +46,29 @@ func sanitizeBody(body []byte, maxBytes int) (string, bool) {
 	return suffixIfTruncated(buf.String(), truncated), truncated
 }
 
+// redactBody hides log_redact fields, including in SSE data: lines
+func redactBody(body []byte, redact config.LogRedact) []byte {
+	payload, ok := bytes.CutPrefix(body, []byte("data:"))
+	if !ok {
+		return redact.RedactJSON(body)
+	}
+	payload = bytes.TrimSpace(payload)
+	return append([]byte("data: "), redact.RedactJSON(payload)...)
+}
+
+// bodyJSON renders a parsed body for debug logs, with log_redact fields and image data hidden
+func bodyJSON(data any, redact config.LogRedact) string {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, elideImageData(redact.RedactJSON(body)), "  ", "  "); err != nil {
+		return string(body)
+	}
+	return buf.String()
+}
+
 func suffixIfTruncated(val string, truncated bool) string {
 	if !truncated {
 		return val
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+func TestSanitizeBodyRedactsFields(t *testing.T) {
+	redact := config.LogRedact{Paths: []string{"choices[*].delta.content"}}
+	if err := redact.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	line := `data: {"choices":[{"index":0,"delta":{"content":"private"}}]}`
+	safe, _ := sanitizeBody([]byte(line), 4096, redact)
+	if strings.Contains(safe, "private") || !strings.HasPrefix(safe, "data: ") || !strings.Contains(safe, config.LogRedactPlaceholder) {
+		t.Fatalf("SSE line not redacted: %s", safe)
+	}
+
+	safe, _ = sanitizeBody([]byte("data: [DONE]"), 4096, redact)
+	if safe != "data: [DONE]" {
+		t.Fatalf("done marker changed: %s", safe)
+	}
+}
+
+func TestDebugLogsRedactBodyFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	logger.EnableDebug(true)
+	t.Cleanup(func() {
+		logger.EnableDebug(false)
+		logger.SetOutput(os.Stdout)
+	})
+
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:   newPatternField("POST"),
+		Paths:     newPatternField("^/v1/chat/completions$"),
+		OnRequest: []config.Action{{Merge: map[string]any{"temperature": 0.2}}},
+	}})
+	cfg.Proxies[0].LogRedact = config.LogRedact{Paths: []string{"messages[*].content"}}
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(chatBody("top secret prompt")))
+	NewHandler(cfg.Proxies[0]).ModifyRequest(req)
+
+	logs := buf.String()
+	if !strings.Contains(logs, "Request body") || !strings.Contains(logs, "Outbound request body") {
+		t.Fatalf("expected request body logs, got:\n%s", logs)
+	}
+	if strings.Contains(logs, "top secret") {
+		t.Fatalf("prompt leaked into debug logs:\n%s", logs)
+	}
+}
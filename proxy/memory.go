@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+)
+
+var (
+	bufferedBytes = metrics.NewGauge("llama_matchmaker_buffered_bytes", "Approximate memory held by buffered bodies and active streams")
+	shedRequests  = metrics.NewCounter("llama_matchmaker_shed_requests_total", "Large requests refused while memory.limit was exceeded", "listen")
+)
+
+// streamMemory approximates what one active stream holds: its line and event buffers
+const streamMemory = 2 * scanBufferSize
+
+// memoryInUse sums every request's memoryLedger
+var memoryInUse atomic.Int64
+
+// memoryLimits holds the memory config in effect; nil means nothing is shed
+var memoryLimits atomic.Pointer[config.MemoryConfig]
+
+// ConfigureMemory sets the limit above which WithMemoryLimit sheds large requests; nil
+// turns shedding off. Memory stays tracked either way.
+func ConfigureMemory(cfg *config.MemoryConfig) {
+	memoryLimits.Store(cfg)
+}
+
+// MemoryInUse reports the approximate bytes held by buffered bodies and active streams
+func MemoryInUse() int64 {
+	return memoryInUse.Load()
+}
+
+type memoryLedgerKey struct{}
+
+// memoryLedger is the memory charged to one request, returned when it completes
+type memoryLedger struct {
+	held atomic.Int64
+}
+
+// chargeMemory adds n bytes to the request's ledger; requests outside WithMemoryLimit
+// aren't tracked
+func chargeMemory(ctx context.Context, n int) {
+	l, _ := ctx.Value(memoryLedgerKey{}).(*memoryLedger)
+	if l == nil || n <= 0 {
+		return
+	}
+	l.held.Add(int64(n))
+	bufferedBytes.Set(float64(memoryInUse.Add(int64(n))))
+}
+
+func (l *memoryLedger) release() {
+	if n := l.held.Swap(0); n > 0 {
+		bufferedBytes.Set(float64(memoryInUse.Add(-n)))
+	}
+}
+
+// WithMemoryLimit charges the bodies and streams each request buffers until it completes.
+// While the total is over memory.limit, requests with bodies of at least memory.large_body
+// (or of unknown length) are answered 503 memory_pressure before anything is read.
+func WithMemoryLimit(next http.Handler, listen string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if cfg := memoryLimits.Load(); cfg != nil && memoryInUse.Load() > cfg.Limit && isLargeBody(req, cfg.LargeBody) {
+			shedRequests.Add(1, listen)
+			logger.Info("Shed request under memory pressure", "method", req.Method, "path", req.URL.Path,
+				"in_use", memoryInUse.Load(), "limit", cfg.Limit)
+			rej := &Rejection{
+				Status:  http.StatusServiceUnavailable,
+				Type:    "server_error",
+				Code:    "memory_pressure",
+				Message: "the proxy is buffering too much data; retry shortly",
+			}
+			rej.write(w, http.Header{"Retry-After": {"1"}})
+			return
+		}
+
+		ledger := &memoryLedger{}
+		defer ledger.release()
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), memoryLedgerKey{}, ledger)))
+	})
+}
+
+// isLargeBody reports whether req declares a body of at least threshold bytes, or sends
+// one of unknown length
+func isLargeBody(req *http.Request, threshold int64) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return false
+	}
+	return req.ContentLength < 0 || req.ContentLength >= threshold
+}
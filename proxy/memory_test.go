@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestWithMemoryLimitReleasesOnCompletion(t *testing.T) {
+	before := MemoryInUse()
+	var during int64
+	h := WithMemoryLimit(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		chargeMemory(req.Context(), 1000)
+		chargeMemory(req.Context(), 500)
+		during = MemoryInUse()
+	}), "mem-test")
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat", strings.NewReader("{}")))
+
+	if during-before != 1500 {
+		t.Fatalf("in use while serving = %d, want %d", during-before, 1500)
+	}
+	if got := MemoryInUse(); got != before {
+		t.Fatalf("in use after completion = %d, want %d", got, before)
+	}
+}
+
+func TestWithMemoryLimitShedsLargeBodies(t *testing.T) {
+	ConfigureMemory(&config.MemoryConfig{Limit: MemoryInUse() + 100, LargeBody: 1024})
+	t.Cleanup(func() { ConfigureMemory(nil) })
+
+	holding := make(chan struct{})
+	done := make(chan struct{})
+	var served int
+	h := WithMemoryLimit(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/hold" {
+			chargeMemory(req.Context(), 200)
+			close(holding)
+			<-done
+			return
+		}
+		served++
+	}), "mem-test")
+
+	released := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/hold", strings.NewReader("{}")))
+		close(released)
+	}()
+	<-holding
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat", strings.NewReader(strings.Repeat("x", 2048))))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "memory_pressure") {
+		t.Fatalf("large body over limit = %d %s, want 503 memory_pressure", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("shed response has no Retry-After")
+	}
+
+	// Small bodies still go through
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat", strings.NewReader("{}")))
+	if rec.Code != http.StatusOK || served != 1 {
+		t.Fatalf("small body over limit = %d (served %d), want it served", rec.Code, served)
+	}
+
+	close(done)
+	<-released
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat", strings.NewReader(strings.Repeat("x", 2048))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("large body under limit = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// MethodOverrideHeader carries the intended method of a POST from a client that can only
+// send GET and POST
+const MethodOverrideHeader = "X-HTTP-Method-Override"
+
+// overridableMethods are the methods a POST may be turned into
+var overridableMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// WithMethodOverride turns POSTs with an X-HTTP-Method-Override header into the method it
+// names, before routes match them, and forwards them with it. The header is removed;
+// other methods, and unknown override values, pass through unchanged.
+func WithMethodOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		override := strings.ToUpper(strings.TrimSpace(req.Header.Get(MethodOverrideHeader)))
+		if req.Method == http.MethodPost && override != "" {
+			if slices.Contains(overridableMethods, override) {
+				logger.Debug("Method overridden", "path", req.URL.Path, "method", override)
+				req.Method = override
+				req.Header.Del(MethodOverrideHeader)
+			} else {
+				logger.Debug("Ignored unknown method override", "path", req.URL.Path, "method", override)
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
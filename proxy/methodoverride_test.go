@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithMethodOverride(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		override   string
+		want       string
+		wantHeader string
+	}{
+		{name: "POST tunneling DELETE", method: "POST", override: "delete", want: "DELETE"},
+		{name: "POST without header", method: "POST", want: "POST"},
+		{name: "unknown override ignored", method: "POST", override: "CONNECT", want: "POST", wantHeader: "CONNECT"},
+		{name: "only POST is overridden", method: "GET", override: "DELETE", want: "GET", wantHeader: "DELETE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			handler := WithMethodOverride(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				got = req
+			}))
+			req := httptest.NewRequest(tt.method, "/slots/0", nil)
+			if tt.override != "" {
+				req.Header.Set(MethodOverrideHeader, tt.override)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got.Method != tt.want {
+				t.Errorf("method = %s, want %s", got.Method, tt.want)
+			}
+			if h := got.Header.Get(MethodOverrideHeader); h != tt.wantHeader {
+				t.Errorf("%s = %q, want %q", MethodOverrideHeader, h, tt.wantHeader)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// ModelsPath is the OpenAI-compatible model list endpoint served by ModelsAggregator
+const ModelsPath = "/v1/models"
+
+// OllamaTagsPath is Ollama's model list endpoint
+const OllamaTagsPath = "/api/tags"
+
+// isModelListRequest reports whether req lists models in OpenAI or Ollama form
+func isModelListRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	return path == ModelsPath || path == OllamaTagsPath
+}
+
+// ModelsAggregator serves a combined /v1/models list gathered from every target
+type ModelsAggregator struct {
+	targets []*url.URL
+	models  config.ModelsConfig
+	client  *http.Client
+}
+
+// NewModelsAggregator creates an aggregator over the given targets
+func NewModelsAggregator(targets []*url.URL, models config.ModelsConfig, timeout time.Duration) *ModelsAggregator {
+	return &ModelsAggregator{
+		targets: targets,
+		models:  models,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// UseTransport sends the aggregator's listing calls through rt, so they reach the targets
+// the way proxied requests do
+func (a *ModelsAggregator) UseTransport(rt http.RoundTripper) {
+	a.client.Transport = rt
+}
+
+// Matches reports whether req should be answered by the aggregator
+func (a *ModelsAggregator) Matches(req *http.Request) bool {
+	return req.Method == http.MethodGet && strings.TrimSuffix(req.URL.Path, "/") == ModelsPath
+}
+
+func (a *ModelsAggregator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	lists := make([][]any, len(a.targets))
+	errs := make([]error, len(a.targets))
+
+	var wg sync.WaitGroup
+	for i, target := range a.targets {
+		wg.Add(1)
+		go func(i int, target *url.URL) {
+			defer wg.Done()
+			lists[i], errs[i] = a.fetch(req.Context(), target, req.Header)
+		}(i, target)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			logger.Error("Failed to fetch model list", "target_host", a.targets[i].Host, "err", err)
+		}
+	}
+	if failed == len(a.targets) {
+		writeJSONError(w, http.StatusBadGateway, "no backend returned a model list", "upstream_error")
+		return
+	}
+
+	data := mergeModelLists(lists, a.models)
+	logger.Info("Served aggregated model list", "targets", len(a.targets), "failed", failed, "models", len(data))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data})
+}
+
+func (a *ModelsAggregator) fetch(ctx context.Context, target *url.URL, header http.Header) ([]any, error) {
+	endpoint := *target
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + ModelsPath
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth := header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Data []any `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("invalid model list: %w", err)
+	}
+	return list.Data, nil
+}
+
+// mergeModelLists publishes each target's entries and drops duplicates,
+// keeping the first occurrence in target order.
+func mergeModelLists(lists [][]any, models config.ModelsConfig) []any {
+	merged := make([]any, 0)
+	seen := make(map[string]struct{})
+	for _, list := range lists {
+		merged = append(merged, publishModelEntries(list, models, seen, "id")...)
+	}
+	return merged
+}
+
+// publishModelEntries renames entries to their published names and drops names outside
+// the allow list or already in seen. The first key holds the model name; every listed
+// key is rewritten (Ollama repeats the name under "name" and "model").
+func publishModelEntries(entries []any, models config.ModelsConfig, seen map[string]struct{}, keys ...string) []any {
+	published := make([]any, 0, len(entries))
+	for _, item := range entries {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		id, _ := entry[keys[0]].(string)
+		if id == "" {
+			continue
+		}
+		for _, name := range models.PublishedNames(id) {
+			if !models.Allowed(name) {
+				continue
+			}
+			if _, dup := seen[name]; dup {
+				continue
+			}
+			seen[name] = struct{}{}
+
+			renamed := make(map[string]any, len(entry))
+			for k, v := range entry {
+				renamed[k] = v
+			}
+			for _, key := range keys {
+				if _, exists := entry[key]; exists {
+					renamed[key] = name
+				}
+			}
+			published = append(published, renamed)
+		}
+	}
+	return published
+}
+
+// rewriteModelListBody filters and renames an OpenAI (data[].id) or Ollama (models[].name)
+// model list. It returns false when the body is not a recognizable list.
+func rewriteModelListBody(body []byte, models config.ModelsConfig) ([]byte, bool) {
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, false
+	}
+
+	seen := make(map[string]struct{})
+	if list, ok := data["data"].([]any); ok {
+		data["data"] = publishModelEntries(list, models, seen, "id")
+	} else if list, ok := data["models"].([]any); ok {
+		data["models"] = publishModelEntries(list, models, seen, "name", "model")
+	} else {
+		return nil, false
+	}
+
+	rewritten, err := json.Marshal(data)
+	if err != nil {
+		return nil, false
+	}
+	return rewritten, true
+}
+
+// writeJSONError responds with an OpenAI-style error body
+func writeJSONError(w http.ResponseWriter, status int, message, errType string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"message": message, "type": errType, "code": status},
+	})
+}
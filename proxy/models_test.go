@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestModelsAggregatorMergesAndRenames(t *testing.T) {
+	first, closeFirst := newSafeTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer k" {
+			t.Errorf("expected Authorization to be forwarded, got %q", r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"object":"list","data":[{"id":"qwen3-32b","object":"model"},{"id":"llama3","object":"model"}]}`))
+	})
+	if first == nil {
+		return
+	}
+	defer closeFirst()
+
+	second, closeSecond := newSafeTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"object":"list","data":[{"id":"llama3","object":"model"},{"id":"gemma3","object":"model"}]}`))
+	})
+	defer closeSecond()
+
+	broken, closeBroken := newSafeTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	defer closeBroken()
+
+	var targets []*url.URL
+	for _, srv := range []string{first.URL, second.URL, broken.URL} {
+		u, _ := url.Parse(srv)
+		targets = append(targets, u)
+	}
+
+	agg := NewModelsAggregator(targets, config.ModelsConfig{
+		Aliases: map[string]string{"gpt-4o": "qwen3-32b"},
+	}, 5*time.Second)
+
+	req := httptest.NewRequest("GET", "http://proxy/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer k")
+	if !agg.Matches(req) {
+		t.Fatal("expected aggregator to match GET /v1/models")
+	}
+
+	rec := httptest.NewRecorder()
+	agg.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	var resp struct {
+		Data []map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	var ids []string
+	for _, m := range resp.Data {
+		ids = append(ids, m["id"].(string))
+	}
+	want := []string{"gpt-4o", "llama3", "gemma3"}
+	if len(ids) != len(want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("ids = %v, want %v", ids, want)
+		}
+	}
+}
+
+func TestModelsAggregatorAllTargetsFail(t *testing.T) {
+	broken, closeBroken := newSafeTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	if broken == nil {
+		return
+	}
+	defer closeBroken()
+
+	u, _ := url.Parse(broken.URL)
+	agg := NewModelsAggregator([]*url.URL{u}, config.ModelsConfig{}, time.Second)
+
+	rec := httptest.NewRecorder()
+	agg.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", rec.Code)
+	}
+}
+
+func TestHandlerResolvesModelAliasBeforeRoutes(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods: newPatternField("POST"),
+		Paths:   newPatternField("^/v1/chat/completions$"),
+		OnRequest: []config.Action{{
+			When:  &config.BoolExpr{Body: map[string]config.PatternField{"model": newPatternField("^qwen3-32b$")}},
+			Merge: map[string]any{"temperature": 0.6},
+		}},
+	}})
+	cfg.Proxies[0].Models.Aliases = map[string]string{"gpt-4o": "qwen3-32b"}
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"gpt-4o","messages":[]}`))
+	NewHandler(cfg.Proxies[0]).ModifyRequest(req)
+
+	body, _ := io.ReadAll(req.Body)
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data["model"] != "qwen3-32b" {
+		t.Fatalf("model = %v, want qwen3-32b", data["model"])
+	}
+	if data["temperature"] != 0.6 {
+		t.Fatalf("expected route to match backend name, got %v", data)
+	}
+}
+
+func TestModifyResponseFiltersModelLists(t *testing.T) {
+	h := NewHandler(config.ProxyConfig{
+		Models: config.ModelsConfig{
+			Aliases: map[string]string{"gpt-4o": "qwen3-32b"},
+			Allow:   newPatternField("^gpt-", "^llama3"),
+		},
+	})
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		key  string
+		want []string
+	}{
+		{
+			name: "openai",
+			path: "/v1/models",
+			body: `{"object":"list","data":[{"id":"qwen3-32b"},{"id":"llama3"},{"id":"secret-model"}]}`,
+			key:  "data",
+			want: []string{"gpt-4o", "llama3"},
+		},
+		{
+			name: "ollama",
+			path: "/api/tags",
+			body: `{"models":[{"name":"qwen3-32b","model":"qwen3-32b"},{"name":"llama3:latest","model":"llama3:latest"},{"name":"secret-model","model":"secret-model"}]}`,
+			key:  "models",
+			want: []string{"gpt-4o", "llama3:latest"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com"+tt.path, nil)
+			resp := &http.Response{
+				Request:    req,
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(bytes.NewBufferString(tt.body)),
+			}
+			if err := h.ModifyResponse(resp); err != nil {
+				t.Fatalf("ModifyResponse error: %v", err)
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.Header.Get("Content-Length") != strconv.Itoa(len(body)) {
+				t.Errorf("Content-Length = %s, body is %d bytes", resp.Header.Get("Content-Length"), len(body))
+			}
+
+			var data map[string]any
+			if err := json.Unmarshal(body, &data); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			entries, _ := data[tt.key].([]any)
+			if len(entries) != len(tt.want) {
+				t.Fatalf("entries = %v, want %v", entries, tt.want)
+			}
+			for i, want := range tt.want {
+				for _, field := range []string{"id", "name", "model"} {
+					if v, ok := entries[i].(map[string]any)[field]; ok && v != want {
+						t.Errorf("entry %d %s = %v, want %s", i, field, v, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	b := NewBalancer(3)
+	req := httptest.NewRequest("GET", "/", nil)
+
+	var got []int
+	for range 6 {
+		got = append(got, b.Pick(req))
+	}
+	want := []int{0, 1, 2, 0, 1, 2}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Pick sequence = %v, want %v", got, want)
+		}
+	}
+
+	if NewBalancer(1).Pick(req) != 0 {
+		t.Fatal("single-target balancer should always pick 0")
+	}
+}
+
+func TestBalancerAffinity(t *testing.T) {
+	b := NewAffinityBalancer(8, &config.AffinityConfig{Header: "X-Session", Body: "user", Messages: 2}, nil, 1024)
+
+	pick := func(header, body string) (int, string) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(body))
+		if header != "" {
+			req.Header.Set("X-Session", header)
+		}
+		target := b.Pick(req)
+		rest, _ := io.ReadAll(req.Body)
+		return target, string(rest)
+	}
+
+	turn1 := `{"messages":[{"role":"system","content":"s"},{"role":"user","content":"hi"}]}`
+	turn2 := `{"messages":[{"role":"system","content":"s"},{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"more"}]}`
+	first, body := pick("", turn1)
+	if body != turn1 {
+		t.Fatalf("body after Pick = %q, want it left readable", body)
+	}
+	if second, _ := pick("", turn2); second != first {
+		t.Errorf("later turn picked %d, want %d", second, first)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		byHeader, _ := pick(key, `{}`)
+		byBody, _ := pick("", `{"user":"`+key+`"}`)
+		again, _ := pick(key, `{"user":"other"}`)
+		if byHeader != again {
+			t.Errorf("header %s picked %d then %d, want the header to win over body", key, byHeader, again)
+		}
+		if again2, _ := pick("", `{"user":"`+key+`"}`); again2 != byBody {
+			t.Errorf("user %s picked %d then %d", key, byBody, again2)
+		}
+	}
+
+	// Requests without a key fall back to round-robin
+	plain := NewAffinityBalancer(2, &config.AffinityConfig{Body: "user"}, nil, 1024)
+	req := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{}`))
+	if a, b := plain.Pick(req), plain.Pick(req); a == b {
+		t.Errorf("keyless picks = %d, %d, want round-robin", a, b)
+	}
+}
@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// redactedText replaces text flagged by moderation
+const redactedText = "[redacted]"
+
+// moderationClient calls classifier endpoints; each call is bounded by the policy timeout
+var moderationClient = &http.Client{}
+
+// moderationVerdict is the outcome of moderating a reply
+type moderationVerdict struct {
+	Flagged    bool
+	Categories []string
+}
+
+func (v moderationVerdict) annotation() map[string]any {
+	categories := make([]any, len(v.Categories))
+	for i, c := range v.Categories {
+		categories[i] = c
+	}
+	return map[string]any{"flagged": v.Flagged, "categories": categories}
+}
+
+func moderationPolicy(routes []*config.Route) *config.ModerationPolicy {
+	for _, route := range routes {
+		if route != nil && route.Moderation != nil {
+			return route.Moderation
+		}
+	}
+	return nil
+}
+
+// matchesPatterns reports whether text matches any moderation regex
+func matchesPatterns(policy *config.ModerationPolicy, text string) bool {
+	return policy.Patterns.Len() > 0 && policy.Patterns.Matches(text)
+}
+
+// redactPatterns replaces every regex match in text
+func redactPatterns(policy *config.ModerationPolicy, text string) string {
+	for _, re := range policy.Patterns.Compiled {
+		text = re.ReplaceAllString(text, redactedText)
+	}
+	return text
+}
+
+// moderate checks text against the policy's regexes, then its classifier
+func moderate(ctx context.Context, policy *config.ModerationPolicy, text string) moderationVerdict {
+	if matchesPatterns(policy, text) {
+		return moderationVerdict{Flagged: true, Categories: []string{"pattern"}}
+	}
+	if policy.Endpoint == "" || text == "" {
+		return moderationVerdict{}
+	}
+	verdict, err := classify(ctx, policy, text)
+	if err != nil {
+		logger.Error("Moderation endpoint failed", "endpoint", policy.Endpoint, "fail_closed", policy.FailClosed, "err", err)
+		if policy.FailClosed {
+			return moderationVerdict{Flagged: true, Categories: []string{"moderation_error"}}
+		}
+		return moderationVerdict{}
+	}
+	return verdict
+}
+
+// classify calls the classifier. It accepts OpenAI's {"results": [{"flagged", "categories"}]}
+// and a bare {"flagged", "categories"} with categories as a list or a name -> bool map.
+func classify(ctx context.Context, policy *config.ModerationPolicy, text string) (moderationVerdict, error) {
+	ctx, cancel := context.WithTimeout(ctx, policy.Timeout)
+	defer cancel()
+
+	payload := map[string]any{"input": text}
+	if policy.Model != "" {
+		payload["model"] = policy.Model
+	}
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, policy.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return moderationVerdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range policy.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := moderationClient.Do(req)
+	if err != nil {
+		return moderationVerdict{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return moderationVerdict{}, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var result map[string]any
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&result); err != nil {
+		return moderationVerdict{}, fmt.Errorf("invalid response: %w", err)
+	}
+
+	entries := asSlice(result["results"])
+	if entries == nil {
+		entries = []any{result}
+	}
+	var verdict moderationVerdict
+	for _, e := range entries {
+		entry := asMap(e)
+		if entry["flagged"] == true {
+			verdict.Flagged = true
+		}
+		switch categories := entry["categories"].(type) {
+		case []any:
+			for _, c := range categories {
+				if name, ok := c.(string); ok {
+					verdict.Categories = append(verdict.Categories, name)
+				}
+			}
+		case map[string]any:
+			for name, hit := range categories {
+				if hit == true {
+					verdict.Categories = append(verdict.Categories, name)
+				}
+			}
+		}
+	}
+	sort.Strings(verdict.Categories)
+	return verdict, nil
+}
+
+// setReplyText replaces the generated text of an OpenAI, Ollama, or /completion reply
+func setReplyText(data map[string]any, text string) {
+	if choices, ok := data["choices"].([]any); ok && len(choices) > 0 {
+		if message, ok := asMap(choices[0])["message"].(map[string]any); ok {
+			message["content"] = text
+		}
+		return
+	}
+	if message, ok := data["message"].(map[string]any); ok {
+		message["content"] = text
+		return
+	}
+	if _, ok := data["content"].(string); ok {
+		data["content"] = text
+	}
+}
+
+// moderateReply applies the policy to a complete reply. It returns a rejection when the
+// reply is blocked, and reports whether data was modified.
+func moderateReply(ctx context.Context, policy *config.ModerationPolicy, data map[string]any) (bool, *Rejection) {
+	text, ok := replyText(data)
+	if !ok {
+		return false, nil
+	}
+	verdict := moderate(ctx, policy, text)
+	if !verdict.Flagged {
+		return false, nil
+	}
+	logger.Info("Moderation flagged reply", "action", policy.Action, "categories", verdict.Categories)
+
+	switch policy.Action {
+	case config.ModerationBlock:
+		return false, &Rejection{
+			Status:  http.StatusForbidden,
+			Type:    "content_filter",
+			Code:    "content_filtered",
+			Message: "reply blocked by moderation (" + strings.Join(verdict.Categories, ", ") + ")",
+		}
+	case config.ModerationRedact:
+		redacted := redactPatterns(policy, text)
+		if redacted == text {
+			// Flagged by the classifier, which gives no spans
+			redacted = redactedText
+		}
+		setReplyText(data, redacted)
+	}
+	data["moderation"] = verdict.annotation()
+	return true, nil
+}
+
+// streamModerator checks streamed text as it accumulates. Regex matches act on the chunk
+// that completes them; the classifier sees the whole text with the final chunk.
+type streamModerator struct {
+	ctx     context.Context
+	policy  *config.ModerationPolicy
+	text    strings.Builder
+	blocked bool
+	verdict moderationVerdict
+}
+
+func newStreamModerator(ctx context.Context, routes []*config.Route) *streamModerator {
+	if policy := moderationPolicy(routes); policy != nil {
+		return &streamModerator{ctx: ctx, policy: policy}
+	}
+	return nil
+}
+
+// streamDelta returns the text container of an OpenAI or Ollama stream chunk
+func streamDelta(data map[string]any) (map[string]any, map[string]any, bool) {
+	if choices, ok := data["choices"].([]any); ok {
+		if len(choices) == 0 {
+			return nil, nil, false
+		}
+		choice := asMap(choices[0])
+		delta, _ := choice["delta"].(map[string]any)
+		return delta, choice, choice["finish_reason"] != nil
+	}
+	if message, ok := data["message"].(map[string]any); ok {
+		return message, nil, data["done"] == true
+	}
+	return nil, nil, data["done"] == true
+}
+
+// apply moderates one chunk. Blocked streams keep flowing with empty content so clients
+// still see a well-formed end, with finish_reason content_filter where the dialect has one.
+func (m *streamModerator) apply(data map[string]any) {
+	delta, choice, final := streamDelta(data)
+	content, _ := delta["content"].(string)
+
+	if m.blocked {
+		if content != "" {
+			delta["content"] = ""
+		}
+		if final && choice != nil {
+			choice["finish_reason"] = "content_filter"
+		}
+	} else if content != "" {
+		m.text.WriteString(content)
+		if matchesPatterns(m.policy, m.text.String()) {
+			m.verdict = moderationVerdict{Flagged: true, Categories: []string{"pattern"}}
+			switch m.policy.Action {
+			case config.ModerationBlock:
+				m.blocked = true
+				delta["content"] = ""
+				if choice != nil {
+					choice["finish_reason"] = "content_filter"
+				}
+			case config.ModerationRedact:
+				delta["content"] = redactPatterns(m.policy, content)
+			}
+		}
+	}
+
+	if !final {
+		return
+	}
+	if !m.verdict.Flagged && m.policy.Endpoint != "" {
+		m.verdict = moderate(m.ctx, m.policy, m.text.String())
+		if m.verdict.Flagged && m.policy.Action == config.ModerationBlock && choice != nil {
+			choice["finish_reason"] = "content_filter"
+		}
+	}
+	if m.verdict.Flagged {
+		logger.Info("Moderation flagged stream", "action", m.policy.Action, "categories", m.verdict.Categories)
+		data["moderation"] = m.verdict.annotation()
+	}
+}
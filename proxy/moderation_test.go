@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func moderatedReply(t *testing.T, h *Handler, content string) (*http.Response, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+	h.ModifyRequest(req)
+	reply, _ := json.Marshal(map[string]any{
+		"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": content}}},
+	})
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(reply)),
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return resp, data
+}
+
+func replyContent(data map[string]any) any {
+	return data["choices"].([]any)[0].(map[string]any)["message"].(map[string]any)["content"]
+}
+
+func TestModerationPatterns(t *testing.T) {
+	patterns := newPatternField(`secret-\d+`)
+
+	t.Run("block", func(t *testing.T) {
+		h := newRouteHandler(t, config.Route{Moderation: &config.ModerationPolicy{Patterns: patterns}}, nil)
+		resp, data := moderatedReply(t, h, "the code is secret-42")
+		if resp.StatusCode != http.StatusForbidden || data["error"].(map[string]any)["code"] != "content_filtered" {
+			t.Fatalf("status = %d, body = %v, want 403 content_filtered", resp.StatusCode, data)
+		}
+	})
+
+	t.Run("redact", func(t *testing.T) {
+		h := newRouteHandler(t, config.Route{Moderation: &config.ModerationPolicy{Patterns: patterns, Action: config.ModerationRedact}}, nil)
+		_, data := moderatedReply(t, h, "the code is SECRET-42")
+		if replyContent(data) != "the code is [redacted]" || data["moderation"] == nil {
+			t.Fatalf("body = %v, want match redacted and annotated", data)
+		}
+	})
+
+	t.Run("clean reply passes", func(t *testing.T) {
+		h := newRouteHandler(t, config.Route{Moderation: &config.ModerationPolicy{Patterns: patterns}}, nil)
+		resp, data := moderatedReply(t, h, "nothing to see")
+		if resp.StatusCode != http.StatusOK || replyContent(data) != "nothing to see" || data["moderation"] != nil {
+			t.Fatalf("status = %d, body = %v, want reply unchanged", resp.StatusCode, data)
+		}
+	})
+}
+
+func TestModerationEndpoint(t *testing.T) {
+	var inputs []string
+	classifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		input, _ := req["input"].(string)
+		inputs = append(inputs, input)
+		if r.Header.Get("Authorization") != "Bearer k" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		flagged := strings.Contains(input, "bad")
+		json.NewEncoder(w).Encode(map[string]any{"results": []any{map[string]any{
+			"flagged":    flagged,
+			"categories": map[string]any{"harassment": flagged, "violence": false},
+		}}})
+	}))
+	defer classifier.Close()
+
+	h := newRouteHandler(t, config.Route{Moderation: &config.ModerationPolicy{
+		Endpoint: classifier.URL,
+		Headers:  map[string]string{"Authorization": "Bearer k"},
+		Action:   config.ModerationAnnotate,
+	}}, nil)
+	_, data := moderatedReply(t, h, "a bad reply")
+	verdict, _ := data["moderation"].(map[string]any)
+	if replyContent(data) != "a bad reply" || verdict["flagged"] != true || verdict["categories"].([]any)[0] != "harassment" {
+		t.Fatalf("body = %v, want reply annotated with harassment", data)
+	}
+
+	// Streams are classified once, on the final chunk
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(`{"model":"m","stream":true}`))
+	h.ModifyRequest(req)
+	upstream := `data: {"choices":[{"delta":{"content":"a b"},"finish_reason":null}]}
+
+data: {"choices":[{"delta":{"content":"ad one"},"finish_reason":"stop"}]}
+
+data: [DONE]
+`
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(upstream)),
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"moderation":{"categories":["harassment"],"flagged":true}`) {
+		t.Fatalf("stream = %s, want final chunk annotated", body)
+	}
+	if inputs[len(inputs)-1] != "a bad one" {
+		t.Fatalf("classifier inputs = %q, want the whole streamed text last", inputs)
+	}
+}
+
+func TestModerationBlocksStreamOnPatternMatch(t *testing.T) {
+	h := newRouteHandler(t, config.Route{Moderation: &config.ModerationPolicy{Patterns: newPatternField("forbidden")}}, nil)
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(`{"model":"m","stream":true}`))
+	h.ModifyRequest(req)
+
+	upstream := `data: {"choices":[{"delta":{"content":"this is forb"},"finish_reason":null}]}
+
+data: {"choices":[{"delta":{"content":"idden text"},"finish_reason":null}]}
+
+data: {"choices":[{"delta":{"content":" and more"},"finish_reason":"stop"}]}
+
+data: [DONE]
+`
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(upstream)),
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "idden") || strings.Contains(string(body), "and more") {
+		t.Fatalf("stream = %s, want content after the match dropped", body)
+	}
+	if strings.Contains(string(body), `"finish_reason":"stop"`) || !strings.Contains(string(body), `"finish_reason":"content_filter"`) {
+		t.Fatalf("stream = %s, want finish_reason content_filter", body)
+	}
+}
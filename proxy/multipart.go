@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// multipartForm keeps a multipart/form-data body so its text fields can be edited as a
+// map and the body rebuilt with file parts copied byte for byte
+type multipartForm struct {
+	boundary string
+	parts    []formPart // In original order
+}
+
+type formPart struct {
+	name   string
+	header textproto.MIMEHeader
+	data   []byte
+	file   bool
+}
+
+// parseMultipart reads a multipart/form-data body. Text fields become strings (a list when
+// repeated); file parts become {filename, content_type, size} so routes can match on them.
+func parseMultipart(contentType string, body []byte) (*multipartForm, map[string]any, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return nil, nil, false
+	}
+
+	form := &multipartForm{boundary: params["boundary"]}
+	data := make(map[string]any)
+	reader := multipart.NewReader(bytes.NewReader(body), form.boundary)
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, false
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, nil, false
+		}
+		p := formPart{name: part.FormName(), header: part.Header, data: content, file: part.FileName() != ""}
+		form.parts = append(form.parts, p)
+		if p.name == "" {
+			continue
+		}
+
+		if p.file {
+			data[p.name] = map[string]any{
+				"filename":     part.FileName(),
+				"content_type": part.Header.Get("Content-Type"),
+				"size":         float64(len(content)),
+			}
+			continue
+		}
+		switch existing := data[p.name].(type) {
+		case nil:
+			data[p.name] = string(content)
+		case []any:
+			data[p.name] = append(existing, string(content))
+		default:
+			data[p.name] = []any{existing, string(content)}
+		}
+	}
+	return form, data, true
+}
+
+// formValue renders an edited field as form text
+func formValue(v any) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64, int, int64, bool:
+		return fmt.Sprint(value)
+	}
+	encoded, _ := json.Marshal(v)
+	return string(encoded)
+}
+
+// encode rebuilds the body from edited fields with the original boundary. File parts are
+// written unchanged unless their field was deleted; new fields are appended in sorted order.
+func (f *multipartForm) encode(data map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.SetBoundary(f.boundary); err != nil {
+		return nil, err
+	}
+
+	writeField := func(name string, value any) error {
+		values, ok := value.([]any)
+		if !ok {
+			values = []any{value}
+		}
+		for _, v := range values {
+			if err := w.WriteField(name, formValue(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	written := make(map[string]bool)
+	for _, p := range f.parts {
+		value, ok := data[p.name]
+		if p.name != "" && !ok {
+			continue
+		}
+		if p.file || p.name == "" {
+			pw, err := w.CreatePart(p.header)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := pw.Write(p.data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if written[p.name] {
+			continue
+		}
+		written[p.name] = true
+		if err := writeField(p.name, value); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(data)) {
+		if f.has(name) {
+			continue
+		}
+		if err := writeField(name, data[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *multipartForm) has(name string) bool {
+	for _, p := range f.parts {
+		if p.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// limitFiles applies the first matched file policy to a multipart form
+func (h *Handler) limitFiles(e *requestEdit) {
+	if e.form == nil {
+		return
+	}
+	rule := e.firstRoute(func(r *config.Route) bool { return r.Files != nil })
+	if rule == nil {
+		return
+	}
+	if rejection := enforceFilePolicy(e.form, rule.Files); rejection != nil {
+		logger.Info("Rejected oversized file upload", "method", e.method, "path", e.path, "limit", rule.Files.MaxBytes)
+		e.route.rejection = rejection
+	}
+}
+
+// enforceFilePolicy rejects forms with a file part over the policy's size limit
+func enforceFilePolicy(form *multipartForm, policy *config.FilePolicy) *Rejection {
+	for _, p := range form.parts {
+		if p.file && int64(len(p.data)) > policy.MaxBytes {
+			return &Rejection{
+				Status:  http.StatusRequestEntityTooLarge,
+				Type:    "invalid_request_error",
+				Code:    "file_too_large",
+				Message: fmt.Sprintf("file %q exceeds the %d-byte limit", p.name, policy.MaxBytes),
+			}
+		}
+	}
+	return nil
+}
+
+// isMultipartForm reports whether a request carries a multipart/form-data body
+func isMultipartForm(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), "multipart/form-data")
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// audioFile is binary content with CRLFs and dashes that must survive re-encoding
+var audioFile = []byte("RIFF\x00\x01\r\n--not-a-boundary\r\n\xff\xfe")
+
+func newAudioRequest(t *testing.T, fields map[string]string) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	fw, _ := w.CreateFormFile("file", "clip.wav")
+	fw.Write(audioFile)
+	w.Close()
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/audio/transcriptions", &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func readAudioForm(t *testing.T, req *http.Request) *multipart.Form {
+	t.Helper()
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("content type: %v", err)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if req.ContentLength != int64(len(body)) {
+		t.Fatalf("ContentLength = %d, body is %d bytes", req.ContentLength, len(body))
+	}
+	form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("read form: %v", err)
+	}
+	return form
+}
+
+func TestMultipartFieldsAreMatchedAndRewritten(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods: newPatternField("POST"),
+		Paths:   newPatternField("^/v1/audio/transcriptions$"),
+		OnRequest: []config.Action{{
+			When:    &config.BoolExpr{Body: map[string]config.PatternField{"model": newPatternField("^whisper-1$")}},
+			Merge:   map[string]any{"model": "large-v3", "temperature": 0},
+			Default: map[string]any{"response_format": "verbose_json"},
+		}},
+	}})
+	cfg.Proxies[0].Models.Aliases = map[string]string{"whisper": "whisper-1"}
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	req := newAudioRequest(t, map[string]string{"model": "whisper", "language": "en"})
+	NewHandler(cfg.Proxies[0]).ModifyRequest(req)
+
+	form := readAudioForm(t, req)
+	want := map[string]string{"model": "large-v3", "language": "en", "temperature": "0", "response_format": "verbose_json"}
+	for k, v := range want {
+		if got := form.Value[k]; len(got) != 1 || got[0] != v {
+			t.Errorf("field %s = %v, want %s", k, got, v)
+		}
+	}
+	files := form.File["file"]
+	if len(files) != 1 || files[0].Filename != "clip.wav" {
+		t.Fatalf("file parts = %v, want clip.wav", files)
+	}
+	f, _ := files[0].Open()
+	content, _ := io.ReadAll(f)
+	if !bytes.Equal(content, audioFile) {
+		t.Fatalf("file content changed: %q", content)
+	}
+}
+
+func TestMultipartFileLimit(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods: newPatternField("POST"),
+		Paths:   newPatternField("^/v1/audio/"),
+		Files:   &config.FilePolicy{MaxBytes: 8},
+	}})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	req := newAudioRequest(t, map[string]string{"model": "whisper-1"})
+	NewHandler(cfg.Proxies[0]).ModifyRequest(req)
+	resp, err := NewTransport(http.DefaultTransport).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || !strings.Contains(string(body), "file_too_large") {
+		t.Fatalf("status = %d, body = %s, want 413 file_too_large", resp.StatusCode, body)
+	}
+}
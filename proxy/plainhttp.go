@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// WithPlainHTTP answers requests that reached a TLS listener without TLS, per plain_http:
+// redirected (308) to the https:// URL, or refused with a 400 naming it. Served requests
+// pass through unchanged.
+func WithPlainHTTP(next http.Handler, mode string) http.Handler {
+	if mode == "" || mode == config.PlainHTTPServe {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.TLS != nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+		target := "https://" + req.Host + req.URL.RequestURI()
+		logger.Debug("Plain HTTP sent to a TLS listener", "method", req.Method, "path", req.URL.Path, "plain_http", mode)
+		if mode == config.PlainHTTPRedirect {
+			http.Redirect(w, req, target, http.StatusPermanentRedirect)
+			return
+		}
+
+		rej := &Rejection{
+			Status:  http.StatusBadRequest,
+			Type:    "invalid_request_error",
+			Code:    "https_required",
+			Message: "this port serves HTTPS; retry with " + target,
+		}
+		rej.write(w, http.Header{"Connection": {"close"}})
+	})
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestWithPlainHTTP(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name     string
+		mode     string
+		tls      bool
+		want     int
+		location string
+		body     string
+	}{
+		{name: "redirect", mode: config.PlainHTTPRedirect, want: http.StatusPermanentRedirect, location: "https://proxy.local:8443/v1/models?x=1"},
+		{name: "error", mode: config.PlainHTTPError, want: http.StatusBadRequest, body: "retry with https://proxy.local:8443/v1/models?x=1"},
+		{name: "serve", mode: config.PlainHTTPServe, want: http.StatusNoContent},
+		{name: "TLS passes", mode: config.PlainHTTPRedirect, tls: true, want: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://proxy.local:8443/v1/models?x=1", nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			rec := httptest.NewRecorder()
+			WithPlainHTTP(next, tt.mode).ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if got := rec.Header().Get("Location"); got != tt.location {
+				t.Errorf("Location = %q, want %q", got, tt.location)
+			}
+			if !strings.Contains(rec.Body.String(), tt.body) {
+				t.Errorf("body = %s, want %q", rec.Body, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maxPooledBuffer keeps one large body from pinning its memory in the pool
+const maxPooledBuffer = 1 << 20
+
+// scanBufferSize is the initial line buffer for streams; lines can grow it to 1MB
+const scanBufferSize = 64 * 1024
+
+var (
+	bufferPool     = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+	scanBufferPool = sync.Pool{New: func() any { b := make([]byte, scanBufferSize); return &b }}
+	headerMapPool  = sync.Pool{New: func() any { return make(map[string]string, 16) }}
+)
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+	b.Reset()
+	bufferPool.Put(b)
+}
+
+// readBody is io.ReadAll into a pooled buffer, so the body is allocated once at its final
+// size instead of doubling up to it
+func readBody(r io.Reader) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	_, err := buf.ReadFrom(r)
+	return bytes.Clone(buf.Bytes()), err
+}
+
+// headerValues maps each lowercased header name to its first value, for when matching.
+// Names are normalized here once so conditions look them up directly. Return the map
+// with releaseHeaderValues once nothing refers to it.
+func headerValues(h http.Header) map[string]string {
+	m := headerMapPool.Get().(map[string]string)
+	for key, values := range h {
+		if len(values) > 0 {
+			m[strings.ToLower(key)] = values[0]
+		}
+	}
+	return m
+}
+
+func releaseHeaderValues(m map[string]string) {
+	clear(m)
+	headerMapPool.Put(m)
+}
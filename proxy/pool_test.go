@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeaderValuesReusesClearedMaps(t *testing.T) {
+	m := headerValues(http.Header{"Authorization": {"Bearer a", "Bearer b"}, "X-Empty": {}})
+	if len(m) != 1 || m["authorization"] != "Bearer a" {
+		t.Fatalf("headerValues = %v, want the first Authorization value only, under a lowercase name", m)
+	}
+	releaseHeaderValues(m)
+
+	m = headerValues(http.Header{"Accept": {"*/*"}})
+	defer releaseHeaderValues(m)
+	if len(m) != 1 || m["accept"] != "*/*" {
+		t.Fatalf("headerValues = %v, want only Accept after reuse", m)
+	}
+}
+
+func TestReadBodyCopiesOutOfPool(t *testing.T) {
+	first, err := readBody(strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A second read reuses the pooled buffer; the first body must not change
+	readBody(strings.NewReader(`{"b":2}`))
+	if string(first) != `{"a":1}` {
+		t.Fatalf("first body = %s, changed by a later read", first)
+	}
+}
+
+func BenchmarkModifyRequestPassthrough(b *testing.B) {
+	h := NewHandler(newTestConfig("http://localhost:8080", nil).Proxies[0])
+	body := []byte(`{"model":"m","messages":[{"role":"user","content":"hello there"}],"stream":true}`)
+	b.ReportAllocs()
+	for b.Loop() {
+		req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		h.ModifyRequest(req)
+		io.Copy(io.Discard, req.Body)
+	}
+}
+
+func BenchmarkStreamPassthrough(b *testing.B) {
+	var stream strings.Builder
+	for range 200 {
+		stream.WriteString(`data: {"choices":[{"index":0,"delta":{"content":"token"}}]}` + "\n\n")
+	}
+	stream.WriteString("data: [DONE]\n\n")
+	b.ReportAllocs()
+	for b.Loop() {
+		resp := &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:       io.NopCloser(strings.NewReader(stream.String())),
+			Request:    &http.Request{Method: "POST", URL: mustParseURL("/v1/chat/completions")},
+		}
+		modifyStreamingResponse(resp, nil, nil, streamOptions{})
+		io.Copy(io.Discard, resp.Body)
+	}
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"bytes"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/translate"
+)
+
+// renderPrompt turns a chat request into a /completion request with the first matched
+// prompt template. Translated requests are left alone.
+func (h *Handler) renderPrompt(e *requestEdit) {
+	if !e.json || e.route.rejection != nil {
+		return
+	}
+	rule := e.firstRoute(func(r *config.Route) bool { return r.Prompt != nil && r.Compiled != nil })
+	if rule == nil {
+		return
+	}
+	if e.route.profile != nil {
+		logger.Info("Skipped prompt template for translated request", "format", e.route.profile.Name)
+		return
+	}
+	completion, err := renderCompletion(e.data, rule.Compiled)
+	if err != nil {
+		logger.Error("Failed to render prompt template", "method", e.method, "path", e.path, "err", err)
+		return
+	}
+	if completion == nil {
+		return
+	}
+	e.data = completion
+	e.modified = true
+	e.route.profile = translate.Completion
+	if !e.rewritten {
+		e.req.URL.Path = translate.Completion.TargetPath
+	}
+	logger.Debug("Rendered chat prompt", "model", e.data["model"], "target_path", e.req.URL.Path)
+}
+
+// renderCompletion renders a chat request with the route's template for its model and
+// returns the equivalent /completion request. Models without a template return nil.
+func renderCompletion(data map[string]any, compiled *config.CompiledRoute) (map[string]any, error) {
+	model, _ := data["model"].(string)
+	prompt, ok := compiled.Prompts[model]
+	if !ok {
+		if prompt, ok = compiled.Prompts[""]; !ok {
+			return nil, nil
+		}
+	}
+
+	messages, _ := data["messages"].([]any)
+	var buf bytes.Buffer
+	if err := prompt.Template.Execute(&buf, map[string]any{
+		"Messages": translate.ChatMessages(messages),
+		"Model":    model,
+	}); err != nil {
+		return nil, err
+	}
+	return translate.ChatToCompletion(data, buf.String(), prompt.Stop), nil
+}
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// Fields backends use for reasoning output
+var reasoningFields = []string{"reasoning_content", "reasoning", "thinking"}
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// reasoningNormalizer applies a reasoning policy to replies. Streams keep state across
+// chunks, since <think> tags can be split between deltas.
+type reasoningNormalizer struct {
+	policy  *config.ReasoningPolicy
+	inThink bool
+	pending string // Partial tag held back until the next delta
+}
+
+func newReasoningNormalizer(routes []*config.Route) *reasoningNormalizer {
+	for _, route := range routes {
+		if route != nil && route.Reasoning != nil {
+			return &reasoningNormalizer{policy: route.Reasoning}
+		}
+	}
+	return nil
+}
+
+// apply normalizes an OpenAI (choices[].message or choices[].delta) or Ollama (message)
+// reply or streamed chunk. It reports whether data was modified.
+func (n *reasoningNormalizer) apply(data map[string]any, streaming bool) bool {
+	modified := false
+	for _, c := range asSlice(data["choices"]) {
+		choice, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		if msg, ok := choice["message"].(map[string]any); ok && n.message(msg) {
+			modified = true
+		}
+		if delta, ok := choice["delta"].(map[string]any); ok && n.delta(delta, choice["finish_reason"] != nil) {
+			modified = true
+		}
+	}
+	if msg, ok := data["message"].(map[string]any); ok {
+		// Ollama streams every chunk as a message; done marks the last one
+		if streaming {
+			modified = n.delta(msg, data["done"] == true) || modified
+		} else {
+			modified = n.message(msg) || modified
+		}
+	}
+	return modified
+}
+
+// takeFields removes every reasoning field from msg and returns their combined text
+func takeFields(msg map[string]any) (string, bool) {
+	var parts []string
+	found := false
+	for _, field := range reasoningFields {
+		v, ok := msg[field]
+		if !ok {
+			continue
+		}
+		found = true
+		delete(msg, field)
+		if text, _ := v.(string); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n"), found
+}
+
+// message normalizes a complete reply message, including inline <think> blocks. A closing
+// tag without an opening one (the template opened it in the prompt) marks everything
+// before it as reasoning.
+func (n *reasoningNormalizer) message(msg map[string]any) bool {
+	reasoning, modified := takeFields(msg)
+
+	if content, ok := msg["content"].(string); ok && strings.Contains(content, thinkClose) {
+		var thoughts []string
+		var rest strings.Builder
+		for {
+			end := strings.Index(content, thinkClose)
+			if end < 0 {
+				rest.WriteString(content)
+				break
+			}
+			start := strings.Index(content[:end], thinkOpen)
+			if start < 0 {
+				thoughts = append(thoughts, content[:end])
+			} else {
+				rest.WriteString(content[:start])
+				thoughts = append(thoughts, content[start+len(thinkOpen):end])
+			}
+			content = content[end+len(thinkClose):]
+		}
+		if reasoning != "" {
+			thoughts = append([]string{reasoning}, thoughts...)
+		}
+		reasoning = strings.TrimSpace(strings.Join(thoughts, "\n"))
+		msg["content"] = strings.TrimLeft(rest.String(), "\n ")
+		modified = true
+	}
+
+	if n.policy.Mode == config.ReasoningField && reasoning != "" {
+		msg[n.policy.Field] = reasoning
+	}
+	return modified
+}
+
+// delta normalizes one streamed delta. final flushes any partial tag held back.
+func (n *reasoningNormalizer) delta(delta map[string]any, final bool) bool {
+	reasoning, modified := takeFields(delta)
+
+	if content, ok := delta["content"].(string); ok && (content != "" || n.pending != "") {
+		text, thought := n.split(content, final)
+		if text != content || thought != "" {
+			modified = true
+		}
+		delta["content"] = text
+		reasoning += thought
+	}
+
+	if n.policy.Mode == config.ReasoningField && reasoning != "" {
+		delta[n.policy.Field] = reasoning
+	}
+	return modified
+}
+
+// split separates streamed content into reply text and reasoning, tracking <think> blocks
+func (n *reasoningNormalizer) split(text string, final bool) (content, reasoning string) {
+	text = n.pending + text
+	n.pending = ""
+	var out, thought strings.Builder
+	emit := func(s string) {
+		if n.inThink {
+			thought.WriteString(s)
+		} else {
+			out.WriteString(s)
+		}
+	}
+
+	for text != "" {
+		tag := thinkOpen
+		if n.inThink {
+			tag = thinkClose
+		}
+		if i := strings.Index(text, tag); i >= 0 {
+			emit(text[:i])
+			n.inThink = !n.inThink
+			text = text[i+len(tag):]
+			continue
+		}
+		keep := 0
+		if !final {
+			keep = partialTagSuffix(text, tag)
+		}
+		emit(text[:len(text)-keep])
+		n.pending = text[len(text)-keep:]
+		break
+	}
+	return out.String(), thought.String()
+}
+
+// partialTagSuffix returns the length of the longest suffix of text that begins tag
+func partialTagSuffix(text, tag string) int {
+	for k := min(len(tag)-1, len(text)); k > 0; k-- {
+		if strings.HasSuffix(text, tag[:k]) {
+			return k
+		}
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestReasoningNormalizerMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    config.ReasoningPolicy
+		msg       map[string]any
+		content   string
+		reasoning any
+	}{
+		{
+			name:      "field renamed",
+			policy:    config.ReasoningPolicy{Mode: config.ReasoningField, Field: "reasoning_content"},
+			msg:       map[string]any{"content": "4", "reasoning": "2+2"},
+			content:   "4",
+			reasoning: "2+2",
+		},
+		{
+			name:      "inline think tags",
+			policy:    config.ReasoningPolicy{Mode: config.ReasoningField, Field: "reasoning_content"},
+			msg:       map[string]any{"content": "<think>2+2</think>\n\n4"},
+			content:   "4",
+			reasoning: "2+2",
+		},
+		{
+			name:      "closing tag only",
+			policy:    config.ReasoningPolicy{Mode: config.ReasoningField, Field: "reasoning_content"},
+			msg:       map[string]any{"content": "2+2\n</think>\n4"},
+			content:   "4",
+			reasoning: "2+2",
+		},
+		{
+			name:      "stripped",
+			policy:    config.ReasoningPolicy{Mode: config.ReasoningStrip},
+			msg:       map[string]any{"content": "<think>2+2</think>4", "thinking": "hmm"},
+			content:   "4",
+			reasoning: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &reasoningNormalizer{policy: &tt.policy}
+			n.apply(map[string]any{"choices": []any{map[string]any{"message": tt.msg}}}, false)
+			if tt.msg["content"] != tt.content || tt.msg["reasoning_content"] != tt.reasoning {
+				t.Fatalf("message = %v, want content %q and reasoning %v", tt.msg, tt.content, tt.reasoning)
+			}
+			for _, field := range []string{"reasoning", "thinking"} {
+				if _, ok := tt.msg[field]; ok {
+					t.Fatalf("%s should be removed: %v", field, tt.msg)
+				}
+			}
+		})
+	}
+}
+
+func TestReasoningNormalizerSplitsTagsAcrossDeltas(t *testing.T) {
+	n := &reasoningNormalizer{policy: &config.ReasoningPolicy{Mode: config.ReasoningStrip}}
+
+	var content strings.Builder
+	for _, piece := range []string{"<th", "ink>let me", " think</thi", "nk>The answer", " is 4<"} {
+		delta := map[string]any{"content": piece}
+		n.delta(delta, false)
+		content.WriteString(delta["content"].(string))
+	}
+	final := map[string]any{"content": ""}
+	n.delta(final, true)
+	content.WriteString(final["content"].(string))
+
+	if content.String() != "The answer is 4<" {
+		t.Fatalf("content = %q", content.String())
+	}
+}
+
+func TestModifyResponseStripsStreamedReasoning(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:   newPatternField("POST"),
+		Paths:     newPatternField("^/v1/chat/completions$"),
+		Reasoning: &config.ReasoningPolicy{Mode: config.ReasoningStrip},
+	}})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	routes := cfg.Proxies[0].Routes
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(`{"model":"m","stream":true}`))
+	ModifyRequest(req, routes)
+
+	upstream := `data: {"choices":[{"delta":{"reasoning_content":"secret"},"finish_reason":null}]}
+
+data: {"choices":[{"delta":{"content":"hi"},"finish_reason":"stop"}]}
+
+data: [DONE]
+`
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(upstream)),
+	}
+	if err := ModifyResponse(resp, routes); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "secret") || !strings.Contains(string(body), `"content":"hi"`) {
+		t.Fatalf("unexpected stream: %s", body)
+	}
+}
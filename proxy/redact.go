@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+)
+
+// redactionsFromContext returns the placeholders to restore in replies, if any
+func redactionsFromContext(ctx context.Context) map[string]string {
+	if v, ok := ctx.Value(routeContextKey).(*responseRouteContext); ok && v != nil {
+		return v.redactions
+	}
+	return nil
+}
+
+// newPlaceholderRestorer returns a function that puts redacted text back into every string
+// of a reply or streamed chunk, or nil when nothing was redacted. A placeholder split
+// across stream chunks is left as is.
+func newPlaceholderRestorer(redactions map[string]string) func(map[string]any) bool {
+	if len(redactions) == 0 {
+		return nil
+	}
+	pairs := make([]string, 0, 2*len(redactions))
+	for placeholder, original := range redactions {
+		pairs = append(pairs, placeholder, original)
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	var restore func(v any) (any, bool)
+	restore = func(v any) (any, bool) {
+		switch val := v.(type) {
+		case string:
+			if !strings.Contains(val, "[") {
+				return val, false
+			}
+			out := replacer.Replace(val)
+			return out, out != val
+		case map[string]any:
+			changed := false
+			for k, item := range val {
+				if out, ok := restore(item); ok {
+					val[k] = out
+					changed = true
+				}
+			}
+			return val, changed
+		case []any:
+			changed := false
+			for i, item := range val {
+				if out, ok := restore(item); ok {
+					val[i] = out
+					changed = true
+				}
+			}
+			return val, changed
+		}
+		return v, false
+	}
+
+	return func(data map[string]any) bool {
+		_, changed := restore(data)
+		return changed
+	}
+}
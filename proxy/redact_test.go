@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestRedactedTextIsRestoredInReplies(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods: newPatternField("POST"),
+		Paths:   newPatternField("^/v1/chat/completions$"),
+		OnRequest: []config.Action{{
+			Redact: &config.RedactPolicy{Patterns: []string{"email"}, Restore: true},
+		}},
+	}})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	routes := cfg.Proxies[0].Routes
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		strings.NewReader(`{"model":"m","messages":[{"role":"user","content":"Email ada@example.com"}]}`))
+	ModifyRequest(req, routes)
+
+	sent, _ := io.ReadAll(req.Body)
+	if strings.Contains(string(sent), "ada@example.com") || !strings.Contains(string(sent), "[EMAIL_1]") {
+		t.Fatalf("upstream body = %s, want email replaced", sent)
+	}
+
+	reply := `{"choices":[{"message":{"role":"assistant","content":"Sent to [EMAIL_1]."}}]}`
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader([]byte(reply))),
+	}
+	if err := ModifyResponse(resp, routes); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	content := data["choices"].([]any)[0].(map[string]any)["message"].(map[string]any)["content"]
+	if content != "Sent to ada@example.com." {
+		t.Fatalf("content = %q, want placeholder restored", content)
+	}
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Rejection is an error response the proxy answers with instead of contacting the backend
+type Rejection struct {
+	Status  int
+	Type    string
+	Code    string
+	Message string
+	Details []string // Individual problems, ex: each schema validation error
+}
+
+// Error reports the rejection's message, so transformers can return it (see Transformer)
+func (r *Rejection) Error() string {
+	return r.Message
+}
+
+func (r *Rejection) body() []byte {
+	errBody := map[string]any{"message": r.Message, "type": r.Type}
+	if r.Code != "" {
+		errBody["code"] = r.Code
+	}
+	if len(r.Details) > 0 {
+		errBody["details"] = r.Details
+	}
+	encoded, _ := json.Marshal(map[string]any{"error": errBody})
+	return encoded
+}
+
+// write answers w with the rejection, adding extra headers (ex: Retry-After)
+func (r *Rejection) write(w http.ResponseWriter, extra http.Header) {
+	body := r.body()
+	for k, v := range extra {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(r.Status)
+	w.Write(body)
+}
+
+func rejectionFromRequest(req *http.Request) *Rejection {
+	if v, ok := req.Context().Value(routeContextKey).(*responseRouteContext); ok && v != nil {
+		return v.rejection
+	}
+	return nil
+}
+
+type rejectingTransport struct {
+	base http.RoundTripper
+}
+
+// NewTransport wraps base so requests rejected by ModifyRequest, and OPTIONS requests to
+// routes with an options reply, are answered locally, replies are bounded by their route's
+// timeouts, context overflows are retried once, n > 1 requests are fanned out where routes
+// emulate it, oversized embedding batches are split across several upstream calls, and
+// calls that fail with transient transport errors are resent under the proxy's retry policy
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	return &rejectingTransport{base: &timeoutTransport{base: &overflowRetryTransport{base: &fanOutTransport{base: &batchingTransport{base: &timingTransport{base: &resendTransport{base: base}}}}}}}
+}
+
+func (t *rejectingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if v, ok := req.Context().Value(routeContextKey).(*responseRouteContext); ok && v != nil && v.options != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return optionsResponse(req, v.options), nil
+	}
+	rej := rejectionFromRequest(req)
+	if rej == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	body := rej.body()
+	return &http.Response{
+		Status:     strconv.Itoa(rej.Status) + " " + http.StatusText(rej.Status),
+		StatusCode: rej.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Content-Type":   []string{"application/json"},
+			"Content-Length": []string{strconv.Itoa(len(body))},
+		},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
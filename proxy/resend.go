@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// resendFromRequest returns the retry policy ModifyRequest chose for req, if any, and
+// whether its body is buffered so it can be sent again
+func resendFromRequest(req *http.Request) (*config.RetryPolicy, bool) {
+	if v, ok := req.Context().Value(routeContextKey).(*responseRouteContext); ok && v != nil {
+		return v.resend, v.rewindable
+	}
+	return nil, false
+}
+
+// isTransientError reports whether err means the backend dropped or refused the connection,
+// as during a restart, rather than timing out or the client going away
+func isTransientError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+type resendTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip resends requests chosen by ModifyRequest after transient transport errors, up
+// to the policy's attempts with doubling backoff. Buffered bodies are replayed each time,
+// and are offered to net/http as GetBody, so a request failed by a pooled connection the
+// backend had already closed is resent on a new one when net/http knows it is safe: nothing
+// was written, or the method is idempotent. A POST the backend may have started on is not.
+func (t *resendTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy, rewindable := resendFromRequest(req)
+	if policy == nil && !rewindable {
+		return t.base.RoundTrip(req)
+	}
+	if policy == nil {
+		policy = &config.RetryPolicy{}
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(req.Context())
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	backoff := policy.Backoff
+	for attempt := 0; ; attempt++ {
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := t.base.RoundTrip(req)
+		if err == nil || attempt >= policy.Attempts || !isTransientError(err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		logger.Info("Retrying request after transport error", "method", req.Method, "path", req.URL.Path, "attempt", attempt+1, "err", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// flakyTransport fails the first failures calls with err, then answers 200, recording the
+// body of every call and the body GetBody would resend
+type flakyTransport struct {
+	failures int
+	err      error
+	bodies   []string
+	rewound  []string
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.GetBody != nil {
+		rewound, _ := req.GetBody()
+		raw, _ := io.ReadAll(rewound)
+		f.rewound = append(f.rewound, string(raw))
+	}
+	body := ""
+	if req.Body != nil {
+		raw, _ := io.ReadAll(req.Body)
+		body = string(raw)
+	}
+	f.bodies = append(f.bodies, body)
+	if len(f.bodies) <= f.failures {
+		return nil, f.err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}")), Request: req}, nil
+}
+
+func TestResendAfterTransportErrors(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods: newPatternField("POST"),
+		Paths:   newPatternField("^/v1/embeddings$"),
+		Retry:   true,
+	}})
+	cfg.Proxies[0].Retry = &config.RetryPolicy{Attempts: 2, Backoff: time.Millisecond}
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+	reset := fmt.Errorf("read tcp: %w", syscall.ECONNRESET)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		failures int
+		err      error
+		wantOK   bool
+		calls    int
+	}{
+		{"GET recovers", "GET", "/v1/models", 2, reset, true, 3},
+		{"GET gives up after attempts", "GET", "/v1/models", 5, reset, false, 3},
+		{"POST is sent once", "POST", "/v1/chat/completions", 1, reset, false, 1},
+		{"marked route replays its body", "POST", "/v1/embeddings", 1, io.EOF, true, 2},
+		{"timeouts are not retried", "GET", "/v1/models", 1, fmt.Errorf("dial: %w", errTimeout{}), false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.method == "POST" {
+				body = strings.NewReader(`{"input":"hi"}`)
+			}
+			req := httptest.NewRequest(tt.method, "http://example.com"+tt.path, body)
+			h.ModifyRequest(req)
+
+			backend := &flakyTransport{failures: tt.failures, err: tt.err}
+			resp, err := NewTransport(backend).RoundTrip(req)
+			if (err == nil) != tt.wantOK {
+				t.Fatalf("err = %v, want success %v", err, tt.wantOK)
+			}
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if len(backend.bodies) != tt.calls {
+				t.Fatalf("calls = %d, want %d", len(backend.bodies), tt.calls)
+			}
+			for _, b := range backend.bodies {
+				if b != backend.bodies[0] {
+					t.Fatalf("bodies = %q, want the same body each time", backend.bodies)
+				}
+			}
+		})
+	}
+}
+
+// errTimeout is a net.Error that timed out
+type errTimeout struct{}
+
+func (errTimeout) Error() string   { return "i/o timeout" }
+func (errTimeout) Timeout() bool   { return true }
+func (errTimeout) Temporary() bool { return true }
+
+func TestResendLeavesStaleConnectionsToNetHTTP(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:   newPatternField("POST"),
+		Paths:     newPatternField(".*"),
+		OnRequest: []config.Action{{Merge: map[string]any{"top_p": 0.9}}},
+	}})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+
+	// The backend may have read a POST before the connection broke, so the proxy doesn't
+	// resend it; net/http does, through GetBody, only when nothing was written
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+	h.ModifyRequest(req)
+	backend := &flakyTransport{failures: 1, err: fmt.Errorf("write tcp: %w", syscall.EPIPE)}
+	if _, err := NewTransport(backend).RoundTrip(req); err == nil {
+		t.Fatal("err = nil, want the broken connection reported")
+	}
+	if len(backend.bodies) != 1 {
+		t.Fatalf("calls = %d, want 1", len(backend.bodies))
+	}
+	if len(backend.rewound) != 1 || backend.rewound[0] != backend.bodies[0] || !strings.Contains(backend.rewound[0], "top_p") {
+		t.Fatalf("GetBody = %q, want the transformed body %q", backend.rewound, backend.bodies)
+	}
+}
@@ -0,0 +1,315 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+)
+
+var dnsChanges = metrics.NewCounter("llama_matchmaker_dns_changes_total", "Target hostname lookups that returned new addresses", "listen", "host")
+
+// familyFallbackDelay is how long a dial waits on the preferred address family before
+// racing the other, as in RFC 8305
+const familyFallbackDelay = 300 * time.Millisecond
+
+// minDNSRefresh keeps records with tiny or zero TTLs from being looked up continuously
+const minDNSRefresh = time.Second
+
+// Resolver re-resolves target hostnames when their DNS records expire, at most dns_refresh
+// apart, and dials the addresses it found, so a backend whose DNS changes is followed
+// without a restart. Dials race IPv4 and IPv6 (happy eyeballs), trying the family that
+// last connected first.
+type Resolver struct {
+	listen   string
+	refresh  time.Duration
+	onChange func() // Called after any host's addresses change, to drop connections to the old ones
+
+	lookup    func(ctx context.Context, host string) ([]netip.Addr, error)
+	lookupTTL func(ctx context.Context, host string) (time.Duration, error)
+	dial      func(ctx context.Context, network, address string) (net.Conn, error)
+
+	mu    sync.Mutex
+	hosts map[string]*resolvedHost
+}
+
+type resolvedHost struct {
+	addrs   []netip.Addr
+	prefer  int       // 4 or 6: the family of the last address that connected; 0 before any has
+	expires time.Time // When addrs are due to be looked up again; zero before the first lookup
+}
+
+// NewResolver resolves the hostnames among targets; IP literals are dialed as they are.
+// dialer connects to the resolved addresses, and onChange runs when any of them change.
+func NewResolver(listen string, targets []*url.URL, refresh time.Duration, dialer *net.Dialer, onChange func()) *Resolver {
+	r := &Resolver{
+		listen:   listen,
+		refresh:  refresh,
+		onChange: onChange,
+		lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+		lookupTTL: lookupTTL,
+		dial:      dialer.DialContext,
+		hosts:     make(map[string]*resolvedHost),
+	}
+	for _, target := range targets {
+		if host := target.Hostname(); host != "" {
+			if _, err := netip.ParseAddr(host); err != nil {
+				r.hosts[host] = &resolvedHost{}
+			}
+		}
+	}
+	return r
+}
+
+// Run resolves every target hostname now, and each again as its records expire, until ctx
+// is done
+func (r *Resolver) Run(ctx context.Context) {
+	for {
+		timer := time.NewTimer(time.Until(r.resolveDue(ctx, time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// resolveDue looks up the hostnames whose records expired by now and returns when the next
+// one expires. A failed lookup keeps the addresses found before, so a DNS outage doesn't
+// take down backends that still answer; it is retried after dns_refresh.
+func (r *Resolver) resolveDue(ctx context.Context, now time.Time) time.Time {
+	r.mu.Lock()
+	var names []string
+	for name, host := range r.hosts {
+		if !host.expires.After(now) {
+			names = append(names, name)
+		}
+	}
+	r.mu.Unlock()
+
+	changed := false
+	for _, name := range names {
+		addrs, err := r.resolve(ctx, name)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("Target hostname lookup failed, keeping previous addresses", "listen", r.listen, "host", name, "err", err)
+			}
+			r.mu.Lock()
+			r.hosts[name].expires = now.Add(r.refresh)
+			r.mu.Unlock()
+			continue
+		}
+		keep := r.keepFor(ctx, name)
+
+		r.mu.Lock()
+		host := r.hosts[name]
+		old := host.addrs
+		if !slices.Equal(old, addrs) {
+			host.addrs = addrs
+		}
+		host.expires = now.Add(keep)
+		r.mu.Unlock()
+
+		if old != nil && !slices.Equal(old, addrs) {
+			changed = true
+			dnsChanges.Add(1, r.listen, name)
+			logger.Info("Target addresses changed", "listen", r.listen, "host", name, "addresses", addrs)
+		}
+	}
+	if changed && r.onChange != nil {
+		r.onChange()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := now.Add(r.refresh)
+	for _, host := range r.hosts {
+		if host.expires.Before(next) {
+			next = host.expires
+		}
+	}
+	return next
+}
+
+// keepFor returns how long name's addresses hold: the TTL of its DNS records, between
+// minDNSRefresh and dns_refresh, or dns_refresh when the nameserver can't say
+func (r *Resolver) keepFor(ctx context.Context, name string) time.Duration {
+	ttl, err := r.lookupTTL(ctx, name)
+	if err != nil {
+		logger.Debug("No DNS TTL for target hostname, using dns_refresh", "listen", r.listen, "host", name, "err", err)
+		return r.refresh
+	}
+	return min(max(ttl, minDNSRefresh), r.refresh)
+}
+
+// resolve returns name's addresses, sorted so lookups returning them in another order
+// don't count as changes
+func (r *Resolver) resolve(ctx context.Context, name string) ([]netip.Addr, error) {
+	addrs, err := r.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range addrs {
+		addrs[i] = addrs[i].Unmap()
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+	return slices.Compact(addrs), nil
+}
+
+// DialContext connects to address, using the resolved addresses when its host is a target
+// hostname. It fits http.Transport.DialContext.
+func (r *Resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	name, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return r.dial(ctx, network, address)
+	}
+	r.mu.Lock()
+	host, ok := r.hosts[name]
+	var addrs []netip.Addr
+	var prefer int
+	if ok {
+		addrs, prefer = host.addrs, host.prefer
+	}
+	r.mu.Unlock()
+	if !ok {
+		return r.dial(ctx, network, address)
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		return r.dial(ctx, network, address)
+	}
+
+	// Dials before the first lookup finishes resolve for themselves
+	if len(addrs) == 0 {
+		if addrs, err = r.resolve(ctx, name); err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		if len(host.addrs) == 0 {
+			host.addrs = addrs
+		}
+		r.mu.Unlock()
+	}
+
+	conn, addr, err := r.dialFamilies(ctx, network, uint16(port), addrs, prefer)
+	if err != nil {
+		return nil, err
+	}
+	if family := addrFamily(addr); family != prefer {
+		logger.Debug("Preferring address family for target", "listen", r.listen, "host", name, "family", "ipv"+strconv.Itoa(family))
+		r.mu.Lock()
+		host.prefer = family
+		r.mu.Unlock()
+	}
+	return conn, nil
+}
+
+type familyDial struct {
+	conn net.Conn
+	addr netip.Addr
+	err  error
+}
+
+// dialFamilies tries the preferred family's addresses in order, starting on the other
+// family's after familyFallbackDelay or once the preferred ones fail. The first connection
+// wins; a later one is closed. Without a preference, the first address's family goes first.
+func (r *Resolver) dialFamilies(ctx context.Context, network string, port uint16, addrs []netip.Addr, prefer int) (net.Conn, netip.Addr, error) {
+	if prefer == 0 {
+		prefer = addrFamily(addrs[0])
+	}
+	var primary, fallback []netip.Addr
+	for _, addr := range addrs {
+		if addrFamily(addr) == prefer {
+			primary = append(primary, addr)
+		} else {
+			fallback = append(fallback, addr)
+		}
+	}
+	if len(primary) == 0 {
+		primary, fallback = fallback, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan familyDial, 2)
+	start := func(addrs []netip.Addr) {
+		go func() {
+			conn, addr, err := r.dialSerial(ctx, network, port, addrs)
+			results <- familyDial{conn, addr, err}
+		}()
+	}
+
+	start(primary)
+	pending := 1
+	var timer <-chan time.Time
+	if len(fallback) > 0 {
+		t := time.NewTimer(familyFallbackDelay)
+		defer t.Stop()
+		timer = t.C
+	}
+	var firstErr error
+	for {
+		select {
+		case <-timer:
+			timer = nil
+			start(fallback)
+			fallback = nil
+			pending++
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				if pending > 0 {
+					go func() {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}()
+				}
+				return result.conn, result.addr, nil
+			}
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			if fallback != nil {
+				timer = nil
+				start(fallback)
+				fallback = nil
+				pending++
+			} else if pending == 0 {
+				return nil, netip.Addr{}, firstErr
+			}
+		}
+	}
+}
+
+// dialSerial tries addrs one at a time, returning the first connection
+func (r *Resolver) dialSerial(ctx context.Context, network string, port uint16, addrs []netip.Addr) (net.Conn, netip.Addr, error) {
+	var err error
+	for _, addr := range addrs {
+		var conn net.Conn
+		if conn, err = r.dial(ctx, network, netip.AddrPortFrom(addr, port).String()); err == nil {
+			return conn, addr, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, netip.Addr{}, err
+}
+
+func addrFamily(addr netip.Addr) int {
+	if addr.Is4() {
+		return 4
+	}
+	return 6
+}
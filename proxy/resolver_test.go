@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNetwork answers lookups from a table and records dials, failing those to down addresses.
+// Records have no TTL unless ttl is set.
+type fakeNetwork struct {
+	mu      sync.Mutex
+	addrs   []netip.Addr
+	err     error
+	ttl     time.Duration
+	down    map[string]bool
+	dialed  []string
+	lookups int
+}
+
+func (n *fakeNetwork) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lookups++
+	return append([]netip.Addr(nil), n.addrs...), n.err
+}
+
+func (n *fakeNetwork) lookupTTL(ctx context.Context, host string) (time.Duration, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ttl == 0 {
+		return 0, errors.New("no nameserver")
+	}
+	return n.ttl, nil
+}
+
+func (n *fakeNetwork) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.dialed = append(n.dialed, address)
+	if n.down[address] {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+func (n *fakeNetwork) set(addrs ...string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.addrs = nil
+	for _, addr := range addrs {
+		n.addrs = append(n.addrs, netip.MustParseAddr(addr))
+	}
+}
+
+func (n *fakeNetwork) takeDials() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	dialed := n.dialed
+	n.dialed = nil
+	return dialed
+}
+
+func newTestResolver(t *testing.T, network *fakeNetwork, onChange func()) *Resolver {
+	t.Helper()
+	target, _ := url.Parse("http://backend.internal:8080")
+	literal, _ := url.Parse("http://10.0.0.9:8080")
+	r := NewResolver("test", []*url.URL{target, literal}, time.Minute, &net.Dialer{}, onChange)
+	r.lookup = network.lookup
+	r.lookupTTL = network.lookupTTL
+	r.dial = network.dial
+	return r
+}
+
+func TestResolverFollowsAddressChanges(t *testing.T) {
+	network := &fakeNetwork{}
+	network.set("10.0.0.1")
+	changes := 0
+	r := newTestResolver(t, network, func() { changes++ })
+	ctx := context.Background()
+	// Each lookup happens as if the last one's records had expired
+	clock := time.Now()
+	resolveLater := func() {
+		clock = clock.Add(time.Hour)
+		r.resolveDue(ctx, clock)
+	}
+
+	resolveLater()
+	if changes != 0 {
+		t.Fatalf("changes = %d after the first lookup, want 0", changes)
+	}
+	if _, err := r.DialContext(ctx, "tcp", "backend.internal:8080"); err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if got := network.takeDials(); len(got) != 1 || got[0] != "10.0.0.1:8080" {
+		t.Fatalf("dialed %v, want 10.0.0.1:8080", got)
+	}
+
+	network.set("10.0.0.2")
+	resolveLater()
+	if changes != 1 {
+		t.Fatalf("changes = %d, want 1", changes)
+	}
+	r.DialContext(ctx, "tcp", "backend.internal:8080")
+	if got := network.takeDials(); len(got) != 1 || got[0] != "10.0.0.2:8080" {
+		t.Fatalf("dialed %v, want 10.0.0.2:8080", got)
+	}
+
+	// A failed lookup keeps the last addresses
+	network.err = errors.New("no such host")
+	resolveLater()
+	r.DialContext(ctx, "tcp", "backend.internal:8080")
+	if got := network.takeDials(); len(got) != 1 || got[0] != "10.0.0.2:8080" {
+		t.Fatalf("dialed %v after a failed lookup, want 10.0.0.2:8080", got)
+	}
+
+	// IP literals are dialed as they are
+	r.DialContext(ctx, "tcp", "10.0.0.9:8080")
+	if got := network.takeDials(); len(got) != 1 || got[0] != "10.0.0.9:8080" {
+		t.Fatalf("dialed %v, want 10.0.0.9:8080", got)
+	}
+}
+
+func TestResolverPrefersWorkingFamily(t *testing.T) {
+	network := &fakeNetwork{down: map[string]bool{"[fd00::1]:8080": true}}
+	network.set("fd00::1", "10.0.0.1")
+	r := newTestResolver(t, network, nil)
+	ctx := context.Background()
+	r.resolveDue(ctx, time.Now())
+
+	// Addresses sort IPv4 first, so prefer IPv6 to see the fallback
+	r.hosts["backend.internal"].prefer = 6
+	if _, err := r.DialContext(ctx, "tcp", "backend.internal:8080"); err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if got := network.takeDials(); len(got) != 2 || got[0] != "[fd00::1]:8080" || got[1] != "10.0.0.1:8080" {
+		t.Fatalf("dialed %v, want IPv6 then IPv4", got)
+	}
+
+	// The family that connected goes first next time
+	r.DialContext(ctx, "tcp", "backend.internal:8080")
+	if got := network.takeDials(); len(got) != 1 || got[0] != "10.0.0.1:8080" {
+		t.Fatalf("dialed %v, want IPv4 only", got)
+	}
+
+	// Everything down reports the first family's error
+	network.down["10.0.0.1:8080"] = true
+	if _, err := r.DialContext(ctx, "tcp", "backend.internal:8080"); err == nil {
+		t.Fatal("dial succeeded with every address down")
+	}
+}
+
+func TestResolverHonorsRecordTTL(t *testing.T) {
+	network := &fakeNetwork{ttl: 10 * time.Second}
+	network.set("10.0.0.1")
+	r := newTestResolver(t, network, nil)
+	ctx := context.Background()
+	now := time.Now()
+
+	if next := r.resolveDue(ctx, now); !next.Equal(now.Add(10 * time.Second)) {
+		t.Fatalf("next lookup at %v, want the record's 10s TTL", next.Sub(now))
+	}
+
+	// Nothing is looked up before the TTL runs out, and a change is seen right after
+	network.set("10.0.0.2")
+	r.resolveDue(ctx, now.Add(5*time.Second))
+	if network.lookups != 1 {
+		t.Fatalf("lookups = %d before the TTL ran out, want 1", network.lookups)
+	}
+	r.resolveDue(ctx, now.Add(10*time.Second))
+	r.DialContext(ctx, "tcp", "backend.internal:8080")
+	if got := network.takeDials(); len(got) != 1 || got[0] != "10.0.0.2:8080" {
+		t.Fatalf("dialed %v once the TTL ran out, want 10.0.0.2:8080", got)
+	}
+
+	// TTLs are bounded by minDNSRefresh and dns_refresh, which also stands in for a missing one
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{0, time.Minute},
+		{time.Millisecond, minDNSRefresh},
+		{time.Hour, time.Minute},
+	}
+	for _, tt := range tests {
+		network.ttl = tt.ttl
+		later := now.Add(time.Hour)
+		if next := r.resolveDue(ctx, later); next.Sub(later) != tt.want {
+			t.Errorf("TTL %v: next lookup after %v, want %v", tt.ttl, next.Sub(later), tt.want)
+		}
+		now = later
+	}
+}
+
+func TestAnswerTTL(t *testing.T) {
+	query, err := dnsQuery(0x1234, "backend.internal", dnsTypeA)
+	if err != nil {
+		t.Fatalf("dnsQuery: %v", err)
+	}
+	// A CNAME to api.internal (TTL 300), then its address (TTL 30), both named by pointers
+	reply := append([]byte(nil), query...)
+	reply[2] |= 0x80
+	reply[7] = 2
+	reply = append(reply,
+		0xc0, 12, 0, 5, 0, 1, 0, 0, 0x01, 0x2c, 0, 6, 3, 'a', 'p', 'i', 0xc0, 20,
+		0xc0, byte(len(query)+12), 0, 1, 0, 1, 0, 0, 0, 30, 0, 4, 10, 0, 0, 1,
+	)
+	if ttl, ok, err := answerTTL(reply, 0x1234); err != nil || !ok || ttl != 30 {
+		t.Fatalf("answerTTL = %d, %v, %v; want 30", ttl, ok, err)
+	}
+	if _, _, err := answerTTL(reply[:len(reply)-3], 0x1234); err == nil {
+		t.Fatal("answerTTL accepted a truncated reply")
+	}
+	if _, _, err := answerTTL(reply, 0x4321); err == nil {
+		t.Fatal("answerTTL accepted a reply to another query")
+	}
+}
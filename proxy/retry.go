@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/tokens"
+)
+
+// overflowMarkers identify context overflow errors from llama.cpp, Ollama, vLLM, and OpenAI
+var overflowMarkers = []string{
+	"context_length_exceeded",
+	"exceed_context_size",
+	"exceeds the available context size",
+	"maximum context length",
+	"context length",
+	"context window",
+	"prompt is too long",
+	"too many tokens",
+}
+
+// maxErrorBody caps how much of an upstream error is read to recognize overflows
+const maxErrorBody = 64 * 1024
+
+// overflowRetry is how a request is shrunk when the backend reports a context overflow
+type overflowRetry struct {
+	mode   string // truncate or max_tokens
+	window int    // Configured context window; 0 when unknown
+	margin int
+	ollama bool
+}
+
+func overflowRetryFromRequest(req *http.Request) *overflowRetry {
+	if v, ok := req.Context().Value(routeContextKey).(*responseRouteContext); ok && v != nil {
+		return v.retry
+	}
+	return nil
+}
+
+// isContextOverflow reports whether an upstream error body describes a context overflow
+func isContextOverflow(status int, body []byte) bool {
+	if status < http.StatusBadRequest {
+		return false
+	}
+	text := strings.ToLower(string(body))
+	for _, marker := range overflowMarkers {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// overflowCounts reads llama.cpp's n_ctx and n_prompt_tokens from an error body, if present
+func overflowCounts(body []byte) (window, prompt int) {
+	var parsed map[string]any
+	if json.Unmarshal(body, &parsed) != nil {
+		return 0, 0
+	}
+	for _, obj := range []map[string]any{parsed, asMap(parsed["error"])} {
+		if n, ok := obj["n_ctx"].(float64); ok {
+			window = int(n)
+		}
+		if n, ok := obj["n_prompt_tokens"].(float64); ok {
+			prompt = int(n)
+		}
+	}
+	return window, prompt
+}
+
+// shrink returns a smaller request body for the retry, or false when nothing can be cut
+func (r *overflowRetry) shrink(body, errBody []byte) ([]byte, bool) {
+	data, err := decodeBody(body)
+	if err != nil {
+		return nil, false
+	}
+	window, prompt := overflowCounts(errBody)
+	if r.window > 0 {
+		window = r.window
+	}
+
+	switch r.mode {
+	case config.OverflowTruncate:
+		messages, _ := data["messages"].([]any)
+		estimate := tokens.Messages(messages)
+		budget := estimate / 2
+		if window > 0 && prompt > 0 {
+			// Scale the budget by how far the estimate was off from the backend's count
+			budget = (window - r.margin) * estimate / prompt
+		} else if window > 0 {
+			budget = min(window-r.margin, budget)
+		}
+		kept, dropped := truncateMessages(messages, budget)
+		if dropped == 0 {
+			return nil, false
+		}
+		data["messages"] = kept
+		logger.Info("Retrying with truncated messages after context overflow", "dropped", dropped, "budget", budget)
+
+	case config.RetryMaxTokens:
+		available := 0
+		if window > 0 && prompt > 0 {
+			available = window - prompt - r.margin
+		} else if requested := requestedOutputTokens(data, r.ollama); requested > 1 {
+			available = requested / 2
+		}
+		if !fitMaxTokens(data, available, r.ollama) {
+			return nil, false
+		}
+		logger.Info("Retrying with a smaller output limit after context overflow", "limit", available)
+
+	default:
+		return nil, false
+	}
+
+	out, err := encodeBody(data, body, true)
+	return out, err == nil
+}
+
+// requestedOutputTokens returns the client's output limit, or 0 when unset
+func requestedOutputTokens(data map[string]any, ollama bool) int {
+	if ollama {
+		n, _ := asMap(data["options"])["num_predict"].(float64)
+		return int(n)
+	}
+	for _, key := range []string{"max_completion_tokens", "max_tokens"} {
+		if n, ok := data[key].(float64); ok {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+type overflowRetryTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip resends a request once, shrunk, when the backend answers with a context
+// overflow error. Other responses, including the retry's, are returned as is.
+func (t *overflowRetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retry := overflowRetryFromRequest(req)
+	if retry == nil || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < http.StatusBadRequest {
+		return resp, err
+	}
+
+	errBody, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if !isContextOverflow(resp.StatusCode, errBody) {
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(errBody), resp.Body), resp.Body}
+		return resp, nil
+	}
+
+	smaller, ok := retry.shrink(body, errBody)
+	if !ok {
+		logger.Debug("Context overflow retry has nothing to cut", "path", req.URL.Path, "mode", retry.mode)
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(errBody), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(smaller))
+	out.ContentLength = int64(len(smaller))
+	out.Header.Set("Content-Length", strconv.Itoa(len(smaller)))
+	return t.base.RoundTrip(out)
+}
+
+// readCloser pairs a reader with the closer of the body it wraps
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// overflowBackend rejects requests whose body is longer than limit the way llama.cpp does,
+// and records every body it receives
+func overflowBackend(limit int, bodies *[]map[string]any) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		var data map[string]any
+		json.Unmarshal(raw, &data)
+		*bodies = append(*bodies, data)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(raw) > limit {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":400,"message":"the request exceeds the available context size, try increasing it","type":"exceed_context_size_error"}}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+}
+
+func retryRoundTrip(t *testing.T, h *Handler, backend, body string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", bytes.NewBufferString(body))
+	h.ModifyRequest(req)
+	req.URL, _ = url.Parse(backend + "/v1/chat/completions")
+	req.RequestURI = ""
+
+	resp, err := NewTransport(http.DefaultTransport).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	return resp
+}
+
+func TestContextOverflowRetryTruncates(t *testing.T) {
+	var bodies []map[string]any
+	backend := overflowBackend(400, &bodies)
+	defer backend.Close()
+
+	long := strings.Repeat("x", 100)
+	resp := retryRoundTrip(t, newRouteHandler(t, config.Route{Context: &config.ContextPolicy{Retry: config.OverflowTruncate}}, nil), backend.URL,
+		chatBody("system prompt", long+"1", long+"2", long+"3", long+"4"))
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200 after retry", resp.StatusCode)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("backend saw %d requests, want 2", len(bodies))
+	}
+	retried := bodies[1]["messages"].([]any)
+	if len(retried) >= 5 {
+		t.Fatalf("retry kept %d messages, want fewer than 5", len(retried))
+	}
+	if retried[0].(map[string]any)["role"] != "system" || retried[len(retried)-1].(map[string]any)["content"] != long+"4" {
+		t.Fatalf("retry messages = %v, want system prompt and latest message kept", retried)
+	}
+}
+
+func TestContextOverflowRetryUsesBackendCounts(t *testing.T) {
+	var bodies []map[string]any
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]any
+		json.NewDecoder(r.Body).Decode(&data)
+		bodies = append(bodies, data)
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"context length exceeded","n_ctx":4096,"n_prompt_tokens":3000}}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer backend.Close()
+
+	resp := retryRoundTrip(t, newRouteHandler(t, config.Route{Context: &config.ContextPolicy{Retry: config.RetryMaxTokens}}, nil), backend.URL,
+		`{"model":"llama3","max_tokens":2048,"messages":[{"role":"user","content":"hi"}]}`)
+	resp.Body.Close()
+
+	if len(bodies) != 2 || bodies[1]["max_tokens"] != float64(1096) {
+		t.Fatalf("retry bodies = %v, want max_tokens 1096", bodies)
+	}
+}
+
+func TestNonOverflowErrorsAreNotRetried(t *testing.T) {
+	calls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"invalid model"}}`))
+	}))
+	defer backend.Close()
+
+	resp := retryRoundTrip(t, newRouteHandler(t, config.Route{Context: &config.ContextPolicy{Retry: config.OverflowTruncate}}, nil), backend.URL, chatBody("system", "hello"))
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if calls != 1 {
+		t.Fatalf("backend saw %d requests, want 1", calls)
+	}
+	if !strings.Contains(string(body), "invalid model") {
+		t.Fatalf("body = %s, want upstream error passed through", body)
+	}
+}
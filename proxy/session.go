@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+)
+
+var (
+	sessionRequests = metrics.NewCounter("llama_matchmaker_session_requests_total", "Requests carrying a session ID, by turn (first or later)", "listen", "turn")
+	activeSessions  = metrics.NewGauge("llama_matchmaker_active_sessions", "Sessions seen within session.idle, as of the last request carrying one", "listen")
+)
+
+// maxTrackedSessions bounds the sessions a proxy remembers; the quietest is dropped first
+const maxTrackedSessions = 10000
+
+// sessionTracker counts the turns of each conversation seen on a proxy. A session quiet for
+// longer than idle is forgotten, so its next request starts over at turn 1.
+type sessionTracker struct {
+	listen string
+	idle   time.Duration
+
+	mu        sync.Mutex
+	sessions  map[string]*sessionTurns
+	lastPrune time.Time
+}
+
+type sessionTurns struct {
+	turns    int
+	lastSeen time.Time
+}
+
+// SessionID returns the conversation ID ModifyRequest found for req, if any
+func SessionID(req *http.Request) string {
+	if v, ok := req.Context().Value(routeContextKey).(*responseRouteContext); ok && v != nil {
+		return v.session
+	}
+	return ""
+}
+
+func newSessionTracker(listen string, cfg *config.SessionConfig) *sessionTracker {
+	if cfg == nil {
+		return nil
+	}
+	return &sessionTracker{listen: listen, idle: cfg.IdleTimeout(), sessions: make(map[string]*sessionTurns)}
+}
+
+// observe records a request for session id and returns its turn, counting from 1
+func (t *sessionTracker) observe(id string, now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Expired sessions are swept at most once per idle period, or when the table fills
+	if now.Sub(t.lastPrune) >= t.idle || len(t.sessions) >= maxTrackedSessions {
+		t.prune(now)
+	}
+	s, ok := t.sessions[id]
+	if !ok || now.Sub(s.lastSeen) >= t.idle {
+		if !ok && len(t.sessions) >= maxTrackedSessions {
+			t.evictQuietest()
+		}
+		s = &sessionTurns{}
+		t.sessions[id] = s
+	}
+	s.turns++
+	s.lastSeen = now
+
+	turn := "later"
+	if s.turns == 1 {
+		turn = "first"
+	}
+	sessionRequests.Add(1, t.listen, turn)
+	activeSessions.Set(float64(len(t.sessions)), t.listen)
+	return s.turns
+}
+
+func (t *sessionTracker) prune(now time.Time) {
+	for id, s := range t.sessions {
+		if now.Sub(s.lastSeen) >= t.idle {
+			delete(t.sessions, id)
+		}
+	}
+	t.lastPrune = now
+}
+
+func (t *sessionTracker) evictQuietest() {
+	var quietest string
+	var oldest time.Time
+	for id, s := range t.sessions {
+		if quietest == "" || s.lastSeen.Before(oldest) {
+			quietest, oldest = id, s.lastSeen
+		}
+	}
+	delete(t.sessions, quietest)
+}
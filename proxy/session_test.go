@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestSessionTrackerCountsTurns(t *testing.T) {
+	tracker := newSessionTracker("session-test", &config.SessionConfig{Header: "X-Session-ID", Idle: time.Minute})
+	start := time.Now()
+
+	steps := []struct {
+		id    string
+		after time.Duration
+		want  int
+	}{
+		{"a", 0, 1},
+		{"a", 10 * time.Second, 2},
+		{"b", 20 * time.Second, 1},
+		{"a", 30 * time.Second, 3},
+		{"b", 90 * time.Second, 1}, // Idle for over a minute, so it starts over
+	}
+	for _, s := range steps {
+		if got := tracker.observe(s.id, start.Add(s.after)); got != s.want {
+			t.Fatalf("session %s at %v: turn = %d, want %d", s.id, s.after, got, s.want)
+		}
+	}
+	if got := sessionRequests.Value("session-test", "first"); got != 3 {
+		t.Errorf("first turns = %v, want 3", got)
+	}
+	if got := sessionRequests.Value("session-test", "later"); got != 2 {
+		t.Errorf("later turns = %v, want 2", got)
+	}
+}
+
+func TestModifyRequestFindsSession(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:   newPatternField("POST"),
+		Paths:     newPatternField("^/v1/chat/completions$"),
+		OnRequest: []config.Action{{Merge: map[string]any{"temperature": 0.6}}},
+	}})
+	cfg.Proxies[0].Session = &config.SessionConfig{Header: "X-Session-ID", Body: "metadata.conversation_id"}
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+
+	tests := []struct {
+		name, header, body, want string
+	}{
+		{"header", "conv-1", `{"metadata":{"conversation_id":"conv-2"}}`, "conv-1"},
+		{"body path", "", `{"metadata":{"conversation_id":"conv-2"}}`, "conv-2"},
+		{"numeric body", "", `{"metadata":{"conversation_id":42}}`, "42"},
+		{"none", "", `{"messages":[]}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", bytes.NewBufferString(tt.body))
+			if tt.header != "" {
+				req.Header.Set("X-Session-ID", tt.header)
+			}
+			h.ModifyRequest(req)
+			if got := SessionID(req); got != tt.want {
+				t.Fatalf("SessionID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBalancerPinsSessions(t *testing.T) {
+	b := NewAffinityBalancer(8, nil, &config.SessionConfig{Header: "X-Session-ID", Body: "metadata.conversation_id"}, 1024)
+
+	pick := func(header, body string) int {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBufferString(body))
+		if header != "" {
+			req.Header.Set("X-Session-ID", header)
+		}
+		target := b.Pick(req)
+		if rest, _ := io.ReadAll(req.Body); string(rest) != body {
+			t.Fatalf("body after Pick = %q, want it left readable", rest)
+		}
+		return target
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		byHeader := pick(id, `{}`)
+		byBody := pick("", `{"metadata":{"conversation_id":"`+id+`"}}`)
+		if byHeader != byBody {
+			t.Errorf("session %s picked %d by header and %d by body, want the same target", id, byHeader, byBody)
+		}
+	}
+
+	// Requests without a session fall back to round-robin
+	if a, b := pick("", `{}`), pick("", `{}`); a == b {
+		t.Errorf("sessionless picks = %d, %d, want round-robin", a, b)
+	}
+}
@@ -0,0 +1,341 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/health"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+	"github.com/spicyneuron/llama-matchmaker/traffic"
+)
+
+var (
+	slotsTotal  = metrics.NewGauge("llama_matchmaker_slots_total", "Slots reported by a target's /slots endpoint", "target")
+	slotsBusy   = metrics.NewGauge("llama_matchmaker_slots_busy", "Busy slots on a target, polled or in flight through the proxy", "target")
+	targetUp    = metrics.NewGauge("llama_matchmaker_target_up", "Whether a target's /health endpoint reports ready", "target")
+	slotsQueued = metrics.NewGauge("llama_matchmaker_slot_queue_depth", "Requests waiting for a free slot", "listen")
+)
+
+var (
+	errSlotQueueFull    = errors.New("slot queue is full")
+	errSlotQueueTimeout = errors.New("timed out waiting for a free slot")
+)
+
+// targetSlots is what the scheduler knows about one target
+type targetSlots struct {
+	url      string
+	host     string // Matches the outbound request's URL.Host
+	healthy  bool
+	total    int // 0 when the target doesn't report slots
+	busy     int // From the last poll
+	inflight int // Requests sent through this proxy and not yet finished
+}
+
+// free returns the slots available on t, or 0 when it can't take a request. Targets that
+// don't report slots are always available, so they behave as with plain balancing.
+func (t *targetSlots) free() int {
+	if !t.healthy {
+		return 0
+	}
+	if t.total == 0 {
+		return 1 << 20
+	}
+	return t.total - max(t.busy, t.inflight)
+}
+
+// SlotScheduler assigns requests to targets by free llama.cpp slots
+type SlotScheduler struct {
+	name    string
+	cfg     config.SlotsConfig
+	client  *http.Client
+	targets []*targetSlots
+
+	mu                 sync.Mutex
+	waiting            int
+	interactiveWaiting int           // Waiting requests batch ones must let go first
+	batchInflight      int           // Batch requests holding a slot, for slots.batch_share
+	changed            chan struct{} // Closed and replaced whenever slots may have freed up
+}
+
+// NewSlotScheduler creates a scheduler over targets; name labels its queue metric
+func NewSlotScheduler(name string, targets []*url.URL, cfg config.SlotsConfig) *SlotScheduler {
+	s := &SlotScheduler{
+		name:    name,
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Interval},
+		changed: make(chan struct{}),
+	}
+	for _, target := range targets {
+		s.targets = append(s.targets, &targetSlots{url: target.String(), host: target.Host, healthy: true})
+	}
+	return s
+}
+
+// UseTransport sends the scheduler's polls through rt, so they reach the targets the way
+// proxied requests do
+func (s *SlotScheduler) UseTransport(rt http.RoundTripper) {
+	s.client.Transport = rt
+}
+
+// Run polls every target until ctx is done
+func (s *SlotScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		s.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll refreshes health and slot counts for every target
+func (s *SlotScheduler) poll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range s.targets {
+		wg.Add(1)
+		go func(t *targetSlots) {
+			defer wg.Done()
+			healthy := s.fetch(ctx, t.url+"/health", nil) == nil
+
+			var slots []map[string]any
+			total, busy := 0, 0
+			if healthy && s.fetch(ctx, t.url+"/slots", &slots) == nil {
+				total = len(slots)
+				for _, slot := range slots {
+					if slot["is_processing"] == true || slot["state"] == float64(1) {
+						busy++
+					}
+				}
+			}
+
+			s.mu.Lock()
+			if healthy != t.healthy {
+				logger.Info("Target health changed", "target", t.url, "healthy", healthy)
+			}
+			t.healthy, t.total, t.busy = healthy, total, busy
+			traffic.Default.SetUp(t.host, healthy)
+			health.Default.SetUp(s.name, t.url, healthy)
+			s.updateMetrics(t)
+			s.notifyLocked()
+			s.mu.Unlock()
+		}(s.targets[i])
+	}
+	wg.Wait()
+}
+
+// fetch GETs url and decodes its JSON into out when out is non-nil
+func (s *SlotScheduler) fetch(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(out)
+}
+
+func (s *SlotScheduler) updateMetrics(t *targetSlots) {
+	up := 0.0
+	if t.healthy {
+		up = 1
+	}
+	targetUp.Set(up, t.url)
+	slotsTotal.Set(float64(t.total), t.url)
+	slotsBusy.Set(float64(max(t.busy, t.inflight)), t.url)
+}
+
+func (s *SlotScheduler) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// pickLocked returns the preferred target when it has a free slot, otherwise the target
+// with the most free slots, or -1 when none is free
+func (s *SlotScheduler) pickLocked(preferred int) int {
+	if preferred >= 0 && preferred < len(s.targets) && s.targets[preferred].free() > 0 {
+		return preferred
+	}
+	best, bestFree := -1, 0
+	for i, t := range s.targets {
+		if free := t.free(); free > bestFree || (free == bestFree && best >= 0 && t.inflight < s.targets[best].inflight) {
+			best, bestFree = i, free
+		}
+	}
+	return best
+}
+
+// batchAllowedLocked reports whether a batch request may take a slot now: no interactive
+// request is waiting, and batch requests hold less than slots.batch_share of the reported
+// slots. Targets that don't report slots leave the share unbounded.
+func (s *SlotScheduler) batchAllowedLocked() bool {
+	if s.interactiveWaiting > 0 {
+		return false
+	}
+	if s.cfg.BatchShare <= 0 {
+		return true
+	}
+	total := 0
+	for _, t := range s.targets {
+		if t.healthy {
+			total += t.total
+		}
+	}
+	if total == 0 {
+		return true
+	}
+	return s.batchInflight < max(1, int(s.cfg.BatchShare*float64(total)))
+}
+
+// Acquire waits for a free slot and returns its target index with a release function to
+// call once the response is finished. preferred (or -1) is tried first, for affinity.
+// Waiting interactive requests are served before batch ones (see config.PriorityBatch).
+func (s *SlotScheduler) Acquire(ctx context.Context, preferred int, priority string) (int, func(), error) {
+	var timeout <-chan time.Time
+	queued := false
+	batch := priority == config.PriorityBatch
+
+	s.mu.Lock()
+	defer func() {
+		if queued {
+			s.waiting--
+			if !batch {
+				s.interactiveWaiting--
+				// Batch requests held back for this one may go now, even if it gave up
+				if s.interactiveWaiting == 0 {
+					s.notifyLocked()
+				}
+			}
+			slotsQueued.Set(float64(s.waiting), s.name)
+		}
+		s.mu.Unlock()
+	}()
+
+	for {
+		if !batch || s.batchAllowedLocked() {
+			if i := s.pickLocked(preferred); i >= 0 {
+				t := s.targets[i]
+				t.inflight++
+				if batch {
+					s.batchInflight++
+				}
+				s.updateMetrics(t)
+				return i, func() { s.release(t, batch) }, nil
+			}
+		}
+
+		if !queued {
+			if s.cfg.MaxQueue > 0 && s.waiting >= s.cfg.MaxQueue {
+				return -1, nil, errSlotQueueFull
+			}
+			queued = true
+			s.waiting++
+			if !batch {
+				s.interactiveWaiting++
+			}
+			slotsQueued.Set(float64(s.waiting), s.name)
+			timer := time.NewTimer(s.cfg.QueueTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+			s.mu.Lock()
+		case <-timeout:
+			s.mu.Lock()
+			return -1, nil, errSlotQueueTimeout
+		case <-ctx.Done():
+			s.mu.Lock()
+			return -1, nil, ctx.Err()
+		}
+	}
+}
+
+func (s *SlotScheduler) release(t *targetSlots, batch bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.inflight--
+	if batch {
+		s.batchInflight--
+	}
+	// The finished request held one of the polled busy slots
+	if t.busy > 0 {
+		t.busy--
+	}
+	s.updateMetrics(t)
+	s.notifyLocked()
+}
+
+type targetContextKey struct{}
+
+// TargetFromContext returns the target index chosen by a SlotScheduler, if any
+func TargetFromContext(ctx context.Context) (int, bool) {
+	i, ok := ctx.Value(targetContextKey{}).(int)
+	return i, ok
+}
+
+// Handler queues POST requests for a free slot before passing them to next, and stores
+// the chosen target for the director (see TargetFromContext). Other requests pass through.
+// priority classifies each request for the queue; nil treats every request as interactive.
+func (s *SlotScheduler) Handler(next http.Handler, balancer *Balancer, priority func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		preferred, ok := balancer.AffinityTarget(req)
+		if !ok {
+			preferred = -1
+		}
+		class := config.PriorityInteractive
+		if priority != nil {
+			class = priority(req)
+		}
+		target, release, err := s.Acquire(req.Context(), preferred, class)
+		if err != nil {
+			if IsClientDisconnect(req, err) {
+				logger.Info("Request aborted by client disconnect", "method", req.Method, "path", req.URL.Path, "stage", "slot_queue")
+				w.WriteHeader(StatusClientClosedRequest)
+				return
+			}
+			logger.Info("No free slot for request", "method", req.Method, "path", req.URL.Path, "err", err)
+			rej := &Rejection{
+				Status:  http.StatusServiceUnavailable,
+				Type:    "server_error",
+				Code:    "slots_unavailable",
+				Message: "no backend slot became free: " + err.Error(),
+			}
+			rej.write(w, http.Header{"Retry-After": {strconv.Itoa(max(1, int(s.cfg.Interval.Seconds())))}})
+			return
+		}
+		defer release()
+
+		logger.Debug("Slot acquired", "target", s.targets[target].url, "priority", class)
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), targetContextKey{}, target)))
+	})
+}
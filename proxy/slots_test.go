@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// slotsBackend serves llama.cpp style /health and /slots with busy of total slots in use
+func slotsBackend(t *testing.T, healthy bool, total, busy int) *url.URL {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			if !healthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"status":"ok"}`))
+		case "/slots":
+			var slots []map[string]any
+			for i := range total {
+				slots = append(slots, map[string]any{"id": i, "is_processing": i < busy})
+			}
+			json.NewEncoder(w).Encode(slots)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	u, _ := url.Parse(server.URL)
+	return u
+}
+
+func TestSlotSchedulerPicksFreestTarget(t *testing.T) {
+	targets := []*url.URL{
+		slotsBackend(t, true, 2, 2),
+		slotsBackend(t, true, 3, 1),
+		slotsBackend(t, false, 8, 0),
+	}
+	s := NewSlotScheduler("test", targets, config.SlotsConfig{Interval: time.Second, QueueTimeout: 50 * time.Millisecond})
+	s.poll(context.Background())
+
+	var releases []func()
+	for range 3 {
+		target, release, err := s.Acquire(context.Background(), -1, config.PriorityInteractive)
+		if err != nil {
+			t.Fatalf("Acquire: %v", err)
+		}
+		if target != 1 {
+			t.Fatalf("target = %d, want 1 (the only healthy target with free slots)", target)
+		}
+		releases = append(releases, release)
+	}
+
+	// All slots are taken: a full target isn't picked even when preferred
+	if _, _, err := s.Acquire(context.Background(), 0, config.PriorityInteractive); err != errSlotQueueTimeout {
+		t.Fatalf("err = %v, want queue timeout", err)
+	}
+
+	// A release wakes a queued request
+	got := make(chan int, 1)
+	go func() {
+		target, release, err := s.Acquire(context.Background(), -1, config.PriorityInteractive)
+		if err == nil {
+			release()
+		}
+		got <- target
+	}()
+	time.Sleep(10 * time.Millisecond)
+	releases[0]()
+	if target := <-got; target != 1 {
+		t.Fatalf("queued request got target %d, want 1", target)
+	}
+}
+
+func TestSlotSchedulerHandler(t *testing.T) {
+	targets := []*url.URL{slotsBackend(t, true, 1, 0)}
+	s := NewSlotScheduler("test", targets, config.SlotsConfig{Interval: time.Second, QueueTimeout: 20 * time.Millisecond, MaxQueue: 1})
+	s.poll(context.Background())
+
+	block := make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if target, ok := TargetFromContext(r.Context()); !ok || target != 0 {
+			t.Errorf("target = %d, %v, want 0 from context", target, ok)
+		}
+		<-block
+	})
+	h := s.Handler(next, NewBalancer(1), nil)
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "slots_unavailable") {
+		t.Fatalf("status = %d, body = %s, want 503 slots_unavailable", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After on 503")
+	}
+
+	// GETs are not scheduled
+	get := httptest.NewRecorder()
+	passthrough := s.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := TargetFromContext(r.Context()); ok {
+			t.Error("GET should not be scheduled")
+		}
+	}), NewBalancer(1), nil)
+	passthrough.ServeHTTP(get, httptest.NewRequest("GET", "/v1/models", nil))
+
+	close(block)
+	<-done
+}
+
+func TestSlotSchedulerServesInteractiveFirst(t *testing.T) {
+	targets := []*url.URL{slotsBackend(t, true, 2, 0)}
+	s := NewSlotScheduler("test", targets, config.SlotsConfig{Interval: time.Second, QueueTimeout: time.Second, BatchShare: 0.5})
+	s.poll(context.Background())
+
+	_, releaseBatch, err := s.Acquire(context.Background(), -1, config.PriorityBatch)
+	if err != nil {
+		t.Fatalf("Acquire batch: %v", err)
+	}
+
+	// batch_share 0.5 of 2 slots: a second batch request waits even with a slot free
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := s.Acquire(ctx, -1, config.PriorityBatch); err != context.DeadlineExceeded {
+		t.Fatalf("second batch err = %v, want to wait beyond batch_share", err)
+	}
+	_, releaseInteractive, err := s.Acquire(context.Background(), -1, config.PriorityInteractive)
+	if err != nil {
+		t.Fatalf("Acquire interactive: %v", err)
+	}
+
+	// Both queue for the full target; the interactive request gets the first free slot
+	order := make(chan string, 2)
+	for _, priority := range []string{config.PriorityBatch, config.PriorityInteractive} {
+		go func() {
+			_, release, err := s.Acquire(context.Background(), -1, priority)
+			if err != nil {
+				t.Errorf("Acquire %s: %v", priority, err)
+				order <- ""
+				return
+			}
+			order <- priority
+			time.Sleep(10 * time.Millisecond)
+			release()
+		}()
+		time.Sleep(10 * time.Millisecond)
+	}
+	releaseInteractive()
+	if first := <-order; first != config.PriorityInteractive {
+		t.Fatalf("first served = %q, want interactive", first)
+	}
+	releaseBatch()
+	if second := <-order; second != config.PriorityBatch {
+		t.Fatalf("second served = %q, want batch", second)
+	}
+}
+
+func TestSlotSchedulerWakesBatchWhenInteractiveGivesUp(t *testing.T) {
+	targets := []*url.URL{slotsBackend(t, true, 1, 0)}
+	s := NewSlotScheduler("test", targets, config.SlotsConfig{Interval: time.Second, QueueTimeout: time.Second})
+	s.poll(context.Background())
+
+	_, release, err := s.Acquire(context.Background(), -1, config.PriorityInteractive)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	gaveUp := make(chan error, 1)
+	go func() {
+		_, _, err := s.Acquire(ctx, -1, config.PriorityInteractive)
+		gaveUp <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	served := make(chan time.Duration, 1)
+	go func() {
+		start := time.Now()
+		if _, release, err := s.Acquire(context.Background(), -1, config.PriorityBatch); err == nil {
+			release()
+		}
+		served <- time.Since(start)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// A slot frees while the interactive request still waits ahead of the batch one, which
+	// then cancels; the batch request must not wait for some unrelated release
+	s.mu.Lock()
+	s.targets[0].inflight--
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.targets[0].inflight++
+		s.mu.Unlock()
+	}()
+	cancel()
+	if err := <-gaveUp; err != context.Canceled {
+		t.Fatalf("interactive err = %v, want canceled", err)
+	}
+	if waited := <-served; waited >= 500*time.Millisecond {
+		t.Fatalf("batch request waited %v, want it woken when the interactive one gave up", waited)
+	}
+}
@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+)
+
+var (
+	requestsTotal = metrics.NewCounter("llama_matchmaker_requests_total", "Requests received", "listen")
+	routeHits     = metrics.NewCounter("llama_matchmaker_route_hits_total", "Requests matched by each route, by name or index", "listen", "route")
+	routeLastHit  = metrics.NewGauge("llama_matchmaker_route_last_hit_timestamp_seconds", "Unix time each route last matched a request", "listen", "route")
+	activeStreams = metrics.NewGauge("llama_matchmaker_active_streams", "Streamed responses in progress", "listen")
+)
+
+// ProxyStats is live activity on one proxy listener, for the monitor
+type ProxyStats struct {
+	Listen        string      `json:"listen"`
+	Requests      int64       `json:"requests"`
+	ActiveStreams int64       `json:"active_streams"`
+	Routes        []RouteHits `json:"routes"`
+}
+
+// RouteHits counts the requests a route matched
+type RouteHits struct {
+	Route   string    `json:"route"` // Name, or index when unnamed
+	Hits    int64     `json:"hits"`
+	LastHit time.Time `json:"last_hit,omitzero"`
+}
+
+// Stats returns activity since startup for every listener that has seen a request, sorted
+// by listen address. Counts survive reloads.
+func Stats() []ProxyStats {
+	var stats []ProxyStats
+	byListen := make(map[string]int)
+	entry := func(listen string) *ProxyStats {
+		i, ok := byListen[listen]
+		if !ok {
+			i = len(stats)
+			byListen[listen] = i
+			stats = append(stats, ProxyStats{Listen: listen, Routes: []RouteHits{}})
+		}
+		return &stats[i]
+	}
+
+	for _, s := range requestsTotal.Samples() {
+		entry(s.Labels[0]).Requests = int64(s.Value)
+	}
+	lastHits := make(map[[2]string]time.Time)
+	for _, s := range routeLastHit.Samples() {
+		lastHits[[2]string{s.Labels[0], s.Labels[1]}] = unixTime(s.Value)
+	}
+	for _, s := range routeHits.Samples() {
+		p := entry(s.Labels[0])
+		p.Routes = append(p.Routes, RouteHits{Route: s.Labels[1], Hits: int64(s.Value), LastHit: lastHits[[2]string{s.Labels[0], s.Labels[1]}]})
+	}
+	for _, s := range activeStreams.Samples() {
+		entry(s.Labels[0]).ActiveStreams = int64(s.Value)
+	}
+	return stats
+}
+
+// RouteUsage is one configured route's activity since startup
+type RouteUsage struct {
+	Listen  string    `json:"listen"`
+	Index   int       `json:"index"`
+	Name    string    `json:"name,omitempty"`
+	Source  string    `json:"source,omitempty"`
+	Hits    int64     `json:"hits"`
+	LastHit time.Time `json:"last_hit,omitzero"`
+}
+
+// RouteActivity lists every route in cfg, in config order, with the requests it matched. Routes
+// are counted by name, or by index when unnamed, so counts follow a named route across
+// reloads.
+func RouteActivity(cfg *config.Config) []RouteUsage {
+	var usage []RouteUsage
+	for _, proxy := range cfg.Proxies {
+		for i, route := range proxy.Routes {
+			label := routeMetricLabel(&route, i)
+			usage = append(usage, RouteUsage{
+				Listen:  proxy.Listen,
+				Index:   i,
+				Name:    route.Name,
+				Source:  route.Source,
+				Hits:    int64(routeHits.Value(proxy.Listen, label)),
+				LastHit: unixTime(routeLastHit.Value(proxy.Listen, label)),
+			})
+		}
+	}
+	return usage
+}
+
+// UnusedRoutes lists the routes in cfg that haven't matched a request since startup
+func UnusedRoutes(cfg *config.Config) []RouteUsage {
+	var unused []RouteUsage
+	for _, u := range RouteActivity(cfg) {
+		if u.Hits == 0 {
+			unused = append(unused, u)
+		}
+	}
+	return unused
+}
+
+// countRouteHits records the routes a request matched
+func (h *Handler) countRouteHits(routes []*config.Route, indices []int) {
+	now := float64(time.Now().UnixNano()) / 1e9
+	for i, route := range routes {
+		index := -1
+		if i < len(indices) {
+			index = indices[i]
+		}
+		label := routeMetricLabel(route, index)
+		routeHits.Add(1, h.cfg.Listen, label)
+		routeLastHit.Set(now, h.cfg.Listen, label)
+	}
+}
+
+// routeMetricLabel names a route in metrics: its name, or its index when unnamed
+func routeMetricLabel(route *config.Route, index int) string {
+	if route.Name != "" || index < 0 {
+		return route.Name
+	}
+	return strconv.Itoa(index)
+}
+
+// unixTime converts a metric timestamp back to a time; 0 is the zero time
+func unixTime(seconds float64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(seconds*1e9))
+}
+
+// trackStream counts resp as an active stream until its body ends
+func trackStream(resp *http.Response, listen string) {
+	if resp.Body == nil {
+		return
+	}
+	activeStreams.Add(1, listen)
+	resp.Body = &streamBody{ReadCloser: resp.Body, listen: listen}
+}
+
+type streamBody struct {
+	io.ReadCloser
+	listen string
+	once   sync.Once
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.end()
+	}
+	return n, err
+}
+
+func (b *streamBody) Close() error {
+	b.end()
+	return b.ReadCloser.Close()
+}
+
+func (b *streamBody) end() {
+	b.once.Do(func() { activeStreams.Add(-1, b.listen) })
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestStatsCountRoutesAndActiveStreams(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{
+		{
+			Name:      "chat",
+			Methods:   newPatternField("POST"),
+			Paths:     newPatternField("^/v1/chat/completions$"),
+			OnRequest: []config.Action{{Default: map[string]any{"temperature": 0.7}}},
+		},
+		{
+			Methods:   newPatternField("POST"),
+			Paths:     newPatternField("^/v1/"),
+			OnRequest: []config.Action{{Default: map[string]any{"user": "proxy"}}},
+		},
+	})
+	cfg.Proxies[0].Listen = "stats-test:1"
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+
+	stats := func() ProxyStats {
+		for _, s := range Stats() {
+			if s.Listen == "stats-test:1" {
+				return s
+			}
+		}
+		return ProxyStats{}
+	}
+
+	req := httptest.NewRequest("POST", "http://gpu:8080/v1/chat/completions", bytes.NewBufferString(`{"model":"m","stream":true}`))
+	h.ModifyRequest(req)
+	req = httptest.NewRequest("POST", "http://gpu:8080/v1/embeddings", bytes.NewBufferString(`{"input":"x"}`))
+	h.ModifyRequest(req)
+
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader("data: {\"x\":1}\n\ndata: [DONE]\n\n")),
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	if got := stats().ActiveStreams; got != 1 {
+		t.Fatalf("active streams = %d while streaming, want 1", got)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	got := stats()
+	if got.Requests != 2 || got.ActiveStreams != 0 {
+		t.Fatalf("stats = %+v, want 2 requests and no active streams", got)
+	}
+	hits := map[string]int64{}
+	for _, r := range got.Routes {
+		hits[r.Route] = r.Hits
+	}
+	if hits["chat"] != 1 || hits["1"] != 2 {
+		t.Fatalf("route hits = %v, want chat:1 and 1:2", hits)
+	}
+	for _, r := range got.Routes {
+		if r.LastHit.IsZero() || time.Since(r.LastHit) > time.Minute {
+			t.Fatalf("route %s last hit = %v, want just now", r.Route, r.LastHit)
+		}
+	}
+}
+
+func TestRouteActivityListsUnusedRoutes(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{
+		{
+			Name:      "chat",
+			Methods:   newPatternField("POST"),
+			Paths:     newPatternField("^/v1/chat/completions$"),
+			OnRequest: []config.Action{{Default: map[string]any{"temperature": 0.7}}},
+		},
+		{
+			Methods:   newPatternField("POST"),
+			Paths:     newPatternField("^/v1/legacy$"),
+			OnRequest: []config.Action{{Default: map[string]any{"user": "proxy"}}},
+		},
+	})
+	cfg.Proxies[0].Listen = "stats-test:2"
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+	h.ModifyRequest(httptest.NewRequest("POST", "http://gpu:8080/v1/chat/completions", bytes.NewBufferString(`{"model":"m"}`)))
+
+	activity := RouteActivity(cfg)
+	if len(activity) != 2 || activity[0].Name != "chat" || activity[0].Hits != 1 || activity[0].LastHit.IsZero() {
+		t.Fatalf("activity = %+v, want chat with one hit first", activity)
+	}
+	if activity[1].Hits != 0 || !activity[1].LastHit.IsZero() {
+		t.Fatalf("unmatched route = %+v, want no hits", activity[1])
+	}
+
+	unused := UnusedRoutes(cfg)
+	if len(unused) != 1 || unused[0].Index != 1 || unused[0].Listen != "stats-test:2" {
+		t.Fatalf("unused = %+v, want route 1", unused)
+	}
+}
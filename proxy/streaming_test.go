@@ -316,3 +316,138 @@ func TestModifyResponse_RoutesToStreaming(t *testing.T) {
 		})
 	}
 }
+
+func TestModifyStreamingResponse_ClientDisconnectClosesUpstream(t *testing.T) {
+	upstreamReader, upstreamWriter := io.Pipe()
+	defer upstreamWriter.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := (&http.Request{
+		Method: "POST",
+		URL:    mustParseURL("/v1/chat/completions"),
+	}).WithContext(ctx)
+
+	resp := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       upstreamReader,
+		Request:    req,
+	}
+
+	if err := ModifyStreamingResponse(resp, nil, nil); err != nil {
+		t.Fatalf("ModifyStreamingResponse failed: %v", err)
+	}
+
+	// First chunk flows through normally
+	go upstreamWriter.Write([]byte("data: {\"n\":1}\n"))
+	buf := make([]byte, 64)
+	if _, err := resp.Body.Read(buf); err != nil {
+		t.Fatalf("expected first chunk, got error: %v", err)
+	}
+
+	cancel()
+
+	// Once the client is gone the upstream body must be closed
+	if _, err := upstreamWriter.Write([]byte("data: {\"n\":2}\n")); err == nil {
+		t.Fatal("expected upstream write to fail after client disconnect")
+	}
+
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Fatal("expected downstream read to report cancellation")
+	}
+}
+
+func TestIsClientDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := (&http.Request{Method: "GET", URL: mustParseURL("/")}).WithContext(ctx)
+
+	if IsClientDisconnect(req, io.ErrUnexpectedEOF) {
+		t.Fatal("live request should not be reported as disconnected")
+	}
+	if !IsClientDisconnect(nil, context.Canceled) {
+		t.Fatal("context.Canceled should be reported as disconnected")
+	}
+
+	cancel()
+	if !IsClientDisconnect(req, io.ErrUnexpectedEOF) {
+		t.Fatal("canceled request context should be reported as disconnected")
+	}
+}
+
+// chunks without route actions go out as received, and usage is still read from them
+func TestModifyStreamingResponse_PassthroughKeepsBytesAndUsage(t *testing.T) {
+	stream := "data: {\"z\":1.0,\"a\":\"<b>\"}\n\n" +
+		"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":7,\"completion_tokens\":3}}\n\n" +
+		"data: [DONE]\n\n"
+	resp := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(stream)),
+		Request:    &http.Request{Method: "POST", URL: mustParseURL("/v1/chat/completions")},
+	}
+
+	var got Usage
+	var reported bool
+	done := make(chan struct{})
+	err := modifyStreamingResponse(resp, nil, nil, streamOptions{onComplete: func(u Usage, _ string, ok bool, _ *streamSummary) {
+		got, reported = u, ok
+		close(done)
+	}})
+	if err != nil {
+		t.Fatalf("modifyStreamingResponse failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	<-done
+
+	if string(body) != stream {
+		t.Fatalf("body = %q, want it unchanged", body)
+	}
+	if !reported || got.PromptTokens != 7 || got.CompletionTokens != 3 {
+		t.Fatalf("usage = %+v (reported %v), want 7 prompt and 3 completion tokens", got, reported)
+	}
+}
+
+func TestModifyStreamingResponse_Summary(t *testing.T) {
+	stream := "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"},\"finish_reason\":null}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"length\"}]}\n\n" +
+		"data: [DONE]\n\n"
+	routes := []*config.Route{{OnResponse: []config.Action{{Merge: map[string]any{"edited": true}}}}}
+	cfg := &config.Config{Proxies: []config.ProxyConfig{{Routes: []config.Route{*routes[0]}}}}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	routes[0] = &cfg.Proxies[0].Routes[0]
+
+	for _, tt := range []struct {
+		name           string
+		routes         []*config.Route
+		wantTransforms int
+	}{
+		{"passthrough", nil, 0},
+		{"transformed", routes, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+				Body:       io.NopCloser(strings.NewReader(stream)),
+				Request:    &http.Request{Method: "POST", URL: mustParseURL("/v1/chat/completions")},
+			}
+			var summary *streamSummary
+			done := make(chan struct{})
+			err := modifyStreamingResponse(resp, tt.routes, nil, streamOptions{onComplete: func(_ Usage, _ string, _ bool, s *streamSummary) {
+				summary = s
+				close(done)
+			}})
+			if err != nil {
+				t.Fatalf("modifyStreamingResponse failed: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			<-done
+
+			if summary.chunks != 2 || summary.transforms != tt.wantTransforms || summary.finishReason != "length" || summary.bytes != int64(len(body)) {
+				t.Fatalf("summary = %+v, want 2 chunks, %d transforms, finish_reason length, %d bytes", summary, tt.wantTransforms, len(body))
+			}
+		})
+	}
+}
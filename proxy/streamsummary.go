@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// Stream outcomes, logged when a stream ends
+const (
+	StreamComplete         = "complete"          // The backend finished the stream
+	StreamClientDisconnect = "client_disconnect" // The client went away first
+	StreamUpstreamError    = "upstream_error"    // Reading the backend failed (ex: reset, idle_chunk_timeout, request deadline)
+)
+
+// streamSummary tallies a stream as it is forwarded, for the one line logged when it ends
+type streamSummary struct {
+	start        time.Time
+	chunks       int    // Events written to the client, not counting delimiters and [DONE]
+	bytes        int64  // Bytes written to the client
+	transforms   int    // Chunks route actions changed
+	finishReason string // The backend's last reported finish reason
+	session      string // The request's conversation ID, if any
+}
+
+// fields returns the summary as log fields
+func (s *streamSummary) fields(outcome string) []any {
+	fields := []any{
+		"outcome", outcome,
+		"chunks", s.chunks,
+		"bytes", s.bytes,
+		"duration_ms", time.Since(s.start).Milliseconds(),
+		"transforms", s.transforms,
+	}
+	if s.finishReason != "" {
+		fields = append(fields, "finish_reason", s.finishReason)
+	}
+	if s.session != "" {
+		fields = append(fields, "session", s.session)
+	}
+	return fields
+}
+
+// observeFinish records the finish reason a chunk reports, in any of the dialects the
+// proxy forwards: OpenAI choices, Ollama done_reason, or Anthropic stop_reason
+func (s *streamSummary) observeFinish(data map[string]any) {
+	if choices, ok := data["choices"].([]any); ok {
+		for _, c := range choices {
+			if choice, ok := c.(map[string]any); ok {
+				if reason, ok := choice["finish_reason"].(string); ok && reason != "" {
+					s.finishReason = reason
+				}
+			}
+		}
+	}
+	if reason, ok := data["done_reason"].(string); ok && reason != "" {
+		s.finishReason = reason
+	}
+	if reason, ok := data["stop_reason"].(string); ok && reason != "" {
+		s.finishReason = reason
+	}
+	if delta, ok := data["delta"].(map[string]any); ok {
+		if reason, ok := delta["stop_reason"].(string); ok && reason != "" {
+			s.finishReason = reason
+		}
+	}
+}
+
+// mayReportFinish reports whether a raw chunk might carry a finish reason, so chunks that
+// pass through unparsed are only decoded when they could
+func mayReportFinish(chunk []byte) bool {
+	return bytes.Contains(chunk, []byte(`_reason":"`)) || bytes.Contains(chunk, []byte(`_reason": "`))
+}
+
+// countingPipe counts the bytes a stream writes to the client
+type countingPipe struct {
+	*io.PipeWriter
+	summary *streamSummary
+}
+
+func (p *countingPipe) Write(b []byte) (int, error) {
+	n, err := p.PipeWriter.Write(b)
+	p.summary.bytes += int64(n)
+	return n, err
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+)
+
+var (
+	streamWorkersBusy = metrics.NewGauge("llama_matchmaker_stream_workers_busy", "Streams being transformed, out of stream_workers", "listen")
+	streamWorkerWait  = metrics.NewHistogram("llama_matchmaker_stream_worker_wait_seconds", "Time streams waited for a free stream worker", metrics.LatencyBuckets, "listen")
+)
+
+// streamWorkers bounds how many streams a proxy transforms at once. Each stream holds
+// one worker (its goroutine, line buffer, and pipe) until it ends; streams beyond the
+// limit wait for a worker before their first chunk is read.
+type streamWorkers struct {
+	listen string
+	slots  chan struct{}
+}
+
+// newStreamWorkers returns a pool of n workers, or nil (no limit) when n is 0
+func newStreamWorkers(listen string, n int) *streamWorkers {
+	if n <= 0 {
+		return nil
+	}
+	return &streamWorkers{listen: listen, slots: make(chan struct{}, n)}
+}
+
+// acquire waits for a free worker, or for ctx to end. A nil pool never waits.
+func (w *streamWorkers) acquire(ctx context.Context) (release func(), err error) {
+	if w == nil {
+		return func() {}, nil
+	}
+
+	start := time.Now()
+	select {
+	case w.slots <- struct{}{}:
+	default:
+		logger.Debug("Waiting for a stream worker", "listen", w.listen, "workers", cap(w.slots))
+		select {
+		case w.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	streamWorkerWait.Observe(time.Since(start).Seconds(), w.listen)
+	streamWorkersBusy.Add(1, w.listen)
+
+	return func() {
+		streamWorkersBusy.Add(-1, w.listen)
+		<-w.slots
+	}, nil
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamWorkersBoundConcurrency(t *testing.T) {
+	w := newStreamWorkers("workers-test", 1)
+
+	release, err := w.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if got := streamWorkersBusy.Value("workers-test"); got != 1 {
+		t.Fatalf("busy = %v, want 1", got)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		next, _ := w.acquire(context.Background())
+		acquired <- next
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second stream got a worker while the only one was busy")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	next := <-acquired
+	next()
+	if got := streamWorkersBusy.Value("workers-test"); got != 0 {
+		t.Fatalf("busy after release = %v, want 0", got)
+	}
+}
+
+func TestStreamWorkersGiveUpWithClient(t *testing.T) {
+	w := newStreamWorkers("workers-test-cancel", 1)
+	release, _ := w.acquire(context.Background())
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := w.acquire(ctx); err != context.Canceled {
+		t.Fatalf("acquire with a canceled client = %v, want context.Canceled", err)
+	}
+
+	// Nil pools never wait
+	var unlimited *streamWorkers
+	if r, err := unlimited.acquire(ctx); err != nil {
+		t.Fatalf("unlimited acquire: %v", err)
+	} else {
+		r()
+	}
+}
+
+func TestStreamingResponseHoldsWorkerUntilEnd(t *testing.T) {
+	w := newStreamWorkers("workers-test-stream", 1)
+	newStream := func() *http.Response {
+		req, _ := http.NewRequest("POST", "http://example.com/v1/chat/completions", nil)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:       io.NopCloser(strings.NewReader("data: {\"id\":\"a\"}\n\ndata: [DONE]\n\n")),
+			Request:    req,
+		}
+	}
+
+	first := newStream()
+	if err := modifyStreamingResponse(first, nil, nil, streamOptions{workers: w}); err != nil {
+		t.Fatalf("first stream: %v", err)
+	}
+
+	second := newStream()
+	started := make(chan error)
+	go func() { started <- modifyStreamingResponse(second, nil, nil, streamOptions{workers: w}) }()
+	select {
+	case <-started:
+		t.Fatal("second stream started while the first held the only worker")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	io.ReadAll(first.Body)
+	if err := <-started; err != nil {
+		t.Fatalf("second stream: %v", err)
+	}
+	if body, _ := io.ReadAll(second.Body); !strings.Contains(string(body), "[DONE]") {
+		t.Fatalf("second stream body = %q", body)
+	}
+}
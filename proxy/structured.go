@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/schema"
+)
+
+// adaptStructuredOutput applies the first matched structured_output: it keeps the schema
+// to check the reply against, and rewrites response_format for the backend
+func (h *Handler) adaptStructuredOutput(e *requestEdit) {
+	if !e.json || e.route.rejection != nil {
+		return
+	}
+	rule := e.firstRoute(func(r *config.Route) bool { return r.StructuredOutput != nil })
+	if rule == nil {
+		return
+	}
+	if rule.StructuredOutput.Validate {
+		e.route.schema, _ = requestedSchema(e.data)
+	}
+	if adaptResponseFormat(e.data, rule.StructuredOutput.Mode) {
+		e.modified = true
+		logger.Debug("Adapted response_format", "mode", rule.StructuredOutput.Mode)
+	}
+}
+
+// requestedSchema returns the JSON schema a request asks the reply to follow, from OpenAI
+// response_format, Ollama format, or llama.cpp json_schema. JSON mode means any object.
+func requestedSchema(data map[string]any) (map[string]any, bool) {
+	anyObject := map[string]any{"type": "object"}
+	if format, ok := data["response_format"].(map[string]any); ok {
+		switch format["type"] {
+		case "json_schema":
+			spec, _ := format["json_schema"].(map[string]any)
+			s, ok := spec["schema"].(map[string]any)
+			return s, ok
+		case "json_object":
+			return anyObject, true
+		}
+		return nil, false
+	}
+	switch format := data["format"].(type) {
+	case map[string]any:
+		return format, true
+	case string:
+		if format == "json" {
+			return anyObject, true
+		}
+	}
+	s, ok := data["json_schema"].(map[string]any)
+	return s, ok
+}
+
+// adaptResponseFormat rewrites an OpenAI response_format into the backend's parameter.
+// It reports whether data was modified.
+func adaptResponseFormat(data map[string]any, mode string) bool {
+	format, ok := data["response_format"].(map[string]any)
+	if !ok || mode == "" {
+		return false
+	}
+	s, hasSchema := requestedSchema(data)
+	delete(data, "response_format")
+
+	switch mode {
+	case config.StructuredLlamaCpp:
+		if hasSchema {
+			data["json_schema"] = s
+		}
+	case config.StructuredOllama:
+		if format["type"] == "json_object" {
+			data["format"] = "json"
+		} else if hasSchema {
+			data["format"] = s
+		}
+	}
+	return true
+}
+
+// replyText returns the generated text of an OpenAI, Ollama, or llama.cpp /completion reply
+func replyText(data map[string]any) (string, bool) {
+	if choices, ok := data["choices"].([]any); ok && len(choices) > 0 {
+		choice, _ := choices[0].(map[string]any)
+		message, _ := choice["message"].(map[string]any)
+		text, ok := message["content"].(string)
+		return text, ok
+	}
+	if message, ok := data["message"].(map[string]any); ok {
+		text, ok := message["content"].(string)
+		return text, ok
+	}
+	text, ok := data["content"].(string)
+	return text, ok
+}
+
+// checkStructuredReply validates the generated text of a reply body against s
+func checkStructuredReply(body []byte, s map[string]any) error {
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil
+	}
+	text, ok := replyText(data)
+	if !ok {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &value); err != nil {
+		return fmt.Errorf("reply is not JSON: %w", err)
+	}
+	return schema.Validate(s, value)
+}
+
+// replaceWithError swaps a response for a locally generated error
+func replaceWithError(resp *http.Response, rej *Rejection) []byte {
+	body := rej.body()
+	resp.StatusCode = rej.Status
+	resp.Status = strconv.Itoa(rej.Status) + " " + http.StatusText(rej.Status)
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return body
+}
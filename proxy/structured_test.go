@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+const schemaRequest = `{"model":"m","messages":[{"role":"user","content":"hi"}],
+	"response_format":{"type":"json_schema","json_schema":{"name":"answer","schema":{"type":"object","required":["answer"]}}}}`
+
+func TestModifyRequestAdaptsResponseFormat(t *testing.T) {
+	tests := []struct {
+		mode  string
+		field string
+	}{
+		{config.StructuredLlamaCpp, "json_schema"},
+		{config.StructuredOllama, "format"},
+		{config.StructuredStrip, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			h := newRouteHandler(t, config.Route{StructuredOutput: &config.StructuredOutputPolicy{Mode: tt.mode}}, nil)
+			req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(schemaRequest))
+			h.ModifyRequest(req)
+
+			body, _ := io.ReadAll(req.Body)
+			var data map[string]any
+			if err := json.Unmarshal(body, &data); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if _, ok := data["response_format"]; ok {
+				t.Fatal("response_format should be removed")
+			}
+			if tt.field == "" {
+				return
+			}
+			if s, ok := data[tt.field].(map[string]any); !ok || s["type"] != "object" {
+				t.Fatalf("%s = %v, want the schema", tt.field, data[tt.field])
+			}
+		})
+	}
+}
+
+func TestModifyResponseValidatesStructuredReply(t *testing.T) {
+	h := newRouteHandler(t, config.Route{StructuredOutput: &config.StructuredOutputPolicy{Validate: true}}, nil)
+
+	send := func(content string) *http.Response {
+		req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(schemaRequest))
+		h.ModifyRequest(req)
+		reply, _ := json.Marshal(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": content}}},
+		})
+		resp := &http.Response{
+			Request:    req,
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(reply)),
+		}
+		if err := h.ModifyResponse(resp); err != nil {
+			t.Fatalf("ModifyResponse: %v", err)
+		}
+		return resp
+	}
+
+	if resp := send(`{"answer": 42}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("valid reply status = %d", resp.StatusCode)
+	}
+
+	resp := send(`{"guess": 42}`)
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("invalid reply status = %d, want 502", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "schema_validation_failed") || resp.ContentLength != int64(len(body)) {
+		t.Fatalf("unexpected error body: %s", body)
+	}
+}
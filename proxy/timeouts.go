@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// routeTimeouts are the reply limits of the first matched route that sets any (see
+// NewTransport)
+type routeTimeouts struct {
+	response  time.Duration
+	firstByte time.Duration
+	idleChunk time.Duration
+
+	// streaming is set when the request asked for a stream (stream: true), which
+	// response_timeout doesn't cover
+	streaming bool
+
+	// deadline ends the call and any reply still being read, streamed or not (see
+	// deadline_header)
+	deadline time.Time
+}
+
+func newRouteTimeouts(rule *config.Route, data map[string]any) *routeTimeouts {
+	return &routeTimeouts{
+		response:  rule.ResponseTimeout,
+		firstByte: rule.FirstByteTimeout,
+		idleChunk: rule.IdleChunkTimeout,
+		streaming: data["stream"] == true,
+	}
+}
+
+// timeoutsFromRequest returns the reply limits ModifyRequest chose for req, if any
+func timeoutsFromRequest(req *http.Request) *routeTimeouts {
+	if v, ok := req.Context().Value(routeContextKey).(*responseRouteContext); ok && v != nil {
+		return v.timeouts
+	}
+	return nil
+}
+
+// replyTimeoutError names the route timeout that ended an upstream call. It counts as a
+// deadline, so error_response answers it 504.
+type replyTimeoutError struct {
+	name  string
+	limit time.Duration
+}
+
+func (e *replyTimeoutError) Error() string {
+	return fmt.Sprintf("%s of %s exceeded", e.name, e.limit)
+}
+
+func (e *replyTimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+type timeoutTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip bounds an upstream call by its route's timeouts: first_byte_timeout until the
+// reply starts, response_timeout until a non-streaming reply has been read (requests asking
+// for a stream are exempt), idle_chunk_timeout between reads of a streamed reply, and the
+// request deadline until the reply is done. An expired limit cancels the call, and the
+// reply body if it has started.
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limits := timeoutsFromRequest(req)
+	if limits == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancelCause(req.Context())
+	expire := func(name string, limit time.Duration) *time.Timer {
+		if limit <= 0 {
+			return nil
+		}
+		return time.AfterFunc(limit, func() { cancel(&replyTimeoutError{name: name, limit: limit}) })
+	}
+	firstByte := expire("first_byte_timeout", limits.firstByte)
+	var response *time.Timer
+	if !limits.streaming {
+		response = expire("response_timeout", limits.response)
+	}
+	var deadline *time.Timer
+	if !limits.deadline.IsZero() {
+		deadline = expire("request deadline", max(time.Until(limits.deadline), time.Nanosecond))
+	}
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	stopTimer(firstByte)
+	if err != nil {
+		stopTimer(response)
+		stopTimer(deadline)
+		err = timeoutCause(ctx, err)
+		cancel(nil)
+		return nil, err
+	}
+
+	var idle *time.Timer
+	if isStreamingContentType(resp.Header.Get("Content-Type")) {
+		stopTimer(response)
+		response = nil
+		idle = expire("idle_chunk_timeout", limits.idleChunk)
+	}
+	resp.Body = &timedBody{
+		ReadCloser: resp.Body,
+		ctx:        ctx,
+		idle:       idle,
+		idleLimit:  limits.idleChunk,
+		release: func() {
+			stopTimer(response)
+			stopTimer(idle)
+			stopTimer(deadline)
+			cancel(nil)
+		},
+	}
+	return resp, nil
+}
+
+// timedBody restarts the idle_chunk_timeout timer on each read and reports an expired
+// route timeout instead of the cancellation it caused. Closing it stops the timers.
+type timedBody struct {
+	io.ReadCloser
+	ctx       context.Context
+	idle      *time.Timer
+	idleLimit time.Duration
+	release   func()
+	once      sync.Once
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.idle != nil {
+		b.idle.Reset(b.idleLimit)
+	}
+	if err != nil && err != io.EOF {
+		err = timeoutCause(b.ctx, err)
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
+
+// timeoutCause returns the route timeout that canceled ctx, or err when none did
+func timeoutCause(ctx context.Context, err error) error {
+	var expired *replyTimeoutError
+	if errors.As(context.Cause(ctx), &expired) {
+		return expired
+	}
+	return err
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+func TestRouteTimeouts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow-start":
+			time.Sleep(150 * time.Millisecond)
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {}\n\ndata: [DONE]\n\n"))
+		case "/stall":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {}\n\n"))
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(500 * time.Millisecond):
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer backend.Close()
+
+	cfg := newTestConfig(backend.URL, []config.Route{{
+		Methods:          newPatternField("POST"),
+		Paths:            newPatternField(".*"),
+		ResponseTimeout:  50 * time.Millisecond,
+		FirstByteTimeout: time.Second,
+		IdleChunkTimeout: 50 * time.Millisecond,
+	}})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+	transport := NewTransport(http.DefaultTransport)
+
+	send := func(path, body string) (*http.Response, error) {
+		req := httptest.NewRequest("POST", backend.URL+path, strings.NewReader(body))
+		req.RequestURI = ""
+		h.ModifyRequest(req)
+		return transport.RoundTrip(req)
+	}
+
+	// A non-streaming request gets response_timeout before the reply starts
+	_, err := send("/slow-start", `{"model":"m"}`)
+	var expired *replyTimeoutError
+	if !errors.As(err, &expired) || expired.name != "response_timeout" {
+		t.Fatalf("err = %v, want response_timeout", err)
+	}
+	if UpstreamStatus(err) != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", UpstreamStatus(err))
+	}
+
+	// A streaming request waits out slow prompt processing under first_byte_timeout
+	resp, err := send("/slow-start", `{"model":"m","stream":true}`)
+	if err != nil {
+		t.Fatalf("streaming request: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || !strings.Contains(string(body), "[DONE]") {
+		t.Fatalf("body = %q, err = %v, want the whole stream", body, err)
+	}
+
+	// A stream that stalls is cut after idle_chunk_timeout
+	resp, err = send("/stall", `{"model":"m","stream":true}`)
+	if err != nil {
+		t.Fatalf("stalled request: %v", err)
+	}
+	_, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !errors.As(err, &expired) || expired.name != "idle_chunk_timeout" {
+		t.Fatalf("err = %v, want idle_chunk_timeout", err)
+	}
+}
+
+func TestDeadlineHeader(t *testing.T) {
+	var header atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header.Store(r.Header.Get("X-Request-Deadline"))
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(500 * time.Millisecond):
+			case <-r.Context().Done():
+			}
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer backend.Close()
+
+	cfg := newTestConfig(backend.URL, []config.Route{{
+		Methods:         newPatternField("POST"),
+		Paths:           newPatternField(".*"),
+		ResponseTimeout: time.Minute,
+	}})
+	cfg.Proxies[0].DeadlineHeader = "X-Request-Deadline"
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+	transport := NewTransport(http.DefaultTransport)
+
+	send := func(path, body, deadline string) (*http.Response, error) {
+		header.Store("")
+		req := httptest.NewRequest("POST", backend.URL+path, strings.NewReader(body))
+		req.RequestURI = ""
+		if deadline != "" {
+			req.Header.Set("X-Request-Deadline", deadline)
+		}
+		h.ModifyRequest(req)
+		return transport.RoundTrip(req)
+	}
+	got := func() string { return header.Load().(string) }
+
+	// Without a client deadline, the route's response_timeout sets it
+	start := time.Now()
+	if _, err := send("/", `{"model":"m"}`, ""); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	sent, ok := parseDeadline(got())
+	if !ok || sent.Before(start.Add(time.Minute-time.Second)) || sent.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("deadline header = %q, want about a minute from now", got())
+	}
+
+	// An earlier client deadline wins, and cuts off the call
+	client := time.Now().Add(100 * time.Millisecond)
+	_, err := send("/slow", `{"model":"m"}`, strconv.FormatInt(client.UnixMilli(), 10))
+	var expired *replyTimeoutError
+	if !errors.As(err, &expired) || expired.name != "request deadline" {
+		t.Fatalf("err = %v, want request deadline", err)
+	}
+	if got() != formatDeadline(time.UnixMilli(client.UnixMilli())) {
+		t.Errorf("deadline header = %q, want the client's", got())
+	}
+
+	// Streams have no route deadline, so an unparsable header is dropped
+	if _, err := send("/", `{"model":"m","stream":true}`, "soon"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if got() != "" {
+		t.Errorf("deadline header = %q, want none", got())
+	}
+
+	// A deadline that already passed is answered without calling the backend
+	resp, err := send("/", `{"model":"m"}`, formatDeadline(time.Now().Add(-time.Second)))
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusGatewayTimeout || !strings.Contains(string(body), "deadline_exceeded") || got() != "" {
+		t.Errorf("status = %d, body = %s, backend header = %q; want 504 deadline_exceeded and no upstream call", resp.StatusCode, body, got())
+	}
+}
+
+// stalledStream sends one chunk and then waits for the call to be canceled
+func stalledStream() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {}\n\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+}
+
+// readTimedOutStream streams req through h and returns the logs written while the stream
+// ran and the error the client reads
+func readTimedOutStream(t *testing.T, h *Handler, req *http.Request) (string, error) {
+	t.Helper()
+	var logs bytes.Buffer
+	logger.SetOutput(&logs)
+	t.Cleanup(func() { logger.SetOutput(os.Stdout) })
+
+	req.RequestURI = ""
+	h.ModifyRequest(req)
+	resp, err := NewTransport(http.DefaultTransport).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	_, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	// The outcome is logged as the stream goroutine exits, just after the body errors
+	time.Sleep(20 * time.Millisecond)
+	return logs.String(), err
+}
+
+func TestStreamIdleTimeoutIsUpstreamError(t *testing.T) {
+	backend := stalledStream()
+	defer backend.Close()
+
+	cfg := newTestConfig(backend.URL, []config.Route{{
+		Methods:          newPatternField("POST"),
+		Paths:            newPatternField(".*"),
+		OnResponse:       []config.Action{{Merge: map[string]any{"seen": true}}},
+		IdleChunkTimeout: 50 * time.Millisecond,
+	}})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", backend.URL+"/", strings.NewReader(`{"model":"m","stream":true}`))
+	logs, err := readTimedOutStream(t, NewHandler(cfg.Proxies[0]), req)
+	var expired *replyTimeoutError
+	if !errors.As(err, &expired) || expired.name != "idle_chunk_timeout" {
+		t.Fatalf("err = %v, want idle_chunk_timeout", err)
+	}
+	if !strings.Contains(logs, "outcome=upstream_error") || strings.Contains(logs, "client_disconnect") {
+		t.Fatalf("logs = %s, want the stream ended as an upstream error", logs)
+	}
+}
+
+func TestStreamDeadlineIsUpstreamError(t *testing.T) {
+	backend := stalledStream()
+	defer backend.Close()
+
+	cfg := newTestConfig(backend.URL, []config.Route{{
+		Methods:    newPatternField("POST"),
+		Paths:      newPatternField(".*"),
+		OnResponse: []config.Action{{Merge: map[string]any{"seen": true}}},
+	}})
+	cfg.Proxies[0].DeadlineHeader = "X-Request-Deadline"
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", backend.URL+"/", strings.NewReader(`{"model":"m","stream":true}`))
+	req.Header.Set("X-Request-Deadline", formatDeadline(time.Now().Add(100*time.Millisecond)))
+	logs, err := readTimedOutStream(t, NewHandler(cfg.Proxies[0]), req)
+	var expired *replyTimeoutError
+	if !errors.As(err, &expired) || expired.name != "request deadline" {
+		t.Fatalf("err = %v, want request deadline", err)
+	}
+	if !strings.Contains(logs, "outcome=upstream_error") || strings.Contains(logs, "client_disconnect") {
+		t.Fatalf("logs = %s, want the stream ended as an upstream error", logs)
+	}
+}
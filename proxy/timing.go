@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+)
+
+// Request phases, logged as <phase>_ms and labeled in metrics
+const (
+	PhaseTransform = "transform"  // Route matching and on_request actions
+	PhaseConnect   = "connect"    // Sending upstream until a connection is ready; near 0 when reused
+	PhaseFirstByte = "first_byte" // Sending upstream until response headers arrive
+	PhaseStream    = "stream"     // Response headers until a streamed body ends
+	PhaseTotal     = "total"      // Received until the response is complete, including slot queueing
+)
+
+// phases lists the phases in log order
+var phases = []string{PhaseTransform, PhaseConnect, PhaseFirstByte, PhaseStream, PhaseTotal}
+
+var phaseSeconds = metrics.NewHistogram("llama_matchmaker_request_phase_seconds", "Time spent per request phase", metrics.LatencyBuckets, "listen", "phase")
+
+type timingsKey struct{}
+
+// timings records where a request's time went. Each phase is kept from its first
+// measurement, so retries and fan-out report the first upstream call.
+type timings struct {
+	mu       sync.Mutex
+	received time.Time
+	headers  time.Time // Response headers arrived
+	phases   map[string]time.Duration
+	finished bool
+}
+
+// WithTimings starts a request's clock as next receives it, so total covers everything
+// after (ex: slot queueing). Requests without it are timed from ModifyRequest.
+func WithTimings(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, withTimings(req))
+	})
+}
+
+// withTimings returns req carrying a fresh clock, or req itself when it already has one
+func withTimings(req *http.Request) *http.Request {
+	if timingsFromContext(req.Context()) != nil {
+		return req
+	}
+	t := &timings{received: time.Now(), phases: make(map[string]time.Duration, len(phases))}
+	return req.WithContext(context.WithValue(req.Context(), timingsKey{}, t))
+}
+
+func timingsFromContext(ctx context.Context) *timings {
+	t, _ := ctx.Value(timingsKey{}).(*timings)
+	return t
+}
+
+// set records a phase unless it was already measured
+func (t *timings) set(phase string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.phases[phase]; !ok {
+		t.phases[phase] = d
+	}
+}
+
+// gotHeaders marks the start of the response body, for the stream phase
+func (t *timings) gotHeaders() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.headers.IsZero() {
+		t.headers = time.Now()
+	}
+}
+
+// finish records the total (and stream, for streamed bodies), observes every measured
+// phase under listen, and returns them as log fields. Later calls return nil.
+func (t *timings) finish(listen string, streamed bool) []any {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.finished {
+		return nil
+	}
+	t.finished = true
+
+	now := time.Now()
+	if streamed && !t.headers.IsZero() {
+		t.phases[PhaseStream] = now.Sub(t.headers)
+	}
+	t.phases[PhaseTotal] = now.Sub(t.received)
+
+	var fields []any
+	for _, phase := range phases {
+		d, ok := t.phases[phase]
+		if !ok {
+			continue
+		}
+		phaseSeconds.Observe(d.Seconds(), listen, phase)
+		fields = append(fields, phase+"_ms", float64(d.Microseconds())/1000)
+	}
+	return fields
+}
+
+// phase returns a measured phase's duration
+func (t *timings) phase(name string) (time.Duration, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.phases[name]
+	return d, ok
+}
+
+// timingTransport traces connection setup and time to first byte for each upstream call
+type timingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	clock := timingsFromContext(req.Context())
+	if clock == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	sent := time.Now()
+	trace := &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) {
+			clock.set(PhaseConnect, time.Since(sent))
+		},
+		GotFirstResponseByte: func() {
+			clock.set(PhaseFirstByte, time.Since(sent))
+		},
+	}
+	resp, err := t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err == nil {
+		// Transports that skip the trace (ex: test stubs) still get a first-byte time
+		clock.set(PhaseFirstByte, time.Since(sent))
+		clock.gotHeaders()
+	}
+	return resp, err
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// timedRoundTrip sends body through WithTimings, ModifyRequest, NewTransport, and
+// ModifyResponse to backend, returning the logs written along the way
+func timedRoundTrip(t *testing.T, h *Handler, backend *httptest.Server, body string) string {
+	t.Helper()
+	var logs bytes.Buffer
+	logger.SetOutput(&logs)
+	t.Cleanup(func() { logger.SetOutput(os.Stdout) })
+
+	target, _ := url.Parse(backend.URL)
+	transport := NewTransport(http.DefaultTransport)
+	handler := WithTimings(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+		req.RequestURI = ""
+		h.ModifyRequest(req)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Errorf("round trip: %v", err)
+			return
+		}
+		if err := h.ModifyResponse(resp); err != nil {
+			t.Errorf("ModifyResponse: %v", err)
+		}
+		io.Copy(w, resp.Body)
+		resp.Body.Close()
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "http://proxy/v1/chat/completions", strings.NewReader(body)))
+	return logs.String()
+}
+
+func TestTimingsLoggedAndExported(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"content":"hi"}}]}`)
+	}))
+	defer backend.Close()
+
+	h := NewHandler(config.ProxyConfig{Listen: "timing-test:1"})
+	before := phaseSeconds.Count("timing-test:1", PhaseTotal)
+	logs := timedRoundTrip(t, h, backend, `{"model":"m","messages":[]}`)
+
+	for _, field := range []string{"transform_ms=", "connect_ms=", "first_byte_ms=", "total_ms="} {
+		if !strings.Contains(logs, field) {
+			t.Fatalf("missing %s in:\n%s", field, logs)
+		}
+	}
+	if strings.Contains(logs, "stream_ms=") {
+		t.Fatalf("non-streaming reply should not report stream time:\n%s", logs)
+	}
+	if got := phaseSeconds.Count("timing-test:1", PhaseTotal) - before; got != 1 {
+		t.Fatalf("total observations = %d, want 1", got)
+	}
+	if phaseSeconds.Count("timing-test:1", PhaseFirstByte) == 0 {
+		t.Fatal("first byte not exported")
+	}
+}
+
+func TestTimingsIncludeStream(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{"a", "b"} {
+			io.WriteString(w, `data: {"choices":[{"delta":{"content":"`+chunk+`"}}]}`+"\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer backend.Close()
+
+	h := NewHandler(config.ProxyConfig{Listen: "timing-test:2"})
+	logs := timedRoundTrip(t, h, backend, `{"model":"m","stream":true,"messages":[]}`)
+
+	if !strings.Contains(logs, "Streaming response complete") || !strings.Contains(logs, "stream_ms=") {
+		t.Fatalf("expected stream timings on completion:\n%s", logs)
+	}
+	if phaseSeconds.Count("timing-test:2", PhaseStream) != 1 {
+		t.Fatal("stream phase not exported")
+	}
+	if streamSeconds.Count("timing-test:2", "", "") != 1 {
+		t.Fatal("stream duration not exported")
+	}
+}
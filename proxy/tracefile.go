@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// maxTraceBody caps each body kept in a trace file
+const maxTraceBody = 1 << 20
+
+// traceSeq keeps trace file names unique within a millisecond
+var traceSeq atomic.Uint64
+
+// requestTrace is one request's trace file: every stage from the client's request to the
+// reply it got. Redacted text stays masked, log_redact fields are hidden, and base64
+// images are shown by length.
+type requestTrace struct {
+	Start      time.Time            `json:"start"`
+	Listen     string               `json:"listen"`
+	Method     string               `json:"method"`
+	Path       string               `json:"path"` // With the query, as received
+	Routes     []int                `json:"matched_routes"`
+	Rejection  string               `json:"rejection,omitempty"`
+	Request    traceMessage         `json:"request"`            // As received from the client
+	Actions    []config.FiredAction `json:"actions,omitempty"`  // Actions whose when matched, with diffs
+	Outbound   traceMessage         `json:"outbound"`           // As sent to the target
+	Upstream   *traceMessage        `json:"upstream,omitempty"` // As the target answered; absent for rejections
+	Response   *traceMessage        `json:"response,omitempty"` // As sent to the client
+	Error      string               `json:"error,omitempty"`
+	DurationMS float64              `json:"duration_ms"`
+
+	mu       sync.Mutex
+	dir      string
+	mask     func(string) string
+	redact   config.LogRedact
+	upstream bytes.Buffer
+	response bytes.Buffer
+	written  bool
+}
+
+// traceMessage is a request or response at one stage
+type traceMessage struct {
+	URL       string              `json:"url,omitempty"`
+	Status    int                 `json:"status,omitempty"`
+	Headers   map[string][]string `json:"headers,omitempty"`
+	Body      any                 `json:"body,omitempty"` // Inline when JSON, otherwise text
+	Truncated bool                `json:"truncated,omitempty"`
+}
+
+// tracing reports whether a request matching routes gets a trace file
+func (h *Handler) tracing(routes []*config.Route) bool {
+	return h.cfg.TraceAll || slices.ContainsFunc(routes, func(r *config.Route) bool { return r.Trace })
+}
+
+// startTrace captures a request once ModifyRequest has decided everything about it. uri is
+// the request as received; the proxy doesn't change headers, so they are kept once.
+func (h *Handler) startTrace(req *http.Request, uri string, body, upstreamBody []byte, matched *responseRouteContext, state *config.ActionState) *requestTrace {
+	t := &requestTrace{
+		Start:   time.Now(),
+		Listen:  h.cfg.Listen,
+		Method:  req.Method,
+		Path:    uri,
+		Routes:  matched.indices,
+		Actions: slices.Clone(state.Fired),
+		dir:     h.cfg.TraceDir,
+		mask:    state.Masker(),
+		redact:  h.cfg.LogRedact,
+	}
+	if t.Routes == nil {
+		t.Routes = []int{}
+	}
+	if rej := matched.rejection; rej != nil {
+		t.Rejection = rej.Code + ": " + rej.Message
+	}
+	t.Request = t.message("", 0, req.Header, body)
+	t.Outbound = t.message(req.URL.String(), 0, nil, upstreamBody)
+	return t
+}
+
+// message renders one stage, hiding what logs and the dashboard hide
+func (t *requestTrace) message(url string, status int, headers http.Header, body []byte) traceMessage {
+	m := traceMessage{URL: url, Status: status}
+	if headers != nil {
+		m.Headers = sanitizeHeaders(headers)
+	}
+	if len(body) > maxTraceBody {
+		body, m.Truncated = body[:maxTraceBody], true
+	}
+	if json.Valid(body) {
+		body = redactBody(body, t.redact)
+	} else {
+		// Streams are redacted event by event
+		lines := bytes.Split(body, []byte("\n"))
+		for i, line := range lines {
+			lines[i] = redactBody(line, t.redact)
+		}
+		body = bytes.Join(lines, []byte("\n"))
+	}
+	body = elideImageData(body)
+	if t.mask != nil {
+		body = []byte(t.mask(string(body)))
+	}
+	if json.Valid(body) {
+		m.Body = json.RawMessage(body)
+	} else if len(body) > 0 {
+		m.Body = string(body)
+	}
+	return m
+}
+
+// captureUpstream tees the target's response body into the trace as it is read
+func (t *requestTrace) captureUpstream(resp *http.Response) (status int, headers http.Header) {
+	if resp.Body != nil {
+		resp.Body = &traceBody{ReadCloser: resp.Body, trace: t, buf: &t.upstream}
+	}
+	return resp.StatusCode, resp.Header.Clone()
+}
+
+// captureResponse tees the body sent to the client and writes the trace when it ends
+func (t *requestTrace) captureResponse(resp *http.Response, upstreamStatus int, upstreamHeaders http.Header, responseFired []config.FiredAction) {
+	t.mu.Lock()
+	t.Actions = append(t.Actions, responseFired...)
+	if t.Rejection == "" {
+		t.Upstream = &traceMessage{Status: upstreamStatus, Headers: upstreamHeaders}
+	}
+	t.Response = &traceMessage{Status: resp.StatusCode, Headers: resp.Header.Clone()}
+	t.mu.Unlock()
+
+	if resp.Body == nil {
+		t.write()
+		return
+	}
+	resp.Body = &traceBody{ReadCloser: resp.Body, trace: t, buf: &t.response, final: true}
+}
+
+// fail records an upstream error and writes the trace
+func (t *requestTrace) fail(err error) {
+	t.mu.Lock()
+	t.Error = err.Error()
+	t.mu.Unlock()
+	t.write()
+}
+
+// write saves the trace once, named by its start time
+func (t *requestTrace) write() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.written {
+		return
+	}
+	t.written = true
+	t.DurationMS = float64(time.Since(t.Start).Microseconds()) / 1000
+	if t.Upstream != nil {
+		*t.Upstream = t.message("", t.Upstream.Status, t.Upstream.Headers, t.upstream.Bytes())
+	}
+	if t.Response != nil {
+		*t.Response = t.message("", t.Response.Status, t.Response.Headers, t.response.Bytes())
+	}
+
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode request trace", "method", t.Method, "path", t.Path, "err", err)
+		return
+	}
+	name := fmt.Sprintf("%s-%06d.json", t.Start.UTC().Format("20060102T150405.000"), traceSeq.Add(1))
+	path := filepath.Join(t.dir, name)
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		logger.Error("Failed to create trace directory", "dir", t.dir, "err", err)
+		return
+	}
+	// Traces hold full bodies, so only the owner can read them
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		logger.Error("Failed to write request trace", "path", path, "err", err)
+		return
+	}
+	logger.Info("Wrote request trace", "method", t.Method, "path", t.Path, "file", path)
+}
+
+// traceBody copies what is read through it into a trace buffer, up to maxTraceBody
+type traceBody struct {
+	io.ReadCloser
+	trace *requestTrace
+	buf   *bytes.Buffer
+	final bool // The client's body; ending it writes the trace
+}
+
+func (b *traceBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.trace.mu.Lock()
+		if room := maxTraceBody + 1 - b.buf.Len(); room > 0 {
+			b.buf.Write(p[:min(n, room)])
+		}
+		b.trace.mu.Unlock()
+	}
+	if err == io.EOF && b.final {
+		b.trace.write()
+	}
+	return n, err
+}
+
+func (b *traceBody) Close() error {
+	if b.final {
+		b.trace.write()
+	}
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestTraceFileCoversEveryStage(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newTestConfig("http://localhost:9000", []config.Route{
+		{
+			Methods:    newPatternField("POST"),
+			Paths:      newPatternField("^/v1/chat/completions$"),
+			Trace:      true,
+			OnRequest:  []config.Action{{Merge: map[string]any{"temperature": 0.2}}},
+			OnResponse: []config.Action{{Merge: map[string]any{"served_by": "proxy"}}},
+		},
+		{
+			Methods:   newPatternField("POST"),
+			Paths:     newPatternField("^/v1/embeddings$"),
+			OnRequest: []config.Action{{Merge: map[string]any{"truncate": true}}},
+		},
+	})
+	cfg.Proxies[0].TraceDir = dir
+	cfg.Proxies[0].LogRedact = config.LogRedact{Paths: []string{"api_secret"}}
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+
+	roundTrip := func(path, reqBody, respBody string) {
+		req := httptest.NewRequest("POST", "http://gpu:8080"+path+"?v=1", bytes.NewBufferString(reqBody))
+		req.Header.Set("Authorization", "Bearer sk-secret")
+		h.ModifyRequest(req)
+		resp := &http.Response{
+			Request:    req,
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewBufferString(respBody)),
+		}
+		if err := h.ModifyResponse(resp); err != nil {
+			t.Fatalf("ModifyResponse: %v", err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	roundTrip("/v1/embeddings", `{"input":"x"}`, `{"data":[]}`)
+	roundTrip("/v1/chat/completions", `{"model":"m","temperature":1,"api_secret":"hunter2"}`, `{"id":"r1"}`)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("trace files = %v, want one for the traced route", files)
+	}
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "hunter2") || strings.Contains(string(raw), "sk-secret") {
+		t.Fatalf("trace keeps secrets:\n%s", raw)
+	}
+
+	var trace struct {
+		Path     string               `json:"path"`
+		Routes   []int                `json:"matched_routes"`
+		Request  traceMessage         `json:"request"`
+		Actions  []config.FiredAction `json:"actions"`
+		Outbound struct {
+			URL  string         `json:"url"`
+			Body map[string]any `json:"body"`
+		} `json:"outbound"`
+		Upstream struct {
+			Status int            `json:"status"`
+			Body   map[string]any `json:"body"`
+		} `json:"upstream"`
+		Response struct {
+			Body map[string]any `json:"body"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(raw, &trace); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, raw)
+	}
+	if trace.Path != "/v1/chat/completions?v=1" || len(trace.Routes) != 1 || trace.Routes[0] != 0 {
+		t.Fatalf("trace = %+v, want the chat request and route 0", trace)
+	}
+	if len(trace.Actions) != 2 || trace.Actions[0].Phase != "request" || trace.Actions[1].Phase != "response" || len(trace.Actions[0].Diff) == 0 {
+		t.Fatalf("actions = %+v, want request and response actions with diffs", trace.Actions)
+	}
+	if trace.Outbound.URL != "http://gpu:8080/v1/chat/completions?v=1" || trace.Outbound.Body["temperature"] != 0.2 {
+		t.Fatalf("outbound = %+v, want the merged body sent to gpu", trace.Outbound)
+	}
+	if trace.Upstream.Status != http.StatusOK || trace.Upstream.Body["served_by"] != nil {
+		t.Fatalf("upstream = %+v, want the reply before on_response", trace.Upstream)
+	}
+	if trace.Response.Body["served_by"] != "proxy" {
+		t.Fatalf("response = %+v, want the reply after on_response", trace.Response)
+	}
+}
+
+func TestTraceAllWritesUpstreamErrors(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newTestConfig("http://localhost:9000", nil)
+	cfg.Proxies[0].TraceDir = dir
+	cfg.Proxies[0].TraceAll = true
+	h := NewHandler(cfg.Proxies[0])
+
+	req := httptest.NewRequest("GET", "http://gpu:8080/v1/models", nil)
+	h.ModifyRequest(req)
+	RecordError(req, http.StatusBadGateway, errors.New("connection refused"))
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("trace files = %v, want one", files)
+	}
+	raw, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(raw), `"error": "connection refused"`) || strings.Contains(string(raw), `"response"`) {
+		t.Fatalf("trace = %s, want the error and no response", raw)
+	}
+}
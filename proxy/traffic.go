@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/traffic"
+)
+
+// startExchange records a request for the dashboard once ModifyRequest has decided
+// everything about it. Redacted text is masked in bodies and diffs.
+func (h *Handler) startExchange(req *http.Request, path string, body, upstreamBody []byte, matched *responseRouteContext, state *config.ActionState) uint64 {
+	mask := state.Masker()
+	masked := func(b []byte) string {
+		s := string(elideImageData(b))
+		if mask != nil {
+			s = mask(s)
+		}
+		return s
+	}
+
+	e := traffic.Exchange{
+		Listen:          h.cfg.Listen,
+		Method:          req.Method,
+		Path:            path,
+		Target:          req.URL.Host,
+		UpstreamPath:    req.URL.RequestURI(),
+		Model:           matched.model,
+		Request:         masked(body),
+		UpstreamRequest: masked(upstreamBody),
+	}
+	for i, index := range matched.indices {
+		e.Routes = append(e.Routes, traffic.Route{Index: index, Name: matched.rules[i].Name})
+	}
+	if len(state.Fired) > 0 {
+		fired, _ := json.Marshal(state.Fired)
+		e.Fired = json.RawMessage(masked(fired))
+	}
+	if rej := matched.rejection; rej != nil {
+		e.Rejection = rej.Code + ": " + rej.Message
+	}
+	matched.mask = mask
+	return traffic.Default.Start(e)
+}
+
+// recordResponse tees the response body sent to the client into the exchange
+func recordResponse(resp *http.Response, id uint64, mask func(string) string) {
+	traffic.Default.Respond(id, resp.StatusCode, isStreamingContentType(resp.Header.Get("Content-Type")))
+	if resp.Body == nil {
+		traffic.Default.Finish(id)
+		return
+	}
+	resp.Body = &recordingBody{ReadCloser: resp.Body, id: id, mask: mask}
+}
+
+type recordingBody struct {
+	io.ReadCloser
+	id   uint64
+	mask func(string) string
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		chunk := p[:n]
+		if b.mask != nil {
+			chunk = []byte(b.mask(string(chunk)))
+		}
+		traffic.Default.Chunk(b.id, elideImageData(chunk))
+	}
+	if err == io.EOF {
+		traffic.Default.Finish(b.id)
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	traffic.Default.Finish(b.id)
+	return b.ReadCloser.Close()
+}
+
+// RecordError marks a request's exchange as failed, and writes its trace, when the upstream
+// call errors
+func RecordError(req *http.Request, status int, err error) {
+	v, ok := req.Context().Value(routeContextKey).(*responseRouteContext)
+	if !ok || v == nil {
+		return
+	}
+	if v.exchange != 0 {
+		traffic.Default.Fail(v.exchange, status, err)
+	}
+	if v.trace != nil {
+		v.trace.fail(err)
+	}
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/traffic"
+)
+
+func TestExchangeRecordedWithRedactionMasked(t *testing.T) {
+	traffic.Default.Configure(10, 64*1024)
+	t.Cleanup(func() { traffic.Default.Configure(0, 0) })
+
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Name:    "private",
+		Methods: newPatternField("POST"),
+		Paths:   newPatternField("^/v1/chat/completions$"),
+		OnRequest: []config.Action{
+			{Redact: &config.RedactPolicy{Patterns: []string{"email"}, Restore: true}},
+			{Merge: map[string]any{"temperature": 0.2}},
+		},
+	}})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	routes := cfg.Proxies[0].Routes
+
+	req := httptest.NewRequest("POST", "http://gpu:8080/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"m","temperature":1,"messages":[{"role":"user","content":"mail ada@example.com"}]}`))
+	ModifyRequest(req, routes)
+
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(`{"choices":[{"message":{"role":"assistant","content":"wrote to [EMAIL_1]"}}]}`)),
+	}
+	if err := ModifyResponse(resp, routes); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	sent, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(sent), "ada@example.com") {
+		t.Fatalf("client reply = %s, want the address restored", sent)
+	}
+
+	recent := traffic.Default.Recent()
+	if len(recent) != 1 {
+		t.Fatalf("recorded %d exchanges, want 1", len(recent))
+	}
+	e, _ := traffic.Default.Get(recent[0].ID)
+	if e.Target != "gpu:8080" || e.Status != http.StatusOK || !e.Done || e.Model != "m" {
+		t.Fatalf("exchange = %+v, want a finished 200 from gpu:8080", e)
+	}
+	if len(e.Routes) != 1 || e.Routes[0].Name != "private" {
+		t.Fatalf("routes = %+v, want private", e.Routes)
+	}
+	if !strings.Contains(string(e.Fired), `"path":"temperature"`) {
+		t.Fatalf("fired = %s, want the temperature diff", e.Fired)
+	}
+	for name, text := range map[string]string{"request": e.Request, "upstream": e.UpstreamRequest, "response": e.Response, "fired": string(e.Fired)} {
+		if strings.Contains(text, "ada@example.com") {
+			t.Errorf("%s keeps redacted text: %s", name, text)
+		}
+	}
+	if !strings.Contains(e.Response, "[EMAIL_1]") {
+		t.Fatalf("response = %s, want the placeholder", e.Response)
+	}
+}
@@ -0,0 +1,24 @@
+package proxy
+
+import "net/http"
+
+// keepChunked drops the Content-Length a buffered reply was given, so a reply the backend
+// sent chunked reaches the client chunked, with the backend's trailers after the body
+func keepChunked(resp *http.Response) {
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+}
+
+// forwardTrailers copies the trailers matching forward_trailers into the reply's headers,
+// for clients that can't read trailers (ex: usage stats some backends send last). The
+// reply has been read by now, so its trailers are known; they are still sent as trailers.
+func (h *Handler) forwardTrailers(resp *http.Response) {
+	if h.cfg.ForwardTrailers.Len() == 0 {
+		return
+	}
+	for name, values := range resp.Trailer {
+		if len(values) > 0 && h.cfg.ForwardTrailers.Matches(name) {
+			resp.Header[name] = values
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// trailerBody fills in trailers at EOF, the way a chunked reply's body does
+type trailerBody struct {
+	io.Reader
+	trailer  http.Header
+	trailers http.Header
+}
+
+func (b *trailerBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF {
+		for name, values := range b.trailers {
+			b.trailer[name] = values
+		}
+	}
+	return n, err
+}
+
+func (b *trailerBody) Close() error { return nil }
+
+func TestModifyResponseKeepsChunkedTrailers(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods:    newPatternField("POST"),
+		Paths:      newPatternField(".*"),
+		OnResponse: []config.Action{{Merge: map[string]any{"edited": true}}},
+	}})
+	cfg.Proxies[0].ForwardTrailers = newPatternField("^X-")
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	h := NewHandler(cfg.Proxies[0])
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(`{}`))
+	h.ModifyRequest(req)
+
+	trailer := http.Header{"X-Usage-Tokens": nil, "Server-Timing": nil}
+	resp := &http.Response{
+		Request:       req,
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		ContentLength: -1,
+		Trailer:       trailer,
+	}
+	resp.Body = &trailerBody{
+		Reader:   strings.NewReader(`{"id":"a"}`),
+		trailer:  trailer,
+		trailers: http.Header{"X-Usage-Tokens": {"42"}, "Server-Timing": {"gen;dur=9"}},
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse error: %v", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"edited":true`) {
+		t.Fatalf("body = %s, want it edited", body)
+	}
+	if resp.ContentLength != -1 || resp.Header.Get("Content-Length") != "" {
+		t.Errorf("ContentLength = %d, Content-Length = %q, want the reply left chunked", resp.ContentLength, resp.Header.Get("Content-Length"))
+	}
+	if resp.Trailer.Get("X-Usage-Tokens") != "42" || resp.Trailer.Get("Server-Timing") == "" {
+		t.Errorf("trailers = %v, want both kept", resp.Trailer)
+	}
+	if resp.Header.Get("X-Usage-Tokens") != "42" || resp.Header.Get("Server-Timing") != "" {
+		t.Errorf("headers = %v, want only the forward_trailers match copied", resp.Header)
+	}
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// Transformer is a transform written in Go that runs alongside a proxy's YAML routes, for
+// programs that embed Handler. Bodies are the decoded JSON (or multipart fields) and are
+// edited in place; they are nil when the body is not JSON. Replies and stream chunks are
+// in the client's dialect, after any format translation.
+//
+// Returning a *Rejection from OnRequest answers the client with it instead of calling the
+// backend, and from OnResponse replaces the reply; other request errors answer 500
+// transform_failed. Response and stream chunk errors are logged and the body passes on.
+type Transformer interface {
+	OnRequest(req *http.Request, body map[string]any) error
+	OnResponse(resp *http.Response, body map[string]any) error
+	OnStreamChunk(resp *http.Response, chunk map[string]any) error
+}
+
+// TransformFuncs adapts plain functions to Transformer; nil functions are skipped
+type TransformFuncs struct {
+	Request     func(req *http.Request, body map[string]any) error
+	Response    func(resp *http.Response, body map[string]any) error
+	StreamChunk func(resp *http.Response, chunk map[string]any) error
+}
+
+func (f TransformFuncs) OnRequest(req *http.Request, body map[string]any) error {
+	if f.Request == nil {
+		return nil
+	}
+	return f.Request(req, body)
+}
+
+func (f TransformFuncs) OnResponse(resp *http.Response, body map[string]any) error {
+	if f.Response == nil {
+		return nil
+	}
+	return f.Response(resp, body)
+}
+
+func (f TransformFuncs) OnStreamChunk(resp *http.Response, chunk map[string]any) error {
+	if f.StreamChunk == nil {
+		return nil
+	}
+	return f.StreamChunk(resp, chunk)
+}
+
+// Stage places a transformer relative to the routes' actions
+type Stage int
+
+const (
+	BeforeRoutes Stage = iota // Before on_request / on_response actions (requests see resolved model aliases)
+	AfterRoutes               // After them; requests are still in the client's dialect
+)
+
+// transformers holds a handler's Go transforms by stage, in registration order
+type transformers [2][]Transformer
+
+// Use registers t to run at stage on every request and response, matched by a route or
+// not. Transformers in the same stage run in the order they were added. Call Use before
+// the handler serves requests.
+func (h *Handler) Use(stage Stage, t Transformer) {
+	h.transformers[stage] = append(h.transformers[stage], t)
+}
+
+func (ts *transformers) empty() bool {
+	return len(ts[BeforeRoutes]) == 0 && len(ts[AfterRoutes]) == 0
+}
+
+// onRequest runs one stage against a request, returning the rejection to answer with
+func (ts *transformers) onRequest(stage Stage, req *http.Request, body map[string]any) *Rejection {
+	for _, t := range ts[stage] {
+		if err := t.OnRequest(req, body); err != nil {
+			return transformRejection(err, req)
+		}
+	}
+	return nil
+}
+
+// onResponse runs one stage against a reply, returning a rejection that replaces it
+func (ts *transformers) onResponse(stage Stage, resp *http.Response, body map[string]any) *Rejection {
+	for _, t := range ts[stage] {
+		err := t.OnResponse(resp, body)
+		var rejection *Rejection
+		if errors.As(err, &rejection) {
+			return rejection
+		}
+		if err != nil {
+			logger.Error("Response transformer failed", "method", resp.Request.Method, "path", resp.Request.URL.Path, "err", err)
+		}
+	}
+	return nil
+}
+
+// onStreamChunk runs one stage against a stream chunk
+func (ts *transformers) onStreamChunk(stage Stage, resp *http.Response, chunk map[string]any) {
+	for _, t := range ts[stage] {
+		if err := t.OnStreamChunk(resp, chunk); err != nil {
+			logger.Error("Stream transformer failed", "method", resp.Request.Method, "path", resp.Request.URL.Path, "err", err)
+		}
+	}
+}
+
+func transformRejection(err error, req *http.Request) *Rejection {
+	var rejection *Rejection
+	if errors.As(err, &rejection) {
+		return rejection
+	}
+	logger.Error("Request transformer failed", "method", req.Method, "path", req.URL.Path, "err", err)
+	return &Rejection{
+		Status:  http.StatusInternalServerError,
+		Type:    "server_error",
+		Code:    "transform_failed",
+		Message: "request transform failed",
+	}
+}
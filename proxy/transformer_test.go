@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// newTransformHandler returns a handler whose chat route merges temperature 0.7
+func transformRoute() config.Route {
+	return config.Route{
+		OnRequest:  []config.Action{{Merge: map[string]any{"temperature": 0.7}}},
+		OnResponse: []config.Action{{Merge: map[string]any{"route": true}}},
+	}
+}
+
+func TestTransformerRequestStages(t *testing.T) {
+	h := newRouteHandler(t, transformRoute(), nil)
+	var seen []string
+	h.Use(AfterRoutes, TransformFuncs{Request: func(req *http.Request, body map[string]any) error {
+		seen = append(seen, "after:"+strconv.FormatFloat(body["temperature"].(float64), 'g', -1, 64))
+		body["user"] = req.Header.Get("X-User")
+		return nil
+	}})
+	h.Use(BeforeRoutes, TransformFuncs{Request: func(_ *http.Request, body map[string]any) error {
+		seen = append(seen, "before:"+body["model"].(string))
+		body["temperature"] = 0.1
+		return nil
+	}})
+	h.Use(BeforeRoutes, TransformFuncs{Request: func(_ *http.Request, body map[string]any) error {
+		seen = append(seen, "before-2")
+		return nil
+	}})
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(`{"model":"m","messages":[]}`))
+	req.Header.Set("X-User", "alice")
+	h.ModifyRequest(req)
+
+	if got := strings.Join(seen, ","); got != "before:m,before-2,after:0.7" {
+		t.Fatalf("call order = %s", got)
+	}
+	var sent map[string]any
+	if err := json.NewDecoder(req.Body).Decode(&sent); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if sent["user"] != "alice" || sent["temperature"] != 0.7 {
+		t.Fatalf("upstream body = %v", sent)
+	}
+
+	// Requests no route matches still reach transformers, with nil for non-JSON bodies
+	seen = nil
+	other := httptest.NewRequest("POST", "http://example.com/v1/audio/speech", strings.NewReader("raw"))
+	h.transformers = transformers{}
+	h.Use(BeforeRoutes, TransformFuncs{Request: func(_ *http.Request, body map[string]any) error {
+		seen = append(seen, "nil="+strconv.FormatBool(body == nil))
+		return nil
+	}})
+	h.ModifyRequest(other)
+	if got := strings.Join(seen, ","); got != "nil=true" {
+		t.Fatalf("unmatched request: %s", got)
+	}
+}
+
+func TestTransformerRequestRejection(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"rejection", &Rejection{Status: http.StatusForbidden, Type: "permission_error", Code: "blocked", Message: "not allowed"}, http.StatusForbidden, "blocked"},
+		{"other error", errors.New("lookup failed"), http.StatusInternalServerError, "transform_failed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHandler(config.ProxyConfig{})
+			h.Use(AfterRoutes, TransformFuncs{Request: func(*http.Request, map[string]any) error { return tc.err }})
+
+			req := httptest.NewRequest("POST", "http://example.com/v1/embeddings", strings.NewReader(`{"input":"x"}`))
+			h.ModifyRequest(req)
+			resp, err := NewTransport(failingTransport{t}).RoundTrip(req)
+			if err != nil {
+				t.Fatalf("round trip: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tc.status || !strings.Contains(string(body), tc.code) {
+				t.Fatalf("got %d %s", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestTransformerResponse(t *testing.T) {
+	h := newRouteHandler(t, transformRoute(), nil)
+	var routeSeen any
+	h.Use(BeforeRoutes, TransformFuncs{Response: func(_ *http.Response, body map[string]any) error {
+		body["before"] = true
+		return nil
+	}})
+	h.Use(AfterRoutes, TransformFuncs{Response: func(_ *http.Response, body map[string]any) error {
+		routeSeen = body["route"]
+		delete(body, "id")
+		return nil
+	}})
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(`{"model":"m","messages":[]}`))
+	h.ModifyRequest(req)
+	reply := `{"id":"chatcmpl-1","choices":[]}`
+	resp := &http.Response{
+		Request:       req,
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"application/json"}, "Content-Length": {strconv.Itoa(len(reply))}},
+		Body:          io.NopCloser(strings.NewReader(reply)),
+		ContentLength: int64(len(reply)),
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	var got map[string]any
+	json.Unmarshal(body, &got)
+	if got["before"] != true || got["route"] != true || got["id"] != nil || routeSeen != true {
+		t.Fatalf("reply = %s (after stage saw route=%v)", body, routeSeen)
+	}
+	if resp.Header.Get("Content-Length") != strconv.Itoa(len(body)) {
+		t.Fatalf("Content-Length header %s, body is %d bytes", resp.Header.Get("Content-Length"), len(body))
+	}
+}
+
+func TestTransformerResponseRejection(t *testing.T) {
+	h := NewHandler(config.ProxyConfig{})
+	h.Use(AfterRoutes, TransformFuncs{Response: func(*http.Response, map[string]any) error {
+		return &Rejection{Status: http.StatusBadGateway, Type: "invalid_response_error", Code: "unsafe_reply", Message: "reply withheld"}
+	}})
+
+	req := httptest.NewRequest("GET", "http://example.com/v1/models", nil)
+	h.ModifyRequest(req)
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"data":[]}`)),
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(string(body), "unsafe_reply") {
+		t.Fatalf("got %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestTransformerStreamChunks(t *testing.T) {
+	h := newRouteHandler(t, transformRoute(), nil)
+	h.Use(BeforeRoutes, TransformFuncs{StreamChunk: func(_ *http.Response, chunk map[string]any) error {
+		chunk["seen"] = chunk["route"] == nil
+		return nil
+	}})
+	var afterSawRoute []any
+	h.Use(AfterRoutes, TransformFuncs{StreamChunk: func(_ *http.Response, chunk map[string]any) error {
+		afterSawRoute = append(afterSawRoute, chunk["route"])
+		return nil
+	}})
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions", strings.NewReader(`{"model":"m","stream":true,"messages":[]}`))
+	h.ModifyRequest(req)
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader("data: {\"choices\":[]}\n\ndata: [DONE]\n\n")),
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"seen":true`) || !strings.Contains(string(body), `"route":true`) || !strings.Contains(string(body), "[DONE]") {
+		t.Fatalf("stream = %s", body)
+	}
+	if len(afterSawRoute) != 1 || afterSawRoute[0] != true {
+		t.Fatalf("after stage should see route actions applied, saw %v", afterSawRoute)
+	}
+}
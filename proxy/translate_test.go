@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestModifyRequestAppliesFormatProfile(t *testing.T) {
+	h := newRouteHandler(t, config.Route{Format: "openai-to-ollama"}, nil)
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"llama3","max_tokens":32,"messages":[{"role":"user","content":"hi"}]}`))
+	h.ModifyRequest(req)
+
+	if req.URL.Path != "/api/chat" {
+		t.Fatalf("path = %s, want /api/chat", req.URL.Path)
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data["options"].(map[string]any)["num_predict"] != 32.0 {
+		t.Fatalf("expected max_tokens translated to options.num_predict, got %v", data)
+	}
+}
+
+func TestModifyResponseTranslatesOllamaStreamToSSE(t *testing.T) {
+	h := newRouteHandler(t, config.Route{
+		Format:     "openai-to-ollama",
+		OnResponse: []config.Action{{Merge: map[string]any{"served_by": "proxy"}}},
+	}, nil)
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"llama3","stream":true,"messages":[]}`))
+	h.ModifyRequest(req)
+
+	upstream := `{"model":"llama3","message":{"role":"assistant","content":"Hel"},"done":false}
+{"model":"llama3","message":{"role":"assistant","content":"lo"},"done":false}
+{"model":"llama3","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","eval_count":2}
+`
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/x-ndjson"}},
+		Body:       io.NopCloser(strings.NewReader(upstream)),
+	}
+
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %s, want text/event-stream", ct)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	var events []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if line != "" {
+			events = append(events, line)
+		}
+	}
+	if len(events) != 4 || events[3] != "data: [DONE]" {
+		t.Fatalf("expected 3 chunks plus [DONE], got %q", events)
+	}
+
+	var last map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(events[2], "data: ")), &last); err != nil {
+		t.Fatalf("unmarshal final chunk: %v", err)
+	}
+	if last["object"] != "chat.completion.chunk" || last["served_by"] != "proxy" {
+		t.Fatalf("expected translated chunk with on_response applied, got %v", last)
+	}
+	if last["choices"].([]any)[0].(map[string]any)["finish_reason"] != "stop" {
+		t.Fatalf("expected finish_reason on final chunk, got %v", last)
+	}
+}
+
+func TestModifyResponseFramesAnthropicEvents(t *testing.T) {
+	h := newRouteHandler(t, config.Route{Format: "anthropic-to-openai"}, nil)
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"m","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	h.ModifyRequest(req)
+
+	upstream := "data: {\"model\":\"m\",\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n" +
+		"data: [DONE]\n\n"
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(upstream)),
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	out := string(body)
+	for _, want := range []string{
+		"event: message_start\ndata: {",
+		"event: content_block_delta\ndata: {",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("stream missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "[DONE]") {
+		t.Fatalf("anthropic streams have no [DONE] marker:\n%s", out)
+	}
+}
+
+func TestModifyRequestRendersPromptTemplate(t *testing.T) {
+	cfg := newTestConfig("http://localhost:9000", []config.Route{{
+		Methods: newPatternField("POST"),
+		Paths:   newPatternField("^/v1/chat/completions$"),
+		Prompt: &config.PromptConfig{
+			Models: map[string]string{"base-model": "chatml"},
+			Stop:   []string{"</answer>"},
+		},
+	}})
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := config.CompileTemplates(cfg); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	routes := cfg.Proxies[0].Routes
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"base-model","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`))
+	ModifyRequest(req, routes)
+
+	if req.URL.Path != "/completion" {
+		t.Fatalf("path = %s, want /completion", req.URL.Path)
+	}
+	body, _ := io.ReadAll(req.Body)
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := "<|im_start|>system\nbe brief<|im_end|>\n<|im_start|>user\nhi<|im_end|>\n<|im_start|>assistant\n"
+	if data["prompt"] != want {
+		t.Fatalf("prompt = %q, want %q", data["prompt"], want)
+	}
+	if stop := data["stop"].([]any); len(stop) != 2 || stop[0] != "<|im_end|>" || stop[1] != "</answer>" {
+		t.Fatalf("stop = %v", stop)
+	}
+
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"content":"hello","stop":true,"stop_type":"eos"}`)),
+	}
+	if err := ModifyResponse(resp, routes); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	var chat map[string]any
+	if err := json.Unmarshal(respBody, &chat); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if chat["object"] != "chat.completion" {
+		t.Fatalf("expected chat completion, got %v", chat)
+	}
+
+	// Models without a template stay chat requests
+	other := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"instruct-model","messages":[{"role":"user","content":"hi"}]}`))
+	ModifyRequest(other, routes)
+	if other.URL.Path != "/v1/chat/completions" {
+		t.Fatalf("untemplated model path = %s", other.URL.Path)
+	}
+}
+
+func TestModifyResponseNormalizesErrorForFormat(t *testing.T) {
+	h := newRouteHandler(t, config.Route{Format: "openai-to-ollama"}, nil)
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"missing","messages":[]}`))
+	h.ModifyRequest(req)
+
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+		Body:       io.NopCloser(strings.NewReader(`{"error":"model \"missing\" not found, try pulling it first"}`)),
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatalf("unmarshal %s: %v", body, err)
+	}
+	errBody, _ := data["error"].(map[string]any)
+	if errBody["type"] != "not_found_error" || !strings.Contains(errBody["message"].(string), "not found") {
+		t.Fatalf("expected OpenAI error shape, got %s", body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %s, want application/json", ct)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// UpstreamStatus returns the status for a failed upstream call: 504 for timeouts, else 502
+func UpstreamStatus(err error) int {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// WriteUpstreamError answers a request whose upstream connection failed or timed out with
+// the proxy's error_response, or Go's plain-text 502 when there is none. It returns the
+// status sent.
+func WriteUpstreamError(w http.ResponseWriter, req *http.Request, cfg *config.ErrorResponse, err error) int {
+	if cfg == nil {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return http.StatusBadGateway
+	}
+
+	rej := &Rejection{Status: UpstreamStatus(err), Type: "upstream_error", Code: "upstream_unreachable", Message: "the backend could not be reached"}
+	if rej.Status == http.StatusGatewayTimeout {
+		rej.Code = "upstream_timeout"
+		rej.Message = "the backend did not respond in time"
+	}
+	if cfg.Status != 0 {
+		rej.Status = cfg.Status
+	}
+
+	body := rej.body()
+	if cfg.Compiled != nil {
+		var out bytes.Buffer
+		data := map[string]any{
+			"status":  rej.Status,
+			"code":    rej.Code,
+			"message": rej.Message,
+			"error":   err.Error(),
+			"method":  req.Method,
+			"path":    req.URL.Path,
+		}
+		if execErr := cfg.Compiled.Execute(&out, data); execErr != nil {
+			logger.Error("Failed to render error_response body", "err", execErr)
+		} else if !json.Valid(out.Bytes()) {
+			logger.Error("error_response body is not JSON", "body", out.String())
+		} else {
+			body = out.Bytes()
+		}
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	for name, value := range cfg.Headers {
+		header.Set(name, value)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(rej.Status)
+	w.Write(body)
+	return rej.Status
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+func TestWriteUpstreamError(t *testing.T) {
+	refused := errors.New("dial tcp 127.0.0.1:8080: connect: connection refused")
+	timeout := fmt.Errorf("read: %w", context.DeadlineExceeded)
+
+	tests := []struct {
+		name       string
+		cfg        *config.ErrorResponse
+		err        error
+		wantStatus int
+		wantType   string
+		wantBody   string
+	}{
+		{name: "unset keeps plain text", err: refused, wantStatus: http.StatusBadGateway, wantType: "text/plain; charset=utf-8", wantBody: "Bad Gateway\n"},
+		{name: "default body", cfg: &config.ErrorResponse{}, err: refused, wantStatus: http.StatusBadGateway, wantType: "application/json",
+			wantBody: `{"error":{"code":"upstream_unreachable","message":"the backend could not be reached","type":"upstream_error"}}`},
+		{name: "timeout", cfg: &config.ErrorResponse{}, err: timeout, wantStatus: http.StatusGatewayTimeout, wantType: "application/json",
+			wantBody: `{"error":{"code":"upstream_timeout","message":"the backend did not respond in time","type":"upstream_error"}}`},
+		{name: "template", cfg: &config.ErrorResponse{Status: 503, Headers: map[string]string{"Retry-After": "5"}, Body: `{"detail": {{ toJson .code }}, "path": {{ toJson .path }}, "status": {{ .status }}}`},
+			err: refused, wantStatus: http.StatusServiceUnavailable, wantType: "application/json",
+			wantBody: `{"detail": "upstream_unreachable", "path": "/v1/models", "status": 503}`},
+		{name: "invalid JSON falls back", cfg: &config.ErrorResponse{Body: `not json`}, err: refused, wantStatus: http.StatusBadGateway, wantType: "application/json",
+			wantBody: `{"error":{"code":"upstream_unreachable","message":"the backend could not be reached","type":"upstream_error"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cfg != nil {
+				if err := tt.cfg.Validate(); err != nil {
+					t.Fatalf("validate: %v", err)
+				}
+			}
+			rec := httptest.NewRecorder()
+			status := WriteUpstreamError(rec, httptest.NewRequest("GET", "http://example.com/v1/models", nil), tt.cfg, tt.err)
+			if status != tt.wantStatus || rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d (sent %d), want %d", status, rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+				t.Fatalf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Fatalf("body = %s, want %s", rec.Body.String(), tt.wantBody)
+			}
+			if tt.cfg != nil && tt.cfg.Headers != nil && rec.Header().Get("Retry-After") != "5" {
+				t.Fatal("expected configured headers on the reply")
+			}
+			if tt.wantType == "application/json" && !json.Valid(rec.Body.Bytes()) {
+				t.Fatal("expected a JSON body")
+			}
+		})
+	}
+}
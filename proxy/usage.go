@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+	"github.com/spicyneuron/llama-matchmaker/usage"
+)
+
+var (
+	tokensTotal = metrics.NewCounter("llama_matchmaker_tokens_total", "Tokens reported by backends", "model", "kind")
+	costTotal   = metrics.NewCounter("llama_matchmaker_cost_total", "Request cost computed from models.pricing", "model")
+)
+
+// Usage is the token accounting reported by a backend for one request
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// usageFromBody reads OpenAI (usage.prompt_tokens), Ollama (prompt_eval_count), or llama.cpp
+// /completion (tokens_evaluated) token counts from a response body or streaming chunk.
+func usageFromBody(data map[string]any) (Usage, bool) {
+	if usage, ok := data["usage"].(map[string]any); ok {
+		prompt, hasPrompt := intField(usage, "prompt_tokens")
+		completion, hasCompletion := intField(usage, "completion_tokens")
+		return Usage{PromptTokens: prompt, CompletionTokens: completion}, hasPrompt || hasCompletion
+	}
+
+	if prompt, ok := intField(data, "tokens_evaluated"); ok {
+		completion, _ := intField(data, "tokens_predicted")
+		return Usage{PromptTokens: prompt, CompletionTokens: completion}, true
+	}
+
+	prompt, hasPrompt := intField(data, "prompt_eval_count")
+	completion, hasCompletion := intField(data, "eval_count")
+	return Usage{PromptTokens: prompt, CompletionTokens: completion}, hasPrompt || hasCompletion
+}
+
+// mayReportUsage is a cheap check for the fields usageFromBody reads, so chunks without
+// them need not be decoded
+func mayReportUsage(chunk []byte) bool {
+	return bytes.Contains(chunk, []byte(`"usage"`)) ||
+		bytes.Contains(chunk, []byte(`"tokens_evaluated"`)) ||
+		bytes.Contains(chunk, []byte(`eval_count"`))
+}
+
+func intField(m map[string]any, key string) (int, bool) {
+	switch n := m[key].(type) {
+	case float64:
+		return int(n), true
+	case int:
+		return n, true
+	}
+	return 0, false
+}
+
+// recordUsage updates token and cost metrics and the usage store, and returns log fields
+// describing the usage. Requests without reported usage still count toward request totals.
+func (h *Handler) recordUsage(req *http.Request, model string, routeIndices []int, u Usage) (fields []any, cost float64, priced bool) {
+	tokensTotal.Add(float64(u.PromptTokens), model, "prompt")
+	tokensTotal.Add(float64(u.CompletionTokens), model, "completion")
+	if u.PromptTokens > 0 || u.CompletionTokens > 0 {
+		route := h.routesLabel(routeIndices)
+		promptTokens.Observe(float64(u.PromptTokens), h.cfg.Listen, model, route)
+		completionTokens.Observe(float64(u.CompletionTokens), h.cfg.Listen, model, route)
+	}
+
+	fields = []any{"model", model, "prompt_tokens", u.PromptTokens, "completion_tokens", u.CompletionTokens}
+	cost, priced = h.cfg.Models.Cost(model, u.PromptTokens, u.CompletionTokens)
+	if priced {
+		costTotal.Add(cost, model)
+		fields = append(fields, "cost", formatCost(cost))
+	}
+
+	usage.Default.Record(usage.Entry{
+		APIKey:           usage.KeyLabel(req.Header.Get("Authorization")),
+		Model:            model,
+		Route:            routeLabel(routeIndices),
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		Cost:             cost,
+	})
+	return fields, cost, priced
+}
+
+// routeLabel identifies the matched routes for usage grouping
+func routeLabel(indices []int) string {
+	if len(indices) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(indices))
+	for i, idx := range indices {
+		parts[i] = strconv.Itoa(idx)
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', 6, 64)
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+)
+
+// pricedRoute leaves requests as sent while the proxy prices model
+func pricedRoute(model string) (config.Route, func(*config.ProxyConfig)) {
+	route := config.Route{OnRequest: []config.Action{{Default: map[string]any{"temperature": 0.7}}}}
+	return route, func(p *config.ProxyConfig) {
+		p.Models.Pricing = map[string]config.Price{model: {Prompt: 0.5, Completion: 2}}
+		p.Models.CostHeader = "X-Request-Cost"
+	}
+}
+
+func TestModifyResponseRecordsCost(t *testing.T) {
+	route, setup := pricedRoute("cost-test-json")
+	h := newRouteHandler(t, route, setup)
+	costBefore := costTotal.Value("cost-test-json")
+	tokensBefore := tokensTotal.Value("cost-test-json", "completion")
+	requestsBefore := requestBytes.Count("localhost:0", "cost-test-json", "0")
+	promptsBefore := promptTokens.Count("localhost:0", "cost-test-json", "0")
+
+	req := httptest.NewRequest("POST", "http://example.com/v1/chat/completions",
+		bytes.NewBufferString(`{"model":"cost-test-json","messages":[]}`))
+	h.ModifyRequest(req)
+
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body: io.NopCloser(strings.NewReader(
+			`{"model":"/models/whatever.gguf","usage":{"prompt_tokens":1000,"completion_tokens":500}}`)),
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+
+	// 1000 * 0.5/1K + 500 * 2/1K
+	if got := resp.Header.Get("X-Request-Cost"); got != "1.500000" {
+		t.Fatalf("X-Request-Cost = %q, want 1.500000", got)
+	}
+	if got := costTotal.Value("cost-test-json") - costBefore; got != 1.5 {
+		t.Fatalf("cost metric = %v, want 1.5", got)
+	}
+	if got := tokensTotal.Value("cost-test-json", "completion") - tokensBefore; got != 500 {
+		t.Fatalf("completion token metric = %v, want 500", got)
+	}
+	if requestBytes.Count("localhost:0", "cost-test-json", "0") != requestsBefore+1 || promptTokens.Count("localhost:0", "cost-test-json", "0") != promptsBefore+1 {
+		t.Fatal("request size and prompt token histograms should each observe the request")
+	}
+}
+
+func TestModifyResponseRecordsStreamingUsage(t *testing.T) {
+	route, setup := pricedRoute("cost-test-stream")
+	h := newRouteHandler(t, route, setup)
+	costBefore := costTotal.Value("cost-test-stream")
+
+	req := httptest.NewRequest("POST", "http://example.com/api/chat",
+		bytes.NewBufferString(`{"model":"cost-test-stream","stream":true,"messages":[]}`))
+	h.ModifyRequest(req)
+
+	upstream := `{"model":"cost-test-stream","message":{"content":"Hi"},"done":false}
+{"model":"cost-test-stream","message":{"content":""},"done":true,"prompt_eval_count":2000,"eval_count":1000}
+`
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/x-ndjson"}},
+		Body:       io.NopCloser(strings.NewReader(upstream)),
+	}
+	if err := h.ModifyResponse(resp); err != nil {
+		t.Fatalf("ModifyResponse: %v", err)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	if resp.Header.Get("X-Request-Cost") != "" {
+		t.Fatal("streaming responses cannot carry the cost header")
+	}
+	// The callback runs just before the pipe closes, so the read above has already synchronized
+	if got := costTotal.Value("cost-test-stream") - costBefore; got != 3 {
+		t.Fatalf("cost metric = %v, want 3", got)
+	}
+}
+
+func TestUsageFromBody(t *testing.T) {
+	if _, ok := usageFromBody(map[string]any{"choices": []any{}}); ok {
+		t.Fatal("body without usage should report none")
+	}
+	u, ok := usageFromBody(map[string]any{"usage": map[string]any{"prompt_tokens": 3.0}})
+	if !ok || u.PromptTokens != 3 || u.CompletionTokens != 0 {
+		t.Fatalf("usage = %+v, %v", u, ok)
+	}
+}
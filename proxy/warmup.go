@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/health"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+	"github.com/spicyneuron/llama-matchmaker/metrics"
+)
+
+var warmupRequests = metrics.NewCounter("llama_matchmaker_warmup_requests_total", "Warm-up requests sent, by name and result (ok or failed)", "listen", "name", "result")
+
+// maxWarmupErrorBody caps how much of a failed warm-up reply is kept for health status
+const maxWarmupErrorBody = 256
+
+// warmupCall is one request a Warmer sends, expanded from a config.WarmupRequest
+type warmupCall struct {
+	name    string
+	method  string
+	path    string
+	headers map[string]string
+	body    []byte
+}
+
+// Warmer sends a proxy's warm-up requests through its handler, so they match routes, use
+// slot scheduling, and reach the backends like client requests
+type Warmer struct {
+	listen  string
+	cfg     config.WarmupConfig
+	handler http.Handler
+	calls   []warmupCall
+}
+
+// NewWarmer creates a warmer for the proxy on listen, sending through handler
+func NewWarmer(listen string, cfg config.WarmupConfig, handler http.Handler) (*Warmer, error) {
+	w := &Warmer{listen: listen, cfg: cfg, handler: handler}
+	for _, r := range cfg.Requests {
+		models := r.Models
+		if len(models) == 0 {
+			models = []string{""}
+		}
+		for _, model := range models {
+			call := warmupCall{name: r.Name, method: r.Method, path: r.Path, headers: r.Headers}
+			body := r.Body
+			if model != "" {
+				call.name = r.Name + " " + model
+				body = make(map[string]any, len(r.Body)+1)
+				for k, v := range r.Body {
+					body[k] = v
+				}
+				body["model"] = model
+			}
+			if body != nil {
+				data, err := json.Marshal(body)
+				if err != nil {
+					return nil, fmt.Errorf("warm-up %s: %w", call.name, err)
+				}
+				call.body = data
+			}
+			w.calls = append(w.calls, call)
+		}
+	}
+	return w, nil
+}
+
+// Run sends every warm-up request now, then again each interval until ctx is done
+func (w *Warmer) Run(ctx context.Context) {
+	w.sendAll(ctx)
+	if w.cfg.Interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.sendAll(ctx)
+		}
+	}
+}
+
+// sendAll sends the requests one after another, so warm-ups never compete for slots
+func (w *Warmer) sendAll(ctx context.Context) {
+	for _, call := range w.calls {
+		if ctx.Err() != nil {
+			return
+		}
+		result := w.send(ctx, call)
+		outcome := "ok"
+		if !result.OK {
+			outcome = "failed"
+			logger.Info("Warm-up request failed", "listen", w.listen, "name", call.name, "status", result.Status, "err", result.Error)
+		} else {
+			logger.Debug("Warm-up request done", "listen", w.listen, "name", call.name, "duration", result.Duration)
+		}
+		warmupRequests.Add(1, w.listen, call.name, outcome)
+		health.Default.SetWarmup(w.listen, result)
+	}
+}
+
+func (w *Warmer) send(ctx context.Context, call warmupCall) health.Warmup {
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+	defer cancel()
+
+	result := health.Warmup{Name: call.name}
+	req, err := http.NewRequestWithContext(ctx, call.method, "http://"+w.listen+call.path, bytes.NewReader(call.body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if call.body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range call.headers {
+		req.Header.Set(k, v)
+	}
+	req.RemoteAddr = "warmup"
+
+	rec := &warmupRecorder{header: make(http.Header)}
+	start := time.Now()
+	w.handler.ServeHTTP(rec, req)
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	result.Status = rec.status()
+	result.OK = result.Status < 400
+	if !result.OK {
+		result.Error = strings.TrimSpace(rec.body.String())
+		if result.Error == "" {
+			result.Error = http.StatusText(result.Status)
+		}
+	}
+	return result
+}
+
+// warmupRecorder is the ResponseWriter for warm-up requests: it keeps the status and the
+// start of the body, and discards the rest
+type warmupRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *warmupRecorder) Header() http.Header { return r.header }
+
+func (r *warmupRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+}
+
+func (r *warmupRecorder) Write(p []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	if room := maxWarmupErrorBody - r.body.Len(); room > 0 {
+		r.body.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// Flush lets streamed warm-up replies pass through handlers that flush each chunk
+func (r *warmupRecorder) Flush() {}
+
+func (r *warmupRecorder) status() int {
+	if r.code == 0 {
+		return http.StatusOK
+	}
+	return r.code
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/health"
+)
+
+func TestWarmerSendsOncePerModel(t *testing.T) {
+	listen := "warmup-test:1"
+	health.Default.Register(listen, []string{"http://backend"})
+	defer health.Default.Reset()
+
+	var mu sync.Mutex
+	var models []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		mu.Lock()
+		models = append(models, body["model"].(string))
+		mu.Unlock()
+		if body["max_tokens"] != float64(1) || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("body = %s, content-type = %q", data, r.Header.Get("Content-Type"))
+		}
+		if body["model"] == "missing" {
+			http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"choices":[]}`))
+	})
+
+	cfg := config.WarmupConfig{Requests: []config.WarmupRequest{{
+		Path:   "/v1/chat/completions",
+		Body:   map[string]any{"max_tokens": 1},
+		Models: []string{"qwen3", "missing"},
+	}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	w, err := NewWarmer(listen, cfg, handler)
+	if err != nil {
+		t.Fatalf("NewWarmer: %v", err)
+	}
+	w.Run(context.Background()) // No interval: sends once and returns
+
+	if len(models) != 2 || models[0] != "qwen3" || models[1] != "missing" {
+		t.Fatalf("models sent = %v, want [qwen3 missing]", models)
+	}
+	warmups := health.Default.Status(listen).Proxies[0].Warmups
+	if len(warmups) != 2 {
+		t.Fatalf("warmups = %+v, want 2 results", warmups)
+	}
+	if ok := warmups[0]; !ok.OK || ok.Name != "POST /v1/chat/completions qwen3" || ok.Status != http.StatusOK {
+		t.Errorf("first result = %+v, want ok", ok)
+	}
+	if failed := warmups[1]; failed.OK || failed.Status != http.StatusNotFound || failed.Error != `{"error":"model not found"}` {
+		t.Errorf("second result = %+v, want 404 with the reply as error", failed)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+// Reloads wait for a change batch to settle: a load is kept only when none of its files
+// changed between the snapshot taken before it and the one after, so the main config and
+// its includes come from one version and an editor's half-written file is never applied
+const (
+	reloadSettle   = 150 * time.Millisecond // Quiet period before each load attempt
+	reloadAttempts = 10                     // Loads tried before giving up on files that keep changing
+)
+
+// fileSnapshot maps each file to the SHA-256 of its contents ("" when unreadable)
+type fileSnapshot map[string]string
+
+func snapshotFiles(paths []string) fileSnapshot {
+	snap := make(fileSnapshot, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			snap[path] = ""
+			continue
+		}
+		sum := sha256.Sum256(data)
+		snap[path] = hex.EncodeToString(sum[:])
+	}
+	return snap
+}
+
+// covers reports whether every file in other has the same checksum in s
+func (s fileSnapshot) covers(other fileSnapshot) bool {
+	for path, sum := range other {
+		if prev, ok := s[path]; !ok || prev != sum {
+			return false
+		}
+	}
+	return true
+}
+
+// loadSettled loads the config once its files hold still across a load. New includes are
+// only known after a load, so a reload that adds one always takes a second attempt.
+func loadSettled() (*config.Config, []string, fileSnapshot, error) {
+	before := snapshotFiles(watchedFiles)
+	for attempt := 1; ; attempt++ {
+		time.Sleep(reloadSettle)
+		cfg, files, err := config.Load(configPaths, overrides)
+		if err != nil {
+			// A failed load has no file list; judge it by the files already watched
+			after := snapshotFiles(watchedFiles)
+			if before.covers(after) {
+				return nil, nil, nil, err
+			}
+			before = after
+		} else {
+			after := snapshotFiles(files)
+			if before.covers(after) {
+				return cfg, files, after, nil
+			}
+			before = after
+		}
+		if attempt == reloadAttempts {
+			return nil, nil, nil, fmt.Errorf("config files kept changing over %d loads", reloadAttempts)
+		}
+		logger.Debug("Config files changed while loading, retrying", "attempt", attempt)
+	}
+}
@@ -0,0 +1,225 @@
+package schema
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPI holds the JSON response schemas of an OpenAPI 3 spec (YAML or JSON), with
+// $refs inlined, for checking what a backend returns
+type OpenAPI struct {
+	basePath   string
+	operations []operation
+}
+
+// operation is one path template and method with its response schemas by status key
+// ("200", "2XX", or "default")
+type operation struct {
+	template []string // Path segments; {param} segments match anything
+	path     string
+	method   string
+	schemas  map[string]map[string]any
+}
+
+// LoadOpenAPI reads a spec. basePath is stripped from request paths before matching; when
+// empty it is taken from the first server URL (ex: /v1 for https://api.openai.com/v1).
+func LoadOpenAPI(file, basePath string) (*OpenAPI, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	doc, _ = normalizeYAML(doc).(map[string]any)
+	paths := asMap(doc["paths"])
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s: no paths; not an OpenAPI spec", file)
+	}
+
+	if basePath == "" {
+		if server := asMap(firstOf(asSlice(doc["servers"]))); server != nil {
+			if u, err := url.Parse(fmt.Sprint(server["url"])); err == nil {
+				basePath = u.Path
+			}
+		}
+	}
+	spec := &OpenAPI{basePath: strings.TrimSuffix(basePath, "/")}
+	r := &refResolver{doc: doc, resolving: make(map[string]bool)}
+
+	for _, path := range sortedKeys(paths) {
+		for _, method := range sortedKeys(asMap(paths[path])) {
+			responses := asMap(asMap(asMap(paths[path])[method])["responses"])
+			if responses == nil {
+				continue
+			}
+			op := operation{template: splitPath(path), path: path, method: strings.ToUpper(method), schemas: make(map[string]map[string]any)}
+			for status, response := range responses {
+				response = r.resolve(response)
+				content := asMap(asMap(response)["content"])
+				if s := asMap(asMap(content["application/json"])["schema"]); s != nil {
+					op.schemas[strings.ToUpper(status)] = asMap(r.resolve(s))
+				}
+			}
+			if len(op.schemas) > 0 {
+				spec.operations = append(spec.operations, op)
+			}
+		}
+	}
+	return spec, nil
+}
+
+// ResponseSchema returns the schema a JSON response to method and path should follow, and
+// the spec's path template for it. Statuses fall back to their class (2XX), then default.
+func (o *OpenAPI) ResponseSchema(method, path string, status int) (map[string]any, string, bool) {
+	path = strings.TrimPrefix(path, o.basePath)
+	segments := splitPath(path)
+	for _, op := range o.operations {
+		if op.method != method || !matchTemplate(op.template, segments) {
+			continue
+		}
+		code := strconv.Itoa(status)
+		for _, key := range []string{code, code[:1] + "XX", "DEFAULT"} {
+			if s, ok := op.schemas[key]; ok {
+				return s, op.path, true
+			}
+		}
+		return nil, op.path, false
+	}
+	return nil, "", false
+}
+
+// Operations returns the number of method and path pairs with JSON response schemas
+func (o *OpenAPI) Operations() int {
+	return len(o.operations)
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func matchTemplate(template, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+	for i, t := range template {
+		if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+			continue
+		}
+		if t != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// refResolver inlines local $refs (#/components/...). A schema that refers back to itself
+// is cut off with an empty schema, which accepts anything.
+type refResolver struct {
+	doc       map[string]any
+	resolving map[string]bool
+}
+
+func (r *refResolver) resolve(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		if ref, ok := val["$ref"].(string); ok {
+			if r.resolving[ref] {
+				return map[string]any{}
+			}
+			target := r.lookup(ref)
+			if target == nil {
+				return map[string]any{}
+			}
+			r.resolving[ref] = true
+			defer delete(r.resolving, ref)
+			return r.resolve(target)
+		}
+		out := make(map[string]any, len(val))
+		for k, sub := range val {
+			out[k] = r.resolve(sub)
+		}
+		// OpenAPI 3.0 marks null as allowed with nullable instead of a type list
+		if out["nullable"] == true {
+			if t, ok := out["type"].(string); ok {
+				out["type"] = []any{t, "null"}
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, sub := range val {
+			out[i] = r.resolve(sub)
+		}
+		return out
+	}
+	return v
+}
+
+func (r *refResolver) lookup(ref string) any {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var node any = r.doc
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		node = asMap(node)[part]
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// normalizeYAML converts YAML-decoded values to the shapes encoding/json produces, so
+// numeric keywords read as float64 and unquoted status codes read as string keys
+func normalizeYAML(v any) any {
+	switch val := v.(type) {
+	case map[any]any:
+		out := make(map[string]any, len(val))
+		for k, sub := range val {
+			out[fmt.Sprint(k)] = normalizeYAML(sub)
+		}
+		return out
+	case map[string]any:
+		for k, sub := range val {
+			val[k] = normalizeYAML(sub)
+		}
+		return val
+	case []any:
+		for i, sub := range val {
+			val[i] = normalizeYAML(sub)
+		}
+		return val
+	case int:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	}
+	return v
+}
+
+func firstOf(s []any) any {
+	if len(s) == 0 {
+		return nil
+	}
+	return s[0]
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testSpec = `
+openapi: 3.0.0
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /models/{model}:
+    get:
+      responses:
+        200:
+          content:
+            application/json:
+              schema: { $ref: "#/components/schemas/Model" }
+        default:
+          $ref: "#/components/responses/Error"
+components:
+  responses:
+    Error:
+      content:
+        application/json:
+          schema:
+            type: object
+            required: [error]
+  schemas:
+    Model:
+      type: object
+      required: [id, created]
+      properties:
+        id: { type: string }
+        created: { type: integer, minimum: 0 }
+        owned_by: { type: string, nullable: true }
+        parent: { $ref: "#/components/schemas/Model" }
+`
+
+func TestLoadOpenAPI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spec.yml")
+	os.WriteFile(path, []byte(testSpec), 0o644)
+
+	spec, err := LoadOpenAPI(path, "")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if spec.Operations() != 1 {
+		t.Fatalf("operations = %d, want 1", spec.Operations())
+	}
+
+	s, specPath, ok := spec.ResponseSchema("GET", "/v1/models/llama", 200)
+	if !ok || specPath != "/models/{model}" {
+		t.Fatalf("ResponseSchema = %v, %q, %v", s, specPath, ok)
+	}
+	if err := Validate(s, map[string]any{"id": "llama", "created": 1.0, "owned_by": nil, "parent": map[string]any{"anything": true}}); err != nil {
+		t.Fatalf("conforming model: %v", err)
+	}
+	if err := Validate(s, map[string]any{"id": "llama", "created": -1.0}); err == nil {
+		t.Fatal("expected the minimum from the referenced schema to apply")
+	}
+
+	if s, _, ok := spec.ResponseSchema("GET", "/v1/models/llama", 404); !ok || Validate(s, map[string]any{}) == nil {
+		t.Fatal("expected errors to fall back to the default response")
+	}
+	if _, _, ok := spec.ResponseSchema("POST", "/v1/models/llama", 200); ok {
+		t.Fatal("expected no schema for an undocumented method")
+	}
+	if _, _, ok := spec.ResponseSchema("GET", "/v1/models", 200); ok {
+		t.Fatal("expected no schema for an undocumented path")
+	}
+}
+
+func TestLoadOpenAPIRejectsNonSpec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spec.json")
+	os.WriteFile(path, []byte(`{"type": "object"}`), 0o644)
+	if _, err := LoadOpenAPI(path, ""); err == nil {
+		t.Fatal("expected an error for a file without paths")
+	}
+}
@@ -0,0 +1,325 @@
+// Package schema validates decoded JSON against the subset of JSON Schema used for
+// structured outputs and validate_schema: types, properties, required, items, enum/const,
+// combinators, and the common numeric, string, and array bounds. Unknown keywords are
+// ignored.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// Validate reports the first way value fails schema, or nil when it conforms
+func Validate(schema map[string]any, value any) error {
+	if errs := Errors(schema, value, 1); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Errors lists up to limit ways value fails schema (all of them when limit is 0), in
+// document order. Numbers may be float64 or json.Number.
+func Errors(schema map[string]any, value any, limit int) []error {
+	v := &validator{limit: limit}
+	v.validate(schema, value, "$")
+	return v.errs
+}
+
+// validator collects errors until it reaches its limit
+type validator struct {
+	errs  []error
+	limit int
+}
+
+func (v *validator) fail(format string, args ...any) {
+	if !v.done() {
+		v.errs = append(v.errs, fmt.Errorf(format, args...))
+	}
+}
+
+func (v *validator) done() bool {
+	return v.limit > 0 && len(v.errs) >= v.limit
+}
+
+// conforms checks value against a subschema without recording anything
+func conforms(s map[string]any, value any, path string) bool {
+	sub := &validator{limit: 1}
+	sub.validate(s, value, path)
+	return len(sub.errs) == 0
+}
+
+func (v *validator) validate(s map[string]any, value any, path string) {
+	if s == nil {
+		return
+	}
+	if n, ok := value.(json.Number); ok {
+		if f, err := n.Float64(); err == nil {
+			value = f
+		}
+	}
+
+	if t, ok := s["type"]; ok && !matchesType(t, value) {
+		v.fail("%s: expected %v, got %s", path, t, typeName(value))
+		return
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if equal(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail("%s: value not in enum", path)
+			return
+		}
+	}
+	if c, ok := s["const"]; ok && !equal(c, value) {
+		v.fail("%s: expected %v", path, c)
+		return
+	}
+
+	v.validateCombinators(s, value, path)
+
+	switch val := value.(type) {
+	case map[string]any:
+		v.validateObject(s, val, path)
+	case []any:
+		v.validateArray(s, val, path)
+	case string:
+		v.validateString(s, val, path)
+	case float64:
+		v.validateNumber(s, val, path)
+	}
+}
+
+func (v *validator) validateCombinators(s map[string]any, value any, path string) {
+	for _, sub := range asSlice(s["allOf"]) {
+		v.validate(asMap(sub), value, path)
+	}
+	if anyOf := asSlice(s["anyOf"]); len(anyOf) > 0 {
+		matched := false
+		for _, sub := range anyOf {
+			if conforms(asMap(sub), value, path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail("%s: matches none of anyOf", path)
+		}
+	}
+	if oneOf := asSlice(s["oneOf"]); len(oneOf) > 0 {
+		matches := 0
+		for _, sub := range oneOf {
+			if conforms(asMap(sub), value, path) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			v.fail("%s: matches %d of oneOf, want exactly 1", path, matches)
+		}
+	}
+	if not, ok := s["not"].(map[string]any); ok && conforms(not, value, path) {
+		v.fail("%s: matches a forbidden schema", path)
+	}
+}
+
+func (v *validator) validateObject(s map[string]any, obj map[string]any, path string) {
+	for _, r := range asSlice(s["required"]) {
+		if key, ok := r.(string); ok {
+			if _, present := obj[key]; !present {
+				v.fail("%s: missing required property %q", path, key)
+			}
+		}
+	}
+
+	props := asMap(s["properties"])
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v.done() {
+			return
+		}
+		if sub, ok := props[k]; ok {
+			v.validate(asMap(sub), obj[k], path+"."+k)
+			continue
+		}
+		switch extra := s["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				v.fail("%s: unexpected property %q", path, k)
+			}
+		case map[string]any:
+			v.validate(extra, obj[k], path+"."+k)
+		}
+	}
+
+	if n, ok := asInt(s["minProperties"]); ok && len(obj) < n {
+		v.fail("%s: expected at least %d properties", path, n)
+	}
+	if n, ok := asInt(s["maxProperties"]); ok && len(obj) > n {
+		v.fail("%s: expected at most %d properties", path, n)
+	}
+}
+
+func (v *validator) validateArray(s map[string]any, arr []any, path string) {
+	if n, ok := asInt(s["minItems"]); ok && len(arr) < n {
+		v.fail("%s: expected at least %d items", path, n)
+	}
+	if n, ok := asInt(s["maxItems"]); ok && len(arr) > n {
+		v.fail("%s: expected at most %d items", path, n)
+	}
+
+	prefix := asSlice(s["prefixItems"])
+	for i, item := range arr {
+		if v.done() {
+			return
+		}
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		if i < len(prefix) {
+			v.validate(asMap(prefix[i]), item, itemPath)
+			continue
+		}
+		if items, ok := s["items"].(map[string]any); ok {
+			v.validate(items, item, itemPath)
+		}
+	}
+
+	if s["uniqueItems"] == true {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if equal(arr[i], arr[j]) {
+					v.fail("%s: items %d and %d are equal", path, i, j)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validateString(s map[string]any, str string, path string) {
+	length := utf8.RuneCountInString(str)
+	if n, ok := asInt(s["minLength"]); ok && length < n {
+		v.fail("%s: expected at least %d characters", path, n)
+	}
+	if n, ok := asInt(s["maxLength"]); ok && length > n {
+		v.fail("%s: expected at most %d characters", path, n)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err == nil && !re.MatchString(str) {
+			v.fail("%s: does not match pattern %s", path, pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(s map[string]any, n float64, path string) {
+	if limit, ok := s["minimum"].(float64); ok && n < limit {
+		v.fail("%s: %v is below minimum %v", path, n, limit)
+	}
+	if limit, ok := s["maximum"].(float64); ok && n > limit {
+		v.fail("%s: %v is above maximum %v", path, n, limit)
+	}
+	if limit, ok := s["exclusiveMinimum"].(float64); ok && n <= limit {
+		v.fail("%s: %v is not above %v", path, n, limit)
+	}
+	if limit, ok := s["exclusiveMaximum"].(float64); ok && n >= limit {
+		v.fail("%s: %v is not below %v", path, n, limit)
+	}
+	if m, ok := s["multipleOf"].(float64); ok && m > 0 {
+		if q := n / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail("%s: %v is not a multiple of %v", path, n, m)
+		}
+	}
+}
+
+// matchesType accepts a single type name or a list of them
+func matchesType(t any, v any) bool {
+	switch tt := t.(type) {
+	case string:
+		return isType(tt, v)
+	case []any:
+		for _, name := range tt {
+			if s, ok := name.(string); ok && isType(s, v) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func isType(name string, v any) bool {
+	switch name {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return true
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// equal compares decoded JSON values; numbers compare by value
+func equal(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+func asMap(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+func asInt(v any) (int, bool) {
+	n, ok := v.(float64)
+	return int(n), ok
+}
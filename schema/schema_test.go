@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("decode %s: %v", s, err)
+	}
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	person := decode(t, `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"role": {"enum": ["admin", "user"]}
+		},
+		"required": ["name", "age"],
+		"additionalProperties": false
+	}`).(map[string]any)
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`{"name": "Ada", "age": 36, "tags": ["math"], "role": "admin"}`, ""},
+		{`{"name": "Ada"}`, `missing required property "age"`},
+		{`{"name": "Ada", "age": 3.5}`, "$.age: expected integer"},
+		{`{"name": "Ada", "age": -1}`, "below minimum"},
+		{`{"name": "", "age": 1}`, "at least 1 characters"},
+		{`{"name": "Ada", "age": 1, "tags": ["a", 2]}`, "$.tags[1]: expected string"},
+		{`{"name": "Ada", "age": 1, "tags": ["a", "b", "c"]}`, "at most 2 items"},
+		{`{"name": "Ada", "age": 1, "role": "root"}`, "not in enum"},
+		{`{"name": "Ada", "age": 1, "email": "x"}`, `unexpected property "email"`},
+		{`[]`, "expected object, got array"},
+	}
+	for _, tt := range tests {
+		err := Validate(person, decode(t, tt.value))
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("Validate(%s) = %v, want nil", tt.value, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Validate(%s) = %v, want error containing %q", tt.value, err, tt.want)
+		}
+	}
+}
+
+func TestValidateCombinators(t *testing.T) {
+	s := decode(t, `{"anyOf": [
+		{"type": "object", "properties": {"name": {"const": "search"}}, "required": ["name"]},
+		{"type": "object", "required": ["content"]}
+	]}`).(map[string]any)
+
+	if err := Validate(s, decode(t, `{"name": "search"}`)); err != nil {
+		t.Fatalf("first alternative: %v", err)
+	}
+	if err := Validate(s, decode(t, `{"content": "hi"}`)); err != nil {
+		t.Fatalf("second alternative: %v", err)
+	}
+	if err := Validate(s, decode(t, `{"name": "other"}`)); err == nil {
+		t.Fatal("expected no alternative to match")
+	}
+}
+
+func TestErrorsListsEveryFailure(t *testing.T) {
+	s := decode(t, `{
+		"type": "object",
+		"properties": {
+			"model": {"type": "string"},
+			"max_tokens": {"type": "integer", "maximum": 100},
+			"seed": {"type": "integer"}
+		},
+		"required": ["model", "messages"]
+	}`).(map[string]any)
+
+	value := map[string]any{"max_tokens": 500.0, "seed": json.Number("18446744073709551615")}
+	var got []string
+	for _, err := range Errors(s, value, 0) {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		`$: missing required property "model"`,
+		`$: missing required property "messages"`,
+		"$.max_tokens: 500 is above maximum 100",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if errs := Errors(s, value, 2); len(errs) != 2 {
+		t.Fatalf("limited to 2, got %d errors", len(errs))
+	}
+}
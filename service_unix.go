@@ -0,0 +1,394 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spicyneuron/llama-matchmaker/config"
+	"github.com/spicyneuron/llama-matchmaker/logger"
+)
+
+const defaultServiceName = "llama-matchmaker"
+
+// serviceOptions is what a generated unit or compose file runs
+type serviceOptions struct {
+	Name       string
+	Exe        string
+	Args       []string // Flags for the proxy, with absolute paths
+	User       string   // Empty runs as a transient DynamicUser
+	ConfigDirs []string // Directories holding config files, mounted read-only in containers
+	WritePaths []string // Directories the proxy writes to
+	Ports      []string // Listen ports, published from containers
+	LowPorts   bool     // A listener needs CAP_NET_BIND_SERVICE
+}
+
+// runServiceCommand writes a systemd unit (and optionally a compose file) that runs the
+// proxy with the given config and flags. systemctl manages the unit from there.
+func runServiceCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "service: expected install")
+		return 2
+	}
+	action := args[0]
+	if action != "install" {
+		fmt.Fprintf(os.Stderr, "service %s: Windows only; use systemctl to start, stop, or disable the installed unit\n", action)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("service install", flag.ContinueOnError)
+	var paths configFiles
+	fs.Var(&paths, "config", "Config file for the service to load (can be specified multiple times)")
+	fs.Var(&paths, "c", "Alias for -config")
+	name := fs.String("name", defaultServiceName, "Service name")
+	output := fs.String("o", "", "Unit file to write; defaults to /etc/systemd/system/<name>.service, - prints to stdout")
+	compose := fs.String("compose", "", "Also write a Docker compose file here")
+	force := fs.Bool("force", false, "Overwrite existing files")
+	user := fs.String("user", "", "User to run as; defaults to a transient DynamicUser")
+	logFile := fs.String("log-file", "", "Append logs to this file instead of the journal")
+	// The proxy's own flags, passed through
+	var o config.CliOverrides
+	fs.StringVar(&o.Listen, "listen", "", "Address to listen on")
+	fs.StringVar(&o.Listen, "l", "", "Alias for -listen")
+	fs.StringVar(&o.Target, "target", "", "Target URL to proxy to")
+	fs.StringVar(&o.Target, "t", "", "Alias for -target")
+	fs.StringVar(&o.SSLCert, "ssl-cert", "", "SSL certificate file")
+	fs.StringVar(&o.SSLCert, "s", "", "Alias for -ssl-cert")
+	fs.StringVar(&o.SSLKey, "ssl-key", "", "SSL key file")
+	fs.StringVar(&o.SSLKey, "k", "", "Alias for -ssl-key")
+	fs.DurationVar(&o.Timeout, "timeout", 0, "Timeout for requests to target")
+	fs.DurationVar(&o.Timeout, "T", 0, "Alias for -timeout")
+	fs.BoolVar(&o.Debug, "debug", false, "Print debug logs")
+	fs.BoolVar(&o.Debug, "d", false, "Alias for -debug")
+	fs.StringVar(&o.Trace, "trace", "", "Write a JSON trace of every request to this directory")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "service install: -config is required")
+		return 2
+	}
+	if *output == "" {
+		*output = filepath.Join("/etc/systemd/system", *name+".service")
+	}
+
+	// The unit goes to stdout with -o -, so keep load logs out of it
+	logger.SetOutput(os.Stderr)
+	opts, cfg, err := serviceInstallOptions(*name, *user, paths, o, *logFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "service install: %v\n", err)
+		return 1
+	}
+
+	unit := systemdUnit(opts)
+	if *output == "-" {
+		os.Stdout.WriteString(unit)
+	} else if err := writeServiceFile(*output, unit, *force); err != nil {
+		fmt.Fprintf(os.Stderr, "service install: %v\n", err)
+		return 1
+	}
+	if *compose != "" {
+		for _, warning := range composeWarnings(cfg) {
+			fmt.Fprintln(os.Stderr, "service install: "+warning)
+		}
+		if err := writeServiceFile(*compose, composeFile(opts), *force); err != nil {
+			fmt.Fprintf(os.Stderr, "service install: %v\n", err)
+			return 1
+		}
+	}
+	if *output == "-" {
+		return 0
+	}
+
+	if opts.User == "" && len(opts.WritePaths) > 0 {
+		fmt.Fprintf(os.Stderr, "service install: the DynamicUser can only write to %s if it owns them; pass -user to run as an existing user\n", strings.Join(opts.WritePaths, ", "))
+	}
+	fmt.Printf("Wrote %s. Start it with:\n  systemctl daemon-reload\n  systemctl enable --now %s\n", *output, *name)
+	fmt.Printf("Reload the config with systemctl reload %s (file changes also reload it)\n", *name)
+	if *compose != "" {
+		fmt.Printf("Wrote %s. Build the image from a checkout with docker build -t llama-matchmaker . then docker compose -f %s up -d\n", *compose, *compose)
+	}
+	return 0
+}
+
+// serviceInstallOptions loads the config as the service will, so a broken config fails here,
+// and collects the paths and ports the unit needs. Paths become absolute, since services
+// start in /.
+func serviceInstallOptions(name, user string, paths []string, o config.CliOverrides, logFile string) (serviceOptions, *config.Config, error) {
+	opts := serviceOptions{Name: name, User: user}
+	exe, err := os.Executable()
+	if err != nil {
+		return opts, nil, err
+	}
+	opts.Exe = exe
+
+	var abs []string
+	for _, path := range paths {
+		p, err := filepath.Abs(path)
+		if err != nil {
+			return opts, nil, err
+		}
+		if _, err := os.Stat(p); err != nil {
+			return opts, nil, err
+		}
+		abs = append(abs, p)
+		opts.Args = append(opts.Args, "-config", p)
+	}
+	for _, p := range []*string{&o.SSLCert, &o.SSLKey, &o.Trace, &logFile} {
+		if *p != "" {
+			if *p, err = filepath.Abs(*p); err != nil {
+				return opts, nil, err
+			}
+		}
+	}
+
+	cfg, files, err := config.Load(abs, o)
+	if err != nil {
+		return opts, nil, err
+	}
+
+	if o.Listen != "" {
+		opts.Args = append(opts.Args, "-listen", o.Listen)
+	}
+	if o.Target != "" {
+		opts.Args = append(opts.Args, "-target", o.Target)
+	}
+	if o.Timeout > 0 {
+		opts.Args = append(opts.Args, "-timeout", o.Timeout.String())
+	}
+	if o.SSLCert != "" {
+		opts.Args = append(opts.Args, "-ssl-cert", o.SSLCert)
+	}
+	if o.SSLKey != "" {
+		opts.Args = append(opts.Args, "-ssl-key", o.SSLKey)
+	}
+	if o.Debug {
+		opts.Args = append(opts.Args, "-debug")
+	}
+	if o.Trace != "" {
+		opts.Args = append(opts.Args, "-trace", o.Trace)
+	}
+	if logFile != "" {
+		opts.Args = append(opts.Args, "-log-file", logFile)
+		opts.WritePaths = append(opts.WritePaths, filepath.Dir(logFile))
+	}
+
+	// Includes and SSL files are watched, so every one is read
+	for _, file := range files {
+		opts.ConfigDirs = append(opts.ConfigDirs, filepath.Dir(file))
+	}
+	if cfg.Admin.UsageFile != "" {
+		opts.WritePaths = append(opts.WritePaths, filepath.Dir(cfg.Admin.UsageFile))
+	}
+	listens := []string{cfg.Admin.Listen}
+	for _, proxy := range cfg.Proxies {
+		listens = append(listens, proxy.Listen)
+		if proxy.TraceAll || slices.ContainsFunc(proxy.Routes, func(r config.Route) bool { return r.Trace }) {
+			opts.WritePaths = append(opts.WritePaths, proxy.TraceDir)
+		}
+	}
+	for _, listen := range listens {
+		_, port, err := net.SplitHostPort(listen)
+		if err != nil {
+			continue
+		}
+		opts.Ports = append(opts.Ports, port)
+		if n, err := strconv.Atoi(port); err == nil && n < 1024 {
+			opts.LowPorts = true
+		}
+	}
+
+	slices.Sort(opts.ConfigDirs)
+	opts.ConfigDirs = slices.Compact(opts.ConfigDirs)
+	slices.Sort(opts.WritePaths)
+	opts.WritePaths = slices.Compact(opts.WritePaths)
+	slices.Sort(opts.Ports)
+	opts.Ports = slices.Compact(opts.Ports)
+	return opts, cfg, nil
+}
+
+// systemdUnit renders a unit that runs opts with the usual sandboxing. The proxy only
+// reads its config, makes network connections, and writes the directories in WritePaths.
+func systemdUnit(opts serviceOptions) string {
+	var b strings.Builder
+	b.WriteString("# Generated by llama-matchmaker service install\n")
+	b.WriteString(`[Unit]
+Description=Llama Matchmaker LLM proxy
+Documentation=https://github.com/spicyneuron/llama-matchmaker
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+`)
+	cmd := []string{systemdQuote(opts.Exe)}
+	for _, arg := range opts.Args {
+		cmd = append(cmd, systemdQuote(arg))
+	}
+	b.WriteString("ExecStart=" + strings.Join(cmd, " ") + "\n")
+	b.WriteString(`# Reloads the config, as a change to the files does
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=5s
+`)
+	if opts.User != "" {
+		b.WriteString("User=" + opts.User + "\n")
+	} else {
+		b.WriteString("DynamicUser=yes\n")
+	}
+
+	b.WriteString("\n# Hardening\n")
+	if opts.LowPorts {
+		b.WriteString("AmbientCapabilities=CAP_NET_BIND_SERVICE\nCapabilityBoundingSet=CAP_NET_BIND_SERVICE\n")
+	} else {
+		b.WriteString("CapabilityBoundingSet=\n")
+	}
+	b.WriteString(`NoNewPrivileges=yes
+ProtectSystem=strict
+ProtectHome=read-only
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectControlGroups=yes
+ProtectClock=yes
+ProtectHostname=yes
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6
+RestrictNamespaces=yes
+RestrictRealtime=yes
+RestrictSUIDSGID=yes
+LockPersonality=yes
+MemoryDenyWriteExecute=yes
+SystemCallArchitectures=native
+UMask=0027
+`)
+	if len(opts.WritePaths) > 0 {
+		// - skips directories that don't exist yet instead of failing to start
+		var writable []string
+		for _, path := range opts.WritePaths {
+			writable = append(writable, "-"+systemdQuote(path))
+		}
+		b.WriteString("ReadWritePaths=" + strings.Join(writable, " ") + "\n")
+	}
+
+	b.WriteString(`
+[Install]
+WantedBy=multi-user.target
+`)
+	return b.String()
+}
+
+// systemdQuote escapes an ExecStart word: specifiers and variables always, quotes when
+// it has spaces or quotes
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// composeFile renders a compose service running opts in the llama-matchmaker image.
+// Config and writable directories are mounted at the same paths, so the flags work as
+// they are.
+func composeFile(opts serviceOptions) string {
+	var b strings.Builder
+	b.WriteString(`# Generated by llama-matchmaker service install. Build the image from a checkout with:
+#   docker build -t llama-matchmaker .
+# Reload the config with: docker compose kill -s HUP ` + opts.Name + `
+services:
+  ` + opts.Name + `:
+    image: llama-matchmaker
+    restart: unless-stopped
+`)
+	var command []string
+	for _, arg := range opts.Args {
+		command = append(command, strconv.Quote(arg))
+	}
+	b.WriteString("    command: [" + strings.Join(command, ", ") + "]\n")
+
+	if len(opts.Ports) > 0 {
+		b.WriteString("    ports:\n")
+		for _, port := range opts.Ports {
+			fmt.Fprintf(&b, "      - %q\n", port+":"+port)
+		}
+	}
+	b.WriteString("    volumes:\n")
+	for _, dir := range opts.ConfigDirs {
+		// Mounted read-write instead when the proxy also writes there
+		if !slices.Contains(opts.WritePaths, dir) {
+			fmt.Fprintf(&b, "      - %q\n", dir+":"+dir+":ro")
+		}
+	}
+	for _, dir := range opts.WritePaths {
+		fmt.Fprintf(&b, "      - %q\n", dir+":"+dir)
+	}
+	b.WriteString(`    # Backends on the host are at host.docker.internal
+    extra_hosts:
+      - "host.docker.internal:host-gateway"
+    read_only: true
+    security_opt:
+      - "no-new-privileges:true"
+    cap_drop:
+      - ALL
+`)
+	if opts.LowPorts {
+		b.WriteString("    cap_add:\n      - NET_BIND_SERVICE\n")
+	}
+	return b.String()
+}
+
+// composeWarnings flags addresses that work on the host but not in a container
+func composeWarnings(cfg *config.Config) []string {
+	var warnings []string
+	for _, proxy := range cfg.Proxies {
+		if host, port, err := net.SplitHostPort(proxy.Listen); err == nil && isLoopback(host) {
+			warnings = append(warnings, fmt.Sprintf("listen %s is unreachable from outside the container; use :%s", proxy.Listen, port))
+		}
+		for _, target := range proxy.AllTargets() {
+			if u, err := url.Parse(target); err == nil && isLoopback(u.Hostname()) {
+				warnings = append(warnings, fmt.Sprintf("target %s is the container itself; use host.docker.internal for a backend on the host", target))
+			}
+		}
+	}
+	return warnings
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// writeServiceFile writes a generated file, keeping an existing one unless force is set
+func writeServiceFile(path, content string, force bool) error {
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, mode, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists (use -force to overwrite)", path)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
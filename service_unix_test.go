@@ -0,0 +1,116 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServiceInstallWritesUnit(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yml")
+	os.WriteFile(configPath, []byte(`
+admin:
+  listen: localhost:9090
+  usage_file: state/usage.json
+proxy:
+  listen: localhost:8081
+  target: http://localhost:8080
+  routes:
+    - methods: POST
+      paths: ^/v1/chat/completions$
+      trace: true
+`), 0o644)
+	unitPath := filepath.Join(dir, "llm.service")
+	composePath := filepath.Join(dir, "compose.yml")
+
+	code := runServiceCommand([]string{"install", "-config", configPath, "-name", "llm", "-o", unitPath,
+		"-compose", composePath, "-user", "llm", "-timeout", "90s", "-debug"})
+	if code != 0 {
+		t.Fatalf("service install exited %d", code)
+	}
+
+	unit, err := os.ReadFile(unitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		" -config " + configPath + " -timeout 1m30s -debug\n",
+		"ExecReload=/bin/kill -HUP $MAINPID\n",
+		"User=llm\n",
+		"ProtectSystem=strict\n",
+		"NoNewPrivileges=yes\n",
+		"ReadWritePaths=-" + filepath.Join(dir, "state") + " -" + filepath.Join(dir, "traces") + "\n",
+		"CapabilityBoundingSet=\n",
+		"WantedBy=multi-user.target\n",
+	} {
+		if !strings.Contains(string(unit), want) {
+			t.Errorf("unit missing %q:\n%s", want, unit)
+		}
+	}
+	if strings.Contains(string(unit), "DynamicUser") {
+		t.Errorf("unit has DynamicUser despite -user:\n%s", unit)
+	}
+
+	compose, err := os.ReadFile(composePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"  llm:\n",
+		`command: ["-config", "` + configPath + `", "-timeout", "1m30s", "-debug"]`,
+		`- "8081:8081"`,
+		`- "9090:9090"`,
+		`- "` + dir + ":" + dir + `:ro"`,
+		`- "` + filepath.Join(dir, "state") + ":" + filepath.Join(dir, "state") + `"`,
+	} {
+		if !strings.Contains(string(compose), want) {
+			t.Errorf("compose file missing %q:\n%s", want, compose)
+		}
+	}
+
+	// Both files exist now
+	if code := runServiceCommand([]string{"install", "-config", configPath, "-o", unitPath}); code != 1 {
+		t.Fatalf("service install exited %d, want 1 for an existing unit", code)
+	}
+}
+
+func TestServiceInstallRejectsBadConfig(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yml")
+	os.WriteFile(configPath, []byte("proxy:\n  listen: localhost:8081\n"), 0o644)
+	unitPath := filepath.Join(dir, "llm.service")
+
+	if code := runServiceCommand([]string{"install", "-config", configPath, "-o", unitPath}); code != 1 {
+		t.Fatalf("service install exited %d, want 1", code)
+	}
+	if _, err := os.Stat(unitPath); !os.IsNotExist(err) {
+		t.Fatal("unit written for an invalid config")
+	}
+	if code := runServiceCommand([]string{"start"}); code != 2 {
+		t.Fatalf("service start exited %d, want 2", code)
+	}
+}
+
+func TestSystemdUnitLowPortsAndQuoting(t *testing.T) {
+	unit := systemdUnit(serviceOptions{
+		Exe:      "/opt/llama matchmaker/bin",
+		Args:     []string{"-config", "/etc/llm/100%.yml"},
+		LowPorts: true,
+	})
+	for _, want := range []string{
+		`ExecStart="/opt/llama matchmaker/bin" -config /etc/llm/100%%.yml` + "\n",
+		"DynamicUser=yes\n",
+		"AmbientCapabilities=CAP_NET_BIND_SERVICE\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("unit missing %q:\n%s", want, unit)
+		}
+	}
+	if strings.Contains(unit, "ReadWritePaths") {
+		t.Errorf("unit has ReadWritePaths with nothing to write:\n%s", unit)
+	}
+}
@@ -0,0 +1,225 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const defaultServiceName = "llama-matchmaker"
+
+func daemonize(logFile string) (int, error) {
+	return 0, errors.New("-daemon is not supported on Windows; use llama-matchmaker service install")
+}
+
+func processAlive(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	// STILL_ACTIVE
+	return windows.GetExitCodeProcess(h, &code) == nil && code == 259
+}
+
+func runningAsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// runAsService runs the proxies under the service control manager, stopping them when
+// the service is stopped or Windows shuts down
+func runAsService(run func(stop <-chan os.Signal)) error {
+	// The name is ignored for services in their own process
+	return svc.Run(defaultServiceName, serviceHandler{run: run})
+}
+
+type serviceHandler struct {
+	run func(stop <-chan os.Signal)
+}
+
+func (h serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	stop := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		h.run(stop)
+		close(done)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				stop <- os.Interrupt
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// notifyReloadSignal does nothing; Windows has no reload signal, so only file changes reload
+func notifyReloadSignal(ch chan<- os.Signal) {}
+
+// runServiceCommand installs, removes, starts, or stops the Windows service
+func runServiceCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "service: expected install, uninstall, start, or stop")
+		return 2
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("service "+action, flag.ContinueOnError)
+	var paths configFiles
+	name := fs.String("name", defaultServiceName, "Service name")
+	if action == "install" {
+		fs.Var(&paths, "config", "Config file to load (can be specified multiple times)")
+		fs.Var(&paths, "c", "Alias for -config")
+	}
+	logFile := fs.String("log-file", "", "Log file for the service; defaults to llama-matchmaker.log beside the first config")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "service: %v (run from an administrator prompt)\n", err)
+		return 1
+	}
+	defer m.Disconnect()
+
+	switch action {
+	case "install":
+		err = installService(m, *name, paths, *logFile)
+	case "uninstall":
+		err = uninstallService(m, *name)
+	case "start":
+		err = startService(m, *name)
+	case "stop":
+		err = stopService(m, *name)
+	default:
+		fmt.Fprintf(os.Stderr, "service: unknown action %q; expected install, uninstall, start, or stop\n", action)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "service %s: %v\n", action, err)
+		return 1
+	}
+	fmt.Printf("Service %s: %s done\n", *name, action)
+	return 0
+}
+
+// installService registers this binary to run with absolute config and log paths, since
+// services start in the system directory
+func installService(m *mgr.Mgr, name string, paths []string, logFile string) error {
+	if len(paths) == 0 {
+		return errors.New("-config is required")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	var args []string
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return err
+		}
+		args = append(args, "-config", abs)
+	}
+	if logFile == "" {
+		logFile = filepath.Join(filepath.Dir(args[1]), "llama-matchmaker.log")
+	}
+	if logFile, err = filepath.Abs(logFile); err != nil {
+		return err
+	}
+	args = append(args, "-log-file", logFile)
+
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName: "Llama Matchmaker",
+		Description: "Proxy that matches LLM requests to model-specific settings",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	// Restart after crashes, backing off
+	return s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}, uint32((24 * time.Hour).Seconds()))
+}
+
+func uninstallService(m *mgr.Mgr, name string) error {
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if status, err := s.Query(); err == nil && status.State != svc.Stopped {
+		if err := waitForState(s, svc.Stop, svc.Stopped); err != nil {
+			return err
+		}
+	}
+	return s.Delete()
+}
+
+func startService(m *mgr.Mgr, name string) error {
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Start()
+}
+
+func stopService(m *mgr.Mgr, name string) error {
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return waitForState(s, svc.Stop, svc.Stopped)
+}
+
+// waitForState sends cmd and waits up to 30s for the service to reach state
+func waitForState(s *mgr.Service, cmd svc.Cmd, state svc.State) error {
+	status, err := s.Control(cmd)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for status.State != state {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for the service to reach state %d", state)
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// sniffTimeout bounds the wait for a new connection's first byte
+const sniffTimeout = 10 * time.Second
+
+// tlsHandshakeRecord is the first byte of every TLS connection
+const tlsHandshakeRecord = 0x16
+
+// sniffListener serves TLS and plain connections on one port (plain_http), telling them
+// apart by their first byte. TLS connections are returned as *tls.Conn, so the server sets
+// Request.TLS on them and not on plain ones.
+type sniffListener struct {
+	net.Listener
+	tlsConfig *tls.Config
+	accepted  chan acceptResult
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+func newSniffListener(ln net.Listener, tlsConfig *tls.Config) *sniffListener {
+	l := &sniffListener{
+		Listener:  ln,
+		tlsConfig: tlsConfig,
+		accepted:  make(chan acceptResult),
+		closed:    make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// run accepts connections and sniffs each in its own goroutine, so a client slow to send
+// its first byte doesn't hold up the others
+func (l *sniffListener) run() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.accepted <- acceptResult{err: err}:
+			case <-l.closed:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go l.sniff(conn)
+	}
+}
+
+func (l *sniffListener) sniff(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	reader := bufio.NewReader(conn)
+	first, err := reader.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	var sniffed net.Conn = &peekedConn{Conn: conn, reader: reader}
+	if first[0] == tlsHandshakeRecord {
+		sniffed = tls.Server(sniffed, l.tlsConfig)
+	}
+	select {
+	case l.accepted <- acceptResult{conn: sniffed}:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+func (l *sniffListener) Accept() (net.Conn, error) {
+	select {
+	case result := <-l.accepted:
+		return result.conn, result.err
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *sniffListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return l.Listener.Close()
+}
+
+// peekedConn replays the bytes read while sniffing
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// terminalSize returns the size from COLUMNS and LINES, or a default
+func terminalSize() (width, height int) {
+	return defaultTerminalSize()
+}
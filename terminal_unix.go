@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalSize returns stdout's size in characters, or a default when it isn't a terminal
+func terminalSize() (width, height int) {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return defaultTerminalSize()
+	}
+	return int(ws.Col), int(ws.Row)
+}
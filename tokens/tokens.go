@@ -0,0 +1,57 @@
+// Package tokens estimates prompt sizes without loading a model tokenizer.
+package tokens
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+const (
+	charsPerToken   = 4 // Rough average for English text across common BPE vocabularies
+	messageOverhead = 4 // Role and chat template framing per message
+)
+
+// Estimate returns the approximate token count of text, rounding up
+func Estimate(text string) int {
+	n := utf8.RuneCountInString(text)
+	return (n + charsPerToken - 1) / charsPerToken
+}
+
+// Messages returns the approximate prompt size of OpenAI/Ollama style chat messages
+func Messages(messages []any) int {
+	total := 0
+	for _, m := range messages {
+		total += Message(m)
+	}
+	return total
+}
+
+// Message returns the approximate size of a single chat message, including framing
+func Message(message any) int {
+	msg, ok := message.(map[string]any)
+	if !ok {
+		return 0
+	}
+
+	total := messageOverhead
+	switch content := msg["content"].(type) {
+	case string:
+		total += Estimate(content)
+	case []any:
+		for _, part := range content {
+			if p, ok := part.(map[string]any); ok {
+				if text, ok := p["text"].(string); ok {
+					total += Estimate(text)
+				}
+			}
+		}
+	}
+	if reasoning, ok := msg["reasoning_content"].(string); ok {
+		total += Estimate(reasoning)
+	}
+	if calls, ok := msg["tool_calls"]; ok {
+		encoded, _ := json.Marshal(calls)
+		total += Estimate(string(encoded))
+	}
+	return total
+}
@@ -0,0 +1,37 @@
+package tokens
+
+import "testing"
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abc", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"héllo wörld", 3},
+	}
+	for _, tt := range tests {
+		if got := Estimate(tt.text); got != tt.want {
+			t.Errorf("Estimate(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMessages(t *testing.T) {
+	messages := []any{
+		map[string]any{"role": "system", "content": "12345678"},
+		map[string]any{"role": "user", "content": []any{
+			map[string]any{"type": "text", "text": "1234"},
+			map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:..."}},
+		}},
+		"not a message",
+	}
+
+	// 4+2 for the system message, 4+1 for the user message
+	if got := Messages(messages); got != 11 {
+		t.Errorf("Messages() = %d, want 11", got)
+	}
+}
@@ -0,0 +1,293 @@
+// Package traffic keeps the most recent requests for the admin dashboard.
+package traffic
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxChunks caps a stream's timeline; the response body keeps accumulating up to maxBody
+const maxChunks = 500
+
+// Route is a matched route, named when the config names it
+type Route struct {
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Chunk is one piece of a streamed response, timed from the start of the request
+type Chunk struct {
+	At   float64 `json:"at_ms"`
+	Data string  `json:"data"`
+}
+
+// Exchange is one request and its response. Bodies are capped and have redacted text
+// already replaced by placeholders.
+type Exchange struct {
+	ID           uint64          `json:"id"`
+	Start        time.Time       `json:"start"`
+	Listen       string          `json:"listen"`
+	Method       string          `json:"method"`
+	Path         string          `json:"path"`
+	Target       string          `json:"target,omitempty"`
+	UpstreamPath string          `json:"upstream_path,omitempty"`
+	Model        string          `json:"model,omitempty"`
+	Routes       []Route         `json:"routes"`
+	Fired        json.RawMessage `json:"fired,omitempty"` // config.FiredAction list with diffs
+	Rejection    string          `json:"rejection,omitempty"`
+	Status       int             `json:"status,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	DurationMS   float64         `json:"duration_ms,omitempty"`
+	Done         bool            `json:"done"`
+	Stream       bool            `json:"stream"`
+
+	Request         string  `json:"request,omitempty"`          // As received from the client
+	UpstreamRequest string  `json:"upstream_request,omitempty"` // As sent to the target
+	Response        string  `json:"response,omitempty"`         // As sent to the client
+	Chunks          []Chunk `json:"chunks,omitempty"`           // Stream timeline
+	Truncated       bool    `json:"truncated,omitempty"`
+}
+
+// Health is what recent traffic and slot polling say about one target
+type Health struct {
+	Target     string     `json:"target"`
+	Up         *bool      `json:"up,omitempty"` // From /health polling (slots), when configured
+	Checked    *time.Time `json:"checked,omitempty"`
+	Requests   int        `json:"requests"`
+	Errors     int        `json:"errors"` // Transport errors and 5xx responses
+	LastStatus int        `json:"last_status,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	LastSeen   time.Time  `json:"last_seen,omitempty"`
+}
+
+// Recorder holds a ring of recent exchanges. A zero capacity disables recording.
+type Recorder struct {
+	mu        sync.Mutex
+	capacity  int
+	maxBody   int
+	nextID    uint64
+	exchanges []*Exchange // Oldest first
+	health    map[string]*Health
+	now       func() time.Time
+}
+
+// NewRecorder creates a disabled recorder; see Configure
+func NewRecorder() *Recorder {
+	return &Recorder{health: make(map[string]*Health), now: time.Now}
+}
+
+// Default is the process-wide recorder fed by the proxies and read by the admin dashboard
+var Default = NewRecorder()
+
+// Configure sets how many exchanges are kept and how many bytes of each body. Shrinking
+// drops the oldest exchanges; a zero capacity disables recording and clears everything.
+func (r *Recorder) Configure(capacity, maxBody int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.capacity = capacity
+	r.maxBody = maxBody
+	if capacity == 0 {
+		r.exchanges = nil
+		r.health = make(map[string]*Health)
+		return
+	}
+	if len(r.exchanges) > capacity {
+		r.exchanges = append([]*Exchange(nil), r.exchanges[len(r.exchanges)-capacity:]...)
+	}
+}
+
+// Enabled reports whether exchanges are being recorded
+func (r *Recorder) Enabled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.capacity > 0
+}
+
+// Start records a new exchange and returns its ID, or 0 when recording is disabled
+func (r *Recorder) Start(e Exchange) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.capacity == 0 {
+		return 0
+	}
+	r.nextID++
+	e.ID = r.nextID
+	if e.Start.IsZero() {
+		e.Start = r.now()
+	}
+	e.Request = r.capLocked(&e, e.Request)
+	e.UpstreamRequest = r.capLocked(&e, e.UpstreamRequest)
+	if len(r.exchanges) == r.capacity {
+		r.exchanges = r.exchanges[1:]
+	}
+	r.exchanges = append(r.exchanges, &e)
+	return e.ID
+}
+
+// capLocked truncates a body to maxBody, flagging the exchange
+func (r *Recorder) capLocked(e *Exchange, body string) string {
+	if r.maxBody > 0 && len(body) > r.maxBody {
+		e.Truncated = true
+		return body[:r.maxBody]
+	}
+	return body
+}
+
+func (r *Recorder) findLocked(id uint64) *Exchange {
+	// IDs are increasing, so search from the newest
+	for i := len(r.exchanges) - 1; i >= 0; i-- {
+		if r.exchanges[i].ID == id {
+			return r.exchanges[i]
+		}
+	}
+	return nil
+}
+
+// Respond records the response status and headers arriving for an exchange
+func (r *Recorder) Respond(id uint64, status int, stream bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.findLocked(id)
+	if e == nil {
+		return
+	}
+	e.Status = status
+	e.Stream = stream
+	r.observeLocked(e, status, "")
+}
+
+// Chunk appends response bytes, timed for streams
+func (r *Recorder) Chunk(id uint64, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.findLocked(id)
+	if e == nil || len(data) == 0 {
+		return
+	}
+	if e.Stream {
+		if len(e.Chunks) < maxChunks {
+			e.Chunks = append(e.Chunks, Chunk{At: ms(r.now().Sub(e.Start)), Data: string(data)})
+		} else {
+			e.Truncated = true
+		}
+	}
+	if r.maxBody > 0 && len(e.Response)+len(data) > r.maxBody {
+		e.Truncated = true
+		data = data[:max(0, r.maxBody-len(e.Response))]
+	}
+	e.Response += string(data)
+}
+
+// Finish marks an exchange complete
+func (r *Recorder) Finish(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e := r.findLocked(id); e != nil && !e.Done {
+		e.Done = true
+		e.DurationMS = ms(r.now().Sub(e.Start))
+	}
+}
+
+// Fail marks an exchange complete with the error answered to the client as status
+func (r *Recorder) Fail(id uint64, status int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.findLocked(id)
+	if e == nil || e.Done {
+		return
+	}
+	e.Done = true
+	e.DurationMS = ms(r.now().Sub(e.Start))
+	e.Error = err.Error()
+	if e.Status == 0 {
+		r.observeLocked(e, status, e.Error)
+	} else if e.Target != "" {
+		// The response was already counted; only the failure is new
+		h := r.healthLocked(e.Target)
+		h.Errors++
+		h.LastError = e.Error
+	}
+	e.Status = status
+}
+
+// observeLocked updates the target's health from a response or error
+func (r *Recorder) observeLocked(e *Exchange, status int, errText string) {
+	if e.Target == "" || e.Rejection != "" {
+		return
+	}
+	h := r.healthLocked(e.Target)
+	h.Requests++
+	h.LastSeen = r.now()
+	if status != 0 {
+		h.LastStatus = status
+	}
+	if errText != "" || status >= 500 {
+		h.Errors++
+		h.LastError = errText
+	}
+}
+
+func (r *Recorder) healthLocked(target string) *Health {
+	h, ok := r.health[target]
+	if !ok {
+		h = &Health{Target: target}
+		r.health[target] = h
+	}
+	return h
+}
+
+// SetUp records a target's polled health
+func (r *Recorder) SetUp(target string, up bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.capacity == 0 {
+		return
+	}
+	h := r.healthLocked(target)
+	checked := r.now()
+	h.Up, h.Checked = &up, &checked
+}
+
+// Recent returns copies of the recorded exchanges, newest first, without bodies
+func (r *Recorder) Recent() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Exchange, 0, len(r.exchanges))
+	for i := len(r.exchanges) - 1; i >= 0; i-- {
+		e := *r.exchanges[i]
+		e.Fired, e.Request, e.UpstreamRequest, e.Response, e.Chunks = nil, "", "", "", nil
+		out = append(out, e)
+	}
+	return out
+}
+
+// Get returns a copy of one exchange with its bodies
+func (r *Recorder) Get(id uint64) (Exchange, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.findLocked(id)
+	if e == nil {
+		return Exchange{}, false
+	}
+	out := *e
+	out.Chunks = append([]Chunk(nil), e.Chunks...)
+	return out, true
+}
+
+// Health returns every target seen, sorted by name
+func (r *Recorder) Health() []Health {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Health, 0, len(r.health))
+	for _, h := range r.health {
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Target < out[j].Target })
+	return out
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,65 @@
+package traffic
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecorderKeepsNewest(t *testing.T) {
+	r := NewRecorder()
+	if id := r.Start(Exchange{Path: "/ignored"}); id != 0 || r.Enabled() {
+		t.Fatalf("disabled recorder started exchange %d", id)
+	}
+
+	r.Configure(2, 4)
+	for _, path := range []string{"/a", "/b", "/c"} {
+		r.Start(Exchange{Path: path, Request: "123456"})
+	}
+	recent := r.Recent()
+	if len(recent) != 2 || recent[0].Path != "/c" || recent[1].Path != "/b" {
+		t.Fatalf("recent = %+v, want /c then /b", recent)
+	}
+	if recent[0].Request != "" {
+		t.Fatalf("Recent returned bodies: %+v", recent[0])
+	}
+	e, ok := r.Get(recent[0].ID)
+	if !ok || e.Request != "1234" || !e.Truncated {
+		t.Fatalf("Get = %+v, want request capped at 4 bytes", e)
+	}
+	if _, ok := r.Get(1); ok {
+		t.Fatal("evicted exchange still returned")
+	}
+}
+
+func TestRecorderStreamTimelineAndHealth(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	r := NewRecorder()
+	r.now = func() time.Time { return now }
+	r.Configure(10, 1024)
+
+	id := r.Start(Exchange{Target: "gpu:8080"})
+	r.Respond(id, 200, true)
+	now = now.Add(150 * time.Millisecond)
+	r.Chunk(id, []byte("data: {}\n\n"))
+	now = now.Add(50 * time.Millisecond)
+	r.Finish(id)
+
+	e, _ := r.Get(id)
+	if len(e.Chunks) != 1 || e.Chunks[0].At != 150 || e.DurationMS != 200 || !e.Done {
+		t.Fatalf("exchange = %+v, want one chunk at 150ms and 200ms duration", e)
+	}
+
+	failed := r.Start(Exchange{Target: "gpu:8080"})
+	r.Fail(failed, 502, errors.New("connection refused"))
+	r.SetUp("gpu:8080", false)
+
+	health := r.Health()
+	if len(health) != 1 {
+		t.Fatalf("health = %+v, want one target", health)
+	}
+	h := health[0]
+	if h.Requests != 2 || h.Errors != 1 || h.LastStatus != 502 || h.LastError != "connection refused" || h.Up == nil || *h.Up {
+		t.Fatalf("health = %+v, want 2 requests, 1 error, down", h)
+	}
+}
@@ -0,0 +1,396 @@
+package translate
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	register(&Profile{
+		Name:       "anthropic-to-openai",
+		TargetPath: "/v1/chat/completions",
+		Request:    anthropicToOpenAIRequest,
+		Response:   openAIToAnthropicResponse,
+		Error:      openAIToAnthropicError,
+		NewStream: func() Stream {
+			return &openAIToAnthropicStream{id: newID("msg_"), blockIndex: -1}
+		},
+		// Anthropic SDKs dispatch on the SSE event name, which mirrors each event's type
+		SSE:        true,
+		EventField: "type",
+	})
+}
+
+// anthropicToOpenAIParams maps Messages API params to OpenAI params
+var anthropicToOpenAIParams = map[string]string{
+	"model":          "model",
+	"max_tokens":     "max_tokens",
+	"temperature":    "temperature",
+	"top_p":          "top_p",
+	"top_k":          "top_k",
+	"stop_sequences": "stop",
+}
+
+var anthropicStopReasons = map[string]string{
+	"stop":           "end_turn",
+	"length":         "max_tokens",
+	"tool_calls":     "tool_use",
+	"function_call":  "tool_use",
+	"content_filter": "refusal",
+}
+
+func anthropicToOpenAIRequest(body map[string]any, _ string) map[string]any {
+	out := make(map[string]any)
+	copyKeys(out, body, anthropicToOpenAIParams)
+
+	if body["stream"] == true {
+		out["stream"] = true
+		out["stream_options"] = map[string]any{"include_usage": true}
+	}
+
+	var messages []any
+	switch system := body["system"].(type) {
+	case string:
+		if system != "" {
+			messages = append(messages, map[string]any{"role": "system", "content": system})
+		}
+	case []any:
+		if text := anthropicBlocksText(system); text != "" {
+			messages = append(messages, map[string]any{"role": "system", "content": text})
+		}
+	}
+	for _, m := range asSlice(body["messages"]) {
+		messages = append(messages, anthropicMessageToOpenAI(asMap(m))...)
+	}
+	out["messages"] = messages
+
+	var tools []any
+	for _, t := range asSlice(body["tools"]) {
+		tool := asMap(t)
+		// Server tools (web_search, bash, ...) have a type and no schema; backends can't run them
+		if tool["input_schema"] == nil {
+			continue
+		}
+		fn := map[string]any{"name": tool["name"], "parameters": tool["input_schema"]}
+		if desc, ok := tool["description"]; ok {
+			fn["description"] = desc
+		}
+		tools = append(tools, map[string]any{"type": "function", "function": fn})
+	}
+	if len(tools) > 0 {
+		out["tools"] = tools
+	}
+
+	if choice := asMap(body["tool_choice"]); choice != nil {
+		switch asString(choice["type"]) {
+		case "auto":
+			out["tool_choice"] = "auto"
+		case "any":
+			out["tool_choice"] = "required"
+		case "none":
+			out["tool_choice"] = "none"
+		case "tool":
+			out["tool_choice"] = map[string]any{"type": "function", "function": map[string]any{"name": choice["name"]}}
+		}
+		if choice["disable_parallel_tool_use"] == true {
+			out["parallel_tool_calls"] = false
+		}
+	}
+
+	return out
+}
+
+func anthropicBlocksText(blocks []any) string {
+	var texts []string
+	for _, b := range blocks {
+		if block := asMap(b); asString(block["type"]) == "text" {
+			texts = append(texts, asString(block["text"]))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// anthropicMessageToOpenAI converts one message. tool_result blocks become separate tool
+// messages, which OpenAI requires to precede any remaining user text.
+func anthropicMessageToOpenAI(msg map[string]any) []any {
+	role := asString(msg["role"])
+	if text, ok := msg["content"].(string); ok {
+		return []any{map[string]any{"role": role, "content": text}}
+	}
+
+	var out []any
+	var parts []any
+	var texts []string
+	var toolCalls []any
+	hasImage := false
+	for _, b := range asSlice(msg["content"]) {
+		block := asMap(b)
+		switch asString(block["type"]) {
+		case "text":
+			texts = append(texts, asString(block["text"]))
+			parts = append(parts, map[string]any{"type": "text", "text": block["text"]})
+		case "image":
+			if url := anthropicImageURL(asMap(block["source"])); url != "" {
+				hasImage = true
+				parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]any{"url": url}})
+			}
+		case "tool_use":
+			args, _ := json.Marshal(block["input"])
+			toolCalls = append(toolCalls, map[string]any{
+				"id":       block["id"],
+				"type":     "function",
+				"function": map[string]any{"name": block["name"], "arguments": string(args)},
+			})
+		case "tool_result":
+			content := ""
+			switch c := block["content"].(type) {
+			case string:
+				content = c
+			case []any:
+				content = anthropicBlocksText(c)
+			}
+			if block["is_error"] == true {
+				content = "Error: " + content
+			}
+			out = append(out, map[string]any{"role": "tool", "tool_call_id": block["tool_use_id"], "content": content})
+		}
+	}
+
+	if len(parts) == 0 && len(toolCalls) == 0 {
+		return out
+	}
+	message := map[string]any{"role": role}
+	if hasImage {
+		message["content"] = parts
+	} else {
+		message["content"] = strings.Join(texts, "\n")
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+	return append(out, message)
+}
+
+func anthropicImageURL(source map[string]any) string {
+	switch asString(source["type"]) {
+	case "base64":
+		return "data:" + asString(source["media_type"]) + ";base64," + asString(source["data"])
+	case "url":
+		return asString(source["url"])
+	}
+	return ""
+}
+
+func anthropicStopReason(finishReason any) string {
+	if reason, ok := anthropicStopReasons[asString(finishReason)]; ok {
+		return reason
+	}
+	return "end_turn"
+}
+
+// anthropicErrorTypes maps OpenAI error types to Anthropic's where they differ
+var anthropicErrorTypes = map[string]string{
+	"server_error": "api_error",
+}
+
+func openAIToAnthropicError(status int, normalized map[string]any) map[string]any {
+	e := asMap(normalized["error"])
+	errType := asString(e["type"])
+	if mapped, ok := anthropicErrorTypes[errType]; ok {
+		errType = mapped
+	}
+	if status == http.StatusServiceUnavailable || status == 529 {
+		errType = "overloaded_error"
+	}
+	return map[string]any{
+		"type":  "error",
+		"error": map[string]any{"type": errType, "message": e["message"]},
+	}
+}
+
+func anthropicUsage(usage map[string]any) map[string]any {
+	prompt, _ := asNumber(usage["prompt_tokens"])
+	completion, _ := asNumber(usage["completion_tokens"])
+	return map[string]any{"input_tokens": prompt, "output_tokens": completion}
+}
+
+func openAIToAnthropicResponse(body map[string]any) map[string]any {
+	var content []any
+	var finishReason any
+	if choices := asSlice(body["choices"]); len(choices) > 0 {
+		choice := asMap(choices[0])
+		finishReason = choice["finish_reason"]
+		msg := asMap(choice["message"])
+		if reasoning := asString(msg["reasoning_content"]); reasoning != "" {
+			content = append(content, map[string]any{"type": "thinking", "thinking": reasoning, "signature": ""})
+		}
+		if text := asString(msg["content"]); text != "" {
+			content = append(content, map[string]any{"type": "text", "text": text})
+		}
+		for _, c := range asSlice(msg["tool_calls"]) {
+			call := asMap(c)
+			fn := asMap(call["function"])
+			if fn == nil {
+				continue
+			}
+			id := asString(call["id"])
+			if id == "" {
+				id = newID("toolu_")
+			}
+			content = append(content, map[string]any{
+				"type":  "tool_use",
+				"id":    id,
+				"name":  fn["name"],
+				"input": toolArguments(fn["arguments"]),
+			})
+		}
+	}
+	if content == nil {
+		content = []any{}
+	}
+
+	return map[string]any{
+		"id":            newID("msg_"),
+		"type":          "message",
+		"role":          "assistant",
+		"model":         body["model"],
+		"content":       content,
+		"stop_reason":   anthropicStopReason(finishReason),
+		"stop_sequence": nil,
+		"usage":         anthropicUsage(asMap(body["usage"])),
+	}
+}
+
+// openAIToAnthropicStream turns OpenAI chat.completion.chunk events into the Messages API
+// event sequence: message_start, content blocks (start/delta/stop), message_delta, message_stop.
+type openAIToAnthropicStream struct {
+	id           string
+	model        any
+	started      bool
+	blockIndex   int
+	blockType    string
+	toolBlocks   map[int]int // OpenAI tool call index -> content block index
+	finishReason any
+	usage        map[string]any
+}
+
+func (s *openAIToAnthropicStream) start() []map[string]any {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	return []map[string]any{{
+		"type": "message_start",
+		"message": map[string]any{
+			"id":            s.id,
+			"type":          "message",
+			"role":          "assistant",
+			"model":         s.model,
+			"content":       []any{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         map[string]any{"input_tokens": 0, "output_tokens": 0},
+		},
+	}}
+}
+
+// openBlock closes the current block and starts a new one
+func (s *openAIToAnthropicStream) openBlock(block map[string]any) []map[string]any {
+	events := s.closeBlock()
+	s.blockIndex++
+	s.blockType = asString(block["type"])
+	return append(events, map[string]any{"type": "content_block_start", "index": s.blockIndex, "content_block": block})
+}
+
+func (s *openAIToAnthropicStream) closeBlock() []map[string]any {
+	if s.blockType == "" {
+		return nil
+	}
+	s.blockType = ""
+	return []map[string]any{{"type": "content_block_stop", "index": s.blockIndex}}
+}
+
+func (s *openAIToAnthropicStream) delta(delta map[string]any) map[string]any {
+	return map[string]any{"type": "content_block_delta", "index": s.blockIndex, "delta": delta}
+}
+
+func (s *openAIToAnthropicStream) Chunk(data map[string]any) []map[string]any {
+	if model, ok := data["model"]; ok && s.model == nil {
+		s.model = model
+	}
+	if usage := asMap(data["usage"]); usage != nil {
+		s.usage = usage
+	}
+
+	events := s.start()
+	choices := asSlice(data["choices"])
+	if len(choices) == 0 {
+		return events
+	}
+	choice := asMap(choices[0])
+	if reason, ok := choice["finish_reason"]; ok && reason != nil {
+		s.finishReason = reason
+	}
+	delta := asMap(choice["delta"])
+
+	if reasoning := asString(delta["reasoning_content"]); reasoning != "" {
+		if s.blockType != "thinking" {
+			events = append(events, s.openBlock(map[string]any{"type": "thinking", "thinking": ""})...)
+		}
+		events = append(events, s.delta(map[string]any{"type": "thinking_delta", "thinking": reasoning}))
+	}
+	if text := asString(delta["content"]); text != "" {
+		if s.blockType != "text" {
+			events = append(events, s.openBlock(map[string]any{"type": "text", "text": ""})...)
+		}
+		events = append(events, s.delta(map[string]any{"type": "text_delta", "text": text}))
+	}
+
+	for _, c := range asSlice(delta["tool_calls"]) {
+		call := asMap(c)
+		idx := 0
+		if n, ok := asNumber(call["index"]); ok {
+			idx = int(n)
+		}
+		if s.toolBlocks == nil {
+			s.toolBlocks = make(map[int]int)
+		}
+		fn := asMap(call["function"])
+		block, seen := s.toolBlocks[idx]
+		if !seen {
+			id := asString(call["id"])
+			if id == "" {
+				id = newID("toolu_")
+			}
+			events = append(events, s.openBlock(map[string]any{"type": "tool_use", "id": id, "name": fn["name"], "input": map[string]any{}})...)
+			s.toolBlocks[idx] = s.blockIndex
+			block = s.blockIndex
+		}
+		// Fragments for an earlier call after another block started can't be represented; drop them
+		if args := asString(fn["arguments"]); args != "" && block == s.blockIndex {
+			events = append(events, s.delta(map[string]any{"type": "input_json_delta", "partial_json": args}))
+		}
+	}
+
+	return events
+}
+
+func (s *openAIToAnthropicStream) Finish() []map[string]any {
+	events := s.start()
+	events = append(events, s.closeBlock()...)
+
+	usage := map[string]any{"output_tokens": 0}
+	if s.usage != nil {
+		usage = anthropicUsage(s.usage)
+	}
+	events = append(events,
+		map[string]any{
+			"type":  "message_delta",
+			"delta": map[string]any{"stop_reason": anthropicStopReason(s.finishReason), "stop_sequence": nil},
+			"usage": usage,
+		},
+		map[string]any{"type": "message_stop"},
+	)
+	return events
+}
@@ -0,0 +1,127 @@
+package translate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnthropicToOpenAIRequest(t *testing.T) {
+	p := Lookup("anthropic-to-openai")
+	if p == nil {
+		t.Fatal("anthropic-to-openai profile not registered")
+	}
+
+	out := p.Request(map[string]any{
+		"model":      "claude-ish",
+		"max_tokens": 256.0,
+		"system":     []any{map[string]any{"type": "text", "text": "be brief"}},
+		"stream":     true,
+		"messages": []any{
+			map[string]any{"role": "user", "content": "weather in Oslo?"},
+			map[string]any{"role": "assistant", "content": []any{
+				map[string]any{"type": "text", "text": "Checking."},
+				map[string]any{"type": "tool_use", "id": "toolu_1", "name": "weather", "input": map[string]any{"city": "Oslo"}},
+			}},
+			map[string]any{"role": "user", "content": []any{
+				map[string]any{"type": "tool_result", "tool_use_id": "toolu_1", "content": "3C"},
+				map[string]any{"type": "text", "text": "thanks"},
+			}},
+		},
+		"tools": []any{
+			map[string]any{"name": "weather", "description": "get weather", "input_schema": map[string]any{"type": "object"}},
+			map[string]any{"type": "web_search_20250305", "name": "web_search"},
+		},
+		"tool_choice": map[string]any{"type": "any"},
+	}, "/v1/messages")
+
+	if out["max_tokens"] != 256.0 || out["stream"] != true || out["tool_choice"] != "required" {
+		t.Fatalf("params not mapped: %v", out)
+	}
+	if tools := out["tools"].([]any); len(tools) != 1 {
+		t.Fatalf("expected server tools to be dropped, got %v", tools)
+	}
+
+	messages := out["messages"].([]any)
+	roles := make([]string, len(messages))
+	for i, m := range messages {
+		roles[i] = m.(map[string]any)["role"].(string)
+	}
+	if !reflect.DeepEqual(roles, []string{"system", "user", "assistant", "tool", "user"}) {
+		t.Fatalf("roles = %v", roles)
+	}
+	call := messages[2].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	if call["id"] != "toolu_1" || call["function"].(map[string]any)["arguments"] != `{"city":"Oslo"}` {
+		t.Fatalf("tool_use not converted: %v", call)
+	}
+	if messages[3].(map[string]any)["tool_call_id"] != "toolu_1" {
+		t.Fatalf("tool_result not paired: %v", messages[3])
+	}
+}
+
+func TestOpenAIToAnthropicResponse(t *testing.T) {
+	out := Lookup("anthropic-to-openai").Response(map[string]any{
+		"model": "m",
+		"choices": []any{map[string]any{
+			"finish_reason": "tool_calls",
+			"message": map[string]any{
+				"content":    "Checking.",
+				"tool_calls": []any{map[string]any{"id": "call_9", "function": map[string]any{"name": "weather", "arguments": `{"city":"Oslo"}`}}},
+			},
+		}},
+		"usage": map[string]any{"prompt_tokens": 10.0, "completion_tokens": 4.0},
+	})
+
+	if out["type"] != "message" || out["stop_reason"] != "tool_use" {
+		t.Fatalf("unexpected envelope: %v", out)
+	}
+	content := out["content"].([]any)
+	if len(content) != 2 {
+		t.Fatalf("expected text and tool_use blocks, got %v", content)
+	}
+	block := content[1].(map[string]any)
+	if block["id"] != "call_9" || !reflect.DeepEqual(block["input"], map[string]any{"city": "Oslo"}) {
+		t.Fatalf("tool_use block = %v", block)
+	}
+	if out["usage"].(map[string]any)["output_tokens"] != 4.0 {
+		t.Fatalf("usage = %v", out["usage"])
+	}
+}
+
+func TestOpenAIToAnthropicStream(t *testing.T) {
+	s := Lookup("anthropic-to-openai").NewStream()
+
+	var events []map[string]any
+	events = append(events, s.Chunk(map[string]any{"model": "m", "choices": []any{map[string]any{"delta": map[string]any{"role": "assistant", "content": "Hi"}}}})...)
+	events = append(events, s.Chunk(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{
+		"tool_calls": []any{map[string]any{"index": 0.0, "id": "call_1", "function": map[string]any{"name": "f", "arguments": `{"a":`}}},
+	}}}})...)
+	events = append(events, s.Chunk(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{
+		"tool_calls": []any{map[string]any{"index": 0.0, "function": map[string]any{"arguments": `1}`}}},
+	}}}})...)
+	events = append(events, s.Chunk(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{}, "finish_reason": "tool_calls"}}})...)
+	events = append(events, s.Chunk(map[string]any{"choices": []any{}, "usage": map[string]any{"prompt_tokens": 5.0, "completion_tokens": 7.0}})...)
+	events = append(events, s.Finish()...)
+
+	var types []string
+	for _, e := range events {
+		types = append(types, e["type"].(string))
+	}
+	want := []string{
+		"message_start",
+		"content_block_start", "content_block_delta",
+		"content_block_stop", "content_block_start", "content_block_delta", "content_block_delta",
+		"content_block_stop", "message_delta", "message_stop",
+	}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("event types = %v\nwant %v", types, want)
+	}
+
+	toolStart := events[4]["content_block"].(map[string]any)
+	if toolStart["type"] != "tool_use" || toolStart["id"] != "call_1" || events[4]["index"] != 1 {
+		t.Fatalf("tool block start = %v", events[4])
+	}
+	messageDelta := events[8]
+	if messageDelta["delta"].(map[string]any)["stop_reason"] != "tool_use" || messageDelta["usage"].(map[string]any)["output_tokens"] != 7.0 {
+		t.Fatalf("message_delta = %v", messageDelta)
+	}
+}
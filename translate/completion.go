@@ -0,0 +1,208 @@
+package translate
+
+import (
+	"strings"
+	"time"
+)
+
+// ChatTemplate is a built-in prompt format for rendering chat messages into raw text
+type ChatTemplate struct {
+	Text string   // Go template over .Messages (role, content) and .Model
+	Stop []string // End-of-turn markers added to the request's stop strings
+}
+
+// ChatTemplates are the built-in prompt formats. BOS tokens are left to the backend,
+// which adds them when tokenizing the prompt.
+var ChatTemplates = map[string]ChatTemplate{
+	"chatml": {
+		Text: "{{range .Messages}}<|im_start|>{{.role}}\n{{.content}}<|im_end|>\n{{end}}<|im_start|>assistant\n",
+		Stop: []string{"<|im_end|>"},
+	},
+	"llama3": {
+		Text: "{{range .Messages}}<|start_header_id|>{{.role}}<|end_header_id|>\n\n{{.content}}<|eot_id|>{{end}}" +
+			"<|start_header_id|>assistant<|end_header_id|>\n\n",
+		Stop: []string{"<|eot_id|>"},
+	},
+	"mistral": {
+		Text: `{{range .Messages}}{{if eq .role "assistant"}}{{.content}}</s>{{else}}[INST] {{.content}} [/INST]{{end}}{{end}}`,
+		Stop: []string{"</s>"},
+	},
+	"gemma": {
+		Text: "{{range .Messages}}<start_of_turn>{{if eq .role \"assistant\"}}model{{else}}user{{end}}\n{{.content}}<end_of_turn>\n{{end}}" +
+			"<start_of_turn>model\n",
+		Stop: []string{"<end_of_turn>"},
+	},
+}
+
+// Completion converts llama.cpp /completion responses and streams back to OpenAI chat
+// completions. It has no Request: ChatToCompletion builds the request from a rendered prompt.
+var Completion = &Profile{
+	Name:       "chat-to-completion",
+	TargetPath: "/completion",
+	Response:   completionToChatResponse,
+	NewStream: func() Stream {
+		return &completionToChatStream{id: newID("chatcmpl-"), created: time.Now().Unix()}
+	},
+	SSE:        true,
+	DoneMarker: "[DONE]",
+}
+
+// chatToCompletionParams maps OpenAI chat params to llama.cpp /completion params
+var chatToCompletionParams = map[string]string{
+	"model":             "model",
+	"stream":            "stream",
+	"temperature":       "temperature",
+	"top_p":             "top_p",
+	"top_k":             "top_k",
+	"min_p":             "min_p",
+	"seed":              "seed",
+	"presence_penalty":  "presence_penalty",
+	"frequency_penalty": "frequency_penalty",
+	"repeat_penalty":    "repeat_penalty",
+	"grammar":           "grammar",
+	"json_schema":       "json_schema",
+	"cache_prompt":      "cache_prompt",
+}
+
+// ChatToCompletion builds a /completion request from a chat request and its rendered
+// prompt. The client's stop strings are kept alongside the template's.
+func ChatToCompletion(body map[string]any, prompt string, stop []string) map[string]any {
+	out := map[string]any{"prompt": prompt}
+	copyKeys(out, body, chatToCompletionParams)
+
+	if n, ok := body["max_completion_tokens"]; ok {
+		out["n_predict"] = n
+	} else if n, ok := body["max_tokens"]; ok {
+		out["n_predict"] = n
+	}
+
+	var stops []any
+	switch s := body["stop"].(type) {
+	case string:
+		stops = append(stops, s)
+	case []any:
+		stops = append(stops, s...)
+	}
+	for _, s := range stop {
+		stops = append(stops, s)
+	}
+	if len(stops) > 0 {
+		out["stop"] = stops
+	}
+	return out
+}
+
+// ChatMessages flattens chat messages for prompt templates: content parts become plain
+// text, so templates only deal with role and content strings.
+func ChatMessages(messages []any) []any {
+	out := make([]any, 0, len(messages))
+	for _, m := range messages {
+		msg := asMap(m)
+		content := asString(msg["content"])
+		if parts := asSlice(msg["content"]); parts != nil {
+			var texts []string
+			for _, p := range parts {
+				if text := asString(asMap(p)["text"]); text != "" {
+					texts = append(texts, text)
+				}
+			}
+			content = strings.Join(texts, "\n")
+		}
+		out = append(out, map[string]any{"role": asString(msg["role"]), "content": content})
+	}
+	return out
+}
+
+func completionFinishReason(body map[string]any) string {
+	if body["stop_type"] == "limit" || body["stopped_limit"] == true {
+		return "length"
+	}
+	return "stop"
+}
+
+func completionUsage(body map[string]any) map[string]any {
+	prompt, hasPrompt := asNumber(body["tokens_evaluated"])
+	completion, hasCompletion := asNumber(body["tokens_predicted"])
+	if !hasPrompt && !hasCompletion {
+		return nil
+	}
+	return map[string]any{
+		"prompt_tokens":     prompt,
+		"completion_tokens": completion,
+		"total_tokens":      prompt + completion,
+	}
+}
+
+func completionToChatResponse(body map[string]any) map[string]any {
+	out := map[string]any{
+		"id":      newID("chatcmpl-"),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   body["model"],
+		"choices": []any{map[string]any{
+			"index":         0,
+			"message":       map[string]any{"role": "assistant", "content": asString(body["content"])},
+			"finish_reason": completionFinishReason(body),
+		}},
+	}
+	if usage := completionUsage(body); usage != nil {
+		out["usage"] = usage
+	}
+	return out
+}
+
+// completionToChatStream turns /completion content events into chat.completion.chunk events
+type completionToChatStream struct {
+	id       string
+	created  int64
+	model    any
+	sentRole bool
+	finished bool
+}
+
+func (s *completionToChatStream) chunk(delta map[string]any, finishReason any) map[string]any {
+	return map[string]any{
+		"id":      s.id,
+		"object":  "chat.completion.chunk",
+		"created": s.created,
+		"model":   s.model,
+		"choices": []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finishReason}},
+	}
+}
+
+func (s *completionToChatStream) Chunk(data map[string]any) []map[string]any {
+	if s.model == nil {
+		s.model = data["model"]
+	}
+
+	var out []map[string]any
+	delta := map[string]any{}
+	if !s.sentRole {
+		s.sentRole = true
+		delta["role"] = "assistant"
+	}
+	if content := asString(data["content"]); content != "" {
+		delta["content"] = content
+	}
+	if len(delta) > 0 {
+		out = append(out, s.chunk(delta, nil))
+	}
+
+	if data["stop"] == true && !s.finished {
+		s.finished = true
+		final := s.chunk(map[string]any{}, completionFinishReason(data))
+		if usage := completionUsage(data); usage != nil {
+			final["usage"] = usage
+		}
+		out = append(out, final)
+	}
+	return out
+}
+
+func (s *completionToChatStream) Finish() []map[string]any {
+	if s.finished {
+		return nil
+	}
+	s.finished = true
+	return []map[string]any{s.chunk(map[string]any{}, "stop")}
+}
@@ -0,0 +1,78 @@
+package translate
+
+import "testing"
+
+func TestChatToCompletion(t *testing.T) {
+	out := ChatToCompletion(map[string]any{
+		"model":       "m",
+		"max_tokens":  64.0,
+		"temperature": 0.2,
+		"stop":        "###",
+		"messages":    []any{},
+	}, "PROMPT", []string{"<|im_end|>"})
+
+	if out["prompt"] != "PROMPT" || out["n_predict"] != 64.0 || out["temperature"] != 0.2 || out["model"] != "m" {
+		t.Fatalf("unexpected completion request: %v", out)
+	}
+	if _, ok := out["messages"]; ok {
+		t.Fatal("messages should not be forwarded")
+	}
+	stop := out["stop"].([]any)
+	if len(stop) != 2 || stop[0] != "###" || stop[1] != "<|im_end|>" {
+		t.Fatalf("stop = %v, want client and template stops", stop)
+	}
+}
+
+func TestChatMessagesFlattensParts(t *testing.T) {
+	got := ChatMessages([]any{map[string]any{"role": "user", "content": []any{
+		map[string]any{"type": "text", "text": "a"},
+		map[string]any{"type": "image_url", "image_url": map[string]any{"url": "x"}},
+		map[string]any{"type": "text", "text": "b"},
+	}}})
+	if msg := got[0].(map[string]any); msg["role"] != "user" || msg["content"] != "a\nb" {
+		t.Fatalf("flattened = %v", msg)
+	}
+}
+
+func TestCompletionToChatResponse(t *testing.T) {
+	out := Completion.Response(map[string]any{
+		"content":          "hello",
+		"model":            "m",
+		"stop":             true,
+		"stop_type":        "limit",
+		"tokens_evaluated": 10.0,
+		"tokens_predicted": 4.0,
+	})
+
+	choice := out["choices"].([]any)[0].(map[string]any)
+	if choice["message"].(map[string]any)["content"] != "hello" || choice["finish_reason"] != "length" {
+		t.Fatalf("unexpected choice: %v", choice)
+	}
+	if usage := out["usage"].(map[string]any); usage["total_tokens"] != 14.0 {
+		t.Fatalf("usage = %v, want 14 total tokens", usage)
+	}
+}
+
+func TestCompletionToChatStream(t *testing.T) {
+	s := Completion.NewStream()
+
+	first := s.Chunk(map[string]any{"content": "Hel", "stop": false})
+	if len(first) != 1 {
+		t.Fatalf("expected one chunk, got %v", first)
+	}
+	delta := first[0]["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)
+	if delta["role"] != "assistant" || delta["content"] != "Hel" {
+		t.Fatalf("first delta = %v", delta)
+	}
+
+	last := s.Chunk(map[string]any{"content": "", "stop": true, "stop_type": "eos", "tokens_evaluated": 3.0, "tokens_predicted": 2.0})
+	if len(last) != 1 || last[0]["usage"] == nil {
+		t.Fatalf("expected final chunk with usage, got %v", last)
+	}
+	if reason := last[0]["choices"].([]any)[0].(map[string]any)["finish_reason"]; reason != "stop" {
+		t.Fatalf("finish_reason = %v, want stop", reason)
+	}
+	if trailing := s.Finish(); trailing != nil {
+		t.Fatalf("Finish after final chunk = %v, want nothing", trailing)
+	}
+}
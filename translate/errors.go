@@ -0,0 +1,125 @@
+package translate
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// finishReasons maps backend finish reasons onto OpenAI's (stop, length, tool_calls,
+// content_filter). Unknown values pass through unchanged.
+var finishReasons = map[string]string{
+	"stop":           "stop",
+	"eos":            "stop",
+	"word":           "stop",
+	"end_turn":       "stop",
+	"stop_sequence":  "stop",
+	"length":         "length",
+	"limit":          "length",
+	"max_tokens":     "length",
+	"tool_calls":     "tool_calls",
+	"tool_use":       "tool_calls",
+	"function_call":  "tool_calls",
+	"content_filter": "content_filter",
+	"safety":         "content_filter",
+	"refusal":        "content_filter",
+}
+
+// NormalizeFinishReason returns the OpenAI finish reason for a backend's value. nil (still
+// streaming) stays nil.
+func NormalizeFinishReason(reason any) any {
+	s, ok := reason.(string)
+	if !ok {
+		return reason
+	}
+	if mapped, ok := finishReasons[strings.ToLower(s)]; ok {
+		return mapped
+	}
+	return s
+}
+
+// NormalizeFinishReasons rewrites choices[].finish_reason in an OpenAI response or stream
+// chunk in place and returns body. Bodies without choices are left alone.
+func NormalizeFinishReasons(body map[string]any) map[string]any {
+	for _, c := range asSlice(body["choices"]) {
+		if choice := asMap(c); choice != nil {
+			if reason, ok := choice["finish_reason"]; ok {
+				choice["finish_reason"] = NormalizeFinishReason(reason)
+			}
+		}
+	}
+	return body
+}
+
+// errorTypes are the OpenAI error types used when a backend's error doesn't name one
+var errorTypes = map[int]string{
+	http.StatusUnauthorized:    "authentication_error",
+	http.StatusForbidden:       "permission_error",
+	http.StatusNotFound:        "not_found_error",
+	http.StatusTooManyRequests: "rate_limit_error",
+}
+
+// NormalizeError converts a backend error body into OpenAI's
+// {"error": {"message", "type", "code"}}. It understands OpenAI and llama.cpp errors,
+// Ollama's {"error": "..."}, Anthropic's {"type": "error", "error": {...}}, Google's
+// {"error": {"status": ...}}, {"detail": ...} and {"message": ...} bodies, and plain text.
+func NormalizeError(status int, body []byte) map[string]any {
+	var message, errType string
+	var code any
+
+	var parsed map[string]any
+	if json.Unmarshal(body, &parsed) == nil {
+		switch e := parsed["error"].(type) {
+		case string:
+			message = e
+		case map[string]any:
+			message = asString(e["message"])
+			errType = asString(e["type"])
+			code = e["code"]
+			if s := asString(e["status"]); s != "" {
+				// Google puts the HTTP status in code and the symbolic name in status
+				code = strings.ToLower(s)
+			}
+		}
+		if message == "" {
+			switch d := parsed["detail"].(type) {
+			case string:
+				message = d
+			case nil:
+			default:
+				encoded, _ := json.Marshal(d)
+				message = string(encoded)
+			}
+		}
+		if message == "" {
+			message = asString(parsed["message"])
+		}
+	}
+	if message == "" {
+		message = strings.TrimSpace(string(body))
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+
+	if errType == "" {
+		errType = errorTypes[status]
+	}
+	if errType == "" {
+		errType = "invalid_request_error"
+		if status >= http.StatusInternalServerError {
+			errType = "server_error"
+		}
+	}
+	// OpenAI codes are strings; llama.cpp repeats the HTTP status here
+	if _, ok := code.(string); !ok {
+		code = nil
+	}
+
+	return map[string]any{"error": map[string]any{"message": message, "type": errType, "code": code}}
+}
+
+// errorMessage returns the message of a normalized error
+func errorMessage(normalized map[string]any) string {
+	return asString(asMap(normalized["error"])["message"])
+}
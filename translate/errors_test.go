@@ -0,0 +1,87 @@
+package translate
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   map[string]any
+	}{
+		{"ollama", 404, `{"error":"model 'x' not found"}`,
+			map[string]any{"message": "model 'x' not found", "type": "not_found_error", "code": nil}},
+		{"llama.cpp", 400, `{"error":{"code":400,"message":"context too long","type":"exceed_context_size_error"}}`,
+			map[string]any{"message": "context too long", "type": "exceed_context_size_error", "code": nil}},
+		{"openai", 429, `{"error":{"message":"slow down","type":"requests","code":"rate_limit_exceeded"}}`,
+			map[string]any{"message": "slow down", "type": "requests", "code": "rate_limit_exceeded"}},
+		{"google", 400, `{"error":{"code":400,"message":"bad field","status":"INVALID_ARGUMENT"}}`,
+			map[string]any{"message": "bad field", "type": "invalid_request_error", "code": "invalid_argument"}},
+		{"fastapi", 422, `{"detail":[{"msg":"field required"}]}`,
+			map[string]any{"message": `[{"msg":"field required"}]`, "type": "invalid_request_error", "code": nil}},
+		{"plain text", 502, "upstream connect error\n",
+			map[string]any{"message": "upstream connect error", "type": "server_error", "code": nil}},
+		{"empty", 503, "",
+			map[string]any{"message": "Service Unavailable", "type": "server_error", "code": nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeError(tt.status, []byte(tt.body))
+			if !reflect.DeepEqual(got["error"], tt.want) {
+				t.Fatalf("error = %v, want %v", got["error"], tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslateErrorClientDialects(t *testing.T) {
+	backend := []byte(`{"error":{"code":503,"message":"loading model","type":"unavailable_error"}}`)
+	tests := map[string]string{
+		"openai-to-ollama":    `{"error":{"code":null,"message":"loading model","type":"unavailable_error"}}`,
+		"ollama-to-openai":    `{"error":"loading model"}`,
+		"anthropic-to-openai": `{"error":{"message":"loading model","type":"overloaded_error"},"type":"error"}`,
+		"gemini-to-openai":    `{"error":{"code":503,"message":"loading model","status":"UNAVAILABLE"}}`,
+	}
+	for name, want := range tests {
+		got := Lookup(name).TranslateError(503, backend)
+		var gotJSON, wantJSON any
+		json.Unmarshal(got, &gotJSON)
+		json.Unmarshal([]byte(want), &wantJSON)
+		if !reflect.DeepEqual(gotJSON, wantJSON) {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestNormalizeFinishReasons(t *testing.T) {
+	body := map[string]any{"choices": []any{
+		map[string]any{"finish_reason": "eos"},
+		map[string]any{"finish_reason": "limit"},
+		map[string]any{"finish_reason": "tool_use"},
+		map[string]any{"finish_reason": "SAFETY"},
+		map[string]any{"finish_reason": nil},
+		map[string]any{"finish_reason": "abort"},
+	}}
+	NormalizeFinishReasons(body)
+
+	want := []any{"stop", "length", "tool_calls", "content_filter", nil, "abort"}
+	for i, c := range body["choices"].([]any) {
+		if got := c.(map[string]any)["finish_reason"]; got != want[i] {
+			t.Errorf("choice %d finish_reason = %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestGeminiResponseNormalizesFinishReason(t *testing.T) {
+	out := Lookup("gemini-to-openai").Response(NormalizeFinishReasons(map[string]any{
+		"choices": []any{map[string]any{"message": map[string]any{"content": "hi"}, "finish_reason": "eos"}},
+	}))
+	candidate := asMap(asSlice(out["candidates"])[0])
+	if candidate["finishReason"] != "STOP" {
+		t.Fatalf("finishReason = %v, want STOP", candidate["finishReason"])
+	}
+}
@@ -0,0 +1,369 @@
+package translate
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	register(&Profile{
+		Name:       "gemini-to-openai",
+		TargetPath: "/v1/chat/completions",
+		Request:    geminiToOpenAIRequest,
+		Response:   openAIToGeminiResponse,
+		Error:      openAIToGeminiError,
+		NewStream: func() Stream {
+			return &openAIToGeminiStream{}
+		},
+		// streamGenerateContent?alt=sse has no terminal marker
+		SSE: true,
+	})
+}
+
+// geminiPathPattern extracts the model and method from /v1beta/models/{model}:{method}
+var geminiPathPattern = regexp.MustCompile(`models/([^/:]+):(\w+)`)
+
+// geminiToOpenAIOptions maps generationConfig keys to OpenAI params
+var geminiToOpenAIOptions = map[string]string{
+	"temperature":      "temperature",
+	"topP":             "top_p",
+	"topK":             "top_k",
+	"maxOutputTokens":  "max_tokens",
+	"stopSequences":    "stop",
+	"candidateCount":   "n",
+	"seed":             "seed",
+	"presencePenalty":  "presence_penalty",
+	"frequencyPenalty": "frequency_penalty",
+}
+
+var geminiFinishReasons = map[string]string{
+	"stop":           "STOP",
+	"length":         "MAX_TOKENS",
+	"content_filter": "SAFETY",
+	"tool_calls":     "STOP",
+}
+
+// geminiField reads a field accepting both the camelCase and snake_case spellings
+// the Gemini REST API allows.
+func geminiField(m map[string]any, camel string) any {
+	if v, ok := m[camel]; ok {
+		return v
+	}
+	var snake strings.Builder
+	for _, r := range camel {
+		if r >= 'A' && r <= 'Z' {
+			snake.WriteByte('_')
+			r += 'a' - 'A'
+		}
+		snake.WriteRune(r)
+	}
+	return m[snake.String()]
+}
+
+func geminiToOpenAIRequest(body map[string]any, path string) map[string]any {
+	out := make(map[string]any)
+
+	if match := geminiPathPattern.FindStringSubmatch(path); match != nil {
+		out["model"] = match[1]
+		if match[2] == "streamGenerateContent" {
+			out["stream"] = true
+			out["stream_options"] = map[string]any{"include_usage": true}
+		}
+	}
+
+	var messages []any
+	if system := asMap(geminiField(body, "systemInstruction")); system != nil {
+		if text := geminiPartsText(asSlice(system["parts"])); text != "" {
+			messages = append(messages, map[string]any{"role": "system", "content": text})
+		}
+	}
+	messages = append(messages, geminiContentsToOpenAI(asSlice(body["contents"]))...)
+	out["messages"] = messages
+
+	genConfig := asMap(geminiField(body, "generationConfig"))
+	for from, to := range geminiToOpenAIOptions {
+		if v := geminiField(genConfig, from); v != nil {
+			out[to] = v
+		}
+	}
+	if schema := asMap(geminiField(genConfig, "responseSchema")); schema != nil {
+		out["response_format"] = map[string]any{
+			"type":        "json_schema",
+			"json_schema": map[string]any{"name": "response", "schema": lowercaseSchemaTypes(schema)},
+		}
+	} else if asString(geminiField(genConfig, "responseMimeType")) == "application/json" {
+		out["response_format"] = map[string]any{"type": "json_object"}
+	}
+
+	var tools []any
+	for _, t := range asSlice(body["tools"]) {
+		for _, d := range asSlice(geminiField(asMap(t), "functionDeclarations")) {
+			decl := asMap(d)
+			fn := map[string]any{"name": decl["name"]}
+			if desc, ok := decl["description"]; ok {
+				fn["description"] = desc
+			}
+			if params := asMap(decl["parameters"]); params != nil {
+				fn["parameters"] = lowercaseSchemaTypes(params)
+			}
+			tools = append(tools, map[string]any{"type": "function", "function": fn})
+		}
+	}
+	if len(tools) > 0 {
+		out["tools"] = tools
+	}
+
+	return out
+}
+
+func geminiPartsText(parts []any) string {
+	var texts []string
+	for _, p := range parts {
+		if text, ok := asMap(p)["text"].(string); ok {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// geminiContentsToOpenAI converts contents/parts into OpenAI messages. Gemini has no tool
+// call IDs, so function responses are paired with the latest call of the same name.
+func geminiContentsToOpenAI(contents []any) []any {
+	var messages []any
+	callIDs := make(map[string]string)
+
+	for _, c := range contents {
+		content := asMap(c)
+		role := asString(content["role"])
+		if role == "model" {
+			role = "assistant"
+		} else if role == "" {
+			role = "user"
+		}
+
+		var texts []string
+		var images []any
+		var toolCalls []any
+		for _, p := range asSlice(content["parts"]) {
+			part := asMap(p)
+			if text, ok := part["text"].(string); ok {
+				texts = append(texts, text)
+			}
+			if inline := asMap(geminiField(part, "inlineData")); inline != nil {
+				images = append(images, map[string]any{
+					"type":      "image_url",
+					"image_url": map[string]any{"url": "data:" + asString(geminiField(inline, "mimeType")) + ";base64," + asString(inline["data"])},
+				})
+			}
+			if call := asMap(geminiField(part, "functionCall")); call != nil {
+				id := newID("call_")
+				name := asString(call["name"])
+				callIDs[name] = id
+				args, _ := json.Marshal(call["args"])
+				toolCalls = append(toolCalls, map[string]any{
+					"id":       id,
+					"type":     "function",
+					"function": map[string]any{"name": name, "arguments": string(args)},
+				})
+			}
+			if resp := asMap(geminiField(part, "functionResponse")); resp != nil {
+				name := asString(resp["name"])
+				result, _ := json.Marshal(resp["response"])
+				messages = append(messages, map[string]any{
+					"role":         "tool",
+					"tool_call_id": callIDs[name],
+					"name":         name,
+					"content":      string(result),
+				})
+			}
+		}
+
+		if len(texts) == 0 && len(images) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+
+		msg := map[string]any{"role": role}
+		text := strings.Join(texts, "\n")
+		if len(images) > 0 {
+			msg["content"] = append([]any{map[string]any{"type": "text", "text": text}}, images...)
+		} else {
+			msg["content"] = text
+		}
+		if len(toolCalls) > 0 {
+			msg["tool_calls"] = toolCalls
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// lowercaseSchemaTypes converts Gemini's OBJECT/STRING schema types into JSON Schema spelling.
+func lowercaseSchemaTypes(schema map[string]any) map[string]any {
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		switch val := v.(type) {
+		case string:
+			if k == "type" {
+				val = strings.ToLower(val)
+			}
+			out[k] = val
+		case map[string]any:
+			out[k] = lowercaseSchemaTypes(val)
+		case []any:
+			items := make([]any, len(val))
+			for i, item := range val {
+				if m, ok := item.(map[string]any); ok {
+					items[i] = lowercaseSchemaTypes(m)
+				} else {
+					items[i] = item
+				}
+			}
+			out[k] = items
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func geminiFinishReason(reason any) string {
+	if mapped, ok := geminiFinishReasons[asString(reason)]; ok {
+		return mapped
+	}
+	return "FINISH_REASON_UNSPECIFIED"
+}
+
+// geminiErrorStatuses are the Google RPC status names for HTTP statuses
+var geminiErrorStatuses = map[int]string{
+	http.StatusBadRequest:            "INVALID_ARGUMENT",
+	http.StatusUnauthorized:          "UNAUTHENTICATED",
+	http.StatusForbidden:             "PERMISSION_DENIED",
+	http.StatusNotFound:              "NOT_FOUND",
+	http.StatusRequestEntityTooLarge: "INVALID_ARGUMENT",
+	http.StatusTooManyRequests:       "RESOURCE_EXHAUSTED",
+	http.StatusServiceUnavailable:    "UNAVAILABLE",
+	http.StatusGatewayTimeout:        "DEADLINE_EXCEEDED",
+}
+
+func openAIToGeminiError(status int, normalized map[string]any) map[string]any {
+	rpcStatus, ok := geminiErrorStatuses[status]
+	if !ok {
+		rpcStatus = "INTERNAL"
+		if status < http.StatusInternalServerError {
+			rpcStatus = "FAILED_PRECONDITION"
+		}
+	}
+	return map[string]any{"error": map[string]any{
+		"code":    status,
+		"message": errorMessage(normalized),
+		"status":  rpcStatus,
+	}}
+}
+
+func geminiUsage(usage map[string]any) map[string]any {
+	return map[string]any{
+		"promptTokenCount":     usage["prompt_tokens"],
+		"candidatesTokenCount": usage["completion_tokens"],
+		"totalTokenCount":      usage["total_tokens"],
+	}
+}
+
+func openAIMessageToGeminiParts(msg map[string]any) []any {
+	var parts []any
+	if reasoning := asString(msg["reasoning_content"]); reasoning != "" {
+		parts = append(parts, map[string]any{"text": reasoning, "thought": true})
+	}
+	if content := asString(msg["content"]); content != "" {
+		parts = append(parts, map[string]any{"text": content})
+	}
+	for _, call := range openAIToolCallsToOllama(asSlice(msg["tool_calls"])) {
+		fn := asMap(asMap(call)["function"])
+		parts = append(parts, map[string]any{
+			"functionCall": map[string]any{"name": fn["name"], "args": fn["arguments"]},
+		})
+	}
+	if len(parts) == 0 {
+		parts = []any{map[string]any{"text": ""}}
+	}
+	return parts
+}
+
+func openAIToGeminiResponse(body map[string]any) map[string]any {
+	var candidates []any
+	for i, c := range asSlice(body["choices"]) {
+		choice := asMap(c)
+		candidates = append(candidates, map[string]any{
+			"content":      map[string]any{"role": "model", "parts": openAIMessageToGeminiParts(asMap(choice["message"]))},
+			"finishReason": geminiFinishReason(choice["finish_reason"]),
+			"index":        i,
+		})
+	}
+
+	out := map[string]any{
+		"candidates":   candidates,
+		"modelVersion": body["model"],
+	}
+	if usage := asMap(body["usage"]); usage != nil {
+		out["usageMetadata"] = geminiUsage(usage)
+	}
+	return out
+}
+
+// openAIToGeminiStream turns OpenAI chat.completion.chunk events into Gemini response chunks.
+// Text is forwarded as it arrives; function calls, finish reason, and usage go on the final chunk.
+type openAIToGeminiStream struct {
+	model        any
+	finishReason any
+	usage        map[string]any
+	toolCalls    toolCallAccumulator
+}
+
+func (s *openAIToGeminiStream) Chunk(data map[string]any) []map[string]any {
+	if model, ok := data["model"]; ok {
+		s.model = model
+	}
+	if usage := asMap(data["usage"]); usage != nil {
+		s.usage = usage
+	}
+
+	choices := asSlice(data["choices"])
+	if len(choices) == 0 {
+		return nil
+	}
+	choice := asMap(choices[0])
+	if reason, ok := choice["finish_reason"]; ok && reason != nil {
+		s.finishReason = reason
+	}
+
+	delta := asMap(choice["delta"])
+	s.toolCalls.add(asSlice(delta["tool_calls"]))
+
+	if asString(delta["content"]) == "" && asString(delta["reasoning_content"]) == "" {
+		return nil
+	}
+	return []map[string]any{{
+		"candidates": []any{map[string]any{
+			"content": map[string]any{"role": "model", "parts": openAIMessageToGeminiParts(delta)},
+			"index":   0,
+		}},
+		"modelVersion": s.model,
+	}}
+}
+
+func (s *openAIToGeminiStream) Finish() []map[string]any {
+	message := map[string]any{"tool_calls": s.toolCalls.openAICalls()}
+	final := map[string]any{
+		"candidates": []any{map[string]any{
+			"content":      map[string]any{"role": "model", "parts": openAIMessageToGeminiParts(message)},
+			"finishReason": geminiFinishReason(s.finishReason),
+			"index":        0,
+		}},
+		"modelVersion": s.model,
+	}
+	if s.usage != nil {
+		final["usageMetadata"] = geminiUsage(s.usage)
+	}
+	return []map[string]any{final}
+}
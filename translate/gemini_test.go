@@ -0,0 +1,117 @@
+package translate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGeminiToOpenAIRequest(t *testing.T) {
+	p := Lookup("gemini-to-openai")
+	if p == nil {
+		t.Fatal("gemini-to-openai profile not registered")
+	}
+
+	out := p.Request(map[string]any{
+		"system_instruction": map[string]any{"parts": []any{map[string]any{"text": "be brief"}}},
+		"contents": []any{
+			map[string]any{"role": "user", "parts": []any{
+				map[string]any{"text": "weather?"},
+				map[string]any{"inlineData": map[string]any{"mimeType": "image/png", "data": "AAAA"}},
+			}},
+			map[string]any{"role": "model", "parts": []any{
+				map[string]any{"functionCall": map[string]any{"name": "weather", "args": map[string]any{"city": "Oslo"}}},
+			}},
+			map[string]any{"role": "user", "parts": []any{
+				map[string]any{"functionResponse": map[string]any{"name": "weather", "response": map[string]any{"temp": 3.0}}},
+			}},
+		},
+		"generationConfig": map[string]any{
+			"maxOutputTokens": 100.0,
+			"topP":            0.9,
+			"stopSequences":   []any{"END"},
+			"responseSchema":  map[string]any{"type": "OBJECT", "properties": map[string]any{"a": map[string]any{"type": "STRING"}}},
+		},
+		"tools": []any{map[string]any{"functionDeclarations": []any{
+			map[string]any{"name": "weather", "parameters": map[string]any{"type": "OBJECT"}},
+		}}},
+	}, "/v1beta/models/gemini-pro:streamGenerateContent")
+
+	if out["model"] != "gemini-pro" || out["stream"] != true {
+		t.Fatalf("model/stream not derived from path: %v", out)
+	}
+	if out["max_tokens"] != 100.0 || out["top_p"] != 0.9 || !reflect.DeepEqual(out["stop"], []any{"END"}) {
+		t.Fatalf("generationConfig not mapped: %v", out)
+	}
+
+	schema := out["response_format"].(map[string]any)["json_schema"].(map[string]any)["schema"].(map[string]any)
+	if schema["type"] != "object" || schema["properties"].(map[string]any)["a"].(map[string]any)["type"] != "string" {
+		t.Fatalf("schema types not lowercased: %v", schema)
+	}
+
+	messages := out["messages"].([]any)
+	if len(messages) != 4 {
+		t.Fatalf("expected system, user, assistant, tool messages; got %v", messages)
+	}
+	if messages[0].(map[string]any)["role"] != "system" {
+		t.Fatalf("system instruction not first: %v", messages[0])
+	}
+	if parts, ok := messages[1].(map[string]any)["content"].([]any); !ok || len(parts) != 2 {
+		t.Fatalf("expected text and image parts, got %v", messages[1])
+	}
+	call := messages[2].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	tool := messages[3].(map[string]any)
+	if tool["role"] != "tool" || tool["tool_call_id"] != call["id"] {
+		t.Fatalf("function response not paired with call: call=%v tool=%v", call, tool)
+	}
+
+	fn := out["tools"].([]any)[0].(map[string]any)["function"].(map[string]any)
+	if fn["parameters"].(map[string]any)["type"] != "object" {
+		t.Fatalf("tool parameters not converted: %v", fn)
+	}
+}
+
+func TestOpenAIToGeminiResponse(t *testing.T) {
+	out := Lookup("gemini-to-openai").Response(map[string]any{
+		"model": "gemini-pro",
+		"choices": []any{map[string]any{
+			"message":       map[string]any{"role": "assistant", "content": "Sunny"},
+			"finish_reason": "length",
+		}},
+		"usage": map[string]any{"prompt_tokens": 4.0, "completion_tokens": 1.0, "total_tokens": 5.0},
+	})
+
+	candidate := out["candidates"].([]any)[0].(map[string]any)
+	if candidate["finishReason"] != "MAX_TOKENS" {
+		t.Fatalf("finishReason = %v", candidate["finishReason"])
+	}
+	parts := candidate["content"].(map[string]any)["parts"].([]any)
+	if parts[0].(map[string]any)["text"] != "Sunny" {
+		t.Fatalf("unexpected parts: %v", parts)
+	}
+	if out["usageMetadata"].(map[string]any)["totalTokenCount"] != 5.0 {
+		t.Fatalf("usage not mapped: %v", out["usageMetadata"])
+	}
+}
+
+func TestOpenAIToGeminiStream(t *testing.T) {
+	s := Lookup("gemini-to-openai").NewStream()
+
+	chunks := s.Chunk(map[string]any{"model": "m", "choices": []any{map[string]any{"delta": map[string]any{"role": "assistant", "content": "Hi"}}}})
+	if len(chunks) != 1 {
+		t.Fatalf("expected a text chunk, got %v", chunks)
+	}
+	s.Chunk(map[string]any{"choices": []any{map[string]any{
+		"delta": map[string]any{"tool_calls": []any{map[string]any{"index": 0.0, "function": map[string]any{"name": "f", "arguments": `{"a":1}`}}}},
+	}}})
+	s.Chunk(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{}, "finish_reason": "tool_calls"}}})
+
+	final := s.Finish()
+	candidate := final[0]["candidates"].([]any)[0].(map[string]any)
+	if candidate["finishReason"] != "STOP" {
+		t.Fatalf("finishReason = %v", candidate["finishReason"])
+	}
+	part := candidate["content"].(map[string]any)["parts"].([]any)[0].(map[string]any)
+	if !reflect.DeepEqual(part["functionCall"], map[string]any{"name": "f", "args": map[string]any{"a": 1.0}}) {
+		t.Fatalf("function call not emitted: %v", part)
+	}
+}
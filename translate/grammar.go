@@ -0,0 +1,230 @@
+package translate
+
+import (
+	"encoding/json"
+	"maps"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(&Profile{
+		Name:     "openai-tools-via-grammar",
+		Request:  toolsToGrammarRequest,
+		Response: grammarToToolsResponse,
+		NewStream: func() Stream {
+			return &grammarToToolsStream{}
+		},
+		SSE:        true,
+		DoneMarker: "[DONE]",
+	})
+}
+
+// toolsToGrammarRequest replaces OpenAI tools with a JSON schema constraint for backends
+// without native tool calling (llama.cpp converts response_format schemas into a grammar).
+// The model answers with {"name": ..., "arguments": {...}} or, when tool_choice allows it,
+// {"content": "..."}. One call per turn; parallel calls can't be expressed this way.
+func toolsToGrammarRequest(body map[string]any, _ string) map[string]any {
+	out := maps.Clone(body)
+	delete(out, "tools")
+	delete(out, "tool_choice")
+	delete(out, "parallel_tool_calls")
+
+	messages := flattenToolHistory(asSlice(body["messages"]))
+
+	tools := asSlice(body["tools"])
+	toolChoice := body["tool_choice"]
+	if len(tools) == 0 || toolChoice == "none" {
+		out["messages"] = messages
+		return out
+	}
+
+	forced := asString(asMap(asMap(toolChoice)["function"])["name"])
+	var alternatives []any
+	var descriptions []string
+	for _, t := range tools {
+		fn := asMap(asMap(t)["function"])
+		name := asString(fn["name"])
+		if name == "" || (forced != "" && name != forced) {
+			continue
+		}
+		params := asMap(fn["parameters"])
+		if params == nil {
+			params = map[string]any{"type": "object"}
+		}
+		alternatives = append(alternatives, map[string]any{
+			"type":                 "object",
+			"properties":           map[string]any{"name": map[string]any{"const": name}, "arguments": params},
+			"required":             []any{"name", "arguments"},
+			"additionalProperties": false,
+		})
+		line := "- " + name
+		if desc := asString(fn["description"]); desc != "" {
+			line += ": " + desc
+		}
+		descriptions = append(descriptions, line)
+	}
+
+	instruction := "You can call these functions:\n" + strings.Join(descriptions, "\n") +
+		"\n\nTo call one, reply with JSON {\"name\": <function>, \"arguments\": {...}}."
+	if forced == "" && toolChoice != "required" {
+		alternatives = append(alternatives, map[string]any{
+			"type":                 "object",
+			"properties":           map[string]any{"content": map[string]any{"type": "string"}},
+			"required":             []any{"content"},
+			"additionalProperties": false,
+		})
+		instruction += " To answer directly, reply with JSON {\"content\": <answer>}."
+	}
+
+	out["messages"] = append([]any{map[string]any{"role": "system", "content": instruction}}, messages...)
+	out["response_format"] = map[string]any{
+		"type":        "json_schema",
+		"json_schema": map[string]any{"name": "tool_call", "schema": map[string]any{"anyOf": alternatives}},
+	}
+	return out
+}
+
+// flattenToolHistory rewrites earlier tool calls and results as plain messages, since
+// backends without tool support often reject tool roles in their chat templates.
+func flattenToolHistory(messages []any) []any {
+	out := make([]any, 0, len(messages))
+	names := make(map[string]string)
+	for _, m := range messages {
+		msg := asMap(m)
+		switch {
+		case asString(msg["role"]) == "assistant" && len(asSlice(msg["tool_calls"])) > 0:
+			var calls []string
+			for _, c := range asSlice(msg["tool_calls"]) {
+				call := asMap(c)
+				fn := asMap(call["function"])
+				names[asString(call["id"])] = asString(fn["name"])
+				encoded, _ := json.Marshal(map[string]any{"name": fn["name"], "arguments": toolArguments(fn["arguments"])})
+				calls = append(calls, string(encoded))
+			}
+			out = append(out, map[string]any{"role": "assistant", "content": strings.Join(calls, "\n")})
+		case asString(msg["role"]) == "tool":
+			name := names[asString(msg["tool_call_id"])]
+			if name == "" {
+				name = asString(msg["name"])
+			}
+			out = append(out, map[string]any{"role": "user", "content": "Result of " + name + ": " + asString(msg["content"])})
+		default:
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// grammarOutput decodes constrained output into either a tool call or plain content
+func grammarOutput(text string) (call map[string]any, content string, ok bool) {
+	var parsed map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &parsed); err != nil {
+		return nil, "", false
+	}
+	if name := asString(parsed["name"]); name != "" {
+		if _, hasArgs := parsed["arguments"]; hasArgs {
+			args, _ := json.Marshal(toolArguments(parsed["arguments"]))
+			return map[string]any{
+				"id":       newID("call_"),
+				"type":     "function",
+				"function": map[string]any{"name": name, "arguments": string(args)},
+			}, "", true
+		}
+	}
+	if text, isString := parsed["content"].(string); isString {
+		return nil, text, true
+	}
+	return nil, "", false
+}
+
+func grammarToToolsResponse(body map[string]any) map[string]any {
+	for _, c := range asSlice(body["choices"]) {
+		choice := asMap(c)
+		msg := asMap(choice["message"])
+		call, content, ok := grammarOutput(asString(msg["content"]))
+		if !ok {
+			continue
+		}
+		if call != nil {
+			msg["content"] = nil
+			msg["tool_calls"] = []any{call}
+			choice["finish_reason"] = "tool_calls"
+		} else {
+			msg["content"] = content
+		}
+	}
+	return body
+}
+
+// grammarToToolsStream buffers the constrained JSON, since a call can't be told apart from
+// content until it is complete, then emits it as a single delta before the final chunk.
+type grammarToToolsStream struct {
+	id           any
+	model        any
+	created      any
+	sentRole     bool
+	content      strings.Builder
+	finishReason any
+	usage        map[string]any
+}
+
+func (s *grammarToToolsStream) chunk(delta map[string]any, finishReason any) map[string]any {
+	created := s.created
+	if created == nil {
+		created = time.Now().Unix()
+	}
+	return map[string]any{
+		"id":      s.id,
+		"object":  "chat.completion.chunk",
+		"created": created,
+		"model":   s.model,
+		"choices": []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finishReason}},
+	}
+}
+
+func (s *grammarToToolsStream) Chunk(data map[string]any) []map[string]any {
+	if s.id == nil {
+		s.id, s.model, s.created = data["id"], data["model"], data["created"]
+	}
+	if usage := asMap(data["usage"]); usage != nil {
+		s.usage = usage
+	}
+	if choices := asSlice(data["choices"]); len(choices) > 0 {
+		choice := asMap(choices[0])
+		if reason, ok := choice["finish_reason"]; ok && reason != nil {
+			s.finishReason = reason
+		}
+		s.content.WriteString(asString(asMap(choice["delta"])["content"]))
+	}
+
+	// Send the role right away so clients see the stream open
+	if s.sentRole {
+		return nil
+	}
+	s.sentRole = true
+	return []map[string]any{s.chunk(map[string]any{"role": "assistant", "content": ""}, nil)}
+}
+
+func (s *grammarToToolsStream) Finish() []map[string]any {
+	finishReason := s.finishReason
+	delta := map[string]any{"content": s.content.String()}
+	if call, content, ok := grammarOutput(s.content.String()); ok {
+		if call != nil {
+			call["index"] = 0
+			delta = map[string]any{"tool_calls": []any{call}}
+			finishReason = "tool_calls"
+		} else {
+			delta = map[string]any{"content": content}
+		}
+	}
+	if finishReason == nil {
+		finishReason = "stop"
+	}
+
+	final := s.chunk(map[string]any{}, finishReason)
+	if s.usage != nil {
+		final["usage"] = s.usage
+	}
+	return []map[string]any{s.chunk(delta, nil), final}
+}
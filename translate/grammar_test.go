@@ -0,0 +1,108 @@
+package translate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToolsToGrammarRequest(t *testing.T) {
+	p := Lookup("openai-tools-via-grammar")
+	if p == nil {
+		t.Fatal("openai-tools-via-grammar profile not registered")
+	}
+	if p.TargetPath != "" {
+		t.Fatalf("grammar profile should keep the request path, got %q", p.TargetPath)
+	}
+
+	out := p.Request(map[string]any{
+		"model": "m",
+		"messages": []any{
+			map[string]any{"role": "user", "content": "weather?"},
+			map[string]any{"role": "assistant", "tool_calls": []any{map[string]any{
+				"id": "call_1", "function": map[string]any{"name": "weather", "arguments": `{"city":"Oslo"}`},
+			}}},
+			map[string]any{"role": "tool", "tool_call_id": "call_1", "content": "3C"},
+		},
+		"tools": []any{map[string]any{"type": "function", "function": map[string]any{
+			"name": "weather", "description": "get weather", "parameters": map[string]any{"type": "object"},
+		}}},
+	}, "/v1/chat/completions")
+
+	if _, ok := out["tools"]; ok {
+		t.Fatal("tools should be removed")
+	}
+	schema := out["response_format"].(map[string]any)["json_schema"].(map[string]any)["schema"].(map[string]any)
+	if alts := schema["anyOf"].([]any); len(alts) != 2 {
+		t.Fatalf("expected a tool alternative and a content alternative, got %v", alts)
+	}
+
+	messages := out["messages"].([]any)
+	if len(messages) != 4 || !strings.Contains(messages[0].(map[string]any)["content"].(string), "weather: get weather") {
+		t.Fatalf("expected tool instructions first, got %v", messages)
+	}
+	if messages[2].(map[string]any)["content"] != `{"arguments":{"city":"Oslo"},"name":"weather"}` {
+		t.Fatalf("assistant tool call not flattened: %v", messages[2])
+	}
+	if got := messages[3].(map[string]any); got["role"] != "user" || got["content"] != "Result of weather: 3C" {
+		t.Fatalf("tool result not flattened: %v", got)
+	}
+
+	required := p.Request(map[string]any{
+		"messages":    []any{},
+		"tool_choice": "required",
+		"tools":       []any{map[string]any{"function": map[string]any{"name": "weather"}}},
+	}, "")
+	schema = required["response_format"].(map[string]any)["json_schema"].(map[string]any)["schema"].(map[string]any)
+	if alts := schema["anyOf"].([]any); len(alts) != 1 {
+		t.Fatalf("tool_choice=required should not allow plain content, got %v", alts)
+	}
+}
+
+func TestGrammarToToolsResponse(t *testing.T) {
+	p := Lookup("openai-tools-via-grammar")
+
+	out := p.Response(map[string]any{"choices": []any{map[string]any{
+		"finish_reason": "stop",
+		"message":       map[string]any{"role": "assistant", "content": `{"name":"weather","arguments":{"city":"Oslo"}}`},
+	}}})
+	choice := out["choices"].([]any)[0].(map[string]any)
+	msg := choice["message"].(map[string]any)
+	if choice["finish_reason"] != "tool_calls" || msg["content"] != nil {
+		t.Fatalf("expected a tool call, got %v", choice)
+	}
+	fn := msg["tool_calls"].([]any)[0].(map[string]any)["function"].(map[string]any)
+	if fn["name"] != "weather" || fn["arguments"] != `{"city":"Oslo"}` {
+		t.Fatalf("function = %v", fn)
+	}
+
+	out = p.Response(map[string]any{"choices": []any{map[string]any{
+		"message": map[string]any{"content": `{"content":"It is 3C."}`},
+	}}})
+	if got := out["choices"].([]any)[0].(map[string]any)["message"].(map[string]any)["content"]; got != "It is 3C." {
+		t.Fatalf("content = %v", got)
+	}
+}
+
+func TestGrammarToToolsStream(t *testing.T) {
+	s := Lookup("openai-tools-via-grammar").NewStream()
+
+	first := s.Chunk(map[string]any{"id": "c1", "model": "m", "choices": []any{map[string]any{"delta": map[string]any{"content": `{"name":"f",`}}}})
+	if len(first) != 1 || first[0]["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)["role"] != "assistant" {
+		t.Fatalf("expected an opening role chunk, got %v", first)
+	}
+	if more := s.Chunk(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"content": `"arguments":{}}`}, "finish_reason": "stop"}}}); more != nil {
+		t.Fatalf("content should be buffered, got %v", more)
+	}
+
+	final := s.Finish()
+	if len(final) != 2 {
+		t.Fatalf("expected delta and final chunks, got %v", final)
+	}
+	delta := final[0]["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)
+	if calls, ok := delta["tool_calls"].([]any); !ok || len(calls) != 1 {
+		t.Fatalf("expected a tool call delta, got %v", delta)
+	}
+	if final[1]["choices"].([]any)[0].(map[string]any)["finish_reason"] != "tool_calls" {
+		t.Fatalf("final chunk = %v", final[1])
+	}
+}
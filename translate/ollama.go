@@ -0,0 +1,523 @@
+package translate
+
+import (
+	"encoding/json"
+	"maps"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(&Profile{
+		Name:       "openai-to-ollama",
+		TargetPath: "/api/chat",
+		Request:    openAIToOllamaRequest,
+		Response:   ollamaToOpenAIResponse,
+		NewStream: func() Stream {
+			return &ollamaToOpenAIStream{id: newID("chatcmpl-")}
+		},
+		SSE:        true,
+		DoneMarker: "[DONE]",
+	})
+	register(&Profile{
+		Name:       "ollama-to-openai",
+		TargetPath: "/v1/chat/completions",
+		Request:    ollamaToOpenAIRequest,
+		Response:   openAIToOllamaResponse,
+		Error:      openAIToOllamaError,
+		NewStream: func() Stream {
+			return &openAIToOllamaStream{}
+		},
+		SSE: false,
+	})
+}
+
+// openAIToOllamaOptions maps top-level OpenAI sampling params to Ollama options keys
+var openAIToOllamaOptions = map[string]string{
+	"max_tokens":        "num_predict",
+	"temperature":       "temperature",
+	"top_p":             "top_p",
+	"top_k":             "top_k",
+	"min_p":             "min_p",
+	"seed":              "seed",
+	"stop":              "stop",
+	"presence_penalty":  "presence_penalty",
+	"frequency_penalty": "frequency_penalty",
+	"repeat_penalty":    "repeat_penalty",
+}
+
+// ollamaToOpenAIOptions maps Ollama options keys to top-level OpenAI-compatible params.
+// Options that only make sense to Ollama (num_ctx, num_gpu, ...) are dropped.
+var ollamaToOpenAIOptions = map[string]string{
+	"num_predict":       "max_tokens",
+	"temperature":       "temperature",
+	"top_p":             "top_p",
+	"top_k":             "top_k",
+	"min_p":             "min_p",
+	"typical_p":         "typical_p",
+	"seed":              "seed",
+	"stop":              "stop",
+	"presence_penalty":  "presence_penalty",
+	"frequency_penalty": "frequency_penalty",
+	"repeat_penalty":    "repeat_penalty",
+	"repeat_last_n":     "repeat_last_n",
+	"mirostat":          "mirostat",
+	"mirostat_tau":      "mirostat_tau",
+	"mirostat_eta":      "mirostat_eta",
+}
+
+func openAIToOllamaRequest(body map[string]any, _ string) map[string]any {
+	out := make(map[string]any)
+	copyKeys(out, body, map[string]string{"model": "model", "tools": "tools", "keep_alive": "keep_alive", "think": "think"})
+
+	// OpenAI defaults to non-streaming, Ollama to streaming
+	out["stream"] = body["stream"] == true
+
+	if messages := asSlice(body["messages"]); messages != nil {
+		out["messages"] = openAIMessagesToOllama(messages)
+	}
+
+	options := make(map[string]any)
+	if existing := asMap(body["options"]); existing != nil {
+		maps.Copy(options, existing)
+	}
+	copyKeys(options, body, openAIToOllamaOptions)
+	if _, ok := options["num_predict"]; !ok {
+		if v, ok := body["max_completion_tokens"]; ok {
+			options["num_predict"] = v
+		}
+	}
+	if stop, ok := options["stop"].(string); ok {
+		options["stop"] = []any{stop}
+	}
+	if len(options) > 0 {
+		out["options"] = options
+	}
+
+	if format := openAIResponseFormatToOllama(asMap(body["response_format"])); format != nil {
+		out["format"] = format
+	}
+
+	return out
+}
+
+func ollamaToOpenAIRequest(body map[string]any, _ string) map[string]any {
+	out := make(map[string]any)
+	copyKeys(out, body, map[string]string{"model": "model", "tools": "tools"})
+
+	// Ollama defaults to streaming, OpenAI does not
+	stream := true
+	if v, ok := body["stream"].(bool); ok {
+		stream = v
+	}
+	out["stream"] = stream
+	if stream {
+		out["stream_options"] = map[string]any{"include_usage": true}
+	}
+
+	if messages := asSlice(body["messages"]); messages != nil {
+		out["messages"] = ollamaMessagesToOpenAI(messages)
+	}
+
+	copyKeys(out, asMap(body["options"]), ollamaToOpenAIOptions)
+
+	switch format := body["format"].(type) {
+	case string:
+		if format == "json" {
+			out["response_format"] = map[string]any{"type": "json_object"}
+		}
+	case map[string]any:
+		out["response_format"] = map[string]any{
+			"type":        "json_schema",
+			"json_schema": map[string]any{"name": "response", "schema": format},
+		}
+	}
+
+	return out
+}
+
+func openAIResponseFormatToOllama(format map[string]any) any {
+	switch asString(format["type"]) {
+	case "json_object":
+		return "json"
+	case "json_schema":
+		if schema := asMap(asMap(format["json_schema"])["schema"]); schema != nil {
+			return schema
+		}
+		return "json"
+	}
+	return nil
+}
+
+func openAIMessagesToOllama(messages []any) []any {
+	out := make([]any, 0, len(messages))
+	for _, m := range messages {
+		msg := asMap(m)
+		if msg == nil {
+			continue
+		}
+
+		converted := map[string]any{"role": msg["role"]}
+		switch content := msg["content"].(type) {
+		case string:
+			converted["content"] = content
+		case []any:
+			text, images := splitOpenAIContent(content)
+			converted["content"] = text
+			if len(images) > 0 {
+				converted["images"] = images
+			}
+		default:
+			converted["content"] = ""
+		}
+
+		if reasoning := asString(msg["reasoning_content"]); reasoning != "" {
+			converted["thinking"] = reasoning
+		}
+		if calls := asSlice(msg["tool_calls"]); len(calls) > 0 {
+			converted["tool_calls"] = openAIToolCallsToOllama(calls)
+		}
+		if name := asString(msg["name"]); name != "" && msg["role"] == "tool" {
+			converted["tool_name"] = name
+		}
+
+		out = append(out, converted)
+	}
+	return out
+}
+
+func ollamaMessagesToOpenAI(messages []any) []any {
+	out := make([]any, 0, len(messages))
+	for _, m := range messages {
+		msg := asMap(m)
+		if msg == nil {
+			continue
+		}
+
+		converted := map[string]any{"role": msg["role"]}
+		content := asString(msg["content"])
+		if images := asSlice(msg["images"]); len(images) > 0 {
+			parts := []any{map[string]any{"type": "text", "text": content}}
+			for _, img := range images {
+				data := asString(img)
+				if data == "" {
+					continue
+				}
+				parts = append(parts, map[string]any{
+					"type":      "image_url",
+					"image_url": map[string]any{"url": "data:" + sniffImageType(data) + ";base64," + data},
+				})
+			}
+			converted["content"] = parts
+		} else {
+			converted["content"] = content
+		}
+
+		if calls := asSlice(msg["tool_calls"]); len(calls) > 0 {
+			converted["tool_calls"] = ollamaToolCallsToOpenAI(calls, 0, false)
+		}
+		if name := asString(msg["tool_name"]); name != "" {
+			converted["name"] = name
+		}
+
+		out = append(out, converted)
+	}
+	return out
+}
+
+// splitOpenAIContent flattens OpenAI content parts into text plus raw base64 images.
+// Remote image URLs cannot be forwarded to Ollama and are dropped.
+func splitOpenAIContent(parts []any) (string, []any) {
+	var texts []string
+	var images []any
+	for _, p := range parts {
+		part := asMap(p)
+		switch asString(part["type"]) {
+		case "text":
+			texts = append(texts, asString(part["text"]))
+		case "image_url":
+			url := asString(part["image_url"])
+			if url == "" {
+				url = asString(asMap(part["image_url"])["url"])
+			}
+			if _, data, ok := strings.Cut(url, ";base64,"); ok && strings.HasPrefix(url, "data:") {
+				images = append(images, data)
+			}
+		}
+	}
+	return strings.Join(texts, "\n"), images
+}
+
+func sniffImageType(data string) string {
+	switch {
+	case strings.HasPrefix(data, "/9j/"):
+		return "image/jpeg"
+	case strings.HasPrefix(data, "R0lGOD"):
+		return "image/gif"
+	case strings.HasPrefix(data, "UklGR"):
+		return "image/webp"
+	}
+	return "image/png"
+}
+
+func openAIToolCallsToOllama(calls []any) []any {
+	out := make([]any, 0, len(calls))
+	for _, c := range calls {
+		fn := asMap(asMap(c)["function"])
+		if fn == nil {
+			continue
+		}
+		out = append(out, map[string]any{
+			"function": map[string]any{"name": fn["name"], "arguments": toolArguments(fn["arguments"])},
+		})
+	}
+	return out
+}
+
+// ollamaToolCallsToOpenAI converts Ollama tool calls (object arguments) into OpenAI tool calls
+// (string arguments). Streaming deltas additionally carry each call's index.
+func ollamaToolCallsToOpenAI(calls []any, startIndex int, streaming bool) []any {
+	out := make([]any, 0, len(calls))
+	for i, c := range calls {
+		fn := asMap(asMap(c)["function"])
+		if fn == nil {
+			continue
+		}
+		args := "{}"
+		switch raw := fn["arguments"].(type) {
+		case string:
+			args = raw
+		case nil:
+		default:
+			if b, err := json.Marshal(raw); err == nil {
+				args = string(b)
+			}
+		}
+		call := map[string]any{
+			"id":       newID("call_"),
+			"type":     "function",
+			"function": map[string]any{"name": fn["name"], "arguments": args},
+		}
+		if streaming {
+			call["index"] = startIndex + i
+		}
+		out = append(out, call)
+	}
+	return out
+}
+
+func ollamaFinishReason(doneReason any, hasToolCalls bool) string {
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	if asString(doneReason) == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+func ollamaDoneReason(finishReason any) string {
+	if asString(finishReason) == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+// openAIToOllamaError returns Ollama's {"error": "..."}
+func openAIToOllamaError(_ int, normalized map[string]any) map[string]any {
+	return map[string]any{"error": errorMessage(normalized)}
+}
+
+func ollamaUsage(body map[string]any) map[string]any {
+	prompt, hasPrompt := asNumber(body["prompt_eval_count"])
+	completion, hasCompletion := asNumber(body["eval_count"])
+	if !hasPrompt && !hasCompletion {
+		return nil
+	}
+	return map[string]any{
+		"prompt_tokens":     prompt,
+		"completion_tokens": completion,
+		"total_tokens":      prompt + completion,
+	}
+}
+
+func ollamaToOpenAIResponse(body map[string]any) map[string]any {
+	message := map[string]any{"role": "assistant", "content": ""}
+	hasToolCalls := false
+	if msg := asMap(body["message"]); msg != nil {
+		if role := asString(msg["role"]); role != "" {
+			message["role"] = role
+		}
+		message["content"] = asString(msg["content"])
+		if thinking := asString(msg["thinking"]); thinking != "" {
+			message["reasoning_content"] = thinking
+		}
+		if calls := asSlice(msg["tool_calls"]); len(calls) > 0 {
+			message["tool_calls"] = ollamaToolCallsToOpenAI(calls, 0, false)
+			hasToolCalls = true
+		}
+	}
+
+	out := map[string]any{
+		"id":      newID("chatcmpl-"),
+		"object":  "chat.completion",
+		"created": unixFromRFC3339(body["created_at"]),
+		"model":   body["model"],
+		"choices": []any{map[string]any{
+			"index":         0,
+			"message":       message,
+			"finish_reason": ollamaFinishReason(body["done_reason"], hasToolCalls),
+		}},
+	}
+	if usage := ollamaUsage(body); usage != nil {
+		out["usage"] = usage
+	}
+	return out
+}
+
+func openAIToOllamaResponse(body map[string]any) map[string]any {
+	message := map[string]any{"role": "assistant", "content": ""}
+	var finishReason any
+	if choices := asSlice(body["choices"]); len(choices) > 0 {
+		choice := asMap(choices[0])
+		finishReason = choice["finish_reason"]
+		if msg := asMap(choice["message"]); msg != nil {
+			message["content"] = asString(msg["content"])
+			if reasoning := asString(msg["reasoning_content"]); reasoning != "" {
+				message["thinking"] = reasoning
+			}
+			if calls := asSlice(msg["tool_calls"]); len(calls) > 0 {
+				message["tool_calls"] = openAIToolCallsToOllama(calls)
+			}
+		}
+	}
+
+	out := map[string]any{
+		"model":       body["model"],
+		"created_at":  rfc3339FromUnix(body["created"]),
+		"message":     message,
+		"done":        true,
+		"done_reason": ollamaDoneReason(finishReason),
+	}
+	if usage := asMap(body["usage"]); usage != nil {
+		out["prompt_eval_count"] = usage["prompt_tokens"]
+		out["eval_count"] = usage["completion_tokens"]
+	}
+	return out
+}
+
+// ollamaToOpenAIStream turns Ollama NDJSON chunks into OpenAI chat.completion.chunk events.
+type ollamaToOpenAIStream struct {
+	id        string
+	sentRole  bool
+	toolCalls int
+}
+
+func (s *ollamaToOpenAIStream) Chunk(data map[string]any) []map[string]any {
+	delta := make(map[string]any)
+	if !s.sentRole {
+		delta["role"] = "assistant"
+		s.sentRole = true
+	}
+
+	if msg := asMap(data["message"]); msg != nil {
+		if content := asString(msg["content"]); content != "" {
+			delta["content"] = content
+		}
+		if thinking := asString(msg["thinking"]); thinking != "" {
+			delta["reasoning_content"] = thinking
+		}
+		if calls := asSlice(msg["tool_calls"]); len(calls) > 0 {
+			delta["tool_calls"] = ollamaToolCallsToOpenAI(calls, s.toolCalls, true)
+			s.toolCalls += len(calls)
+		}
+	}
+
+	choice := map[string]any{"index": 0, "delta": delta, "finish_reason": nil}
+	chunk := map[string]any{
+		"id":      s.id,
+		"object":  "chat.completion.chunk",
+		"created": unixFromRFC3339(data["created_at"]),
+		"model":   data["model"],
+		"choices": []any{choice},
+	}
+
+	if data["done"] == true {
+		choice["finish_reason"] = ollamaFinishReason(data["done_reason"], s.toolCalls > 0)
+		if usage := ollamaUsage(data); usage != nil {
+			chunk["usage"] = usage
+		}
+	}
+
+	return []map[string]any{chunk}
+}
+
+func (s *ollamaToOpenAIStream) Finish() []map[string]any {
+	return nil
+}
+
+// openAIToOllamaStream turns OpenAI chat.completion.chunk events into Ollama NDJSON chunks.
+// Tool call fragments are accumulated and emitted whole on the final chunk.
+type openAIToOllamaStream struct {
+	model        any
+	finishReason any
+	usage        map[string]any
+	toolCalls    toolCallAccumulator
+}
+
+func (s *openAIToOllamaStream) chunk(message map[string]any, done bool) map[string]any {
+	return map[string]any{
+		"model":      s.model,
+		"created_at": time.Now().UTC().Format(time.RFC3339Nano),
+		"message":    message,
+		"done":       done,
+	}
+}
+
+func (s *openAIToOllamaStream) Chunk(data map[string]any) []map[string]any {
+	if model, ok := data["model"]; ok {
+		s.model = model
+	}
+	if usage := asMap(data["usage"]); usage != nil {
+		s.usage = usage
+	}
+
+	choices := asSlice(data["choices"])
+	if len(choices) == 0 {
+		return nil
+	}
+	choice := asMap(choices[0])
+	if reason, ok := choice["finish_reason"]; ok && reason != nil {
+		s.finishReason = reason
+	}
+
+	delta := asMap(choice["delta"])
+	s.toolCalls.add(asSlice(delta["tool_calls"]))
+
+	content := asString(delta["content"])
+	reasoning := asString(delta["reasoning_content"])
+	if content == "" && reasoning == "" {
+		return nil
+	}
+
+	message := map[string]any{"role": "assistant", "content": content}
+	if reasoning != "" {
+		message["thinking"] = reasoning
+	}
+	return []map[string]any{s.chunk(message, false)}
+}
+
+func (s *openAIToOllamaStream) Finish() []map[string]any {
+	message := map[string]any{"role": "assistant", "content": ""}
+	if calls := s.toolCalls.openAICalls(); len(calls) > 0 {
+		message["tool_calls"] = openAIToolCallsToOllama(calls)
+	}
+
+	final := s.chunk(message, true)
+	final["done_reason"] = ollamaDoneReason(s.finishReason)
+	if s.usage != nil {
+		final["prompt_eval_count"] = s.usage["prompt_tokens"]
+		final["eval_count"] = s.usage["completion_tokens"]
+	}
+	return []map[string]any{final}
+}
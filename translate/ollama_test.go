@@ -0,0 +1,174 @@
+package translate
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestOpenAIToOllamaRequest(t *testing.T) {
+	p := Lookup("openai-to-ollama")
+	if p == nil {
+		t.Fatal("openai-to-ollama profile not registered")
+	}
+
+	out := p.Request(map[string]any{
+		"model":       "llama3",
+		"max_tokens":  128.0,
+		"temperature": 0.2,
+		"stop":        "###",
+		"user":        "dropped",
+		"messages": []any{
+			map[string]any{"role": "system", "content": "be brief"},
+			map[string]any{"role": "user", "content": []any{
+				map[string]any{"type": "text", "text": "what is this?"},
+				map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/png;base64,AAAA"}},
+			}},
+		},
+		"response_format": map[string]any{"type": "json_object"},
+	}, "/v1/chat/completions")
+
+	if out["stream"] != false {
+		t.Fatalf("stream should default to false, got %v", out["stream"])
+	}
+	if _, exists := out["user"]; exists {
+		t.Fatalf("unknown OpenAI fields should be dropped, got %v", out)
+	}
+	if out["format"] != "json" {
+		t.Fatalf("format = %v, want json", out["format"])
+	}
+
+	options := out["options"].(map[string]any)
+	if options["num_predict"] != 128.0 || options["temperature"] != 0.2 {
+		t.Fatalf("sampling params not moved into options: %v", options)
+	}
+	if !reflect.DeepEqual(options["stop"], []any{"###"}) {
+		t.Fatalf("stop should be normalized to a list, got %v", options["stop"])
+	}
+
+	user := out["messages"].([]any)[1].(map[string]any)
+	if user["content"] != "what is this?" {
+		t.Fatalf("content parts not flattened, got %v", user["content"])
+	}
+	if !reflect.DeepEqual(user["images"], []any{"AAAA"}) {
+		t.Fatalf("images not extracted, got %v", user["images"])
+	}
+}
+
+func TestOllamaToOpenAIResponse(t *testing.T) {
+	out := Lookup("openai-to-ollama").Response(map[string]any{
+		"model":      "llama3",
+		"created_at": "2024-01-01T00:00:00Z",
+		"message": map[string]any{
+			"role":    "assistant",
+			"content": "",
+			"tool_calls": []any{
+				map[string]any{"function": map[string]any{"name": "lookup", "arguments": map[string]any{"q": "x"}}},
+			},
+		},
+		"done":              true,
+		"done_reason":       "stop",
+		"prompt_eval_count": 10.0,
+		"eval_count":        5.0,
+	})
+
+	if out["object"] != "chat.completion" || out["created"] != int64(1704067200) {
+		t.Fatalf("unexpected envelope: %v", out)
+	}
+	choice := out["choices"].([]any)[0].(map[string]any)
+	if choice["finish_reason"] != "tool_calls" {
+		t.Fatalf("finish_reason = %v, want tool_calls", choice["finish_reason"])
+	}
+	call := choice["message"].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	if call["function"].(map[string]any)["arguments"] != `{"q":"x"}` {
+		t.Fatalf("tool call arguments should be a JSON string, got %v", call)
+	}
+	usage := out["usage"].(map[string]any)
+	if usage["total_tokens"] != 15.0 {
+		t.Fatalf("usage total = %v, want 15", usage["total_tokens"])
+	}
+}
+
+func TestOllamaToOpenAIRequestAndResponse(t *testing.T) {
+	p := Lookup("ollama-to-openai")
+
+	req := p.Request(map[string]any{
+		"model":    "llama3",
+		"messages": []any{map[string]any{"role": "user", "content": "hi", "images": []any{"/9j/abc"}}},
+		"options":  map[string]any{"num_predict": 64.0, "num_ctx": 4096.0, "top_k": 40.0},
+		"format":   map[string]any{"type": "object"},
+	}, "/api/chat")
+
+	if req["stream"] != true {
+		t.Fatalf("stream should default to true, got %v", req["stream"])
+	}
+	if req["max_tokens"] != 64.0 || req["top_k"] != 40.0 {
+		t.Fatalf("options not hoisted: %v", req)
+	}
+	if _, exists := req["num_ctx"]; exists {
+		t.Fatalf("ollama-only options should be dropped: %v", req)
+	}
+	if req["response_format"].(map[string]any)["type"] != "json_schema" {
+		t.Fatalf("schema format not converted: %v", req["response_format"])
+	}
+	parts := req["messages"].([]any)[0].(map[string]any)["content"].([]any)
+	image := parts[1].(map[string]any)["image_url"].(map[string]any)["url"]
+	if image != "data:image/jpeg;base64,/9j/abc" {
+		t.Fatalf("image url = %v", image)
+	}
+
+	resp := p.Response(map[string]any{
+		"model":   "llama3",
+		"created": 1704067200.0,
+		"choices": []any{map[string]any{
+			"message":       map[string]any{"role": "assistant", "content": "hello"},
+			"finish_reason": "length",
+		}},
+		"usage": map[string]any{"prompt_tokens": 3.0, "completion_tokens": 7.0},
+	})
+	if resp["done"] != true || resp["done_reason"] != "length" || resp["eval_count"] != 7.0 {
+		t.Fatalf("unexpected ollama response: %v", resp)
+	}
+	if resp["message"].(map[string]any)["content"] != "hello" {
+		t.Fatalf("content not carried over: %v", resp["message"])
+	}
+}
+
+func TestOpenAIToOllamaStreamAccumulatesToolCalls(t *testing.T) {
+	s := Lookup("ollama-to-openai").NewStream()
+
+	chunks := s.Chunk(map[string]any{"model": "m", "choices": []any{map[string]any{
+		"delta": map[string]any{"content": "Hi"},
+	}}})
+	if len(chunks) != 1 || chunks[0]["done"] != false {
+		t.Fatalf("expected one content chunk, got %v", chunks)
+	}
+
+	for _, fragment := range []string{`{"q":`, `"x"}`} {
+		s.Chunk(map[string]any{"choices": []any{map[string]any{
+			"delta": map[string]any{"tool_calls": []any{map[string]any{
+				"index":    0.0,
+				"function": map[string]any{"name": "lookup", "arguments": fragment},
+			}}},
+		}}})
+	}
+	s.Chunk(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{}, "finish_reason": "tool_calls"}}})
+	s.Chunk(map[string]any{"choices": []any{}, "usage": map[string]any{"prompt_tokens": 1.0, "completion_tokens": 2.0}})
+
+	final := s.Finish()
+	if len(final) != 1 || final[0]["done"] != true || final[0]["eval_count"] != 2.0 {
+		t.Fatalf("unexpected final chunk: %v", final)
+	}
+	calls := final[0]["message"].(map[string]any)["tool_calls"].([]any)
+	args := calls[0].(map[string]any)["function"].(map[string]any)["arguments"]
+	if !reflect.DeepEqual(args, map[string]any{"q": "x"}) {
+		t.Fatalf("tool call arguments = %v", args)
+	}
+}
+
+func TestNamesSorted(t *testing.T) {
+	names := Names()
+	if !sort.StringsAreSorted(names) || len(names) < 2 {
+		t.Fatalf("Names() = %v", names)
+	}
+}
@@ -0,0 +1,214 @@
+package translate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Profile translates between the dialect a client speaks and the dialect the backend speaks.
+// Request runs after on_request actions; Response runs before on_response actions, so rules
+// always see the client's dialect.
+type Profile struct {
+	Name string
+
+	// TargetPath is the backend path used when no matched route sets target_path
+	TargetPath string
+
+	// Request converts a client request body into the backend dialect. Path is the
+	// inbound request path, for dialects that carry parameters in the URL.
+	Request func(body map[string]any, path string) map[string]any
+
+	// Response converts a backend response body into the client dialect
+	Response func(body map[string]any) map[string]any
+
+	// Error converts a backend error, already normalized to OpenAI's shape, into the client
+	// dialect. Nil keeps the OpenAI shape.
+	Error func(status int, normalized map[string]any) map[string]any
+
+	// NewStream returns per-stream state for translating streamed chunks
+	NewStream func() Stream
+
+	// SSE reports whether clients expect `data:` framed events rather than newline-delimited JSON
+	SSE bool
+
+	// DoneMarker is sent as the final SSE event when set (ex: [DONE])
+	DoneMarker string
+
+	// EventField names the chunk field echoed as each SSE `event:` line, for dialects
+	// whose clients dispatch on event names
+	EventField string
+}
+
+// Stream translates the chunks of a single streamed response.
+type Stream interface {
+	// Chunk converts one upstream chunk into zero or more client chunks
+	Chunk(data map[string]any) []map[string]any
+
+	// Finish is called once when the upstream stream ends and returns any trailing chunks
+	Finish() []map[string]any
+}
+
+// StreamContentType returns the content type clients of this profile expect for streams.
+func (p *Profile) StreamContentType() string {
+	if p.SSE {
+		return "text/event-stream"
+	}
+	return "application/x-ndjson"
+}
+
+// TranslateError rewrites a backend error body for the client: normalized to OpenAI's
+// shape, then converted by Error when the client speaks another dialect.
+func (p *Profile) TranslateError(status int, body []byte) []byte {
+	normalized := NormalizeError(status, body)
+	if p.Error != nil {
+		normalized = p.Error(status, normalized)
+	}
+	encoded, _ := json.Marshal(normalized)
+	return encoded
+}
+
+var profiles = map[string]*Profile{}
+
+func register(p *Profile) {
+	profiles[p.Name] = p
+}
+
+// Lookup returns the named profile, or nil if it does not exist.
+func Lookup(name string) *Profile {
+	return profiles[name]
+}
+
+// Names returns all registered profile names in sorted order.
+func Names() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newID(prefix string) string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return prefix + "0"
+	}
+	return prefix + hex.EncodeToString(b)
+}
+
+func asMap(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+func asString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func asNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// copyKeys copies the listed keys from src to dst when present, optionally renaming them.
+func copyKeys(dst, src map[string]any, keys map[string]string) {
+	for from, to := range keys {
+		if v, ok := src[from]; ok {
+			dst[to] = v
+		}
+	}
+}
+
+func unixFromRFC3339(value any) int64 {
+	if s := asString(value); s != "" {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t.Unix()
+		}
+	}
+	return time.Now().Unix()
+}
+
+func rfc3339FromUnix(value any) string {
+	if n, ok := asNumber(value); ok && n > 0 {
+		return time.Unix(int64(n), 0).UTC().Format(time.RFC3339Nano)
+	}
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+// toolArguments parses OpenAI string arguments into an object; object arguments pass through
+func toolArguments(raw any) map[string]any {
+	args := map[string]any{}
+	switch v := raw.(type) {
+	case string:
+		if v != "" {
+			json.Unmarshal([]byte(v), &args)
+		}
+	case map[string]any:
+		args = v
+	}
+	return args
+}
+
+type partialToolCall struct {
+	name      string
+	arguments strings.Builder
+}
+
+// toolCallAccumulator reassembles OpenAI streaming tool call fragments, keyed by index.
+type toolCallAccumulator struct {
+	calls map[int]*partialToolCall
+	order []int
+}
+
+func (a *toolCallAccumulator) add(deltaCalls []any) {
+	if a.calls == nil {
+		a.calls = make(map[int]*partialToolCall)
+	}
+	for _, c := range deltaCalls {
+		call := asMap(c)
+		idx := 0
+		if n, ok := asNumber(call["index"]); ok {
+			idx = int(n)
+		}
+		partial, exists := a.calls[idx]
+		if !exists {
+			partial = &partialToolCall{}
+			a.calls[idx] = partial
+			a.order = append(a.order, idx)
+		}
+		fn := asMap(call["function"])
+		if name := asString(fn["name"]); name != "" {
+			partial.name = name
+		}
+		partial.arguments.WriteString(asString(fn["arguments"]))
+	}
+}
+
+// openAICalls returns the completed calls in OpenAI shape (string arguments).
+func (a *toolCallAccumulator) openAICalls() []any {
+	calls := make([]any, 0, len(a.order))
+	for _, idx := range a.order {
+		partial := a.calls[idx]
+		calls = append(calls, map[string]any{
+			"function": map[string]any{"name": partial.name, "arguments": partial.arguments.String()},
+		})
+	}
+	return calls
+}
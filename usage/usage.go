@@ -0,0 +1,233 @@
+// Package usage aggregates requests, tokens, and cost per API key, model, and route.
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retention is how long hourly buckets are kept before being pruned
+const Retention = 31 * 24 * time.Hour
+
+// Entry is one completed request
+type Entry struct {
+	APIKey           string
+	Model            string
+	Route            string
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+}
+
+// Totals are summed counters for a group of requests
+type Totals struct {
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func (t *Totals) add(o Totals) {
+	t.Requests += o.Requests
+	t.PromptTokens += o.PromptTokens
+	t.CompletionTokens += o.CompletionTokens
+	t.Cost += o.Cost
+}
+
+// Row is the usage of one API key, model, and route combination
+type Row struct {
+	APIKey string `json:"api_key"`
+	Model  string `json:"model"`
+	Route  string `json:"route"`
+	Totals
+}
+
+// Report summarizes usage since a point in time
+type Report struct {
+	Since time.Time `json:"since"`
+	Rows  []Row     `json:"rows"`
+	Total Totals    `json:"total"`
+}
+
+type bucketKey struct {
+	Hour   int64 // Unix seconds, truncated to the hour
+	APIKey string
+	Model  string
+	Route  string
+}
+
+// Store holds hourly usage buckets in memory
+type Store struct {
+	mu      sync.Mutex
+	buckets map[bucketKey]*Totals
+	now     func() time.Time
+}
+
+// NewStore creates an empty store
+func NewStore() *Store {
+	return &Store{buckets: make(map[bucketKey]*Totals), now: time.Now}
+}
+
+// Default is the process-wide store fed by the proxies and read by the admin endpoint
+var Default = NewStore()
+
+// Record adds a completed request to the current hour's bucket
+func (s *Store) Record(e Entry) {
+	key := bucketKey{
+		Hour:   s.now().Truncate(time.Hour).Unix(),
+		APIKey: e.APIKey,
+		Model:  e.Model,
+		Route:  e.Route,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals, ok := s.buckets[key]
+	if !ok {
+		totals = &Totals{}
+		s.buckets[key] = totals
+		s.pruneLocked()
+	}
+	totals.add(Totals{
+		Requests:         1,
+		PromptTokens:     int64(e.PromptTokens),
+		CompletionTokens: int64(e.CompletionTokens),
+		Cost:             e.Cost,
+	})
+}
+
+// pruneLocked drops buckets older than Retention; called when a new bucket is created
+func (s *Store) pruneLocked() {
+	cutoff := s.now().Add(-Retention).Unix()
+	for key := range s.buckets {
+		if key.Hour < cutoff {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// Report sums usage over the trailing window. Buckets are hourly, so the window is
+// widened to the start of the hour it begins in.
+func (s *Store) Report(window time.Duration) Report {
+	since := s.now().Add(-window).Truncate(time.Hour)
+
+	s.mu.Lock()
+	grouped := make(map[bucketKey]*Totals)
+	for key, totals := range s.buckets {
+		if key.Hour < since.Unix() {
+			continue
+		}
+		group := bucketKey{APIKey: key.APIKey, Model: key.Model, Route: key.Route}
+		if grouped[group] == nil {
+			grouped[group] = &Totals{}
+		}
+		grouped[group].add(*totals)
+	}
+	s.mu.Unlock()
+
+	report := Report{Since: since, Rows: make([]Row, 0, len(grouped))}
+	for key, totals := range grouped {
+		report.Rows = append(report.Rows, Row{APIKey: key.APIKey, Model: key.Model, Route: key.Route, Totals: *totals})
+		report.Total.add(*totals)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.APIKey+a.Model+a.Route < b.APIKey+b.Model+b.Route
+	})
+	return report
+}
+
+type persistedBucket struct {
+	Hour   int64  `json:"hour"`
+	APIKey string `json:"api_key"`
+	Model  string `json:"model"`
+	Route  string `json:"route"`
+	Totals
+}
+
+// Save writes all buckets to path, replacing it atomically
+func (s *Store) Save(path string) error {
+	s.mu.Lock()
+	buckets := make([]persistedBucket, 0, len(s.buckets))
+	for key, totals := range s.buckets {
+		buckets = append(buckets, persistedBucket{Hour: key.Hour, APIKey: key.APIKey, Model: key.Model, Route: key.Route, Totals: *totals})
+	}
+	s.mu.Unlock()
+
+	data, err := json.Marshal(buckets)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load merges buckets saved at path into the store. A missing file is not an error.
+func (s *Store) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var buckets []persistedBucket
+	if err := json.Unmarshal(data, &buckets); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range buckets {
+		key := bucketKey{Hour: b.Hour, APIKey: b.APIKey, Model: b.Model, Route: b.Route}
+		if s.buckets[key] == nil {
+			s.buckets[key] = &Totals{}
+		}
+		s.buckets[key].add(b.Totals)
+	}
+	s.pruneLocked()
+	return nil
+}
+
+// KeyLabel identifies the API key in an Authorization header without storing the secret
+func KeyLabel(authorization string) string {
+	key := strings.TrimSpace(authorization)
+	if len(key) > 7 && strings.EqualFold(key[:7], "bearer ") {
+		key = strings.TrimSpace(key[7:])
+	}
+	switch {
+	case key == "":
+		return "anonymous"
+	case len(key) <= 8:
+		return "…"
+	default:
+		return "…" + key[len(key)-4:]
+	}
+}
@@ -0,0 +1,74 @@
+package usage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(now *time.Time) *Store {
+	s := NewStore()
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestStoreReportWindow(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 30, 0, 0, time.UTC)
+	s := newTestStore(&now)
+
+	s.Record(Entry{APIKey: "…abcd", Model: "llama3", Route: "0", PromptTokens: 10, CompletionTokens: 5, Cost: 0.5})
+
+	now = now.Add(30 * time.Hour)
+	s.Record(Entry{APIKey: "…abcd", Model: "llama3", Route: "0", PromptTokens: 1, CompletionTokens: 1, Cost: 0.1})
+	s.Record(Entry{APIKey: "…abcd", Model: "llama3", Route: "0", PromptTokens: 1, CompletionTokens: 1, Cost: 0.1})
+	s.Record(Entry{APIKey: "anonymous", Model: "qwen3", Route: "-"})
+
+	recent := s.Report(24 * time.Hour)
+	if recent.Total.Requests != 3 || len(recent.Rows) != 2 {
+		t.Fatalf("24h report = %+v, want 3 requests in 2 rows", recent)
+	}
+	if top := recent.Rows[0]; top.Model != "llama3" || top.Requests != 2 || top.PromptTokens != 2 {
+		t.Fatalf("top row = %+v, want llama3 with 2 requests", top)
+	}
+
+	all := s.Report(48 * time.Hour)
+	if all.Total.Requests != 4 || all.Total.PromptTokens != 12 {
+		t.Fatalf("48h totals = %+v, want 4 requests and 12 prompt tokens", all.Total)
+	}
+}
+
+func TestStoreSaveLoad(t *testing.T) {
+	now := time.Now()
+	path := filepath.Join(t.TempDir(), "usage.json")
+
+	s := newTestStore(&now)
+	s.Record(Entry{APIKey: "…abcd", Model: "llama3", Route: "0", PromptTokens: 7, Cost: 1.25})
+	if err := s.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	restored := newTestStore(&now)
+	if err := restored.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if total := restored.Report(time.Hour).Total; total.Requests != 1 || total.PromptTokens != 7 || total.Cost != 1.25 {
+		t.Fatalf("restored totals = %+v", total)
+	}
+
+	if err := NewStore().Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Fatalf("missing file should load as empty, got %v", err)
+	}
+}
+
+func TestKeyLabel(t *testing.T) {
+	tests := map[string]string{
+		"":                       "anonymous",
+		"Bearer sk-secret-12345": "…2345",
+		"bearer short":           "…",
+	}
+	for header, want := range tests {
+		if got := KeyLabel(header); got != want {
+			t.Errorf("KeyLabel(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
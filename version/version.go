@@ -0,0 +1,87 @@
+// Package version reports which build is running. Release builds set Version, Commit, and
+// Date with -ldflags "-X"; otherwise they come from the module and VCS info Go embeds.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at build time, ex: -ldflags "-X github.com/spicyneuron/llama-matchmaker/version.Version=v1.2.0"
+var (
+	Version string
+	Commit  string
+	Date    string
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a tree with uncommitted changes
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// Get returns the build info, preferring values set at build time
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, s := range build.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+// ShortCommit returns the first 12 characters of the commit
+func (i Info) ShortCommit() string {
+	if len(i.Commit) > 12 {
+		return i.Commit[:12]
+	}
+	return i.Commit
+}
+
+// String formats the info for --version, ex: "v1.2.0 (commit 3d805a1c9e2f, built
+// 2026-10-01T12:00:00Z, go1.25.0 linux/amd64)"
+func (i Info) String() string {
+	var details []string
+	if i.Commit != "" {
+		commit := "commit " + i.ShortCommit()
+		if i.Modified {
+			commit += "-dirty"
+		}
+		details = append(details, commit)
+	}
+	if i.Date != "" {
+		details = append(details, "built "+i.Date)
+	}
+	details = append(details, i.GoVersion+" "+i.Platform)
+	return fmt.Sprintf("%s (%s)", i.Version, strings.Join(details, ", "))
+}
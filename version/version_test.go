@@ -0,0 +1,35 @@
+package version
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGetPrefersBuildTimeValues(t *testing.T) {
+	defer func(v, c, d string) { Version, Commit, Date = v, c, d }(Version, Commit, Date)
+	Version, Commit, Date = "v1.2.0", "3d805a1c9e2f4b5a6c7d8e9f0a1b2c3d4e5f6a7b", "2026-10-01T12:00:00Z"
+
+	info := Get()
+	if info.Version != "v1.2.0" || info.Commit != Commit || info.Date != Date {
+		t.Fatalf("info = %+v", info)
+	}
+	if info.GoVersion != runtime.Version() || info.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Fatalf("runtime = %s %s", info.GoVersion, info.Platform)
+	}
+
+	want := "v1.2.0 (commit 3d805a1c9e2f"
+	if s := info.String(); !strings.HasPrefix(s, want) || !strings.Contains(s, "built 2026-10-01T12:00:00Z, "+runtime.Version()) {
+		t.Fatalf("String() = %q", s)
+	}
+}
+
+func TestGetDefaultsToDev(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+	Version = ""
+
+	// Test binaries have no module version
+	if info := Get(); info.Version != "dev" {
+		t.Fatalf("version = %q, want dev", info.Version)
+	}
+}